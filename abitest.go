@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+	"github.com/ku-lang/ku/semantic"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// ABI布局测试（ku abitest）
+//
+// 用随机种子生成一组 [layout(c)] 结构体和联合体，成员是各种基本类型、指针、定长数组以及前面生成的类型，
+// 其中一部分结构体带有 [packed]；同时生成对应的C声明。
+// ku一侧的源码经过解析、变量解析、类型推导和语义检查，再由代码生成器计算每个类型在目标平台（--target）上的
+// 大小、对齐和成员偏移；C一侧把这些值写成 _Static_assert，交给C编译器（--cc）编译。
+// 任何一个断言不成立都说明ku与C的布局不一致，C编译器的报错中列出了不一致的类型和成员。
+//
+// C代码只编译不运行，所以只要C编译器支持，交叉编译的目标也能检查：clang会加上 --target=<三元组>，
+// 其它编译器应该是目标平台的交叉编译器，如 --cc aarch64-linux-gnu-gcc。
+// 种子固定时生成的类型也固定，CI中用默认的种子运行即可发现布局的回归。
+//
+// 给出ku源文件时不生成类型，而是检查其中所有的 [layout(c)] 结构体和联合体，C声明由它们的成员类型得出。
+// tests/abi 中是这样的一组类型，覆盖随机生成不容易遇到的情况（参见 tests/run.sh）。
+
+// abiType 成员的类型在ku和C中的写法
+type abiType struct {
+	ku     string // ku中的类型，如 [4]u16
+	c      string // C中的类型，如 uint16_t
+	suffix string // C声明中跟在成员名之后的数组长度，如 [4]
+}
+
+// abiPrimitives 基本类型在C中对应的类型。int、uint与指针一样大
+var abiPrimitives = []abiType{
+	{ku: "s8", c: "int8_t"},
+	{ku: "s16", c: "int16_t"},
+	{ku: "s32", c: "int32_t"},
+	{ku: "s64", c: "int64_t"},
+	{ku: "u8", c: "uint8_t"},
+	{ku: "u16", c: "uint16_t"},
+	{ku: "u32", c: "uint32_t"},
+	{ku: "u64", c: "uint64_t"},
+	{ku: "f32", c: "float"},
+	{ku: "f64", c: "double"},
+	{ku: "bool", c: "_Bool"},
+	{ku: "int", c: "intptr_t"},
+	{ku: "uint", c: "uintptr_t"},
+	{ku: "uintptr", c: "uintptr_t"},
+	{ku: "^u8", c: "uint8_t *"},
+}
+
+// abiField 结构体或联合体的成员
+type abiField struct {
+	name string
+	typ  abiType
+}
+
+// abiCase 一个要检查的结构体或联合体
+type abiCase struct {
+	name   string
+	union  bool
+	packed bool
+	fields []abiField
+}
+
+// 生成的类型的成员个数上限，以及定长数组的长度上限
+const (
+	abiMaxFields   = 8
+	abiMaxArrayLen = 4
+)
+
+type abiGenerator struct {
+	rand  *rand.Rand
+	cases []*abiCase
+}
+
+// genType 随机的成员类型。depth限制数组嵌套的层数
+func (v *abiGenerator) genType(depth int) abiType {
+	switch n := v.rand.Intn(10); {
+	case n < 6 || depth == 0:
+		return abiPrimitives[v.rand.Intn(len(abiPrimitives))]
+	case n < 8:
+		elem := v.genType(depth - 1)
+		length := 1 + v.rand.Intn(abiMaxArrayLen)
+		return abiType{
+			ku:     fmt.Sprintf("[%d]%s", length, elem.ku),
+			c:      elem.c,
+			suffix: fmt.Sprintf("[%d]%s", length, elem.suffix),
+		}
+	default:
+		// 前面生成的类型，或者指向它的指针
+		if len(v.cases) == 0 {
+			return abiPrimitives[v.rand.Intn(len(abiPrimitives))]
+		}
+		other := v.cases[v.rand.Intn(len(v.cases))]
+		typ := abiType{ku: other.name, c: other.cKeyword() + " " + other.name}
+		if v.rand.Intn(4) == 0 {
+			typ.ku, typ.c = "^"+typ.ku, typ.c+" *"
+		}
+		return typ
+	}
+}
+
+func (v *abiGenerator) genCase() {
+	c := &abiCase{
+		name:  fmt.Sprintf("AbiTest%d", len(v.cases)),
+		union: v.rand.Intn(5) == 0,
+	}
+	// 联合体不能是packed
+	c.packed = !c.union && v.rand.Intn(5) == 0
+
+	count := 1 + v.rand.Intn(abiMaxFields)
+	for i := 0; i < count; i++ {
+		c.fields = append(c.fields, abiField{name: fmt.Sprintf("f%d", i), typ: v.genType(2)})
+	}
+	v.cases = append(v.cases, c)
+}
+
+func (v *abiCase) cKeyword() string {
+	if v.union {
+		return "union"
+	}
+	return "struct"
+}
+
+func (v *abiCase) kuSource() string {
+	buf := new(bytes.Buffer)
+	if v.packed {
+		buf.WriteString("[layout(c), packed]\n")
+	} else {
+		buf.WriteString("[layout(c)]\n")
+	}
+	keyword := "struct"
+	if v.union {
+		keyword = "union"
+	}
+	fmt.Fprintf(buf, "pub type %s %s {\n", v.name, keyword)
+	for _, field := range v.fields {
+		fmt.Fprintf(buf, "    %s %s,\n", field.name, field.typ.ku)
+	}
+	buf.WriteString("}\n\n")
+	return buf.String()
+}
+
+// cSource C中的声明，以及按ku的布局写出的断言
+func (v *abiCase) cSource(layout *LLVMCodegen.StructLayout) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %s {\n", v.cKeyword(), v.name)
+	for _, field := range v.fields {
+		fmt.Fprintf(buf, "    %s %s%s;\n", field.typ.c, field.name, field.typ.suffix)
+	}
+	if v.packed {
+		buf.WriteString("} __attribute__((packed));\n")
+	} else {
+		buf.WriteString("};\n")
+	}
+
+	typ := v.cKeyword() + " " + v.name
+	fmt.Fprintf(buf, "_Static_assert(sizeof(%s) == %d, \"%s: size is %d in ku\");\n", typ, layout.Size, v.name, layout.Size)
+	fmt.Fprintf(buf, "_Static_assert(_Alignof(%s) == %d, \"%s: align is %d in ku\");\n", typ, layout.Align, v.name, layout.Align)
+	for _, field := range layout.Fields {
+		fmt.Fprintf(buf, "_Static_assert(offsetof(%s, %s) == %d, \"%s.%s: offset is %d in ku\");\n",
+			typ, field.Name, field.Offset, v.name, field.Name, field.Offset)
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// abiCasesOf input中的 [layout(c)] 结构体和联合体，按声明的顺序
+func (v *Context) abiCasesOf(input string) []*abiCase {
+	var cases []*abiCase
+	declared := make(map[*ast.NamedType]bool)
+	for _, module := range v.modules {
+		for _, submod := range module.Parts {
+			for _, node := range submod.Nodes {
+				decl, ok := node.(*ast.TypeDecl)
+				if !ok {
+					continue
+				}
+				st, ok := decl.NamedType.Type.ActualType().(ast.StructType)
+				if !ok || len(st.GenericParameters) > 0 {
+					continue
+				}
+				if layout := st.Attrs().Get("layout"); layout == nil || layout.Value != "c" {
+					continue
+				}
+
+				c := &abiCase{name: decl.NamedType.Name, union: st.IsUnion, packed: st.Attrs().Contains("packed")}
+				for _, member := range st.Members {
+					typ, ok := abiTypeOf(member.Type, declared)
+					if !ok {
+						setupErr("Type `%s` of `%s.%s` has no C counterpart in abitest", member.Type.BaseType.TypeName(), c.name, member.Name)
+					}
+					c.fields = append(c.fields, abiField{name: member.Name, typ: typ})
+				}
+				cases = append(cases, c)
+				declared[decl.NamedType] = true
+			}
+		}
+	}
+
+	if len(cases) == 0 {
+		setupErr("No [layout(c)] types in `%s`", input)
+	}
+	return cases
+}
+
+// abiTypeOf 成员类型typ在C中的写法。成员可以是前面检查过的类型declared，指针都写成 void *
+func abiTypeOf(typ *ast.TypeReference, declared map[*ast.NamedType]bool) (abiType, bool) {
+	if named, ok := typ.BaseType.(*ast.NamedType); ok {
+		if st, ok := named.Type.ActualType().(ast.StructType); ok {
+			if !declared[named] {
+				return abiType{}, false
+			}
+			keyword := "struct"
+			if st.IsUnion {
+				keyword = "union"
+			}
+			return abiType{c: keyword + " " + named.Name}, true
+		}
+	}
+
+	switch t := typ.BaseType.ActualType().(type) {
+	case ast.PrimitiveType:
+		for _, prim := range abiPrimitives {
+			if prim.ku == t.TypeName() {
+				return prim, true
+			}
+		}
+	case ast.PointerType:
+		return abiType{c: "void *"}, true
+	case ast.ArrayType:
+		if !t.IsFixedLength {
+			break
+		}
+		elem, ok := abiTypeOf(t.MemberType, declared)
+		if !ok {
+			break
+		}
+		return abiType{c: elem.c, suffix: fmt.Sprintf("[%d]%s", t.Length, elem.suffix)}, true
+	}
+	return abiType{}, false
+}
+
+// ABITest 比较类型在ku与C中的布局。input为空时用种子seed生成count个类型，否则检查input中的类型。
+// cc为C编译器，keep为true时保留生成的文件
+func (v *Context) ABITest(count int, seed int64, input string, cc string, keep bool) {
+	if input == "" && count <= 0 {
+		setupErr("Number of test types must be positive, have %d", count)
+	}
+
+	dir, err := ioutil.TempDir("", "ku-abitest")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+
+	// 生成的C文件开头的说明，以及结果中对这组类型的描述
+	origin := fmt.Sprintf("ku abitest --seed %d", seed)
+	description := fmt.Sprintf("%d generated types (seed %d)", count, seed)
+
+	var cases []*abiCase
+	kuFile := input
+	if input == "" {
+		gen := &abiGenerator{rand: rand.New(rand.NewSource(seed))}
+		for i := 0; i < count; i++ {
+			gen.genCase()
+		}
+		cases = gen.cases
+
+		kuSrc := new(bytes.Buffer)
+		fmt.Fprintf(kuSrc, "// generated by %s\n\n", origin)
+		for _, c := range cases {
+			kuSrc.WriteString(c.kuSource())
+		}
+		kuFile = filepath.Join(dir, "abitest.ku")
+		if err := ioutil.WriteFile(kuFile, kuSrc.Bytes(), 0666); err != nil {
+			setupErr("Couldn't write `%s`: %s", kuFile, err)
+		}
+	}
+
+	// ku一侧：完整的前端检查，然后计算布局
+	runPhase("runtime loading", func() {
+		LoadRuntime()
+	})
+
+	v.Inputs = []string{kuFile}
+	v.parseFiles()
+
+	runPhase("resolve phase", func() {
+		for _, module := range v.modules {
+			ast.Resolve(module, v.moduleLookup)
+		}
+	})
+
+	runPhase("inference phase", func() {
+		for _, module := range v.modules {
+			for _, submod := range module.Parts {
+				ast.Infer(submod)
+			}
+		}
+	})
+
+	runPhase("semantic analysis phase", func() {
+		for _, module := range v.modules {
+			semantic.SemCheck(module, true)
+		}
+	})
+
+	if input != "" {
+		cases = v.abiCasesOf(input)
+		origin = "ku abitest " + input
+		description = fmt.Sprintf("%d types in `%s`", len(cases), input)
+	}
+
+	cSrc := new(bytes.Buffer)
+	fmt.Fprintf(cSrc, "// generated by %s\n\n", origin)
+	cSrc.WriteString("#include <stddef.h>\n#include <stdint.h>\n\n")
+	runPhase("layout phase", func() {
+		layouts := &LLVMCodegen.Codegen{Target: v.Target}
+		for _, c := range cases {
+			_, decl := v.findStructDecl(c.name)
+			layout := layouts.LayoutOf(&ast.TypeReference{BaseType: decl.NamedType})
+			cSrc.WriteString(c.cSource(layout))
+		}
+	})
+	cFile := filepath.Join(dir, "abitest.c")
+	if err := ioutil.WriteFile(cFile, cSrc.Bytes(), 0666); err != nil {
+		setupErr("Couldn't write `%s`: %s", cFile, err)
+	}
+
+	// C一侧：只检查断言，不生成代码
+	args := []string{"-std=c11", "-ffreestanding", "-fsyntax-only"}
+	if v.Target != "" && strings.Contains(filepath.Base(cc), "clang") {
+		args = append(args, "--target="+LLVMCodegen.TargetTriple(v.Target))
+	}
+	args = append(args, cFile)
+
+	var out []byte
+	runPhase("c compile phase", func() {
+		out, err = exec.Command(cc, args...).CombinedOutput()
+	})
+	if err != nil {
+		os.Stderr.Write(out)
+		if _, ok := err.(*exec.ExitError); !ok {
+			setupErr("Couldn't run C compiler `%s`: %s", cc, err)
+		}
+		// 保留生成的文件，便于查看不一致的类型
+		setupErr("Layouts of %s don't all match C, see the assertions above and the files in `%s`", description, dir)
+	}
+
+	if keep {
+		log.Infoln(log.TagMain, "Generated files are kept in `%s`", dir)
+	} else {
+		os.RemoveAll(dir)
+	}
+	log.Infoln(log.TagMain, "Layouts of %s match C", description)
+}
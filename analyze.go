@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ku-lang/ku/ast"
+)
+
+// ku analyze：在类型推导之后分析整个项目（输入模块以及从源码读入的依赖模块），输出报告。
+//
+//	--dead  列出项目中从未被引用的公开函数和方法，即可以删除、或者不必公开的候选。
+//	        未使用的非公开函数已经由语义分析的unused检查报告。
+//	        引用来自变量解析和类型推导记录的 Function.Accesses，函数对自己的递归调用不算引用。
+//	        main函数和 [nomangle] 函数会被外部调用，不在报告中
+//	--size  编译项目，按模块和函数统计目标代码的大小，参见size.go
+//	--layout T
+//	        输出结构体类型T在目标平台上的布局，参见layout.go
+
+// deadSymbol 从未被引用的公开函数，以及它的位置
+type deadSymbol struct {
+	file      string
+	line, col int
+	name      string
+}
+
+// Analyze 分析项目并输出报告。optLevel和top用于 --size，参见size.go；layout为 --layout 的类型名
+func (v *Context) Analyze(dead, size bool, layout string, optLevel, top int) {
+	if !dead && !size && layout == "" {
+		setupErr("Nothing to analyze, pass --dead, --size or --layout")
+	}
+
+	if size {
+		// 编译时已经完成了变量解析和类型推导
+		v.reportSize(optLevel, top)
+	} else {
+		runPhase("runtime loading", func() {
+			LoadRuntime()
+		})
+
+		v.parseFiles()
+
+		runPhase("resolve phase", func() {
+			for _, module := range v.modules {
+				ast.Resolve(module, v.moduleLookup)
+			}
+		})
+
+		runPhase("inference phase", func() {
+			for _, module := range v.modules {
+				for _, submod := range module.Parts {
+					ast.Infer(submod)
+				}
+			}
+		})
+	}
+
+	if dead {
+		var symbols []deadSymbol
+		runPhase("dead symbol analysis", func() {
+			symbols = v.deadSymbols()
+		})
+
+		if size {
+			fmt.Println()
+		}
+		for _, sym := range symbols {
+			fmt.Printf("%s:%d:%d: public function `%s` is never referenced\n", sym.file, sym.line, sym.col, sym.name)
+		}
+	}
+
+	if layout != "" {
+		if dead || size {
+			fmt.Println()
+		}
+		v.reportLayout(layout)
+	}
+}
+
+// deadSymbols 找出从未被引用的公开函数。模块包和接口文件中的模块不属于项目，不做分析
+func (v *Context) deadSymbols() []deadSymbol {
+	var res []deadSymbol
+	for _, module := range v.modules {
+		if module.Interface {
+			continue
+		}
+
+		for _, submod := range module.Parts {
+			for _, node := range submod.Nodes {
+				decl, ok := node.(*ast.FunctionDecl)
+				if !ok || !decl.IsPublic() {
+					continue
+				}
+
+				fn := decl.Function
+				if (fn.Name == "main" && fn.Receiver == nil && fn.StaticReceiverType == nil) || fn.Type.Attrs().Contains("nomangle") {
+					continue
+				}
+
+				referenced := false
+				for _, access := range fn.Accesses {
+					if access.ParentFunction != fn {
+						referenced = true
+						break
+					}
+				}
+				if referenced {
+					continue
+				}
+
+				pos := decl.Pos()
+				res = append(res, deadSymbol{
+					file: submod.File.Path,
+					line: pos.Line,
+					col:  pos.Char,
+					name: functionGraphName(fn),
+				})
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].file != res[j].file {
+			return res[i].file < res[j].file
+		}
+		return res[i].line < res[j].line
+	})
+	return res
+}
@@ -1,31 +1,207 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+	"github.com/ku-lang/ku/util/log"
+)
+
+var (
+	logLevels       = []string{"debug", "verbose", "info", "warning", "error"}
+	codegenBackends = []string{"none", "llvm"}
+	logFormats      = []string{"text", "json"}
 )
 
+// flagValueHints 参数可选值，用于自动补全。--output-type 可以是这些值的逗号分隔列表
+var flagValueHints = map[string][]string{
+	"loglevel":       logLevels,
+	"logtags":        logTagNames(),
+	"log-format":     logFormats,
+	"codegen":        codegenBackends,
+	"dump-after":     dumpPhases,
+	"dump-level":     dumpLevels,
+	"output-type":    codegen.OutputTypeNames(),
+	"target":         LLVMCodegen.TargetPresetNames(),
+	"format":         graphFormats,
+	"enable-feature": ast.LanguageFeatureNames(),
+}
+
 // 利用kinpin库解析编译器参数
 var (
-	app = kingpin.New("ark", "Compiler for the Ku programming language.").Version(VERSION).Author(AUTHOR)
+	app = kingpin.New("ku", "Compiler for the Ku programming language.").Version(VERSION).Author(AUTHOR)
 
 	// log参数。log的实现参见util/log/log.go`
-	logLevel = app.Flag("loglevel", "Set the level of logging to show").Default("info").Enum("debug", "verbose", "info", "warning", "error")
-	// TODO: 当前日志标签是分散写在编译器各个文件中的，没有统一收集。需要收集起来做成常量或enum，并在命令行信息中展示。
-	logTags = app.Flag("logtags", "Which log tags to show").Default("all").String()
+	logLevel = app.Flag("loglevel", "Set the level of logging to show").Default("info").Enum(logLevels...)
+	// 日志标签统一登记在util/log/tags.go中，--logtags=list 列出所有标签
+	logTags   = app.Flag("logtags", "Comma-separated log tags to show, \"all\", or \"list\" to print the available tags").Default("all").PreAction(listLogTags).String()
+	logFormat = app.Flag("log-format", "Log output format: text, or json for one JSON object per line").Default("text").Enum(logFormats...)
+
+	// 启用实验性的语言特性，参见ast/feature.go
+	enableFeatures = app.Flag("enable-feature", "Enable an experimental language feature in all modules (repeatable)").Strings()
 
 	// 命令：build。
-	buildCom         = app.Command("build", "Build an executable.")
-	buildOutput      = buildCom.Flag("output", "Output binary name.").Short('o').Default("main").String()
-	buildSearchpaths = buildCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
-	buildInput       = buildCom.Arg("input", "Ku source file or package").String()
-	buildCodegen     = buildCom.Flag("codegen", "Codegen backend to use").Default("llvm").Enum("none", "llvm")
-	buildOutputType  = buildCom.Flag("output-type", "The format to produce after code generation").Default("executable").Enum("executable", "assembly", "object", "llvm-ir")
-	buildOptLevel    = buildCom.Flag("opt-level", "LLVM optimization level").Short('O').Default("0").Int()
-	ignoreUnused     = buildCom.Flag("unused", "Do not error on unused declarations").Bool()
+	buildCom           = app.Command("build", "Build an executable.")
+	buildOutput        = buildCom.Flag("output", "Output binary name (default .ku-build/bin/main)").Short('o').String()
+	buildSearchpaths   = buildCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	buildInputs        = buildCom.Arg("inputs", "Ku source files, merged into one module, or packages (default the project in the current directory)").Strings()
+	buildExcludes      = buildCom.Flag("exclude", "Pattern of module source files to leave out, matched against the file name or its path in the top-level module (repeatable)").Strings()
+	buildFeatures      = buildCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	buildCodegen       = buildCom.Flag("codegen", "Codegen backend to use").Default("llvm").Enum(codegenBackends...)
+	buildOutputType    = buildCom.Flag("output-type", "Comma-separated formats to produce after code generation: executable, assembly, object, llvm-ir").Default("executable").String()
+	buildOptLevel      = buildCom.Flag("opt-level", "LLVM optimization level").Short('O').Default("0").Int()
+	ignoreUnused       = buildCom.Flag("unused", "Do not error on unused declarations").Bool()
+	buildTarget        = buildCom.Flag("target", "Target triple, or one of the presets "+strings.Join(LLVMCodegen.TargetPresetNames(), ", ")).String()
+	buildPIC           = buildCom.Flag("pic", "Generate position-independent code even when linking statically (default unless --static)").Bool()
+	buildStatic        = buildCom.Flag("static", "Link a fully static executable").Bool()
+	buildStrip         = buildCom.Flag("strip", "Strip symbols from the linked executable").Bool()
+	buildEmitMIR       = buildCom.Flag("emit-mir", "Write the mid-level IR of each module to <output>-<module>.mir (for inspection)").Bool()
+	buildEmitInterface = buildCom.Flag("emit-interface", "Write an interface file for each module to .ku-build/kui, for use by separately compiled modules").Bool()
+	buildEmitTypedAST  = buildCom.Flag("emit-typed-ast", "Write the resolved and inferred syntax tree of each module to .ku-build/cache, for tools that reuse the analysis").Bool()
+	buildDumpAfter     = buildCom.Flag("dump-after", "Print the syntax tree after a phase: "+strings.Join(dumpPhases, ", ")+" (repeatable)").Enums(dumpPhases...)
+	buildDumpModules   = buildCom.Flag("dump-module", "Only dump the given module (repeatable)").Strings()
+	buildDumpLevel     = buildCom.Flag("dump-level", "Detail of --dump-after output: stable omits source positions, full includes them").Default("stable").Enum(dumpLevels...)
+	buildExplainTypes  = buildCom.Flag("explain-types", "On type inference errors, print the constraints that led to the inferred types and where they came from").Bool()
+	buildExplainAt     = buildCom.Flag("explain-at", "Explain the inferred types of the expressions at file:line[:column], implies --explain-types").String()
+	buildMaxErrors     = buildCom.Flag("max-errors", "Stop after reporting this many name resolution errors, 0 for no limit").Default("20").Int()
+
+	// 命令：run。编译到临时目录并立即运行，`--` 之后的参数传给程序
+	runCom          = app.Command("run", "Build an executable to a temporary directory and run it.")
+	runSearchpaths  = runCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	runExcludes     = runCom.Flag("exclude", "Pattern of module source files to leave out, matched against the file name or its path in the top-level module (repeatable)").Strings()
+	runFeatures     = runCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	runOptLevel     = runCom.Flag("opt-level", "LLVM optimization level").Short('O').Default("0").Int()
+	runExplainTypes = runCom.Flag("explain-types", "On type inference errors, print the constraints that led to the inferred types and where they came from").Bool()
+	runExplainAt    = runCom.Flag("explain-at", "Explain the inferred types of the expressions at file:line[:column], implies --explain-types").String()
+	runMaxErrors    = runCom.Flag("max-errors", "Stop after reporting this many name resolution errors, 0 for no limit").Default("20").Int()
+	runInput        = runCom.Arg("input", "Ku source file or package (default the project in the current directory)").String()
+	runArgs         = runCom.Arg("args", "Arguments passed to the program, after `--`").Strings()
+
+	// 命令：test。编译输入模块中的测试函数并逐个运行，参见test.go
+	testCom         = app.Command("test", "Build and run the test functions of a module: functions named test_* or marked [test].")
+	testSearchpaths = testCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	testExcludes    = testCom.Flag("exclude", "Pattern of module source files to leave out, matched against the file name or its path in the top-level module (repeatable)").Strings()
+	testFeatures    = testCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	testOptLevel    = testCom.Flag("opt-level", "LLVM optimization level").Short('O').Default("0").Int()
+	testRun         = testCom.Flag("run", "Only run the tests whose names contain this string").String()
+	testMaxErrors   = testCom.Flag("max-errors", "Stop after reporting this many name resolution errors, 0 for no limit").Default("20").Int()
+	testInput       = testCom.Arg("input", "Ku source file or package (default the project in the current directory)").String()
+
+	// 命令：fmt。按统一的格式重新输出源文件，参见format.go
+	fmtCom   = app.Command("fmt", "Reformat Ku source files, printing the result to stdout unless -w or --check is given.")
+	fmtWrite = fmtCom.Flag("write", "Write the result back to the source files").Short('w').Bool()
+	fmtCheck = fmtCom.Flag("check", "Only list the files that aren't formatted, and exit with status 1 if there are any").Bool()
+	fmtPaths = fmtCom.Arg("paths", "Ku source files, or directories to format recursively").Required().Strings()
+
+	// 命令：package。把模块编译成模块包（.kupkg）
+	packageCom         = app.Command("package", "Compile a module and its submodules into a package of interface files and object code.")
+	packageOutput      = packageCom.Flag("output", "Output package name (default .ku-build/pkg/<module>.kupkg)").Short('o').String()
+	packageSearchpaths = packageCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	packageVersion     = packageCom.Flag("pkg-version", "Semantic version of the package").Default("0.0.0").String()
+	packageCompilers   = packageCom.Flag("compilers", "Range of ku compiler versions that can use the package (default ^<this version>)").String()
+	packageRequires    = packageCom.Flag("require", "Version range required of a used package, as <package>@<range>; used packages default to ^<their version> (repeatable)").Strings()
+	packageExcludes    = packageCom.Flag("exclude", "Pattern of module source files to leave out, matched against the file name or its path in the top-level module (repeatable)").Strings()
+	packageFeatures    = packageCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	packageOptLevel    = packageCom.Flag("opt-level", "LLVM optimization level").Short('O').Default("0").Int()
+	packageTarget      = packageCom.Flag("target", "Target triple, or one of the presets "+strings.Join(LLVMCodegen.TargetPresetNames(), ", ")).String()
+	packageInput       = packageCom.Arg("input", "Ku module to package").Required().String()
+
+	// 命令：graph。输出模块依赖图和调用图，参见graph.go
+	graphCom         = app.Command("graph", "Print the module dependency graph, or the call graph with --calls, as DOT (Graphviz) or JSON.")
+	graphOutput      = graphCom.Flag("output", "Output file (default stdout)").Short('o').String()
+	graphSearchpaths = graphCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	graphFeatures    = graphCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	graphFormat      = graphCom.Flag("format", "Output format: dot or json").Default("dot").Enum(graphFormats...)
+	graphCalls       = graphCom.Flag("calls", "Print the call graph between functions after type inference; requires the modules to be free of cycles").Bool()
+	graphInput       = graphCom.Arg("input", "Ku source file or package").Required().String()
+
+	// 命令：analyze。分析项目并输出报告，参见analyze.go
+	analyzeCom         = app.Command("analyze", "Analyze a project and print a report.")
+	analyzeSearchpaths = analyzeCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	analyzeFeatures    = analyzeCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+	analyzeDead        = analyzeCom.Flag("dead", "List public functions that are never referenced inside the project").Bool()
+	analyzeSize        = analyzeCom.Flag("size", "Build the project and print the code size of each module and of the largest functions").Bool()
+	analyzeLayout      = analyzeCom.Flag("layout", "Print the field offsets, sizes and padding of a struct type (T or module.T)").String()
+	analyzeTop         = analyzeCom.Flag("top", "Number of functions listed by --size").Default("20").Int()
+	analyzeOptLevel    = analyzeCom.Flag("opt-level", "LLVM optimization level used by --size").Short('O').Default("0").Int()
+	analyzeTarget      = analyzeCom.Flag("target", "Target triple used by --size and --layout, or one of the presets "+strings.Join(LLVMCodegen.TargetPresetNames(), ", ")).String()
+	analyzeInput       = analyzeCom.Arg("input", "Ku source file or package").Required().String()
+
+	// 命令：new、init。创建项目，参见project.go
+	newCom   = app.Command("new", "Create a project directory with a manifest and src/main.ku.")
+	newName  = newCom.Arg("name", "Project name, also the name of its top-level module and directory").Required().String()
+	initCom  = app.Command("init", "Turn the current directory into a project, keeping existing files.")
+	initName = initCom.Arg("name", "Project name, also the name of its top-level module (default the directory name)").String()
+
+	// 命令：clean。删除构建输出目录 .ku-build
+	cleanCom = app.Command("clean", "Remove the .ku-build build directory.")
+
+	// 命令：reduce。最小化让编译器崩溃的源文件
+	reduceCom       = app.Command("reduce", "Shrink a source file while a predicate command keeps succeeding, to minimize compiler crash reproducers.")
+	reduceOutput    = reduceCom.Flag("output", "Where to write the reduced source (default <input>.reduced.ku)").Short('o').String()
+	reduceTimeout   = reduceCom.Flag("timeout", "Time limit for one run of the predicate; runs that time out count as failures").Default("30s").Duration()
+	reduceInput     = reduceCom.Arg("input", "Ku source file that makes the compiler crash").Required().String()
+	reducePredicate = reduceCom.Arg("predicate", "Command that exits with 0 while the crash still happens, after \"--\". \"{}\" is replaced by the candidate file, otherwise the file is appended").Required().Strings()
+
+	// 命令：lsp。语言服务器，参见lsp.go
+	lspCom         = app.Command("lsp", "Run a Language Server Protocol server over stdin and stdout, for editors.")
+	lspSearchpaths = lspCom.Flag("searchpaths", "Paths to search for used modules (default the workspace root)").Short('I').Strings()
+	lspFeatures    = lspCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+
+	// 命令：repl。交互式解释器，参见repl.go
+	replCom         = app.Command("repl", "Start an interactive session that evaluates declarations, statements and expressions line by line.")
+	replSearchpaths = replCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	replFeatures    = replCom.Flag("features", "Comma-separated features to enable: <feature> for the input module, <module>/<feature> for a used module (repeatable)").Strings()
+
+	// 命令：abitest。比较生成的（或者源文件中的）结构体在ku与C中的布局
+	abitestCom    = app.Command("abitest", "Generate matching ku and C struct declarations, or take the [layout(c)] types of a source file, and check that their sizes, alignments and offsets agree.")
+	abitestCount  = abitestCom.Flag("count", "Number of struct and union types to generate").Default("100").Int()
+	abitestSeed   = abitestCom.Flag("seed", "Random seed; the same seed generates the same types").Default("1").Int64()
+	abitestCC     = abitestCom.Flag("cc", "C compiler used to check the layouts; clang also gets --target").Default("cc").String()
+	abitestTarget = abitestCom.Flag("target", "Target triple, or one of the presets "+strings.Join(LLVMCodegen.TargetPresetNames(), ", ")).String()
+	abitestKeep   = abitestCom.Flag("keep", "Keep the generated ku and C files").Bool()
+	abitestInput  = abitestCom.Arg("input", "Ku source file whose [layout(c)] types are checked instead of generated ones").String()
+
+	// 命令：completions。输出shell自动补全脚本
+	completionsCom   = app.Command("completions", "Print a shell completion script.")
+	completionsShell = completionsCom.Arg("shell", "Shell to generate the script for: bash, zsh or fish").Required().Enum("bash", "zsh", "fish")
 
 	// 命令：docgen。生成文档。
 	docgenCom         = app.Command("docgen", "Generate documentation.")
-	docgenDir         = docgenCom.Flag("dir", "Directory to place generated docs in.").Default("docgen").String()
-	docgenInput       = docgenCom.Arg("input", "Ku source file or package").String()
+	docgenDir         = docgenCom.Flag("dir", "Directory to place generated docs in (default .ku-build/doc)").String()
+	docgenInputs      = docgenCom.Arg("inputs", "Ku source files, merged into one module, or packages").Strings()
 	docgenSearchpaths = docgenCom.Flag("searchpaths", "Paths to search for used modules if not found in base directory").Short('I').Strings()
+	docgenPrivate     = docgenCom.Flag("document-private", "Also document declarations that aren't public").Bool()
 )
+
+// logTagNames 所有日志标签的名字，以及 all 和 list
+func logTagNames() []string {
+	names := []string{"all", "list"}
+	for _, info := range log.Tags() {
+		names = append(names, string(info.Tag))
+	}
+	return names
+}
+
+// listLogTags 处理 --logtags=list：打印所有日志标签后退出。
+// 在kingpin的PreAction中处理，这样不指定命令也可以使用
+func listLogTags(ctx *kingpin.ParseContext) error {
+	for _, elem := range ctx.Elements {
+		flag, ok := elem.Clause.(*kingpin.FlagClause)
+		if !ok || flag.Model().Name != "logtags" || elem.Value == nil || *elem.Value != "list" {
+			continue
+		}
+
+		for _, info := range log.Tags() {
+			fmt.Printf("%-12s %s\n", info.Tag, info.Description)
+		}
+		os.Exit(0)
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"math/big"
+	"sort"
 	"strconv"
 
 	"github.com/ku-lang/ku/lexer"
@@ -48,6 +50,8 @@ type Decl interface {
 	declNode()
 	IsPublic() bool
 	SetPublic(bool)
+	IsFilePrivate() bool
+	SetFilePrivate(bool)
 }
 
 // an implementation of Locatable that is used for Nodes
@@ -139,8 +143,14 @@ type Variable struct {
 	ParentStruct StructType
 	ParentModule *Module
 
+	// 类型的静态成员所属的类型。静态成员是模块级的变量，通过 类型名.成员名 访问
+	StaticReceiverType *NamedType
+
 	// Is the variable not from an variable decl
 	IsImplicit bool
+
+	// 变量没有给出类型，由只含数字常量的表达式初始化，类型是常量的默认类型
+	NumericDefault bool
 }
 
 func (v Variable) String() string {
@@ -172,7 +182,16 @@ type Function struct {
 
 	StaticReceiverType Type // non-nil if static
 
+	// 泛型类型的静态方法声明中类型的泛型参数，如 fun static List<T>.make() 中的T。
+	// 它们是 Type.GenericParameters 的前几项，调用 List<int>.make() 时由类型的泛型实参给出
+	StaticTypeParameters GenericSigil
+
 	Anonymous bool
+
+	// 函数体中声明的嵌套函数所在的函数，顶层函数为nil，参见 Resolver.resolveNestedFunction
+	Outer *Function
+
+	purity purityState // 推导出的是否是纯函数，参见 IsPure
 }
 
 func (v Function) String() string {
@@ -203,6 +222,8 @@ type Block struct {
 	Nodes         []Node
 	IsTerminating bool
 	NonScoping    bool
+	IsUnsafe      bool // unsafe { ... }，参见 semantic/unsafe.go
+	Tail          Expr // 代码块的值，只出现在 CondExpr 的分支中。函数体最后的表达式构造为return语句
 }
 
 func (v Block) String() string {
@@ -211,6 +232,10 @@ func (v Block) String() string {
 		s.AddString("\n\t")
 		s.Add(n)
 	}
+	if v.Tail != nil {
+		s.AddString("\n\t")
+		s.Add(v.Tail)
+	}
 	return s.Finish()
 }
 
@@ -235,7 +260,8 @@ func (v Block) LastNode() Node {
  */
 
 type PublicHandler struct {
-	public bool
+	public      bool
+	filePrivate bool // 只在声明所在的文件中可见，参见 Resolver.ResolveTopLevelDecls
 }
 
 func (v *PublicHandler) SetPublic(b bool) {
@@ -246,6 +272,14 @@ func (v PublicHandler) IsPublic() bool {
 	return v.public
 }
 
+func (v *PublicHandler) SetFilePrivate(b bool) {
+	v.filePrivate = b
+}
+
+func (v PublicHandler) IsFilePrivate() bool {
+	return v.filePrivate
+}
+
 // VariableDecl
 
 type VariableDecl struct {
@@ -328,6 +362,48 @@ func (v TypeDecl) DocComments() []*parser.DocComment {
 	return nil // TODO
 }
 
+// TypeAliasDecl
+
+// TypeAlias 类型别名 type Pair<T> = (T, T)。别名不是新的类型，
+// 解析类型时用泛型实参代入别名的类型，参见 Resolver.expandTypeAlias
+type TypeAlias struct {
+	nodePos
+	Name              string
+	GenericParameters GenericSigil
+	Type              *TypeReference
+	ParentModule      *Module
+
+	submod    *Submodule // 声明所在的子模块，解析别名的类型时使用其中引入的模块
+	resolving bool
+	resolved  bool
+}
+
+func (v *TypeAlias) String() string {
+	return NewASTStringer("TypeAlias").AddString(v.Name).AddString(v.GenericParameters.String()).
+		AddTypeReference(v.Type).Finish()
+}
+
+type TypeAliasDecl struct {
+	nodePos
+	PublicHandler
+	docs  []*parser.DocComment
+	Alias *TypeAlias
+}
+
+func (_ TypeAliasDecl) declNode() {}
+
+func (v TypeAliasDecl) String() string {
+	return NewASTStringer("TypeAliasDecl").AddString(v.Alias.String()).Finish()
+}
+
+func (_ TypeAliasDecl) NodeName() string {
+	return "type alias declaration"
+}
+
+func (v TypeAliasDecl) DocComments() []*parser.DocComment {
+	return v.docs
+}
+
 // FunctionDecl
 
 type FunctionDecl struct {
@@ -460,6 +536,47 @@ func (_ CallStat) NodeName() string {
 	return "call statement"
 }
 
+// StaticAssertStat 编译期断言，可以在顶层或者语句中使用
+
+type StaticAssertStat struct {
+	nodePos
+	Cond    Expr
+	Message string
+
+	// 条件依赖目标平台的数据布局，语义分析时不能计算，由代码生成检查
+	TargetDependent bool
+}
+
+func (_ StaticAssertStat) statNode() {}
+
+func (v StaticAssertStat) String() string {
+	return NewASTStringer("StaticAssertStat").Add(v.Cond).AddString(strconv.Quote(v.Message)).Finish()
+}
+
+func (_ StaticAssertStat) NodeName() string {
+	return "static assertion"
+}
+
+// VolatileStoreStat
+
+// VolatileStoreStat 通过指针写入值：volatile_store(ptr, value)，生成LLVM的volatile store，
+// 写操作不会被优化掉、合并或者与其他volatile操作重排，用于访问内存映射的硬件寄存器
+type VolatileStoreStat struct {
+	nodePos
+	Pointer Expr
+	Value   Expr
+}
+
+func (_ VolatileStoreStat) statNode() {}
+
+func (v VolatileStoreStat) String() string {
+	return NewASTStringer("VolatileStoreStat").Add(v.Pointer).Add(v.Value).Finish()
+}
+
+func (_ VolatileStoreStat) NodeName() string {
+	return "volatile store statement"
+}
+
 // DeferStat
 
 type DeferStat struct {
@@ -602,6 +719,19 @@ type LoopStat struct {
 
 	// LOOP_TYPE_CONDITIONAL
 	Condition Expr
+
+	// 由for-in循环展开而来时不为nil，参见 Constructor.constructForInNode
+	ForIn *ForInLoop
+}
+
+// ForInLoop for-in循环使用的迭代器协议：
+// 迭代的值的 iter() 方法返回迭代器，迭代器的 next() 方法返回 Option<T>，None表示迭代结束。
+// 两个调用都在展开后的语法树中，这里只引用它们，用于检查协议方法的签名（参见 semantic.IteratorCheck）
+type ForInLoop struct {
+	Variable *Variable
+	Iterable Expr
+	IterCall *CallExpr
+	NextCall *CallExpr
 }
 
 func (_ LoopStat) statNode() {}
@@ -688,6 +818,9 @@ type NumericLiteral struct {
 	IsFloat       bool
 	Type          *TypeReference
 	floatSizeHint rune
+
+	// 时长字面量，如 10ms。IntValue是纳秒数，类型总是运行时中的 Duration
+	IsDuration bool
 }
 
 func (_ NumericLiteral) exprNode() {}
@@ -706,6 +839,8 @@ func (v NumericLiteral) String() string {
 func (v NumericLiteral) GetType() *TypeReference {
 	if v.Type != nil {
 		return v.Type
+	} else if v.IsDuration {
+		return DurationType()
 	} else if v.IsFloat {
 		typ := PRIMITIVE_f32
 		switch v.floatSizeHint {
@@ -730,18 +865,33 @@ func (v NumericLiteral) AsFloat() float64 {
 	if v.IsFloat {
 		return v.FloatValue
 	} else {
-		return float64(v.IntValue.Int64())
+		f, _ := new(big.Float).SetInt(v.IntValue).Float64()
+		return f
 	}
 }
 
+// AsInt 返回整数常量的低64位。超过64位的常量（如 u128、s128）应当使用 IntValue
 func (v NumericLiteral) AsInt() uint64 {
 	if v.IsFloat {
 		panic("downcasting floating point value to int")
 	}
 
+	if v.IntValue.IsUint64() {
+		return v.IntValue.Uint64()
+	}
 	return uint64(v.IntValue.Int64())
 }
 
+// IsNaN 是否是常量 nan
+func (v NumericLiteral) IsNaN() bool {
+	return v.IsFloat && math.IsNaN(v.FloatValue)
+}
+
+// FitsIn64Bits 整数常量是否能用64位表示（有符号或无符号）
+func (v NumericLiteral) FitsIn64Bits() bool {
+	return v.IntValue.IsInt64() || v.IntValue.IsUint64()
+}
+
 // StringLiteral
 
 type StringLiteral struct {
@@ -901,9 +1051,14 @@ func (_ EnumLiteral) NodeName() string {
 
 type BinaryExpr struct {
 	nodePos
-	Lhand, Rhand Expr
-	Op           parser.BinOpType
-	Type         *TypeReference
+	Lhand, Rhand  Expr
+	Op            parser.BinOpType
+	Type          *TypeReference
+	Parenthesized bool // 源码中被括号包围，如 (a < b)。用于链式比较的诊断
+
+	// 左操作数的类型是带约束的泛型参数时，运算符由约束中的方法实现（如 a + b 调用 a.add(b)），
+	// 这里是推导时生成的方法调用，参见 constraintOperator
+	Method *CallExpr
 }
 
 func (_ BinaryExpr) exprNode() {}
@@ -1009,6 +1164,9 @@ type FunctionAccessExpr struct {
 	Function       *Function
 	ReceiverAccess Expr // should be same as on the callexpr
 
+	// 访问的函数有重载时是所有的候选，在类型推导中选定之后为nil，参见 overload.go
+	Overloads []*Function
+
 	GenericArguments    []*TypeReference
 	ExtraGenericContext *GenericContext // used when we're calling on a substitution type wth generic interface constraints
 
@@ -1022,6 +1180,10 @@ func (v FunctionAccessExpr) String() string {
 }
 
 func (v FunctionAccessExpr) GetType() *TypeReference {
+	if v.Overloads != nil {
+		return nil
+	}
+
 	ref := &TypeReference{
 		BaseType:         v.Function.Type,
 		GenericArguments: v.GenericArguments,
@@ -1086,6 +1248,13 @@ type StructAccessExpr struct {
 
 	// Needed for when we convert an struct access to function access
 	ParentFunction *Function
+
+	// 作为方法调用的函数表达式。否则访问方法得到的是绑定了接收者的函数值（方法值），
+	// 类型是去掉接收者的方法类型，参见 methodValueType
+	Callee bool
+
+	// 方法值访问的方法，由类型推导设置
+	Method *FunctionAccessExpr
 }
 
 func (_ StructAccessExpr) exprNode() {}
@@ -1104,11 +1273,11 @@ func (v StructAccessExpr) GetType() *TypeReference {
 		return nil
 	}
 
-	if typ, ok := TypeWithoutPointers(stype.BaseType).(*NamedType); ok {
-		fn := typ.GetMethod(v.Member)
-		if fn != nil {
-			return &TypeReference{BaseType: fn.Type, GenericArguments: v.GenericArguments}
+	if fn := receiverMethod(stype, v.Member); fn != nil {
+		if !v.Callee {
+			return methodValueType(stype, fn, v.GenericArguments)
 		}
+		return &TypeReference{BaseType: fn.Type, GenericArguments: v.GenericArguments}
 	}
 
 	if stype == nil {
@@ -1133,6 +1302,51 @@ func (_ StructAccessExpr) NodeName() string {
 	return "struct access expression"
 }
 
+// methodValueType 方法值的类型：去掉接收者的方法类型。
+// 由接收者的类型决定的泛型参数替换为实际的类型，方法自己的泛型参数需要给出泛型实参
+func methodValueType(receiver *TypeReference, fn *Function, genericArgs []*TypeReference) *TypeReference {
+	ft := fn.Type
+	ft.Receiver = nil
+	typ := &TypeReference{BaseType: ft, GenericArguments: genericArgs}
+
+	if len(ft.GenericParameters) == 0 {
+		return typ
+	}
+
+	var gcon *GenericContext
+	var rest GenericSigil
+	if len(genericArgs) == len(ft.GenericParameters) {
+		gcon = NewGenericContextFromTypeReference(typ)
+	} else {
+		if fn.Type.Receiver == nil {
+			return typ
+		}
+		types, err := ExtractTypeVariable(TypeReferenceWithoutPointers(fn.Type.Receiver), TypeReferenceWithoutPointers(receiver))
+		if err != nil {
+			return typ
+		}
+
+		var params GenericSigil
+		var args []*TypeReference
+		for _, par := range ft.GenericParameters {
+			if arg, ok := types[par.Name]; ok {
+				params = append(params, par)
+				args = append(args, arg)
+			} else {
+				rest = append(rest, par)
+			}
+		}
+		gcon = NewGenericContext(params, args)
+	}
+
+	// 替换后只剩下没有确定的泛型参数
+	typ = gcon.Replace(&TypeReference{BaseType: ft})
+	ft = typ.BaseType.(FunctionType)
+	ft.GenericParameters = rest
+	typ.BaseType = ft
+	return typ
+}
+
 func (v StructAccessExpr) Mutable() bool {
 	return v.Struct.Mutable()
 }
@@ -1177,6 +1391,39 @@ func (v ArrayAccessExpr) Mutable() bool {
 	return v.Array.Mutable()
 }
 
+// SliceExpr
+
+// SliceExpr 动态数组或字符串的切片 a[low:high]，省略的一端为nil（low为0，high为len(a)）。
+// 结果与a的类型相同，共享a的元素，不复制。越界（不满足 0 <= low <= high <= len(a)）时停止程序；
+// 字符串的两端还必须在UTF-8字符的边界上，参见 LLVMCodegen/slice.go
+type SliceExpr struct {
+	nodePos
+	Array     Expr
+	Low, High Expr
+}
+
+func (_ SliceExpr) exprNode() {}
+
+func (v SliceExpr) String() string {
+	s := NewASTStringer("SliceExpr")
+	s.AddString("array").Add(v.Array)
+	if v.Low != nil {
+		s.AddString("low").Add(v.Low)
+	}
+	if v.High != nil {
+		s.AddString("high").Add(v.High)
+	}
+	return s.Finish()
+}
+
+func (v SliceExpr) GetType() *TypeReference {
+	return v.Array.GetType()
+}
+
+func (_ SliceExpr) NodeName() string {
+	return "slice expression"
+}
+
 // DerefAccessExpr
 
 type DerefAccessExpr struct {
@@ -1256,6 +1503,33 @@ func (v DiscardAccessExpr) Mutable() bool {
 	return true
 }
 
+// TempAccessExpr
+
+// TempAccessExpr 把不是访问表达式的值（如函数调用的结果）当作访问表达式，
+// 这样可以访问它的成员或者调用它的方法，如 x.clone().size()。临时值是不可变的
+type TempAccessExpr struct {
+	nodePos
+	Expr Expr
+}
+
+func (_ TempAccessExpr) exprNode() {}
+
+func (v TempAccessExpr) String() string {
+	return NewASTStringer("TempAccessExpr").Add(v.Expr).Finish()
+}
+
+func (v TempAccessExpr) GetType() *TypeReference {
+	return v.Expr.GetType()
+}
+
+func (_ TempAccessExpr) NodeName() string {
+	return "temporary value"
+}
+
+func (v TempAccessExpr) Mutable() bool {
+	return false
+}
+
 // EnumPatternExpr
 
 type EnumPatternExpr struct {
@@ -1346,6 +1620,15 @@ func (v LambdaExpr) String() string {
 }
 
 func (v LambdaExpr) GetType() *TypeReference {
+	// 省略的参数类型或返回类型还没有确定
+	if v.Function.Type.Return == nil {
+		return nil
+	}
+	for _, par := range v.Function.Type.Parameters {
+		if par == nil {
+			return nil
+		}
+	}
 	return &TypeReference{BaseType: v.Function.Type}
 }
 
@@ -1413,6 +1696,312 @@ func (_ SizeofExpr) NodeName() string {
 	return "sizeof expression"
 }
 
+// AlignofExpr
+
+type AlignofExpr struct {
+	nodePos
+	// either Expr or Type is nil, like SizeofExpr
+
+	Expr Expr
+
+	Type *TypeReference
+}
+
+func (_ AlignofExpr) exprNode() {}
+
+func (v AlignofExpr) String() string {
+	s := NewASTStringer("AlignofExpr")
+	if v.Expr != nil {
+		s.Add(v.Expr)
+	} else {
+		s.AddTypeReference(v.Type)
+	}
+	return s.Finish()
+}
+
+func (v AlignofExpr) GetType() *TypeReference {
+	return &TypeReference{BaseType: PRIMITIVE_uint}
+}
+
+func (_ AlignofExpr) NodeName() string {
+	return "alignof expression"
+}
+
+// OffsetofExpr 结构体成员相对于结构体开头的偏移
+
+type OffsetofExpr struct {
+	nodePos
+
+	Type   *TypeReference
+	Member string
+}
+
+func (_ OffsetofExpr) exprNode() {}
+
+func (v OffsetofExpr) String() string {
+	s := NewASTStringer("OffsetofExpr")
+	s.AddTypeReference(v.Type)
+	s.AddString(v.Member)
+	return s.Finish()
+}
+
+func (v OffsetofExpr) GetType() *TypeReference {
+	return &TypeReference{BaseType: PRIMITIVE_uint}
+}
+
+func (_ OffsetofExpr) NodeName() string {
+	return "offsetof expression"
+}
+
+// FloatBuiltinExpr
+
+// FloatBuiltinExpr 浮点数内建函数，如 is_nan(x)、fma(a, b, c)。
+// is_nan 和 is_inf 的类型是bool，fma 的类型与参数相同
+type FloatBuiltinExpr struct {
+	nodePos
+	Builtin   parser.FloatBuiltin
+	Arguments []Expr
+	Type      *TypeReference
+}
+
+func (_ FloatBuiltinExpr) exprNode() {}
+
+func (v FloatBuiltinExpr) String() string {
+	s := NewASTStringer("FloatBuiltinExpr").Add(v.Builtin)
+	for _, arg := range v.Arguments {
+		s.Add(arg)
+	}
+	return s.Finish()
+}
+
+func (v FloatBuiltinExpr) GetType() *TypeReference {
+	return v.Type
+}
+
+func (_ FloatBuiltinExpr) NodeName() string {
+	return "float builtin expression"
+}
+
+// BitcastExpr
+
+// BitcastExpr 按位重新解释值的类型，如把f32的值x当作u32：bitcast<u32>(x)。
+// 两个类型在目标平台上的大小必须相同，只能在unsafe代码块中使用
+type BitcastExpr struct {
+	nodePos
+	Expr Expr
+	Type *TypeReference
+}
+
+func (_ BitcastExpr) exprNode() {}
+
+func (v BitcastExpr) String() string {
+	return NewASTStringer("BitcastExpr").Add(v.Expr).AddTypeReference(v.Type).Finish()
+}
+
+func (v BitcastExpr) GetType() *TypeReference {
+	return v.Type
+}
+
+func (_ BitcastExpr) NodeName() string {
+	return "bitcast expression"
+}
+
+// VolatileLoadExpr
+
+// VolatileLoadExpr 通过指针读取值：volatile_load(ptr)，类型是指针指向的类型。
+// 生成LLVM的volatile load，每次求值都会真正读取内存
+type VolatileLoadExpr struct {
+	nodePos
+	Pointer Expr
+}
+
+func (_ VolatileLoadExpr) exprNode() {}
+
+func (v VolatileLoadExpr) String() string {
+	return NewASTStringer("VolatileLoadExpr").Add(v.Pointer).Finish()
+}
+
+func (v VolatileLoadExpr) GetType() *TypeReference {
+	if v.Pointer.GetType() != nil {
+		ret := getAdressee(v.Pointer.GetType().BaseType.ActualType())
+		if ret == nil {
+			return &TypeReference{BaseType: PRIMITIVE_void}
+		}
+		return ret
+	}
+	return nil
+}
+
+func (_ VolatileLoadExpr) NodeName() string {
+	return "volatile load expression"
+}
+
+// CStringExpr
+
+// CStringExpr 把ku字符串转换为以NUL结尾的C字符串：cstr(s)，类型是 ^u8。
+// 缓冲区分配在当前函数的栈上，函数返回后失效。传给C函数 ^u8 形参的字符串由语义检查隐式转换（Implicit），
+// 这时缓冲区只在调用期间有效，参见 semantic/cstring.go
+type CStringExpr struct {
+	nodePos
+	Expr     Expr
+	Implicit bool
+}
+
+func (_ CStringExpr) exprNode() {}
+
+func (v CStringExpr) String() string {
+	return NewASTStringer("CStringExpr").Add(v.Expr).Finish()
+}
+
+func (v CStringExpr) GetType() *TypeReference {
+	return &TypeReference{BaseType: PointerTo(&TypeReference{BaseType: PRIMITIVE_u8}, false)}
+}
+
+func (_ CStringExpr) NodeName() string {
+	return "C string conversion"
+}
+
+// HashExpr
+
+// HashExpr 值的哈希值：hashof(value)，类型是 u64。相等的值的哈希值相同，可以计算哪些类型参见 compare.go
+type HashExpr struct {
+	nodePos
+	Expr Expr
+}
+
+func (_ HashExpr) exprNode() {}
+
+func (v HashExpr) String() string {
+	return NewASTStringer("HashExpr").Add(v.Expr).Finish()
+}
+
+func (v HashExpr) GetType() *TypeReference {
+	return &TypeReference{BaseType: PRIMITIVE_u64}
+}
+
+func (_ HashExpr) NodeName() string {
+	return "hash expression"
+}
+
+// CondExpr
+
+// CondExpr 作为表达式的if或match语句，如 if c { 1 } else { 2 }。值是执行的分支的代码块的值（Block.Tail），
+// 分支也可以不产生值而结束执行（return、break等）。if必须有else，match必须包括所有的情况，参见 semantic/condexpr.go
+type CondExpr struct {
+	nodePos
+	Stat Node // *IfStat 或 *MatchStat
+	Type *TypeReference
+}
+
+func (_ CondExpr) exprNode() {}
+
+func (v CondExpr) String() string {
+	return NewASTStringer("CondExpr").Add(v.Stat).AddTypeReference(v.Type).Finish()
+}
+
+func (v CondExpr) GetType() *TypeReference {
+	return v.Type
+}
+
+func (v CondExpr) NodeName() string {
+	if _, ok := v.Stat.(*MatchStat); ok {
+		return "match expression"
+	}
+	return "if expression"
+}
+
+// Branches 各个分支，按源码中的顺序。match的分支可以是语句，其它分支都是代码块
+func (v CondExpr) Branches() []Node {
+	var res []Node
+	switch stat := v.Stat.(type) {
+	case *IfStat:
+		for _, body := range stat.Bodies {
+			res = append(res, body)
+		}
+		if stat.Else != nil {
+			res = append(res, stat.Else)
+		}
+
+	case *MatchStat:
+		for _, branch := range stat.Branches {
+			res = append(res, branch)
+		}
+		sort.Slice(res, func(i, j int) bool {
+			a, b := res[i].Pos(), res[j].Pos()
+			return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+		})
+	}
+	return res
+}
+
+// Values 各个分支的值，按源码中的顺序。不产生值的分支没有值
+func (v CondExpr) Values() []Expr {
+	var res []Expr
+	for _, branch := range v.Branches() {
+		if block, ok := branch.(*Block); ok && block.Tail != nil {
+			res = append(res, block.Tail)
+		}
+	}
+	return res
+}
+
+// NewExpr
+
+// NewExpr 在堆上分配一个值：new Point{x: 1}，类型是 ^var Point。
+// 内存由运行时钩子alloc分配，属于得到指针的一方，用完之后由 free(p) 释放（钩子free）。
+// new Vec(1, 2) 是构造方法的约定写法，等同于 new Vec.new(1, 2)，参见 Resolver
+type NewExpr struct {
+	nodePos
+	Expr Expr
+}
+
+func (_ NewExpr) exprNode() {}
+
+func (v NewExpr) String() string {
+	return NewASTStringer("NewExpr").Add(v.Expr).AddTypeReference(v.GetType()).Finish()
+}
+
+func (v NewExpr) GetType() *TypeReference {
+	if v.Expr.GetType() != nil {
+		return &TypeReference{BaseType: PointerTo(v.Expr.GetType(), true)}
+	}
+	return nil
+}
+
+func (_ NewExpr) NodeName() string {
+	return "new expression"
+}
+
+// OverflowArithExpr
+
+// OverflowArithExpr 显式指定溢出行为的整数运算，如 checked_add(a, b)。
+// checked 运算的类型是 (T, bool)，其余运算的类型与操作数相同
+type OverflowArithExpr struct {
+	nodePos
+	Mode         parser.OverflowMode
+	Op           parser.BinOpType
+	Lhand, Rhand Expr
+	Type         *TypeReference
+}
+
+func (_ OverflowArithExpr) exprNode() {}
+
+func (v OverflowArithExpr) String() string {
+	return NewASTStringer("OverflowArithExpr").Add(v.Mode).Add(v.Op).Add(v.Lhand).Add(v.Rhand).Finish()
+}
+
+func (v OverflowArithExpr) GetType() *TypeReference {
+	return v.Type
+}
+
+func (v OverflowArithExpr) Name() string {
+	return parser.OverflowArithName(v.Mode, v.Op)
+}
+
+func (_ OverflowArithExpr) NodeName() string {
+	return "overflow arithmetic expression"
+}
+
 // String representation util
 type ASTStringer struct {
 	buf   *bytes.Buffer
@@ -1432,7 +2021,7 @@ func NewASTStringer(name string) *ASTStringer {
 }
 
 func (v *ASTStringer) AddAttrs(attrs parser.AttrGroup) *ASTStringer {
-	for _, attr := range attrs {
+	for _, attr := range attrs.Sorted() {
 		v.Add(attr)
 	}
 	return v
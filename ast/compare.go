@@ -0,0 +1,210 @@
+package ast
+
+import "fmt"
+
+// 相等和大小比较
+//
+// == 和 != 可以比较布尔值、数值、指针、引用、简单枚举，以及成员都可以比较的结构体、元组、带数据的枚举、
+// 定长数组和不定长数组（包括 string）：
+//   - 结构体和元组逐个比较成员，数组先比较长度再逐个比较元素，枚举先比较标签再比较这个成员的数据；
+//   - 浮点数按IEEE比较，NaN不等于任何值，因此包含NaN的值也不等于自身；
+//   - 复合类型中的指针、引用和函数值默认不能比较：它们只能按地址比较，通常不是想要的结果。
+//     标注了 [derive(eq)] 的结构体和枚举按地址比较它们直接包含的指针、引用和函数值；
+//   - 联合体和接口值不能比较。
+//
+// <、<=、> 和 >= 可以比较数值、指针、简单枚举、成员可以排序的元组和数组（包括 string），
+// 以及标注了 [derive(ord)] 的结构体：按成员声明的顺序逐个比较（字典序），数组的一个是另一个的前缀时较短的较小。
+// [derive(ord)] 同时也是 [derive(eq)]。代码生成参见 LLVMCodegen/compare.go。
+//
+// hashof(value) 可以计算的类型（用作map的键）是可以用 == 比较、且不包含浮点数和函数值的类型：
+// 相等的值的哈希值必须相同，而浮点数的NaN不等于自身、0.0与-0.0相等，函数值只按地址比较。
+// 指针和引用与 == 一样按地址计算。代码生成参见 LLVMCodegen/hash.go。
+
+// Comparable 类型为typ的值能否用 == 和 != 比较。函数值只能作为 [derive(eq)] 类型的成员比较
+func Comparable(typ *TypeReference) bool {
+	if _, ok := typ.BaseType.ActualType().(FunctionType); ok {
+		return false
+	}
+	return (&comparison{}).check(typ, nil, true)
+}
+
+// Ordered 类型为typ的值能否用 <、<=、> 和 >= 比较
+func Ordered(typ *TypeReference) bool {
+	return (&comparison{ordered: true}).check(typ, nil, true)
+}
+
+// Hashable 类型为typ的值能否用 hashof 计算哈希值，不能时返回原因
+func Hashable(typ *TypeReference) (bool, string) {
+	if _, ok := typ.BaseType.ActualType().(FunctionType); ok {
+		return false, "function values can't be hashed"
+	}
+	v := &comparison{hashed: true}
+	if !v.check(typ, nil, true) {
+		return false, v.why
+	}
+	return true, ""
+}
+
+// IsCompositeComparison 类型为typ的值的比较是否需要逐个比较成员，即不是一次比较指令
+func IsCompositeComparison(typ *TypeReference) bool {
+	switch t := typ.BaseType.ActualType().(type) {
+	case StructType, TupleType, ArrayType:
+		return true
+	case EnumType:
+		return !t.Simple
+	}
+	return false
+}
+
+// Derives 命名类型是否标注了 [derive(what)]，what是eq或ord。[derive(ord)] 也是 [derive(eq)]
+func Derives(t *NamedType, what string) bool {
+	var attr string
+	switch typ := t.Type.(type) {
+	case StructType:
+		if a := typ.Attrs().Get("derive"); a != nil {
+			attr = a.Value
+		}
+	case EnumType:
+		if a := typ.Attrs().Get("derive"); a != nil {
+			attr = a.Value
+		}
+	}
+	return attr == what || (what == "eq" && attr == "ord")
+}
+
+// ComparisonMembers 结构体、元组或枚举成员的数据的各个成员的类型，其它类型返回nil
+func ComparisonMembers(typ Type) []*TypeReference {
+	switch t := typ.(type) {
+	case StructType:
+		res := make([]*TypeReference, len(t.Members))
+		for idx, mem := range t.Members {
+			res[idx] = mem.Type
+		}
+		return res
+	case TupleType:
+		return t.Members
+	}
+	return nil
+}
+
+type comparison struct {
+	ordered  bool
+	hashed   bool                // 检查能否计算哈希值，不能时why是原因
+	visiting map[*NamedType]bool // 正在检查的命名类型，通过不定长数组包含自身的类型在这里结束递归
+	why      string
+}
+
+// fail 记录不能比较或计算哈希值的原因
+func (v *comparison) fail(format string, args ...interface{}) bool {
+	v.why = fmt.Sprintf(format, args...)
+	return false
+}
+
+// check 类型为typ的值能否比较。raw为true时指针、引用和函数值可以按地址比较
+func (v *comparison) check(typ *TypeReference, gcon *GenericContext, raw bool) bool {
+	if typ == nil {
+		return false
+	}
+	if sub, ok := typ.BaseType.(*SubstitutionType); ok {
+		for con := gcon; con != nil; con = con.Outer {
+			if arg, ok := con.submap[sub]; ok {
+				return v.check(arg, con.Outer, raw)
+			}
+		}
+		return false
+	}
+
+	switch t := typ.BaseType.(type) {
+	case *NamedType:
+		if _, ok := InterfaceOf(typ); ok {
+			return v.fail("interface `%s` values can't be compared", t.Name)
+		}
+		if v.visiting[t] {
+			return true
+		}
+
+		switch t.Type.(type) {
+		case StructType, EnumType:
+			if v.ordered {
+				if _, ok := t.Type.(StructType); ok && !Derives(t, "ord") {
+					return false
+				}
+			}
+			raw = Derives(t, "eq")
+		}
+
+		if v.visiting == nil {
+			v.visiting = make(map[*NamedType]bool)
+		}
+		v.visiting[t] = true
+		defer delete(v.visiting, t)
+
+		var inner *GenericContext
+		if len(typ.GenericArguments) > 0 && len(getTypeGenericParameters(t)) == len(typ.GenericArguments) {
+			inner = NewGenericContextFromTypeReference(typ)
+			inner.Outer = gcon
+		}
+		if !v.check(&TypeReference{BaseType: t.Type}, inner, raw) {
+			v.why += fmt.Sprintf(", in `%s`", t.Name)
+			return false
+		}
+		return true
+
+	case PrimitiveType:
+		if v.hashed && t.IsFloatingType() {
+			return v.fail("floating-point `%s` can't be hashed, NaN is not equal to itself", t.TypeName())
+		}
+		if v.ordered {
+			return t.IsIntegerType() || t.IsFloatingType()
+		}
+		return t != PRIMITIVE_void
+
+	case PointerType, ReferenceType:
+		if !raw {
+			return v.fail("`%s` is compared by address, which needs [derive(eq)] on the type that contains it", typ.String())
+		}
+		return true
+
+	case FunctionType:
+		if v.hashed {
+			return v.fail("function values can't be hashed")
+		}
+		return raw && !v.ordered
+
+	case StructType:
+		if t.IsUnion {
+			return v.fail("unions can't be compared")
+		}
+		return v.checkMembers(ComparisonMembers(t), gcon, raw)
+
+	case TupleType:
+		return v.checkMembers(t.Members, gcon, false)
+
+	case EnumType:
+		if t.Simple {
+			return true
+		}
+		if v.ordered {
+			return false
+		}
+		for _, mem := range t.Members {
+			if !v.checkMembers(ComparisonMembers(mem.Type), gcon, raw) {
+				return false
+			}
+		}
+		return true
+
+	case ArrayType:
+		return v.check(t.MemberType, gcon, false)
+	}
+	return false
+}
+
+func (v *comparison) checkMembers(members []*TypeReference, gcon *GenericContext, raw bool) bool {
+	for _, mem := range members {
+		if !v.check(mem, gcon, raw) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,431 @@
+package ast
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ku-lang/ku/parser"
+)
+
+// 常量求值器：在类型推导之后计算常量表达式的值，用于编译期断言（static_assert），
+// 以及文档中显示不可变全局变量的初始值（如 let size = 4 * 1024 显示为 4096）。
+// 数组类型的长度也可以是常量表达式，在变量解析结束时求值（这时表达式还没有类型）。
+// 只计算字面量、不可变全局变量、sizeof/alignof/offsetof、数值之间的转换，以及它们的算术、位运算、比较和逻辑运算，
+// 类型推导之后还可以计算实参都是常量的纯函数调用（参见 ctfe.go）。
+// 有类型的整数运算和转换的结果按类型的位宽回绕，与生成的代码一致（如 u8(255) + 1 == 0）。
+// int、uint、uintptr 的位宽取决于目标平台，至少是32位，结果超出32位的范围时由 SizeOf 得到位宽
+
+// TypeLayout 目标平台上类型的大小、对齐以及结构体成员的偏移
+type TypeLayout interface {
+	SizeOf(typ *TypeReference) (uint64, bool)
+	AlignOf(typ *TypeReference) (uint64, bool)
+	OffsetOf(typ *TypeReference, member string) (uint64, bool)
+}
+
+// TargetLayout 编译目标的类型布局，由编译器在变量解析之前设置。
+// 数组长度在变量解析结束时求值，其中的 sizeof、alignof、offsetof 由它计算，为nil时它们不是常量
+var TargetLayout TypeLayout
+
+// Constant 常量的值
+type Constant struct {
+	Kind  ConstKind
+	Int   *big.Int
+	Float float64
+	Str   string
+	Bool  bool
+	Rune  rune
+}
+
+type ConstKind int
+
+const (
+	ConstInt ConstKind = iota
+	ConstFloat
+	ConstString
+	ConstBool
+	ConstRune
+)
+
+func (v *Constant) String() string {
+	switch v.Kind {
+	case ConstInt:
+		return v.Int.String()
+	case ConstFloat:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case ConstString:
+		return strconv.Quote(v.Str)
+	case ConstBool:
+		return strconv.FormatBool(v.Bool)
+	default:
+		return strconv.QuoteRune(v.Rune)
+	}
+}
+
+// Literal 把常量写成ku的字面量，如写入接口文件和REPL会话
+func (v *Constant) Literal() string {
+	switch v.Kind {
+	case ConstInt:
+		return v.Int.String()
+	case ConstFloat:
+		switch {
+		case math.IsNaN(v.Float):
+			return parser.FLOAT_NAN
+		case math.IsInf(v.Float, 1):
+			return parser.FLOAT_INF
+		case math.IsInf(v.Float, -1):
+			return "-" + parser.FLOAT_INF
+		}
+		// 没有小数点时是整数字面量
+		str := strconv.FormatFloat(v.Float, 'f', -1, 64)
+		if !strings.Contains(str, ".") {
+			str += ".0"
+		}
+		return str
+	case ConstBool:
+		return strconv.FormatBool(v.Bool)
+	case ConstString:
+		return "\"" + parser.EscapeString(v.Str, '"') + "\""
+	default:
+		return "'" + parser.EscapeString(string(v.Rune), '\'') + "'"
+	}
+}
+
+// ConstEvaluator 计算常量表达式
+type ConstEvaluator struct {
+	// SizeOf、AlignOf、OffsetOf 返回类型的大小、对齐以及结构体成员的偏移。
+	// 它们由目标平台的数据布局决定，只有代码生成时才知道，为nil时 sizeof、alignof、offsetof 不是常量
+	SizeOf   func(typ *TypeReference) (uint64, bool)
+	AlignOf  func(typ *TypeReference) (uint64, bool)
+	OffsetOf func(typ *TypeReference, member string) (uint64, bool)
+
+	// Calls 是否计算纯函数的调用。类型推导之前不知道函数体中的类型，不能计算
+	Calls bool
+
+	consts   map[*Variable]*VariableDecl // 所有不可变的全局变量
+	modules  map[*Module]bool            // 已经加入consts的模块
+	visiting map[*Variable]bool
+
+	frames []*ctfeFrame // 正在解释执行的函数调用
+	steps  int          // 当前的最外层调用已经执行的语句数
+}
+
+// NewConstEvaluator 创建常量求值器，常量可以引用这些模块以及变量所属的模块中的不可变全局变量
+func NewConstEvaluator(modules []*Module) *ConstEvaluator {
+	res := &ConstEvaluator{
+		consts:   make(map[*Variable]*VariableDecl),
+		modules:  make(map[*Module]bool),
+		visiting: make(map[*Variable]bool),
+	}
+	for _, module := range modules {
+		res.addModule(module)
+	}
+	return res
+}
+
+// addModule 记录模块中的不可变全局变量
+func (v *ConstEvaluator) addModule(module *Module) {
+	if v.modules[module] {
+		return
+	}
+	v.modules[module] = true
+	for _, submod := range module.Parts {
+		for _, node := range submod.Nodes {
+			if decl, ok := node.(*VariableDecl); ok && !decl.Variable.Mutable {
+				v.consts[decl.Variable] = decl
+			}
+		}
+	}
+}
+
+// Eval 计算表达式的值，不是常量表达式时返回nil
+func (v *ConstEvaluator) Eval(expr Expr) *Constant {
+	switch expr := expr.(type) {
+	case *NumericLiteral:
+		if expr.IsFloat {
+			return &Constant{Kind: ConstFloat, Float: expr.FloatValue}
+		}
+		return &Constant{Kind: ConstInt, Int: expr.IntValue}
+	case *StringLiteral:
+		return &Constant{Kind: ConstString, Str: expr.Value}
+	case *BoolLiteral:
+		return &Constant{Kind: ConstBool, Bool: expr.Value}
+	case *RuneLiteral:
+		return &Constant{Kind: ConstRune, Rune: expr.Value}
+
+	case *VariableAccessExpr:
+		if len(v.frames) > 0 {
+			if value, ok := v.frames[len(v.frames)-1].locals[expr.Variable]; ok {
+				return value
+			}
+		}
+		if expr.Variable != nil && expr.Variable.ParentModule != nil {
+			v.addModule(expr.Variable.ParentModule)
+		}
+		decl, ok := v.consts[expr.Variable]
+		if !ok || decl.Assignment == nil || v.visiting[expr.Variable] {
+			return nil
+		}
+		v.visiting[expr.Variable] = true
+		defer delete(v.visiting, expr.Variable)
+		return v.Eval(decl.Assignment)
+
+	case *SizeofExpr:
+		if v.SizeOf == nil {
+			return nil
+		}
+		typ := expr.Type
+		if expr.Expr != nil {
+			typ = expr.Expr.GetType()
+		}
+		if typ == nil {
+			return nil
+		}
+		size, ok := v.SizeOf(typ)
+		if !ok {
+			return nil
+		}
+		return &Constant{Kind: ConstInt, Int: new(big.Int).SetUint64(size)}
+
+	case *AlignofExpr:
+		if v.AlignOf == nil {
+			return nil
+		}
+		typ := expr.Type
+		if expr.Expr != nil {
+			typ = expr.Expr.GetType()
+		}
+		if typ == nil {
+			return nil
+		}
+		align, ok := v.AlignOf(typ)
+		if !ok {
+			return nil
+		}
+		return &Constant{Kind: ConstInt, Int: new(big.Int).SetUint64(align)}
+
+	case *OffsetofExpr:
+		if v.OffsetOf == nil {
+			return nil
+		}
+		offset, ok := v.OffsetOf(expr.Type, expr.Member)
+		if !ok {
+			return nil
+		}
+		return &Constant{Kind: ConstInt, Int: new(big.Int).SetUint64(offset)}
+
+	case *CastExpr:
+		return v.wrapInt(evalCast(v.Eval(expr.Expr), expr.Type), expr.Type)
+
+	case *UnaryExpr:
+		return v.wrapInt(evalUnary(expr.Op, v.Eval(expr.Expr)), expr.GetType())
+
+	case *BinaryExpr:
+		return v.wrapInt(evalBinary(expr.Op, v.Eval(expr.Lhand), v.Eval(expr.Rhand)), expr.GetType())
+
+	case *CallExpr:
+		return v.evalCall(expr)
+	}
+	return nil
+}
+
+// wrapInt 把整数x按类型typ的位宽回绕。没有类型（变量解析时的数组长度）或者不是整数类型时不变，
+// 需要位宽但不知道时返回nil
+func (v *ConstEvaluator) wrapInt(x *Constant, typ *TypeReference) *Constant {
+	if x == nil || x.Kind != ConstInt || typ == nil {
+		return x
+	}
+	prim, ok := typ.BaseType.ActualType().(PrimitiveType)
+	if !ok || !prim.IsIntegerType() {
+		return x
+	}
+
+	var bits uint
+	switch prim {
+	case PRIMITIVE_s8, PRIMITIVE_u8:
+		bits = 8
+	case PRIMITIVE_s16, PRIMITIVE_u16:
+		bits = 16
+	case PRIMITIVE_s32, PRIMITIVE_u32:
+		bits = 32
+	case PRIMITIVE_s64, PRIMITIVE_u64:
+		bits = 64
+	case PRIMITIVE_s128, PRIMITIVE_u128:
+		bits = 128
+	default:
+		if intInRange(x.Int, 32, prim.IsSigned()) {
+			return x
+		}
+		if v.SizeOf == nil {
+			return nil
+		}
+		size, ok := v.SizeOf(&TypeReference{BaseType: prim})
+		if !ok {
+			return nil
+		}
+		bits = uint(size) * 8
+	}
+
+	if intInRange(x.Int, bits, prim.IsSigned()) {
+		return x
+	}
+	// big.Int 的位运算按补码进行
+	modulus := new(big.Int).Lsh(big.NewInt(1), bits)
+	res := new(big.Int).And(x.Int, new(big.Int).Sub(modulus, big.NewInt(1)))
+	if prim.IsSigned() && res.Bit(int(bits)-1) == 1 {
+		res.Sub(res, modulus)
+	}
+	return &Constant{Kind: ConstInt, Int: res}
+}
+
+// intInRange x是否在bits位的有符号或无符号整数的范围内
+func intInRange(x *big.Int, bits uint, signed bool) bool {
+	if signed {
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		return x.Cmp(new(big.Int).Neg(limit)) >= 0 && x.Cmp(limit) < 0
+	}
+	return x.Sign() >= 0 && x.BitLen() <= int(bits)
+}
+
+// evalCast 整数和浮点数之间的转换，以及数值类型之间的转换
+func evalCast(x *Constant, typ *TypeReference) *Constant {
+	if x == nil {
+		return nil
+	}
+	prim, ok := typ.BaseType.ActualType().(PrimitiveType)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case prim.IsIntegerType() && x.Kind == ConstInt:
+		return x
+	case prim.IsIntegerType() && x.Kind == ConstFloat:
+		res, _ := big.NewFloat(x.Float).Int(nil)
+		return &Constant{Kind: ConstInt, Int: res}
+	case prim.IsFloatingType() && x.Kind == ConstInt:
+		res, _ := new(big.Float).SetInt(x.Int).Float64()
+		return &Constant{Kind: ConstFloat, Float: res}
+	case prim.IsFloatingType() && x.Kind == ConstFloat:
+		return x
+	}
+	return nil
+}
+
+func evalUnary(op parser.UnOpType, x *Constant) *Constant {
+	if x == nil {
+		return nil
+	}
+
+	switch {
+	case op == parser.UNOP_NEGATIVE && x.Kind == ConstInt:
+		return &Constant{Kind: ConstInt, Int: new(big.Int).Neg(x.Int)}
+	case op == parser.UNOP_NEGATIVE && x.Kind == ConstFloat:
+		return &Constant{Kind: ConstFloat, Float: -x.Float}
+	case op == parser.UNOP_BIT_NOT && x.Kind == ConstInt:
+		return &Constant{Kind: ConstInt, Int: new(big.Int).Not(x.Int)}
+	case op == parser.UNOP_LOG_NOT && x.Kind == ConstBool:
+		return &Constant{Kind: ConstBool, Bool: !x.Bool}
+	}
+	return nil
+}
+
+func evalBinary(op parser.BinOpType, x, y *Constant) *Constant {
+	if x == nil || y == nil || x.Kind != y.Kind {
+		return nil
+	}
+
+	switch x.Kind {
+	case ConstInt:
+		return evalIntBinary(op, x.Int, y.Int)
+
+	case ConstFloat:
+		a, b := x.Float, y.Float
+		switch op {
+		case parser.BINOP_ADD:
+			return &Constant{Kind: ConstFloat, Float: a + b}
+		case parser.BINOP_SUB:
+			return &Constant{Kind: ConstFloat, Float: a - b}
+		case parser.BINOP_MUL:
+			return &Constant{Kind: ConstFloat, Float: a * b}
+		case parser.BINOP_DIV:
+			if b != 0 {
+				return &Constant{Kind: ConstFloat, Float: a / b}
+			}
+		}
+
+	case ConstBool:
+		switch op {
+		case parser.BINOP_LOG_AND:
+			return &Constant{Kind: ConstBool, Bool: x.Bool && y.Bool}
+		case parser.BINOP_LOG_OR:
+			return &Constant{Kind: ConstBool, Bool: x.Bool || y.Bool}
+		case parser.BINOP_EQ:
+			return &Constant{Kind: ConstBool, Bool: x.Bool == y.Bool}
+		case parser.BINOP_NOT_EQ:
+			return &Constant{Kind: ConstBool, Bool: x.Bool != y.Bool}
+		}
+	}
+	return nil
+}
+
+func evalIntBinary(op parser.BinOpType, a, b *big.Int) *Constant {
+	res := new(big.Int)
+	switch op {
+	case parser.BINOP_ADD:
+		res.Add(a, b)
+	case parser.BINOP_SUB:
+		res.Sub(a, b)
+	case parser.BINOP_MUL:
+		res.Mul(a, b)
+	case parser.BINOP_DIV, parser.BINOP_MOD:
+		if b.Sign() == 0 {
+			return nil
+		}
+		// 与生成的代码一致，向零取整
+		if op == parser.BINOP_DIV {
+			res.Quo(a, b)
+		} else {
+			res.Rem(a, b)
+		}
+	case parser.BINOP_BIT_AND:
+		res.And(a, b)
+	case parser.BINOP_BIT_OR:
+		res.Or(a, b)
+	case parser.BINOP_BIT_XOR:
+		res.Xor(a, b)
+	case parser.BINOP_BIT_LEFT, parser.BINOP_BIT_RIGHT:
+		if !b.IsUint64() || b.Uint64() > 1024 {
+			return nil
+		}
+		if op == parser.BINOP_BIT_LEFT {
+			res.Lsh(a, uint(b.Uint64()))
+		} else {
+			res.Rsh(a, uint(b.Uint64()))
+		}
+
+	case parser.BINOP_LESS, parser.BINOP_LESS_EQ, parser.BINOP_GREATER, parser.BINOP_GREATER_EQ, parser.BINOP_EQ, parser.BINOP_NOT_EQ:
+		c := a.Cmp(b)
+		var ok bool
+		switch op {
+		case parser.BINOP_LESS:
+			ok = c < 0
+		case parser.BINOP_LESS_EQ:
+			ok = c <= 0
+		case parser.BINOP_GREATER:
+			ok = c > 0
+		case parser.BINOP_GREATER_EQ:
+			ok = c >= 0
+		case parser.BINOP_EQ:
+			ok = c == 0
+		default:
+			ok = c != 0
+		}
+		return &Constant{Kind: ConstBool, Bool: ok}
+
+	default:
+		return nil
+	}
+	return &Constant{Kind: ConstInt, Int: res}
+}
@@ -2,8 +2,8 @@ package ast
 
 import (
 	"fmt"
-	"os"
 	"reflect"
+	"strconv"
 
 	"github.com/ku-lang/ku/lexer"
 	"github.com/ku-lang/ku/parser"
@@ -29,6 +29,10 @@ type Constructor struct {
 
 	curTree   *parser.ParseTree
 	curSubmod *Submodule
+
+	forInCount int // 用于生成for-in循环的临时变量名
+
+	declStruct *parser.StructTypeNode // 正在构造的类型定义中的结构体，只有它可以声明静态成员
 }
 
 func (v *Constructor) err(pos lexer.Span, err string, stuff ...interface{}) {
@@ -36,25 +40,25 @@ func (v *Constructor) err(pos lexer.Span, err string, stuff ...interface{}) {
 }
 
 func (v *Constructor) errPos(pos lexer.Position, err string, stuff ...interface{}) {
-	log.Errorln("constructor",
+	log.Errorln(log.TagConstructor,
 		util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
 		pos.Filename, pos.Line, pos.Char,
 		fmt.Sprintf(err, stuff...))
 
-	log.Error("constructor", v.curTree.Source.MarkPos(pos))
+	log.Error(log.TagConstructor, v.curTree.Source.MarkPos(pos))
 
-	os.Exit(util.EXIT_FAILURE_CONSTRUCTOR)
+	util.ExitFunc(util.EXIT_FAILURE_CONSTRUCTOR)
 }
 
 func (v *Constructor) errSpan(pos lexer.Span, err string, stuff ...interface{}) {
-	log.Errorln("constructor",
+	log.Errorln(log.TagConstructor,
 		util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
 		pos.Filename, pos.StartLine, pos.StartChar,
 		fmt.Sprintf(err, stuff...))
 
-	log.Error("constructor", v.curTree.Source.MarkSpan(pos))
+	log.Error(log.TagConstructor, v.curTree.Source.MarkSpan(pos))
 
-	os.Exit(util.EXIT_FAILURE_CONSTRUCTOR)
+	util.ExitFunc(util.EXIT_FAILURE_CONSTRUCTOR)
 }
 
 func Construct(module *Module, modules *ModuleLookup) {
@@ -85,6 +89,23 @@ func (v *Constructor) constructSubmodule(tree *parser.ParseTree) {
 		if cnode != nil {
 			v.curSubmod.Nodes = append(v.curSubmod.Nodes, cnode)
 		}
+
+		// 位标志枚举需要由编译器生成 has() 方法
+		if decl, ok := cnode.(*TypeDecl); ok {
+			if et, ok := decl.NamedType.Type.(EnumType); ok && et.IsFlags() && et.Simple && len(et.GenericParameters) == 0 {
+				hasMethod := v.constructFunctionDeclNode(newFlagsHasMethodNode(node.(*parser.TypeDeclNode)))
+				v.curSubmod.Nodes = append(v.curSubmod.Nodes, hasMethod)
+			}
+
+			// 静态成员作为模块级的变量声明，参见 Resolver.ResolveTopLevelDecls
+			if st, ok := node.(*parser.TypeDeclNode).Type.(*parser.StructTypeNode); ok {
+				for _, static := range st.StaticMembers {
+					staticDecl := v.constructVarDeclNode(static)
+					staticDecl.Variable.StaticReceiverType = decl.NamedType
+					v.curSubmod.Nodes = append(v.curSubmod.Nodes, staticDecl)
+				}
+			}
+		}
 	}
 
 	v.module.Parts[v.curTree.Source.Name] = v.curSubmod
@@ -94,11 +115,18 @@ func (v *Constructor) constructSubmodule(tree *parser.ParseTree) {
 func (v *Constructor) constructNode(node parser.ParseNode) Node {
 	switch node := node.(type) {
 	case *parser.TypeDeclNode:
+		if node.Alias {
+			return v.constructTypeAliasNode(node)
+		}
 		return v.constructTypeDeclNode(node)
 	case *parser.LinkDirectiveNode:
 		return v.constructLinkDirectiveNode(node)
 	case *parser.UseDirectiveNode:
 		return v.constructUseDirectiveNode(node)
+	case *parser.WarnDirectiveNode:
+		return v.constructWarnDirectiveNode(node)
+	case *parser.FeatureDirectiveNode:
+		return v.constructFeatureDirectiveNode(node)
 	case *parser.FunctionDeclNode:
 		return v.constructFunctionDeclNode(node)
 	case *parser.VarDeclNode:
@@ -107,11 +135,18 @@ func (v *Constructor) constructNode(node parser.ParseNode) Node {
 		return v.constructDestructVarDeclNode(node)
 	case *parser.DeferStatNode:
 		return v.constructDeferStatNode(node)
+	case *parser.StaticAssertNode:
+		return v.constructStaticAssertNode(node)
+	case *parser.VolatileStoreStatNode:
+		return v.constructVolatileStoreStatNode(node)
 	case *parser.IfStatNode:
-		return v.constructIfStatNode(node)
+		return v.constructIfStatNode(node, false)
 	case *parser.MatchStatNode:
-		return v.constructMatchStatNode(node)
+		return v.constructMatchStatNode(node, false)
 	case *parser.LoopStatNode:
+		if node.Iterable != nil {
+			return v.constructForInNode(node)
+		}
 		return v.constructLoopStatNode(node)
 	case *parser.ReturnStatNode:
 		return v.constructReturnStatNode(node)
@@ -131,7 +166,7 @@ func (v *Constructor) constructNode(node parser.ParseNode) Node {
 		return v.constructBinopAssignStatNode(node)
 
 	default:
-		log.Infoln("constructor", "Type of node: %s", reflect.TypeOf(node))
+		log.Infoln(log.TagConstructor, "Type of node: %s", reflect.TypeOf(node))
 		panic("Encountered un-constructable node")
 	}
 }
@@ -158,7 +193,7 @@ func (v *Constructor) constructType(node parser.ParseNode) Type {
 		return v.constructEnumTypeNode(node)
 
 	default:
-		log.Infoln("constructor", "Type of node: %s", reflect.TypeOf(node))
+		log.Infoln(log.TagConstructor, "Type of node: %s", reflect.TypeOf(node))
 		panic("Encountered un-constructable node")
 	}
 }
@@ -171,6 +206,24 @@ func (v *Constructor) constructExpr(node parser.ParseNode) Expr {
 		return v.constructArrayLenExprNode(node)
 	case *parser.SizeofExprNode:
 		return v.constructSizeofExprNode(node)
+	case *parser.AlignofExprNode:
+		return v.constructAlignofExprNode(node)
+	case *parser.OffsetofExprNode:
+		return v.constructOffsetofExprNode(node)
+	case *parser.OverflowArithExprNode:
+		return v.constructOverflowArithExprNode(node)
+	case *parser.FloatBuiltinExprNode:
+		return v.constructFloatBuiltinExprNode(node)
+	case *parser.BitcastExprNode:
+		return v.constructBitcastExprNode(node)
+	case *parser.VolatileLoadExprNode:
+		return v.constructVolatileLoadExprNode(node)
+	case *parser.CStringExprNode:
+		return v.constructCStringExprNode(node)
+	case *parser.HashExprNode:
+		return v.constructHashExprNode(node)
+	case *parser.NewExprNode:
+		return v.constructNewExprNode(node)
 	case *parser.AddrofExprNode:
 		return v.constructAddrofExprNode(node)
 	case *parser.CastExprNode:
@@ -185,6 +238,8 @@ func (v *Constructor) constructExpr(node parser.ParseNode) Expr {
 		return v.constructStructAccessNode(node)
 	case *parser.ArrayAccessNode:
 		return v.constructArrayAccessNode(node)
+	case *parser.SliceNode:
+		return v.constructSliceNode(node)
 	case *parser.DiscardAccessNode:
 		return v.constructDiscardAccessNode(node)
 	case *parser.EnumPatternNode:
@@ -203,9 +258,11 @@ func (v *Constructor) constructExpr(node parser.ParseNode) Expr {
 		return v.constructRuneLitNode(node)
 	case *parser.LambdaExprNode:
 		return v.constructLambdaExprNode(node)
+	case *parser.CondExprNode:
+		return v.constructCondExprNode(node)
 
 	default:
-		log.Infoln("constructor", "Type of node: %s", reflect.TypeOf(node))
+		log.Infoln(log.TagConstructor, "Type of node: %s", reflect.TypeOf(node))
 		panic("Encountered un-constructable node")
 	}
 }
@@ -281,7 +338,11 @@ func (c *Constructor) constructFunctionTypeNode(v *parser.FunctionTypeNode) Func
 
 func (c *Constructor) constructArrayTypeNode(v *parser.ArrayTypeNode) ArrayType {
 	memberType := c.constructTypeReferenceNode(v.MemberType)
-	return ArrayOf(memberType, v.IsFixedLength, v.Length)
+	res := ArrayOf(memberType, v.IsFixedLength, v.Length)
+	if v.LengthExpr != nil {
+		res.LengthExpr = c.constructExpr(v.LengthExpr)
+	}
+	return res
 }
 
 func (c *Constructor) constructNamedTypeNode(v *parser.NamedTypeNode) UnresolvedType {
@@ -311,10 +372,15 @@ func (c *Constructor) constructInterfaceTypeNode(v *parser.InterfaceTypeNode) In
 }
 
 func (c *Constructor) constructStructTypeNode(v *parser.StructTypeNode) StructType {
+	if len(v.StaticMembers) > 0 && v != c.declStruct {
+		c.err(v.StaticMembers[0].Where(), "Static members can only be declared in type declarations")
+	}
+
 	structType := StructType{
 		attrs:             v.Attrs(),
 		GenericParameters: c.constructGenericSigilNode(v.GenericSigil),
 		Module:            c.module,
+		IsUnion:           v.IsUnion,
 	}
 
 	for _, member := range v.Members {
@@ -329,9 +395,15 @@ func (c *Constructor) constructEnumTypeNode(v *parser.EnumTypeNode) EnumType {
 		Simple:            true,
 		Members:           make([]EnumTypeMember, len(v.Members)),
 		GenericParameters: c.constructGenericSigilNode(v.GenericSigil),
+		attrs:             v.Attrs(),
 	}
 
+	// 位标志枚举没有显式赋值的成员，依次使用下一个2的幂：1, 2, 4, ...
+	isFlags := v.Attrs().Contains("flags")
 	lastValue := 0
+	if isFlags {
+		lastValue = 1
+	}
 	for idx, mem := range v.Members {
 		enumType.Members[idx].Name = mem.Name.Value
 
@@ -346,11 +418,18 @@ func (c *Constructor) constructEnumTypeNode(v *parser.EnumTypeNode) EnumType {
 		}
 
 		if mem.Value != nil {
-			// TODO: Check for overflow
+			// 是否超出标签类型 [repr(...)] 的范围，由语义分析检查
+			if !mem.Value.IntValue.IsInt64() {
+				c.err(mem.Where(), "Enum tag `%s` on member `%s` is too large", mem.Value.IntValue.String(), mem.Name.Value)
+			}
 			lastValue = int(mem.Value.IntValue.Int64())
 		}
 		enumType.Members[idx].Tag = lastValue
-		lastValue += 1
+		if isFlags {
+			lastValue = nextPowerOfTwo(lastValue)
+		} else {
+			lastValue += 1
+		}
 	}
 
 	// this should probably be somewhere else
@@ -371,6 +450,106 @@ func (c *Constructor) constructEnumTypeNode(v *parser.EnumTypeNode) EnumType {
 	return enumType
 }
 
+// nextPowerOfTwo 返回大于n的最小的2的幂
+func nextPowerOfTwo(n int) int {
+	res := 1
+	for res <= n {
+		res <<= 1
+	}
+	return res
+}
+
+// newFlagsHasMethodNode 为位标志枚举生成 has() 方法的语法树，
+// 相当于 `pub fun Flags.has(flag Flags) bool = (this & flag) == flag`
+func newFlagsHasMethodNode(decl *parser.TypeDeclNode) *parser.FunctionDeclNode {
+	where := decl.Where()
+	name := func(value string) *parser.NameNode {
+		res := &parser.NameNode{Name: parser.LocatedString{Where: where, Value: value}}
+		res.SetWhere(where)
+		return res
+	}
+	typeRef := func(typ string) *parser.TypeReferenceNode {
+		named := &parser.NamedTypeNode{Name: name(typ)}
+		named.SetWhere(where)
+		res := &parser.TypeReferenceNode{Type: named}
+		res.SetWhere(where)
+		return res
+	}
+	access := func(vari string) *parser.VariableAccessNode {
+		res := &parser.VariableAccessNode{Name: name(vari)}
+		res.SetWhere(where)
+		return res
+	}
+	binop := func(lhand, rhand parser.ParseNode, op parser.BinOpType) *parser.BinaryExprNode {
+		res := &parser.BinaryExprNode{Lhand: lhand, Rhand: rhand, Operator: op}
+		res.SetWhere(where)
+		return res
+	}
+
+	receiver := &parser.VarDeclNode{
+		Name:             parser.LocatedString{Where: where, Value: "this"},
+		Type:             typeRef(decl.Name.Value),
+		IsImplicit:       true,
+		IsMethodReceiver: true,
+	}
+	receiver.SetWhere(where)
+
+	flag := &parser.VarDeclNode{
+		Name: parser.LocatedString{Where: where, Value: "flag"},
+		Type: typeRef(decl.Name.Value),
+	}
+	flag.SetWhere(where)
+
+	header := &parser.FunctionHeaderNode{
+		Name:       parser.LocatedString{Where: where, Value: "has"},
+		Arguments:  []*parser.VarDeclNode{flag},
+		ReturnType: typeRef("bool"),
+		Receiver:   receiver,
+	}
+	header.SetWhere(where)
+
+	fn := &parser.FunctionNode{
+		Header: header,
+		Expr:   binop(binop(access("this"), access("flag"), parser.BINOP_BIT_AND), access("flag"), parser.BINOP_EQ),
+	}
+	fn.SetWhere(where)
+
+	res := &parser.FunctionDeclNode{Function: fn}
+	res.SetPublic(true)
+	res.SetWhere(where)
+	return res
+}
+
+func (c *Constructor) constructTypeAliasNode(v *parser.TypeDeclNode) *TypeAliasDecl {
+	if len(v.Attrs()) > 0 {
+		c.err(v.Where(), "Type alias `%s` cannot have attributes", v.Name.Value)
+	}
+
+	alias := &TypeAlias{
+		Name:              v.Name.Value,
+		GenericParameters: c.constructGenericSigilNode(v.GenericSigil),
+		Type:              c.constructTypeReferenceNode(v.Type.(*parser.TypeReferenceNode)),
+		ParentModule:      c.module,
+		submod:            c.curSubmod,
+	}
+	for _, par := range alias.GenericParameters {
+		if len(par.Constraints) > 0 {
+			c.err(v.GenericSigil.Where(), "Generic parameter `%s` of type alias `%s` cannot have constraints", par.Name, alias.Name)
+		}
+	}
+
+	alias.SetPos(v.Where().Start())
+
+	res := &TypeAliasDecl{
+		docs:  v.DocComments(),
+		Alias: alias,
+	}
+	res.SetPublic(v.IsPublic())
+	res.SetFilePrivate(v.IsFilePrivate())
+	res.SetPos(v.Where().Start())
+	return res
+}
+
 func (c *Constructor) constructTypeDeclNode(v *parser.TypeDeclNode) *TypeDecl {
 	var paramNodes []parser.ParseNode
 
@@ -381,17 +560,30 @@ func (c *Constructor) constructTypeDeclNode(v *parser.TypeDeclNode) *TypeDecl {
 		}
 	}
 
+	// 类型定义前的标注，如 [packed]、[repr(u8)]，属于被定义的类型本身
+	if len(v.Attrs()) > 0 {
+		attrs := make(parser.AttrGroup)
+		attrs.Extend(v.Type.Attrs())
+		attrs.Extend(v.Attrs())
+		v.Type.SetAttrs(attrs)
+	}
+
+	if st, ok := v.Type.(*parser.StructTypeNode); ok {
+		c.declStruct = st
+	}
 	namedType := &NamedType{
 		Name:         v.Name.Value,
 		Type:         c.constructType(v.Type),
 		ParentModule: c.module,
 	}
+	c.declStruct = nil
 
 	res := &TypeDecl{
 		NamedType: namedType,
 	}
 
 	res.SetPublic(v.IsPublic())
+	res.SetFilePrivate(v.IsFilePrivate())
 	res.SetPos(v.Where().Start())
 
 	return res
@@ -402,6 +594,28 @@ func (c *Constructor) constructLinkDirectiveNode(v *parser.LinkDirectiveNode) No
 	return nil
 }
 
+func (c *Constructor) constructWarnDirectiveNode(v *parser.WarnDirectiveNode) Node {
+	res := &WarnDirective{Name: v.Name.Value}
+	switch v.Level.Value {
+	case "off":
+		res.Level = WARN_OFF
+	case "error":
+		res.Level = WARN_ERROR
+	default:
+		res.Level = WARN_ON
+	}
+	res.SetPos(v.Where().Start())
+	c.curSubmod.WarnDirectives = append(c.curSubmod.WarnDirectives, res)
+	return nil
+}
+
+func (c *Constructor) constructFeatureDirectiveNode(v *parser.FeatureDirectiveNode) Node {
+	res := &FeatureDirective{Feature: v.Feature.Value}
+	res.SetPos(v.Where().Start())
+	c.curSubmod.FeatureDirectives = append(c.curSubmod.FeatureDirectives, res)
+	return nil
+}
+
 func (c *Constructor) constructUseDirectiveNode(v *parser.UseDirectiveNode) *UseDirective {
 	res := &UseDirective{}
 	res.ModuleName = toUnresolvedName(v.Module)
@@ -420,6 +634,7 @@ func (c *Constructor) constructFunctionDeclNode(v *parser.FunctionDeclNode) *Fun
 	}
 
 	res.SetPublic(v.IsPublic())
+	res.SetFilePrivate(v.IsFilePrivate())
 	res.SetPos(v.Where().Start())
 	return res
 }
@@ -455,6 +670,7 @@ func (c *Constructor) constructVarDeclNode(v *parser.VarDeclNode) *VariableDecl
 	}
 
 	res.SetPublic(v.IsPublic())
+	res.SetFilePrivate(v.IsFilePrivate())
 	res.SetPos(v.Where().Start())
 	return res
 }
@@ -493,32 +709,156 @@ func (c *Constructor) constructDeferStatNode(v *parser.DeferStatNode) *DeferStat
 	return res
 }
 
-func (c *Constructor) constructIfStatNode(v *parser.IfStatNode) *IfStat {
+func (c *Constructor) constructStaticAssertNode(v *parser.StaticAssertNode) *StaticAssertStat {
+	res := &StaticAssertStat{}
+	res.Cond = c.constructExpr(v.Cond)
+	if v.Message != nil {
+		res.Message = v.Message.Value
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructVolatileStoreStatNode(v *parser.VolatileStoreStatNode) *VolatileStoreStat {
+	res := &VolatileStoreStat{
+		Pointer: c.constructExpr(v.Pointer),
+		Value:   c.constructExpr(v.Value),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+// constructIfStatNode 构造if语句。value为true时是作为表达式的if，分支是有值的代码块
+func (c *Constructor) constructIfStatNode(v *parser.IfStatNode, value bool) *IfStat {
+	block := c.constructBlockNode
+	if value {
+		block = c.constructValueBlock
+	}
+
 	res := &IfStat{}
 	for _, part := range v.Parts {
 		res.Exprs = append(res.Exprs, c.constructExpr(part.Condition))
-		res.Bodies = append(res.Bodies, c.constructBlockNode(part.Body))
+		res.Bodies = append(res.Bodies, block(part.Body))
 	}
 	if v.ElseBody != nil {
-		res.Else = c.constructBlockNode(v.ElseBody)
+		res.Else = block(v.ElseBody)
 	}
 	res.SetPos(v.Where().Start())
 	return res
 }
 
-func (c *Constructor) constructMatchStatNode(v *parser.MatchStatNode) *MatchStat {
+// constructMatchStatNode 构造match语句。value为true时是作为表达式的match，分支是有值的代码块或者语句
+func (c *Constructor) constructMatchStatNode(v *parser.MatchStatNode, value bool) *MatchStat {
 	res := &MatchStat{}
 	res.Target = c.constructExpr(v.Value)
 	res.Branches = make(map[Expr]Node)
 	for _, branch := range v.Cases {
 		pattern := c.constructExpr(branch.Pattern)
-		body := c.constructNode(branch.Body)
+		var body Node
+		switch {
+		case value:
+			body = c.constructValueBranch(branch)
+		case branch.Value != nil:
+			// 作为语句的match中，分支可以是if或match语句，其它的值没有用到
+			cond, ok := branch.Value.(*parser.CondExprNode)
+			if !ok {
+				c.err(branch.Value.Where(), "Value of match arm is unused")
+			}
+			body = c.constructNode(cond.Stat)
+		default:
+			body = c.constructNode(branch.Body)
+		}
 		res.Branches[pattern] = body
 	}
 	res.SetPos(v.Where().Start())
 	return res
 }
 
+// constructValueBranch 作为表达式的match的分支：=> 之后的值和调用是只有值的代码块，其它语句（如return）不变
+func (c *Constructor) constructValueBranch(v *parser.MatchCaseNode) Node {
+	var tail parser.ParseNode
+	switch body := v.Body.(type) {
+	case nil:
+		tail = v.Value
+	case *parser.BlockNode:
+		return c.constructValueBlock(body)
+	case *parser.CallStatNode:
+		tail = body.Call
+	default:
+		return c.constructNode(body)
+	}
+
+	res := &Block{Tail: c.constructExpr(tail)}
+	res.SetPos(tail.Where().Start())
+	return res
+}
+
+// constructCondExprNode 构造作为表达式的if和match
+func (c *Constructor) constructCondExprNode(v *parser.CondExprNode) *CondExpr {
+	res := &CondExpr{}
+	switch stat := v.Stat.(type) {
+	case *parser.IfStatNode:
+		res.Stat = c.constructIfStatNode(stat, true)
+	case *parser.MatchStatNode:
+		res.Stat = c.constructMatchStatNode(stat, true)
+	default:
+		panic("INTERNAL ERROR: Conditional expression was not if or match")
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+// hasBranchValues 分支中是否有代码块的值，有时if或match语句作为表达式使用
+func hasBranchValues(node parser.ParseNode) bool {
+	switch n := node.(type) {
+	case *parser.IfStatNode:
+		for _, part := range n.Parts {
+			if blockHasValue(part.Body) {
+				return true
+			}
+		}
+		return n.ElseBody != nil && blockHasValue(n.ElseBody)
+
+	case *parser.MatchStatNode:
+		for _, branch := range n.Cases {
+			if branch.Value != nil {
+				return true
+			}
+			if body, ok := branch.Body.(*parser.BlockNode); ok && blockHasValue(body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func blockHasValue(block *parser.BlockNode) bool {
+	return block.Tail != nil || (len(block.Nodes) > 0 && hasBranchValues(block.Nodes[len(block.Nodes)-1]))
+}
+
+// valueBlockTail 代码块的值：最后的表达式。作为值的代码块中，最后的调用语句，以及分支有值的if和match语句也是代码块的值。
+// 返回其余的语句和代码块的值
+func valueBlockTail(v *parser.BlockNode, calls bool) ([]parser.ParseNode, parser.ParseNode) {
+	if v.Tail != nil || len(v.Nodes) == 0 {
+		return v.Nodes, v.Tail
+	}
+
+	nodes, last := v.Nodes[:len(v.Nodes)-1], v.Nodes[len(v.Nodes)-1]
+	switch last := last.(type) {
+	case *parser.CallStatNode:
+		if calls {
+			return nodes, last.Call
+		}
+	case *parser.IfStatNode, *parser.MatchStatNode:
+		if hasBranchValues(last) {
+			cond := &parser.CondExprNode{Stat: last}
+			cond.SetWhere(last.Where())
+			return nodes, cond
+		}
+	}
+	return v.Nodes, nil
+}
+
 func (c *Constructor) constructLoopStatNode(v *parser.LoopStatNode) *LoopStat {
 	res := &LoopStat{}
 	if v.Condition != nil {
@@ -532,6 +872,111 @@ func (c *Constructor) constructLoopStatNode(v *parser.LoopStatNode) *LoopStat {
 	return res
 }
 
+// constructForInNode 展开for-in循环，`for x in iterable { body }` 相当于
+//
+//	{
+//		var __for_iter = iterable.iter();
+//		for {
+//			match __for_iter.next() {
+//				Some(x) => { body },
+//				None => break,
+//			}
+//		}
+//	}
+//
+// iterable不是变量或成员访问时先保存到临时变量中。协议方法的签名由 semantic.IteratorCheck 检查
+func (c *Constructor) constructForInNode(v *parser.LoopStatNode) *BlockStat {
+	where := v.Iterable.Where()
+	c.forInCount++
+	suffix := strconv.Itoa(c.forInCount)
+
+	name := func(value string) *parser.NameNode {
+		res := &parser.NameNode{Name: parser.LocatedString{Where: where, Value: value}}
+		res.SetWhere(where)
+		return res
+	}
+	access := func(vari string) *parser.VariableAccessNode {
+		res := &parser.VariableAccessNode{Name: name(vari)}
+		res.SetWhere(where)
+		return res
+	}
+	methodCall := func(recv parser.ParseNode, method string) *parser.CallExprNode {
+		member := &parser.StructAccessNode{Struct: recv, Member: parser.LocatedString{Where: where, Value: method}}
+		member.SetWhere(where)
+		res := &parser.CallExprNode{Function: member}
+		res.SetWhere(where)
+		return res
+	}
+	varDecl := func(vari string, value parser.ParseNode) *parser.VarDeclNode {
+		res := &parser.VarDeclNode{
+			Name:    parser.LocatedString{Where: where, Value: vari},
+			Value:   value,
+			Mutable: parser.LocatedString{Where: where, Value: parser.KEYWORD_VAR},
+		}
+		res.SetWhere(where)
+		return res
+	}
+
+	var nodes []parser.ParseNode
+	iterable := v.Iterable
+	switch iterable.(type) {
+	case *parser.VariableAccessNode, *parser.StructAccessNode:
+	default:
+		decl := varDecl("__for_iterable"+suffix, iterable)
+		nodes = append(nodes, decl)
+		iterable = access(decl.Name.Value)
+	}
+
+	iterDecl := varDecl("__for_iter"+suffix, methodCall(iterable, "iter"))
+	nodes = append(nodes, iterDecl)
+
+	somePattern := &parser.EnumPatternNode{MemberName: name("Some"), Names: []parser.LocatedString{v.Variable}}
+	somePattern.SetWhere(v.Variable.Where)
+	someCase := &parser.MatchCaseNode{Pattern: somePattern, Body: v.Body}
+	someCase.SetWhere(v.Body.Where())
+
+	nonePattern := &parser.EnumPatternNode{MemberName: name("None")}
+	nonePattern.SetWhere(where)
+	breakStat := &parser.BreakStatNode{}
+	breakStat.SetWhere(where)
+	noneCase := &parser.MatchCaseNode{Pattern: nonePattern, Body: breakStat}
+	noneCase.SetWhere(where)
+
+	match := &parser.MatchStatNode{
+		Value: methodCall(access(iterDecl.Name.Value), "next"),
+		Cases: []*parser.MatchCaseNode{someCase, noneCase},
+	}
+	match.SetWhere(v.Where())
+
+	loopBody := &parser.BlockNode{Nodes: []parser.ParseNode{match}}
+	loopBody.SetWhere(v.Body.Where())
+	loop := &parser.LoopStatNode{Body: loopBody}
+	loop.SetWhere(v.Where())
+	nodes = append(nodes, loop)
+
+	block := &parser.BlockNode{Nodes: nodes}
+	block.SetWhere(v.Where())
+	blockStat := &parser.BlockStatNode{Body: block}
+	blockStat.SetWhere(v.Where())
+
+	res := c.constructBlockStatNode(blockStat)
+	stats := res.Block.Nodes
+	loopStat := stats[len(stats)-1].(*LoopStat)
+	matchStat := loopStat.Body.Nodes[0].(*MatchStat)
+	forIn := &ForInLoop{
+		IterCall: stats[len(stats)-2].(*VariableDecl).Assignment.(*CallExpr),
+		NextCall: matchStat.Target.(*CallExpr),
+	}
+	forIn.Iterable = forIn.IterCall.ReceiverAccess
+	for pattern := range matchStat.Branches {
+		if enum, ok := pattern.(*EnumPatternExpr); ok && len(enum.Variables) == 1 {
+			forIn.Variable = enum.Variables[0]
+		}
+	}
+	loopStat.ForIn = forIn
+	return res
+}
+
 func (c *Constructor) constructReturnStatNode(v *parser.ReturnStatNode) *ReturnStat {
 	res := &ReturnStat{}
 	if v.Value != nil {
@@ -561,13 +1006,48 @@ func (c *Constructor) constructBlockStatNode(v *parser.BlockStatNode) *BlockStat
 }
 
 func (c *Constructor) constructBlockNode(v *parser.BlockNode) *Block {
+	if v.Tail != nil {
+		c.err(v.Tail.Where(), "Value of expression is unused")
+	}
+
 	res := &Block{}
 	res.NonScoping = v.NonScoping
+	res.IsUnsafe = v.Unsafe
 	res.Nodes = c.constructNodes(v.Nodes)
 	res.SetPos(v.Where().Start())
 	return res
 }
 
+// constructValueBlock 作为表达式的if和match的分支，代码块的值参见 valueBlockTail
+func (c *Constructor) constructValueBlock(v *parser.BlockNode) *Block {
+	nodes, tail := valueBlockTail(v, true)
+
+	res := &Block{}
+	res.NonScoping = v.NonScoping
+	res.IsUnsafe = v.Unsafe
+	res.Nodes = c.constructNodes(nodes)
+	if tail != nil {
+		res.Tail = c.constructExpr(tail)
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+// constructFunctionBody 函数体的值是函数的返回值，构造为return语句
+func (c *Constructor) constructFunctionBody(v *parser.BlockNode) *Block {
+	nodes, tail := valueBlockTail(v, false)
+
+	res := &Block{}
+	res.Nodes = c.constructNodes(nodes)
+	if tail != nil {
+		ret := &ReturnStat{Value: c.constructExpr(tail)}
+		ret.SetPos(tail.Where().Start())
+		res.Nodes = append(res.Nodes, ret)
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
 func (c *Constructor) constructCallStatNode(v *parser.CallStatNode) *CallStat {
 	res := &CallStat{}
 	res.Call = c.constructExpr(v.Call).(*CallExpr)
@@ -671,6 +1151,87 @@ func (c *Constructor) constructSizeofExprNode(v *parser.SizeofExprNode) *SizeofE
 	return res
 }
 
+func (c *Constructor) constructAlignofExprNode(v *parser.AlignofExprNode) *AlignofExpr {
+	res := &AlignofExpr{}
+	if v.Value != nil {
+		res.Expr = c.constructExpr(v.Value)
+	} else if v.Type != nil {
+		res.Type = c.constructTypeReferenceNode(v.Type)
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructOffsetofExprNode(v *parser.OffsetofExprNode) *OffsetofExpr {
+	res := &OffsetofExpr{Member: v.Member.Value}
+	if v.Type != nil {
+		res.Type = c.constructTypeReferenceNode(v.Type)
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructFloatBuiltinExprNode(v *parser.FloatBuiltinExprNode) Expr {
+	res := &FloatBuiltinExpr{Builtin: v.Builtin}
+	for _, arg := range v.Arguments {
+		res.Arguments = append(res.Arguments, c.constructExpr(arg))
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructBitcastExprNode(v *parser.BitcastExprNode) *BitcastExpr {
+	res := &BitcastExpr{
+		Type: c.constructTypeReferenceNode(v.Type),
+		Expr: c.constructExpr(v.Value),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructVolatileLoadExprNode(v *parser.VolatileLoadExprNode) *VolatileLoadExpr {
+	res := &VolatileLoadExpr{
+		Pointer: c.constructExpr(v.Pointer),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructCStringExprNode(v *parser.CStringExprNode) *CStringExpr {
+	res := &CStringExpr{
+		Expr: c.constructExpr(v.Value),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructHashExprNode(v *parser.HashExprNode) *HashExpr {
+	res := &HashExpr{
+		Expr: c.constructExpr(v.Value),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructNewExprNode(v *parser.NewExprNode) *NewExpr {
+	res := &NewExpr{
+		Expr: c.constructExpr(v.Value),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+func (c *Constructor) constructOverflowArithExprNode(v *parser.OverflowArithExprNode) *OverflowArithExpr {
+	res := &OverflowArithExpr{
+		Mode:  v.Mode,
+		Op:    v.Operator,
+		Lhand: c.constructExpr(v.Lhand),
+		Rhand: c.constructExpr(v.Rhand),
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
 func (c *Constructor) constructAddrofExprNode(v *parser.AddrofExprNode) Expr {
 	var res Expr
 	if v.IsReference {
@@ -753,7 +1314,7 @@ func (c *Constructor) constructStructAccessNode(v *parser.StructAccessNode) *Str
 	res := &StructAccessExpr{
 		Member: v.Member.Value,
 	}
-	res.Struct = c.constructExpr(v.Struct).(AccessExpr) // TODO: Error message
+	res.Struct = c.constructAccessTarget(v.Struct)
 	res.SetPos(v.Where().Start())
 	return res
 }
@@ -762,11 +1323,36 @@ func (c *Constructor) constructArrayAccessNode(v *parser.ArrayAccessNode) *Array
 	res := &ArrayAccessExpr{
 		Subscript: c.constructExpr(v.Index),
 	}
-	res.Array = c.constructExpr(v.Array).(AccessExpr) // TODO: Error message
+	res.Array = c.constructAccessTarget(v.Array)
 	res.SetPos(v.Where().Start())
 	return res
 }
 
+func (c *Constructor) constructSliceNode(v *parser.SliceNode) *SliceExpr {
+	res := &SliceExpr{
+		Array: c.constructExpr(v.Array),
+	}
+	if v.Low != nil {
+		res.Low = c.constructExpr(v.Low)
+	}
+	if v.High != nil {
+		res.High = c.constructExpr(v.High)
+	}
+	res.SetPos(v.Where().Start())
+	return res
+}
+
+// constructAccessTarget 成员访问和下标访问的对象。不是访问表达式的值作为临时值访问
+func (c *Constructor) constructAccessTarget(node parser.ParseNode) AccessExpr {
+	expr := c.constructExpr(node)
+	if access, ok := expr.(AccessExpr); ok {
+		return access
+	}
+	res := &TempAccessExpr{Expr: expr}
+	res.SetPos(expr.Pos())
+	return res
+}
+
 func (c *Constructor) constructDiscardAccessNode(v *parser.DiscardAccessNode) *DiscardAccessExpr {
 	res := &DiscardAccessExpr{}
 	res.SetPos(v.Where().Start())
@@ -795,6 +1381,10 @@ func (c *Constructor) constructTupleLiteralNode(v *parser.TupleLiteralNode) Expr
 		Members: c.constructExprs(v.Values),
 	}
 	if len(res.Members) == 1 {
+		// 单个成员的元组其实是括号表达式，需要记下括号，以便语义分析区分 (a < b) < c 和 a < b < c
+		if bin, ok := res.Members[0].(*BinaryExpr); ok {
+			bin.Parenthesized = true
+		}
 		return res.Members[0]
 	}
 	res.SetPos(v.Where().Start())
@@ -827,6 +1417,7 @@ func (c *Constructor) constructNumberLitNode(v *parser.NumberLitNode) *NumericLi
 		IsFloat:    v.IsFloat,
 		IntValue:   v.IntValue,
 		FloatValue: v.FloatValue,
+		IsDuration: v.IsDuration,
 	}
 
 	res.floatSizeHint = v.FloatSize
@@ -911,14 +1502,19 @@ func (c *Constructor) constructFunctionNode(v *parser.FunctionNode) *Function {
 
 	if v.Header.ReturnType != nil {
 		function.Type.Return = c.constructTypeReferenceNode(v.Header.ReturnType)
-	} else {
+	} else if !v.Header.Anonymous {
 		// set it to void since we haven't specified a type
 		function.Type.Return = &TypeReference{BaseType: PRIMITIVE_void}
 	}
+	// lambda省略的参数类型和返回类型在类型推导时由上下文得到，参见 LambdaExpr.SetType
 
 	if v.Header.GenericSigil != nil {
 		function.Type.GenericParameters = c.constructGenericSigilNode(v.Header.GenericSigil)
 	}
+	if v.Header.StaticReceiverSigil != nil {
+		function.StaticTypeParameters = c.constructGenericSigilNode(v.Header.StaticReceiverSigil)
+		function.Type.GenericParameters = append(append(GenericSigil{}, function.StaticTypeParameters...), function.Type.GenericParameters...)
+	}
 
 	if v.Expr != nil {
 		v.Stat = &parser.ReturnStatNode{Value: v.Expr}
@@ -927,7 +1523,7 @@ func (c *Constructor) constructFunctionNode(v *parser.FunctionNode) *Function {
 		v.Body = &parser.BlockNode{Nodes: []parser.ParseNode{v.Stat}}
 	}
 	if v.Body != nil {
-		function.Body = c.constructBlockNode(v.Body)
+		function.Body = c.constructFunctionBody(v.Body)
 	} else if v.Header.Anonymous {
 		c.err(v.Where(), "Lambda cannot be prototype")
 	}
@@ -0,0 +1,192 @@
+package ast
+
+// 编译期函数调用
+//
+//	fun square(x int) int { return x * x }
+//	static_assert(square(4) == 16);
+//
+// ConstEvaluator.Calls 为true时，常量求值器可以计算实参都是常量的纯函数调用（参见 Function.IsPure），
+// 解释执行函数体：支持局部变量的声明和赋值、if、循环、break、continue 和 return，表达式按 Eval 计算。
+// 纯函数的结果只取决于实参和不可变的全局变量，所以可以在编译时计算。
+// 遇到其他的语句（如 match、defer）、泛型函数和方法时调用不是常量。
+// 为了保证求值能结束，每次最外层调用执行的语句数和调用深度都有上限，超过时调用也不是常量。
+
+const (
+	ctfeMaxSteps = 1000000
+	ctfeMaxDepth = 128
+)
+
+type ctfeFrame struct {
+	locals map[*Variable]*Constant
+	result *Constant
+}
+
+// ctfeFlow 执行语句之后的控制流
+type ctfeFlow int
+
+const (
+	ctfeNext ctfeFlow = iota
+	ctfeBreak
+	ctfeContinue
+	ctfeReturn
+	ctfeFail // 不能在编译时执行
+)
+
+// evalCall 计算纯函数调用，不能计算时返回nil
+func (v *ConstEvaluator) evalCall(call *CallExpr) *Constant {
+	fae, ok := call.Function.(*FunctionAccessExpr)
+	if !v.Calls || !ok || call.ReceiverAccess != nil || len(fae.GenericArguments) > 0 {
+		return nil
+	}
+	fn := fae.Function
+	if fn.Body == nil || fn.Receiver != nil || len(fn.Type.GenericParameters) > 0 || fn.Type.IsVariadic ||
+		len(call.Arguments) != len(fn.Parameters) || len(v.frames) >= ctfeMaxDepth || !fn.IsPure() {
+		return nil
+	}
+
+	// 实参在调用者的栈帧中计算
+	frame := &ctfeFrame{locals: make(map[*Variable]*Constant)}
+	for idx, arg := range call.Arguments {
+		value := v.Eval(arg)
+		if value == nil {
+			return nil
+		}
+		frame.locals[fn.Parameters[idx].Variable] = value
+	}
+
+	if len(v.frames) == 0 {
+		v.steps = 0
+	}
+	v.frames = append(v.frames, frame)
+	defer func() { v.frames = v.frames[:len(v.frames)-1] }()
+
+	if v.execBlock(fn.Body) != ctfeReturn {
+		return nil
+	}
+	return frame.result
+}
+
+func (v *ConstEvaluator) execBlock(block *Block) ctfeFlow {
+	for _, node := range block.Nodes {
+		if flow := v.exec(node); flow != ctfeNext {
+			return flow
+		}
+	}
+	return ctfeNext
+}
+
+func (v *ConstEvaluator) exec(node Node) ctfeFlow {
+	v.steps++
+	if v.steps > ctfeMaxSteps {
+		return ctfeFail
+	}
+	frame := v.frames[len(v.frames)-1]
+
+	switch n := node.(type) {
+	case *VariableDecl:
+		if n.Assignment == nil {
+			return ctfeFail
+		}
+		value := v.Eval(n.Assignment)
+		if value == nil {
+			return ctfeFail
+		}
+		frame.locals[n.Variable] = value
+
+	case *AssignStat:
+		return v.assign(n.Access, v.Eval(n.Assignment))
+
+	case *BinopAssignStat:
+		value := v.Eval(n.Assignment)
+		if value == nil {
+			return ctfeFail
+		}
+		return v.assign(n.Access, v.wrapInt(evalBinary(n.Operator, v.Eval(n.Access), value), n.Access.GetType()))
+
+	case *BlockStat:
+		return v.execBlock(n.Block)
+
+	case *IfStat:
+		for idx, cond := range n.Exprs {
+			value := v.Eval(cond)
+			if value == nil || value.Kind != ConstBool {
+				return ctfeFail
+			}
+			if value.Bool {
+				return v.execBlock(n.Bodies[idx])
+			}
+		}
+		if n.Else != nil {
+			return v.execBlock(n.Else)
+		}
+
+	case *LoopStat:
+		return v.execLoop(n)
+
+	case *BreakStat:
+		return ctfeBreak
+
+	case *ContinueStat:
+		return ctfeContinue
+
+	case *ReturnStat:
+		if n.Value != nil {
+			frame.result = v.Eval(n.Value)
+			if frame.result == nil {
+				return ctfeFail
+			}
+		}
+		return ctfeReturn
+
+	case *StaticAssertStat:
+		// 编译期断言单独检查
+
+	default:
+		return ctfeFail
+	}
+	return ctfeNext
+}
+
+func (v *ConstEvaluator) execLoop(n *LoopStat) ctfeFlow {
+	if n.ForIn != nil || n.LoopType != LOOP_TYPE_INFINITE && n.LoopType != LOOP_TYPE_CONDITIONAL {
+		return ctfeFail
+	}
+
+	for {
+		v.steps++
+		if v.steps > ctfeMaxSteps {
+			return ctfeFail
+		}
+
+		if n.LoopType == LOOP_TYPE_CONDITIONAL {
+			cond := v.Eval(n.Condition)
+			if cond == nil || cond.Kind != ConstBool {
+				return ctfeFail
+			}
+			if !cond.Bool {
+				return ctfeNext
+			}
+		}
+
+		switch flow := v.execBlock(n.Body); flow {
+		case ctfeBreak:
+			return ctfeNext
+		case ctfeReturn, ctfeFail:
+			return flow
+		}
+	}
+}
+
+// assign 给当前调用的局部变量赋值
+func (v *ConstEvaluator) assign(access Expr, value *Constant) ctfeFlow {
+	frame := v.frames[len(v.frames)-1]
+	acc, ok := access.(*VariableAccessExpr)
+	if !ok || value == nil {
+		return ctfeFail
+	}
+	if _, ok := frame.locals[acc.Variable]; !ok {
+		return ctfeFail
+	}
+	frame.locals[acc.Variable] = value
+	return ctfeNext
+}
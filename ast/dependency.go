@@ -49,15 +49,20 @@ func (v *DependencyGraph) AddDependency(source, dependency *ModuleName) {
 	v.EdgesFrom[source.String()] = append(v.EdgesFrom[source.String()], dep)
 }
 
-func (d *DependencyGraph) DetectCycles() []string {
-	scgs := d.tarjan()
-
-	var errs []string
-	for _, scg := range scgs {
-		if len(scg) == 1 {
-			continue
+// Cycles 返回依赖图中的循环依赖，即包含多于一个模块的强连通分量
+func (d *DependencyGraph) Cycles() []NodeSet {
+	var res []NodeSet
+	for _, scg := range d.tarjan() {
+		if len(scg) > 1 {
+			res = append(res, scg)
 		}
+	}
+	return res
+}
 
+func (d *DependencyGraph) DetectCycles() []string {
+	var errs []string
+	for _, scg := range d.Cycles() {
 		buf := new(bytes.Buffer)
 		for idx, v := range scg {
 			buf.WriteString(v.Module.String())
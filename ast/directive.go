@@ -0,0 +1,59 @@
+package ast
+
+// 文件级指令
+//
+//	#warn(off, "unused")         在这个文件中关闭名为unused的警告
+//	#warn(error, "deprecated")   把这个文件中的警告当作错误
+//	#warn(on, "unused")          打开警告（默认）
+//	#feature("name")             在这个文件中启用实验性的语言特性，参见feature.go
+//
+// 指令作用于整个文件，与它在文件中的位置无关；同一个警告有多个 #warn 时最后一个生效。
+// 警告的名字是产生它的语义检查的名字，如 unused、deprecated、nan comparison，由 semantic.DirectiveCheck 检查
+
+// WarnLevel 警告的处理方式
+type WarnLevel int
+
+const (
+	WARN_ON WarnLevel = iota
+	WARN_OFF
+	WARN_ERROR
+)
+
+// WarnDirective #warn 指令
+type WarnDirective struct {
+	nodePos
+	Level WarnLevel
+	Name  string
+}
+
+// FeatureDirective #feature 指令
+type FeatureDirective struct {
+	nodePos
+	Feature string
+}
+
+// WarnLevel 这个文件中名为name的警告的处理方式
+func (v *Submodule) WarnLevel(name string) WarnLevel {
+	level := WARN_ON
+	for _, directive := range v.WarnDirectives {
+		if directive.Name == name {
+			level = directive.Level
+		}
+	}
+	return level
+}
+
+// FeatureEnabled 这个文件中是否启用了实验性的语言特性feature：用 #feature 启用，或者用命令行参数在所有模块中启用
+func (v *Submodule) FeatureEnabled(feature string) bool {
+	for _, enabled := range EnabledFeatures {
+		if enabled == feature {
+			return true
+		}
+	}
+	for _, directive := range v.FeatureDirectives {
+		if directive.Feature == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package ast
+
+// 析构：类型的drop方法
+//
+// 命名类型可以定义没有参数和返回值的方法drop，如 fun File.drop() 或者 fun var File.drop()。
+// 值不再使用时编译器调用它：
+//   - 局部变量在声明它的块结束时，与块中的defer一起按声明的逆序执行，return、break和continue离开的块同样如此。
+//     return返回的变量移出了函数，不在函数中drop；移出到别处的变量是零值；
+//   - 参数在函数返回时。方法的接收者是借用的，不drop；
+//   - 给变量赋值时，先drop原来的值；
+//   - new分配的值在 free(p) 释放内存之前。
+//
+// 没有初始值的变量是零值，drop方法需要能够处理零值。结构体成员、数组元素等不会自动drop，由外层类型的drop方法负责。
+// 是否drop按声明的类型判断：类型为泛型参数T的值即使T的实参有drop方法也不drop，泛型函数只检查一次，无法保证只drop一次。
+// 有drop方法的值不能复制，只能移动，参见 move.go；生成的代码参见 LLVMCodegen/drop.go
+
+// DropMethodName 析构方法的名字
+const DropMethodName = "drop"
+
+// DropMethod 类型为typ的值的drop方法，没有时返回nil。指针、引用和接口值没有drop方法
+func DropMethod(typ *TypeReference) *Function {
+	if typ == nil {
+		return nil
+	}
+	named, ok := typ.BaseType.(*NamedType)
+	if !ok {
+		return nil
+	}
+	if _, ok := InterfaceOf(typ); ok {
+		return nil
+	}
+	return named.GetMethod(DropMethodName)
+}
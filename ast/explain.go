@@ -0,0 +1,290 @@
+package ast
+
+// 类型推导的解释（--explain-types）
+//
+// 推导器为每个类型条件记录它的来源：产生条件的表达式或语句的位置。求解时由一个条件派生出来的条件
+// 沿用原条件的来源，不能统一的条件（冲突）记录在原条件上。
+// 推导出错时，或者对 --explain-at 选定的位置，从表达式的类型变量出发，沿着类型条件找出相关的条件，
+// 列出每个条件和它的来源，以及其中的类型变量代表的表达式和推导出的类型。
+//
+// 不能统一的两个类型记录在子模块上（TypeMismatch），语义检查报告类型不匹配时指出要求这两个类型的位置。
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ku-lang/ku/lexer"
+)
+
+// TypeExplanation 类型推导的解释选项
+type TypeExplanation struct {
+	OnError bool            // 推导出错时解释出错的表达式的类型
+	At      *lexer.Position // 解释这个位置上的表达式的类型。Char为0时解释整行
+}
+
+// ExplainTypes 类型推导的解释选项，由 --explain-types 和 --explain-at 设置
+var ExplainTypes TypeExplanation
+
+// 一次解释最多列出的类型条件，以及出错时最多解释的表达式
+const (
+	maxExplainedConstraints = 30
+	maxExplainedTypeds      = 3
+)
+
+// ParseExplainPosition 解析 --explain-at 的位置，格式是 file[.ku]:line[:column]。
+// 文件名与lexer.Position一样，不包含目录和扩展名
+func ParseExplainPosition(s string) (*lexer.Position, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("Invalid position `%s`, expected file:line or file:line:column", s)
+	}
+
+	base := filepath.Base(parts[0])
+	pos := &lexer.Position{Filename: strings.TrimSuffix(base, filepath.Ext(base))}
+
+	var err error
+	if pos.Line, err = strconv.Atoi(parts[1]); err != nil || pos.Line < 1 {
+		return nil, fmt.Errorf("Invalid line `%s` in position `%s`", parts[1], s)
+	}
+	if len(parts) == 3 {
+		if pos.Char, err = strconv.Atoi(parts[2]); err != nil || pos.Char < 1 {
+			return nil, fmt.Errorf("Invalid column `%s` in position `%s`", parts[2], s)
+		}
+	}
+	return pos, nil
+}
+
+// TypeOrigin 类型条件的来源：产生条件的表达式或语句
+type TypeOrigin struct {
+	Pos  lexer.Position
+	What string // 如 "variable `x`"
+}
+
+func (v *TypeOrigin) String() string {
+	if v == nil {
+		return "unknown origin"
+	}
+	return fmt.Sprintf("%s at [%s:%d:%d]", v.What, v.Pos.Filename, v.Pos.Line, v.Pos.Char)
+}
+
+// TypeMismatch 类型推导时不能统一的两个类型，以及要求这两个类型的表达式或语句
+type TypeMismatch struct {
+	Left, Right             *TypeReference
+	LeftOrigin, RightOrigin *TypeOrigin
+	Origin                  *TypeOrigin // 产生这个条件的表达式或语句
+}
+
+// FindTypeMismatch 找出推导时want与got不能统一的记录，条件或者其中一个类型来自at中的某个位置。
+// 返回要求这两个类型的表达式或语句，没有找到时返回nil
+func (v *Submodule) FindTypeMismatch(want, got *TypeReference, at ...lexer.Position) (wantOrigin, gotOrigin *TypeOrigin) {
+	for _, mismatch := range v.TypeMismatches {
+		if mismatch.Left == nil || mismatch.Right == nil {
+			continue
+		}
+
+		if Identical(mismatch.Left, want) && Identical(mismatch.Right, got) {
+			wantOrigin, gotOrigin = mismatch.LeftOrigin, mismatch.RightOrigin
+		} else if Identical(mismatch.Right, want) && Identical(mismatch.Left, got) {
+			wantOrigin, gotOrigin = mismatch.RightOrigin, mismatch.LeftOrigin
+		} else {
+			continue
+		}
+
+		for _, pos := range at {
+			for _, origin := range []*TypeOrigin{mismatch.Origin, wantOrigin, gotOrigin} {
+				if origin != nil && origin.Pos == pos {
+					return wantOrigin, gotOrigin
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// typedOrigin 以表达式（或变量等）为来源
+func typedOrigin(ann *AnnotatedTyped) *TypeOrigin {
+	return &TypeOrigin{Pos: ann.Pos, What: describeTyped(ann.Typed)}
+}
+
+// describeTyped 用于解释的表达式描述，如 "variable `x`"
+func describeTyped(typed Typed) string {
+	switch t := typed.(type) {
+	case *Variable:
+		return fmt.Sprintf("variable `%s`", t.Name)
+	case *VariableAccessExpr:
+		return fmt.Sprintf("%s `%s`", t.NodeName(), t.Name)
+	case *FunctionAccessExpr:
+		return fmt.Sprintf("%s `%s`", t.NodeName(), t.Function.Name)
+	case *StructAccessExpr:
+		return fmt.Sprintf("%s `.%s`", t.NodeName(), t.Member)
+	case *lambdaReturn:
+		return "return type of lambda"
+	case *genericArgument:
+		return fmt.Sprintf("generic argument %d of composite literal", t.Index+1)
+	case Node:
+		return t.NodeName()
+	}
+	return "expression"
+}
+
+// typeVariableIds 类型中出现的所有类型变量
+func typeVariableIds(typ *TypeReference, ids []int) []int {
+	if typ == nil {
+		return ids
+	}
+	for _, arg := range typ.GenericArguments {
+		ids = typeVariableIds(arg, ids)
+	}
+
+	switch t := typ.BaseType.(type) {
+	case TypeVariable:
+		ids = append(ids, t.Id)
+	case *ConstructorType:
+		for _, arg := range t.Args {
+			ids = typeVariableIds(arg, ids)
+		}
+	case PointerType:
+		ids = typeVariableIds(t.Addressee, ids)
+	case ReferenceType:
+		ids = typeVariableIds(t.Referrer, ids)
+	case ArrayType:
+		ids = typeVariableIds(t.MemberType, ids)
+	case TupleType:
+		for _, mem := range t.Members {
+			ids = typeVariableIds(mem, ids)
+		}
+	case FunctionType:
+		ids = typeVariableIds(t.Receiver, ids)
+		for _, par := range t.Parameters {
+			ids = typeVariableIds(par, ids)
+		}
+		ids = typeVariableIds(t.Return, ids)
+	}
+	return ids
+}
+
+// sideIds 条件的一边出现的类型变量
+func sideIds(side Side, ids []int) []int {
+	if side.SideType == IdentSide {
+		return append(ids, side.Id)
+	}
+	return typeVariableIds(side.Type, ids)
+}
+
+// explainPos 出错时解释位置pos上的表达式的类型
+func (v *Inferrer) explainPos(pos lexer.Position) string {
+	buf := new(bytes.Buffer)
+	count := 0
+	for id := 0; id < v.IdCount && count < maxExplainedTypeds; id++ {
+		if ann := v.Typeds[id]; ann != nil && ann.Pos == pos {
+			buf.WriteString(v.explain(id))
+			count++
+		}
+	}
+	return buf.String()
+}
+
+// explainSelected 解释 --explain-at 选定的位置上的表达式的类型
+func (v *Inferrer) explainSelected() {
+	at := ExplainTypes.At
+	if at == nil || at.Filename != v.Submodule.File.Name {
+		return
+	}
+	for id := 0; id < v.IdCount; id++ {
+		ann := v.Typeds[id]
+		if ann == nil || ann.Pos.Line != at.Line || (at.Char != 0 && ann.Pos.Char != at.Char) {
+			continue
+		}
+		fmt.Print(v.explain(id))
+	}
+}
+
+// explain 解释类型变量id的类型：从id出发找出相关的类型条件，以及条件中的类型变量
+func (v *Inferrer) explain(id int) string {
+	all := make([]*Constraint, 0, len(v.SimpleConstraints)+len(v.Constraints))
+	all = append(all, v.SimpleConstraints...)
+	all = append(all, v.Constraints...)
+
+	allIds := make([][]int, len(all))
+	for idx, cons := range all {
+		allIds[idx] = sideIds(cons.Right, sideIds(cons.Left, nil))
+	}
+
+	// 广度优先，先列出与id直接相关的条件
+	seen := map[int]bool{id: true}
+	vars := []int{id}
+	used := make([]bool, len(all))
+	var listed []*Constraint
+	truncated := false
+	for next := 0; next < len(vars) && !truncated; next++ {
+		for idx, ids := range allIds {
+			if used[idx] || !containsInt(ids, vars[next]) {
+				continue
+			}
+			if len(listed) == maxExplainedConstraints {
+				truncated = true
+				break
+			}
+			used[idx] = true
+			listed = append(listed, all[idx])
+			for _, other := range ids {
+				if !seen[other] {
+					seen[other] = true
+					vars = append(vars, other)
+				}
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	ann := v.Typeds[id]
+	fmt.Fprintf(buf, "note: type of %s is $%d = %s\n", typedOrigin(ann), id, v.explainSolved(id))
+	if len(listed) == 0 {
+		buf.WriteString("  no constraints involve it\n")
+		return buf.String()
+	}
+
+	buf.WriteString("  constraints:\n")
+	for _, cons := range listed {
+		fmt.Fprintf(buf, "    %s    (from %s)\n", cons, cons.origin)
+		for _, conflict := range v.conflicts {
+			if conflict.root == cons {
+				fmt.Fprintf(buf, "      conflict: %s doesn't unify with %s\n", conflict.Left, conflict.Right)
+			}
+		}
+	}
+	if truncated {
+		fmt.Fprintf(buf, "    ... (only the first %d constraints are shown)\n", maxExplainedConstraints)
+	}
+
+	buf.WriteString("  where:\n")
+	for _, other := range vars {
+		if ann := v.Typeds[other]; ann != nil {
+			fmt.Fprintf(buf, "    $%d is %s = %s\n", other, typedOrigin(ann), v.explainSolved(other))
+		}
+	}
+	return buf.String()
+}
+
+// explainSolved 类型变量id求解的结果
+func (v *Inferrer) explainSolved(id int) string {
+	if v.solution == nil {
+		return "not solved yet"
+	}
+	if subs := v.solution[id]; subs != nil {
+		return subs.Right.String()
+	}
+	return "unsolved"
+}
+
+func containsInt(xs []int, x int) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"strings"
+)
+
+// 实验性的语言特性
+//
+// 还在开发中的语言特性默认关闭，使用时报错并提示如何启用：
+//   - 命令行参数 --enable-feature=name 在所有模块中启用，参见 EnabledFeatures；
+//   - 文件中的 #feature("name") 只在这个文件中启用，参见directive.go。
+//
+// 新的特性在 LanguageFeatures 中登记，检查它的语法的地方调用 Submodule.FeatureEnabled，
+// 没有启用时用 FeatureDisabledMessage 报错。特性稳定之后从表中删除，同时删除这些检查。
+// 与cfg标注使用的模块特性（ku.json 的 features，参见 main 包的features.go）无关
+
+// LanguageFeature 一个实验性的语言特性
+type LanguageFeature struct {
+	Name        string
+	Description string
+}
+
+// LanguageFeatures 所有实验性的语言特性。嵌套函数已经稳定，目前没有实验性的特性
+var LanguageFeatures = []LanguageFeature{}
+
+// EnabledFeatures 用命令行参数 --enable-feature 在所有模块中启用的特性
+var EnabledFeatures []string
+
+// IsLanguageFeature name是否是登记过的实验性语言特性
+func IsLanguageFeature(name string) bool {
+	for _, feature := range LanguageFeatures {
+		if feature.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageFeatureNames 所有实验性语言特性的名字
+func LanguageFeatureNames() []string {
+	var names []string
+	for _, feature := range LanguageFeatures {
+		names = append(names, feature.Name)
+	}
+	return names
+}
+
+// UnknownFeatureMessage 特性name没有登记时的错误信息
+func UnknownFeatureMessage(name string) string {
+	if len(LanguageFeatures) == 0 {
+		return "No experimental feature named `" + name + "`, there are no experimental features"
+	}
+	return "No experimental feature named `" + name + "`, expected one of: " + strings.Join(LanguageFeatureNames(), ", ")
+}
+
+// FeatureDisabledMessage 使用了没有启用的特性feature时的错误信息，what是用到的语法
+func FeatureDisabledMessage(what, feature string) string {
+	return what + " is an experimental feature, enable it with `--enable-feature=" + feature +
+		"` or with `#feature(\"" + feature + "\")` in this file"
+}
@@ -2,7 +2,6 @@ package ast
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 
 	"github.com/ku-lang/ku/lexer"
@@ -57,6 +56,9 @@ const (
 	ConstructorStructMember
 	ConstructorDeref
 	ConstructorArrayIndex
+	ConstructorMethodCallee // 作为调用的函数的成员访问，方法的类型包括接收者
+	ConstructorPointerArith // 加减法的结果，左操作数是指针时与数值运算不同，参见 pointerArithType
+	ConstructorArithOperand // 加减法右边的数字常量：左操作数是指针时是int，否则与左操作数相同
 )
 
 func (v *ConstructorType) Equals(other Type) bool {
@@ -102,6 +104,9 @@ func (v *ConstructorType) ActualType() Type {
 // It consists of two "sides", each representing a type or a type variable.
 type Constraint struct {
 	Left, Right Side
+
+	origin *TypeOrigin // 产生条件的表达式或语句，参见 explain.go
+	root   *Constraint       // 求解时派生出这个条件的原始条件
 }
 
 func ConstraintFromTypes(left, right *TypeReference) *Constraint {
@@ -115,14 +120,6 @@ func (v *Constraint) String() string {
 	return fmt.Sprintf("%s = %s", v.Left, v.Right)
 }
 
-func (v *Constraint) Subs(id int, side Side) *Constraint {
-	res := &Constraint{
-		Left:  v.Left.Subs(id, side),
-		Right: v.Right.Subs(id, side),
-	}
-	return res
-}
-
 // Side的种类，分别是：1. 类型变量（IdentSide），2. 具体类型 （TypeSide）
 type SideType int
 
@@ -138,6 +135,8 @@ type Side struct {
 	SideType SideType       // Side的类型
 	Id       int            // 如果是类型变量，则使用Id存放变量的Id
 	Type     *TypeReference // 如果是具体类型，则使用Type指向其类型
+
+	origin *TypeOrigin // 求解时，要求这个类型的表达式或语句，用于报告类型不匹配
 }
 
 // SideFromType 用指定类型t创建一个Side对象
@@ -172,7 +171,11 @@ func (v Side) Subs(id int, what Side) Side {
 			// 注：为什么用这样的TypeReference，而不是 TypeRefernce{BaseType: what}？
 			nt = SubsType(v.Type, id, &TypeReference{BaseType: TypeVariable{Id: what.Id}})
 		}
-		return Side{SideType: TypeSide, Type: nt}
+		origin := v.origin
+		if origin == nil {
+			origin = what.origin
+		}
+		return Side{SideType: TypeSide, Type: nt, origin: origin}
 
 	default:
 		panic("Invalid SideType")
@@ -203,12 +206,21 @@ func SubsType(typ *TypeReference, id int, what *TypeReference) *TypeReference {
 		// If we have a struct member, we check whether we can resolve the
 		// actual type of the member with the information we have at the
 		// current point. If we do, we return the actual type.
-		case ConstructorStructMember:
+		case ConstructorStructMember, ConstructorMethodCallee:
 			// Method check
-			fn := GetMethod(nargs[0].BaseType, t.Data.(string))
+			fn := receiverMethod(nargs[0], t.Data.(string))
 			if fn != nil {
+				// 不是调用的方法访问是方法值
+				if t.Id == ConstructorStructMember {
+					return methodValueType(nargs[0], fn, typ.GenericArguments)
+				}
+				// 接口的函数没有接收者，通过约束或者接口值调用时，访问的对象就是接收者
+				ft := fn.Type
+				if ft.Receiver == nil {
+					ft.Receiver = nargs[0]
+				}
 				return &TypeReference{
-					BaseType:         fn.Type,
+					BaseType:         ft,
 					GenericArguments: typ.GenericArguments,
 				}
 			}
@@ -263,6 +275,19 @@ func SubsType(typ *TypeReference, id int, what *TypeReference) *TypeReference {
 				}
 				return mt
 			}
+
+		case ConstructorPointerArith:
+			if res, ok := pointerArithType(nargs[0], nargs[1]); ok {
+				return res
+			}
+
+		case ConstructorArithOperand:
+			if isInferredType(nargs[0]) {
+				if _, ok := nargs[0].BaseType.ActualType().(PointerType); ok {
+					return &TypeReference{BaseType: PRIMITIVE_int}
+				}
+				return nargs[0]
+			}
 		}
 
 		return &TypeReference{
@@ -281,12 +306,20 @@ func SubsType(typ *TypeReference, id int, what *TypeReference) *TypeReference {
 			np[idx] = SubsType(param, id, what)
 		}
 
+		// Descend into receiver type
+		var newRec *TypeReference
+		if t.Receiver != nil {
+			newRec = SubsType(t.Receiver, id, what)
+		}
+
 		return &TypeReference{
 			BaseType: FunctionType{
-				attrs:      t.attrs,
-				IsVariadic: t.IsVariadic,
-				Parameters: np,
-				Return:     newRet,
+				attrs:             t.attrs,
+				IsVariadic:        t.IsVariadic,
+				Parameters:        np,
+				Return:            newRet,
+				Receiver:          newRec,
+				GenericParameters: t.GenericParameters,
 			},
 			GenericArguments: typ.GenericArguments,
 		}
@@ -322,10 +355,22 @@ func SubsType(typ *TypeReference, id int, what *TypeReference) *TypeReference {
 			GenericArguments: typ.GenericArguments,
 		}
 
-	// The following are noops at the current time. For NamedType and EnumType
-	// this is only temporary, until we finalize implementaiton of generics
-	// in a solid maintainable way.
-	case PrimitiveType, StructType, *NamedType, InterfaceType, EnumType, *SubstitutionType:
+	// 泛型的命名类型：替换所有的泛型参数，如字面量 Pair{a: 1, b: 2} 的类型 Pair<$1>
+	case *NamedType:
+		if len(typ.GenericArguments) == 0 {
+			return typ
+		}
+
+		nargs := make([]*TypeReference, len(typ.GenericArguments))
+		for idx, arg := range typ.GenericArguments {
+			nargs[idx] = SubsType(arg, id, what)
+		}
+		return &TypeReference{BaseType: t, GenericArguments: nargs}
+
+	// The following are noops at the current time. For EnumType this is only
+	// temporary, until we finalize implementaiton of generics in a solid
+	// maintainable way.
+	case PrimitiveType, StructType, InterfaceType, EnumType, *SubstitutionType:
 		return typ
 
 	default:
@@ -333,8 +378,44 @@ func SubsType(typ *TypeReference, id int, what *TypeReference) *TypeReference {
 	}
 }
 
+// methodKey 方法查找表的键：去掉指针和引用之后的命名类型或替换类型，以及方法名
+type methodKey struct {
+	typ  Type
+	name string
+}
+
+// methodCache 方法查找表，保存GetMethod的结果（包括没有找到的nil）。类型的方法在构造阶段添加，
+// 添加方法时以及推导每个子模块之前清空
+var methodCache = make(map[methodKey]*Function)
+
+func invalidateMethodCache() {
+	if len(methodCache) > 0 {
+		methodCache = make(map[methodKey]*Function)
+	}
+}
+
 func GetMethod(typ Type, name string) *Function {
-	typNp := TypeWithoutPointers(typ)
+	typNp := typeWithoutIndirection(typ)
+
+	// 匿名的接口类型不能作为键，不缓存
+	var key methodKey
+	switch typNp.(type) {
+	case *NamedType, *SubstitutionType:
+		key = methodKey{typ: typNp, name: name}
+		if fn, ok := methodCache[key]; ok {
+			return fn
+		}
+	}
+
+	fn := lookupMethod(typNp, name)
+	if key.typ != nil {
+		methodCache[key] = fn
+	}
+	return fn
+}
+
+// lookupMethod 在命名类型的方法、接口的函数或者替换类型的约束中查找方法
+func lookupMethod(typNp Type, name string) *Function {
 	if it, ok := typNp.ActualType().(InterfaceType); ok {
 		typNp = it
 	}
@@ -361,6 +442,101 @@ func GetMethod(typ Type, name string) *Function {
 	return fn
 }
 
+// receiverMethod 查找接收者的方法。通过约束或者接口值访问泛型接口的方法时，
+// 返回的方法的类型中已经代入了接口的泛型实参
+func receiverMethod(receiver *TypeReference, name string) *Function {
+	fn := GetMethod(receiver.BaseType, name)
+	if fn == nil {
+		return nil
+	}
+	if gcon := interfaceGenericContext(receiver, fn); gcon != nil {
+		ifn := *fn
+		ifn.Type = gcon.Replace(&TypeReference{BaseType: fn.Type}).BaseType.(FunctionType)
+		return &ifn
+	}
+	return fn
+}
+
+// constraintOperatorMethods 实现运算符的约束方法。比较运算符调用 cmp(o) int，结果与0比较；
+// == 和 != 优先调用 eq(o) bool
+var constraintOperatorMethods = map[parser.BinOpType]string{
+	parser.BINOP_ADD:        "add",
+	parser.BINOP_SUB:        "sub",
+	parser.BINOP_MUL:        "mul",
+	parser.BINOP_DIV:        "div",
+	parser.BINOP_MOD:        "rem",
+	parser.BINOP_GREATER:    "cmp",
+	parser.BINOP_LESS:       "cmp",
+	parser.BINOP_GREATER_EQ: "cmp",
+	parser.BINOP_LESS_EQ:    "cmp",
+	parser.BINOP_EQ:         "cmp",
+	parser.BINOP_NOT_EQ:     "cmp",
+}
+
+// constraintOperator 操作数的类型为带约束的泛型参数时，实现运算符op的约束方法（已代入接口的泛型实参）。
+// 没有对应的方法时返回nil
+func constraintOperator(typ *TypeReference, op parser.BinOpType) *Function {
+	if typ == nil {
+		return nil
+	}
+	if sub, ok := typ.BaseType.(*SubstitutionType); !ok || len(sub.Constraints) == 0 {
+		return nil
+	}
+	if op == parser.BINOP_EQ || op == parser.BINOP_NOT_EQ {
+		if fn := receiverMethod(typ, "eq"); fn != nil {
+			return fn
+		}
+	}
+	name, ok := constraintOperatorMethods[op]
+	if !ok {
+		return nil
+	}
+	return receiverMethod(typ, name)
+}
+
+// newOperatorCall 由约束方法fn实现的运算 a op b，生成调用 a.fn(b)
+func (v *Inferrer) newOperatorCall(n *BinaryExpr, fn *Function) *CallExpr {
+	var receiver AccessExpr
+	if access, ok := n.Lhand.(AccessExpr); ok {
+		receiver = access
+	} else {
+		temp := &TempAccessExpr{Expr: n.Lhand}
+		temp.SetPos(n.Lhand.Pos())
+		receiver = temp
+	}
+
+	sae := &StructAccessExpr{Struct: receiver, Member: fn.Name}
+	if len(v.Functions) > 0 {
+		sae.ParentFunction = v.Function()
+	}
+	sae.SetPos(n.Pos())
+	call := &CallExpr{
+		Function:       sae,
+		Arguments:      []Expr{n.Rhand},
+		ReceiverAccess: receiver,
+	}
+	call.SetPos(n.Pos())
+	return call
+}
+
+// typeWithoutIndirection 去掉指针和引用，方法可以通过它们调用
+func typeWithoutIndirection(t Type) Type {
+	return typeReferenceWithoutIndirection(&TypeReference{BaseType: t}).BaseType
+}
+
+func typeReferenceWithoutIndirection(t *TypeReference) *TypeReference {
+	for {
+		switch it := t.BaseType.(type) {
+		case PointerType:
+			t = it.Addressee
+		case ReferenceType:
+			t = it.Referrer
+		default:
+			return t
+		}
+	}
+}
+
 func (v Side) String() string {
 	switch v.SideType {
 	case IdentSide:
@@ -385,19 +561,30 @@ type Inferrer struct {
 	SimpleConstraints []*Constraint
 	Constraints       []*Constraint
 	IdCount           int
+
+	overloads []*overloadedAccess // 推迟到求解之后选定的重载，参见 overload.go
+	declared  map[*Variable]bool  // 声明时给出了类型的变量，推导之后保留声明的类型
+
+	// 用于解释推导结果，参见 explain.go
+	origin    *TypeOrigin // 当前添加的条件的来源
+	conflicts []*Constraint     // 求解时不能统一的条件
+	solution  []*Constraint     // 求解的结果，按类型变量的Id存放
 }
 
 func (v *Inferrer) err(msg string, args ...interface{}) {
-	log.Errorln("inferrer", "%s %s", util.Red("error:"), fmt.Sprintf(msg, args...))
-	os.Exit(util.EXIT_FAILURE_SEMANTIC)
+	log.Errorln(log.TagInferrer, "%s %s", util.Red("error:"), fmt.Sprintf(msg, args...))
+	util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
 }
 
 func (v *Inferrer) errPos(pos lexer.Position, msg string, args ...interface{}) {
-	log.Errorln("inferrer", "%s: [%s:%d:%d] %s", util.Bold(util.Red("error")),
+	log.Errorln(log.TagInferrer, "%s: [%s:%d:%d] %s", util.Bold(util.Red("error")),
 		pos.Filename, pos.Line, pos.Char,
 		fmt.Sprintf(msg, args...))
-	log.Errorln("inferrer", "%s", v.Submodule.File.MarkPos(pos))
-	os.Exit(util.EXIT_FAILURE_SEMANTIC)
+	log.Errorln(log.TagInferrer, "%s", v.Submodule.File.MarkPos(pos))
+	if ExplainTypes.OnError {
+		log.Errorln(log.TagInferrer, "%s", v.explainPos(pos))
+	}
+	util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
 }
 
 func (v *Inferrer) Function() *Function {
@@ -419,11 +606,14 @@ func Infer(submod *Submodule) {
 	}
 
 	log.Timed("inferring submodule", submod.File.Name, func() {
+		invalidateMethodCache()
+
 		// 推导本模块的所有AST节点
 		inf := &Inferrer{
 			Submodule:   submod,
 			Typeds:      make(map[int]*AnnotatedTyped),
 			TypedLookup: make(map[Typed]*AnnotatedTyped),
+			declared:    make(map[*Variable]bool),
 		}
 		// 利用visit模式遍历AST树
 		vis := NewASTVisitor(inf)
@@ -435,6 +625,7 @@ func Infer(submod *Submodule) {
 }
 
 func (v *Inferrer) AddConstraint(c *Constraint) {
+	c.origin = v.origin
 	v.Constraints = append(v.Constraints, c)
 }
 
@@ -450,10 +641,11 @@ func (v *Inferrer) AddEqualsConstraint(a, b int) {
 
 // AddIsConstraint creates a constraing that indicates that the given id is of
 // the given type and add it to the list of constraints.
+// A type which is just a type variable gives an equality constraint.
 func (v *Inferrer) AddIsConstraint(id int, typref *TypeReference) {
 	c := &Constraint{
 		Left:  Side{Id: id, SideType: IdentSide},
-		Right: Side{Type: typref, SideType: TypeSide},
+		Right: SideFromType(typref),
 	}
 	v.AddConstraint(c)
 }
@@ -462,8 +654,9 @@ func (v *Inferrer) AddIsConstraint(id int, typref *TypeReference) {
 // the type given is guaranteed not to contain a type variable.
 func (v *Inferrer) AddSimpleIsConstraint(id int, typref *TypeReference) {
 	c := &Constraint{
-		Left:  Side{Id: id, SideType: IdentSide},
-		Right: Side{Type: typref, SideType: TypeSide},
+		Left:   Side{Id: id, SideType: IdentSide},
+		Right:  Side{Type: typref, SideType: TypeSide},
+		origin: v.origin,
 	}
 	v.SimpleConstraints = append(v.SimpleConstraints, c)
 }
@@ -473,12 +666,19 @@ func (v *Inferrer) EnterScope() {}
 func (v *Inferrer) ExitScope() {}
 
 func (v *Inferrer) PostVisit(node *Node) {
-	switch (*node).(type) {
+	switch n := (*node).(type) {
 	case *FunctionDecl, *LambdaExpr:
 		idx := len(v.Functions) - 1
 		v.Functions[idx] = nil
 		v.Functions = v.Functions[:idx]
 		return
+
+	// 分支的值在处理完分支之后才加入约束，这时匹配模式中的变量已经有了类型
+	case *CondExpr:
+		id := v.HandleExpr(n)
+		for _, value := range n.Values() {
+			v.AddEqualsConstraint(id, v.HandleExpr(value))
+		}
 	}
 }
 
@@ -490,16 +690,23 @@ func (v *Inferrer) Visit(node *Node) bool {
 		return true
 
 	case *LambdaExpr:
+		// 通常在处理所在的表达式时已经处理过了，这里保证在推导函数体之前确定参数和返回类型
+		v.HandleExpr(n)
 		v.Functions = append(v.Functions, n.Function)
 		return true
 	}
 
+	v.origin = &TypeOrigin{Pos: (*node).Pos(), What: (*node).NodeName()}
+
 	// Switch on the type of a node. If it is a variable declaration, or a
 	// statement that contains an expression it should be in here.
 	switch n := (*node).(type) {
 	case *VariableDecl:
 		if n.Assignment != nil {
+			// 没有给出类型的变量由只含数字常量的表达式初始化时，取常量的默认类型，不由之后的使用决定
+			untyped := n.Variable.Type == nil && isUntypedNumeric(n.Assignment)
 			if n.Variable.Type != nil { // 如果变量指定了类型，则赋值语句的类型应当设为这个类型
+				v.declared[n.Variable] = true
 				n.Assignment.SetType(n.Variable.Type)
 			} else if n.Assignment.GetType() != nil { // 如果变量未指定类型，而赋值语句可以获得类型，则将变量设置为该类型
 				if _, isSubst := n.Assignment.GetType().BaseType.(*SubstitutionType); !isSubst {
@@ -508,6 +715,10 @@ func (v *Inferrer) Visit(node *Node) bool {
 			}
 			// 处理赋值语句内部，获得其TypeVariable的ID
 			aid := v.HandleExpr(n.Assignment)
+			if untyped {
+				n.Variable.NumericDefault = true
+				v.AddSimpleIsConstraint(aid, untypedNumericDefault(n.Assignment))
+			}
 			// 处理变量，获得它的TypeVariable的ID
 			vid := v.HandleTyped(n.Pos(), n.Variable)
 			// 这两个类型变量应当满足相等条件
@@ -615,6 +826,15 @@ func (v *Inferrer) Visit(node *Node) bool {
 	case *DeferStat: // 同上
 		v.HandleExpr(n.Call)
 
+	case *StaticAssertStat: // 编译期断言，条件应当是bool型
+		id := v.HandleExpr(n.Cond)
+		v.AddSimpleIsConstraint(id, &TypeReference{BaseType: PRIMITIVE_bool})
+
+	case *VolatileStoreStat: // volatile写，写入的值的类型应当是指针指向的类型
+		ptr := v.HandleExpr(n.Pointer)
+		val := v.HandleExpr(n.Value)
+		v.addDerefConstraint(val, n.Pointer, ptr)
+
 	case *IfStat: // 对于if语句，递归处理其表达式，并且添加类型条件：其表达式的返回值类型应当是一个bool型
 		for _, expr := range n.Exprs {
 			id := v.HandleExpr(expr)
@@ -624,7 +844,17 @@ func (v *Inferrer) Visit(node *Node) bool {
 	case *ReturnStat: // 返回语句，处理其返回值表达式，并且它的类型应当与函数的返回值类型相同
 		if n.Value != nil {
 			id := v.HandleExpr(n.Value)
-			v.AddSimpleIsConstraint(id, v.Function().Type.Return)
+			// lambda省略的返回类型是一个类型变量，由返回值推导得到。
+			// 无类型的数值字面量取默认类型
+			if ret := v.Function().Type.Return; containsTypeVariable(ret) {
+				if lit, ok := n.Value.(*NumericLiteral); ok && lit.Type == nil {
+					lit.SetType(nil)
+					v.AddIsConstraint(id, lit.Type)
+				}
+				v.AddIsConstraint(id, ret)
+			} else {
+				v.AddSimpleIsConstraint(id, ret)
+			}
 		}
 
 	case *LoopStat: //  循环语句，处理其循环条件表达式，且表达式返回值应当是bool类型
@@ -675,6 +905,10 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	v.TypedLookup[typed] = ann
 	v.IdCount++
 
+	// 这个表达式添加的条件以它为来源
+	defer func(origin *TypeOrigin) { v.origin = origin }(v.origin)
+	v.origin = typedOrigin(ann)
+
 	// 根据表达式的具体类型分别处理
 	// Switch on the type of the typed. If it is a `Variable`, any expression,
 	// or a literal of some sort, it should be handled here.
@@ -682,29 +916,59 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	case *BinaryExpr: // 二元操作表达式，应当分别处理表达式双方分支，并根据具体操作符类型添加条件
 		a := v.HandleExpr(typed.Lhand)
 		b := v.HandleExpr(typed.Rhand)
+		// 只由数字常量组成的操作数的类型由上下文决定，不使用常量的默认类型，参见 isUntypedNumeric
+		ltype, rtype := typed.Lhand.GetType(), typed.Rhand.GetType()
+		if isUntypedNumeric(typed.Lhand) {
+			ltype = nil
+		}
+		if isUntypedNumeric(typed.Rhand) {
+			rtype = nil
+		}
+
+		// 泛型参数的运算符，转换为对约束中方法的调用。两边的类型相同，左操作数的类型未知时（如推导类型的变量）看右操作数
+		opType := ltype
+		if opType == nil {
+			opType = rtype
+		}
+		if fn := constraintOperator(opType, typed.Op); fn != nil {
+			typed.Method = v.newOperatorCall(typed, fn)
+			res := v.HandleExpr(typed.Method)
+			if typed.Op.Category() == parser.OP_COMPARISON {
+				v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_bool})
+			} else {
+				// 结果的类型由方法声明，先记下来，链式的运算（如 a + b + c）可以继续使用约束中的方法
+				typed.Type = fn.Type.Return
+				v.AddSimpleIsConstraint(ann.Id, typed.Type)
+				v.AddEqualsConstraint(ann.Id, res)
+			}
+			break
+		}
+
 		switch typed.Op.Category() {
 
 		// 如果是比较型的操作符，则表达式两边的类型应当相同（EqualConstraint），且表达式的最终结果应当是bool类型
 		case parser.OP_COMPARISON:
-			if typed.Lhand.GetType() == nil || typed.Rhand.GetType() == nil {
+			if ltype == nil || rtype == nil {
 				v.AddEqualsConstraint(a, b)
 			}
 			v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_bool})
 
 		// 如果是比特操作符，与前面相似，双方应当是相同类型，且与结果类型也相同
 		case parser.OP_BITWISE:
-			if typed.Lhand.GetType() != nil && typed.Rhand.GetType() != nil {
-				v.AddSimpleIsConstraint(ann.Id, typed.Lhand.GetType())
+			if ltype != nil && rtype != nil {
+				v.AddSimpleIsConstraint(ann.Id, ltype)
 			} else {
 				v.AddEqualsConstraint(a, b)
 				v.AddEqualsConstraint(ann.Id, a)
 			}
 
-		// 数值操作符，与上面类似
+		// 数值操作符，与上面类似。加减法的左操作数可能是指针，参见 handleAdditive
 		// TODO: These assumptions don't hold once we add operator overloading
 		case parser.OP_ARITHMETIC:
-			if typed.Lhand.GetType() != nil && typed.Rhand.GetType() != nil {
-				v.AddSimpleIsConstraint(ann.Id, typed.Lhand.GetType())
+			if typed.Op == parser.BINOP_ADD || typed.Op == parser.BINOP_SUB {
+				v.handleAdditive(typed, ann.Id, a, b, ltype, rtype)
+			} else if ltype != nil && rtype != nil {
+				v.AddSimpleIsConstraint(ann.Id, ltype)
 			} else {
 				v.AddEqualsConstraint(a, b)
 				v.AddEqualsConstraint(ann.Id, a)
@@ -720,6 +984,39 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 			panic("Unhandled binary operator in type inference")
 		}
 
+	case *FloatBuiltinExpr: // 浮点数内建函数
+		ids := make([]int, len(typed.Arguments))
+		for idx, arg := range typed.Arguments {
+			ids[idx] = v.HandleExpr(arg)
+		}
+
+		switch typed.Builtin {
+		case parser.FLOAT_BUILTIN_IS_NAN, parser.FLOAT_BUILTIN_IS_INF:
+			v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_bool})
+
+		// fma的三个参数与结果类型都相同
+		case parser.FLOAT_BUILTIN_FMA:
+			for _, id := range ids[1:] {
+				v.AddEqualsConstraint(ids[0], id)
+			}
+			v.AddEqualsConstraint(ann.Id, ids[0])
+		}
+
+	case *OverflowArithExpr: // 溢出控制的整数运算，双方类型相同
+		a := v.HandleExpr(typed.Lhand)
+		b := v.HandleExpr(typed.Rhand)
+		v.AddEqualsConstraint(a, b)
+
+		// checked 运算返回 (结果, 是否溢出)，其余运算的结果与操作数类型相同
+		if typed.Mode == parser.OVERFLOW_CHECKED {
+			v.AddIsConstraint(ann.Id, &TypeReference{BaseType: tupleOf(
+				&TypeReference{BaseType: TypeVariable{Id: a}},
+				&TypeReference{BaseType: PRIMITIVE_bool},
+			)})
+		} else {
+			v.AddEqualsConstraint(ann.Id, a)
+		}
+
 	case *UnaryExpr: // 一元操作表达式
 		// 先处理其单边表达式
 		id := v.HandleExpr(typed.Expr)
@@ -744,8 +1041,15 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 		}
 
 	case *CallExpr: // 函数调用表达式
-		log.Debugln("inference", "[Handling CallEXpr typed: %s", typed.String())
-		// 先处理它的函数表达式
+		log.Debugln(log.TagInference, "[Handling CallEXpr typed: %s", typed.String())
+		// 先处理它的函数表达式。调用方法时接收者作为参数传递，方法访问的类型包括接收者
+		if sae, ok := typed.Function.(*StructAccessExpr); ok && typed.ReceiverAccess != nil {
+			sae.Callee = true
+		}
+		// 调用重载的函数时先由实参选择重载，参见 overload.go
+		if fae, ok := typed.Function.(*FunctionAccessExpr); ok && fae.Overloads != nil {
+			v.chooseOverloadForCall(typed, fae)
+		}
 		fnId := v.HandleExpr(typed.Function)
 		// 如果函数声明了类型
 		if typed.Function.GetType() != nil {
@@ -760,8 +1064,16 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 
 				// 如果没有泛型参数
 				if len(ft.GenericParameters) == 0 {
+					// 接收者可能是方法调用的结果（链式调用），同样需要推导
+					if typed.ReceiverAccess != nil {
+						v.HandleExpr(typed.ReceiverAccess)
+					}
 					// 遍历处理所有实参表达式
 					for idx, arg := range typed.Arguments {
+						// lambda实参省略的参数类型和返回类型由形参的类型得到，必须在处理lambda之前设置
+						if lambda, ok := arg.(*LambdaExpr); ok && idx < len(ft.Parameters) {
+							lambda.SetType(ft.Parameters[idx])
+						}
 						id := v.HandleExpr(arg)
 						if idx >= len(ft.Parameters) {
 							continue
@@ -785,12 +1097,25 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 			recieverId = v.HandleExpr(typed.ReceiverAccess)
 		}
 
-		log.Debugln("inference", "receiverid: %v, fnId: %v", recieverId, fnId)
+		log.Debugln(log.TagInference, "receiverid: %v, fnId: %v", recieverId, fnId)
 
-		// 分别处理每个实参
+		// 分别处理每个实参。lambda实参放到最后处理：先由接收对象和其它实参确定泛型参数，
+		// 才能得到lambda省略的参数类型
 		argIds := make([]int, len(typed.Arguments))
 		for idx, arg := range typed.Arguments {
-			argIds[idx] = v.HandleExpr(arg)
+			if _, ok := arg.(*LambdaExpr); !ok {
+				argIds[idx] = v.HandleExpr(arg)
+			}
+		}
+		for idx, arg := range typed.Arguments {
+			if lambda, ok := arg.(*LambdaExpr); ok {
+				if typed.Function.GetType() != nil {
+					if ft, ok := typed.Function.GetType().BaseType.ActualType().(FunctionType); ok {
+						lambda.SetType(lambdaArgumentType(typed, ft, idx))
+					}
+				}
+				argIds[idx] = v.HandleExpr(arg)
+			}
 		}
 
 		// 根据前面得到的类型变量ID，包括调用表达式ann.Id、各个实参的类型Id，构造出一个函数类型声明，用于后面的推导
@@ -805,7 +1130,7 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 		}
 		// 函数表达式的类型（对应fnId），应当与根据参数列表与调用表达式构造的函数声明一致。
 		if rightT, ok := fnType.ActualType().(FunctionType); ok {
-			log.Debugln("inference", "adding Constraint fro funID:%d, left: %#v, right: %#v", fnId, fnId, rightT)
+			log.Debugln(log.TagInference, "adding Constraint fro funID:%d, left: %#v, right: %#v", fnId, fnId, rightT)
 		}
 		v.AddIsConstraint(fnId, &TypeReference{BaseType: fnType})
 
@@ -814,6 +1139,11 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 		v.HandleExpr(typed.Expr)
 		v.AddSimpleIsConstraint(ann.Id, typed.Type)
 
+	// 按位重新解释的值的类型与目标类型无关，由值本身决定
+	case *BitcastExpr:
+		v.HandleExpr(typed.Expr)
+		v.AddSimpleIsConstraint(ann.Id, typed.Type)
+
 	// Given an reference-to expr or a pointer-to expr, we know that the result
 	// will be a pointer to the type of the access of which we took the address
 	case *ReferenceToExpr:
@@ -834,29 +1164,56 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	// while maintaining the mutablility stuff is a pain.
 	case *DerefAccessExpr:
 		id := v.HandleExpr(typed.Expr)
-		if typed.Expr.GetType() != nil {
-			addressee := getAdressee(typed.Expr.GetType().BaseType.ActualType())
-			if addressee != nil {
-				v.AddSimpleIsConstraint(ann.Id, addressee)
-				break
-			}
+		v.addDerefConstraint(ann.Id, typed.Expr, id)
+
+	// volatile读的类型与解引用相同
+	case *VolatileLoadExpr:
+		id := v.HandleExpr(typed.Pointer)
+		v.addDerefConstraint(ann.Id, typed.Pointer, id)
+
+	// 临时值的类型就是值的类型
+	case *TempAccessExpr:
+		id := v.HandleExpr(typed.Expr)
+		v.AddEqualsConstraint(ann.Id, id)
+
+	// new得到指向值的可变指针
+	case *NewExpr:
+		id := v.HandleExpr(typed.Expr)
+		v.AddIsConstraint(ann.Id, &TypeReference{BaseType: PointerTo(&TypeReference{BaseType: TypeVariable{Id: id}}, true)})
+
+	// 转换得到的C字符串总是 ^u8
+	case *CStringExpr:
+		v.HandleExpr(typed.Expr)
+		v.AddSimpleIsConstraint(ann.Id, typed.GetType())
+
+	// 哈希值总是 u64
+	case *HashExpr:
+		v.HandleExpr(typed.Expr)
+		v.AddSimpleIsConstraint(ann.Id, typed.GetType())
+
+	// 作为表达式的if和match的类型与各个分支的值相同（在PostVisit中加入约束），
+	// 由上下文给出类型时（如变量声明的类型）也与它相同
+	case *CondExpr:
+		if typed.Type != nil {
+			v.AddIsConstraint(ann.Id, typed.Type)
 		}
-		v.AddIsConstraint(ann.Id, &TypeReference{
-			BaseType: &ConstructorType{
-				Id: ConstructorDeref,
-				Args: []*TypeReference{
-					&TypeReference{BaseType: TypeVariable{Id: id}},
-				},
-			},
-		})
 
-	// A sizeof expr always return a uint
+	// sizeof, alignof and offsetof exprs always return a uint
 	case *SizeofExpr:
 		if typed.Expr != nil {
 			v.HandleExpr(typed.Expr)
 		}
 		v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_uint})
 
+	case *AlignofExpr:
+		if typed.Expr != nil {
+			v.HandleExpr(typed.Expr)
+		}
+		v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_uint})
+
+	case *OffsetofExpr:
+		v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: PRIMITIVE_uint})
+
 	// Given a variable access, we know that the type of the access must be
 	// equal to the type of the variable being accessed.
 	case *VariableAccessExpr:
@@ -872,12 +1229,23 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	// without a bit of jerry-rigging.
 	case *StructAccessExpr:
 		id := v.HandleExpr(typed.Struct)
+		if typed.Callee {
+			v.AddIsConstraint(ann.Id, &TypeReference{
+				BaseType: &ConstructorType{
+					Id:   ConstructorMethodCallee,
+					Args: []*TypeReference{&TypeReference{BaseType: TypeVariable{Id: id}}},
+					Data: typed.Member,
+				},
+			})
+			break
+		}
 		v.AddIsConstraint(ann.Id, &TypeReference{
 			BaseType: &ConstructorType{
 				Id:   ConstructorStructMember,
 				Args: []*TypeReference{&TypeReference{BaseType: TypeVariable{Id: id}}},
 				Data: typed.Member,
 			},
+			GenericArguments: typed.GenericArguments,
 		})
 
 	// Given an array access, we know that the type of the expression being
@@ -888,7 +1256,7 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 		if typed.Array.GetType() != nil {
 			at, ok := typed.Array.GetType().BaseType.ActualType().(ArrayType)
 			if ok {
-				v.AddSimpleIsConstraint(id, at.MemberType)
+				v.AddSimpleIsConstraint(ann.Id, at.MemberType)
 				break
 			}
 		}
@@ -901,6 +1269,17 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 			},
 		})
 
+	// 切片与被切片的数组类型相同
+	case *SliceExpr:
+		id := v.HandleExpr(typed.Array)
+		if typed.Low != nil {
+			v.HandleExpr(typed.Low)
+		}
+		if typed.High != nil {
+			v.HandleExpr(typed.High)
+		}
+		v.AddIsConstraint(ann.Id, &TypeReference{BaseType: TypeVariable{Id: id}})
+
 	// An array length expression is always of type uint
 	case *ArrayLenExpr:
 		v.HandleExpr(typed.Expr)
@@ -936,23 +1315,50 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	// a struct, but in either case we go through and generate the type
 	// variables for the contained expression, and if we know the type of the
 	// literal we bind the generated type variables to their respective types.
+	//
+	// If the literal is of a generic struct type without generic arguments,
+	// like `Pair{a: 1, b: 2}`, each generic parameter gets a type variable,
+	// which is inferred from the context and the member values.
+	//
+	// The rows of a multi-dimensional array literal may leave out their type,
+	// like `[2][3]int{{1, 2, 3}, {4, 5, 6}}`, and get the member type.
 	case *CompositeLiteral:
 		if typed.Type != nil {
-			typ := typed.Type.BaseType.ActualType()
-			if at, ok := typ.(ArrayType); ok {
+			typ, inferArgs := v.compositeLiteralType(typed)
+			addConstraint := v.AddSimpleIsConstraint
+			if inferArgs {
+				addConstraint = v.AddIsConstraint
+			}
+
+			var gcon *GenericContext
+			if len(typ.GenericArguments) > 0 {
+				gcon = NewGenericContextFromTypeReference(typ)
+			}
+
+			if at, ok := typ.BaseType.ActualType().(ArrayType); ok {
 				for _, val := range typed.Values {
+					if row, ok := val.(*CompositeLiteral); ok && row.Type == nil {
+						row.SetType(at.MemberType)
+					}
 					id := v.HandleExpr(val)
-					v.AddSimpleIsConstraint(id, at.MemberType)
+					addConstraint(id, at.MemberType)
 				}
-			} else if st, ok := typ.(StructType); ok {
+			} else if st, ok := typ.BaseType.ActualType().(StructType); ok {
 				for idx, val := range typed.Values {
-					field := typed.Fields[idx]
-					mem := st.GetMember(field)
 					id := v.HandleExpr(val)
-					v.AddSimpleIsConstraint(id, mem.Type)
+					mem := st.GetMember(typed.Fields[idx])
+					if mem == nil {
+						// Reported by the semantic type check
+						continue
+					}
+					if gcon != nil {
+						addConstraint(id, gcon.Replace(mem.Type))
+					} else {
+						addConstraint(id, mem.Type)
+					}
 				}
 			}
-			v.AddSimpleIsConstraint(ann.Id, typed.Type)
+			addConstraint(ann.Id, typ)
 		}
 
 	// Given a tuple literal we handle each member, and if we know the type of
@@ -988,23 +1394,44 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 
 	// A function access will always be the type of the function it accesses
 	case *FunctionAccessExpr:
-		fnType := &TypeReference{BaseType: typed.Function.Type}
-
-		if len(typed.Function.Type.GenericParameters) > 0 {
-			if len(typed.GenericArguments) > 0 {
-				gcon := NewGenericContext(getTypeGenericParameters(fnType.BaseType), typed.GenericArguments)
-				fnType = gcon.Replace(fnType)
-				v.AddSimpleIsConstraint(ann.Id, fnType)
+		// 重载的函数在选定之前不约束类型，调用的重载在处理调用时已经记录
+		if typed.Overloads != nil {
+			if !v.isPendingOverload(typed) {
+				v.overloads = append(v.overloads, &overloadedAccess{access: typed})
 			}
-		} else {
-			v.AddSimpleIsConstraint(ann.Id, fnType)
+			break
 		}
+		v.functionAccessConstraint(ann.Id, typed)
 
-	// A lambda expr will always be the type of the function it is
+	// A lambda expr will always be the type of the function it is. Types left
+	// out in the lambda have already been set from the context, see
+	// LambdaExpr.SetType. A return type not decided by the context is inferred
+	// from the returned expression.
 	case *LambdaExpr:
-		v.AddSimpleIsConstraint(ann.Id, &TypeReference{BaseType: typed.Function.Type})
+		fn := typed.Function
+		for _, par := range fn.Parameters {
+			if par.Variable.Type == nil {
+				v.errPos(par.Pos(), "Couldn't infer type of lambda parameter `%s`, annotate its type", par.Variable.Name)
+			}
+		}
+
+		if fn.Type.Return == nil {
+			if returnsValue(fn) {
+				id := v.HandleTyped(typed.Pos(), &lambdaReturn{Function: fn})
+				fn.Type.Return = &TypeReference{BaseType: TypeVariable{Id: id}}
+				v.AddIsConstraint(ann.Id, typed.GetType())
+				break
+			}
+			fn.Type.Return = &TypeReference{BaseType: PRIMITIVE_void}
+		}
+		v.AddSimpleIsConstraint(ann.Id, typed.GetType())
 
-	case *NumericLiteral, *StringLiteral, *DiscardAccessExpr, *EnumPatternExpr:
+	case *NumericLiteral:
+		if typed.IsDuration {
+			v.AddSimpleIsConstraint(ann.Id, DurationType())
+		}
+
+	case *StringLiteral, *DiscardAccessExpr, *EnumPatternExpr, *genericArgument, *lambdaReturn:
 		// noop
 
 	default:
@@ -1014,73 +1441,391 @@ func (v *Inferrer) HandleTyped(pos lexer.Position, typed Typed) int {
 	return ann.Id
 }
 
+// functionAccessConstraint 函数访问的类型就是函数的类型。泛型函数没有给出泛型实参时由调用推导
+func (v *Inferrer) functionAccessConstraint(id int, access *FunctionAccessExpr) {
+	fnType := &TypeReference{BaseType: access.Function.Type}
+
+	if len(access.Function.Type.GenericParameters) > 0 {
+		if len(access.GenericArguments) > 0 {
+			gcon := NewGenericContext(getTypeGenericParameters(fnType.BaseType), access.GenericArguments)
+			fnType = gcon.Replace(fnType)
+			v.AddSimpleIsConstraint(id, fnType)
+		}
+	} else {
+		v.AddSimpleIsConstraint(id, fnType)
+	}
+}
+
+func (v *Inferrer) isPendingOverload(access *FunctionAccessExpr) bool {
+	for _, pending := range v.overloads {
+		if pending.access == access {
+			return true
+		}
+	}
+	return false
+}
+
+// lambdaArgumentType returns the type expected for the lambda passed as the
+// argument idx in a call of a generic function. The generic parameters are
+// decided by the receiver and the other arguments where their types are
+// already known. Parts of the expected function type that still depend on
+// undecided generic parameters are left nil.
+func lambdaArgumentType(call *CallExpr, ft FunctionType, idx int) *TypeReference {
+	if idx >= len(ft.Parameters) {
+		return nil
+	}
+
+	found := make(map[string]*TypeReference)
+	extract := func(pattern, value *TypeReference) {
+		if pattern == nil || value == nil {
+			return
+		}
+		types, err := ExtractTypeVariable(pattern, value)
+		if err != nil {
+			return
+		}
+		for name, typ := range types {
+			if _, ok := found[name]; !ok && !containsTypeVariable(typ) {
+				found[name] = typ
+			}
+		}
+	}
+
+	if ft.Receiver != nil && call.ReceiverAccess != nil {
+		if typ := call.ReceiverAccess.GetType(); typ != nil {
+			extract(TypeReferenceWithoutPointers(ft.Receiver), TypeReferenceWithoutPointers(typ))
+		}
+	}
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*LambdaExpr); !ok && i < len(ft.Parameters) {
+			extract(ft.Parameters[i], arg.GetType())
+		}
+	}
+
+	expected, ok := ft.Parameters[idx].BaseType.ActualType().(FunctionType)
+	if !ok {
+		return nil
+	}
+
+	var params GenericSigil
+	var args []*TypeReference
+	for _, sub := range substitutionTypes(ft.Parameters[idx], nil) {
+		if typ, ok := found[sub.Name]; ok {
+			params = append(params, sub)
+			args = append(args, typ)
+		}
+	}
+	gcon := NewGenericContext(params, args)
+
+	decided := func(typ *TypeReference) *TypeReference {
+		typ = gcon.Replace(typ)
+		for _, sub := range substitutionTypes(typ, nil) {
+			if _, ok := found[sub.Name]; ok {
+				continue
+			}
+			for _, par := range ft.GenericParameters {
+				if par.Name == sub.Name {
+					return nil
+				}
+			}
+		}
+		return typ
+	}
+
+	res := FunctionType{Parameters: make([]*TypeReference, len(expected.Parameters))}
+	for i, par := range expected.Parameters {
+		res.Parameters[i] = decided(par)
+	}
+	if expected.Return != nil {
+		res.Return = decided(expected.Return)
+	}
+	return &TypeReference{BaseType: res}
+}
+
+// substitutionTypes appends the substitution types used in typ to dest
+func substitutionTypes(typ *TypeReference, dest []*SubstitutionType) []*SubstitutionType {
+	if typ == nil {
+		return dest
+	}
+	if sub, ok := typ.BaseType.(*SubstitutionType); ok {
+		return append(dest, sub)
+	}
+	if _, ok := typ.BaseType.(StructType); ok {
+		return dest
+	}
+	for _, child := range AddChildren(typ, nil) {
+		dest = substitutionTypes(child, dest)
+	}
+	if ft, ok := typ.BaseType.(FunctionType); ok {
+		dest = substitutionTypes(ft.Return, dest)
+	}
+	return dest
+}
+
+// returnsValue returns true if the function returns a value in any of its
+// return statements, not counting those in nested lambdas.
+func returnsValue(fn *Function) bool {
+	finder := &returnFinder{}
+	vis := NewASTVisitor(finder)
+	vis.VisitChildren(fn.Body)
+	return finder.found
+}
+
+type returnFinder struct {
+	found bool
+}
+
+func (v *returnFinder) Visit(n *Node) bool {
+	switch n := (*n).(type) {
+	case *LambdaExpr:
+		return false
+	case *ReturnStat:
+		if n.Value != nil {
+			v.found = true
+		}
+	}
+	return !v.found
+}
+
+func (v *returnFinder) PostVisit(n *Node) {}
+func (v *returnFinder) EnterScope()       {}
+func (v *returnFinder) ExitScope()        {}
+
+// lambdaReturn is the type variable of the return type left out in a lambda,
+// see the LambdaExpr case in HandleTyped.
+type lambdaReturn struct {
+	Function *Function
+}
+
+func (v *lambdaReturn) GetType() *TypeReference {
+	if containsTypeVariable(v.Function.Type.Return) {
+		return nil
+	}
+	return v.Function.Type.Return
+}
+
+func (v *lambdaReturn) SetType(t *TypeReference) { v.Function.Type.Return = t }
+
+// handleAdditive 加减法的条件。指针加减整数的结果是指针，两个指针相减的结果是int（元素的个数），
+// 所以不能像其它数值运算那样要求两边和结果的类型都相同。左操作数的类型还不知道时，
+// 结果是ConstructorPointerArith，右边的数字常量是ConstructorArithOperand，在左操作数的类型确定之后得到
+func (v *Inferrer) handleAdditive(expr *BinaryExpr, id, a, b int, ltype, rtype *TypeReference) {
+	_, leftPointer := typeOrNil(ltype).(PointerType)
+	switch {
+	// 两边的类型都已知
+	case ltype != nil && rtype != nil:
+		res, _ := pointerArithType(ltype, rtype)
+		v.AddSimpleIsConstraint(id, res)
+		return
+
+	// 左边是数字常量，如 1 + x，不会是指针运算
+	case ltype == nil && isUntypedNumeric(expr.Lhand):
+		v.AddEqualsConstraint(a, b)
+		v.AddEqualsConstraint(id, a)
+		return
+
+	// 左边是已知类型的数值
+	case ltype != nil && !leftPointer:
+		if rtype == nil {
+			v.AddEqualsConstraint(a, b)
+		}
+		v.AddSimpleIsConstraint(id, ltype)
+		return
+	}
+
+	// 左边是指针或者类型还不知道
+	if isUntypedNumeric(expr.Rhand) {
+		if leftPointer {
+			v.AddSimpleIsConstraint(b, &TypeReference{BaseType: PRIMITIVE_int})
+		} else {
+			v.AddIsConstraint(b, &TypeReference{BaseType: &ConstructorType{
+				Id:   ConstructorArithOperand,
+				Args: []*TypeReference{&TypeReference{BaseType: TypeVariable{Id: a}}},
+			}})
+		}
+	}
+	v.AddIsConstraint(id, &TypeReference{BaseType: &ConstructorType{
+		Id: ConstructorPointerArith,
+		Args: []*TypeReference{
+			&TypeReference{BaseType: TypeVariable{Id: a}},
+			&TypeReference{BaseType: TypeVariable{Id: b}},
+		},
+	}})
+}
+
+// addDerefConstraint 添加条件：类型变量id是指针表达式ptr（类型变量ptrId）指向的类型。
+// 指针的类型已知时直接使用指向的类型，否则用ConstructorDeref在指针的类型确定之后得到
+func (v *Inferrer) addDerefConstraint(id int, ptr Expr, ptrId int) {
+	if ptr.GetType() != nil {
+		addressee := getAdressee(ptr.GetType().BaseType.ActualType())
+		if addressee != nil {
+			v.AddSimpleIsConstraint(id, addressee)
+			return
+		}
+	}
+	v.AddIsConstraint(id, &TypeReference{
+		BaseType: &ConstructorType{
+			Id: ConstructorDeref,
+			Args: []*TypeReference{
+				&TypeReference{BaseType: TypeVariable{Id: ptrId}},
+			},
+		},
+	})
+}
+
+// pointerArithType 加减法的结果类型：指针加减整数是指针，两个指针相减是int，否则是左操作数的类型。
+// 操作数的类型还没有推导出来时返回false
+func pointerArithType(left, right *TypeReference) (*TypeReference, bool) {
+	if !isInferredType(left) {
+		return nil, false
+	}
+	if _, ok := left.BaseType.ActualType().(PointerType); !ok {
+		return left, true
+	}
+
+	if !isInferredType(right) {
+		return nil, false
+	}
+	if _, ok := right.BaseType.ActualType().(PointerType); ok {
+		return &TypeReference{BaseType: PRIMITIVE_int}, true
+	}
+	return left, true
+}
+
+// isInferredType 类型是否已经确定（不是类型变量或者还没有得到结果的ConstructorType）
+func isInferredType(typ *TypeReference) bool {
+	switch typ.BaseType.(type) {
+	case TypeVariable, *ConstructorType:
+		return false
+	}
+	return true
+}
+
+// typeOrNil 类型的实际类型，typ为nil时返回nil
+func typeOrNil(typ *TypeReference) Type {
+	if typ == nil {
+		return nil
+	}
+	return typ.BaseType.ActualType()
+}
+
+// compositeLiteralType returns the type of a composite literal used for
+// generating constraints. If the literal is of a generic struct type and the
+// generic arguments were left out, a type variable is created for each of the
+// generic parameters, and true is returned.
+func (v *Inferrer) compositeLiteralType(lit *CompositeLiteral) (*TypeReference, bool) {
+	st, ok := lit.Type.BaseType.ActualType().(StructType)
+	if !ok || len(st.GenericParameters) == 0 || len(lit.Type.GenericArguments) == len(st.GenericParameters) {
+		return lit.Type, false
+	}
+
+	args := make([]*TypeReference, len(st.GenericParameters))
+	for idx := range st.GenericParameters {
+		id := v.HandleTyped(lit.Pos(), &genericArgument{Literal: lit, Index: idx})
+		args[idx] = &TypeReference{BaseType: TypeVariable{Id: id}}
+	}
+	return &TypeReference{BaseType: lit.Type.BaseType, GenericArguments: args}, true
+}
+
+// genericArgument is the type variable of a generic argument left out in a
+// composite literal, see compositeLiteralType.
+type genericArgument struct {
+	Literal *CompositeLiteral
+	Index   int
+	Type    *TypeReference
+}
+
+func (v *genericArgument) GetType() *TypeReference  { return v.Type }
+func (v *genericArgument) SetType(t *TypeReference) { v.Type = t }
+
 // Solve solves the constraints using the unification algorithm.
+// 类型变量用合并-查找（union-find）结构归并，每个集合的根记录绑定的类型，参见 unify.go。
+// 求解的每一步只在比较条件的两边时代入已知的绑定，不再把替换代入所有剩余的条件
 func (v *Inferrer) Solve() []*Constraint {
-	// Create a stack, and copy all constraints to this stack
-	stack := make([]*Constraint, len(v.Constraints))
-	copy(stack, v.Constraints)
-
-	// Create an array to hold all the final substitutions
-	var substitutions []*Constraint
+	v.conflicts = nil
+	u := newUnifier(v.IdCount)
 
-	// Run through the simple constraints
+	// Run through the simple constraints. 同一个类型变量的简单条件给出了不同的类型时也是冲突，
+	// 求解时第一个条件生效（Finalize中最后一个条件生效），冲突留给语义检查报告
+	simple := make(map[int]*Constraint)
 	for _, cons := range v.SimpleConstraints {
-		stack, substitutions = v.SolveStep(stack, substitutions, false, cons)
+		if prev, ok := simple[cons.Left.Id]; ok {
+			if prev.Right.Type != nil && cons.Right.Type != nil && !Identical(prev.Right.Type, cons.Right.Type) {
+				v.conflicts = append(v.conflicts, &Constraint{
+					Left:   Side{SideType: TypeSide, Type: prev.Right.Type, origin: prev.origin},
+					Right:  Side{SideType: TypeSide, Type: cons.Right.Type, origin: cons.origin},
+					origin: cons.origin,
+					root:   cons,
+				})
+			}
+			continue
+		}
+		simple[cons.Left.Id] = cons
+
+		right := cons.Right
+		right.origin = cons.origin
+		u.bind(cons.Left.Id, right)
 	}
 
+	// Create a stack, and copy all constraints to this stack
+	stack := make([]*Constraint, len(v.Constraints))
+	copy(stack, v.Constraints)
+
 	// As long as we have a constraint on the stack
 	for len(stack) > 0 {
 		// Remove a constraint X = Y from the stack
 		element := stack[0]
 		stack[0], stack = nil, stack[1:]
 
-		stack, substitutions = v.SolveStep(stack, substitutions, true, element)
+		stack = v.SolveStep(u, stack, element)
 	}
 
-	return substitutions
+	return u.substitutions(v.IdCount)
 }
 
-func (v *Inferrer) SolveStep(stackIn []*Constraint, subsIn []*Constraint, addSubs bool, element *Constraint) (stack []*Constraint, substitutions []*Constraint) {
+func (v *Inferrer) SolveStep(u *unifier, stackIn []*Constraint, element *Constraint) (stack []*Constraint) {
 	stack = stackIn
-	substitutions = subsIn
 
-	// subsAll runs the substitues a given id for a new side, on all
-	// constraints, both on the stack and in the final substitutions
-	subsAll := func(id int, what Side) {
-		for idx, cons := range stack {
-			stack[idx] = cons.Subs(id, what)
-		}
-		for idx, cons := range substitutions {
-			substitutions[idx] = cons.Subs(id, what)
-		}
+	// 派生出的条件沿用原始条件的来源，两边的类型沿用要求它们的表达式或语句，参见 explain.go
+	x, y := element.Left, element.Right
+	if x.origin == nil {
+		x.origin = element.origin
+	}
+	if y.origin == nil {
+		y.origin = element.origin
 	}
 
-	x, y := element.Left, element.Right
+	root := element.root
+	if root == nil {
+		root = element
+	}
+	defer func(stackLen int) {
+		for _, cons := range stack[stackLen:] {
+			cons.origin, cons.root = element.origin, root
+			cons.Left.origin, cons.Right.origin = x.origin, y.origin
+		}
+	}(len(stack))
+
+	// 代入已知的绑定。之后仍然是类型变量的一边就是还没有绑定的集合的根
+	x, y = u.resolve(x), u.resolve(y)
 
 	// 1. If X and Y are identical identifiers, do nothing.
 	if x.SideType == IdentSide && y.SideType == IdentSide && x.Id == y.Id {
 		return
 	}
 
-	// 2. If X is an identifier, replace all occurrences of X by Y both on
-	// the stack and in the substitution, and add X → Y to the substitution.
+	// 2. If X is an identifier, bind X to Y: every occurrence of X now
+	// resolves to Y.
 	if x.SideType == IdentSide {
-		subsAll(x.Id, y)
-		if addSubs {
-			substitutions = append(substitutions, &Constraint{
-				Left: x, Right: y,
-			})
-		}
+		v.occursCheck(u, x.Id, y, element)
+		u.bind(x.Id, y)
 		return
 	}
 
-	// 3. If Y is an identifier, replace all occurrences of Y by X both on
-	// the stack and in the substitution, and add Y → X to the substitution.
+	// 3. If Y is an identifier, bind Y to X.
 	if y.SideType == IdentSide {
-		subsAll(y.Id, x)
-		if addSubs {
-			substitutions = append(substitutions, &Constraint{Left: y, Right: x})
-		}
+		v.occursCheck(u, y.Id, x, element)
+		u.bind(y.Id, x)
 		return
 	}
 
@@ -1090,7 +1835,7 @@ func (v *Inferrer) SolveStep(stackIn []*Constraint, subsIn []*Constraint, addSub
 
 	// 4.0.1. Equal types
 	if x.SideType == TypeSide && y.SideType == TypeSide {
-		if x.Type.ActualTypesEqual(y.Type) {
+		if Identical(x.Type, y.Type) {
 			return
 		}
 	}
@@ -1157,10 +1902,10 @@ func (v *Inferrer) SolveStep(stackIn []*Constraint, subsIn []*Constraint, addSub
 			if xFunc.Receiver != nil && yFunc.Receiver != nil {
 				stack = append(stack, ConstraintFromTypes(xFunc.Receiver, yFunc.Receiver))
 			} else if xFunc.Receiver != nil || yFunc.Receiver != nil {
-				log.Errorln("inference", "!! IMPORTANT !! xFunc and yFunc should both have Receiver or neither!")
-				log.Debugln("inference", "xFunc.recxevier: %#v", xFunc.Receiver.String())
-				log.Debugln("inference", "xFunc: %#v, yFunc: %#v", xFunc, yFunc)
-				log.Debugln("inference", "x: %#v, y: %#v", x.String(), y.String())
+				log.Errorln(log.TagInference, "!! IMPORTANT !! xFunc and yFunc should both have Receiver or neither!")
+				log.Debugln(log.TagInference, "xFunc.recxevier: %#v", xFunc.Receiver.String())
+				log.Debugln(log.TagInference, "xFunc: %#v, yFunc: %#v", xFunc, yFunc)
+				log.Debugln(log.TagInference, "x: %#v, y: %#v", x.String(), y.String())
 			}
 
 			// Return type
@@ -1192,17 +1937,68 @@ func (v *Inferrer) SolveStep(stackIn []*Constraint, subsIn []*Constraint, addSub
 		}
 	}
 
+	// 4.6. N<x1, ..., xn> = N<y1, ..., yn>
+	if x.SideType == TypeSide && y.SideType == TypeSide {
+		xNamed, okX := x.Type.BaseType.(*NamedType)
+		yNamed, okY := y.Type.BaseType.(*NamedType)
+
+		if okX && okY && xNamed.Equals(yNamed) && len(x.Type.GenericArguments) == len(y.Type.GenericArguments) {
+			for idx, argX := range x.Type.GenericArguments {
+				argY := y.Type.GenericArguments[idx]
+				stack = append(stack, ConstraintFromTypes(argX, argY))
+			}
+			return
+		}
+	}
+
 	// 5. Otherwise, X and Y do not unify. Report an error.
 	// NOTE: We defer handling error until the semantic type check
 	// TODO: Verify if continuing is ok, or if we should return now
+	v.conflicts = append(v.conflicts, &Constraint{Left: x, Right: y, origin: element.origin, root: root})
 	return
 }
 
+// occursCheck 类型变量id不能绑定到含有它自己的类型，如 $1 = func($1)，否则类型是无限的。
+// 报告产生这个条件的表达式
+func (v *Inferrer) occursCheck(u *unifier, id int, what Side, element *Constraint) {
+	if what.SideType != TypeSide || what.Type == nil {
+		return
+	}
+	for _, tid := range typeVariableIds(what.Type, nil) {
+		if u.find(tid) != id {
+			continue
+		}
+
+		ann := v.Typeds[id]
+		pos := ann.Pos
+		if element.origin != nil {
+			pos = element.origin.Pos
+		}
+		v.errPos(pos, "Infinite type: the type `$%d` of %s would have to be `%s`, which contains itself",
+			id, describeTyped(ann.Typed), what.Type.String())
+	}
+}
+
 // Finalize runs the actual unification, sets default types in cases where
 // these are needed, and sets the inferred types on the expressions.
 func (v *Inferrer) Finalize() {
+	// 先求解一次，由实参的类型选定推迟的重载，再加上选定的函数的类型重新求解
+	if len(v.overloads) > 0 {
+		v.resolveOverloads(v.Solve())
+	}
 	substitutions := v.Solve()
 
+	// 不能统一的条件留给语义检查报告，记下要求两边类型的表达式或语句，参见 FindTypeMismatch
+	for _, conflict := range v.conflicts {
+		v.Submodule.TypeMismatches = append(v.Submodule.TypeMismatches, &TypeMismatch{
+			Left:        conflict.Left.Type,
+			Right:       conflict.Right.Type,
+			LeftOrigin:  conflict.Left.origin,
+			RightOrigin: conflict.Right.origin,
+			Origin:      conflict.origin,
+		})
+	}
+
 	// Map all substitutions to the id they act upon
 	subList := make([]*Constraint, v.IdCount)
 	for _, subs := range substitutions {
@@ -1221,6 +2017,20 @@ func (v *Inferrer) Finalize() {
 		ann := v.Typeds[subs.Left.Id]
 		subList[ann.Id] = subs
 	}
+	v.solution = subList
+	v.explainSelected()
+
+	// The return types left out in lambdas must be known before applying the
+	// substitutions, the types of calls with lambda arguments depend on them
+	for id, subs := range subList {
+		ann := v.Typeds[id]
+		if ann == nil {
+			continue
+		}
+		if _, ok := ann.Typed.(*lambdaReturn); ok && (subs == nil || subs.Right.SideType != TypeSide) {
+			v.errPos(ann.Pos, "Couldn't infer return type of lambda, annotate its return type")
+		}
+	}
 
 	// Apply all substitutions
 	for _, subs := range subList {
@@ -1237,12 +2047,16 @@ func (v *Inferrer) Finalize() {
 			if ann.Typed.GetType() != nil {
 				continue
 			}
+			// Reported with the composite literal below
+			if _, ok := ann.Typed.(*genericArgument); ok {
+				continue
+			}
 			v.errPos(ann.Pos, "Couldn't infer type of expression")
 		}
 
 		if ct, ok := subs.Right.Type.BaseType.(*ConstructorType); ok {
 			switch ct.Id {
-			case ConstructorStructMember:
+			case ConstructorStructMember, ConstructorMethodCallee:
 				typ := ct.Args[0]
 				if tv, ok := typ.BaseType.(TypeVariable); ok && subList[tv.Id] != nil {
 					typ = subList[tv.Id].Right.Type
@@ -1258,6 +2072,15 @@ func (v *Inferrer) Finalize() {
 				}
 				panic("INTERNAL ERROR: Assumed unreachable")
 
+			case ConstructorPointerArith, ConstructorArithOperand:
+				v.errPos(ann.Pos, "Couldn't infer type of expression")
+
+			case ConstructorDeref:
+				if isInferredType(ct.Args[0]) {
+					v.errPos(ann.Pos, "Cannot dereference non-pointer type `%s`", ct.Args[0].String())
+				}
+				v.errPos(ann.Pos, "Couldn't infer type of expression")
+
 			default:
 				panic("INTERNAL ERROR: Unhandled ConstructorType escaped inference pass " + ct.String())
 			}
@@ -1286,27 +2109,12 @@ func (v *Inferrer) Finalize() {
 					v.errPos(sae.Pos(), "Type `%s` has no method `%s`", TypeWithoutPointers(sae.Struct.GetType().BaseType).TypeName(), sae.Member)
 				}
 
-				// Some extra generic context used with interface constraints
-				var extraGcon *GenericContext
-				if sub, ok := sae.Struct.GetType().BaseType.(*SubstitutionType); ok {
-				outer:
-					for _, con := range sub.Constraints {
-						inter := con.BaseType.ActualType().(InterfaceType)
-						for _, ifn := range inter.Functions {
-							if ifn == fn {
-								extraGcon = NewGenericContext(inter.GenericParameters, con.GenericArguments)
-								break outer
-							}
-						}
-					}
-				}
-
 				fae := &FunctionAccessExpr{
 					Function:            fn,
 					ReceiverAccess:      n.ReceiverAccess,
 					GenericArguments:    sae.GenericArguments,
 					ParentFunction:      sae.ParentFunction,
-					ExtraGenericContext: extraGcon,
+					ExtraGenericContext: interfaceGenericContext(sae.Struct.GetType(), fn),
 				}
 				fae.SetPos(sae.Pos())
 
@@ -1330,7 +2138,7 @@ func (v *Inferrer) Finalize() {
 				fn.Accesses = append(fn.Accesses, fae)
 			}
 
-			log.Debugln("inference", "infering Call:%#v", n)
+			log.Debugln(log.TagInference, "infering Call:%#v", n)
 			if n.Function != nil {
 				if _, ok := n.Function.GetType().BaseType.(FunctionType); !ok {
 					v.errPos(n.Function.Pos(), "Attempt to call non-function `%s`", n.Function.GetType().String())
@@ -1366,7 +2174,10 @@ func (v *Inferrer) Finalize() {
 
 		case *StructAccessExpr:
 			// Check if we're dealing with a method and exit early
-			if GetMethod(n.Struct.GetType().BaseType, n.Member) != nil {
+			if fn := GetMethod(n.Struct.GetType().BaseType, n.Member); fn != nil {
+				if !n.Callee {
+					v.finishMethodValue(n, fn)
+				}
 				break
 			}
 
@@ -1419,6 +2230,35 @@ func (v *Inferrer) Finalize() {
 				nlr.SetType(n.Lhand.GetType())
 			}
 
+		case *FloatBuiltinExpr:
+			// 数字常量参数的类型跟随第一个非常量参数
+			var typ *TypeReference
+			for _, arg := range n.Arguments {
+				if _, ok := arg.(*NumericLiteral); !ok {
+					typ = arg.GetType()
+					break
+				}
+			}
+
+			if typ != nil {
+				for _, arg := range n.Arguments {
+					if numlit, ok := arg.(*NumericLiteral); ok {
+						numlit.SetType(typ)
+					}
+				}
+			}
+
+		case *OverflowArithExpr:
+			// 与二元表达式相同，数字常量的类型跟随另一边的操作数
+			if nll, ok := n.Lhand.(*NumericLiteral); ok {
+				nll.SetType(n.Rhand.GetType())
+			} else if nlr, ok := n.Rhand.(*NumericLiteral); ok {
+				nlr.SetType(n.Lhand.GetType())
+			}
+
+		case *CompositeLiteral:
+			v.finishCompositeLiteral(n)
+
 		case *CastExpr:
 			expr, ok := n.Expr.(*NumericLiteral)
 
@@ -1432,17 +2272,281 @@ func (v *Inferrer) Finalize() {
 	}
 
 	// TODO: Bandaid for #706
+	// 给出了类型的变量保留声明的类型，赋给它的值的类型不同时由语义检查报告；
+	// 接口类型的变量也是这样，赋给它的值在语义检查中装箱，参见 interface.go
 	for node := range v.Submodule.IterNodes() {
 		if varDecl, ok := node.(*VariableDecl); ok {
-			if varDecl.Assignment != nil {
+			if varDecl.Assignment != nil && !v.declared[varDecl.Variable] {
 				varDecl.Variable.Type = varDecl.Assignment.GetType()
 			}
 		}
 	}
 }
 
+// isUntypedNumeric 表达式的类型是否只由数字常量的默认类型决定，如 1 + 2 和 -1。
+// 这样的表达式不约束为默认类型，而是与上下文（变量的类型、形参的类型、另一个操作数等）相同，
+// 求解之后常量取得上下文的类型，如 var x u8 = 1 + 2 中的常量都是u8；上下文没有要求时才使用默认类型
+func isUntypedNumeric(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *NumericLiteral:
+		return expr.Type == nil && !expr.IsDuration
+
+	case *BinaryExpr:
+		cat := expr.Op.Category()
+		return (cat == parser.OP_ARITHMETIC || cat == parser.OP_BITWISE) &&
+			isUntypedNumeric(expr.Lhand) && isUntypedNumeric(expr.Rhand)
+
+	case *UnaryExpr:
+		return (expr.Op == parser.UNOP_NEGATIVE || expr.Op == parser.UNOP_BIT_NOT) && isUntypedNumeric(expr.Expr)
+
+	case *CondExpr:
+		values := expr.Values()
+		for _, value := range values {
+			if !isUntypedNumeric(value) {
+				return false
+			}
+		}
+		return len(values) > 0
+	}
+	return false
+}
+
+// untypedNumericDefault 只由数字常量组成的表达式的默认类型：有浮点常量时是浮点常量的默认类型，否则是int
+func untypedNumericDefault(expr Expr) *TypeReference {
+	switch expr := expr.(type) {
+	case *BinaryExpr:
+		if typ := untypedNumericDefault(expr.Lhand); typ.BaseType.IsFloatingType() {
+			return typ
+		}
+		return untypedNumericDefault(expr.Rhand)
+
+	case *UnaryExpr:
+		return untypedNumericDefault(expr.Expr)
+
+	case *CondExpr:
+		values := expr.Values()
+		for _, value := range values {
+			if typ := untypedNumericDefault(value); typ.BaseType.IsFloatingType() {
+				return typ
+			}
+		}
+		return untypedNumericDefault(values[0])
+	}
+	return expr.GetType()
+}
+
+// interfaceGenericContext returns some extra generic context used with
+// generic interfaces, when the method is called on a substitution type with
+// interface constraints or on an interface value.
+func interfaceGenericContext(receiver *TypeReference, fn *Function) *GenericContext {
+	receiver = typeReferenceWithoutIndirection(receiver)
+	if inter, ok := InterfaceOf(receiver); ok {
+		if len(inter.GenericParameters) > 0 && inter.GetFunction(fn.Name) == fn {
+			return NewGenericContext(inter.GenericParameters, receiver.GenericArguments)
+		}
+		return nil
+	}
+
+	sub, ok := receiver.BaseType.(*SubstitutionType)
+	if !ok {
+		return nil
+	}
+	for _, con := range sub.Constraints {
+		inter := con.BaseType.ActualType().(InterfaceType)
+		for _, ifn := range inter.Functions {
+			if ifn == fn {
+				return NewGenericContext(inter.GenericParameters, con.GenericArguments)
+			}
+		}
+	}
+	return nil
+}
+
+// finishMethodValue 方法值：记录访问的方法，由接收者的类型推导方法的泛型参数。
+// 方法自己的泛型参数无法由接收者得到，必须给出泛型实参
+func (v *Inferrer) finishMethodValue(sae *StructAccessExpr, fn *Function) {
+	typ := sae.GetType()
+	if len(sae.GenericArguments) == 0 {
+		for _, sub := range substitutionTypes(typ, nil) {
+			for _, par := range fn.Type.GenericParameters {
+				if sub == par {
+					v.errPos(sae.Pos(), "Couldn't infer generic arguments of method `%s` used as a value, specify them like `%s<...>`",
+						sae.Member, sae.Member)
+				}
+			}
+		}
+	}
+
+	fae := &FunctionAccessExpr{
+		Function:            fn,
+		ReceiverAccess:      sae.Struct,
+		GenericArguments:    sae.GenericArguments,
+		ParentFunction:      sae.ParentFunction,
+		ExtraGenericContext: interfaceGenericContext(sae.Struct.GetType(), fn),
+	}
+	fae.SetPos(sae.Pos())
+
+	fnType := typ.BaseType.(FunctionType)
+	fnType.Receiver = sae.Struct.GetType()
+	fae.SetType(&TypeReference{BaseType: fnType})
+
+	sae.Method = fae
+	fn.Accesses = append(fn.Accesses, fae)
+}
+
+// finishCompositeLiteral determines the generic arguments left out in a
+// composite literal of a generic struct type. Arguments not decided by the
+// context are extracted from the types of the member values. Untyped numeric
+// literals are only used if no other member decides the argument, and a
+// floating point literal wins over an integer one.
+func (v *Inferrer) finishCompositeLiteral(lit *CompositeLiteral) {
+	if lit.Type == nil {
+		return
+	}
+	st, ok := lit.Type.BaseType.ActualType().(StructType)
+	if !ok || len(st.GenericParameters) == 0 {
+		return
+	}
+
+	args := make([]*TypeReference, len(st.GenericParameters))
+	fromContext := make([]bool, len(args))
+	if len(lit.Type.GenericArguments) == len(args) {
+		for idx, arg := range lit.Type.GenericArguments {
+			if !containsTypeVariable(arg) {
+				args[idx] = arg
+				fromContext[idx] = true
+			}
+		}
+	}
+
+	literals := make([]*TypeReference, len(args))
+	for idx, val := range lit.Values {
+		// Untyped numeric literals have their default types
+		if numlit, ok := val.(*NumericLiteral); ok && numlit.Type == nil {
+			numlit.SetType(nil)
+		}
+
+		mem := st.GetMember(lit.Fields[idx])
+		if mem == nil || val.GetType() == nil || containsTypeVariable(val.GetType()) {
+			continue
+		}
+
+		types, err := ExtractTypeVariable(mem.Type, val.GetType())
+		if err != nil {
+			// The mismatch is reported by the semantic type check
+			continue
+		}
+
+		numlit, isLiteral := val.(*NumericLiteral)
+		for pidx, param := range st.GenericParameters {
+			typ, ok := types[param.Name]
+			if !ok || containsTypeVariable(typ) || fromContext[pidx] {
+				continue
+			}
+
+			if isLiteral {
+				if literals[pidx] == nil || numlit.IsFloat {
+					literals[pidx] = typ
+				}
+			} else if args[pidx] == nil {
+				args[pidx] = typ
+			} else if !Identical(args[pidx], typ) {
+				v.errPos(val.Pos(), "Conflicting types `%s` and `%s` for generic parameter `%s` of `%s`",
+					args[pidx].String(), typ.String(), param.Name, lit.Type.BaseType.TypeName())
+			}
+		}
+	}
+
+	for idx, arg := range args {
+		if arg == nil {
+			args[idx] = literals[idx]
+		}
+		if args[idx] == nil {
+			v.errPos(lit.Pos(), "Couldn't infer generic parameter `%s` of `%s`, specify the generic arguments like `%s<...>{...}`",
+				st.GenericParameters[idx].Name, lit.Type.BaseType.TypeName(), lit.Type.BaseType.TypeName())
+		}
+	}
+	lit.Type = &TypeReference{BaseType: lit.Type.BaseType, GenericArguments: args}
+
+	// Numeric literals get the type of their member with the inferred arguments
+	gcon := NewGenericContextFromTypeReference(lit.Type)
+	for idx, val := range lit.Values {
+		mem := st.GetMember(lit.Fields[idx])
+		if numlit, ok := val.(*NumericLiteral); ok && mem != nil {
+			if _, ok := mem.Type.BaseType.(*SubstitutionType); ok {
+				numlit.Type = nil
+				numlit.SetType(gcon.Replace(mem.Type))
+			}
+		}
+	}
+}
+
+// containsTypeVariable returns true if the type still contains a type variable
+func containsTypeVariable(typ *TypeReference) bool {
+	if typ == nil {
+		return false
+	}
+	if _, ok := typ.BaseType.(TypeVariable); ok {
+		return true
+	}
+
+	for _, arg := range typ.GenericArguments {
+		if containsTypeVariable(arg) {
+			return true
+		}
+	}
+
+	switch t := typ.BaseType.(type) {
+	case PointerType:
+		return containsTypeVariable(t.Addressee)
+	case ReferenceType:
+		return containsTypeVariable(t.Referrer)
+	case ArrayType:
+		return containsTypeVariable(t.MemberType)
+	case TupleType:
+		for _, mem := range t.Members {
+			if containsTypeVariable(mem) {
+				return true
+			}
+		}
+	case FunctionType:
+		for _, par := range t.Parameters {
+			if containsTypeVariable(par) {
+				return true
+			}
+		}
+		return containsTypeVariable(t.Return)
+	}
+	return false
+}
+
 // SetType Methods
 
+// SetType fills in the parameter and return types left out in the lambda from
+// the type expected by the context. Parts of the expected type which are nil
+// or not yet known are ignored.
+func (v *LambdaExpr) SetType(t *TypeReference) {
+	if t == nil {
+		return
+	}
+	ft, ok := t.BaseType.ActualType().(FunctionType)
+	if !ok || len(ft.Parameters) != len(v.Function.Parameters) {
+		return
+	}
+
+	fn := v.Function
+	for idx, par := range fn.Parameters {
+		if par.Variable.Type == nil && ft.Parameters[idx] != nil && !containsTypeVariable(ft.Parameters[idx]) {
+			par.Variable.Type = ft.Parameters[idx]
+			fn.Type.Parameters[idx] = ft.Parameters[idx]
+		}
+	}
+
+	if (fn.Type.Return == nil || containsTypeVariable(fn.Type.Return)) && ft.Return != nil && !containsTypeVariable(ft.Return) {
+		fn.Type.Return = ft.Return
+	}
+}
+
 // UnaryExpr
 func (v *UnaryExpr) SetType(t *TypeReference) {
 	v.Type = t
@@ -1453,8 +2557,24 @@ func (v *BinaryExpr) SetType(t *TypeReference) {
 	v.Type = t
 }
 
+// FloatBuiltinExpr
+func (v *FloatBuiltinExpr) SetType(t *TypeReference) {
+	v.Type = t
+}
+
+// OverflowArithExpr
+func (v *OverflowArithExpr) SetType(t *TypeReference) {
+	v.Type = t
+}
+
 // NumericLiteral
 func (v *NumericLiteral) SetType(t *TypeReference) {
+	// 时长字面量的类型不随上下文改变，类型不同时由语义检查报告
+	if v.IsDuration {
+		v.Type = DurationType()
+		return
+	}
+
 	var actual Type
 	if t != nil {
 		actual = t.BaseType.ActualType()
@@ -1493,6 +2613,14 @@ func (v *CompositeLiteral) SetType(t *TypeReference) {
 		case StructType, ArrayType:
 			v.Type = t
 		}
+		return
+	}
+
+	// 省略了泛型参数的结构体字面量，从上下文得到泛型参数
+	if st, ok := v.Type.BaseType.ActualType().(StructType); ok && len(st.GenericParameters) > 0 &&
+		(len(v.Type.GenericArguments) != len(st.GenericParameters) || containsTypeVariable(v.Type)) &&
+		v.Type.BaseType.Equals(t.BaseType) && len(t.GenericArguments) == len(st.GenericParameters) {
+		v.Type = t
 	}
 }
 
@@ -1503,6 +2631,17 @@ func (v *StringLiteral) SetType(t *TypeReference) {
 	} // TODO arrays
 }
 
+// CondExpr 各个分支的值的类型与它相同
+func (v *CondExpr) SetType(t *TypeReference) {
+	if t == nil {
+		return
+	}
+	v.Type = t
+	for _, value := range v.Values() {
+		value.SetType(t)
+	}
+}
+
 // TupleLiteral
 func (v *TupleLiteral) SetType(t *TypeReference) {
 	if t == nil {
@@ -1527,15 +2666,15 @@ func (v *FunctionAccessExpr) SetType(t *TypeReference) {
 	if len(v.GenericArguments) == 0 && len(v.Function.Type.GenericParameters) > 0 {
 		types, err := ExtractTypeVariable(&TypeReference{BaseType: v.Function.Type}, t)
 		if err != nil {
-			log.Errorln("inference", "%s [%s:%d:%d] Unable to infer extract generic arguments for call",
+			log.Errorln(log.TagInference, "%s [%s:%d:%d] Unable to infer extract generic arguments for call",
 				util.Red("error:"), v.Pos().Filename, v.Pos().Line, v.Pos().Char)
 			panic(err)
 		}
 
 		if len(types) != len(v.Function.Type.GenericParameters) {
-			log.Errorln("inference", "%s [%s:%d:%d] Unable to infer generic arguments for call",
+			log.Errorln(log.TagInference, "%s [%s:%d:%d] Unable to infer generic arguments for call",
 				util.Red("error:"), v.Pos().Filename, v.Pos().Line, v.Pos().Char)
-			os.Exit(1)
+			util.ExitFunc(1)
 		}
 
 		genArgs := make([]*TypeReference, len(v.Function.Type.GenericParameters))
@@ -1544,10 +2683,10 @@ func (v *FunctionAccessExpr) SetType(t *TypeReference) {
 		}
 		v.GenericArguments = genArgs
 	} else if len(v.GenericArguments) != len(v.Function.Type.GenericParameters) {
-		log.Errorln("inference", "%s [%s:%d:%d] Amount of generic arguments must match amount of generic parameters, %d vs %d",
+		log.Errorln(log.TagInference, "%s [%s:%d:%d] Amount of generic arguments must match amount of generic parameters, %d vs %d",
 			util.Red("error:"), v.Pos().Filename, v.Pos().Line, v.Pos().Char,
 			len(v.GenericArguments), len(v.Function.Type.GenericParameters))
-		os.Exit(1)
+		util.ExitFunc(1)
 	}
 }
 
@@ -1595,18 +2734,27 @@ func (v *EnumPatternExpr) SetType(t *TypeReference) {
 
 // Noops
 func (_ ArrayAccessExpr) SetType(t *TypeReference)    {}
+func (_ VolatileLoadExpr) SetType(t *TypeReference)   {}
+func (_ CStringExpr) SetType(t *TypeReference)        {}
+func (_ HashExpr) SetType(t *TypeReference)           {}
+func (_ NewExpr) SetType(t *TypeReference)            {}
+func (_ TempAccessExpr) SetType(t *TypeReference)     {}
 func (_ ArrayLenExpr) SetType(t *TypeReference)       {}
+func (_ SliceExpr) SetType(t *TypeReference)          {}
 func (_ BoolLiteral) SetType(t *TypeReference)        {}
 func (_ CastExpr) SetType(t *TypeReference)           {}
+func (_ BitcastExpr) SetType(t *TypeReference)        {}
+func (_ InterfaceWrapExpr) SetType(t *TypeReference)  {}
 func (_ CallExpr) SetType(t *TypeReference)           {}
 func (_ DerefAccessExpr) SetType(t *TypeReference)    {}
 func (_ DiscardAccessExpr) SetType(t *TypeReference)  {}
-func (_ LambdaExpr) SetType(t *TypeReference)         {}
 func (_ PointerToExpr) SetType(t *TypeReference)      {}
 func (_ ReferenceToExpr) SetType(t *TypeReference)    {}
 func (_ RuneLiteral) SetType(t *TypeReference)        {}
 func (_ VariableAccessExpr) SetType(t *TypeReference) {}
 func (_ SizeofExpr) SetType(t *TypeReference)         {}
+func (_ AlignofExpr) SetType(t *TypeReference)        {}
+func (_ OffsetofExpr) SetType(t *TypeReference)       {}
 func (_ StructAccessExpr) SetType(t *TypeReference)   {}
 
 // ExtractTypeVariable takes a pattern type containing one or more substitution
@@ -1660,9 +2808,14 @@ func ExtractTypeVariable(pattern *TypeReference, value *TypeReference) (map[stri
 				return nil, fmt.Errorf("inference: type mismatch %v != %v", pGoTyp, vGoTyp)
 			}
 
-			// If the pattern part is not a substitution type, delve deeper
+			// If the pattern part is not a substitution type, delve deeper.
+			// The children must correspond one to one, e.g. a generic type
+			// used without generic arguments doesn't match.
 			ps = AddChildren(ppart, ps)
 			vs = AddChildren(vpart, vs)
+			if len(ps) != len(vs) {
+				return nil, fmt.Errorf("inference: type mismatch %s != %s", ppart.String(), vpart.String())
+			}
 		}
 	}
 
@@ -1683,6 +2836,9 @@ func AddChildren(typ *TypeReference, dest []*TypeReference) []*TypeReference {
 	case PointerType:
 		dest = append(dest, t.Addressee)
 
+	case ReferenceType:
+		dest = append(dest, t.Referrer)
+
 	case TupleType:
 		for _, tref := range t.Members {
 			dest = append(dest, tref)
@@ -1702,6 +2858,10 @@ func AddChildren(typ *TypeReference, dest []*TypeReference) []*TypeReference {
 			dest = append(dest, tref)
 		}
 
+		if t.Return != nil {
+			dest = append(dest, t.Return)
+		}
+
 	case *NamedType:
 		for _, garg := range typ.GenericArguments {
 			dest = append(dest, garg)
@@ -0,0 +1,150 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// 接口值
+//
+// 接口类型除了用作泛型参数的约束，也可以作为值的类型，如 []Printable 的元素可以是实现了接口的不同类型的值。
+// 接口值由两个指针组成：装箱的值的地址和方法表。
+//   - 命名类型的值存入接口类型的位置（变量、数组元素、实参、返回值等）时装箱，
+//     语义检查在这些位置插入 InterfaceWrapExpr（参见 semantic.expectType）；
+//   - 装箱把值复制到当前函数的栈上，与数组字面量的存储相同，接口值不能在创建它的函数返回之后使用；
+//   - 方法表的第一项是装箱的值的类型信息，之后按接口中方法的顺序存放类型的方法的绑定函数
+//     （参见 LLVMCodegen.boundMethodThunk），通过接口值调用方法时从方法表中取出绑定函数，
+//     装箱的值的地址作为第一个参数；
+//   - 类型信息记录类型的名字和可以实现接口方法的所有方法（参见 TypeInfoMethods），
+//     接口值之间的转换 J(i) 在运行时由类型信息查找J的每个方法，组成新的方法表，
+//     装箱的值的类型没有J的方法时停止程序（参见运行时中的 __interface_method）。
+//
+// 复制接口值只复制这两个指针，所有副本共享同一个装箱的值，所以实现接口方法的方法不能有可变的接收者，
+// 否则通过一个副本的修改会在其它副本中可见，与值的复制语义不一致。
+// 作为值的类型时，接口的方法不能有自己的泛型参数（方法表中只能存放确定的函数）
+
+// InterfaceWrapExpr 把命名类型的值装箱为接口值
+
+type InterfaceWrapExpr struct {
+	nodePos
+	Expr      Expr
+	Interface *TypeReference
+
+	// Expr是对值的不可变引用，不复制值，装箱的值的地址就是引用的地址。
+	// 需要 &I 的地方使用 &T 时生成，参见 types_compat.go
+	Borrowed bool
+}
+
+func (_ InterfaceWrapExpr) exprNode() {}
+
+func (v InterfaceWrapExpr) String() string {
+	return NewASTStringer("InterfaceWrapExpr").Add(v.Expr).AddTypeReference(v.Interface).Finish()
+}
+
+func (v InterfaceWrapExpr) GetType() *TypeReference {
+	return v.Interface
+}
+
+func (_ InterfaceWrapExpr) NodeName() string {
+	return "interface wrap expression"
+}
+
+// InterfaceOf 类型是否是接口类型，是时返回接口
+func InterfaceOf(t *TypeReference) (InterfaceType, bool) {
+	if t == nil {
+		return InterfaceType{}, false
+	}
+	it, ok := t.BaseType.ActualType().(InterfaceType)
+	return it, ok
+}
+
+// InterfaceMethod 类型typ中实现接口iface的方法ifn的方法。不能实现时返回nil和原因
+func InterfaceMethod(typ, iface *TypeReference, ifn *Function) (*Function, string) {
+	if len(ifn.Type.GenericParameters) > 0 {
+		return nil, fmt.Sprintf("interface method `%s` has generic parameters", ifn.Name)
+	}
+
+	named, ok := typ.BaseType.(*NamedType)
+	if !ok {
+		return nil, fmt.Sprintf("missing method `%s`", ifn.Name)
+	}
+	method := named.GetMethod(ifn.Name)
+	if method == nil {
+		return nil, fmt.Sprintf("missing method `%s`", ifn.Name)
+	}
+
+	if len(method.Type.GenericParameters) != len(typ.GenericArguments) {
+		return nil, fmt.Sprintf("method `%s` has generic parameters", ifn.Name)
+	}
+	if ptr, ok := method.Type.Receiver.BaseType.(PointerType); ok && ptr.IsMutable {
+		return nil, fmt.Sprintf("method `%s` has a mutable receiver, and copies of interface values share the boxed value", ifn.Name)
+	}
+
+	want, have := InterfaceMethodType(iface, ifn), boxedMethodType(typ, method)
+	if !SameParameterTypes(have, want) || !Identical(functionReturn(have), functionReturn(want)) {
+		return nil, fmt.Sprintf("method `%s` has type `%s`, want `%s`", ifn.Name,
+			methodSignature(have), methodSignature(want))
+	}
+
+	return method, ""
+}
+
+// InterfaceMethodType 接口iface的方法ifn代入接口的泛型实参之后的类型
+func InterfaceMethodType(iface *TypeReference, ifn *Function) FunctionType {
+	inter, _ := InterfaceOf(iface)
+	return NewGenericContext(inter.GenericParameters, iface.GenericArguments).
+		Replace(&TypeReference{BaseType: ifn.Type}).BaseType.(FunctionType)
+}
+
+// boxedMethodType 类型typ的方法method代入类型的泛型实参之后的类型
+func boxedMethodType(typ *TypeReference, method *Function) FunctionType {
+	return NewGenericContext(method.Type.GenericParameters, typ.GenericArguments).
+		Replace(&TypeReference{BaseType: method.Type}).BaseType.(FunctionType)
+}
+
+// TypeInfoMethod 类型信息中的一个方法。Key由方法名和方法的类型组成，如 show fun() string，
+// 转换接口值时用接口方法的Key查找
+type TypeInfoMethod struct {
+	Function *Function
+	Key      string
+}
+
+// TypeInfoMethods 类型typ的值装箱时类型信息中记录的方法：没有自己的泛型参数、接收者不可变的方法
+func TypeInfoMethods(typ *TypeReference) []TypeInfoMethod {
+	named, ok := typ.BaseType.(*NamedType)
+	if !ok {
+		return nil
+	}
+
+	var res []TypeInfoMethod
+	for _, method := range named.Methods {
+		if len(method.Type.GenericParameters) != len(typ.GenericArguments) {
+			continue
+		}
+		if ptr, ok := method.Type.Receiver.BaseType.(PointerType); ok && ptr.IsMutable {
+			continue
+		}
+		res = append(res, TypeInfoMethod{Function: method, Key: InterfaceMethodKey(method.Name, boxedMethodType(typ, method))})
+	}
+	return res
+}
+
+// InterfaceMethodKey 方法在类型信息中的Key
+func InterfaceMethodKey(name string, typ FunctionType) string {
+	return name + " " + methodSignature(typ)
+}
+
+// methodSignature 在错误信息中表示方法的类型，不包括接收者，如 fun(int) bool
+func methodSignature(typ FunctionType) string {
+	res := "fun("
+	for idx, par := range typ.Parameters {
+		if idx > 0 {
+			res += ", "
+		}
+		res += par.String()
+	}
+	res += ")"
+	if ret := functionReturn(typ); !ret.BaseType.IsVoidType() {
+		res += " " + ret.String()
+	}
+	return res
+}
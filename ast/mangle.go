@@ -3,6 +3,8 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // In case we support multiple name mangling schemes
@@ -57,6 +59,9 @@ func TypeReferenceMangledName(mangleType MangleType, typ *TypeReference, gcon *G
 			}
 
 		case StructType:
+			if typ.IsUnion {
+				res += "U"
+			}
 			res += fmt.Sprintf("S%d", len(typ.Members))
 			for _, mem := range typ.Members {
 				res += TypeReferenceMangledName(mangleType, mem.Type, gcon)
@@ -135,46 +140,146 @@ func (v Module) MangledName(typ MangleType) string {
 }
 
 func (v Function) MangledName(typ MangleType, gcon *GenericContext) string {
-	if v.Name == "main" {
+	if v.Name == "main" && v.Outer == nil {
 		return "main" // TODO make sure only one main function
 	}
 
 	switch typ {
 	case MANGLE_ARK_UNSTABLE:
-		var prefix string
-		if v.Type.Receiver != nil {
-			prefix = "m"
-		} else if v.StaticReceiverType != nil {
-			prefix = "s"
-		}
+		return v.ParentModule.MangledName(typ) + v.localMangledName(typ, gcon)
+	default:
+		panic("")
+	}
+}
 
-		result := fmt.Sprintf("_%sF%d%s", prefix, len(v.Name), v.Name)
-		for _, arg := range v.Parameters {
-			result += TypeReferenceMangledName(typ, arg.Variable.Type, gcon)
-		}
+// localMangledName 不含模块前缀的符号名。嵌套函数的符号名是外层函数的符号名、_N 和它自己的符号名，
+// 如 main 中的 inner(int) int 是 _F4main_3int_N_F5inner_3int_3int
+func (v Function) localMangledName(typ MangleType, gcon *GenericContext) string {
+	var prefix string
+	if v.Type.Receiver != nil {
+		prefix = "m"
+	} else if v.StaticReceiverType != nil {
+		prefix = "s"
+	}
 
-		result += TypeReferenceMangledName(typ, v.Type.Return, gcon)
+	result := fmt.Sprintf("_%sF%d%s", prefix, len(v.Name), v.Name)
 
-		if v.Type.Receiver != nil {
-			result = TypeReferenceMangledName(typ, v.Type.Receiver, gcon) + result
-		} else if v.StaticReceiverType != nil {
-			result = TypeReferenceMangledName(typ, &TypeReference{BaseType: v.StaticReceiverType}, gcon) + result
+	// 泛型函数的实例加上泛型实参，与参数类型相同的非泛型重载区分，如 f<T>(T) 的实例 f<int> 与 f(int)
+	if len(v.Type.GenericParameters) > 0 {
+		result += "G"
+		for _, par := range v.Type.GenericParameters {
+			result += TypeReferenceMangledName(typ, &TypeReference{BaseType: par}, gcon)
 		}
+	}
 
-		result = v.ParentModule.MangledName(typ) + result
+	for _, arg := range v.Parameters {
+		result += TypeReferenceMangledName(typ, arg.Variable.Type, gcon)
+	}
 
-		return result
-	default:
-		panic("")
+	result += TypeReferenceMangledName(typ, v.Type.Return, gcon)
+
+	if v.Type.Receiver != nil {
+		result = TypeReferenceMangledName(typ, v.Type.Receiver, gcon) + result
+	} else if v.StaticReceiverType != nil {
+		result = TypeReferenceMangledName(typ, &TypeReference{BaseType: v.StaticReceiverType}, gcon) + result
 	}
+
+	if v.Outer != nil {
+		result = v.Outer.localMangledName(typ, nil) + "_N" + result
+	}
+	return result
 }
 
 func (v Variable) MangledName(typ MangleType) string {
 	switch typ {
 	case MANGLE_ARK_UNSTABLE:
 		result := fmt.Sprintf("_V%d%s", len(v.Name), v.Name)
+
+		// 不同类型的静态成员可以同名
+		if v.StaticReceiverType != nil {
+			result = v.ParentModule.MangledName(typ) +
+				TypeReferenceMangledName(typ, &TypeReference{BaseType: v.StaticReceiverType}, nil) + "_s" + result[1:]
+		}
 		return result
 	default:
 		panic("")
 	}
 }
+
+// DemangleFunction 从函数的符号名中还原模块名和函数名，方法的函数名为 类型名.方法名，嵌套函数为 外层函数名.函数名。
+// 泛型函数的各个实例还原出的名字相同。不是ku函数的符号（如main、运行时的C函数、全局变量）返回false
+func DemangleFunction(symbol string) (module, function string, ok bool) {
+	var parts []string
+	rest := symbol
+	for strings.HasPrefix(rest, "_M") {
+		name, after, ok := demangleName(rest[2:])
+		if !ok {
+			return "", "", false
+		}
+		parts = append(parts, name)
+		rest = after
+	}
+	if len(parts) == 0 {
+		return "", "", false
+	}
+
+	// 函数名前是方法的接收者类型，接收者类型的编码中不会出现 _F、_mF 或 _sF 后跟数字
+	for i := 0; i < len(rest); i++ {
+		var marker string
+		switch {
+		case i == 0 && strings.HasPrefix(rest, "_F"):
+			marker = "_F"
+		case i > 0 && (strings.HasPrefix(rest[i:], "_mF") || strings.HasPrefix(rest[i:], "_sF")):
+			marker = rest[i : i+3]
+		default:
+			continue
+		}
+
+		name, _, ok := demangleName(rest[i+len(marker):])
+		if !ok {
+			continue
+		}
+		if i > 0 {
+			name = demangleTypeName(rest[:i]) + "." + name
+		}
+
+		// 嵌套函数：之后的每个 _N_F 是一层嵌套函数
+		nested := rest[i+len(marker):]
+		for {
+			idx := strings.Index(nested, "_N_F")
+			if idx < 0 {
+				break
+			}
+			inner, after, ok := demangleName(nested[idx+4:])
+			if !ok {
+				break
+			}
+			name += "." + inner
+			nested = after
+		}
+		return strings.Join(parts, "."), name, true
+	}
+	return "", "", false
+}
+
+// demangleName 读入 <长度><名字>
+func demangleName(s string) (name, rest string, ok bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil || n <= 0 || i+n > len(s) {
+		return "", "", false
+	}
+	return s[i : i+n], s[i+n:], true
+}
+
+// demangleTypeName 接收者类型的名字，指针和泛型参数被去掉。不是命名类型时返回原来的编码
+func demangleTypeName(s string) string {
+	trimmed := strings.TrimLeft(strings.TrimPrefix(s, "_"), "p")
+	if name, _, ok := demangleName(trimmed); ok {
+		return name
+	}
+	return s
+}
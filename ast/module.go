@@ -19,14 +19,24 @@ type Module struct {
 	Parts           map[string]*Submodule
 	LinkedLibraries []string
 	resolved        bool
+
+	// 从接口文件（.kui）读入的模块：只有导出的声明，非泛型函数没有函数体，代码由预先编译的目标文件提供
+	Interface bool
 }
 
 type Submodule struct {
-	Parent   *Module
-	UseScope *Scope
-	File     *lexer.Sourcefile
-	Nodes    []Node
-	inferred bool
+	Parent    *Module
+	UseScope  *Scope
+	FileScope *Scope // 文件私有（priv）的声明，外层是模块作用域
+	File      *lexer.Sourcefile
+	Nodes     []Node
+	inferred  bool
+
+	TypeMismatches []*TypeMismatch // 类型推导时不能统一的类型，由语义检查报告
+
+	// 文件中的 #warn 和 #feature 指令，参见directive.go
+	WarnDirectives    []*WarnDirective
+	FeatureDirectives []*FeatureDirective
 }
 
 type ModuleLookup struct {
@@ -76,8 +86,8 @@ func (v *ModuleLookup) Create(name *ModuleName) *ModuleLookup {
 
 func (v *ModuleLookup) Dump(i int) {
 	if v.Name != "" {
-		log.Debug("main", "%s", strings.Repeat(" ", i))
-		log.Debugln("main", "%s", v.Name)
+		log.Debug(log.TagMain, "%s", strings.Repeat(" ", i))
+		log.Debugln(log.TagMain, "%s", v.Name)
 	}
 
 	for _, child := range v.Children {
@@ -0,0 +1,87 @@
+package ast
+
+// 所有权和移动
+//
+// 有drop方法的类型、标注了 [owned] 的结构体，以及直接包含它们的值的结构体、元组、枚举和定长数组是有所有权的类型。
+// 这样的值不能复制，赋值和传参把所有权移动到新的位置：
+//   - 移动的位置：变量的初始值、赋值的右侧、实参、return的值、复合字面量和元组的成员、new的值、代码块的值（Block.Tail）；
+//   - 只能移出局部变量和参数，不能移出全局变量、方法的接收者、成员、数组元素和指针指向的值，
+//     它们仍然属于别的值，应当传递引用或者指针；
+//   - 移出之后变量不能再使用，直到重新赋值。可能移出（只在某些分支中移出）的变量同样不能使用，参见 semantic/move.go。
+//
+// 移出有drop方法的变量时把它置为零值，离开作用域时drop的是零值，因此drop方法需要能够处理零值（参见 drop.go）。
+// 指针、引用、不定长数组和接口值没有所有权：它们只是借用，复制不会复制指向的值。
+
+// IsOwned 类型为typ的值是否有所有权，不能复制
+func IsOwned(typ *TypeReference) bool {
+	return isOwned(typ, nil)
+}
+
+func isOwned(typ *TypeReference, gcon *GenericContext) bool {
+	if typ == nil {
+		return false
+	}
+	// 只替换泛型参数本身：Replace 会原地修改结构体、元组和枚举的成员，不能用在类型的定义上
+	if sub, ok := typ.BaseType.(*SubstitutionType); ok {
+		for con := gcon; con != nil; con = con.Outer {
+			if arg, ok := con.submap[sub]; ok {
+				return isOwned(arg, con.Outer)
+			}
+		}
+		return false
+	}
+	if DropMethod(typ) != nil {
+		return true
+	}
+
+	switch t := typ.BaseType.(type) {
+	case *NamedType:
+		if _, ok := InterfaceOf(typ); ok {
+			return false
+		}
+		if st, ok := t.Type.(StructType); ok && st.Attrs().Contains("owned") {
+			return true
+		}
+		var inner *GenericContext
+		if len(typ.GenericArguments) > 0 && len(getTypeGenericParameters(t)) == len(typ.GenericArguments) {
+			// 实参中的泛型参数属于外层
+			inner = NewGenericContextFromTypeReference(typ)
+			inner.Outer = gcon
+		}
+		return isOwned(&TypeReference{BaseType: t.Type}, inner)
+
+	case StructType:
+		for _, mem := range t.Members {
+			if isOwned(mem.Type, gcon) {
+				return true
+			}
+		}
+
+	case TupleType:
+		for _, mem := range t.Members {
+			if isOwned(mem, gcon) {
+				return true
+			}
+		}
+
+	case EnumType:
+		for _, mem := range t.Members {
+			if isOwned(&TypeReference{BaseType: mem.Type}, gcon) {
+				return true
+			}
+		}
+
+	case ArrayType:
+		return t.IsFixedLength && isOwned(t.MemberType, gcon)
+	}
+	return false
+}
+
+// MovedVariable 位于移动的位置上的expr移出的变量，不是移动时返回nil
+func MovedVariable(expr Expr) *Variable {
+	vae, ok := expr.(*VariableAccessExpr)
+	if !ok || vae.Variable == nil || !IsOwned(vae.Variable.Type) {
+		return nil
+	}
+	return vae.Variable
+}
@@ -0,0 +1,330 @@
+package ast
+
+import (
+	"sort"
+	"strings"
+)
+
+// 函数重载
+//
+// 同一个作用域中可以声明多个同名的函数，只要它们的参数类型不同（参见 Resolver.checkOverloads）。
+// 不能重载main函数、C函数和方法。重载的函数的标识符记录所有的重载（Ident.Overloads），
+// 访问它的 FunctionAccessExpr 在类型推导中选定其中一个：
+//   - 处理调用时，如果由参数个数和已知的实参类型就能确定唯一的重载，直接选定，之后与普通的调用相同；
+//   - 否则先不约束函数的类型，在 Inferrer.Finalize 中先求解一次，由求出的实参类型选定重载，再重新求解。
+//     不是调用的访问（把函数作为值）由期望的函数类型选定。
+//
+// 参数个数相同（可变参数的函数不少于固定参数的个数），而且每个类型已知的实参与形参的类型相同的重载是可选的，
+// 数字常量可以传给任意数字类型的参数（浮点常量只能传给浮点类型）。有多个可选的重载时，
+// 选择实参与形参类型完全相同（数字常量按其默认类型）最多的一个，仍然无法区分时报告调用有歧义，并列出候选。
+// 结果只取决于实参，与声明的顺序无关。
+//
+// 函数的符号名包括参数类型（参见 Function.MangledName），重载的函数可以同时存在于目标文件中
+
+// overloadedAccess 还没有选定重载的函数访问。call为nil时函数作为值使用
+type overloadedAccess struct {
+	access *FunctionAccessExpr
+	call   *CallExpr
+}
+
+// overloadArg 选择重载时实参的类型：已知的类型、数字常量，或者未知（两者都为nil）
+type overloadArg struct {
+	typ     *TypeReference
+	literal *NumericLiteral
+}
+
+func (v overloadArg) String() string {
+	switch {
+	case v.literal != nil && v.literal.IsFloat:
+		return "float literal"
+	case v.literal != nil:
+		return "integer literal"
+	case v.typ != nil:
+		return v.typ.String()
+	default:
+		return "_"
+	}
+}
+
+// accepts 实参能否传给类型为param的形参，以及类型是否完全相同
+func (v overloadArg) accepts(param *TypeReference) (ok, exact bool) {
+	if len(substitutionTypes(param, nil)) > 0 {
+		return true, false
+	}
+
+	switch {
+	case v.literal != nil:
+		prim, isPrim := param.BaseType.ActualType().(PrimitiveType)
+		if !isPrim || !prim.IsFloatingType() && (v.literal.IsFloat || !prim.IsIntegerType()) {
+			return false, false
+		}
+		return true, Identical(v.literal.GetType(), param)
+
+	case v.typ != nil:
+		equal := Identical(v.typ, param)
+		return equal, equal
+
+	default:
+		return true, false
+	}
+}
+
+// overloadCandidate 候选的重载以及它的类型（已经代入显式给出的泛型实参）
+type overloadCandidate struct {
+	fn  *Function
+	typ FunctionType
+}
+
+// overloadCandidates 访问的所有候选。显式给出泛型实参时，只有泛型参数个数相同的重载是候选
+func overloadCandidates(access *FunctionAccessExpr) []overloadCandidate {
+	var res []overloadCandidate
+	for _, fn := range access.Overloads {
+		if len(access.GenericArguments) > 0 && len(access.GenericArguments) != len(fn.Type.GenericParameters) {
+			continue
+		}
+		fae := &FunctionAccessExpr{Function: fn, GenericArguments: access.GenericArguments}
+		res = append(res, overloadCandidate{fn: fn, typ: fae.GetType().BaseType.(FunctionType)})
+	}
+	return res
+}
+
+// selectOverload 返回可以接受实参的候选，以及其中实参与形参类型完全相同最多的候选
+func selectOverload(candidates []overloadCandidate, args []overloadArg) (matching, best []overloadCandidate) {
+	bestExact := -1
+	for _, cand := range candidates {
+		params := cand.typ.Parameters
+		if len(args) < len(params) || len(args) > len(params) && !cand.typ.IsVariadic {
+			continue
+		}
+
+		ok, exact := true, 0
+		for idx, param := range params {
+			argOk, argExact := args[idx].accepts(param)
+			if !argOk {
+				ok = false
+				break
+			}
+			if argExact {
+				exact++
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		matching = append(matching, cand)
+		switch {
+		case exact > bestExact:
+			best, bestExact = []overloadCandidate{cand}, exact
+		case exact == bestExact:
+			best = append(best, cand)
+		}
+	}
+	return
+}
+
+// chooseOverloadForCall 调用重载的函数时，由参数个数和已经知道的实参类型选择重载，
+// 无法确定时推迟到 Finalize 中求解之后
+func (v *Inferrer) chooseOverloadForCall(call *CallExpr, access *FunctionAccessExpr) {
+	args := make([]overloadArg, len(call.Arguments))
+	complete := true
+	for idx, arg := range call.Arguments {
+		args[idx] = knownOverloadArg(arg)
+		if args[idx].typ == nil && args[idx].literal == nil {
+			complete = false
+		}
+	}
+
+	candidates := overloadCandidates(access)
+	matching, best := selectOverload(candidates, args)
+	switch {
+	case len(matching) == 1:
+		v.setOverload(access, matching[0].fn)
+	case complete && len(best) == 1:
+		v.setOverload(access, best[0].fn)
+	case complete:
+		v.reportOverload(call, access, candidates, args, matching, best)
+	default:
+		v.overloads = append(v.overloads, &overloadedAccess{access: access, call: call})
+	}
+}
+
+// knownOverloadArg 处理实参之前已经知道的类型。泛型函数调用等表达式的类型中的泛型参数还没有代入，
+// 只有变量的类型可以包含泛型参数（所在的泛型函数的参数）
+func knownOverloadArg(arg Expr) overloadArg {
+	switch arg := arg.(type) {
+	case *NumericLiteral:
+		if arg.IsDuration {
+			return overloadArg{typ: DurationType()}
+		}
+		return overloadArg{literal: arg}
+	case *LambdaExpr:
+		return overloadArg{}
+	}
+
+	typ := arg.GetType()
+	if typ == nil || containsTypeVariable(typ) {
+		return overloadArg{}
+	}
+	if _, ok := arg.(*VariableAccessExpr); !ok && len(substitutionTypes(typ, nil)) > 0 {
+		return overloadArg{}
+	}
+	return overloadArg{typ: typ}
+}
+
+// reportOverload 无法选定重载时报错：没有可选的重载，或者有多个
+func (v *Inferrer) reportOverload(call *CallExpr, access *FunctionAccessExpr, candidates []overloadCandidate,
+	args []overloadArg, matching, best []overloadCandidate) {
+	if len(matching) == 0 {
+		argStrs := make([]string, len(args))
+		for idx, arg := range args {
+			argStrs[idx] = arg.String()
+		}
+		v.errPos(call.Pos(), "No overload of function `%s` accepts arguments (%s), candidates are:%s",
+			access.Function.Name, strings.Join(argStrs, ", "), candidateList(candidates))
+	}
+	v.errPos(call.Pos(), "Call to overloaded function `%s` is ambiguous, candidates are:%s",
+		access.Function.Name, candidateList(best))
+}
+
+// resolveOverloads 由求解的结果选定推迟的重载，并添加选定的函数的类型约束。之后需要重新求解
+func (v *Inferrer) resolveOverloads(substitutions []*Constraint) {
+	solved := make(map[int]Side)
+	for _, subs := range substitutions {
+		solved[subs.Left.Id] = subs.Right
+	}
+	for _, subs := range v.SimpleConstraints {
+		solved[subs.Left.Id] = subs.Right
+	}
+
+	for _, pending := range v.overloads {
+		access := pending.access
+		candidates := overloadCandidates(access)
+
+		if pending.call == nil {
+			v.resolveOverloadValue(access, candidates, solved)
+		} else {
+			args := make([]overloadArg, len(pending.call.Arguments))
+			for idx, arg := range pending.call.Arguments {
+				args[idx] = v.solvedOverloadArg(arg, solved)
+			}
+
+			matching, best := selectOverload(candidates, args)
+			if len(best) != 1 {
+				v.reportOverload(pending.call, access, candidates, args, matching, best)
+			}
+			v.setOverload(access, best[0].fn)
+		}
+
+		v.origin = typedOrigin(v.TypedLookup[access])
+		v.functionAccessConstraint(v.TypedLookup[access].Id, access)
+	}
+	v.overloads = nil
+}
+
+// solvedOverloadArg 由求解的结果得到实参的类型。类型只由数字常量决定时作为数字常量
+func (v *Inferrer) solvedOverloadArg(arg Expr, solved map[int]Side) overloadArg {
+	if known := knownOverloadArg(arg); known.typ != nil || known.literal != nil {
+		return known
+	}
+
+	ann, ok := v.TypedLookup[arg]
+	if !ok {
+		return overloadArg{}
+	}
+	side, ok := solved[ann.Id]
+	if !ok {
+		return overloadArg{}
+	}
+
+	if side.SideType == TypeSide {
+		if containsTypeVariable(side.Type) {
+			return overloadArg{}
+		}
+		return overloadArg{typ: side.Type}
+	}
+	if lit, ok := v.Typeds[side.Id].Typed.(*NumericLiteral); ok {
+		return overloadArg{literal: lit}
+	}
+	return overloadArg{}
+}
+
+// resolveOverloadValue 函数作为值使用时，由期望的函数类型选定重载
+func (v *Inferrer) resolveOverloadValue(access *FunctionAccessExpr, candidates []overloadCandidate, solved map[int]Side) {
+	side, ok := solved[v.TypedLookup[access].Id]
+	if !ok || side.SideType != TypeSide || containsTypeVariable(side.Type) {
+		v.errPos(access.Pos(), "Cannot decide which overload of function `%s` is used, annotate the expected function type, candidates are:%s",
+			access.Function.Name, candidateList(candidates))
+	}
+
+	expected, ok := side.Type.BaseType.ActualType().(FunctionType)
+	if ok {
+		for _, cand := range candidates {
+			if SameParameterTypes(cand.typ, expected) && Identical(functionReturn(cand.typ), functionReturn(expected)) {
+				v.setOverload(access, cand.fn)
+				return
+			}
+		}
+	}
+	v.errPos(access.Pos(), "No overload of function `%s` has type `%s`, candidates are:%s",
+		access.Function.Name, side.Type.String(), candidateList(candidates))
+}
+
+// setOverload 选定重载，之后访问与普通的函数访问相同
+func (v *Inferrer) setOverload(access *FunctionAccessExpr, fn *Function) {
+	access.Function = fn
+	access.Overloads = nil
+	fn.Accesses = append(fn.Accesses, access)
+}
+
+func functionReturn(typ FunctionType) *TypeReference {
+	if typ.Return == nil {
+		return &TypeReference{BaseType: PRIMITIVE_void}
+	}
+	return typ.Return
+}
+
+// SameParameterTypes 两个函数类型的参数类型是否相同
+func SameParameterTypes(a, b FunctionType) bool {
+	if len(a.Parameters) != len(b.Parameters) || a.IsVariadic != b.IsVariadic {
+		return false
+	}
+	for idx, par := range a.Parameters {
+		if !Identical(par, b.Parameters[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// OverloadSignature 在错误信息中表示一个重载，如 max<T>(T, T) T
+func OverloadSignature(fn *Function) string {
+	res := fn.Name + fn.Type.GenericParameters.String() + "("
+	for idx, par := range fn.Type.Parameters {
+		if idx > 0 {
+			res += ", "
+		}
+		res += par.String()
+	}
+	if fn.Type.IsVariadic {
+		if len(fn.Type.Parameters) > 0 {
+			res += ", "
+		}
+		res += "..."
+	}
+	res += ")"
+	if ret := fn.Type.Return; ret != nil && !ret.BaseType.IsVoidType() {
+		res += " " + ret.String()
+	}
+	return res
+}
+
+// candidateList 候选列表，每行一个，按签名排序
+func candidateList(candidates []overloadCandidate) string {
+	sigs := make([]string, len(candidates))
+	for idx, cand := range candidates {
+		sigs[idx] = OverloadSignature(cand.fn)
+	}
+	sort.Strings(sigs)
+	return "\n    " + strings.Join(sigs, "\n    ")
+}
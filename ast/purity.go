@@ -0,0 +1,217 @@
+package ast
+
+// 纯函数
+//
+// 纯函数只读写自己的局部变量和参数、读取不可修改的全局变量、调用其他纯函数，不修改调用者可见的内存。
+// 标注了 [pure] 的函数由语义检查保证满足这些要求（参见 semantic.PurityCheck）；
+// 没有标注的函数在第一次询问时推导：函数体满足同样的要求，调用的函数（包括局部变量和参数的drop方法）
+// 也都是纯函数时，函数是纯函数。没有函数体的函数（C函数、接口模块中的函数）和钩子（可以在链接时被替换）
+// 只有标注了才是纯函数。
+//
+// 推导时先收集从函数出发能调用到的所有需要推导的函数，假设它们都是纯函数，
+// 再反复去掉函数体不满足要求或者调用了非纯函数的函数，直到不再变化，所以互相递归的函数也能被推导为纯函数。
+// 结果记录在函数中，常量求值器（参见 ctfe.go）和代码生成使用它。推导需要类型，只能在类型推导之后进行。
+
+type purityState int
+
+const (
+	purityUnknown purityState = iota
+	purityPure
+	purityImpure
+)
+
+// IsPure 函数是否是纯函数：标注了 [pure]，或者推导出满足纯函数的要求
+func (v *Function) IsPure() bool {
+	if v.Type.Attrs().Contains("pure") {
+		return true
+	}
+	if v.purity == purityUnknown {
+		inferPurity(v)
+	}
+	return v.purity == purityPure
+}
+
+// inferPurity 推导fn以及它能调用到的所有还没有推导过的函数是否是纯函数
+func inferPurity(fn *Function) {
+	scanners := make(map[*Function]*purityScanner)
+	var collect func(fn *Function)
+	collect = func(fn *Function) {
+		if _, ok := scanners[fn]; ok || fn.purity != purityUnknown || fn.Type.Attrs().Contains("pure") {
+			return
+		}
+		scanner := scanPurity(fn)
+		scanners[fn] = scanner
+		for _, callee := range scanner.callees {
+			collect(callee)
+		}
+	}
+	collect(fn)
+
+	isPure := func(fn *Function) bool {
+		if scanner, ok := scanners[fn]; ok {
+			return !scanner.impure
+		}
+		return fn.IsPure()
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, scanner := range scanners {
+			if scanner.impure {
+				continue
+			}
+			for _, callee := range scanner.callees {
+				if !isPure(callee) {
+					scanner.impure = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	for fn, scanner := range scanners {
+		if scanner.impure {
+			fn.purity = purityImpure
+		} else {
+			fn.purity = purityPure
+		}
+	}
+}
+
+// scanPurity 检查函数体是否满足纯函数的要求，并找出它调用的函数
+func scanPurity(fn *Function) *purityScanner {
+	scanner := &purityScanner{locals: make(map[*Variable]bool)}
+	attrs := fn.Type.Attrs()
+	if fn.Body == nil || attrs.Contains("C") || attrs.Contains("hook") {
+		scanner.impure = true
+		return scanner
+	}
+
+	// 可修改的接收者是调用者的值，不算作局部变量
+	if fn.Receiver != nil && !fn.Receiver.Variable.Mutable {
+		scanner.locals[fn.Receiver.Variable] = true
+	}
+	for _, param := range fn.Parameters {
+		scanner.addLocal(param.Variable)
+	}
+	NewASTVisitor(scanner).VisitBlock(fn.Body)
+	return scanner
+}
+
+type purityScanner struct {
+	locals  map[*Variable]bool
+	callees []*Function
+	impure  bool
+}
+
+func (v *purityScanner) EnterScope()     {}
+func (v *purityScanner) ExitScope()      {}
+func (v *purityScanner) PostVisit(*Node) {}
+
+func (v *purityScanner) Visit(node *Node) bool {
+	if v.impure {
+		return false
+	}
+
+	switch n := (*node).(type) {
+	case *FunctionDecl, *LambdaExpr:
+		// 嵌套函数和匿名函数单独推导，只在调用时用到
+		return false
+
+	case *VariableDecl:
+		v.addLocal(n.Variable)
+
+	case *DestructVarDecl:
+		for _, vari := range n.Variables {
+			v.addLocal(vari)
+		}
+
+	case *AssignStat:
+		v.checkWrite(n.Access)
+
+	case *BinopAssignStat:
+		v.checkWrite(n.Access)
+
+	case *DestructAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(acc)
+		}
+
+	case *DestructBinopAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(acc)
+		}
+
+	case *VolatileStoreStat, *VolatileLoadExpr:
+		v.impure = true
+
+	case *VariableAccessExpr:
+		if n.Variable != nil && n.Variable.Mutable && !v.locals[n.Variable] {
+			v.impure = true
+		}
+
+	case *BinaryExpr:
+		// 约束中的方法实现的运算符，被调用的是接口的方法
+		if n.Method != nil {
+			v.impure = true
+		}
+
+	case *CallExpr:
+		if fae, ok := n.Function.(*FunctionAccessExpr); ok {
+			v.callees = append(v.callees, fae.Function)
+		} else {
+			v.impure = true
+		}
+	}
+	return !v.impure
+}
+
+// addLocal 记录局部变量，有drop方法时离开作用域会调用它
+func (v *purityScanner) addLocal(vari *Variable) {
+	v.locals[vari] = true
+	if drop := DropMethod(vari.Type); drop != nil {
+		v.callees = append(v.callees, drop)
+	}
+}
+
+func (v *purityScanner) checkWrite(access Expr) {
+	root, indirect := AccessRoot(access)
+	if indirect || root != nil && !v.locals[root] {
+		v.impure = true
+	}
+}
+
+// AccessRoot 返回访问表达式最终访问的变量，以及访问是否经过了指针或引用
+func AccessRoot(expr Expr) (root *Variable, indirect bool) {
+	switch n := expr.(type) {
+	case *VariableAccessExpr:
+		return n.Variable, false
+
+	case *StructAccessExpr:
+		// 通过指针或引用访问成员时会隐式解引用
+		root, indirect = AccessRoot(n.Struct)
+		switch n.Struct.GetType().BaseType.ActualType().(type) {
+		case PointerType, ReferenceType:
+			indirect = true
+		}
+		return root, indirect
+
+	case *ArrayAccessExpr:
+		// 指针和动态数组的元素不在变量自身的内存中
+		root, indirect = AccessRoot(n.Array)
+		switch typ := n.Array.GetType().BaseType.ActualType().(type) {
+		case PointerType, ReferenceType:
+			indirect = true
+		case ArrayType:
+			indirect = indirect || !typ.IsFixedLength
+		}
+		return root, indirect
+
+	case *DerefAccessExpr:
+		root, _ = AccessRoot(n.Expr)
+		return root, true
+	}
+
+	return nil, false
+}
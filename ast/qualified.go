@@ -0,0 +1,145 @@
+package ast
+
+// 限定名的解析
+//
+// 源码中的 a.b.c.d 在构建时都是 UnresolvedName，变量解析从左到右逐段解析，
+// 得到能够解析的最长前缀，其余的段是成员访问（StructAccessExpr），如 p.pos.x 中的 pos 和 x。
+//
+// 第一段按以下顺序查找：
+//  1. 当前作用域及外层作用域中的名字：局部变量、参数、泛型参数、文件私有的声明、模块中的声明、内建类型；
+//  2. 引入的模块：use a.b 引入的模块用最后一段 b 访问；
+//  3. 引入的模块的完整路径的第一段：use a.b 之后可以写 a.b.X，a 本身只是路径的一部分。
+//
+// 因此局部变量与引入的模块同名时，x.y 总是访问变量的成员。之后的每一段取决于前面解析得到的是什么：
+//   - 模块：先查找模块中的声明，再查找以它的路径为前缀的引入的模块，如 use a 和 use a.b 之后 a.b 是模块 a 中的 b，
+//     a 中没有 b 时才是模块 a.b；
+//   - 模块路径的一部分：路径更长的引入的模块；
+//   - 命名类型：类型的静态方法和静态成员，如 a.Vec.new()；
+//   - 变量和函数：不再解析，其余的段是成员访问。
+//
+// 枚举成员（a.Shape.Circle）在解析出枚举类型之后由 Resolver 处理。
+
+// resolveQualified 解析name能够解析的最长前缀，返回它的标识符和段数。
+// 没有能够解析的前缀时返回nil，段数是作为模块路径的一部分解析的段数，无法解析的名字是前段数+1段
+func (v *Resolver) resolveQualified(name UnresolvedName) (*Ident, int) {
+	parts := append(append([]string{}, name.ModuleNames...), name.Name)
+
+	ident := v.curScope.GetIdent(UnresolvedName{Name: parts[0]})
+	if ident == nil && v.curSubmod != nil {
+		ident = v.curSubmod.UseScope.GetIdent(UnresolvedName{Name: parts[0]})
+	}
+
+	if ident == nil && !v.isModulePathPrefix(parts[:1]) {
+		return nil, 0
+	}
+
+	used := 1
+	for ; used < len(parts); used++ {
+		if ident == nil {
+			// 前面的段是模块路径的一部分
+			if mod := v.usedModuleAt(parts[:used+1]); mod != nil {
+				ident = &Ident{IDENT_MODULE, mod, true, v.curScope, nil}
+			} else if !v.isModulePathPrefix(parts[:used+1]) {
+				return nil, used
+			}
+			continue
+		}
+
+		next := v.qualifiedMember(ident, parts[used])
+		if next == nil {
+			break
+		}
+		ident = next
+	}
+
+	if ident == nil {
+		return nil, used - 1
+	}
+	return ident, used
+}
+
+// qualifiedMember 解析 ident.part，ident之后不能再解析时返回nil
+func (v *Resolver) qualifiedMember(ident *Ident, part string) *Ident {
+	switch ident.Type {
+	case IDENT_MODULE:
+		mod := ident.Value.(*Module)
+		if member := mod.ModScope.Idents[part]; member != nil {
+			return member
+		}
+		path := append(append([]string{}, mod.Name.Parts...), part)
+		if sub := v.usedModuleAt(path); sub != nil {
+			return &Ident{IDENT_MODULE, sub, true, v.curScope, nil}
+		}
+
+	case IDENT_TYPE:
+		if named, ok := ident.Value.(*NamedType); ok {
+			if fn := named.GetStaticMethod(part); fn != nil {
+				return &Ident{IDENT_FUNCTION, fn, true, ident.Scope, nil}
+			}
+			if vari := named.GetStaticVariable(part); vari != nil {
+				return &Ident{IDENT_VARIABLE, vari, true, ident.Scope, nil}
+			}
+		}
+	}
+	return nil
+}
+
+// usedModuleAt 当前文件引入的路径为path的模块，没有时返回nil
+func (v *Resolver) usedModuleAt(path []string) *Module {
+	if v.curSubmod == nil {
+		return nil
+	}
+	for _, mod := range v.curSubmod.UseScope.UsedModules {
+		if stringsEqual(mod.Name.Parts, path) {
+			return mod
+		}
+	}
+	return nil
+}
+
+// isModulePathPrefix 当前文件是否引入了路径比path长、以path开头的模块
+func (v *Resolver) isModulePathPrefix(path []string) bool {
+	if v.curSubmod == nil {
+		return false
+	}
+	for _, mod := range v.curSubmod.UseScope.UsedModules {
+		if len(mod.Name.Parts) > len(path) && stringsEqual(mod.Name.Parts[:len(path)], path) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// qualifiedPrefix name的前n段
+func qualifiedPrefix(name UnresolvedName, n int) UnresolvedName {
+	parts := append(append([]string{}, name.ModuleNames...), name.Name)
+	return UnresolvedName{ModuleNames: parts[:n-1], Name: parts[n-1]}
+}
+
+// qualifiedMembers name在前n段之后的段
+func qualifiedMembers(name UnresolvedName, n int) []string {
+	parts := append(append([]string{}, name.ModuleNames...), name.Name)
+	return parts[n:]
+}
+
+// memberAccesses 在expr外依次加上对members的成员访问
+func memberAccesses(expr AccessExpr, members []string, fn *Function) AccessExpr {
+	for _, member := range members {
+		sae := &StructAccessExpr{Member: member, Struct: expr, ParentFunction: fn}
+		sae.SetPos(expr.Pos())
+		expr = sae
+	}
+	return expr
+}
@@ -2,9 +2,11 @@ package ast
 
 import (
 	"fmt"
-	"os"
+	"math"
 	"reflect"
+	"sort"
 
+	"github.com/ku-lang/ku/parser"
 	"github.com/ku-lang/ku/util"
 	"github.com/ku-lang/ku/util/log"
 )
@@ -41,6 +43,21 @@ type Resolver struct {
 	curSubmod     *Submodule
 	functionStack []*Function
 	curScope      *Scope
+	arrayLengths  []*pendingArrayLength
+	errors        int             // 报告的错误数，参见 err
+	reported      map[string]bool // 报告过的错误。方法调用的接收者会访问两次，同样的错误只报告一次
+
+	nestedFunctions map[*Function][]*Function // 每个函数中声明的嵌套函数，参见 resolveNestedFunction
+}
+
+// MaxErrors 变量解析最多报告的错误数，达到后停止编译。为0时不限制
+var MaxErrors = 20
+
+// pendingArrayLength 长度还没有求值的数组类型，ref或named的类型是这个数组
+type pendingArrayLength struct {
+	ref    *TypeReference
+	named  *NamedType
+	submod *Submodule
 }
 
 func (v *Resolver) pushFunction(fn *Function) {
@@ -87,7 +104,15 @@ func Resolve(mod *Module, mods *ModuleLookup) {
 	log.Timed("resolving module", mod.Name.String(), func() {
 		res.ResolveTopLevelDecls()
 		res.ResolveDescent()
+		// 数组长度的常量表达式可能用到没有解析的名字，有错误时不再求值
+		if res.errors == 0 {
+			res.evalArrayLengths()
+		}
+		res.checkOverloads()
 	})
+	if res.errors > 0 {
+		util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
+	}
 	res.module.ModScope.Dump(0)
 }
 
@@ -115,13 +140,30 @@ func (v *Resolver) ResolveUsedModules() {
 	}
 }
 
+// ResolveTopLevelDecls 把顶层声明加入作用域。用priv声明的类型、函数和变量只在声明所在的文件中可见，
+// 加入文件的作用域（Submodule.FileScope），它位于模块作用域与函数作用域之间。
+// 文件私有的声明仍然与模块中其他文件的声明共用名字，不能重名
 func (v *Resolver) ResolveTopLevelDecls() {
-	modScope := v.module.ModScope
-
 	var staticFuncList []*FunctionDecl
+	var staticFuncSubmods []*Submodule
 
 	for _, submod := range v.module.Parts {
+		submod.FileScope = newScope(v.module.ModScope, v.module, nil)
+	}
+
+	for _, submod := range v.module.Parts {
+		v.curSubmod = submod
 		for _, node := range submod.Nodes {
+			decl, ok := node.(Decl)
+			if !ok {
+				continue
+			}
+			modScope := v.module.ModScope
+			if decl.IsFilePrivate() {
+				v.checkFilePrivateDecl(decl)
+				modScope = submod.FileScope
+			}
+
 			switch node := node.(type) {
 			// TODO: We might need to do more that just insert this into the
 			// scope at the current point.
@@ -130,25 +172,45 @@ func (v *Resolver) ResolveTopLevelDecls() {
 					v.err(node, "Illegal redeclaration of type `%s`", node.NamedType.Name)
 				}
 
+			case *TypeAliasDecl:
+				if modScope.InsertTypeAlias(node.Alias, node.IsPublic()) != nil {
+					v.err(node, "Illegal redeclaration of type `%s`", node.Alias.Name)
+				}
+
 			case *FunctionDecl:
 				if node.Function.Receiver == nil {
 					if node.Function.StaticReceiverType == nil {
-						scope := v.curScope
+						scope := modScope
 						if node.Function.Type.Attrs().Contains("C") {
 							scope = v.cModule.ModScope
 							node.SetPublic(true)
 						}
 
-						if scope.InsertFunction(node.Function, node.IsPublic()) != nil {
+						if existing := scope.Idents[node.Function.Name]; scope != v.cModule.ModScope &&
+							existing != nil && existing.Type == IDENT_FUNCTION {
+							v.addOverload(scope, existing, node)
+						} else if scope.InsertFunction(node.Function, node.IsPublic()) != nil {
 							v.err(node, "Illegal redeclaration of function `%s`", node.Function.Name)
 						}
 					} else {
 						staticFuncList = append(staticFuncList, node)
+						staticFuncSubmods = append(staticFuncSubmods, submod)
 					}
 				}
 
 			case *VariableDecl:
-				if modScope.InsertVariable(node.Variable, node.IsPublic()) != nil {
+				if named := node.Variable.StaticReceiverType; named != nil {
+					if named.GetStaticVariable(node.Variable.Name) != nil {
+						v.err(node, "Illegal redeclaration of static member `%s.%s`", named.Name, node.Variable.Name)
+					}
+					named.addStaticVariable(node.Variable)
+				} else if node.Variable.Attrs.Contains("C") {
+					// C的全局变量与C函数一样属于C模块，如 C.errno
+					node.SetPublic(true)
+					if v.cModule.ModScope.InsertVariable(node.Variable, true) != nil {
+						v.err(node, "Illegal redeclaration of C variable `%s`", node.Variable.Name)
+					}
+				} else if modScope.InsertVariable(node.Variable, node.IsPublic()) != nil {
 					v.err(node, "Illegal redeclaration of variable `%s`", node.Variable.Name)
 				}
 
@@ -157,68 +219,244 @@ func (v *Resolver) ResolveTopLevelDecls() {
 			}
 		}
 	}
+	v.checkFilePrivateNames()
 
-	for _, node := range staticFuncList {
+	for idx, node := range staticFuncList {
+		// 静态方法的类型可以是文件私有的类型
+		v.curSubmod, v.curScope = staticFuncSubmods[idx], staticFuncSubmods[idx].FileScope
 		node.Function.StaticReceiverType = v.ResolveType(node, node.Function.StaticReceiverType)
 		if checkReceiverType(v, node, &TypeReference{BaseType: node.Function.StaticReceiverType}, "static receiver") {
-			node.Function.StaticReceiverType.(*NamedType).addStaticMethod(node.Function)
+			named := node.Function.StaticReceiverType.(*NamedType)
+			if params, want := node.Function.StaticTypeParameters, declaredTypeParameters(named); len(params) > 0 && len(params) != len(want) {
+				v.err(node, "Static method `%s.%s` declares %d type parameters for type `%s`, which has %d",
+					named.Name, node.Function.Name, len(params), named.Name, len(want))
+			}
+			if named.GetStaticVariable(node.Function.Name) != nil {
+				v.err(node, "Illegal redeclaration of static member `%s.%s`", named.Name, node.Function.Name)
+			}
+			// 枚举的静态方法不能与成员同名，Shape.Circle(1) 总是构造枚举值
+			if et, ok := named.Type.(EnumType); ok {
+				if _, isMember := et.GetMember(node.Function.Name); isMember {
+					v.err(node, "Static method `%s` of enum `%s` has the same name as a member", node.Function.Name, named.Name)
+				}
+			}
+			named.addStaticMethod(node.Function)
 		}
 	}
+	v.curSubmod, v.curScope = nil, v.module.ModScope
+}
+
+// checkFilePrivateDecl 只有顶层的类型、函数和变量可以是文件私有的：方法和静态成员通过类型访问，C函数属于C模块
+func (v *Resolver) checkFilePrivateDecl(decl Decl) {
+	switch decl := decl.(type) {
+	case *FunctionDecl:
+		if decl.Function.Receiver != nil || decl.Function.StaticReceiverType != nil {
+			v.err(decl, "Method `%s` can't be file-private, `priv` only applies to top-level types, functions and variables", decl.Function.Name)
+		}
+		if decl.Function.Type.Attrs().Contains("C") {
+			v.err(decl, "C function `%s` can't be file-private", decl.Function.Name)
+		}
+
+	case *VariableDecl:
+		if decl.Variable.StaticReceiverType != nil {
+			v.err(decl, "Static member `%s` can't be file-private, `priv` only applies to top-level types, functions and variables", decl.Variable.Name)
+		}
+		if decl.Variable.Attrs.Contains("C") {
+			v.err(decl, "C variable `%s` can't be file-private", decl.Variable.Name)
+		}
+	}
+}
+
+// checkFilePrivateNames 文件私有的声明不能与模块作用域中的声明或者其他文件中的文件私有声明重名。按文件名的顺序检查
+func (v *Resolver) checkFilePrivateNames() {
+	var names []string
+	for name := range v.module.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	declaredIn := make(map[string]*Submodule)
+	for _, name := range names {
+		v.curSubmod = v.module.Parts[name]
+		for _, node := range v.curSubmod.Nodes {
+			decl, ok := node.(Decl)
+			if !ok || !decl.IsFilePrivate() {
+				continue
+			}
+
+			var declName string
+			switch decl := decl.(type) {
+			case *TypeDecl:
+				declName = decl.NamedType.Name
+			case *TypeAliasDecl:
+				declName = decl.Alias.Name
+			case *FunctionDecl:
+				declName = decl.Function.Name
+			case *VariableDecl:
+				declName = decl.Variable.Name
+			default:
+				continue
+			}
+
+			if other := declaredIn[declName]; v.module.ModScope.Idents[declName] != nil || (other != nil && other != v.curSubmod) {
+				v.err(decl, "Illegal redeclaration of `%s`, file-private declarations can't share names with other declarations of the module", declName)
+			}
+			declaredIn[declName] = v.curSubmod
+		}
+	}
+	v.curSubmod = nil
+}
+
+// hasStaticMember 类型名.name 是否是静态方法或静态成员。枚举的静态方法与其他类型相同，不是枚举值
+func hasStaticMember(typ Type, name string) bool {
+	named, ok := typ.(*NamedType)
+	return ok && (named.GetStaticMethod(name) != nil || named.GetStaticVariable(name) != nil)
+}
+
+// resolveNestedFunction 函数体中声明的函数：加入所在代码块的作用域，声明之后的代码和它自己可以调用它。
+// 嵌套函数不能捕获外层函数的局部变量（参见 VariableAccessExpr 的解析），只在外层函数中可见，编译为内部符号，
+// 符号名中包含外层函数，参见 Function.MangledName
+func (v *Resolver) resolveNestedFunction(n *FunctionDecl, outer *Function) {
+	fn := n.Function
+	switch {
+	case fn.Receiver != nil || fn.StaticReceiverType != nil:
+		v.err(n, "Method `%s` must be declared at the top level", fn.Name)
+	case fn.Type.Attrs().Contains("C"):
+		v.err(n, "C function `%s` must be declared at the top level", fn.Name)
+	case outer.Anonymous:
+		v.err(n, "Function `%s` can't be declared inside a lambda", fn.Name)
+	case len(outer.Type.GenericParameters) > 0:
+		v.err(n, "Function `%s` can't be declared inside generic function `%s`", fn.Name, outer.Name)
+	}
+
+	// 同一个外层函数中的嵌套函数的符号名只由名字和签名区分，不同代码块中也不能重名
+	for _, other := range v.nestedFunctions[outer] {
+		if other.Name == fn.Name {
+			v.err(n, "Nested function `%s` is already declared in `%s`", fn.Name, outer.Name)
+		}
+	}
+	if v.nestedFunctions == nil {
+		v.nestedFunctions = make(map[*Function][]*Function)
+	}
+	v.nestedFunctions[outer] = append(v.nestedFunctions[outer], fn)
+
+	fn.Outer = outer
+	if v.curScope.InsertFunction(fn, false) != nil {
+		v.err(n, "Illegal redeclaration of function `%s`", fn.Name)
+	}
+}
+
+// addOverload 同名的函数作为重载。参数类型是否重复要在解析完函数签名之后检查，参见 checkOverloads
+func (v *Resolver) addOverload(scope *Scope, ident *Ident, decl *FunctionDecl) {
+	if decl.Function.Name == "main" {
+		v.err(decl, "Function `main` cannot be overloaded")
+	}
+	if ident.Public != decl.IsPublic() {
+		v.err(decl, "Overloads of function `%s` must be either all public or all private", decl.Function.Name)
+	}
+	scope.AddOverload(ident, decl.Function)
+}
+
+// checkOverloads 检查重载的函数的参数类型各不相同。按文件名的顺序检查，报告后声明的一个
+func (v *Resolver) checkOverloads() {
+	var names []string
+	for name := range v.module.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	declared := make(map[string][]*Function)
+	for _, name := range names {
+		v.curSubmod = v.module.Parts[name]
+		for _, node := range v.curSubmod.Nodes {
+			decl, ok := node.(*FunctionDecl)
+			if !ok || decl.Function.Receiver != nil || decl.Function.StaticReceiverType != nil ||
+				decl.Function.Type.Attrs().Contains("C") {
+				continue
+			}
+
+			fn := decl.Function
+			for _, other := range declared[fn.Name] {
+				if SameParameterTypes(fn.Type, other.Type) {
+					v.err(decl, "Illegal redeclaration of function `%s` with the same parameter types as `%s`",
+						fn.Name, OverloadSignature(other))
+				}
+			}
+			declared[fn.Name] = append(declared[fn.Name], fn)
+		}
+	}
+	v.curSubmod = nil
 }
 
 func (v *Resolver) ResolveDescent() {
 	vis := NewASTVisitor(v)
 	for _, submod := range v.module.Parts {
-		v.curSubmod = submod
+		v.curSubmod, v.curScope = submod, submod.FileScope
 		vis.VisitSubmodule(submod)
 	}
+	v.curSubmod, v.curScope = nil, v.module.ModScope
 }
 
+// err 报告错误后继续解析，调用者用 ErrorType 等占位代替没有解析的部分。
+// 模块解析完成后有错误时停止编译，报告的错误达到 MaxErrors 时立即停止
 func (v *Resolver) err(thing Locatable, err string, stuff ...interface{}) {
 	pos := thing.Pos()
 
-	log.Error("resolve", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
-		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(err, stuff...))
+	msg := fmt.Sprintf(err, stuff...)
+	key := fmt.Sprintf("%s:%d:%d %s", pos.Filename, pos.Line, pos.Char, msg)
+	if v.reported[key] {
+		return
+	}
+	if v.reported == nil {
+		v.reported = make(map[string]bool)
+	}
+	v.reported[key] = true
+
+	log.Error(log.TagResolve, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
+		pos.Filename, pos.Line, pos.Char, msg)
 
 	if v.curSubmod != nil {
-		log.Error("resolve", v.curSubmod.File.MarkPos(pos))
+		log.Error(log.TagResolve, v.curSubmod.File.MarkPos(pos))
 	}
 
-	os.Exit(util.EXIT_FAILURE_SEMANTIC)
+	v.errors++
+	if MaxErrors > 0 && v.errors >= MaxErrors {
+		log.Error(log.TagResolve, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" too many errors, stopping after %d (see --max-errors)\n", v.errors)
+		util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
+	}
 }
 
-func (v *Resolver) tryGetIdent(loc Locatable, name UnresolvedName) *Ident {
-	// TODO: Decide whether we should actually allow shadowing a module
-	//fmt.Printf("[CurScope]:%#v\n", v.curScope)
-	ident := v.curScope.GetIdent(name)
-	if ident == nil {
-		ident = v.curSubmod.UseScope.GetIdent(name)
+// lookupIdent 解析整个限定名，参见 qualified.go。有不能解析的段时返回nil
+func (v *Resolver) lookupIdent(name UnresolvedName) *Ident {
+	ident, used := v.resolveQualified(name)
+	if ident == nil || used != len(name.ModuleNames)+1 {
+		return nil
 	}
+	return ident
+}
+
+func (v *Resolver) tryGetIdent(loc Locatable, name UnresolvedName) *Ident {
+	ident := v.lookupIdent(name)
 
 	if ident == nil {
-		log.Debugln("resolve", "Cannot resolve `%s`", name.String())
+		log.Debugln(log.TagResolve, "Cannot resolve `%s`", name.String())
 		return nil
 	}
 
 	if !ident.Public && ident.Scope.Module != v.module {
-		log.Debugln("resolve", "Cannot access private identifier `%s`", name)
+		log.Debugln(log.TagResolve, "Cannot access private identifier `%s`", name)
 	}
 
 	// make sure lambda can't access variables of enclosing function
 	if ident.Scope.Function != nil && v.currentFunction() != ident.Scope.Function {
-		log.Debugln("resolve", "Cannot access local identifier `%s` from lambda", name)
+		log.Debugln(log.TagResolve, "Cannot access local identifier `%s` from lambda", name)
 	}
 
 	return ident
 }
 
 func (v *Resolver) getIdent(loc Locatable, name UnresolvedName) *Ident {
-	// TODO: Decide whether we should actually allow shadowing a module
-	//fmt.Printf("[CurScope]:%#v\n", v.curScope)
-	ident := v.curScope.GetIdent(name)
-	if ident == nil {
-		ident = v.curSubmod.UseScope.GetIdent(name)
-	}
+	ident := v.lookupIdent(name)
 
 	if ident == nil {
 		v.err(loc, "Cannot resolve `%s`", name.String())
@@ -257,7 +495,34 @@ func (v *Resolver) PostVisit(node *Node) {
 
 	case *LambdaExpr:
 		v.popFunction()
+
+	case *FloatBuiltinExpr:
+		// 参数是常量时直接折叠成bool常量。参数中的 nan 和 inf 这时才解析成常量
+		if lit := foldFloatBuiltin(n); lit != nil {
+			*node = lit
+		}
+	}
+}
+
+func foldFloatBuiltin(n *FloatBuiltinExpr) *BoolLiteral {
+	numlit, ok := n.Arguments[0].(*NumericLiteral)
+	if !ok || !numlit.IsFloat {
+		return nil
+	}
+
+	var value bool
+	switch n.Builtin {
+	case parser.FLOAT_BUILTIN_IS_NAN:
+		value = math.IsNaN(numlit.FloatValue)
+	case parser.FLOAT_BUILTIN_IS_INF:
+		value = math.IsInf(numlit.FloatValue, 0)
+	default:
+		return nil
 	}
+
+	lit := &BoolLiteral{Value: value}
+	lit.SetPos(n.Pos())
+	return lit
 }
 
 func (v *Resolver) EnterScope() {
@@ -271,6 +536,100 @@ func (v *Resolver) ExitScope() {
 	v.curScope = v.curScope.Outer
 }
 
+// resolveGenericStaticCall 解析 List<int>.make 形式的静态方法访问：类型的泛型实参是静态方法的前几个泛型实参，
+// 参见 Function.StaticTypeParameters。之后的类型推导、名字修饰和代码生成与显式给出泛型实参的函数调用 make<int>() 相同。
+// 不是这种形式时matched为false；报告了错误时返回nil
+func (v *Resolver) resolveGenericStaticCall(sae *StructAccessExpr) (fae *FunctionAccessExpr, matched bool) {
+	vae, ok := sae.Struct.(*VariableAccessExpr)
+	if !ok || len(vae.GenericArguments) == 0 {
+		return nil, false
+	}
+	ident, used := v.resolveQualified(vae.Name)
+	if ident == nil || ident.Type != IDENT_TYPE || used != len(vae.Name.ModuleNames)+1 {
+		return nil, false
+	}
+	named, ok := ident.Value.(*NamedType)
+	if !ok {
+		return nil, false
+	}
+
+	fn := named.GetStaticMethod(sae.Member)
+	if fn == nil {
+		v.err(sae, "Type `%s` has no static method `%s`", vae.Name, sae.Member)
+		return nil, true
+	}
+	if len(fn.StaticTypeParameters) == 0 {
+		v.err(sae, "Static method `%s.%s` doesn't take the type arguments of `%s`, declare it as `fun static %s<...>.%s`",
+			vae.Name, fn.Name, vae.Name, named.Name, fn.Name)
+		return nil, true
+	}
+	if len(vae.GenericArguments) != len(fn.StaticTypeParameters) {
+		v.err(sae, "Type `%s` expects %d type arguments, found %d", vae.Name, len(fn.StaticTypeParameters), len(vae.GenericArguments))
+		return nil, true
+	}
+	if len(fn.Type.GenericParameters) != len(fn.StaticTypeParameters) {
+		v.err(sae, "Static method `%s.%s` has type parameters of its own, which can't be given together with the type arguments of `%s`",
+			vae.Name, fn.Name, vae.Name)
+		return nil, true
+	}
+
+	fae = &FunctionAccessExpr{
+		Function:         fn,
+		GenericArguments: v.ResolveTypeReferences(vae, vae.GenericArguments),
+		ParentFunction:   v.currentFunction(),
+	}
+	fae.SetPos(sae.Pos())
+	fn.Accesses = append(fn.Accesses, fae)
+	return fae, true
+}
+
+// resolveConstructorCall 构造方法的约定：new Vec(1, 2) 调用类型的静态方法new，即 new Vec.new(1, 2)，
+// 泛型类型写成 new List<int>(10)。类型没有静态方法new时是类型转换，只能有一个实参
+func (v *Resolver) resolveConstructorCall(n *NewExpr) {
+	call, ok := n.Expr.(*CallExpr)
+	if !ok {
+		return
+	}
+	vae, ok := call.Function.(*VariableAccessExpr)
+	if !ok {
+		return
+	}
+	ident, used := v.resolveQualified(vae.Name)
+	if ident == nil || ident.Type != IDENT_TYPE || used != len(vae.Name.ModuleNames)+1 {
+		return
+	}
+	named, ok := ident.Value.(*NamedType)
+	if !ok {
+		return
+	}
+
+	if named.GetStaticMethod(parser.KEYWORD_NEW) == nil {
+		if len(call.Arguments) != 1 {
+			v.err(n, "Type `%s` has no static method `new`, use a composite literal like `new %s{...}`", vae.Name, vae.Name)
+			// 不再作为类型转换报告错误
+			call.Function = nil
+		}
+		return
+	}
+
+	if len(vae.GenericArguments) > 0 {
+		sae := &StructAccessExpr{Struct: vae, Member: parser.KEYWORD_NEW, ParentFunction: v.currentFunction()}
+		sae.SetPos(vae.Pos())
+		call.Function = sae
+	} else {
+		vae.Name = UnresolvedName{ModuleNames: append(append([]string{}, vae.Name.ModuleNames...), vae.Name.Name), Name: parser.KEYWORD_NEW}
+	}
+}
+
+// declaredTypeParameters 类型声明中的泛型参数。此时类型可能还没有解析，只看声明的结构体、枚举和接口
+func declaredTypeParameters(named *NamedType) GenericSigil {
+	switch typ := named.Type.(type) {
+	case StructType, EnumType, InterfaceType, *InterfaceType:
+		return getTypeGenericParameters(typ)
+	}
+	return nil
+}
+
 // returns true if no error
 func checkReceiverType(res *Resolver, loc Locatable, t *TypeReference, purpose string) bool {
 	if named, ok := TypeReferenceWithoutPointers(t).BaseType.(*NamedType); ok {
@@ -279,6 +638,9 @@ func checkReceiverType(res *Resolver, loc Locatable, t *TypeReference, purpose s
 				t.String(), named.ParentModule.Name, purpose)
 			return false
 		}
+	} else if _, ok := TypeReferenceWithoutPointers(t).BaseType.(ErrorType); ok {
+		// 已经报告过无法解析
+		return false
 	} else {
 		res.err(loc, "Expected named type for %s, found `%s`", purpose, t.String())
 		return false
@@ -293,10 +655,21 @@ func (v *Resolver) ResolveNode(node *Node) {
 		// resolved when they are used, as the type parameters can only be
 		// resolved when we know what they are.
 		n.NamedType.Type = v.ResolveType(n, n.NamedType.Type)
+		if arr, ok := n.NamedType.Type.(ArrayType); ok && arr.LengthExpr != nil {
+			v.arrayLengths = append(v.arrayLengths, &pendingArrayLength{named: n.NamedType, submod: v.curSubmod})
+		}
+
+	case *TypeAliasDecl:
+		v.resolveTypeAlias(n, n.Alias)
 
 	case *FunctionDecl:
-		v.EnterScope()
+		if outer := v.currentFunction(); outer != nil {
+			v.resolveNestedFunction(n, outer)
+		}
+
+		// 参数所在的作用域属于这个函数，嵌套函数和lambda不能访问它们
 		v.pushFunction(n.Function)
+		v.EnterScope()
 
 		// 将this变量插入到当前scope中
 		if n.Function.Receiver != nil {
@@ -312,12 +685,22 @@ func (v *Resolver) ResolveNode(node *Node) {
 		}
 
 		n.Function.Type = v.ResolveType(n, n.Function.Type).(FunctionType)
+		shareParameterTypes(n.Function)
+		inheritReceiverConstraints(n.Function)
 
 	case *VariableDecl:
 		if n.Variable.Type != nil {
 			n.Variable.Type = v.ResolveTypeReference(n, n.Variable.Type)
 		}
-		if v.curScope.InsertVariable(n.Variable, n.IsPublic()) != nil {
+		// C变量只能是全局变量，已经加入了C模块
+		if n.Variable.Attrs.Contains("C") {
+			if n.Variable.StaticReceiverType != nil || v.currentFunction() != nil {
+				v.err(n, "C variable `%s` must be declared at the top level", n.Variable.Name)
+			}
+			break
+		}
+		// 静态成员只能通过类型名访问，不在作用域中
+		if n.Variable.StaticReceiverType == nil && v.curScope.InsertVariable(n.Variable, n.IsPublic()) != nil {
 			v.err(n, "Illegal redeclaration of variable `%s`", n.Variable.Name)
 		}
 
@@ -338,6 +721,9 @@ func (v *Resolver) ResolveNode(node *Node) {
 	case *CastExpr:
 		n.Type = v.ResolveTypeReference(n, n.Type)
 
+	case *BitcastExpr:
+		n.Type = v.ResolveTypeReference(n, n.Type)
+
 	case *ArrayLenExpr:
 		if n.Type != nil {
 			n.Type = v.ResolveType(n, n.Type)
@@ -356,7 +742,7 @@ func (v *Resolver) ResolveNode(node *Node) {
 			ident := v.tryGetIdent(n, enumName)
 			if ident != nil && ident.Type == IDENT_TYPE {
 				itype := ident.Value.(Type)
-				if etype, ok := itype.ActualType().(EnumType); ok {
+				if etype, ok := itype.ActualType().(EnumType); ok && !hasStaticMember(itype, memberName) {
 					if _, ok := etype.GetMember(memberName); !ok {
 						v.err(n, "No such member in enum `%s`: `%s`", itype.TypeName(), memberName)
 						break
@@ -379,69 +765,71 @@ func (v *Resolver) ResolveNode(node *Node) {
 			}
 		}
 
-		var memberName string
-		//fmt.Printf("[try name 1]: %#v\n", n.Name)
-
-		ident := v.tryGetIdent(n, n.Name)
-		var wrap *StructAccessExpr
-		//fmt.Printf("[try name]: %#v\n", n.Name)
-		for ident == nil && len(n.Name.ModuleNames) > 0 {
-			log.Debugln("resolve", "trying to resolve VariableAccessNode as StructAccessNode: %#v", n)
-			// 如果名字获取不到，说明有可能实际是StructAccess，尝试向前移动一个词，重新检验
-			var parentName UnresolvedName
-			parentName, memberName = n.Name.Split()
-			n.Name = parentName
-			log.Debugln("resolve", "new name: %#v; member: %#v", parentName, memberName)
-			ident = v.tryGetIdent(n, parentName)
-			log.Debugln("resolve", "ident: %#v", ident)
-
-			sae := &StructAccessExpr{
-				Member:         memberName,
-				Struct:         n,
-				ParentFunction: v.currentFunction(),
-			}
-			if wrap == nil {
-				wrap = sae
-			} else {
-				wrap.Struct = sae
-			}
-
-		}
-		if wrap != nil {
-			*node = wrap
-			(*node).SetPos(n.Pos())
-		}
-		log.Debugln("resolve", "VariableAccessExpr:%#v", *node)
-
+		// 能够解析的最长前缀之后的段是成员访问，参见 qualified.go
+		ident, used := v.resolveQualified(n.Name)
 		if ident == nil {
-			v.err(n, "Cannot resolve ident `%s`", n.Name.String())
+			if lit := floatSpecialLiteral(n.Name); lit != nil {
+				lit.SetPos(n.Pos())
+				*node = lit
+				break
+			}
+			v.err(n, "Cannot resolve ident `%s`", qualifiedPrefix(n.Name, used+1).String())
+			break
 		}
+		members := qualifiedMembers(n.Name, used)
+		n.Name = qualifiedPrefix(n.Name, used)
 
 		if ident.Type == IDENT_FUNCTION {
+			if len(members) > 0 {
+				v.err(n, "Function `%s` has no member `%s`", n.Name, members[0])
+				break
+			}
 			fan := &FunctionAccessExpr{
 				Function:         ident.Value.(*Function),
+				Overloads:        ident.Overloads,
 				GenericArguments: v.ResolveTypeReferences(n, n.GenericArguments),
 				ParentFunction:   v.currentFunction(),
 			}
-			fan.Function.Accesses = append(fan.Function.Accesses, fan)
+			// 重载的函数在类型推导中选定之后才记录访问
+			if fan.Overloads == nil {
+				fan.Function.Accesses = append(fan.Function.Accesses, fan)
+			}
 			*node = fan
 			(*node).SetPos(n.Pos())
 			break
 		} else if ident.Type == IDENT_VARIABLE {
 			n.Variable = ident.Value.(*Variable)
+
+			// 嵌套函数不捕获外层函数的局部变量
+			if fn := v.currentFunction(); fn != nil && fn.Outer != nil && ident.Scope.Function != nil && ident.Scope.Function != fn {
+				v.err(n, "Nested function `%s` can't access local variable `%s` of `%s`, pass it as a parameter",
+					fn.Name, n.Variable.Name, ident.Scope.Function.Name)
+			}
+		} else if len(members) > 0 && ident.Type == IDENT_MODULE {
+			v.err(n, "Module `%s` has no member `%s`", n.Name, members[0])
+			break
+		} else if len(members) > 0 {
+			v.err(n, "Type `%s` has no static member `%s`", n.Name, members[0])
+			break
 		} else {
 			v.err(n, "Expected variable identifier, found %s `%s`", ident.Type, n.Name)
+			break
 		}
 
-		if n.Variable != nil && n.Variable.Type != nil {
+		if n.Variable.Type != nil {
 			n.Variable.Type = v.ResolveTypeReference(n, n.Variable.Type)
 		}
 
+		if len(members) > 0 {
+			*node = memberAccesses(n, members, v.currentFunction())
+		}
+		log.Debugln(log.TagResolve, "VariableAccessExpr:%#v", *node)
+
 	case *SizeofExpr:
 		if n.Expr != nil {
 			if typ, ok := v.exprToType(n.Expr); ok {
 				n.Expr = nil
-				n.Type = &TypeReference{BaseType: typ}
+				n.Type = typ
 			}
 		}
 
@@ -449,6 +837,23 @@ func (v *Resolver) ResolveNode(node *Node) {
 			n.Type = v.ResolveTypeReference(n, n.Type)
 		}
 
+	case *AlignofExpr:
+		if n.Expr != nil {
+			if typ, ok := v.exprToType(n.Expr); ok {
+				n.Expr = nil
+				n.Type = typ
+			}
+		}
+
+		if n.Type != nil {
+			n.Type = v.ResolveTypeReference(n, n.Type)
+		}
+
+	case *OffsetofExpr:
+		if n.Type != nil {
+			n.Type = v.ResolveTypeReference(n, n.Type)
+		}
+
 	case *CompositeLiteral:
 		if n.Type == nil {
 			break
@@ -459,8 +864,8 @@ func (v *Resolver) ResolveNode(node *Node) {
 		if name, ok := n.Type.BaseType.(UnresolvedType); ok {
 			enumName, memberName := name.Name.Split()
 			if memberName != "" {
-				ident := v.getIdent(n, enumName)
-				if ident.Type == IDENT_TYPE {
+				ident := v.tryGetIdent(n, enumName)
+				if ident != nil && ident.Type == IDENT_TYPE {
 					itype := ident.Value.(Type)
 					if _, ok := itype.ActualType().(EnumType); ok {
 						et := v.ResolveTypeReference(n, &TypeReference{
@@ -473,6 +878,7 @@ func (v *Resolver) ResolveNode(node *Node) {
 						member, ok := et.BaseType.ActualType().(EnumType).GetMember(memberName)
 						if !ok {
 							v.err(n, "Enum `%s` has no member `%s`", enumName.String(), memberName)
+							break
 						}
 
 						enum := &EnumLiteral{}
@@ -519,7 +925,7 @@ func (v *Resolver) ResolveNode(node *Node) {
 			}
 
 			switch n.Type.BaseType.ActualType().(type) {
-			case StructType, ArrayType:
+			case StructType, ArrayType, ErrorType:
 
 			default:
 				v.err(n, "Type `%s` is not composite type", n.Type.String())
@@ -527,8 +933,8 @@ func (v *Resolver) ResolveNode(node *Node) {
 		}
 
 	case *CallExpr:
-		log.Debugln("resolve", "checking callexpr:%#v", n.Function)
-		log.Debugln("resolve", "checking callexpr receiver:%#v", n.ReceiverAccess)
+		log.Debugln(log.TagResolve, "checking callexpr:%#v", n.Function)
+		log.Debugln(log.TagResolve, "checking callexpr receiver:%#v", n.ReceiverAccess)
 
 		// NOTE: Here we check whether this is a call or an enum tuple lit.
 		// way too much duplication with all this enum literal creating stuff
@@ -539,7 +945,7 @@ func (v *Resolver) ResolveNode(node *Node) {
 				ident := v.tryGetIdent(n, enumName)
 				if ident != nil && ident.Type == IDENT_TYPE {
 					itype := ident.Value.(Type)
-					if _, ok := itype.ActualType().(EnumType); ok {
+					if _, ok := itype.ActualType().(EnumType); ok && !hasStaticMember(itype, memberName) {
 						et := v.ResolveTypeReference(n, &TypeReference{
 							BaseType: UnresolvedType{
 								Name: enumName,
@@ -550,6 +956,7 @@ func (v *Resolver) ResolveNode(node *Node) {
 						member, ok := et.BaseType.ActualType().(EnumType).GetMember(memberName)
 						if !ok {
 							v.err(n, "Enum `%s` has no member `%s`", enumName.String(), memberName)
+							break
 						}
 
 						enum := &EnumLiteral{}
@@ -569,36 +976,31 @@ func (v *Resolver) ResolveNode(node *Node) {
 				}
 			}
 
-			ident := v.tryGetIdent(n, vae.Name)
-			var wrap *StructAccessExpr
-			for ident == nil && len(vae.Name.ModuleNames) > 0 {
-				log.Debugln("resolve", "trying to resolve VariableAccessNode as StructAccessNode: %#v", n)
-				// 如果名字获取不到，说明有可能实际是StructAccess，尝试向前移动一个词，重新检验
-				parentName, memberName := vae.Name.Split()
-				vae.Name = parentName
-				log.Debugln("resolve", "new name: %#v; member: %#v", parentName, memberName)
-				ident = v.tryGetIdent(n, parentName)
-				log.Debugln("resolve", "ident: %#v", ident)
-				sae := &StructAccessExpr{
-					Member:         memberName,
-					Struct:         vae,
-					ParentFunction: v.currentFunction(),
-				}
-				if wrap == nil {
-					wrap = sae
-				} else {
-					wrap.Struct = sae
-				}
-
-				log.Debugln("resolve", "got strctAccessExpr:%#v", wrap)
-			}
-			if wrap != nil {
+			// 方法调用：解析得到变量时，之后的段是成员访问，最后一段是方法，参见 qualified.go。
+			// 其它情况由 VariableAccessExpr 报告错误
+			if ident, used := v.resolveQualified(vae.Name); ident != nil && ident.Type == IDENT_VARIABLE && used <= len(vae.Name.ModuleNames) {
+				members := qualifiedMembers(vae.Name, used)
+				vae.Name = qualifiedPrefix(vae.Name, used)
+				wrap := memberAccesses(vae, members, v.currentFunction()).(*StructAccessExpr)
 				n.Function = wrap
 				n.ReceiverAccess = wrap.Struct
 			}
 
-			log.Debugln("resolve", "checking callexpr:%#v", n.Function)
-			log.Debugln("resolve", "checking callexpr receiver:%#v", n.ReceiverAccess)
+			log.Debugln(log.TagResolve, "checking callexpr:%#v", n.Function)
+			log.Debugln(log.TagResolve, "checking callexpr receiver:%#v", n.ReceiverAccess)
+		}
+
+		// 泛型类型的静态方法调用，如 List<int>.make(10)
+		if sae, ok := n.Function.(*StructAccessExpr); ok {
+			if fae, matched := v.resolveGenericStaticCall(sae); matched {
+				n.ReceiverAccess = nil
+				if fae == nil {
+					// 已经报告了错误，也不再把其中的类型名作为变量解析
+					n.Function = nil
+					break
+				}
+				n.Function = fae
+			}
 		}
 
 		// NOTE: Here we check whether this is a call or a cast
@@ -606,10 +1008,11 @@ func (v *Resolver) ResolveNode(node *Node) {
 		if typ, ok := v.exprToType(n.Function); ok {
 			if len(n.Arguments) != 1 {
 				v.err(n, "Casts must recieve exactly one argument")
+				break
 			}
 
 			cast := &CastExpr{}
-			cast.Type = &TypeReference{BaseType: typ}
+			cast.Type = typ
 			cast.Expr = n.Arguments[0]
 			cast.SetPos(n.Pos())
 			*node = cast
@@ -618,6 +1021,18 @@ func (v *Resolver) ResolveNode(node *Node) {
 	case *StructAccessExpr:
 		n.ParentFunction = v.currentFunction()
 
+	case *NewExpr:
+		v.resolveConstructorCall(n)
+
+	case *FunctionAccessExpr:
+		// 已经在调用中解析，如 List<int>.make(10)，参见 resolveGenericStaticCall
+
+	case *OverflowArithExpr:
+		v.resolveShadowedBuiltin(node, parser.OverflowArithName(n.Mode, n.Op), []Expr{n.Lhand, n.Rhand})
+
+	case *FloatBuiltinExpr:
+		v.resolveShadowedBuiltin(node, n.Builtin.String(), n.Arguments)
+
 	case *EnumPatternExpr:
 		for _, vari := range n.Variables {
 			if vari != nil && v.curScope.InsertVariable(vari, false) != nil {
@@ -628,9 +1043,9 @@ func (v *Resolver) ResolveNode(node *Node) {
 	// No-Ops
 	case *Block, *UseDirective, *AssignStat, *BinopAssignStat,
 		*DestructAssignStat, *DestructBinopAssignStat, *BlockStat, *BreakStat,
-		*CallStat, *DeferStat, *IfStat, *MatchStat, *LoopStat, *ContinueStat,
-		*ReturnStat, *ReferenceToExpr, *PointerToExpr, *ArrayAccessExpr,
-		*BinaryExpr, *DerefAccessExpr, *UnaryExpr, *DiscardAccessExpr, *BoolLiteral,
+		*CallStat, *DeferStat, *StaticAssertStat, *VolatileStoreStat, *IfStat, *MatchStat, *LoopStat, *ContinueStat,
+		*ReturnStat, *ReferenceToExpr, *PointerToExpr, *ArrayAccessExpr, *SliceExpr,
+		*BinaryExpr, *VolatileLoadExpr, *CStringExpr, *HashExpr, *CondExpr, *TempAccessExpr, *DerefAccessExpr, *UnaryExpr, *DiscardAccessExpr, *BoolLiteral,
 		*NumericLiteral, *RuneLiteral, *StringLiteral, *TupleLiteral:
 		break
 
@@ -639,7 +1054,40 @@ func (v *Resolver) ResolveNode(node *Node) {
 	}
 }
 
-func (v *Resolver) exprToType(expr Expr) (Type, bool) {
+// 内建函数和浮点数特殊值的名字不是保留关键字，可以用作函数或变量的名字。
+// 作用域中有同名的标识符时，它隐藏内建的含义：fma(a, b, c) 是普通的函数调用，nan 是变量
+
+// resolveShadowedBuiltin 内建函数name被作用域中的同名标识符隐藏时，把它改成普通的调用
+func (v *Resolver) resolveShadowedBuiltin(node *Node, name string, args []Expr) {
+	if v.lookupIdent(UnresolvedName{Name: name}) == nil {
+		return
+	}
+
+	fn := &VariableAccessExpr{Name: UnresolvedName{Name: name}}
+	fn.SetPos((*node).Pos())
+	call := &CallExpr{Function: fn, Arguments: args}
+	call.SetPos((*node).Pos())
+
+	*node = call
+	v.ResolveNode(node)
+}
+
+// floatSpecialLiteral 没有同名标识符时，nan 和 inf 是浮点数特殊值。负无穷写作 -inf
+func floatSpecialLiteral(name UnresolvedName) *NumericLiteral {
+	if len(name.ModuleNames) > 0 {
+		return nil
+	}
+
+	switch name.Name {
+	case parser.FLOAT_NAN:
+		return &NumericLiteral{IsFloat: true, FloatValue: math.NaN()}
+	case parser.FLOAT_INF:
+		return &NumericLiteral{IsFloat: true, FloatValue: math.Inf(1)}
+	}
+	return nil
+}
+
+func (v *Resolver) exprToType(expr Expr) (*TypeReference, bool) {
 	var references []bool
 	var mutable []bool
 	for {
@@ -656,16 +1104,24 @@ func (v *Resolver) exprToType(expr Expr) (Type, bool) {
 		}
 	}
 
+	// 不是类型时由 VariableAccessExpr 报告名字的错误，这里只查找
 	if vae, ok := expr.(*VariableAccessExpr); ok {
-		ident := v.getIdent(vae, vae.Name)
-		if ident != nil && ident.Type == IDENT_TYPE {
-			res := ident.Value.(Type)
+		ident := v.tryGetIdent(vae, vae.Name)
+		if ident != nil && (ident.Type == IDENT_TYPE || ident.Type == IDENT_TYPE_ALIAS && len(vae.GenericArguments) == 0) {
+			ident = v.getIdent(vae, vae.Name)
+			var res *TypeReference
+			if ident.Type == IDENT_TYPE_ALIAS {
+				res = &TypeReference{BaseType: v.ResolveType(vae, UnresolvedType{Name: vae.Name})}
+			} else {
+				// 泛型类型的实参，如 Comparable<Num>(x)
+				res = &TypeReference{BaseType: ident.Value.(Type), GenericArguments: v.ResolveTypeReferences(vae, vae.GenericArguments)}
+			}
 			for idx, isReference := range references {
 				isMutable := mutable[idx]
 				if isReference {
-					res = ReferenceTo(&TypeReference{BaseType: res}, isMutable)
+					res = &TypeReference{BaseType: ReferenceTo(res, isMutable)}
 				} else {
-					res = PointerTo(&TypeReference{BaseType: res}, isMutable)
+					res = &TypeReference{BaseType: PointerTo(res, isMutable)}
 				}
 			}
 			return res, true
@@ -692,15 +1148,90 @@ func (v *Resolver) ResolveTypeReferences(src Locatable, ts []*TypeReference) []*
 }
 
 func (v *Resolver) ResolveTypeReference(src Locatable, t *TypeReference) *TypeReference {
-	return &TypeReference{
+	// 不是别名时由 ResolveType 报告名字的错误，这里只查找
+	if unresolved, ok := t.BaseType.(UnresolvedType); ok {
+		if ident := v.tryGetIdent(src, unresolved.Name); ident != nil && ident.Type == IDENT_TYPE_ALIAS {
+			ident = v.getIdent(src, unresolved.Name)
+			res := v.expandTypeAlias(src, ident.Value.(*TypeAlias), v.ResolveTypeReferences(src, t.GenericArguments))
+			v.addArrayLengths(res)
+			return res
+		}
+	}
+
+	res := &TypeReference{
 		BaseType:         v.ResolveType(src, t.BaseType),
 		GenericArguments: v.ResolveTypeReferences(src, t.GenericArguments),
 	}
+	v.addArrayLengths(res)
+	return res
+}
+
+// addArrayLengths 记录t中长度还没有求值的数组类型（包括数组的元素类型），在模块解析结束时求值
+func (v *Resolver) addArrayLengths(t *TypeReference) {
+	arr, ok := t.BaseType.(ArrayType)
+	if !ok {
+		return
+	}
+	v.addArrayLengths(arr.MemberType)
+	if arr.LengthExpr != nil {
+		v.arrayLengths = append(v.arrayLengths, &pendingArrayLength{ref: t, submod: v.curSubmod})
+	}
+}
+
+// evalArrayLengths 计算长度是常量表达式的数组类型的长度。长度可以使用本模块和引入的模块中的不可变全局变量，
+// 以及由 TargetLayout 计算的 sizeof、alignof、offsetof
+func (v *Resolver) evalArrayLengths() {
+	if len(v.arrayLengths) == 0 {
+		return
+	}
+
+	modules := []*Module{v.module}
+	for _, submod := range v.module.Parts {
+		for _, used := range submod.UseScope.UsedModules {
+			modules = append(modules, used)
+		}
+	}
+	eval := NewConstEvaluator(modules)
+	if TargetLayout != nil {
+		eval.SizeOf, eval.AlignOf, eval.OffsetOf = TargetLayout.SizeOf, TargetLayout.AlignOf, TargetLayout.OffsetOf
+	}
+
+	for _, pending := range v.arrayLengths {
+		var arr ArrayType
+		if pending.named != nil {
+			arr = pending.named.Type.(ArrayType)
+		} else {
+			arr = pending.ref.BaseType.(ArrayType)
+		}
+		if arr.LengthExpr == nil {
+			continue
+		}
+
+		v.curSubmod = pending.submod
+		value := eval.Eval(arr.LengthExpr)
+		if value == nil || value.Kind != ConstInt {
+			v.err(arr.LengthExpr, "Array length must be a constant integer expression")
+			continue
+		}
+		if value.Int.Sign() < 0 || value.Int.BitLen() > 31 {
+			v.err(arr.LengthExpr, "Invalid array length `%s`", value)
+			continue
+		}
+
+		arr.Length, arr.LengthExpr = int(value.Int.Int64()), nil
+		if pending.named != nil {
+			pending.named.Type = arr
+		} else {
+			pending.ref.BaseType = arr
+		}
+	}
+	v.arrayLengths = nil
+	v.curSubmod = nil
 }
 
 func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 	switch t := t.(type) {
-	case PrimitiveType, *NamedType:
+	case PrimitiveType, *NamedType, ErrorType:
 		return t
 
 	case InterfaceType:
@@ -727,7 +1258,11 @@ func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 		}
 
 	case ArrayType:
-		return ArrayOf(v.ResolveTypeReference(src, t.MemberType), t.IsFixedLength, t.Length)
+		res := ArrayOf(v.ResolveTypeReference(src, t.MemberType), t.IsFixedLength, t.Length)
+		if t.LengthExpr != nil {
+			res.LengthExpr = NewASTVisitor(v).VisitExpr(t.LengthExpr)
+		}
+		return res
 
 	case ReferenceType:
 		return ReferenceTo(v.ResolveTypeReference(src, t.Referrer), t.IsMutable)
@@ -736,6 +1271,13 @@ func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 		return PointerTo(v.ResolveTypeReference(src, t.Addressee), t.IsMutable)
 
 	case *SubstitutionType:
+		// 约束中可以引用参数自身，如 T: Comparable<T>
+		if t.resolving {
+			return t
+		}
+		t.resolving = true
+		defer func() { t.resolving = false }()
+
 		var constraints []*TypeReference
 		for _, c := range t.Constraints {
 			rc := v.ResolveTypeReference(src, c)
@@ -761,6 +1303,7 @@ func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 			Members:           make([]*StructMember, len(t.Members)),
 			attrs:             t.attrs,
 			GenericParameters: t.GenericParameters,
+			IsUnion:           t.IsUnion,
 		}
 
 		v.EnterScope()
@@ -814,10 +1357,17 @@ func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 		nv := FunctionType{
 			attrs:             t.attrs,
 			IsVariadic:        t.IsVariadic,
-			Parameters:        v.ResolveTypeReferences(src, t.Parameters),
+			Parameters:        make([]*TypeReference, len(t.Parameters)),
 			GenericParameters: t.GenericParameters,
 		}
 
+		// lambda省略类型的参数为nil，留给类型推导
+		for idx, par := range t.Parameters {
+			if par != nil {
+				nv.Parameters[idx] = v.ResolveTypeReference(src, par)
+			}
+		}
+
 		if t.Receiver != nil {
 			nv.Receiver = v.ResolveTypeReference(src, t.Receiver)
 			checkReceiverType(v, src, nv.Receiver, "receiver")
@@ -831,17 +1381,65 @@ func (v *Resolver) ResolveType(src Locatable, t Type) Type {
 	case UnresolvedType:
 		ident := v.getIdent(src, t.Name)
 		if ident == nil {
-			// do nothing
+			return ErrorType{Name: t.Name.String()}
+		} else if ident.Type == IDENT_TYPE_ALIAS {
+			// 这里没有泛型实参，别名展开的结果也不能带有泛型实参
+			res := v.expandTypeAlias(src, ident.Value.(*TypeAlias), nil)
+			if len(res.GenericArguments) > 0 {
+				v.err(src, "Type alias `%s` of generic type `%s` cannot be used here", t.Name, res.String())
+			}
+			return res.BaseType
 		} else if ident.Type != IDENT_TYPE {
 			v.err(src, "Expected type identifier, found %s `%s`", ident.Type, t.Name)
-		} else {
-			return v.ResolveType(src, ident.Value.(Type))
+			return ErrorType{Name: t.Name.String()}
 		}
-
-		panic("unreachable")
+		return v.ResolveType(src, ident.Value.(Type))
 
 	default:
 		typeName := reflect.TypeOf(t).String()
 		panic("INTERNAL ERROR: Unhandled type in resolve pass: " + typeName)
 	}
 }
+
+// shareParameterTypes 接收者和参数的变量与构造时一样使用函数类型中解析后的类型，
+// 访问它们的 VariableDecl 时不再重复解析，也不会重复报告无法解析的类型
+func shareParameterTypes(fn *Function) {
+	if fn.Receiver != nil {
+		fn.Receiver.Variable.Type = fn.Type.Receiver
+	}
+	for idx, par := range fn.Parameters {
+		par.Variable.Type = fn.Type.Parameters[idx]
+	}
+}
+
+// inheritReceiverConstraints 方法从接收者的泛型实参得到的类型参数继承类型声明中的约束，
+// 如 type Box struct<T: Sized> 的方法 fun Box<T>.total() 中的T同样满足Sized，可以调用约束的方法。
+// 静态方法 fun static Box<T>.make() 同样如此
+func inheritReceiverConstraints(fn *Function) {
+	var recv *TypeReference
+	if fn.Receiver != nil {
+		recv = TypeReferenceWithoutPointers(fn.Type.Receiver)
+	} else if len(fn.StaticTypeParameters) > 0 && fn.StaticReceiverType != nil {
+		recv = &TypeReference{BaseType: fn.StaticReceiverType}
+		for _, par := range fn.StaticTypeParameters {
+			recv.GenericArguments = append(recv.GenericArguments, &TypeReference{BaseType: par})
+		}
+	} else {
+		return
+	}
+	params := getTypeGenericParameters(recv.BaseType)
+	if len(params) == 0 || len(params) != len(recv.GenericArguments) {
+		return
+	}
+
+	gcon := NewGenericContext(params, recv.GenericArguments)
+	for idx, arg := range recv.GenericArguments {
+		sub, ok := arg.BaseType.(*SubstitutionType)
+		if !ok || len(sub.Constraints) > 0 {
+			continue
+		}
+		for _, con := range params[idx].Constraints {
+			sub.Constraints = append(sub.Constraints, gcon.Replace(con))
+		}
+	}
+}
@@ -1,22 +1,157 @@
 package ast
 
 import (
+	"sort"
+
 	"github.com/ku-lang/ku/util/log"
 )
 
+// RuntimeModuleName 运行时模块的名字
+const RuntimeModuleName = "__runtime"
+
+// IsRuntime 是否是运行时模块
+func (v *Module) IsRuntime() bool {
+	return v != nil && v.Name != nil && v.Name.String() == RuntimeModuleName
+}
+
+// runtimeHooks 运行时钩子的默认实现，钩子名 -> 函数
+var runtimeHooks = make(map[string]*Function)
+
 func LoadRuntimeModule(mod *Module) {
 	for name, ident := range mod.ModScope.Idents {
 		if ident.Public {
 			builtinScope.InsertIdent(ident.Value, name, ident.Type, ident.Public)
 		}
+		if fn, ok := ident.Value.(*Function); ok && ident.Type == IDENT_FUNCTION {
+			if hook := HookName(fn); hook != "" {
+				runtimeHooks[hook] = fn
+			}
+		}
+	}
+}
+
+// UnloadRuntimeModule 从内置作用域中去掉LoadRuntimeModule加入的标识符，用于重新加载修改过的运行时
+func UnloadRuntimeModule(mod *Module) {
+	for name, ident := range mod.ModScope.Idents {
+		if loaded := builtinScope.Idents[name]; loaded != nil && ident.Public && loaded.Value == ident.Value {
+			delete(builtinScope.Idents, name)
+		}
+	}
+	for hook, fn := range runtimeHooks {
+		if fn.ParentModule == mod {
+			delete(runtimeHooks, hook)
+		}
+	}
+}
+
+// FunctionAccessCounts 模块中每个函数当前的访问数。复用已经推导过的模块时，
+// 用 TruncateFunctionAccesses 去掉之后的编译中添加的访问
+func FunctionAccessCounts(mod *Module) map[*Function]int {
+	counts := make(map[*Function]int)
+	for _, submod := range mod.Parts {
+		for node := range submod.IterNodes() {
+			if decl, ok := node.(*FunctionDecl); ok {
+				counts[decl.Function] = len(decl.Function.Accesses)
+			}
+		}
+	}
+	return counts
+}
+
+// TruncateFunctionAccesses 把函数的访问恢复到 FunctionAccessCounts 记录时的状态
+func TruncateFunctionAccesses(counts map[*Function]int) {
+	for fn, count := range counts {
+		fn.Accesses = fn.Accesses[:count]
 	}
 }
 
 func runtimeMustLoadType(mod *Module, name string) Type {
-	log.Debugln("runtime", "Loading runtime type: %s", name)
+	log.Debugln(log.TagRuntime, "Loading runtime type: %s", name)
 	ident := mod.ModScope.GetIdent(UnresolvedName{Name: name})
 	if ident.Type != IDENT_TYPE {
 		panic("INTERNAL ERROR: Type not defined in runtime: " + name)
 	}
 	return ident.Value.(Type)
 }
+
+// IsOptionType 类型是否是运行时中的 Option<T>
+func IsOptionType(typ *TypeReference) bool {
+	ident := builtinScope.GetIdent(UnresolvedName{Name: "Option"})
+	if typ == nil || ident == nil || ident.Type != IDENT_TYPE {
+		return false
+	}
+	return typ.BaseType.Equals(ident.Value.(Type))
+}
+
+// IsResultType 类型是否是运行时中的 Result<T, E>
+func IsResultType(typ *TypeReference) bool {
+	ident := builtinScope.GetIdent(UnresolvedName{Name: "Result"})
+	if typ == nil || ident == nil || ident.Type != IDENT_TYPE {
+		return false
+	}
+	return typ.BaseType.Equals(ident.Value.(Type))
+}
+
+// IsStringType 类型是否是 string（不包括 []u8）
+func IsStringType(typ *TypeReference) bool {
+	return typ != nil && typ.BaseType.Equals(stringType)
+}
+
+// DurationType 运行时中的时长类型 Duration，时长字面量的类型
+func DurationType() *TypeReference {
+	ident := builtinScope.GetIdent(UnresolvedName{Name: "Duration"})
+	if ident == nil || ident.Type != IDENT_TYPE {
+		panic("INTERNAL ERROR: Type not defined in runtime: Duration")
+	}
+	return &TypeReference{BaseType: ident.Value.(Type)}
+}
+
+// IsDurationType 类型是否是运行时中的 Duration
+func IsDurationType(typ *TypeReference) bool {
+	ident := builtinScope.GetIdent(UnresolvedName{Name: "Duration"})
+	if typ == nil || ident == nil || ident.Type != IDENT_TYPE {
+		return false
+	}
+	return typ.BaseType.Equals(ident.Value.(Type))
+}
+
+// RuntimeFunction 运行时中的公开函数，代码生成器通过它调用运行时
+func RuntimeFunction(name string) *Function {
+	ident := builtinScope.GetIdent(UnresolvedName{Name: name})
+	if ident == nil || ident.Type != IDENT_FUNCTION {
+		panic("INTERNAL ERROR: Function not defined in runtime: " + name)
+	}
+	return ident.Value.(*Function)
+}
+
+// 运行时钩子：runtime.ku中用 [hook(name)] 标注的函数是钩子name的默认实现，代码生成时以弱符号
+// HookSymbol(name) 输出。用户程序中签名相同、同样标注了 [hook(name)] 的函数以强符号输出，链接时替换默认实现；
+// 嵌入ku代码的C程序也可以直接定义这个符号
+
+// HookName 函数的 [hook(name)] 标注中的钩子名，没有标注时返回""
+func HookName(fn *Function) string {
+	if attr := fn.Type.Attrs().Get("hook"); attr != nil {
+		return attr.Value
+	}
+	return ""
+}
+
+// HookSymbol 钩子的链接符号
+func HookSymbol(name string) string {
+	return "__ku_hook_" + name
+}
+
+// RuntimeHook 钩子name的默认实现，运行时中没有这个钩子时返回nil
+func RuntimeHook(name string) *Function {
+	return runtimeHooks[name]
+}
+
+// RuntimeHookNames 运行时中所有钩子的名字，按字母排序
+func RuntimeHookNames() []string {
+	var names []string
+	for name := range runtimeHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
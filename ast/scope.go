@@ -2,7 +2,6 @@ package ast
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/ku-lang/ku/util/log"
@@ -17,6 +16,7 @@ const (
 	IDENT_TYPE
 	IDENT_FUNCTION
 	IDENT_MODULE
+	IDENT_TYPE_ALIAS
 )
 
 func (v IdentType) String() string {
@@ -27,6 +27,8 @@ func (v IdentType) String() string {
 		return "module"
 	case IDENT_TYPE:
 		return "type"
+	case IDENT_TYPE_ALIAS:
+		return "type alias"
 	case IDENT_VARIABLE:
 		return "variable"
 	default:
@@ -39,6 +41,9 @@ type Ident struct {
 	Value  interface{}
 	Public bool
 	Scope  *Scope
+
+	// 函数有重载时是所有的重载（包括Value），否则为nil，参见 overload.go
+	Overloads []*Function
 }
 
 type Scope struct {
@@ -93,9 +98,9 @@ func NewCScope(mod *Module) *Scope {
 
 func (v *Scope) err(err string, stuff ...interface{}) {
 	// TODO: These errors are unacceptably shitty
-	log.Error("resolve", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
+	log.Error(log.TagResolve, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
 		fmt.Sprintf(err, stuff...))
-	os.Exit(util.EXIT_FAILURE_PARSE)
+	util.ExitFunc(util.EXIT_FAILURE_PARSE)
 }
 
 func (v *Scope) InsertIdent(value interface{}, name string, typ IdentType, public bool) *Ident {
@@ -126,6 +131,14 @@ func (v *Scope) InsertFunction(t *Function, public bool) *Ident {
 	return v.InsertIdent(t, t.Name, IDENT_FUNCTION, public)
 }
 
+// AddOverload 把函数作为ident中同名函数的重载
+func (v *Scope) AddOverload(ident *Ident, t *Function) {
+	if ident.Overloads == nil {
+		ident.Overloads = []*Function{ident.Value.(*Function)}
+	}
+	ident.Overloads = append(ident.Overloads, t)
+}
+
 func (v *Scope) UseModule(t *Module) {
 	v.UsedModules[t.Name.Last()] = t
 }
@@ -134,41 +147,16 @@ func (v *Scope) UseModuleAs(t *Module, name string) {
 	v.UsedModules[name] = t
 }
 
+// GetIdent 在作用域及外层作用域中查找名字。限定名（a.b.c）由 Resolver 逐段解析，参见 qualified.go
 func (v *Scope) GetIdent(name UnresolvedName) *Ident {
-	scope := v
-
-	for idx, modname := range name.ModuleNames {
-		module, ok := scope.UsedModules[modname]
-		for !ok && scope.Outer != nil {
-			scope = scope.Outer
-			module, ok = scope.UsedModules[modname]
-		}
-
-		if !ok {
-			// Check for the case of the static method
-			if idx == len(name.ModuleNames)-1 {
-				lastName, method := name.Split()
-				if r := v.GetIdent(lastName); r != nil && r.Type == IDENT_TYPE {
-					typ := r.Value.(Type)
-					if nt, ok := typ.(*NamedType); ok {
-						fn := nt.GetStaticMethod(method)
-						if fn != nil {
-							return &Ident{IDENT_FUNCTION, fn, true, scope}
-						}
-					}
-				}
-			}
-
-			return nil
-		}
-
-		scope = module.ModScope
+	if len(name.ModuleNames) > 0 {
+		panic("INTERNAL ERROR: Scope.GetIdent called with qualified name `" + name.String() + "`")
 	}
 
-	if r := scope.Idents[name.Name]; r != nil {
+	if r := v.Idents[name.Name]; r != nil {
 		return r
-	} else if r := scope.UsedModules[name.Name]; r != nil {
-		return &Ident{IDENT_MODULE, r, true, v}
+	} else if r := v.UsedModules[name.Name]; r != nil {
+		return &Ident{IDENT_MODULE, r, true, v, nil}
 	} else if v.Outer != nil {
 		return v.Outer.GetIdent(name)
 	}
@@ -180,18 +168,18 @@ func (v *Scope) Dump(depth int) {
 	indent := strings.Repeat(" ", depth)
 
 	if depth == 0 {
-		log.Debug("resolve", indent)
-		log.Debugln("resolve", "This scope:")
+		log.Debug(log.TagResolve, indent)
+		log.Debugln(log.TagResolve, "This scope:")
 	}
 
 	for name, ident := range v.Idents {
-		log.Debug("resolve", indent)
-		log.Debugln("resolve", " %s (%s)", name, ident.Type)
+		log.Debug(log.TagResolve, indent)
+		log.Debugln(log.TagResolve, " %s (%s)", name, ident.Type)
 	}
 
 	if v.Outer != nil {
-		log.Debug("resolve", indent)
-		log.Debugln("resolve", "Parent scope:")
+		log.Debug(log.TagResolve, indent)
+		log.Debugln(log.TagResolve, "Parent scope:")
 		v.Outer.Dump(depth + 1)
 	}
 
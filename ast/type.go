@@ -100,6 +100,16 @@ func (v PrimitiveType) TypeName() string {
 	return v.String()[10:]
 }
 
+// PrimitiveTypeFromName 根据名称查找基本类型，如 "u8"
+func PrimitiveTypeFromName(name string) (PrimitiveType, bool) {
+	for typ := PRIMITIVE_s8; typ <= PRIMITIVE_void; typ++ {
+		if typ.TypeName() == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
 func (v PrimitiveType) LevelsOfIndirection() int {
 	return 0
 }
@@ -137,6 +147,7 @@ type StructType struct {
 	Members           []*StructMember
 	attrs             parser.AttrGroup
 	GenericParameters GenericSigil
+	IsUnion           bool // 联合体：所有成员的偏移都是0，大小是最大的成员的大小
 }
 
 type StructMember struct {
@@ -148,6 +159,9 @@ type StructMember struct {
 
 func (v StructType) String() string {
 	result := "(" + util.Blue("StructType") + ": "
+	if v.IsUnion {
+		result += "union "
+	}
 	result += v.attrs.String()
 	result += "\n"
 	for _, mem := range v.Members {
@@ -157,7 +171,7 @@ func (v StructType) String() string {
 }
 
 func (v StructType) TypeName() string {
-	res := "struct" + v.GenericParameters.String() + " {"
+	res := v.Keyword() + v.GenericParameters.String() + " {"
 
 	for i, mem := range v.Members {
 		res += mem.Name + ": " + mem.Type.String()
@@ -170,6 +184,14 @@ func (v StructType) TypeName() string {
 	return res + "}"
 }
 
+// Keyword 声明这个类型的关键字：struct 或 union
+func (v StructType) Keyword() string {
+	if v.IsUnion {
+		return "union"
+	}
+	return "struct"
+}
+
 func (v StructType) IsSigned() bool {
 	return false
 }
@@ -216,6 +238,18 @@ func (v StructType) MemberIndex(name string) int {
 	return -1
 }
 
+// FixedLayout 成员是否必须按声明的顺序排列。默认编译器可以重排成员以减少填充，
+// [layout(c)] 保持与C相同的布局，[packed] 没有填充，也不重排。联合体的成员都在偏移0，与C相同
+func (v StructType) FixedLayout() bool {
+	if v.IsUnion {
+		return true
+	}
+	if layout := v.attrs.Get("layout"); layout != nil && layout.Value == "c" {
+		return true
+	}
+	return v.attrs.Contains("packed")
+}
+
 func (v StructType) Attrs() parser.AttrGroup {
 	return v.attrs
 }
@@ -226,7 +260,7 @@ func (v StructType) Equals(t Type) bool {
 		return false
 	}
 
-	if !v.Attrs().Equals(other.Attrs()) {
+	if !v.Attrs().Equals(other.Attrs()) || v.IsUnion != other.IsUnion {
 		return false
 	}
 
@@ -262,9 +296,12 @@ type NamedType struct {
 	ParentModule  *Module
 	Methods       []*Function
 	StaticMethods []*Function
+
+	StaticVariables []*Variable // 静态成员，参见 Variable.StaticReceiverType
 }
 
 func (v *NamedType) addMethod(fn *Function) {
+	invalidateMethodCache()
 	v.Methods = append(v.Methods, fn)
 }
 
@@ -291,6 +328,19 @@ func (v *NamedType) GetStaticMethod(name string) *Function {
 	return nil
 }
 
+func (v *NamedType) addStaticVariable(vari *Variable) {
+	v.StaticVariables = append(v.StaticVariables, vari)
+}
+
+func (v *NamedType) GetStaticVariable(name string) *Variable {
+	for _, vari := range v.StaticVariables {
+		if vari.Name == name {
+			return vari
+		}
+	}
+	return nil
+}
+
 func (v *NamedType) ActualType() Type {
 	return v.Type.ActualType()
 }
@@ -354,7 +404,8 @@ type ArrayType struct {
 	MemberType *TypeReference
 
 	IsFixedLength bool
-	Length        int // TODO change to uint64
+	Length        int  // TODO change to uint64
+	LengthExpr    Expr // 还没有求值的长度表达式，变量解析结束时求值，参见 Resolver.evalArrayLengths
 
 	attrs parser.AttrGroup
 }
@@ -376,7 +427,9 @@ func (v ArrayType) String() string {
 
 func (v ArrayType) TypeName() string {
 	var l string
-	if v.IsFixedLength {
+	if v.LengthExpr != nil {
+		l = "?"
+	} else if v.IsFixedLength {
 		l = fmt.Sprintf("%d", v.Length)
 	}
 	return "[" + l + "]" + v.MemberType.String()
@@ -698,11 +751,14 @@ func (v InterfaceType) IsVoidType() bool {
 	return false
 }
 
+// CanCastTo 接口值可以转换为任意接口类型，装箱的值的类型是否实现了目标接口在运行时检查
 func (v InterfaceType) CanCastTo(t Type) bool {
-	return v.Equals(t.ActualType())
+	_, ok := t.ActualType().(InterfaceType)
+	return ok
 }
 
 func (v InterfaceType) addFunction(fn *Function) InterfaceType {
+	invalidateMethodCache()
 	v.Functions = append(v.Functions, fn)
 	return v
 }
@@ -780,6 +836,25 @@ type EnumTypeMember struct {
 	Tag  int
 }
 
+// DefaultEnumTagType 枚举标签的默认类型，与C语言的enum保持一致
+const DefaultEnumTagType = PRIMITIVE_s32
+
+// TagType 枚举标签的整数类型。可以用 [repr(u8)] 这样的标注指定，否则为DefaultEnumTagType。
+// 标注的值是否合法由语义分析检查
+func (v EnumType) TagType() PrimitiveType {
+	if repr := v.attrs.Get("repr"); repr != nil {
+		if typ, ok := PrimitiveTypeFromName(repr.Value); ok && typ.IsIntegerType() {
+			return typ
+		}
+	}
+	return DefaultEnumTagType
+}
+
+// IsFlags 是否是 [flags] 位标志枚举。位标志枚举的值之间可以使用 |、&、^ 和 ~ 运算
+func (v EnumType) IsFlags() bool {
+	return v.attrs.Contains("flags")
+}
+
 func (v EnumType) GetMember(name string) (EnumTypeMember, bool) {
 	for _, member := range v.Members {
 		if member.Name == name {
@@ -815,7 +890,7 @@ func (v EnumType) TypeName() string {
 }
 
 func (v EnumType) IsSigned() bool {
-	return false
+	return v.Simple && v.TagType().IsSigned()
 }
 
 func (v EnumType) LevelsOfIndirection() int {
@@ -1068,6 +1143,9 @@ type SubstitutionType struct {
 	attrs       parser.AttrGroup
 	Name        string
 	Constraints []*TypeReference // should be all interface type references
+
+	resolving bool // 正在解析约束
+	printing  bool // 正在输出约束，约束中的参数自身只输出名字
 }
 
 func NewSubstitutionType(name string, constraints []*TypeReference) *SubstitutionType {
@@ -1081,11 +1159,13 @@ func (v *SubstitutionType) String() string {
 func (v *SubstitutionType) TypeName() string {
 	str := v.Name
 
-	if len(v.Constraints) > 0 {
+	if len(v.Constraints) > 0 && !v.printing {
+		v.printing = true
 		str += ":"
 		for _, c := range v.Constraints {
 			str += " " + c.String()
 		}
+		v.printing = false
 	}
 
 	return str
@@ -1158,12 +1238,14 @@ func getTypeGenericParameters(typ Type) GenericSigil {
 		return typ.GenericParameters
 	case StructType:
 		return typ.GenericParameters
+	case InterfaceType:
+		return typ.GenericParameters
 	case PointerType:
 		return getTypeGenericParameters(typ.Addressee.BaseType)
 	case ReferenceType:
 		return getTypeGenericParameters(typ.Referrer.BaseType)
 
-	case PrimitiveType, *SubstitutionType, ArrayType, TupleType:
+	case PrimitiveType, *SubstitutionType, ArrayType, TupleType, ErrorType:
 		return nil
 
 	case *NamedType:
@@ -1312,6 +1394,58 @@ func (v UnresolvedType) ActualType() Type {
 	return v
 }
 
+// ErrorType 变量解析时无法解析的类型的占位，使解析能够继续，报告后面的错误。
+// 变量解析有错误时编译在类型推导之前停止，参见 Resolver.err
+type ErrorType struct {
+	Name string // 源码中的写法
+}
+
+func (v ErrorType) String() string {
+	return "(" + util.Blue("ErrorType") + ": " + v.Name + ")"
+}
+
+func (v ErrorType) TypeName() string {
+	return v.Name
+}
+
+func (v ErrorType) LevelsOfIndirection() int {
+	return 0
+}
+
+func (v ErrorType) IsIntegerType() bool {
+	return false
+}
+
+func (v ErrorType) IsFloatingType() bool {
+	return false
+}
+
+func (v ErrorType) IsSigned() bool {
+	return false
+}
+
+func (v ErrorType) IsVoidType() bool {
+	return false
+}
+
+// CanCastTo 总是为真，不再为已经报告过的错误报告类型不匹配
+func (v ErrorType) CanCastTo(t Type) bool {
+	return true
+}
+
+func (v ErrorType) Attrs() parser.AttrGroup {
+	return nil
+}
+
+func (v ErrorType) Equals(t Type) bool {
+	_, ok := t.(ErrorType)
+	return ok
+}
+
+func (v ErrorType) ActualType() Type {
+	return v
+}
+
 func TypeWithoutPointers(t Type) Type {
 	return TypeReferenceWithoutPointers(&TypeReference{BaseType: t}).BaseType
 }
@@ -0,0 +1,143 @@
+package ast
+
+// 类型别名
+//
+// type Name<T, U> = Type 给类型起另一个名字，别名与它代表的类型完全相同，不能定义方法。
+// 别名在解析时展开：用到别名的地方直接替换为它代表的类型，泛型实参代入别名的泛型参数，
+// 之后的类型推导、语义检查和代码生成都看不到别名。
+// 别名的类型在声明它的子模块中解析（使用那里引入的模块），第一次使用时解析，别名不能直接或间接地引用自身
+
+func (v *Scope) InsertTypeAlias(t *TypeAlias, public bool) *Ident {
+	return v.InsertIdent(t, t.Name, IDENT_TYPE_ALIAS, public)
+}
+
+// resolveTypeAlias 解析别名代表的类型，泛型参数只在别名的类型中可见。别名引用自身时返回false
+func (v *Resolver) resolveTypeAlias(src Locatable, alias *TypeAlias) bool {
+	if alias.resolved {
+		return true
+	}
+	if alias.resolving {
+		v.err(src, "Type alias `%s` refers to itself", alias.Name)
+		return false
+	}
+	alias.resolving = true
+
+	curSubmod, curScope, functionStack := v.curSubmod, v.curScope, v.functionStack
+	v.curSubmod, v.curScope, v.functionStack = alias.submod, v.module.ModScope, nil
+	if alias.submod.FileScope != nil {
+		// 别名的类型中可以使用声明它的文件中的文件私有类型
+		v.curScope = alias.submod.FileScope
+	}
+
+	v.EnterScope()
+	for _, gpar := range alias.GenericParameters {
+		v.curScope.InsertType(gpar, false)
+	}
+	alias.Type = v.ResolveTypeReference(alias, alias.Type)
+	v.ExitScope()
+
+	v.curSubmod, v.curScope, v.functionStack = curSubmod, curScope, functionStack
+	alias.resolving, alias.resolved = false, true
+	return true
+}
+
+// expandTypeAlias 展开别名，arguments是已经解析的泛型实参
+func (v *Resolver) expandTypeAlias(src Locatable, alias *TypeAlias, arguments []*TypeReference) *TypeReference {
+	if len(arguments) != len(alias.GenericParameters) {
+		v.err(src, "Type alias `%s` expects %d generic arguments, have %d",
+			alias.Name, len(alias.GenericParameters), len(arguments))
+		return &TypeReference{BaseType: ErrorType{Name: alias.Name}}
+	}
+
+	// 使用前面的文件中声明的别名时，它可能还没有解析
+	if !v.resolveTypeAlias(src, alias) {
+		return &TypeReference{BaseType: ErrorType{Name: alias.Name}}
+	}
+
+	subs := make(map[*SubstitutionType]*TypeReference)
+	for idx, par := range alias.GenericParameters {
+		subs[par] = arguments[idx]
+	}
+	return substituteAliasReference(alias.Type, subs)
+}
+
+// substituteAliasReference 代入别名的泛型实参。与 GenericContext.Replace 不同，
+// 不修改别名的类型，也保留命名类型本身，展开的结果与直接写出的类型相同
+func substituteAliasReference(t *TypeReference, subs map[*SubstitutionType]*TypeReference) *TypeReference {
+	if t == nil {
+		return nil
+	}
+	if sub, ok := t.BaseType.(*SubstitutionType); ok {
+		if arg, ok := subs[sub]; ok {
+			return arg
+		}
+	}
+
+	args := make([]*TypeReference, len(t.GenericArguments))
+	for idx, arg := range t.GenericArguments {
+		args[idx] = substituteAliasReference(arg, subs)
+	}
+	return &TypeReference{BaseType: substituteAliasType(t.BaseType, subs), GenericArguments: args}
+}
+
+func substituteAliasReferences(ts []*TypeReference, subs map[*SubstitutionType]*TypeReference) []*TypeReference {
+	res := make([]*TypeReference, len(ts))
+	for idx, t := range ts {
+		res[idx] = substituteAliasReference(t, subs)
+	}
+	return res
+}
+
+func substituteAliasType(t Type, subs map[*SubstitutionType]*TypeReference) Type {
+	if len(subs) == 0 {
+		return t
+	}
+
+	switch t := t.(type) {
+	case ArrayType:
+		t.MemberType = substituteAliasReference(t.MemberType, subs)
+		return t
+
+	case PointerType:
+		t.Addressee = substituteAliasReference(t.Addressee, subs)
+		return t
+
+	case ReferenceType:
+		t.Referrer = substituteAliasReference(t.Referrer, subs)
+		return t
+
+	case TupleType:
+		return TupleType{Members: substituteAliasReferences(t.Members, subs)}
+
+	case FunctionType:
+		t.Parameters = substituteAliasReferences(t.Parameters, subs)
+		t.Receiver = substituteAliasReference(t.Receiver, subs)
+		t.Return = substituteAliasReference(t.Return, subs)
+		return t
+
+	case StructType:
+		members := make([]*StructMember, len(t.Members))
+		for idx, mem := range t.Members {
+			members[idx] = &StructMember{
+				Name:   mem.Name,
+				Public: mem.Public,
+				Type:   substituteAliasReference(mem.Type, subs),
+				docs:   mem.docs,
+			}
+		}
+		t.Members = members
+		return t
+
+	case EnumType:
+		members := make([]EnumTypeMember, len(t.Members))
+		for idx, mem := range t.Members {
+			members[idx] = EnumTypeMember{Name: mem.Name, Tag: mem.Tag, Type: substituteAliasType(mem.Type, subs)}
+		}
+		t.Members = members
+		return t
+
+	default:
+		// 基本类型、命名类型和接口类型中没有别名的泛型参数
+		return t
+	}
+}
@@ -0,0 +1,165 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// 类型的相容性
+//
+// 类型推导、语义检查和错误信息都由这里判断两个类型之间的关系：
+//   - Identical：两个类型相同。命名类型的别名与原类型相同，泛型实参逐个比较；
+//   - AssignableTo：类型为from的值可以存入类型为to的位置（变量、成员、实参、返回值等），
+//     需要做的转换参见 AssignmentOf，不能赋值的原因参见 AssignmentError；
+//   - ConvertibleTo：类型为from的值可以用类型转换 to(x) 得到。
+//
+// 除了类型相同，赋值还允许：
+//   - 可变的指针、引用作为不可变的使用；
+//   - 命名类型的值装箱为它实现的接口的值（参见 interface.go）；
+//   - 不可变引用是协变的：需要 &I 的地方可以使用 &T 或者 &mut T，T实现了接口I。
+//     引用的值不复制，装箱的值的地址就是引用的地址，接口值与其它装箱的值一样存放在当前函数的栈上，
+//     得到的 &I 指向它。实现接口方法的方法的接收者不可变，通过 &I 读到的总是T的当前值。
+//
+// 可变引用和数组是不变的：
+//   - 通过 &mut I 可以写入实现了I的其它类型的值，T的存储放不下它；
+//   - []T 的元素是T的值，[]I 的元素是接口值，布局不同，不能不复制就转换。
+//     数组的值共享元素的存储，即使布局相同，通过 []I 写入其它类型的元素也会破坏 []T。
+//     对数组的引用和指针同样如此，不可变的引用和指针虽然不能写入，布局也不同。
+
+// Identical 两个类型是否相同
+func Identical(a, b *TypeReference) bool {
+	return a.ActualTypesEqual(b)
+}
+
+// Assignment 类型为from的值存入类型为to的位置时需要的转换
+type Assignment int
+
+const (
+	AssignNone      Assignment = iota // 不能赋值
+	AssignDirect                      // 直接存入
+	AssignBox                         // 装箱为接口值，参见 InterfaceWrapExpr
+	AssignBorrowBox                   // 不复制地装箱引用的值，再取对接口值的引用
+)
+
+// AssignmentOf 类型为from的值存入类型为to的位置时需要的转换，不能赋值时返回 AssignNone
+func AssignmentOf(from, to *TypeReference) Assignment {
+	if Identical(from, to) {
+		return AssignDirect
+	}
+
+	switch want := to.BaseType.(type) {
+	case PointerType:
+		if have, ok := from.BaseType.(PointerType); ok && have.IsMutable && !want.IsMutable && Identical(have.Addressee, want.Addressee) {
+			return AssignDirect
+		}
+
+	case ReferenceType:
+		have, ok := from.BaseType.(ReferenceType)
+		if !ok {
+			break
+		}
+		if have.IsMutable && !want.IsMutable && Identical(have.Referrer, want.Referrer) {
+			return AssignDirect
+		}
+		if !want.IsMutable && IsBoxable(have.Referrer, want.Referrer) && Implements(have.Referrer, want.Referrer) {
+			return AssignBorrowBox
+		}
+	}
+
+	if IsBoxable(from, to) && Implements(from, to) {
+		return AssignBox
+	}
+	return AssignNone
+}
+
+// AssignableTo 类型为from的值能否存入类型为to的位置
+func AssignableTo(from, to *TypeReference) bool {
+	return AssignmentOf(from, to) != AssignNone
+}
+
+// ConvertibleTo 类型为from的值能否用类型转换得到to的值。
+// 接口值可以转换为任意接口，装箱的值的类型是否实现了目标接口在运行时检查
+func ConvertibleTo(from, to *TypeReference) bool {
+	if _, ok := InterfaceOf(from); ok {
+		_, ok := InterfaceOf(to)
+		return ok
+	}
+	return from.CanCastTo(to)
+}
+
+// IsBoxable iface是否是接口，typ是否是可以装箱为接口值的命名类型。不检查typ是否有接口的方法
+func IsBoxable(typ, iface *TypeReference) bool {
+	if _, ok := InterfaceOf(iface); !ok {
+		return false
+	}
+	if _, ok := typ.BaseType.(*NamedType); !ok {
+		return false
+	}
+	_, isInterface := InterfaceOf(typ)
+	return !isInterface
+}
+
+// Implements 类型typ是否实现了接口iface的所有方法，参见 InterfaceMethod
+func Implements(typ, iface *TypeReference) bool {
+	return implementsError(typ, iface) == ""
+}
+
+func implementsError(typ, iface *TypeReference) string {
+	inter, _ := InterfaceOf(iface)
+	for _, ifn := range inter.Functions {
+		if _, reason := InterfaceMethod(typ, iface, ifn); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// AssignmentError 类型为from的值不能存入类型为to的位置的原因，用在错误信息中。
+// 只是类型不同，没有更具体的原因时返回空字符串
+func AssignmentError(from, to *TypeReference) string {
+	if IsBoxable(from, to) {
+		return implementsError(from, to)
+	}
+
+	switch want := to.BaseType.(type) {
+	case ReferenceType:
+		have, ok := from.BaseType.(ReferenceType)
+		if !ok {
+			break
+		}
+		if IsBoxable(have.Referrer, want.Referrer) {
+			if want.IsMutable {
+				return fmt.Sprintf("a mutable reference to interface `%s` could store another implementation of it into the `%s`; use `%s` instead",
+					want.Referrer.String(), have.Referrer.String(), (&TypeReference{BaseType: ReferenceTo(want.Referrer, false)}).String())
+			}
+			return implementsError(have.Referrer, want.Referrer)
+		}
+		return arrayVarianceError(have.Referrer, want.Referrer, want.IsMutable)
+
+	case PointerType:
+		if have, ok := from.BaseType.(PointerType); ok {
+			return arrayVarianceError(have.Addressee, want.Addressee, want.IsMutable)
+		}
+	}
+
+	return arrayVarianceError(from, to, true)
+}
+
+// arrayVarianceError 元素为实现了接口I的类型的数组have不能作为元素为I的数组want使用的原因。
+// mutable表示能否通过want写入数组
+func arrayVarianceError(have, want *TypeReference, mutable bool) string {
+	wantArray, ok := want.BaseType.ActualType().(ArrayType)
+	if !ok {
+		return ""
+	}
+	haveArray, ok := have.BaseType.ActualType().(ArrayType)
+	if !ok || !IsBoxable(haveArray.MemberType, wantArray.MemberType) {
+		return ""
+	}
+
+	if mutable {
+		return fmt.Sprintf("arrays aren't covariant, storing another implementation of `%s` through it would corrupt the elements of type `%s`; convert the elements one by one into a new array",
+			wantArray.MemberType.String(), haveArray.MemberType.String())
+	}
+	return fmt.Sprintf("elements of type `%s` have a different layout than the boxed interface values of `%s`; convert the elements one by one into a new array",
+		haveArray.MemberType.String(), wantArray.MemberType.String())
+}
@@ -0,0 +1,115 @@
+package ast
+
+// 类型推导的合一求解所用的合并-查找（union-find）结构
+//
+// 每个类型变量属于一个集合，相等的类型变量合并为一个集合。集合的根可以绑定一个类型（Side），
+// 绑定的类型中可以含有其它类型变量。需要比较条件的两边时才代入绑定（resolve），
+// 代入时用SubsType，这样成员访问等ConstructorType在接收者的类型确定之后得到实际的类型。
+// 求解结束后，每个类型变量代入绑定的结果就是它的替换（substitutions）。
+
+// unifier 合并-查找结构，下标是类型变量的Id
+type unifier struct {
+	parent    []int
+	binding   []*Side
+	resolving []bool // 正在代入绑定的集合，绑定的类型中含有自己时不再展开
+}
+
+func newUnifier(count int) *unifier {
+	u := &unifier{}
+	u.grow(count)
+	return u
+}
+
+// grow 保证可以存放Id小于count的类型变量
+func (u *unifier) grow(count int) {
+	for id := len(u.parent); id < count; id++ {
+		u.parent = append(u.parent, id)
+		u.binding = append(u.binding, nil)
+		u.resolving = append(u.resolving, false)
+	}
+}
+
+// find 类型变量所在集合的根，同时压缩路径
+func (u *unifier) find(id int) int {
+	u.grow(id + 1)
+	root := id
+	for u.parent[root] != root {
+		root = u.parent[root]
+	}
+	for u.parent[id] != root {
+		id, u.parent[id] = u.parent[id], root
+	}
+	return root
+}
+
+// bind 把还没有绑定的集合id与what合并：what是类型变量时合并两个集合，否则绑定what的类型。
+// 合并时id的集合并入what的集合（与替换 X → Y 的方向相同），路径压缩保证查找足够快
+func (u *unifier) bind(id int, what Side) {
+	root := u.find(id)
+	if what.SideType == TypeSide {
+		u.binding[root] = &what
+		return
+	}
+
+	other := u.find(what.Id)
+	if other == root {
+		return
+	}
+	u.parent[root] = other
+}
+
+// resolve 代入side中的类型变量已知的绑定。结果是类型变量时，它是一个还没有绑定的集合的根
+func (u *unifier) resolve(side Side) Side {
+	if side.SideType == IdentSide {
+		root := u.find(side.Id)
+		bound := u.binding[root]
+		if bound == nil || u.resolving[root] {
+			return Side{SideType: IdentSide, Id: root, origin: side.origin}
+		}
+
+		u.resolving[root] = true
+		res := u.resolve(*bound)
+		u.resolving[root] = false
+		return res
+	}
+
+	if side.Type == nil {
+		return side
+	}
+	done := make(map[int]bool)
+	for _, id := range typeVariableIds(side.Type, nil) {
+		if done[id] {
+			continue
+		}
+		done[id] = true
+
+		what := u.resolve(Side{SideType: IdentSide, Id: id})
+		if what.SideType == IdentSide && what.Id == id {
+			continue
+		}
+		side = side.Subs(id, what)
+	}
+
+	// 类型只是一个类型变量时作为IdentSide
+	if tv, ok := side.Type.BaseType.(TypeVariable); ok {
+		return u.resolve(Side{SideType: IdentSide, Id: tv.Id, origin: side.origin})
+	}
+	return side
+}
+
+// substitutions 求解的结果：每个类型变量代入绑定之后的类型（或者所在集合的根）
+func (u *unifier) substitutions(count int) []*Constraint {
+	var res []*Constraint
+	for id := 0; id < count; id++ {
+		what := u.resolve(Side{SideType: IdentSide, Id: id})
+		if what.SideType == IdentSide && what.Id == id {
+			continue
+		}
+		res = append(res, &Constraint{
+			Left:   Side{SideType: IdentSide, Id: id},
+			Right:  what,
+			origin: what.origin,
+		})
+	}
+	return res
+}
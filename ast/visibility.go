@@ -0,0 +1,60 @@
+package ast
+
+// 符号的可见性：pub 对应到目标文件中的链接属性
+//
+// 非公开的函数和全局变量只能在所在模块中访问，输出为内部符号：不进入目标文件的符号表，
+// 优化器可以内联或者删除它们。公开的函数和全局变量是外部符号。以下情况例外：
+//   - C函数和C变量在C代码中定义，这里只声明，总是外部符号；
+//   - [nomangle] 的函数供C代码调用，是外部符号；
+//   - 运行时中钩子（[hook(name)]）的默认实现是弱符号，替换它的函数是外部符号，参见 HookName；
+//   - 方法和静态成员通过类型访问，不检查是否公开，其他模块中的接口转换、drop和泛型函数的实例也会引用它们，
+//     总是外部符号；
+//   - 嵌套函数和lambda只在所在的函数中使用，总是内部符号。
+//
+// 泛型函数的实例在声明它的模块中生成（参见 Function.Accesses），可见性与泛型函数相同
+
+// Visibility 符号的可见性
+type Visibility int
+
+const (
+	VISIBILITY_INTERNAL Visibility = iota
+	VISIBILITY_EXTERNAL
+	VISIBILITY_WEAK
+)
+
+// FunctionVisibility 函数decl的符号的可见性
+func FunctionVisibility(decl *FunctionDecl) Visibility {
+	fn := decl.Function
+	attrs := fn.Type.Attrs()
+
+	switch {
+	case fn.Outer != nil || fn.Anonymous:
+		return VISIBILITY_INTERNAL
+	case HookName(fn) != "":
+		if !decl.Prototype && fn.ParentModule.IsRuntime() {
+			return VISIBILITY_WEAK
+		}
+		return VISIBILITY_EXTERNAL
+	case attrs.Contains("C"), attrs.Contains("nomangle"):
+		return VISIBILITY_EXTERNAL
+	case fn.Receiver != nil || fn.StaticReceiverType != nil:
+		return VISIBILITY_EXTERNAL
+	case decl.IsPublic():
+		return VISIBILITY_EXTERNAL
+	}
+	return VISIBILITY_INTERNAL
+}
+
+// VariableVisibility 全局变量vari的符号的可见性，isPublic是声明它的语句是否公开
+func VariableVisibility(isPublic bool, vari *Variable) Visibility {
+	switch {
+	case vari.Attrs.Contains("C"):
+		if vari.Attrs.Contains("weak") {
+			return VISIBILITY_WEAK
+		}
+		return VISIBILITY_EXTERNAL
+	case vari.StaticReceiverType != nil, isPublic:
+		return VISIBILITY_EXTERNAL
+	}
+	return VISIBILITY_INTERNAL
+}
@@ -115,6 +115,7 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 		}
 
 		n.Nodes = v.VisitNodes(n.Nodes)
+		n.Tail = v.VisitExpr(n.Tail)
 
 		if !n.NonScoping {
 			v.ExitScope()
@@ -169,6 +170,18 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 		n.Branches = res
 
 	case *BinaryExpr:
+		// 由约束方法实现的运算符，操作数在生成的方法调用中
+		if n.Method != nil {
+			v.VisitExpr(n.Method)
+			break
+		}
+		n.Lhand = v.VisitExpr(n.Lhand)
+		n.Rhand = v.VisitExpr(n.Rhand)
+
+	case *FloatBuiltinExpr:
+		n.Arguments = v.VisitExprs(n.Arguments)
+
+	case *OverflowArithExpr:
 		n.Lhand = v.VisitExpr(n.Lhand)
 		n.Rhand = v.VisitExpr(n.Rhand)
 
@@ -182,9 +195,17 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 		n.Array = v.Visit(n.Array).(AccessExpr)
 		n.Subscript = v.VisitExpr(n.Subscript)
 
+	case *SliceExpr:
+		n.Array = v.VisitExpr(n.Array)
+		n.Low = v.VisitExpr(n.Low)
+		n.High = v.VisitExpr(n.High)
+
 	case *SizeofExpr:
 		n.Expr = v.VisitExpr(n.Expr)
 
+	case *AlignofExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
 	case *ArrayLenExpr:
 		n.Expr = v.VisitExpr(n.Expr)
 
@@ -218,6 +239,13 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 	case *DeferStat:
 		n.Call = v.Visit(n.Call).(*CallExpr)
 
+	case *StaticAssertStat:
+		n.Cond = v.VisitExpr(n.Cond)
+
+	case *VolatileStoreStat:
+		n.Pointer = v.VisitExpr(n.Pointer)
+		n.Value = v.VisitExpr(n.Value)
+
 	case *ReferenceToExpr:
 		n.Access = v.VisitExpr(n.Access)
 
@@ -227,6 +255,27 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 	case *CastExpr:
 		n.Expr = v.VisitExpr(n.Expr)
 
+	case *BitcastExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
+	case *CStringExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
+	case *HashExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
+	case *CondExpr:
+		n.Stat = v.Visit(n.Stat)
+
+	case *NewExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
+	case *VolatileLoadExpr:
+		n.Pointer = v.VisitExpr(n.Pointer)
+
+	case *InterfaceWrapExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
 	case *LambdaExpr:
 		v.VisitFunction(n.Function)
 
@@ -239,6 +288,9 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 	case *DerefAccessExpr:
 		n.Expr = v.VisitExpr(n.Expr)
 
+	case *TempAccessExpr:
+		n.Expr = v.VisitExpr(n.Expr)
+
 	case *FunctionDecl:
 		v.VisitFunction(n.Function)
 
@@ -252,8 +304,8 @@ func (v *ASTVisitor) VisitChildren(n Node) {
 		n.ReceiverAccess = v.VisitExpr(n.ReceiverAccess)
 
 	case *NumericLiteral, *StringLiteral, *BoolLiteral, *RuneLiteral,
-		*VariableAccessExpr, *TypeDecl, *UseDirective, *BreakStat, *ContinueStat,
-		*DiscardAccessExpr, *EnumPatternExpr:
+		*VariableAccessExpr, *TypeDecl, *TypeAliasDecl, *UseDirective, *BreakStat, *ContinueStat,
+		*DiscardAccessExpr, *EnumPatternExpr, *OffsetofExpr:
 		// do nothing
 
 	default:
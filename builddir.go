@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 构建输出目录。默认情况下编译产物都放在当前目录下的 .ku-build 中：
+//
+//	.ku-build/bin        可执行文件及 --output-type 要求的其他产物
+//	.ku-build/obj        链接用的中间目标文件，以及从模块包中解压的目标文件
+//	.ku-build/pkg        package 生成的模块包
+//	.ku-build/generated  构建钩子生成的源码
+//	.ku-build/doc        docgen 生成的文档
+//	.ku-build/kui        --emit-interface 生成的模块接口文件
+//	.ku-build/cache      --emit-typed-ast 写入的带类型的语法树
+//
+// 目录中的标记文件用于确认这个目录是编译器创建的，clean 命令只删除带有标记文件的目录
+const (
+	buildDirName = ".ku-build"
+	buildDirTag  = "KUBUILD.TAG"
+
+	buildDirTagContents = "Signature: ku build directory\n# This directory is created by the ku compiler and is removed by `ku clean`.\n"
+)
+
+// ensureBuildDir 创建构建输出目录下的子目录sub，返回它的路径
+func ensureBuildDir(sub string) string {
+	dir := filepath.Join(buildDirName, sub)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		setupErr("Couldn't create build directory `%s`: %s", dir, err)
+	}
+
+	tag := filepath.Join(buildDirName, buildDirTag)
+	if _, err := os.Stat(tag); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(tag, []byte(buildDirTagContents), 0666); err != nil {
+			setupErr("Couldn't write `%s`: %s", tag, err)
+		}
+	}
+
+	return dir
+}
+
+// cleanBuildDir 删除构建输出目录。目录不存在时什么也不做；
+// 不是目录、是符号链接或者没有标记文件时拒绝删除
+func cleanBuildDir() error {
+	fi, err := os.Lstat(buildDirName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+		return fmt.Errorf("`%s` is not a directory, refusing to remove it", buildDirName)
+	}
+
+	tag, err := ioutil.ReadFile(filepath.Join(buildDirName, buildDirTag))
+	if err != nil || string(tag) != buildDirTagContents {
+		return fmt.Errorf("`%s` was not created by ku (missing %s), refusing to remove it", buildDirName, buildDirTag)
+	}
+
+	return os.RemoveAll(buildDirName)
+}
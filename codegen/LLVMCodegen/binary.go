@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/ku-lang/ku/ast"
 	"github.com/ku-lang/ku/codegen"
@@ -26,10 +27,14 @@ func (v *Codegen) createIR(mod *WrappedModule) string {
 
 func (v *Codegen) createObjectOrAssembly(mod *WrappedModule, typ llvm.CodeGenFileType) string {
 	filename := v.OutputName + "-" + mod.MangledName(ast.MANGLE_ARK_UNSTABLE)
+	if typ == llvm.ObjectFile && v.ObjDir != "" && !v.OutputType.Has(codegen.OutputObject) {
+		// 只用于链接的目标文件
+		filename = filepath.Join(v.ObjDir, filepath.Base(filename))
+	}
 	if typ == llvm.AssemblyFile {
 		filename += ".s"
 	} else {
-		filename += ".o"
+		filename += v.objectFileExt()
 	}
 
 	membuf, err := v.targetMachine.EmitToMemoryBuffer(mod.LlvmModule, typ)
@@ -45,39 +50,72 @@ func (v *Codegen) createObjectOrAssembly(mod *WrappedModule, typ llvm.CodeGenFil
 	return filename
 }
 
+// relocMode 目标代码的重定位模式。只有不带 --pic 的静态链接才生成非位置无关的代码
+func (v *Codegen) relocMode() llvm.RelocMode {
+	if v.Static && !v.PIC {
+		return llvm.RelocStatic
+	}
+	return llvm.RelocPIC
+}
+
+// linkModeArgs 与重定位模式、静态链接和去除符号相对应的链接参数
+func (v *Codegen) linkModeArgs() []string {
+	var args []string
+	switch {
+	case v.Static && v.PIC:
+		args = append(args, "-static-pie")
+	case v.Static:
+		args = append(args, "-static", "-no-pie")
+	default:
+		args = append(args, "-fPIC")
+	}
+
+	if v.Strip {
+		args = append(args, "-s")
+	}
+	return args
+}
+
 func (v *Codegen) createBinary() {
-	if v.OutputType == codegen.OutputLLVMIR {
+	if v.OutputType.Has(codegen.OutputLLVMIR) {
 		for _, mod := range v.input {
 			log.Timed("creating ir", mod.Name.String(), func() {
 				v.createIR(mod)
 			})
 		}
-		return
-	} else if v.OutputType == codegen.OutputAssembly {
+	}
+
+	if v.OutputType.Has(codegen.OutputAssembly) {
 		for _, mod := range v.input {
 			log.Timed("creating assembly", mod.Name.String(), func() {
 				v.createObjectOrAssembly(mod, llvm.AssemblyFile)
 			})
 		}
-		return
 	}
 
-	linkArgs := append(v.LinkerArgs, "-fPIC" /*"-fno-PIE",*/, "-nodefaultlibs", "-lc", "-lm")
+	if !v.OutputType.Has(codegen.OutputObject) && !v.OutputType.Has(codegen.OutputExectuably) {
+		return
+	}
 
 	objFiles := []string{}
+	libs := []string{}
 
 	for _, mod := range v.input {
 		log.Timed("creating object", mod.Name.String(), func() {
 			objName := v.createObjectOrAssembly(mod, llvm.ObjectFile)
 			objFiles = append(objFiles, objName)
-			linkArgs = append(linkArgs, objName)
-			for _, lib := range mod.LinkedLibraries {
-				linkArgs = append(linkArgs, fmt.Sprintf("-l%s", lib))
-			}
+			libs = append(libs, mod.LinkedLibraries...)
 		})
 	}
 
-	if v.OutputType == codegen.OutputObject {
+	if v.OutputType.Has(codegen.OutputObject) {
+		v.ObjectFiles = make(map[string]string)
+		for i, mod := range v.input {
+			v.ObjectFiles[mod.Name.String()] = objFiles[i]
+		}
+	}
+
+	if !v.OutputType.Has(codegen.OutputExectuably) {
 		return
 	}
 
@@ -85,14 +123,27 @@ func (v *Codegen) createBinary() {
 		panic("OutputName is empty")
 	}
 
-	linkArgs = append(linkArgs, "-o", v.OutputName)
+	linkObjects := append(objFiles[:len(objFiles):len(objFiles)], v.LinkObjects...)
+
+	var linkArgs []string
+	if v.isWindowsTarget() {
+		linkArgs = v.windowsLinkArgs(linkObjects, libs)
+	} else {
+		linkArgs = append(v.LinkerArgs, v.linkModeArgs()...)
+		linkArgs = append(linkArgs, "-nodefaultlibs", "-lc", "-lm")
+		linkArgs = append(linkArgs, linkObjects...)
+		for _, lib := range libs {
+			linkArgs = append(linkArgs, fmt.Sprintf("-l%s", lib))
+		}
+		linkArgs = append(linkArgs, "-o", v.OutputName)
+	}
 
 	if v.Linker == "" {
-		v.Linker = "cc"
+		v.Linker = v.defaultLinker()
 	}
 
 	log.Timed("linking", "", func() {
-		log.Verboseln("codegen", "%s %v", v.Linker, linkArgs)
+		log.Verboseln(log.TagCodegen, "%s %v", v.Linker, linkArgs)
 
 		cmd := exec.Command(v.Linker, linkArgs...)
 		if out, err := cmd.CombinedOutput(); err != nil {
@@ -100,7 +151,10 @@ func (v *Codegen) createBinary() {
 		}
 	})
 
-	for _, objFile := range objFiles {
-		os.Remove(objFile)
+	// 目标文件也是要求的输出时保留
+	if !v.OutputType.Has(codegen.OutputObject) {
+		for _, objFile := range objFiles {
+			os.Remove(objFile)
+		}
 	}
 }
@@ -0,0 +1,61 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// bitcast<T>(value) 按位重新解释值的类型
+//
+// 两边都是同样位数的标量（整数、浮点数、指针、向量）时直接转换：指针与整数之间用 ptrtoint/inttoptr，
+// 其余用 bitcast。否则（结构体、数组、元组，以及 bool 这样位数小于大小的类型）像联合体一样通过内存转换：
+// 把值写入按两者中较大的对齐分配的栈空间，再按目标类型读出。
+// 大小在语义检查时已经比较过，泛型函数的实例在这里再比较一次。
+
+func (v *Codegen) genBitcastExpr(n *ast.BitcastExpr) llvm.Value {
+	value := v.genExprAndLoadIfNeccesary(n.Expr)
+	from, to := value.Type(), v.typeRefToLLVMType(n.Type)
+	if from == to {
+		return value
+	}
+
+	if v.targetData.TypeAllocSize(from) != v.targetData.TypeAllocSize(to) {
+		v.err("Cannot bitcast `%s` (%d bytes) to `%s` (%d bytes), the sizes differ",
+			n.Expr.GetType().String(), v.targetData.TypeAllocSize(from), n.Type.String(), v.targetData.TypeAllocSize(to))
+	}
+
+	fromKind, toKind := from.TypeKind(), to.TypeKind()
+	switch {
+	case fromKind == llvm.PointerTypeKind && toKind == llvm.PointerTypeKind:
+		return v.builder().CreateBitCast(value, to, "")
+	case fromKind == llvm.PointerTypeKind && toKind == llvm.IntegerTypeKind:
+		return v.builder().CreatePtrToInt(value, to, "")
+	case fromKind == llvm.IntegerTypeKind && toKind == llvm.PointerTypeKind:
+		return v.builder().CreateIntToPtr(value, to, "")
+	case isScalarType(from) && isScalarType(to) && v.targetData.TypeSizeInBits(from) == v.targetData.TypeSizeInBits(to):
+		return v.builder().CreateBitCast(value, to, "")
+	}
+
+	if !v.inFunction() {
+		v.err("Cannot bitcast `%s` to `%s` in a global initializer", n.Expr.GetType().String(), n.Type.String())
+	}
+
+	// 通过内存转换，分配的空间满足两个类型的对齐
+	slotType := from
+	if v.targetData.ABITypeAlignment(to) > v.targetData.ABITypeAlignment(from) {
+		slotType = to
+	}
+	slot := v.createAlignedAlloca(slotType, "bitcast")
+	v.builder().CreateStore(value, v.builder().CreateBitCast(slot, llvm.PointerType(from, 0), ""))
+	return v.builder().CreateLoad(v.builder().CreateBitCast(slot, llvm.PointerType(to, 0), ""), "")
+}
+
+// isScalarType 可以直接用LLVM的bitcast转换的类型
+func isScalarType(typ llvm.Type) bool {
+	switch typ.TypeKind() {
+	case llvm.IntegerTypeKind, llvm.FloatTypeKind, llvm.DoubleTypeKind, llvm.FP128TypeKind,
+		llvm.X86_FP80TypeKind, llvm.VectorTypeKind:
+		return true
+	}
+	return false
+}
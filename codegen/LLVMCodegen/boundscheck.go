@@ -0,0 +1,216 @@
+package LLVMCodegen
+
+import (
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 循环中的数组边界检查消除
+//
+// 对于形如
+//
+//	for i < len(a) {
+//	    x := a[i]
+//	    ...
+//	    i += 1
+//	}
+//
+// 的循环，每次进入循环体时都有 i < len(a)。如果 a 是不可修改的局部变量或参数（长度不会改变），
+// i 是没有被取过地址的局部变量，那么在循环体中第一次修改 i 之前的 a[i] 都不需要检查上界；
+// i 是无符号数时连下界检查也不需要。
+
+// markLoopBoundsChecks 分析条件循环，记录循环体中不需要上界检查的数组访问
+func (v *Codegen) markLoopBoundsChecks(n *ast.LoopStat) {
+	array, index := loopBoundsCondition(n.Condition)
+	if array == nil || array.Mutable {
+		return
+	}
+
+	info := v.functionVariableInfo(v.currentFunction().fn)
+	if !info.locals[index] || info.addressTaken[index] {
+		return
+	}
+
+	for _, node := range n.Body.Nodes {
+		scanner := &boundsCheckScanner{array: array, index: index}
+		ast.NewASTVisitor(scanner).Visit(node)
+		if scanner.writesIndex {
+			break
+		}
+
+		for _, access := range scanner.accesses {
+			v.uncheckedAccesses[access] = true
+		}
+	}
+}
+
+// loopBoundsCondition 匹配循环条件 i < len(a) 或 len(a) > i，返回 a 和 i
+func loopBoundsCondition(cond ast.Expr) (array, index *ast.Variable) {
+	binop, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return nil, nil
+	}
+
+	var indexExpr, lenExpr ast.Expr
+	switch binop.Op {
+	case parser.BINOP_LESS:
+		indexExpr, lenExpr = binop.Lhand, binop.Rhand
+	case parser.BINOP_GREATER:
+		indexExpr, lenExpr = binop.Rhand, binop.Lhand
+	default:
+		return nil, nil
+	}
+
+	indexAccess, ok := indexExpr.(*ast.VariableAccessExpr)
+	if !ok {
+		return nil, nil
+	}
+
+	arrayLen, ok := lenExpr.(*ast.ArrayLenExpr)
+	if !ok {
+		return nil, nil
+	}
+	arrayAccess, ok := arrayLen.Expr.(*ast.VariableAccessExpr)
+	if !ok {
+		return nil, nil
+	}
+
+	return arrayAccess.Variable, indexAccess.Variable
+}
+
+type variableInfo struct {
+	locals       map[*ast.Variable]bool     // 参数和函数体中声明的变量
+	addressTaken map[*ast.Variable]bool     // 被 & 或 ^ 取过地址的变量
+	assigned     map[*ast.Variable]bool     // 声明之后被赋值过的变量
+	initializers map[*ast.Variable]ast.Expr // 局部变量声明时的初始值
+}
+
+func (v *Codegen) functionVariableInfo(fn *ast.Function) *variableInfo {
+	if info, ok := v.variableInfos[fn]; ok {
+		return info
+	}
+
+	info := &variableInfo{
+		locals:       make(map[*ast.Variable]bool),
+		addressTaken: make(map[*ast.Variable]bool),
+		assigned:     make(map[*ast.Variable]bool),
+		initializers: make(map[*ast.Variable]ast.Expr),
+	}
+	if fn.Receiver != nil {
+		info.locals[fn.Receiver.Variable] = true
+	}
+	for _, param := range fn.Parameters {
+		info.locals[param.Variable] = true
+	}
+	if fn.Body != nil {
+		ast.NewASTVisitor(info).VisitBlock(fn.Body)
+	}
+
+	v.variableInfos[fn] = info
+	return info
+}
+
+func (v *variableInfo) EnterScope()         {}
+func (v *variableInfo) ExitScope()          {}
+func (v *variableInfo) PostVisit(*ast.Node) {}
+
+func (v *variableInfo) Visit(node *ast.Node) bool {
+	switch n := (*node).(type) {
+	case *ast.VariableDecl:
+		v.locals[n.Variable] = true
+		if n.Assignment != nil {
+			v.initializers[n.Variable] = n.Assignment
+		}
+	case *ast.AssignStat:
+		v.markAssigned(n.Access)
+	case *ast.BinopAssignStat:
+		v.markAssigned(n.Access)
+	case *ast.DestructAssignStat:
+		for _, acc := range n.Accesses {
+			v.markAssigned(acc)
+		}
+	case *ast.DestructBinopAssignStat:
+		for _, acc := range n.Accesses {
+			v.markAssigned(acc)
+		}
+	case *ast.ReferenceToExpr:
+		if root := accessRootVariable(n.Access); root != nil {
+			v.addressTaken[root] = true
+		}
+	case *ast.PointerToExpr:
+		if root := accessRootVariable(n.Access); root != nil {
+			v.addressTaken[root] = true
+		}
+	}
+	return true
+}
+
+func (v *variableInfo) markAssigned(access ast.Expr) {
+	if root := accessRootVariable(access); root != nil {
+		v.assigned[root] = true
+	}
+}
+
+// boundsCheckScanner 在一条语句中查找 a[i] 访问，以及对 i 的修改
+type boundsCheckScanner struct {
+	array, index *ast.Variable
+
+	accesses    []*ast.ArrayAccessExpr
+	writesIndex bool
+}
+
+func (v *boundsCheckScanner) EnterScope()         {}
+func (v *boundsCheckScanner) ExitScope()          {}
+func (v *boundsCheckScanner) PostVisit(*ast.Node) {}
+
+func (v *boundsCheckScanner) Visit(node *ast.Node) bool {
+	switch n := (*node).(type) {
+	case *ast.LambdaExpr:
+		return false
+
+	case *ast.AssignStat:
+		v.checkWrite(n.Access)
+	case *ast.BinopAssignStat:
+		v.checkWrite(n.Access)
+	case *ast.DestructAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(acc)
+		}
+	case *ast.DestructBinopAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(acc)
+		}
+
+	case *ast.ArrayAccessExpr:
+		array, ok := n.Array.(*ast.VariableAccessExpr)
+		if !ok || array.Variable != v.array {
+			break
+		}
+		if index, ok := n.Subscript.(*ast.VariableAccessExpr); ok && index.Variable == v.index {
+			v.accesses = append(v.accesses, n)
+		}
+	}
+	return true
+}
+
+func (v *boundsCheckScanner) checkWrite(access ast.Expr) {
+	if accessRootVariable(access) == v.index {
+		v.writesIndex = true
+	}
+}
+
+// accessRootVariable 返回访问表达式所在的变量，经过指针解引用时返回nil
+func accessRootVariable(expr ast.Expr) *ast.Variable {
+	switch n := expr.(type) {
+	case *ast.VariableAccessExpr:
+		return n.Variable
+	case *ast.StructAccessExpr:
+		return accessRootVariable(n.Struct)
+	case *ast.ArrayAccessExpr:
+		if _, ok := n.Array.GetType().BaseType.ActualType().(ast.PointerType); ok {
+			return nil
+		}
+		return accessRootVariable(n.Array)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 函数值
+//
+// 函数类型的值是闭包 {函数指针, 环境指针}，两个成员都是 i8*：
+//   - 函数和lambda作为值时没有环境，环境指针为null，函数指针直接指向函数；
+//   - 方法值（obj.method）的环境指针是接收者的地址，函数指针指向方法的绑定函数（参见 boundMethodThunk），
+//     绑定函数的第一个参数是环境指针，后面是方法的参数。接口值的方法表中存放的也是绑定函数（参见 interface.go）。
+//
+// 通过函数值调用时根据环境指针是否为null选择调用的方式。方法值引用接收者，不能在接收者的生存期之后调用。
+// 直接调用函数（FunctionAccessExpr）不经过闭包。
+// C函数的参数和返回值使用原始的函数指针，只能传递函数和lambda（参见 semantic.TypeCheck.CheckCallExpr），
+// 它们直接生成为函数指针，参见 genCallArgs
+
+// closureType 函数值的类型
+func (v *Codegen) closureType() llvm.Type {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+	return llvm.StructType([]llvm.Type{i8ptr, i8ptr}, false)
+}
+
+// genFunctionValue 把函数转换为没有环境的函数值
+func (v *Codegen) genFunctionValue(fn llvm.Value) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+	return llvm.ConstStruct([]llvm.Value{llvm.ConstBitCast(fn, i8ptr), llvm.ConstNull(i8ptr)}, false)
+}
+
+// genMethodValue 生成方法值，返回存放闭包的地址
+func (v *Codegen) genMethodValue(n *ast.StructAccessExpr) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	recType := n.Struct.GetType()
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		recType = gcon.Replace(recType)
+	}
+
+	// 接口值的方法表中就是绑定函数，环境指针是装箱的值的地址
+	if v.isInterfaceValue(recType) {
+		fnPtr, data := v.genInterfaceMethod(v.genExprAndLoadIfNeccesary(n.Struct), recType, n.Method.Function)
+		closure := llvm.Undef(v.closureType())
+		closure = v.builder().CreateInsertValue(closure, fnPtr, 0, "")
+		closure = v.builder().CreateInsertValue(closure, data, 1, "")
+
+		alloc := v.createAlignedAlloca(v.closureType(), "method_value")
+		v.builder().CreateStore(closure, alloc)
+		return alloc
+	}
+
+	// 环境指针是接收者的地址
+	var env llvm.Value
+	if ast.IsPointerOrReferenceType(recType.BaseType) {
+		env = v.genExprAndLoadIfNeccesary(n.Struct)
+	} else {
+		env = v.genAccessGEP(n.Struct)
+	}
+
+	_, pointerReceiver := n.Method.Function.Type.Receiver.BaseType.(ast.PointerType)
+	thunk := v.boundMethodThunk(v.genAccessExpr(n.Method), !pointerReceiver)
+
+	closure := llvm.Undef(v.closureType())
+	closure = v.builder().CreateInsertValue(closure, llvm.ConstBitCast(thunk, i8ptr), 0, "")
+	closure = v.builder().CreateInsertValue(closure, v.builder().CreateBitCast(env, i8ptr, ""), 1, "")
+
+	alloc := v.createAlignedAlloca(v.closureType(), "method_value")
+	v.builder().CreateStore(closure, alloc)
+	return alloc
+}
+
+// boundMethodThunk 方法的绑定函数：由环境指针得到接收者，再调用方法。
+// 接收者是值时从环境指针读出接收者。每个模块中每个方法只生成一次
+func (v *Codegen) boundMethodThunk(method llvm.Value, valueReceiver bool) llvm.Value {
+	name := method.Name() + ".bound"
+	if thunk := v.curFile.LlvmModule.NamedFunction(name); !thunk.IsNil() {
+		return thunk
+	}
+
+	methodType := method.Type().ElementType()
+	params := methodType.ParamTypes()
+	thunkParams := append([]llvm.Type{llvm.PointerType(llvm.IntType(8), 0)}, params[1:]...)
+	thunk := llvm.AddFunction(v.curFile.LlvmModule, name, llvm.FunctionType(methodType.ReturnType(), thunkParams, false))
+	thunk.SetLinkage(llvm.InternalLinkage)
+
+	builder := llvm.NewBuilder()
+	defer builder.Dispose()
+	builder.SetInsertPointAtEnd(llvm.AddBasicBlock(thunk, "entry"))
+
+	var receiver llvm.Value
+	if valueReceiver {
+		receiver = builder.CreateLoad(builder.CreateBitCast(thunk.Param(0), llvm.PointerType(params[0], 0), ""), "")
+	} else {
+		receiver = builder.CreateBitCast(thunk.Param(0), params[0], "")
+	}
+
+	args := append([]llvm.Value{receiver}, thunk.Params()[1:]...)
+	call := builder.CreateCall(method, args, "")
+	call.SetInstructionCallConv(method.FunctionCallConv())
+
+	if methodType.ReturnType().TypeKind() == llvm.VoidTypeKind {
+		builder.CreateRetVoid()
+	} else {
+		builder.CreateRet(call)
+	}
+	return thunk
+}
+
+// genClosureCall 通过函数值调用：有环境时把环境指针作为第一个参数
+func (v *Codegen) genClosureCall(closure llvm.Value, fnType ast.FunctionType, args []llvm.Value) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	plainType := v.functionTypeToLLVMType(fnType, false, nil)
+	boundType := llvm.FunctionType(plainType.ReturnType(), append([]llvm.Type{i8ptr}, plainType.ParamTypes()...), plainType.IsFunctionVarArg())
+
+	fnPtr := v.builder().CreateExtractValue(closure, 0, "")
+	env := v.builder().CreateExtractValue(closure, 1, "")
+
+	boundBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "closure_bound")
+	plainBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "closure_plain")
+	exit := llvm.AddBasicBlock(v.currentLLVMFunction(), "closure_exit")
+
+	isBound := v.builder().CreateICmp(llvm.IntNE, env, llvm.ConstNull(i8ptr), "")
+	v.builder().CreateCondBr(isBound, boundBlock, plainBlock)
+
+	v.builder().SetInsertPointAtEnd(boundBlock)
+	boundFn := v.builder().CreateBitCast(fnPtr, llvm.PointerType(boundType, 0), "")
+	boundRes := v.builder().CreateCall(boundFn, append([]llvm.Value{env}, args...), "")
+	v.builder().CreateBr(exit)
+
+	v.builder().SetInsertPointAtEnd(plainBlock)
+	plainFn := v.builder().CreateBitCast(fnPtr, llvm.PointerType(plainType, 0), "")
+	plainRes := v.builder().CreateCall(plainFn, args, "")
+	v.builder().CreateBr(exit)
+
+	v.builder().SetInsertPointAtEnd(exit)
+	if plainType.ReturnType().TypeKind() == llvm.VoidTypeKind {
+		return plainRes
+	}
+
+	phi := v.builder().CreatePHI(plainType.ReturnType(), "closure_res")
+	phi.AddIncoming([]llvm.Value{boundRes, plainRes}, []llvm.BasicBlock{boundBlock, plainBlock})
+	return phi
+}
+
+// cFunctionToClosure C函数返回的函数指针转换为没有环境的函数值
+func (v *Codegen) cFunctionToClosure(fn llvm.Value) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+	closure := llvm.Undef(v.closureType())
+	closure = v.builder().CreateInsertValue(closure, v.builder().CreateBitCast(fn, i8ptr, ""), 0, "")
+	return v.builder().CreateInsertValue(closure, llvm.ConstNull(i8ptr), 1, "")
+}
@@ -2,7 +2,7 @@ package LLVMCodegen
 
 import (
 	"fmt"
-	"os"
+	"math"
 
 	"github.com/ku-lang/ku/ast"
 	"github.com/ku-lang/ku/codegen"
@@ -14,11 +14,6 @@ import (
 	"github.com/ark-lang/go-llvm/llvm"
 )
 
-// Assorted "constants" used in the codegen. Do not ever set them, only read them
-var (
-	enumTagType = llvm.IntType(32)
-)
-
 type functionAndFnGenericInstance struct {
 	fn   *ast.Function
 	gcon *ast.GenericContext // nil for no generics
@@ -50,6 +45,14 @@ type Codegen struct {
 	LinkerArgs []string
 	Linker     string // defaults to cc
 	OptLevel   int
+	Target     string // 目标三元组或预置目标名（如linux-arm64），为空时为本机生成代码
+	PIC        bool   // 静态链接时仍然生成位置无关代码（static-pie）。非静态链接时总是位置无关的
+	Static     bool   // 静态链接，生成不依赖动态库的可执行文件
+	Strip      bool   // 链接时去除符号表
+	ObjDir     string // 链接用的中间目标文件所在的目录，为空时与输出文件放在一起
+
+	LinkObjects []string          // 一起链接的预编译目标文件，如模块包中的目标文件
+	ObjectFiles map[string]string // 生成的目标文件，模块名 -> 路径。只在输出目标文件时填写
 
 	// private stuff
 	input   []*WrappedModule
@@ -58,12 +61,26 @@ type Codegen struct {
 	builders      map[functionAndFnGenericInstance]llvm.Builder      // map of functions to builders
 	curLoopExits  map[functionAndFnGenericInstance][]llvm.BasicBlock // map of functions to slices of blocks, where each block is the exit block for current loops
 	curLoopNexts  map[functionAndFnGenericInstance][]llvm.BasicBlock // map of functions to slices of blocks, where each block is the eval block for current loops
+	curLoopDepths map[functionAndFnGenericInstance][]int             // 当前循环的循环体在 inBlocks 中的位置，见 genRunLoopDefers
 	curSegvBlocks map[functionAndFnGenericInstance]llvm.BasicBlock
 
+	structGEPs map[structGEPKey]llvm.Value // 基本块中已经计算过的结构体成员地址，见 genStructGEP
+
+	readNoneFunctions map[*ast.Function]bool         // 能证明不访问内存的纯函数，见 purity.go
+	pureCalls         map[llvm.BasicBlock][]pureCall // 基本块中对这些函数的调用，见 reusePureCall
+
+	uncheckedAccesses map[*ast.ArrayAccessExpr]bool // 由循环条件保证不越上界的数组访问，见 markLoopBoundsChecks
+	variableInfos     map[*ast.Function]*variableInfo
+
+	pooledStringLiterals map[*ast.StringLiteral]bool               // 直接指向常量池的字符串字面量，见 strlit.go
+	knownCallees         map[*ast.CallExpr]*ast.FunctionAccessExpr // 被调用函数已知的间接调用，见 devirt.go
+
 	globalBuilder   llvm.Builder // used non-function stuff
 	variableLookup  map[variableAndFnGenericInstance]llvm.Value
 	namedTypeLookup map[string]llvm.Type
 
+	structFieldOrders map[llvm.Type][]int // 重排了成员的结构体类型 -> 每个成员的位置，见 layout.go
+
 	declForFunction map[*ast.Function]*ast.FunctionDecl
 
 	referenceAccess bool
@@ -74,6 +91,9 @@ type Codegen struct {
 	inBlocks       map[functionAndFnGenericInstance][]*ast.Block
 	blockDeferData map[*ast.Block][]*deferData // TODO make sure works with generics
 
+	tailValues []llvm.Value // 正在生成的作为表达式的if和match存放值的位置，见 condexpr.go
+	cstrCalls  []*cstrCall  // 正在生成的有隐式C字符串实参的调用，见 cstring.go
+
 	// size calculation stuff
 	target        llvm.Target
 	targetMachine llvm.TargetMachine
@@ -110,6 +130,9 @@ func (v *Codegen) currentLLVMFunction() llvm.Value {
 	if curFn.fn.Type.Attrs().Contains("nomangle") || curFn.fn.Anonymous {
 		name = curFn.fn.Name
 	}
+	if hook := ast.HookName(curFn.fn); hook != "" {
+		name = ast.HookSymbol(hook)
+	}
 	return v.curFile.LlvmModule.NamedFunction(name)
 }
 
@@ -142,12 +165,14 @@ type WrappedModule struct {
 type deferData struct {
 	stat *ast.DeferStat
 	args []llvm.Value
+	drop *ast.Variable // 离开块时drop的变量，这时stat为nil，见 drop.go
+	cstr llvm.Value    // 离开块时释放的C字符串缓冲区的位置，这时stat为nil，见 cstring.go
 }
 
 func (v *Codegen) err(err string, stuff ...interface{}) {
-	log.Error("codegen", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
+	log.Error(log.TagCodegen, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
 		fmt.Sprintf(err, stuff...))
-	os.Exit(util.EXIT_FAILURE_CODEGEN)
+	util.ExitFunc(util.EXIT_FAILURE_CODEGEN)
 }
 
 func (v *Codegen) Generate(input []*ast.Module) {
@@ -158,7 +183,15 @@ func (v *Codegen) Generate(input []*ast.Module) {
 
 	v.curLoopExits = make(map[functionAndFnGenericInstance][]llvm.BasicBlock)
 	v.curLoopNexts = make(map[functionAndFnGenericInstance][]llvm.BasicBlock)
+	v.curLoopDepths = make(map[functionAndFnGenericInstance][]int)
 	v.curSegvBlocks = make(map[functionAndFnGenericInstance]llvm.BasicBlock)
+	v.structGEPs = make(map[structGEPKey]llvm.Value)
+	v.readNoneFunctions = make(map[*ast.Function]bool)
+	v.pureCalls = make(map[llvm.BasicBlock][]pureCall)
+	v.uncheckedAccesses = make(map[*ast.ArrayAccessExpr]bool)
+	v.pooledStringLiterals = make(map[*ast.StringLiteral]bool)
+	v.knownCallees = make(map[*ast.CallExpr]*ast.FunctionAccessExpr)
+	v.variableInfos = make(map[*ast.Function]*variableInfo)
 
 	v.declForFunction = make(map[*ast.Function]*ast.FunctionDecl)
 
@@ -169,20 +202,10 @@ func (v *Codegen) Generate(input []*ast.Module) {
 
 	v.variableLookup = make(map[variableAndFnGenericInstance]llvm.Value)
 	v.namedTypeLookup = make(map[string]llvm.Type)
+	v.structFieldOrders = make(map[llvm.Type][]int)
 
 	// initialize llvm target
-	llvm.InitializeNativeTarget()
-	llvm.InitializeNativeAsmPrinter()
-	llvm.InitializeAllAsmParsers()
-
-	// setup target stuff
-	var err error
-	v.target, err = llvm.GetTargetFromTriple(llvm.DefaultTargetTriple())
-	if err != nil {
-		panic(err)
-	}
-	v.targetMachine = v.target.CreateTargetMachine(llvm.DefaultTargetTriple(), "", "", llvm.CodeGenLevelNone, llvm.RelocPIC, llvm.CodeModelDefault)
-	v.targetData = v.targetMachine.TargetData()
+	v.initializeTarget()
 
 	passManager := llvm.NewPassManager()
 	passBuilder := llvm.NewPassManagerBuilder()
@@ -196,9 +219,15 @@ func (v *Codegen) Generate(input []*ast.Module) {
 	for _, infile := range v.input {
 		log.Timed("codegenning", infile.Name.String(), func() {
 			infile.LlvmModule = llvm.NewModule(infile.Name.String())
+			v.setModuleTarget(infile.LlvmModule)
 			v.curFile = infile
+			v.markPooledStringLiterals(infile)
+			if !infile.Interface {
+				v.markKnownCallees(infile)
+			}
 
 			for _, submod := range infile.Parts {
+				v.checkStaticAsserts(submod)
 				v.declareDecls(submod.Nodes)
 
 				for _, node := range submod.Nodes {
@@ -261,6 +290,9 @@ func (v *Codegen) recursiveGenericFunctionHelper(n *ast.FunctionDecl, access *as
 }
 
 func (v *Codegen) declareDecls(nodes []ast.Node) {
+	// 嵌套函数也先声明，外层函数中声明之前的代码（以及嵌套函数自己）可以调用它们。函数体在外层函数中生成，与lambda相同
+	nodes = append(nodes[:len(nodes):len(nodes)], nestedFunctionDecls(nodes)...)
+
 	for _, node := range nodes {
 		switch n := node.(type) {
 		case *ast.FunctionDecl:
@@ -284,7 +316,46 @@ func (v *Codegen) declareDecls(nodes []ast.Node) {
 	}
 }
 
-var nonPublicLinkage = llvm.InternalLinkage
+// nestedFunctionDecls 函数体中声明的嵌套函数，包括嵌套函数中的
+func nestedFunctionDecls(nodes []ast.Node) []ast.Node {
+	collector := &nestedFunctionCollector{}
+	visitor := ast.NewASTVisitor(collector)
+	for _, node := range nodes {
+		visitor.Visit(node)
+	}
+	return collector.decls
+}
+
+type nestedFunctionCollector struct {
+	decls []ast.Node
+}
+
+func (v *nestedFunctionCollector) Visit(n *ast.Node) bool {
+	if decl, ok := (*n).(*ast.FunctionDecl); ok && decl.Function.Outer != nil {
+		v.decls = append(v.decls, decl)
+	}
+	return true
+}
+
+func (v *nestedFunctionCollector) PostVisit(n *ast.Node) {}
+func (v *nestedFunctionCollector) EnterScope()           {}
+func (v *nestedFunctionCollector) ExitScope()            {}
+
+// symbolLinkage 可见性（参见 ast/visibility.go）对应的链接属性。declaration为true时符号只声明，定义在别处
+func symbolLinkage(vis ast.Visibility, declaration bool) llvm.Linkage {
+	switch {
+	case declaration && vis == ast.VISIBILITY_WEAK:
+		// [weak] 的C变量在链接时可以没有定义，这时地址为null
+		return llvm.ExternalWeakLinkage
+	case declaration:
+		return llvm.ExternalLinkage
+	case vis == ast.VISIBILITY_INTERNAL:
+		return llvm.InternalLinkage
+	case vis == ast.VISIBILITY_WEAK:
+		return llvm.WeakAnyLinkage
+	}
+	return llvm.ExternalLinkage
+}
 
 var callConvTypes = map[string]llvm.CallConv{
 	"c":           llvm.CCallConv,
@@ -294,6 +365,11 @@ var callConvTypes = map[string]llvm.CallConv{
 	"x86fastcall": llvm.X86FastcallCallConv,
 }
 
+var paramAttrType = map[string]llvm.Attribute{
+	"noalias":  llvm.NoAliasAttribute,
+	"readonly": llvm.ReadOnlyAttribute,
+}
+
 var inlineAttrType = map[string]llvm.Attribute{
 	"always": llvm.AlwaysInlineAttribute,
 	"never":  llvm.NoInlineAttribute,
@@ -305,6 +381,9 @@ func (v *Codegen) declareFunctionDecl(n *ast.FunctionDecl, gcon *ast.GenericCont
 	if n.Function.Type.Attrs().Contains("nomangle") {
 		mangledName = n.Function.Name
 	}
+	if hook := ast.HookName(n.Function); hook != "" {
+		mangledName = ast.HookSymbol(hook)
+	}
 
 	function := v.curFile.LlvmModule.NamedFunction(mangledName)
 	if !function.IsNil() {
@@ -325,9 +404,8 @@ func (v *Codegen) declareFunctionDecl(n *ast.FunctionDecl, gcon *ast.GenericCont
 		// add that shit
 		function = llvm.AddFunction(v.curFile.LlvmModule, functionName, funcType)
 
-		if !cBinding && !n.IsPublic() {
-			function.SetLinkage(nonPublicLinkage)
-		}
+		// 钩子的默认实现是弱符号，可以被用户程序中的同名强符号替换；非公开的函数是内部符号
+		function.SetLinkage(symbolLinkage(ast.FunctionVisibility(n), n.Prototype || cBinding))
 
 		if ccAttr := attrs.Get("call_conv"); ccAttr != nil {
 			// TODO: move value checking to parser?
@@ -342,6 +420,29 @@ func (v *Codegen) declareFunctionDecl(n *ast.FunctionDecl, gcon *ast.GenericCont
 			function.AddFunctionAttr(inlineAttrType[inlineAttr.Value])
 		}
 
+		// 标注了 [pure] 的函数：能证明不访问任何内存时是 readnone，否则只读（readonly），参见 purity.go
+		if attrs.Contains("pure") {
+			if pureFunctionReadsNone(n.Function, gcon) {
+				function.AddFunctionAttr(llvm.ReadNoneAttribute)
+			} else {
+				function.AddFunctionAttr(llvm.ReadOnlyAttribute)
+			}
+			function.AddFunctionAttr(llvm.NoUnwindAttribute)
+		}
+
+		params := n.Function.Parameters
+		paramOffset := 0
+		if n.Function.Receiver != nil {
+			paramOffset = 1
+		}
+		for idx, param := range params {
+			for key, attr := range paramAttrType {
+				if param.Variable.Attrs.Contains(key) {
+					function.Param(idx + paramOffset).AddAttribute(attr)
+				}
+			}
+		}
+
 		/*// do some magical shit for later
 		for i := 0; i < numOfParams; i++ {
 			funcParam := function.Param(i)
@@ -362,8 +463,9 @@ func (v *Codegen) getVariable(vari variableAndFnGenericInstance) llvm.Value {
 	}
 
 	if vari.variable.ParentModule != v.curFile.Module {
-		value := llvm.AddGlobal(v.curFile.LlvmModule, v.typeRefToLLVMType(vari.variable.Type), vari.variable.MangledName(ast.MANGLE_ARK_UNSTABLE))
-		value.SetLinkage(llvm.ExternalLinkage)
+		value := llvm.AddGlobal(v.curFile.LlvmModule, v.typeRefToLLVMType(vari.variable.Type), variableSymbol(vari.variable))
+		value.SetLinkage(symbolLinkage(ast.VariableVisibility(true, vari.variable), true))
+		value.SetThreadLocal(vari.variable.Attrs.Contains("thread_local"))
 		v.variableLookup[vari] = value
 		return value
 	}
@@ -412,21 +514,37 @@ func (v *Codegen) genStat(n ast.Stat) {
 		v.genMatchStat(n)
 	case *ast.DeferStat:
 		v.genDeferStat(n)
+	case *ast.StaticAssertStat:
+		// 已经在生成代码之前检查过了
+	case *ast.VolatileStoreStat:
+		v.genVolatileStoreStat(n)
 	default:
 		panic("unimplemented stat")
 	}
 }
 
 func (v *Codegen) genBreakStat(n *ast.BreakStat) {
+	v.genRunLoopDefers()
 	curExits := v.curLoopExits[v.currentFunction()]
 	v.builder().CreateBr(curExits[len(curExits)-1])
 }
 
 func (v *Codegen) genContinueStat(n *ast.ContinueStat) {
+	v.genRunLoopDefers()
 	curNexts := v.curLoopNexts[v.currentFunction()]
 	v.builder().CreateBr(curNexts[len(curNexts)-1])
 }
 
+// genRunLoopDefers break和continue离开了当前循环的循环体及其中的块，从内到外执行它们的defer和drop
+func (v *Codegen) genRunLoopDefers() {
+	fn := v.currentFunction()
+	depths := v.curLoopDepths[fn]
+	blocks := v.inBlocks[fn]
+	for i := len(blocks) - 1; i >= depths[len(depths)-1]; i-- {
+		v.genRunDefers(blocks[i], nil)
+	}
+}
+
 func (v *Codegen) genDeferStat(n *ast.DeferStat) {
 	data := &deferData{
 		stat: n,
@@ -436,11 +554,22 @@ func (v *Codegen) genDeferStat(n *ast.DeferStat) {
 	v.blockDeferData[v.currentBlock()] = append(v.blockDeferData[v.currentBlock()], data)
 }
 
-func (v *Codegen) genRunDefers(block *ast.Block) {
+// genRunDefers 按逆序执行块中的defer和drop。moved是return移出函数的变量，不drop
+func (v *Codegen) genRunDefers(block *ast.Block, moved *ast.Variable) {
 	deferDat := v.blockDeferData[block]
 
 	if len(deferDat) > 0 {
 		for i := len(deferDat) - 1; i >= 0; i-- {
+			if vari := deferDat[i].drop; vari != nil {
+				if vari != moved {
+					v.genDropVariable(vari)
+				}
+				continue
+			}
+			if slot := deferDat[i].cstr; !slot.IsNil() {
+				v.genReleaseCString(slot)
+				continue
+			}
 			v.genCallExprWithArgs(deferDat[i].stat.Call, deferDat[i].args)
 		}
 	}
@@ -451,11 +580,19 @@ func (v *Codegen) genBlock(n *ast.Block) {
 	for i, x := range n.Nodes {
 		v.genNode(x)
 
-		if i == len(n.Nodes)-1 && !n.IsTerminating {
-			v.genRunDefers(n)
+		// break和continue已经执行了defer，见 genRunLoopDefers
+		if i == len(n.Nodes)-1 && n.Tail == nil && !n.IsTerminating && !isBreakOrNext(x) {
+			v.genRunDefers(n, nil)
 		}
 	}
 
+	// 代码块的值在执行defer之前求值，移出了代码块
+	if n.Tail != nil {
+		value := v.genMoveExpr(n.Tail)
+		v.builder().CreateStore(value, v.tailValues[len(v.tailValues)-1])
+		v.genRunDefers(n, nil)
+	}
+
 	delete(v.blockDeferData, n)
 	v.popBlock()
 }
@@ -466,8 +603,14 @@ func (v *Codegen) genReturnStat(n *ast.ReturnStat) {
 		ret = v.genExprAndLoadIfNeccesary(n.Value)
 	}
 
+	// 返回的变量移出了函数，参见 ast/drop.go
+	var moved *ast.Variable
+	if vae, ok := n.Value.(*ast.VariableAccessExpr); ok {
+		moved = vae.Variable
+	}
+
 	for i := len(v.inBlocks[v.currentFunction()]) - 1; i >= 0; i-- {
-		v.genRunDefers(v.inBlocks[v.currentFunction()][i])
+		v.genRunDefers(v.inBlocks[v.currentFunction()][i], moved)
 	}
 
 	if n.Value == nil {
@@ -486,7 +629,9 @@ func (v *Codegen) genCallStat(n *ast.CallStat) {
 }
 
 func (v *Codegen) genAssignStat(n *ast.AssignStat) {
-	v.genAssign(n.Access, v.genExprAndLoadIfNeccesary(n.Assignment))
+	value := v.genMoveExpr(n.Assignment)
+	v.genDropBeforeAssign(n.Access)
+	v.genAssign(n.Access, value)
 }
 
 func (v *Codegen) genBinopAssignStat(n *ast.BinopAssignStat) {
@@ -494,7 +639,7 @@ func (v *Codegen) genBinopAssignStat(n *ast.BinopAssignStat) {
 }
 
 func (v *Codegen) genDestructAssignStat(n *ast.DestructAssignStat) {
-	assignment := v.genExprAndLoadIfNeccesary(n.Assignment)
+	assignment := v.genMoveExpr(n.Assignment)
 	for idx, acc := range n.Accesses {
 		value := v.builder().CreateExtractValue(assignment, idx, "")
 		v.genAssign(acc, value)
@@ -527,7 +672,12 @@ func (v *Codegen) genBinopAssign(op parser.BinOpType, acc ast.AccessExpr, value
 	storage := v.genAccessGEP(acc)
 	storageValue := v.builder().CreateLoad(storage, "")
 
-	result := v.genBinop(op, acc.GetType(), acc.GetType(), valueType, storageValue, value)
+	var result llvm.Value
+	if isCheckedDurationOp(op, acc.GetType()) {
+		result = v.genDurationArith(op, storageValue, value)
+	} else {
+		result = v.genBinop(op, acc.GetType(), acc.GetType(), valueType, storageValue, value)
+	}
 	v.builder().CreateStore(result, storage)
 }
 
@@ -597,6 +747,7 @@ func (v *Codegen) genLoopStat(n *ast.LoopStat) {
 		afterBlock = llvm.AddBasicBlock(v.currentLLVMFunction(), "loop_exit")
 	}
 	v.curLoopExits[curfn] = append(v.curLoopExits[curfn], afterBlock)
+	v.curLoopDepths[curfn] = append(v.curLoopDepths[curfn], len(v.inBlocks[curfn]))
 
 	switch n.LoopType {
 	case ast.LOOP_TYPE_INFINITE:
@@ -623,6 +774,7 @@ func (v *Codegen) genLoopStat(n *ast.LoopStat) {
 		v.builder().CreateCondBr(cond, loopBlock, afterBlock)
 
 		v.builder().SetInsertPointAtEnd(loopBlock)
+		v.markLoopBoundsChecks(n)
 		v.genBlock(n.Body)
 
 		if !isBreakOrNext(n.Body.LastNode()) {
@@ -638,12 +790,18 @@ func (v *Codegen) genLoopStat(n *ast.LoopStat) {
 
 	v.curLoopExits[curfn] = v.curLoopExits[curfn][:len(v.curLoopExits[curfn])-1]
 	v.curLoopNexts[curfn] = v.curLoopNexts[curfn][:len(v.curLoopNexts[curfn])-1]
+	v.curLoopDepths[curfn] = v.curLoopDepths[curfn][:len(v.curLoopDepths[curfn])-1]
 }
 
 func (v *Codegen) genMatchStat(n *ast.MatchStat) {
-	// TODO: implement integral and string versions
+	// TODO: implement integral version
 
 	targetType := n.Target.GetType()
+	if ast.IsStringType(targetType) {
+		v.genStringMatchStat(n)
+		return
+	}
+
 	switch targetType.BaseType.ActualType().(type) {
 	case ast.EnumType:
 		v.genEnumMatchStat(n)
@@ -733,7 +891,7 @@ func (v *Codegen) genEnumMatchStat(n *ast.MatchStat) {
 	}
 
 	for idx := 0; idx < len(tags); idx++ {
-		sw.AddCase(llvm.ConstInt(enumTagType, uint64(tags[idx]), false), blocks[idx])
+		sw.AddCase(llvm.ConstInt(v.enumTagLLVMType(et), uint64(tags[idx]), false), blocks[idx])
 	}
 
 	v.builder().SetInsertPointAtEnd(exitBlock)
@@ -764,6 +922,8 @@ func (v *Codegen) genDecl(n ast.Decl) {
 		v.genDestructVarDecl(n)
 	case *ast.TypeDecl:
 		// TODO nothing to gen?
+	case *ast.TypeAliasDecl:
+		// 别名在解析时已经展开
 	default:
 		v.err("unimplemented decl found: `%s`", n.NodeName())
 	}
@@ -774,6 +934,9 @@ func (v *Codegen) genFunctionDecl(n *ast.FunctionDecl, gcon *ast.GenericContext)
 	if n.Function.Type.Attrs().Contains("nomangle") {
 		mangledName = n.Function.Name
 	}
+	if hook := ast.HookName(n.Function); hook != "" {
+		mangledName = ast.HookSymbol(hook)
+	}
 
 	function := v.curFile.LlvmModule.NamedFunction(mangledName)
 	if function.IsNil() {
@@ -807,26 +970,42 @@ func (v *Codegen) genFunctionBody(fn *ast.Function, llvmFn llvm.Value, gcon *ast
 	for i, par := range pars {
 		v.genVariable(false, par.Variable, llvmFn.Params()[i])
 	}
+	v.addParameterDrops(fn)
 
 	v.genBlock(fn.Body)
 	v.builder().Dispose()
 	delete(v.builders, v.currentFunction())
 	delete(v.curLoopExits, v.currentFunction())
 	delete(v.curLoopNexts, v.currentFunction())
+	delete(v.curLoopDepths, v.currentFunction())
 	delete(v.curSegvBlocks, v.currentFunction())
 	v.popFunction()
 }
 
 func (v *Codegen) genVariableDecl(n *ast.VariableDecl) {
+	// 接口模块中的全局变量定义在预先编译的目标文件中，这里只需要声明。
+	// 导出的泛型函数用到的私有常量在目标文件中是内部符号，要在这里定义，参见 kui.Extract
+	if v.curFile.Interface && !v.inFunction() && ast.VariableVisibility(n.IsPublic(), n.Variable) != ast.VISIBILITY_INTERNAL {
+		global := llvm.AddGlobal(v.curFile.LlvmModule, v.typeRefToLLVMType(n.Variable.Type), variableSymbol(n.Variable))
+		global.SetGlobalConstant(!n.Variable.Mutable)
+		global.SetThreadLocal(n.Variable.Attrs.Contains("thread_local"))
+		v.variableLookup[newvariableAndFnGenericInstance(n.Variable, nil)] = global
+		return
+	}
+
 	var value llvm.Value
 	if n.Assignment != nil {
-		value = v.genExprAndLoadIfNeccesary(n.Assignment)
+		value = v.genMoveExpr(n.Assignment)
 	}
 	v.genVariable(n.IsPublic(), n.Variable, value)
+
+	if v.inFunction() {
+		v.addDrop(n.Variable)
+	}
 }
 
 func (v *Codegen) genDestructVarDecl(n *ast.DestructVarDecl) {
-	assignment := v.genExprAndLoadIfNeccesary(n.Assignment)
+	assignment := v.genMoveExpr(n.Assignment)
 
 	for idx, vari := range n.Variables {
 		if !n.ShouldDiscard[idx] {
@@ -837,12 +1016,16 @@ func (v *Codegen) genDestructVarDecl(n *ast.DestructVarDecl) {
 				value = llvm.ConstExtractValue(assignment, []uint32{uint32(idx)})
 			}
 			v.genVariable(n.IsPublic(), vari, value)
+			if v.inFunction() {
+				v.addDrop(vari)
+			}
 		}
 	}
 }
 
 func (v *Codegen) genVariable(isPublic bool, vari *ast.Variable, assignment llvm.Value) {
-	mangledName := vari.MangledName(ast.MANGLE_ARK_UNSTABLE)
+	mangledName := variableSymbol(vari)
+	cBinding := !v.inFunction() && vari.Attrs.Contains("C")
 
 	var varType llvm.Type
 	if !assignment.IsNil() {
@@ -851,7 +1034,7 @@ func (v *Codegen) genVariable(isPublic bool, vari *ast.Variable, assignment llvm
 		varType = v.typeRefToLLVMType(vari.Type)
 	}
 
-	if assignment.IsNil() && !vari.Attrs.Contains("nozero") {
+	if assignment.IsNil() && !vari.Attrs.Contains("nozero") && !cBinding {
 		assignment = llvm.ConstNull(varType)
 	}
 
@@ -863,15 +1046,12 @@ func (v *Codegen) genVariable(isPublic bool, vari *ast.Variable, assignment llvm
 			v.builder().CreateStore(assignment, alloc)
 		}
 	} else {
-		// TODO cbindings
-		cBinding := false
-
 		value := llvm.AddGlobal(v.curFile.LlvmModule, varType, mangledName)
 		v.variableLookup[newvariableAndFnGenericInstance(vari, nil)] = value
 
-		if !cBinding && !isPublic {
-			value.SetLinkage(nonPublicLinkage)
-		}
+		// C变量定义在C代码中，这里只声明
+		value.SetLinkage(symbolLinkage(ast.VariableVisibility(isPublic, vari), cBinding))
+		value.SetThreadLocal(vari.Attrs.Contains("thread_local"))
 
 		if !assignment.IsNil() {
 			value.SetInitializer(assignment)
@@ -881,6 +1061,14 @@ func (v *Codegen) genVariable(isPublic bool, vari *ast.Variable, assignment llvm
 	}
 }
 
+// variableSymbol 全局变量的符号名，C变量使用原来的名字
+func variableSymbol(vari *ast.Variable) string {
+	if vari.Attrs.Contains("C") {
+		return vari.Name
+	}
+	return vari.MangledName(ast.MANGLE_ARK_UNSTABLE)
+}
+
 func (v *Codegen) createAlignedAlloca(typ llvm.Type, name string) llvm.Value {
 	funcEntry := v.currentLLVMFunction().EntryBasicBlock()
 
@@ -928,24 +1116,49 @@ func (v *Codegen) genExpr(n ast.Expr) llvm.Value {
 		return v.genPointerToExpr(n)
 	case *ast.BinaryExpr:
 		return v.genBinaryExpr(n)
+	case *ast.OverflowArithExpr:
+		return v.genOverflowArithExpr(n)
+	case *ast.FloatBuiltinExpr:
+		return v.genFloatBuiltinExpr(n)
 	case *ast.UnaryExpr:
 		return v.genUnaryExpr(n)
 	case *ast.CastExpr:
 		return v.genCastExpr(n)
+	case *ast.BitcastExpr:
+		return v.genBitcastExpr(n)
+	case *ast.VolatileLoadExpr:
+		return v.genVolatileLoadExpr(n)
+	case *ast.CStringExpr:
+		return v.genCStringExpr(n)
+	case *ast.HashExpr:
+		return v.genHashExpr(n)
+	case *ast.CondExpr:
+		return v.genCondExpr(n)
+	case *ast.NewExpr:
+		return v.genNewExpr(n)
+	case *ast.InterfaceWrapExpr:
+		return v.genInterfaceWrapExpr(n)
 	case *ast.CallExpr:
 		return v.genCallExpr(n)
 	case *ast.VariableAccessExpr, *ast.StructAccessExpr,
-		*ast.ArrayAccessExpr, *ast.DerefAccessExpr,
-		*ast.FunctionAccessExpr:
+		*ast.ArrayAccessExpr, *ast.DerefAccessExpr, *ast.TempAccessExpr:
 		return v.genAccessExpr(n)
+	case *ast.FunctionAccessExpr:
+		return v.genFunctionValue(v.genAccessExpr(n))
 	case *ast.SizeofExpr:
 		return v.genSizeofExpr(n)
+	case *ast.AlignofExpr:
+		return v.genAlignofExpr(n)
+	case *ast.OffsetofExpr:
+		return v.genOffsetofExpr(n)
 	case *ast.ArrayLenExpr:
 		return v.genArrayLenExpr(n)
+	case *ast.SliceExpr:
+		return v.genSliceExpr(n)
 	case *ast.LambdaExpr:
-		return v.genLambdaExpr(n)
+		return v.genFunctionValue(v.genLambdaExpr(n))
 	default:
-		log.Debug("codegen", "expr: %s\n", n)
+		log.Debug(log.TagCodegen, "expr: %s\n", n)
 		panic("unimplemented expr")
 	}
 }
@@ -955,6 +1168,7 @@ func (v *Codegen) genLambdaExpr(n *ast.LambdaExpr) llvm.Value {
 	mod := v.curFile.LlvmModule
 	n.Function.Name = fmt.Sprintf("_lambda%d", v.nextLambdaID())
 	fn := llvm.AddFunction(mod, n.Function.Name, typ)
+	fn.SetLinkage(symbolLinkage(ast.VISIBILITY_INTERNAL, false))
 
 	if len(n.Function.Type.GenericParameters) > 0 {
 		panic("generic lambdas unimplemented")
@@ -1017,6 +1231,9 @@ func (v *Codegen) genAccessExpr(n ast.Expr) llvm.Value {
 		if fae.Function.Type.Attrs().Contains("nomangle") {
 			fnName = fae.Function.Name
 		}
+		if hook := ast.HookName(fae.Function); hook != "" {
+			fnName = ast.HookSymbol(hook)
+		}
 
 		cBinding := false
 		if fae.Function.Type.Attrs() != nil {
@@ -1042,6 +1259,10 @@ func (v *Codegen) genAccessExpr(n ast.Expr) llvm.Value {
 		return fn
 	}
 
+	if sae, ok := n.(*ast.StructAccessExpr); ok && sae.Method != nil {
+		return v.genMethodValue(sae)
+	}
+
 	access := v.genAccessGEP(n)
 
 	// To be able to deal with enum unions, the llvm type is not always the
@@ -1069,31 +1290,39 @@ func (v *Codegen) genAccessGEP(n ast.Expr) llvm.Value {
 		gep := v.genAccessGEP(access.Struct)
 
 		typ := access.Struct.GetType().BaseType.ActualType()
-		index := typ.(ast.StructType).MemberIndex(access.Member)
+		if typ.(ast.StructType).IsUnion {
+			return v.genUnionMemberGEP(gep, v.typeRefToLLVMType(access.GetType()))
+		}
+		index := v.structFieldIndex(gep.Type().ElementType(), typ.(ast.StructType).MemberIndex(access.Member))
 
-		return v.builder().CreateStructGEP(gep, index, "")
+		return v.genStructGEP(gep, index)
 
 	case *ast.ArrayAccessExpr:
-		gep := v.genAccessGEP(access.Array)
-
-		subscriptExpr := v.genExprAndLoadIfNeccesary(access.Subscript)
-		subscriptTyp := access.Subscript.GetType().BaseType.ActualType().(ast.PrimitiveType)
-		// Extend access width to system poiner width
-		if !subscriptTyp.IsSigned() {
-			subscriptExpr = v.builder().CreateZExt(subscriptExpr, v.targetData.IntPtrType(), "")
-		} else {
-			subscriptExpr = v.builder().CreateSExt(subscriptExpr, v.targetData.IntPtrType(), "")
+		if base, accesses := fixedArrayAccesses(access); len(accesses) > 1 {
+			return v.genFixedArrayAccessGEP(base, accesses)
 		}
 
+		gep := v.genAccessGEP(access.Array)
+		subscriptExpr := v.genSubscript(access.Subscript)
+
 		if arrType, ok := access.Array.GetType().BaseType.ActualType().(ast.ArrayType); ok {
+			subscriptSigned := access.Subscript.GetType().BaseType.IsSigned()
 			if arrType.IsFixedLength {
-				v.genBoundsCheck(llvm.ConstInt(v.primitiveTypeToLLVMType(ast.PRIMITIVE_uint), uint64(arrType.Length), false),
-					subscriptExpr, access.Subscript.GetType().BaseType.IsSigned())
+				if v.uncheckedAccesses[access] {
+					v.genLowerBoundsCheck(subscriptExpr, subscriptSigned)
+				} else {
+					v.genBoundsCheck(llvm.ConstInt(v.primitiveTypeToLLVMType(ast.PRIMITIVE_uint), uint64(arrType.Length), false),
+						subscriptExpr, subscriptSigned)
+				}
 
 				return v.builder().CreateGEP(gep, []llvm.Value{llvm.ConstInt(llvm.Int32Type(), 0, false), subscriptExpr}, "")
 			} else {
-				v.genBoundsCheck(v.builder().CreateLoad(v.builder().CreateStructGEP(gep, 0, ""), ""),
-					subscriptExpr, access.Subscript.GetType().BaseType.IsSigned())
+				if v.uncheckedAccesses[access] {
+					v.genLowerBoundsCheck(subscriptExpr, subscriptSigned)
+				} else {
+					v.genBoundsCheck(v.builder().CreateLoad(v.builder().CreateStructGEP(gep, 0, ""), ""),
+						subscriptExpr, subscriptSigned)
+				}
 
 				gep = v.builder().CreateStructGEP(gep, 1, "")
 
@@ -1113,26 +1342,81 @@ func (v *Codegen) genAccessGEP(n ast.Expr) llvm.Value {
 	case *ast.DerefAccessExpr:
 		return v.genExprAndLoadIfNeccesary(access.Expr)
 
+	case *ast.TempAccessExpr:
+		// 临时值存入栈上的空间，再访问它的成员
+		slot := v.createAlignedAlloca(v.typeRefToLLVMType(access.GetType()), "temp")
+		v.builder().CreateStore(v.genExprAndLoadIfNeccesary(access.Expr), slot)
+		return slot
+
 	default:
 		panic("unhandled access type")
 	}
 }
 
-func (v *Codegen) genBoundsCheck(limit llvm.Value, index llvm.Value, indexIsSigned bool) {
-	var segvBlock llvm.BasicBlock
-	needToSetupSegvBlock := false
+type structGEPKey struct {
+	block llvm.BasicBlock
+	base  llvm.Value
+	index int
+}
+
+// genStructGEP 计算结构体成员的地址。同一个基本块中对同一个地址的同一个成员的重复访问（如多次出现的 a.b.c）
+// 会复用之前的GEP，-O0 时也不会生成重复的地址计算
+func (v *Codegen) genStructGEP(base llvm.Value, index int) llvm.Value {
+	if !v.inFunction() {
+		return v.builder().CreateStructGEP(base, index, "")
+	}
+
+	key := structGEPKey{block: v.builder().GetInsertBlock(), base: base, index: index}
+	if gep, ok := v.structGEPs[key]; ok {
+		return gep
+	}
+
+	gep := v.builder().CreateStructGEP(base, index, "")
+	v.structGEPs[key] = gep
+	return gep
+}
+
+// genLowerBoundsCheck 只检查下界。用于已知不会越过上界的访问，下标是无符号数时不需要检查
+func (v *Codegen) genLowerBoundsCheck(index llvm.Value, indexIsSigned bool) {
+	if indexIsSigned {
+		v.genBoundsCheck(llvm.Value{}, index, true)
+	}
+}
+
+// genSubscript 计算数组下标，扩展到指针的宽度
+func (v *Codegen) genSubscript(subscript ast.Expr) llvm.Value {
+	value := v.genExprAndLoadIfNeccesary(subscript)
+	if subscript.GetType().BaseType.ActualType().(ast.PrimitiveType).IsSigned() {
+		return v.builder().CreateSExt(value, v.targetData.IntPtrType(), "")
+	}
+	return v.builder().CreateZExt(value, v.targetData.IntPtrType(), "")
+}
+
+// boundsCheckSegvBlock 当前函数中越界时跳转到的基本块，第一次使用时创建，需要用 setupSegvBlock 生成其中的代码
+func (v *Codegen) boundsCheckSegvBlock() (llvm.BasicBlock, bool) {
 	if b, ok := v.curSegvBlocks[v.currentFunction()]; ok {
-		segvBlock = b
-	} else {
-		segvBlock = llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_segv")
-		v.curSegvBlocks[v.currentFunction()] = segvBlock
-		needToSetupSegvBlock = true
+		return b, false
 	}
+	segvBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_segv")
+	v.curSegvBlocks[v.currentFunction()] = segvBlock
+	return segvBlock, true
+}
+
+// genBoundsCheck 检查 0 <= index < limit。limit为nil时只检查下界
+func (v *Codegen) genBoundsCheck(limit llvm.Value, index llvm.Value, indexIsSigned bool) {
+	segvBlock, needToSetupSegvBlock := v.boundsCheckSegvBlock()
 
 	endBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_end")
-	upperCheckBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_upper_block")
 
 	tooLow := v.builder().CreateICmp(llvm.IntSGT, llvm.ConstInt(index.Type(), 0, false), index, "boundscheck_lower")
+	if limit.IsNil() {
+		v.builder().CreateCondBr(tooLow, segvBlock, endBlock)
+		v.setupSegvBlock(segvBlock, needToSetupSegvBlock)
+		v.builder().SetInsertPointAtEnd(endBlock)
+		return
+	}
+
+	upperCheckBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_upper_block")
 	v.builder().CreateCondBr(tooLow, segvBlock, upperCheckBlock)
 
 	v.builder().SetInsertPointAtEnd(upperCheckBlock)
@@ -1153,13 +1437,16 @@ func (v *Codegen) genBoundsCheck(limit llvm.Value, index llvm.Value, indexIsSign
 	tooHigh := v.builder().CreateICmp(llvm.IntSLE, castedLimit, castedIndex, "boundscheck_upper")
 	v.builder().CreateCondBr(tooHigh, segvBlock, endBlock)
 
-	if needToSetupSegvBlock {
+	v.setupSegvBlock(segvBlock, needToSetupSegvBlock)
+	v.builder().SetInsertPointAtEnd(endBlock)
+}
+
+func (v *Codegen) setupSegvBlock(segvBlock llvm.BasicBlock, needToSetup bool) {
+	if needToSetup {
 		v.builder().SetInsertPointAtEnd(segvBlock)
 		v.genRaiseSegfault()
 		v.builder().CreateUnreachable()
 	}
-
-	v.builder().SetInsertPointAtEnd(endBlock)
 }
 
 func (v *Codegen) genRaiseSegfault() {
@@ -1196,13 +1483,17 @@ func (v *Codegen) genStringLiteral(n *ast.StringLiteral) llvm.Value {
 	}
 
 	var backingArrayPointer llvm.Value
-	if v.inFunction() {
+	if v.stringLiteralPooled(n) {
+		// 内容不会被写入，直接使用常量池中的数据，见 strlit.go
+		backingArrayPointer = v.poolString(n.Value)
+	} else if v.inFunction() {
 		// allocate backing array
-		globString := v.builder().CreateGlobalStringPtr(n.Value, ".str")
+		globString := v.poolString(n.Value)
 		backingArray := v.createAlignedAlloca(llvm.ArrayType(memberLLVMType, length), ".stackstr")
 		backingArrayPointer = v.builder().CreateBitCast(backingArray, llvm.PointerType(memberLLVMType, 0), "")
 		v.genMemcpy(globString, backingArrayPointer, llvm.ConstInt(llvm.IntType(32), uint64(length), false))
 	} else {
+		// 全局变量可能被修改，使用模块内部的可写副本
 		backingArray := llvm.AddGlobal(v.curFile.LlvmModule, llvm.ArrayType(memberLLVMType, length), ".str")
 		backingArray.SetLinkage(llvm.InternalLinkage)
 		backingArray.SetGlobalConstant(false)
@@ -1223,18 +1514,17 @@ func (v *Codegen) genStringLiteral(n *ast.StringLiteral) llvm.Value {
 }
 
 func (v *Codegen) genMemcpy(src llvm.Value, dst llvm.Value, length llvm.Value) {
-	memcpyFn := v.curFile.LlvmModule.NamedFunction("llvm.memcpy.p0i8.p0i8.i32")
-	if memcpyFn.IsNil() {
-		//i8* <dest>, i8* <src>, i32 <len>, i32 <align>, i1 <isvolatile>
-		fnType := llvm.FunctionType(llvm.VoidType(), []llvm.Type{
-			llvm.PointerType(llvm.IntType(8), 0), // dest
-			llvm.PointerType(llvm.IntType(8), 0), // src
-			llvm.IntType(32),                     // len
-			llvm.IntType(32),                     // align
-			llvm.IntType(1),                      // isvolatile
-		}, false)
-		memcpyFn = llvm.AddFunction(v.curFile.LlvmModule, "llvm.memcpy.p0i8.p0i8.i32", fnType)
-	}
+	// 长度的位宽决定使用哪个版本的intrinsic，避免截断超过4GB的长度
+	lengthType := length.Type()
+	//i8* <dest>, i8* <src>, iN <len>, i32 <align>, i1 <isvolatile>
+	fnType := llvm.FunctionType(llvm.VoidType(), []llvm.Type{
+		llvm.PointerType(llvm.IntType(8), 0), // dest
+		llvm.PointerType(llvm.IntType(8), 0), // src
+		lengthType,                           // len
+		llvm.IntType(32),                     // align
+		llvm.IntType(1),                      // isvolatile
+	}, false)
+	memcpyFn := v.getIntrinsic(fmt.Sprintf("llvm.memcpy.p0i8.p0i8.i%d", lengthType.IntTypeWidth()), fnType)
 	v.builder().CreateCall(memcpyFn, []llvm.Value{
 		dst, src, length,
 		llvm.ConstInt(llvm.IntType(32), 1, false),
@@ -1247,6 +1537,9 @@ func (v *Codegen) genCompositeLiteral(n *ast.CompositeLiteral) llvm.Value {
 	case ast.ArrayType:
 		return v.genArrayLiteral(n)
 	case ast.StructType:
+		if n.GetType().BaseType.ActualType().(ast.StructType).IsUnion {
+			return v.genUnionLiteral(n)
+		}
 		return v.genStructLiteral(n)
 	default:
 		panic("invalid composite literal type")
@@ -1261,7 +1554,7 @@ func (v *Codegen) genArrayLiteral(n *ast.CompositeLiteral) llvm.Value {
 
 	arrayValues := make([]llvm.Value, len(n.Values))
 	for idx, mem := range n.Values {
-		value := v.genExprAndLoadIfNeccesary(mem)
+		value := v.genMoveExpr(mem)
 		if !v.inFunction() && !value.IsConstant() {
 			v.err("Encountered non-constant value in global array")
 		}
@@ -1283,9 +1576,18 @@ func (v *Codegen) genArrayLiteral(n *ast.CompositeLiteral) llvm.Value {
 		backingArray = v.createAlignedAlloca(llvm.ArrayType(memberLLVMType, length), "")
 
 		// copy the constant array to the backing array
-		for idx, value := range arrayValues {
-			gep := v.builder().CreateStructGEP(backingArray, idx, "")
-			v.builder().CreateStore(value, gep)
+		if key, ok := constantArrayKey(arrayType.MemberType, n.Values); ok && len(arrayValues) == length && length > 0 {
+			// 全部是常量时从常量池中复制，避免逐个元素存储
+			pooled := v.poolConstant(key, llvm.ConstArray(memberLLVMType, arrayValues))
+			size := v.targetData.TypeAllocSize(llvm.ArrayType(memberLLVMType, length))
+			v.genMemcpy(llvm.ConstBitCast(pooled, llvm.PointerType(llvm.IntType(8), 0)),
+				v.builder().CreateBitCast(backingArray, llvm.PointerType(llvm.IntType(8), 0), ""),
+				llvm.ConstInt(llvm.IntType(32), size, false))
+		} else {
+			for idx, value := range arrayValues {
+				gep := v.builder().CreateStructGEP(backingArray, idx, "")
+				v.builder().CreateStore(value, gep)
+			}
 		}
 
 		backingArrayPointer = v.builder().CreateBitCast(backingArray, llvm.PointerType(memberLLVMType, 0), "")
@@ -1322,9 +1624,9 @@ func (v *Codegen) genStructLiteralValues(n *ast.CompositeLiteral, target llvm.Va
 
 	for i, value := range n.Values {
 		name := n.Fields[i]
-		idx := structBaseType.MemberIndex(name)
+		idx := v.structFieldIndex(target.Type(), structBaseType.MemberIndex(name))
 
-		memberValue := v.genExprAndLoadIfNeccesary(value)
+		memberValue := v.genMoveExpr(value)
 		if !v.inFunction() && !memberValue.IsConstant() {
 			v.err("Encountered non-constant value in global struct literal")
 		}
@@ -1363,7 +1665,7 @@ func (v *Codegen) genTupleLiteral(n *ast.TupleLiteral) llvm.Value {
 
 func (v *Codegen) genTupleLiteralValues(n *ast.TupleLiteral, target llvm.Value) llvm.Value {
 	for idx, mem := range n.Members {
-		memberValue := v.genExprAndLoadIfNeccesary(mem)
+		memberValue := v.genMoveExpr(mem)
 
 		if !v.inFunction() && !memberValue.IsConstant() {
 			v.err("Encountered non-constant value in global tuple literal")
@@ -1397,8 +1699,7 @@ func (v *Codegen) genEnumLiteral(n *ast.EnumLiteral) llvm.Value {
 		return llvm.ConstInt(enumLLVMType, uint64(member.Tag), false)
 	}
 
-	// TODO: Handle other integer size, maybe dynamic depending on max value?
-	tagValue := llvm.ConstInt(enumTagType, uint64(member.Tag), false)
+	tagValue := llvm.ConstInt(v.enumTagLLVMType(enumBaseType), uint64(member.Tag), false)
 
 	memberLLVMType := v.enumMemberTypeToPaddedLLVMType(enumBaseType, memberIdx, gcon)
 
@@ -1427,8 +1728,11 @@ func (v *Codegen) genEnumLiteral(n *ast.EnumLiteral) llvm.Value {
 func (v *Codegen) genNumericLiteral(n *ast.NumericLiteral) llvm.Value {
 	if n.GetType().BaseType.IsFloatingType() {
 		return llvm.ConstFloat(v.typeRefToLLVMType(n.GetType()), n.AsFloat())
+	} else if n.FitsIn64Bits() {
+		return llvm.ConstInt(v.typeRefToLLVMType(n.GetType()), n.AsInt(), n.IntValue.Sign() < 0)
 	} else {
-		return llvm.ConstInt(v.typeRefToLLVMType(n.GetType()), n.AsInt(), false)
+		// 超过64位的常量只能用于 u128/s128，通过十进制字符串构造以保留完整精度
+		return llvm.ConstIntFromString(v.typeRefToLLVMType(n.GetType()), n.IntValue.String(), 10)
 	}
 }
 
@@ -1470,13 +1774,63 @@ func (v *Codegen) genBinaryExpr(n *ast.BinaryExpr) llvm.Value {
 	if n.Op.Category() == parser.OP_LOGICAL {
 		return v.genLogicalBinop(n)
 	}
+	if n.Method != nil {
+		return v.genMethodBinop(n)
+	}
 
 	lhand := v.genExprAndLoadIfNeccesary(n.Lhand)
 	rhand := v.genExprAndLoadIfNeccesary(n.Rhand)
 
+	if _, ok := n.Lhand.GetType().BaseType.ActualType().(ast.PointerType); ok && (n.Op == parser.BINOP_ADD || n.Op == parser.BINOP_SUB) {
+		return v.genPointerArith(n, lhand, rhand)
+	}
+	if isCheckedDurationOp(n.Op, n.GetType()) {
+		return v.genDurationArith(n.Op, lhand, rhand)
+	}
+	if n.Op.Category() == parser.OP_COMPARISON && ast.IsCompositeComparison(n.Lhand.GetType()) {
+		return v.genCompositeComparison(n.Op, n.Lhand.GetType(), lhand, rhand)
+	}
+
 	return v.genBinop(n.Op, n.GetType(), n.Lhand.GetType(), n.Rhand.GetType(), lhand, rhand)
 }
 
+// genMethodBinop 由约束方法实现的运算符。比较运算符调用的 cmp 的结果与0比较，eq 的结果直接使用
+func (v *Codegen) genMethodBinop(n *ast.BinaryExpr) llvm.Value {
+	res := v.genExprAndLoadIfNeccesary(n.Method)
+	if n.Op.Category() != parser.OP_COMPARISON {
+		return res
+	}
+
+	resType := n.Method.GetType()
+	if resType.ActualTypesEqual(&ast.TypeReference{BaseType: ast.PRIMITIVE_bool}) {
+		if n.Op == parser.BINOP_NOT_EQ {
+			return v.builder().CreateNot(res, "")
+		}
+		return res
+	}
+	zero := llvm.ConstNull(res.Type())
+	return v.genBinop(n.Op, n.GetType(), resType, resType, res, zero)
+}
+
+// genPointerArith 指针加减整数按元素的大小移动指针，两个指针相减得到它们之间的元素个数
+func (v *Codegen) genPointerArith(n *ast.BinaryExpr, lhand, rhand llvm.Value) llvm.Value {
+	if _, ok := n.Rhand.GetType().BaseType.ActualType().(ast.PointerType); ok {
+		diff := v.builder().CreatePtrDiff(lhand, rhand, "")
+		return v.builder().CreateIntCast(diff, v.typeRefToLLVMType(n.GetType()), "")
+	}
+
+	var offset llvm.Value
+	if n.Rhand.GetType().BaseType.IsSigned() {
+		offset = v.builder().CreateSExt(rhand, v.targetData.IntPtrType(), "")
+	} else {
+		offset = v.builder().CreateZExt(rhand, v.targetData.IntPtrType(), "")
+	}
+	if n.Op == parser.BINOP_SUB {
+		offset = v.builder().CreateNeg(offset, "")
+	}
+	return v.builder().CreateGEP(lhand, []llvm.Value{offset}, "")
+}
+
 func (v *Codegen) genBinop(operator parser.BinOpType, resType, lhandType, rhandType *ast.TypeReference, lhand, rhand llvm.Value) llvm.Value {
 	if lhand.IsNil() || rhand.IsNil() {
 		v.err("invalid binary expr")
@@ -1557,6 +1911,93 @@ func (v *Codegen) genBinop(operator parser.BinOpType, resType, lhandType, rhandT
 	panic("unreachable")
 }
 
+func (v *Codegen) genOverflowArithExpr(n *ast.OverflowArithExpr) llvm.Value {
+	lhand := v.genExprAndLoadIfNeccesary(n.Lhand)
+	rhand := v.genExprAndLoadIfNeccesary(n.Rhand)
+
+	operandType := n.Lhand.GetType()
+	llvmType := lhand.Type()
+
+	// LLVM的整数运算本身就是按补码回绕的
+	if n.Mode == parser.OVERFLOW_WRAPPING {
+		return v.genBinop(n.Op, operandType, operandType, operandType, lhand, rhand)
+	}
+
+	sign := "u"
+	if operandType.BaseType.IsSigned() {
+		sign = "s"
+	}
+
+	var opName string
+	switch n.Op {
+	case parser.BINOP_ADD:
+		opName = "add"
+	case parser.BINOP_SUB:
+		opName = "sub"
+	case parser.BINOP_MUL:
+		opName = "mul"
+	default:
+		panic("INTERNAL ERROR: Unimplemented overflow arithmetic operator")
+	}
+
+	switch n.Mode {
+	case parser.OVERFLOW_CHECKED:
+		// {iN, i1} @llvm.sadd.with.overflow.iN(iN, iN)
+		// 返回的结构体与元组 (T, bool) 的LLVM类型相同，可以直接使用
+		resType := llvm.StructType([]llvm.Type{llvmType, v.primitiveTypeToLLVMType(ast.PRIMITIVE_bool)}, false)
+		fn := v.getIntrinsic(fmt.Sprintf("llvm.%s%s.with.overflow.i%d", sign, opName, llvmType.IntTypeWidth()),
+			llvm.FunctionType(resType, []llvm.Type{llvmType, llvmType}, false))
+		return v.builder().CreateCall(fn, []llvm.Value{lhand, rhand}, "")
+
+	case parser.OVERFLOW_SATURATING:
+		// iN @llvm.sadd.sat.iN(iN, iN)
+		fn := v.getIntrinsic(fmt.Sprintf("llvm.%s%s.sat.i%d", sign, opName, llvmType.IntTypeWidth()),
+			llvm.FunctionType(llvmType, []llvm.Type{llvmType, llvmType}, false))
+		return v.builder().CreateCall(fn, []llvm.Value{lhand, rhand}, "")
+
+	default:
+		panic("INTERNAL ERROR: Unimplemented overflow mode")
+	}
+}
+
+func (v *Codegen) genFloatBuiltinExpr(n *ast.FloatBuiltinExpr) llvm.Value {
+	args := make([]llvm.Value, len(n.Arguments))
+	for idx, arg := range n.Arguments {
+		args[idx] = v.genExprAndLoadIfNeccesary(arg)
+	}
+
+	llvmType := args[0].Type()
+	suffix := fmt.Sprintf("f%d", floatTypeBits(n.Arguments[0].GetType().BaseType.ActualType().(ast.PrimitiveType)))
+
+	switch n.Builtin {
+	case parser.FLOAT_BUILTIN_IS_NAN:
+		// 只有NaN与自身比较是无序的
+		return v.builder().CreateFCmp(llvm.FloatUNO, args[0], args[0], "")
+
+	case parser.FLOAT_BUILTIN_IS_INF:
+		// fabs(x) == inf
+		fabs := v.getIntrinsic("llvm.fabs."+suffix, llvm.FunctionType(llvmType, []llvm.Type{llvmType}, false))
+		abs := v.builder().CreateCall(fabs, []llvm.Value{args[0]}, "")
+		return v.builder().CreateFCmp(llvm.FloatOEQ, abs, llvm.ConstFloat(llvmType, math.Inf(1)), "")
+
+	case parser.FLOAT_BUILTIN_FMA:
+		fma := v.getIntrinsic("llvm.fma."+suffix, llvm.FunctionType(llvmType, []llvm.Type{llvmType, llvmType, llvmType}, false))
+		return v.builder().CreateCall(fma, args, "")
+
+	default:
+		panic("INTERNAL ERROR: Unimplemented float builtin")
+	}
+}
+
+// getIntrinsic 返回当前模块中的LLVM内部函数，不存在时先声明
+func (v *Codegen) getIntrinsic(name string, typ llvm.Type) llvm.Value {
+	fn := v.curFile.LlvmModule.NamedFunction(name)
+	if fn.IsNil() {
+		fn = llvm.AddFunction(v.curFile.LlvmModule, name, typ)
+	}
+	return fn
+}
+
 func comparisonOpToIntPredicate(op parser.BinOpType, signed bool) llvm.IntPredicate {
 	switch op {
 	case parser.BINOP_GREATER:
@@ -1633,6 +2074,11 @@ func (v *Codegen) genCastExpr(n *ast.CastExpr) llvm.Value {
 		return v.genExprAndLoadIfNeccesary(n.Expr)
 	}
 
+	// 接口值之间的转换，参见 interface.go
+	if _, ok := ast.InterfaceOf(n.Expr.GetType()); ok {
+		return v.genInterfaceCast(n)
+	}
+
 	expr := v.genExprAndLoadIfNeccesary(n.Expr)
 	exprBaseType := n.Expr.GetType().BaseType.ActualType()
 	castBaseType := n.GetType().BaseType.ActualType()
@@ -1674,7 +2120,7 @@ func (v *Codegen) genCastExpr(n *ast.CastExpr) llvm.Value {
 		}
 	} else if exprBaseType.IsFloatingType() {
 		if castBaseType.IsIntegerType() {
-			if exprBaseType.IsSigned() {
+			if castBaseType.IsSigned() {
 				return v.builder().CreateFPToSI(expr, castLLVMType, "")
 			} else {
 				return v.builder().CreateFPToUI(expr, castLLVMType, "")
@@ -1696,19 +2142,68 @@ func (v *Codegen) genCastExpr(n *ast.CastExpr) llvm.Value {
 }
 
 func (v *Codegen) genCallExprWithArgs(n *ast.CallExpr, args []llvm.Value) llvm.Value {
-	call := v.builder().CreateCall(v.genExprAndLoadIfNeccesary(n.Function), args, "")
+	fnType := n.Function.GetType().BaseType.(ast.FunctionType)
+
+	// 通过函数值调用，参见 closure.go。被调用的函数已知时直接调用，参见 devirt.go
+	fae, ok := n.Function.(*ast.FunctionAccessExpr)
+	if !ok {
+		if fae = v.knownCallee(n); fae == nil {
+			return v.genClosureCall(v.genExprAndLoadIfNeccesary(n.Function), fnType, args)
+		}
+	}
 
-	attrs := n.Function.GetType().BaseType.(ast.FunctionType).Attrs()
+	// 通过接口值调用方法，参见 interface.go
+	if fae.ReceiverAccess != nil && v.isInterfaceValue(fae.ReceiverAccess.GetType()) {
+		return v.genInterfaceCall(fae, fnType, args)
+	}
+
+	fn := v.genAccessExpr(fae)
+	readNone := v.callReadsNone(fae)
+	if readNone {
+		if res, ok := v.reusePureCall(fn, args); ok {
+			return res
+		}
+	}
+
+	call := v.builder().CreateCall(fn, args, "")
+	if readNone {
+		v.recordPureCall(fn, args, call)
+	}
+
+	attrs := fnType.Attrs()
 	if attr, ok := attrs["call_conv"]; ok {
 		call.SetInstructionCallConv(callConvTypes[attr.Value])
 	}
 
+	// C函数返回的是原始的函数指针
+	if fnType.Return != nil && attrs.Contains("C") {
+		if _, ok := fnType.Return.BaseType.ActualType().(ast.FunctionType); ok {
+			return v.cFunctionToClosure(call)
+		}
+	}
+
 	return call
 }
 
 func (v *Codegen) genCallExpr(n *ast.CallExpr) llvm.Value {
+	// 隐式转换的C字符串只在调用期间有效，参见 cstring.go
+	if hasImplicitCString(n) {
+		call := &cstrCall{fn: v.currentFunction()}
+		v.cstrCalls = append(v.cstrCalls, call)
+		args := v.genCallArgs(n)
+		v.cstrCalls = v.cstrCalls[:len(v.cstrCalls)-1]
+
+		res := v.genCallExprWithArgs(n, args)
+		for _, heap := range call.heaps {
+			v.builder().CreateCall(v.freeFunction(), []llvm.Value{heap}, "")
+		}
+		return res
+	}
 
 	args := v.genCallArgs(n)
+	if isRuntimeFree(n) {
+		v.genDropPointee(n, args[0])
+	}
 	return v.genCallExprWithArgs(n, args)
 }
 
@@ -1725,14 +2220,28 @@ func (v *Codegen) genCallArgs(n *ast.CallExpr) []llvm.Value {
 		args = append(args, llvmReciverAccess)
 	}
 
+	cCall := n.Function.GetType().BaseType.(ast.FunctionType).Attrs().Contains("C")
 	for _, arg := range n.Arguments {
-		llvmArg := v.genExprAndLoadIfNeccesary(arg)
+		llvmArg := v.genCallArg(arg, cCall)
 		args = append(args, llvmArg)
 	}
 
 	return args
 }
 
+// genCallArg 生成实参。C函数接收原始的函数指针，参见 closure.go
+func (v *Codegen) genCallArg(arg ast.Expr, cCall bool) llvm.Value {
+	if cCall {
+		switch arg := arg.(type) {
+		case *ast.FunctionAccessExpr:
+			return v.genAccessExpr(arg)
+		case *ast.LambdaExpr:
+			return v.genLambdaExpr(arg)
+		}
+	}
+	return v.genMoveExpr(arg)
+}
+
 func (v *Codegen) genArrayLenExpr(n *ast.ArrayLenExpr) llvm.Value {
 	arrType := n.Expr.GetType().BaseType.ActualType().(ast.ArrayType)
 	if arrType.IsFixedLength {
@@ -1761,3 +2270,29 @@ func (v *Codegen) genSizeofExpr(n *ast.SizeofExpr) llvm.Value {
 
 	return llvm.ConstInt(v.targetData.IntPtrType(), v.targetData.TypeAllocSize(typ), false)
 }
+
+func (v *Codegen) genAlignofExpr(n *ast.AlignofExpr) llvm.Value {
+	var typ llvm.Type
+
+	if n.Expr != nil {
+		typ = v.typeRefToLLVMType(n.Expr.GetType())
+	} else {
+		typ = v.typeRefToLLVMType(n.Type)
+	}
+
+	return llvm.ConstInt(v.targetData.IntPtrType(), uint64(v.targetData.ABITypeAlignment(typ)), false)
+}
+
+func (v *Codegen) genOffsetofExpr(n *ast.OffsetofExpr) llvm.Value {
+	return llvm.ConstInt(v.targetData.IntPtrType(), v.memberOffset(n.Type, n.Member), false)
+}
+
+// memberOffset 结构体成员在目标平台上的偏移
+func (v *Codegen) memberOffset(typ *ast.TypeReference, member string) uint64 {
+	if typ.BaseType.ActualType().(ast.StructType).IsUnion {
+		return 0
+	}
+	structType := v.typeRefToLLVMType(typ)
+	index := v.structFieldIndex(structType, typ.BaseType.ActualType().(ast.StructType).MemberIndex(member))
+	return v.targetData.ElementOffset(structType, index)
+}
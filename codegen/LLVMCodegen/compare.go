@@ -0,0 +1,298 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 复合类型的比较，参见 ast/compare.go
+//
+// 结构体、元组、数组和带数据的枚举的比较调用生成的比较函数：eq.<类型> 返回两个值是否相等，
+// cmp.<类型> 返回 -1、0 或 1。比较函数接收两个值的地址，每个模块中每个类型只生成一次；
+// 成员是复合类型时调用成员类型的比较函数，因此通过不定长数组包含自身的类型也可以比较。
+// eq 在第一个不相等的成员处返回，cmp 在第一个不为0的结果处返回。
+// 不定长数组的 eq 先比较长度，cmp 按较短的长度比较元素之后再比较长度；枚举先比较标签，再按标签比较这个成员的数据。
+
+// genCompositeComparison 生成复合类型的值的比较 lhand op rhand
+func (v *Codegen) genCompositeComparison(op parser.BinOpType, typ *ast.TypeReference, lhand, rhand llvm.Value) llvm.Value {
+	if !v.inFunction() {
+		v.err("Cannot compare values of type `%s` in a global initializer", typ.String())
+	}
+
+	lp := v.createAlignedAlloca(lhand.Type(), "cmp_lhand")
+	v.builder().CreateStore(lhand, lp)
+	rp := v.createAlignedAlloca(rhand.Type(), "cmp_rhand")
+	v.builder().CreateStore(rhand, rp)
+
+	gcon := v.currentFunction().gcon
+	switch op {
+	case parser.BINOP_EQ:
+		return v.builder().CreateCall(v.compareFunction(false, typ, gcon), []llvm.Value{lp, rp}, "")
+	case parser.BINOP_NOT_EQ:
+		return v.builder().CreateNot(v.builder().CreateCall(v.compareFunction(false, typ, gcon), []llvm.Value{lp, rp}, ""), "")
+	default:
+		res := v.builder().CreateCall(v.compareFunction(true, typ, gcon), []llvm.Value{lp, rp}, "")
+		return v.builder().CreateICmp(comparisonOpToIntPredicate(op, true), res, llvm.ConstInt(res.Type(), 0, false), "")
+	}
+}
+
+// compareFunction 类型为typ的值的比较函数，ordered为true时是 cmp，否则是 eq
+func (v *Codegen) compareFunction(ordered bool, typ *ast.TypeReference, gcon *ast.GenericContext) llvm.Value {
+	name := "eq." + ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, typ, gcon)
+	resType := llvm.IntType(1)
+	if ordered {
+		name = "cmp." + ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, typ, gcon)
+		resType = llvm.Int32Type()
+	}
+	if fn := v.curFile.LlvmModule.NamedFunction(name); !fn.IsNil() {
+		return fn
+	}
+
+	ptrType := llvm.PointerType(v.typeRefToLLVMTypeWithOuter(typ, gcon), 0)
+	fn := llvm.AddFunction(v.curFile.LlvmModule, name, llvm.FunctionType(resType, []llvm.Type{ptrType, ptrType}, false))
+	fn.SetLinkage(llvm.InternalLinkage)
+
+	g := &compareGen{v: v, fn: fn, ordered: ordered, builder: llvm.NewBuilder()}
+	defer g.builder.Dispose()
+	g.builder.SetInsertPointAtEnd(llvm.AddBasicBlock(fn, "entry"))
+	g.genBody(typ, gcon, fn.Param(0), fn.Param(1))
+	return fn
+}
+
+// compareGen 生成一个比较函数的函数体
+type compareGen struct {
+	v       *Codegen
+	fn      llvm.Value
+	ordered bool
+	builder llvm.Builder
+}
+
+// comparisonType 去掉类型名和泛型参数之后的类型，以及它的成员所在的泛型上下文
+func comparisonType(typ *ast.TypeReference, gcon *ast.GenericContext) (ast.Type, *ast.GenericContext) {
+	for {
+		switch t := typ.BaseType.(type) {
+		case *ast.SubstitutionType:
+			typ = gcon.GetSubstitutionType(t)
+		case *ast.NamedType:
+			if len(typ.GenericArguments) > 0 {
+				inner := ast.NewGenericContextFromTypeReference(typ)
+				inner.Outer = gcon
+				gcon = inner
+			}
+			typ = &ast.TypeReference{BaseType: t.Type}
+		default:
+			return t, gcon
+		}
+	}
+}
+
+func (g *compareGen) genBody(typ *ast.TypeReference, gcon *ast.GenericContext, l, r llvm.Value) {
+	b := g.builder
+	actual, gcon := comparisonType(typ, gcon)
+
+	switch t := actual.(type) {
+	case ast.StructType:
+		llvmType := l.Type().ElementType()
+		for idx, mem := range t.Members {
+			field := g.v.structFieldIndex(llvmType, idx)
+			g.genMember(mem.Type, gcon, b.CreateStructGEP(l, field, ""), b.CreateStructGEP(r, field, ""))
+		}
+		g.genEqual()
+
+	case ast.TupleType:
+		for idx, mem := range t.Members {
+			g.genMember(mem, gcon, b.CreateStructGEP(l, idx, ""), b.CreateStructGEP(r, idx, ""))
+		}
+		g.genEqual()
+
+	case ast.ArrayType:
+		if t.IsFixedLength {
+			length := llvm.ConstInt(g.v.primitiveTypeToLLVMType(ast.PRIMITIVE_uint), uint64(t.Length), false)
+			g.genElements(t.MemberType, gcon, length, func(i llvm.Value) (llvm.Value, llvm.Value) {
+				zero := llvm.ConstInt(i.Type(), 0, false)
+				return b.CreateGEP(l, []llvm.Value{zero, i}, ""), b.CreateGEP(r, []llvm.Value{zero, i}, "")
+			})
+			g.genEqual()
+			return
+		}
+
+		llen := b.CreateLoad(b.CreateStructGEP(l, 0, ""), "")
+		rlen := b.CreateLoad(b.CreateStructGEP(r, 0, ""), "")
+		ldata := b.CreateLoad(b.CreateStructGEP(l, 1, ""), "")
+		rdata := b.CreateLoad(b.CreateStructGEP(r, 1, ""), "")
+		elements := func(i llvm.Value) (llvm.Value, llvm.Value) {
+			return b.CreateGEP(ldata, []llvm.Value{i}, ""), b.CreateGEP(rdata, []llvm.Value{i}, "")
+		}
+
+		if !g.ordered {
+			g.genCheck(b.CreateICmp(llvm.IntEQ, llen, rlen, ""))
+			g.genElements(t.MemberType, gcon, llen, elements)
+			g.genEqual()
+			return
+		}
+
+		shorter := b.CreateSelect(b.CreateICmp(llvm.IntULT, llen, rlen, ""), llen, rlen, "")
+		g.genElements(t.MemberType, gcon, shorter, elements)
+		g.builder.CreateRet(g.genOrder(llen, rlen, false))
+
+	case ast.EnumType:
+		g.genEnumBody(t, gcon, l, r)
+
+	default:
+		panic("INTERNAL ERROR: Composite comparison of type " + typ.String())
+	}
+}
+
+// genEnumBody 标签相同时按标签比较这个成员的数据（eq）
+func (g *compareGen) genEnumBody(t ast.EnumType, gcon *ast.GenericContext, l, r llvm.Value) {
+	b := g.builder
+	ltag := b.CreateLoad(b.CreateStructGEP(l, 0, ""), "")
+	rtag := b.CreateLoad(b.CreateStructGEP(r, 0, ""), "")
+	g.genCheck(b.CreateICmp(llvm.IntEQ, ltag, rtag, ""))
+
+	equal := llvm.AddBasicBlock(g.fn, "equal")
+	sw := b.CreateSwitch(ltag, equal, len(t.Members))
+	for idx, mem := range t.Members {
+		members := ast.ComparisonMembers(mem.Type)
+		if len(members) == 0 {
+			continue
+		}
+
+		block := llvm.AddBasicBlock(g.fn, "member_"+mem.Name)
+		sw.AddCase(llvm.ConstInt(g.v.enumTagLLVMType(t), uint64(mem.Tag), false), block)
+		b.SetInsertPointAtEnd(block)
+
+		memberPtr := llvm.PointerType(g.v.llvmEnumTypeForMember(t, idx, gcon), 0)
+		ldata := b.CreateStructGEP(b.CreateBitCast(l, memberPtr, ""), 1, "")
+		rdata := b.CreateStructGEP(b.CreateBitCast(r, memberPtr, ""), 1, "")
+		for field, typ := range members {
+			g.genMember(typ, gcon, b.CreateStructGEP(ldata, field, ""), b.CreateStructGEP(rdata, field, ""))
+		}
+		b.CreateBr(equal)
+	}
+
+	b.SetInsertPointAtEnd(equal)
+	g.genEqual()
+}
+
+// genElements 逐个比较数组的count个元素，elements返回第i个元素的地址
+func (g *compareGen) genElements(typ *ast.TypeReference, gcon *ast.GenericContext, count llvm.Value, elements func(i llvm.Value) (llvm.Value, llvm.Value)) {
+	b := g.builder
+	entry := b.GetInsertBlock()
+	header := llvm.AddBasicBlock(g.fn, "elements")
+	body := llvm.AddBasicBlock(g.fn, "element")
+	exit := llvm.AddBasicBlock(g.fn, "elements_end")
+	b.CreateBr(header)
+
+	b.SetInsertPointAtEnd(header)
+	i := b.CreatePHI(count.Type(), "i")
+	b.CreateCondBr(b.CreateICmp(llvm.IntULT, i, count, ""), body, exit)
+
+	b.SetInsertPointAtEnd(body)
+	lp, rp := elements(i)
+	g.genMember(typ, gcon, lp, rp)
+	next := b.CreateAdd(i, llvm.ConstInt(count.Type(), 1, false), "")
+	i.AddIncoming([]llvm.Value{llvm.ConstInt(count.Type(), 0, false), next}, []llvm.BasicBlock{entry, b.GetInsertBlock()})
+	b.CreateBr(header)
+
+	b.SetInsertPointAtEnd(exit)
+}
+
+// genMember 比较一个成员，结果决定比较已经结束时返回
+func (g *compareGen) genMember(typ *ast.TypeReference, gcon *ast.GenericContext, lp, rp llvm.Value) {
+	b := g.builder
+	if ast.IsCompositeComparison(g.resolve(typ, gcon)) {
+		res := b.CreateCall(g.v.compareFunction(g.ordered, typ, gcon), []llvm.Value{lp, rp}, "")
+		if g.ordered {
+			g.genCheck(b.CreateICmp(llvm.IntEQ, res, llvm.ConstInt(res.Type(), 0, false), ""), res)
+		} else {
+			g.genCheck(res)
+		}
+		return
+	}
+
+	lhand, rhand := b.CreateLoad(lp, ""), b.CreateLoad(rp, "")
+	actual, _ := comparisonType(typ, gcon)
+	switch t := actual.(type) {
+	case ast.FunctionType:
+		// 函数值按函数指针和环境指针比较，参见 closure.go
+		for idx := 0; idx < 2; idx++ {
+			l, r := b.CreateExtractValue(lhand, idx, ""), b.CreateExtractValue(rhand, idx, "")
+			g.genCheck(b.CreateICmp(llvm.IntEQ, l, r, ""))
+		}
+
+	case ast.PrimitiveType:
+		if g.ordered {
+			res := g.genOrder(lhand, rhand, t.IsSigned())
+			g.genCheck(b.CreateICmp(llvm.IntEQ, res, llvm.ConstInt(res.Type(), 0, false), ""), res)
+		} else if t.IsFloatingType() {
+			g.genCheck(b.CreateFCmp(llvm.FloatOEQ, lhand, rhand, ""))
+		} else {
+			g.genCheck(b.CreateICmp(llvm.IntEQ, lhand, rhand, ""))
+		}
+
+	default:
+		// 指针、引用和简单枚举
+		if g.ordered {
+			res := g.genOrder(lhand, rhand, actual.IsSigned())
+			g.genCheck(b.CreateICmp(llvm.IntEQ, res, llvm.ConstInt(res.Type(), 0, false), ""), res)
+		} else {
+			g.genCheck(b.CreateICmp(llvm.IntEQ, lhand, rhand, ""))
+		}
+	}
+}
+
+// resolve 泛型参数在当前泛型上下文中的实参
+func (g *compareGen) resolve(typ *ast.TypeReference, gcon *ast.GenericContext) *ast.TypeReference {
+	for {
+		sub, ok := typ.BaseType.(*ast.SubstitutionType)
+		if !ok {
+			return typ
+		}
+		typ = gcon.GetSubstitutionType(sub)
+	}
+}
+
+// genOrder 两个标量的大小：-1、0 或 1。浮点数有NaN时为0
+func (g *compareGen) genOrder(lhand, rhand llvm.Value, signed bool) llvm.Value {
+	b := g.builder
+	var less, greater llvm.Value
+	if lhand.Type().TypeKind() == llvm.IntegerTypeKind || lhand.Type().TypeKind() == llvm.PointerTypeKind {
+		less = b.CreateICmp(comparisonOpToIntPredicate(parser.BINOP_LESS, signed), lhand, rhand, "")
+		greater = b.CreateICmp(comparisonOpToIntPredicate(parser.BINOP_GREATER, signed), lhand, rhand, "")
+	} else {
+		less = b.CreateFCmp(llvm.FloatOLT, lhand, rhand, "")
+		greater = b.CreateFCmp(llvm.FloatOGT, lhand, rhand, "")
+	}
+
+	i32 := llvm.Int32Type()
+	res := b.CreateSelect(greater, llvm.ConstInt(i32, 1, false), llvm.ConstInt(i32, 0, false), "")
+	return b.CreateSelect(less, llvm.ConstAllOnes(i32), res, "")
+}
+
+// genCheck cond为false时返回：eq返回false，cmp返回res
+func (g *compareGen) genCheck(cond llvm.Value, res ...llvm.Value) {
+	b := g.builder
+	next := llvm.AddBasicBlock(g.fn, "next")
+	done := llvm.AddBasicBlock(g.fn, "done")
+	b.CreateCondBr(cond, next, done)
+
+	b.SetInsertPointAtEnd(done)
+	if g.ordered {
+		b.CreateRet(res[0])
+	} else {
+		b.CreateRet(llvm.ConstInt(llvm.IntType(1), 0, false))
+	}
+
+	b.SetInsertPointAtEnd(next)
+}
+
+// genEqual 所有成员都相等：eq返回true，cmp返回0
+func (g *compareGen) genEqual() {
+	if g.ordered {
+		g.builder.CreateRet(llvm.ConstInt(llvm.Int32Type(), 0, false))
+	} else {
+		g.builder.CreateRet(llvm.ConstInt(llvm.IntType(1), 1, false))
+	}
+}
@@ -0,0 +1,26 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 作为表达式的if和match（ast.CondExpr）
+//
+// 在函数的栈上分配存放值的位置，然后按语句生成if或match。每个分支的代码块在结尾求出它的值（Block.Tail），
+// 存放到最内层的存放位置（tailValues的最后一个），再执行这个代码块的defer，参见 genBlock。
+// 不产生值的分支（return、break等）不会执行到汇合的位置，汇合之后读出存放的值。
+
+// genCondExpr 生成作为表达式的if或match
+func (v *Codegen) genCondExpr(n *ast.CondExpr) llvm.Value {
+	if !v.inFunction() {
+		v.err("Cannot use %s in a global initializer", n.NodeName())
+	}
+
+	ptr := v.createAlignedAlloca(v.typeRefToLLVMType(n.GetType()), "cond_value")
+	v.tailValues = append(v.tailValues, ptr)
+	v.genNode(n.Stat)
+	v.tailValues = v.tailValues[:len(v.tailValues)-1]
+
+	return v.builder().CreateLoad(ptr, "")
+}
@@ -0,0 +1,74 @@
+package LLVMCodegen
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+
+	"github.com/ark-lang/go-llvm/llvm"
+)
+
+// 常量池：字符串常量和数组常量按内容命名为 linkonce_odr 的只读全局变量，
+// 同一个模块中只生成一次，不同模块中的相同常量在链接时合并为一份。
+// 常量池里的数据是只读的，可能被写入时需要先复制一份，见 strlit.go。
+
+const constantPoolPrefix = "__ku_const_"
+
+// poolConstant 返回常量池中内容为init的全局变量。key必须唯一确定init的内容
+func (v *Codegen) poolConstant(key string, init llvm.Value) llvm.Value {
+	hash := sha1.Sum([]byte(key))
+	name := constantPoolPrefix + hex.EncodeToString(hash[:])
+
+	global := v.curFile.LlvmModule.NamedGlobal(name)
+	if global.IsNil() {
+		global = llvm.AddGlobal(v.curFile.LlvmModule, init.Type(), name)
+		if v.isWindowsTarget() {
+			// COFF中的linkonce_odr需要comdat才能合并，这里退化为每个目标文件各自一份
+			global.SetLinkage(llvm.PrivateLinkage)
+		} else {
+			global.SetLinkage(llvm.LinkOnceODRLinkage)
+		}
+		global.SetGlobalConstant(true)
+		global.SetInitializer(init)
+	}
+	return global
+}
+
+// poolString 返回常量池中以0结尾的字符串，类型为 i8*
+func (v *Codegen) poolString(value string) llvm.Value {
+	global := v.poolConstant("str:"+value, llvm.ConstString(value, true))
+	return llvm.ConstBitCast(global, llvm.PointerType(llvm.IntType(8), 0))
+}
+
+// constantArrayKey 如果数组常量的元素类型是基本类型，且元素都是常量，返回其内容对应的常量池键
+func constantArrayKey(memberType *ast.TypeReference, values []ast.Expr) (string, bool) {
+	prim, ok := memberType.BaseType.ActualType().(ast.PrimitiveType)
+	if !ok {
+		return "", false
+	}
+
+	parts := make([]string, 0, len(values)+1)
+	parts = append(parts, "array:"+prim.TypeName())
+
+	for _, value := range values {
+		switch value := value.(type) {
+		case *ast.NumericLiteral:
+			if value.IsFloat {
+				parts = append(parts, strconv.FormatFloat(value.FloatValue, 'g', -1, 64))
+			} else {
+				parts = append(parts, value.IntValue.String())
+			}
+		case *ast.BoolLiteral:
+			parts = append(parts, strconv.FormatBool(value.Value))
+		case *ast.RuneLiteral:
+			parts = append(parts, strconv.QuoteRune(value.Value))
+		default:
+			return "", false
+		}
+	}
+
+	return strings.Join(parts, ","), true
+}
@@ -0,0 +1,138 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// cstr(s) 把ku字符串转换为以NUL结尾的C字符串
+//
+// 分配 len(s)+1 字节的缓冲区，复制字符串的内容，再写入结尾的0。
+// 每个转换在函数的入口基本块中有 cstrStackLimit 字节的栈上缓冲区，字符串放得下时使用它，
+// 否则用 malloc 在堆上分配。栈的使用量是固定的，很长的字符串和循环中的转换都不会耗尽栈空间。
+// 缓冲区的有效期：
+//   - 传给C函数时的隐式转换（Implicit）只在这次调用期间有效，调用之后释放堆上的缓冲区
+//   - cstr 以及 defer 的实参中的隐式转换在离开所在的块时失效（与drop一样，包括break、continue和return）。
+//     堆上的缓冲区记录在入口基本块中分配的位置中，离开块时释放并清空；语义检查保证结果不会存入块外的变量
+//
+// 同一个转换在块中再次执行时（如循环条件）复用栈上的缓冲区，并释放上一次在堆上分配的缓冲区。
+// 字符串字面量直接生成C字符串字面量，不需要复制。
+
+// cstrStackLimit 每个转换在栈上的缓冲区的字节数
+const cstrStackLimit = 256
+
+// cstrCall 有隐式C字符串实参的调用，生成实参时在堆上分配的缓冲区在调用之后释放
+type cstrCall struct {
+	fn    functionAndFnGenericInstance
+	heaps []llvm.Value // 在栈上分配时为null
+}
+
+func (v *Codegen) genCStringExpr(n *ast.CStringExpr) llvm.Value {
+	if lit, ok := n.Expr.(*ast.StringLiteral); ok {
+		return v.genStringLiteral(&ast.StringLiteral{Value: lit.Value, IsCString: true})
+	}
+	if !v.inFunction() {
+		v.err("Cannot use `cstr` in a global initializer")
+	}
+
+	str := v.genExprAndLoadIfNeccesary(n.Expr)
+	length := v.builder().CreateExtractValue(str, 0, "")
+	data := v.builder().CreateExtractValue(str, 1, "")
+
+	u8 := v.primitiveTypeToLLVMType(ast.PRIMITIVE_u8)
+	bytePtr := llvm.PointerType(u8, 0)
+	sizeType := length.Type()
+	size := v.builder().CreateAdd(length, llvm.ConstInt(sizeType, 1, false), "")
+
+	stackBuf := v.builder().CreateBitCast(v.createAlignedAlloca(llvm.ArrayType(u8, cstrStackLimit), "cstr_buf"), bytePtr, "")
+	fn := v.currentLLVMFunction()
+	heapBlock := llvm.AddBasicBlock(fn, "cstr_heap")
+	done := llvm.AddBasicBlock(fn, "cstr_done")
+
+	entry := v.builder().GetInsertBlock()
+	small := v.builder().CreateICmp(llvm.IntULE, size, llvm.ConstInt(sizeType, cstrStackLimit, false), "")
+	v.builder().CreateCondBr(small, done, heapBlock)
+
+	v.builder().SetInsertPointAtEnd(heapBlock)
+	heapBuf := v.builder().CreateCall(v.mallocFunction(sizeType), []llvm.Value{size}, "")
+	v.builder().CreateBr(done)
+
+	v.builder().SetInsertPointAtEnd(done)
+	res := v.builder().CreatePHI(bytePtr, "cstr")
+	res.AddIncoming([]llvm.Value{stackBuf, heapBuf}, []llvm.BasicBlock{entry, heapBlock})
+	heap := v.builder().CreatePHI(bytePtr, "")
+	heap.AddIncoming([]llvm.Value{llvm.ConstNull(bytePtr), heapBuf}, []llvm.BasicBlock{entry, heapBlock})
+
+	v.genMemcpy(data, res, length)
+	end := v.builder().CreateGEP(res, []llvm.Value{length}, "")
+	v.builder().CreateStore(llvm.ConstInt(u8, 0, false), end)
+
+	if call := v.currentCStringCall(); n.Implicit && call != nil {
+		call.heaps = append(call.heaps, heap)
+	} else {
+		v.genFreeCStringOnBlockExit(heap)
+	}
+	return res
+}
+
+// currentCStringCall 当前函数中正在生成实参的有隐式C字符串实参的调用
+func (v *Codegen) currentCStringCall() *cstrCall {
+	if len(v.cstrCalls) == 0 {
+		return nil
+	}
+	if call := v.cstrCalls[len(v.cstrCalls)-1]; call.fn == v.currentFunction() {
+		return call
+	}
+	return nil
+}
+
+// genFreeCStringOnBlockExit 把堆上的缓冲区heap（可能为null）记录在入口基本块中分配的位置中，离开当前块时释放
+func (v *Codegen) genFreeCStringOnBlockExit(heap llvm.Value) {
+	slot := v.createAlignedAlloca(heap.Type(), "cstr_heap")
+
+	// 在入口基本块中清空，没有执行到转换就离开块时释放的是null
+	entryBuilder := llvm.NewBuilder()
+	defer entryBuilder.Dispose()
+	entryBuilder.SetInsertPoint(v.currentLLVMFunction().EntryBasicBlock(), slot.NextInstruction())
+	entryBuilder.CreateStore(llvm.ConstNull(heap.Type()), slot)
+
+	v.builder().CreateCall(v.freeFunction(), []llvm.Value{v.builder().CreateLoad(slot, "")}, "")
+	v.builder().CreateStore(heap, slot)
+	v.blockDeferData[v.currentBlock()] = append(v.blockDeferData[v.currentBlock()], &deferData{cstr: slot})
+}
+
+// genReleaseCString 释放位置slot中记录的堆上的缓冲区并清空，块可能再次执行
+func (v *Codegen) genReleaseCString(slot llvm.Value) {
+	v.builder().CreateCall(v.freeFunction(), []llvm.Value{v.builder().CreateLoad(slot, "")}, "")
+	v.builder().CreateStore(llvm.ConstNull(slot.Type().ElementType()), slot)
+}
+
+// mallocFunction、freeFunction C标准库的 malloc 和 free，sizeType是 size_t 对应的类型
+
+func (v *Codegen) mallocFunction(sizeType llvm.Type) llvm.Value {
+	fn := v.curFile.LlvmModule.NamedFunction("malloc")
+	if fn.IsNil() {
+		fnType := llvm.FunctionType(llvm.PointerType(llvm.IntType(8), 0), []llvm.Type{sizeType}, false)
+		fn = llvm.AddFunction(v.curFile.LlvmModule, "malloc", fnType)
+	}
+	return fn
+}
+
+func (v *Codegen) freeFunction() llvm.Value {
+	fn := v.curFile.LlvmModule.NamedFunction("free")
+	if fn.IsNil() {
+		fnType := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.PointerType(llvm.IntType(8), 0)}, false)
+		fn = llvm.AddFunction(v.curFile.LlvmModule, "free", fnType)
+	}
+	return fn
+}
+
+// hasImplicitCString 调用的实参中是否有隐式转换的C字符串
+func hasImplicitCString(n *ast.CallExpr) bool {
+	for _, arg := range n.Arguments {
+		if conv, ok := arg.(*ast.CStringExpr); ok && conv.Implicit {
+			return true
+		}
+	}
+	return false
+}
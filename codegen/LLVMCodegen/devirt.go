@@ -0,0 +1,80 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/mir"
+)
+
+// 去虚化：被调用的函数在编译时已知的间接调用生成为直接调用
+//
+// 通过函数值和接口值的调用都是间接调用（参见 closure.go 和 interface.go），以下情况被调用的函数是已知的：
+//   - 通过函数值的调用，由 mir.Devirtualize 在模块的MIR上分析，如 let f = compare; f(a, b)，直接调用这个函数。
+//     泛型函数和用到MIR还不支持的特性的函数没有MIR，其中的调用不处理；
+//   - 接收者是装箱表达式，或者只在声明时由装箱表达式初始化的局部变量，如 let s Shape = circle; s.area()，
+//     装箱的值的类型已知，直接调用它的方法的绑定函数，不读取方法表。MIR不包含通过接口值的调用，这里在AST上分析：
+//     局部变量在声明之后不能被赋值或者取地址（参见 variableInfo），声明总在读取之前执行，所以读出的总是初始值。
+// C函数不处理，调用它们的实参按C的约定生成（参见 genCallArg）。
+
+// markKnownCallees 生成模块的MIR并去虚化，记录被调用函数已知的间接调用
+func (v *Codegen) markKnownCallees(mod *WrappedModule) {
+	mirModule := mir.Lower(mod.Module)
+	mir.Devirtualize(mirModule)
+	for call, fae := range mir.KnownCallees(mirModule) {
+		v.knownCallees[call] = fae
+	}
+}
+
+// knownCallee 通过函数值的调用n的被调用函数在编译时已知时返回这个函数，否则返回nil
+func (v *Codegen) knownCallee(n *ast.CallExpr) *ast.FunctionAccessExpr {
+	fae := v.knownCallees[n]
+	if fae == nil || fae.Function.Type.Attrs().Contains("C") {
+		return nil
+	}
+	return fae
+}
+
+// knownInterfaceMethod 通过接口值调用方法fae时，装箱的值的类型在编译时已知则返回方法的绑定函数
+func (v *Codegen) knownInterfaceMethod(fae *ast.FunctionAccessExpr) (llvm.Value, bool) {
+	wrap, ok := fae.ReceiverAccess.(*ast.InterfaceWrapExpr)
+	if !ok {
+		wrap, ok = v.knownInitializer(fae.ReceiverAccess).(*ast.InterfaceWrapExpr)
+	}
+	if !ok || wrap.Borrowed {
+		return llvm.Value{}, false
+	}
+
+	valType, ifaceType := wrap.Expr.GetType(), fae.ReceiverAccess.GetType()
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		valType, ifaceType = gcon.Replace(valType), gcon.Replace(ifaceType)
+	}
+
+	// 接收者是接口值的指针或引用时不处理
+	inter, ok := ast.InterfaceOf(ifaceType)
+	if !ok {
+		return llvm.Value{}, false
+	}
+	for _, ifn := range inter.Functions {
+		if ifn.Name != fae.Function.Name {
+			continue
+		}
+		if method, _ := ast.InterfaceMethod(valType, ifaceType, ifn); method != nil {
+			return v.boxedMethodThunk(valType, method), true
+		}
+	}
+	return llvm.Value{}, false
+}
+
+// knownInitializer expr是声明之后没有被修改过的局部变量时返回它的初始值，否则返回nil
+func (v *Codegen) knownInitializer(expr ast.Expr) ast.Expr {
+	access, ok := expr.(*ast.VariableAccessExpr)
+	if !ok {
+		return nil
+	}
+
+	info := v.functionVariableInfo(v.currentFunction().fn)
+	if info.assigned[access.Variable] || info.addressTaken[access.Variable] {
+		return nil
+	}
+	return info.initializers[access.Variable]
+}
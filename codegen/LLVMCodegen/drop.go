@@ -0,0 +1,111 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 调用drop方法，参见 ast/drop.go
+//
+// 有drop方法的局部变量和参数与defer一样记录在所在块的 blockDeferData 中，离开块时按逆序执行，
+// 因此drop和defer的顺序就是声明的逆序。
+
+// dropType 类型为typ的值是否有drop方法，以及它在当前函数的泛型实例中的实际类型。
+// 是否drop按声明的类型判断，与语义检查一致，类型为泛型参数的值不drop
+func (v *Codegen) dropType(typ *ast.TypeReference) (*ast.TypeReference, bool) {
+	if ast.DropMethod(typ) == nil {
+		return typ, false
+	}
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		typ = gcon.Replace(typ)
+	}
+	return typ, true
+}
+
+// addDrop 局部变量离开当前块时drop
+func (v *Codegen) addDrop(vari *ast.Variable) {
+	if _, ok := v.dropType(vari.Type); ok {
+		v.blockDeferData[v.currentBlock()] = append(v.blockDeferData[v.currentBlock()], &deferData{drop: vari})
+	}
+}
+
+// addParameterDrops 参数在函数返回时drop，接收者是借用的
+func (v *Codegen) addParameterDrops(fn *ast.Function) {
+	for _, par := range fn.Parameters {
+		if _, ok := v.dropType(par.Variable.Type); ok {
+			v.blockDeferData[fn.Body] = append(v.blockDeferData[fn.Body], &deferData{drop: par.Variable})
+		}
+	}
+}
+
+func (v *Codegen) genDropVariable(vari *ast.Variable) {
+	typ, _ := v.dropType(vari.Type)
+	v.genDrop(typ, v.getVariable(newvariableAndFnGenericInstance(vari, v.currentFunction().gcon)))
+}
+
+// genDropBeforeAssign 给有drop方法的变量赋值之前drop原来的值
+func (v *Codegen) genDropBeforeAssign(acc ast.AccessExpr) {
+	vae, ok := acc.(*ast.VariableAccessExpr)
+	if !ok {
+		return
+	}
+	if typ, ok := v.dropType(vae.Variable.Type); ok {
+		v.genDrop(typ, v.genAccessGEP(vae))
+	}
+}
+
+// genDrop 调用存放在addr的类型为typ的值的drop方法
+func (v *Codegen) genDrop(typ *ast.TypeReference, addr llvm.Value) {
+	drop := ast.DropMethod(typ)
+	fn := v.genAccessExpr(&ast.FunctionAccessExpr{Function: drop, GenericArguments: typ.GenericArguments})
+
+	recvType := fn.Type().ElementType().ParamTypes()[0]
+	var recv llvm.Value
+	if _, pointerReceiver := drop.Type.Receiver.BaseType.(ast.PointerType); pointerReceiver {
+		recv = v.builder().CreateBitCast(addr, recvType, "")
+	} else {
+		recv = v.builder().CreateLoad(v.builder().CreateBitCast(addr, llvm.PointerType(recvType, 0), ""), "")
+	}
+	v.builder().CreateCall(fn, []llvm.Value{recv}, "")
+}
+
+// isRuntimeFree 是否是调用运行时的 free(p)
+func isRuntimeFree(n *ast.CallExpr) bool {
+	fae, ok := n.Function.(*ast.FunctionAccessExpr)
+	return ok && fae.Function.Name == "free" && fae.Function.ParentModule.IsRuntime()
+}
+
+// genDropPointee free(p) 释放内存之前drop指向的值。p为null时什么都不做
+func (v *Codegen) genDropPointee(n *ast.CallExpr, ptr llvm.Value) {
+	fae := n.Function.(*ast.FunctionAccessExpr)
+	typ, ok := v.dropType(fae.GenericArguments[0])
+	if !ok {
+		return
+	}
+
+	dropBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "drop")
+	endBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "drop_end")
+	isNull := v.builder().CreateICmp(llvm.IntEQ, ptr, llvm.ConstNull(ptr.Type()), "")
+	v.builder().CreateCondBr(isNull, endBlock, dropBlock)
+
+	v.builder().SetInsertPointAtEnd(dropBlock)
+	v.genDrop(typ, ptr)
+	v.builder().CreateBr(endBlock)
+
+	v.builder().SetInsertPointAtEnd(endBlock)
+}
+
+// genMoveExpr 生成位于移动的位置上的值（参见 ast/move.go）。移出有drop方法的变量之后把它置为零值，
+// 离开作用域时drop的是零值
+func (v *Codegen) genMoveExpr(expr ast.Expr) llvm.Value {
+	value := v.genExprAndLoadIfNeccesary(expr)
+	if !v.inFunction() {
+		return value
+	}
+	if vari := ast.MovedVariable(expr); vari != nil {
+		if _, ok := v.dropType(vari.Type); ok {
+			v.builder().CreateStore(llvm.ConstNull(value.Type()), v.genAccessGEP(expr))
+		}
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package LLVMCodegen
+
+import (
+	"fmt"
+
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 时长的检查溢出的运算
+//
+// Duration（参见 runtime.ku）的加减乘，以及 +=、-=、*=，使用LLVM的 sadd.with.overflow 等内部函数计算，
+// 溢出时调用运行时的 __duration_overflow 停止程序。其它运算与 s64 相同；wrapping_add 等内建函数仍然按它们的规则计算。
+
+// isCheckedDurationOp 类型为typ的运算op是否检查溢出
+func isCheckedDurationOp(op parser.BinOpType, typ *ast.TypeReference) bool {
+	switch op {
+	case parser.BINOP_ADD, parser.BINOP_SUB, parser.BINOP_MUL:
+		return ast.IsDurationType(typ)
+	}
+	return false
+}
+
+func (v *Codegen) genDurationArith(op parser.BinOpType, lhand, rhand llvm.Value) llvm.Value {
+	var opName string
+	switch op {
+	case parser.BINOP_ADD:
+		opName = "sadd"
+	case parser.BINOP_SUB:
+		opName = "ssub"
+	case parser.BINOP_MUL:
+		opName = "smul"
+	default:
+		panic("INTERNAL ERROR: Unchecked duration operator")
+	}
+
+	llvmType := lhand.Type()
+	resType := llvm.StructType([]llvm.Type{llvmType, v.primitiveTypeToLLVMType(ast.PRIMITIVE_bool)}, false)
+	fn := v.getIntrinsic(fmt.Sprintf("llvm.%s.with.overflow.i%d", opName, llvmType.IntTypeWidth()),
+		llvm.FunctionType(resType, []llvm.Type{llvmType, llvmType}, false))
+	res := v.builder().CreateCall(fn, []llvm.Value{lhand, rhand}, "")
+
+	overflowBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "duration_overflow")
+	okBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "duration_ok")
+	v.builder().CreateCondBr(v.builder().CreateExtractValue(res, 1, ""), overflowBlock, okBlock)
+
+	v.builder().SetInsertPointAtEnd(overflowBlock)
+	overflow := v.genAccessExpr(&ast.FunctionAccessExpr{Function: ast.RuntimeFunction("__duration_overflow")})
+	v.builder().CreateCall(overflow, nil, "")
+	v.builder().CreateUnreachable()
+
+	v.builder().SetInsertPointAtEnd(okBlock)
+	return v.builder().CreateExtractValue(res, 0, "")
+}
@@ -0,0 +1,211 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 哈希值 hashof(value)，可以计算哪些类型参见 ast/compare.go
+//
+// 每个类型生成一个哈希函数 hash.<类型>，接收值的地址，返回 u64。每个模块中每个类型只生成一次，
+// 成员是复合类型时调用成员类型的哈希函数，与比较函数（compare.go）相同。
+// 哈希值按FNV-1a的方式逐个混入64位的字：整数扩展到64位（128位整数分成两个字），指针和引用取地址，
+// 简单枚举取值；结构体和元组依次混入成员，数组先混入长度再混入元素，带数据的枚举先混入标签再混入这个成员的数据。
+// 相等的值混入的字相同，因此哈希值也相同。
+
+const (
+	hashOffsetBasis = 0xcbf29ce484222325
+	hashPrime       = 0x100000001b3
+)
+
+// genHashExpr 生成 hashof(value)
+func (v *Codegen) genHashExpr(n *ast.HashExpr) llvm.Value {
+	typ := n.Expr.GetType()
+	if !v.inFunction() {
+		v.err("Cannot hash values of type `%s` in a global initializer", typ.String())
+	}
+
+	value := v.genExpr(n.Expr)
+	ptr := v.createAlignedAlloca(value.Type(), "hash_value")
+	v.builder().CreateStore(value, ptr)
+	return v.builder().CreateCall(v.hashFunction(typ, v.currentFunction().gcon), []llvm.Value{ptr}, "")
+}
+
+// hashFunction 类型为typ的值的哈希函数
+func (v *Codegen) hashFunction(typ *ast.TypeReference, gcon *ast.GenericContext) llvm.Value {
+	name := "hash." + ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, typ, gcon)
+	if fn := v.curFile.LlvmModule.NamedFunction(name); !fn.IsNil() {
+		return fn
+	}
+
+	ptrType := llvm.PointerType(v.typeRefToLLVMTypeWithOuter(typ, gcon), 0)
+	fn := llvm.AddFunction(v.curFile.LlvmModule, name, llvm.FunctionType(llvm.Int64Type(), []llvm.Type{ptrType}, false))
+	fn.SetLinkage(llvm.InternalLinkage)
+
+	g := &hashGen{v: v, fn: fn, builder: llvm.NewBuilder()}
+	defer g.builder.Dispose()
+	g.builder.SetInsertPointAtEnd(llvm.AddBasicBlock(fn, "entry"))
+	h := g.genValue(typ, gcon, fn.Param(0), llvm.ConstInt(llvm.Int64Type(), hashOffsetBasis, false))
+	g.builder.CreateRet(h)
+	return fn
+}
+
+// hashGen 生成一个哈希函数的函数体
+type hashGen struct {
+	v       *Codegen
+	fn      llvm.Value
+	builder llvm.Builder
+}
+
+// mix 把64位的字x混入哈希值h
+func (g *hashGen) mix(h, x llvm.Value) llvm.Value {
+	b := g.builder
+	return b.CreateMul(b.CreateXor(h, x, ""), llvm.ConstInt(llvm.Int64Type(), hashPrime, false), "")
+}
+
+// genValue 把地址为ptr的值混入哈希值h，返回新的哈希值
+func (g *hashGen) genValue(typ *ast.TypeReference, gcon *ast.GenericContext, ptr, h llvm.Value) llvm.Value {
+	b := g.builder
+	actual, gcon := comparisonType(typ, gcon)
+
+	switch t := actual.(type) {
+	case ast.StructType:
+		llvmType := ptr.Type().ElementType()
+		for idx, mem := range t.Members {
+			h = g.genMember(mem.Type, gcon, b.CreateStructGEP(ptr, g.v.structFieldIndex(llvmType, idx), ""), h)
+		}
+		return h
+
+	case ast.TupleType:
+		for idx, mem := range t.Members {
+			h = g.genMember(mem, gcon, b.CreateStructGEP(ptr, idx, ""), h)
+		}
+		return h
+
+	case ast.ArrayType:
+		if t.IsFixedLength {
+			length := llvm.ConstInt(g.v.primitiveTypeToLLVMType(ast.PRIMITIVE_uint), uint64(t.Length), false)
+			return g.genElements(t.MemberType, gcon, length, h, func(i llvm.Value) llvm.Value {
+				return b.CreateGEP(ptr, []llvm.Value{llvm.ConstInt(i.Type(), 0, false), i}, "")
+			})
+		}
+
+		length := b.CreateLoad(b.CreateStructGEP(ptr, 0, ""), "")
+		data := b.CreateLoad(b.CreateStructGEP(ptr, 1, ""), "")
+		h = g.mix(h, g.word(length))
+		return g.genElements(t.MemberType, gcon, length, h, func(i llvm.Value) llvm.Value {
+			return b.CreateGEP(data, []llvm.Value{i}, "")
+		})
+
+	case ast.EnumType:
+		if t.Simple {
+			return g.mix(h, g.word(b.CreateLoad(ptr, "")))
+		}
+		return g.genEnum(t, gcon, ptr, h)
+
+	default:
+		// 整数、布尔值、指针和引用
+		value := b.CreateLoad(ptr, "")
+		if value.Type().TypeKind() == llvm.IntegerTypeKind && value.Type().IntTypeWidth() > 64 {
+			high := b.CreateLShr(value, llvm.ConstInt(value.Type(), 64, false), "")
+			h = g.mix(h, b.CreateTrunc(value, llvm.Int64Type(), ""))
+			return g.mix(h, b.CreateTrunc(high, llvm.Int64Type(), ""))
+		}
+		return g.mix(h, g.word(value))
+	}
+}
+
+// genMember 混入一个成员，复合类型的成员调用成员类型的哈希函数
+func (g *hashGen) genMember(typ *ast.TypeReference, gcon *ast.GenericContext, ptr, h llvm.Value) llvm.Value {
+	resolved := typ
+	for {
+		sub, ok := resolved.BaseType.(*ast.SubstitutionType)
+		if !ok {
+			break
+		}
+		resolved = gcon.GetSubstitutionType(sub)
+	}
+	if ast.IsCompositeComparison(resolved) {
+		return g.mix(h, g.builder.CreateCall(g.v.hashFunction(typ, gcon), []llvm.Value{ptr}, ""))
+	}
+	return g.genValue(typ, gcon, ptr, h)
+}
+
+// genEnum 先混入标签，再按标签混入这个成员的数据
+func (g *hashGen) genEnum(t ast.EnumType, gcon *ast.GenericContext, ptr, h llvm.Value) llvm.Value {
+	b := g.builder
+	tag := b.CreateLoad(b.CreateStructGEP(ptr, 0, ""), "")
+	h = g.mix(h, g.word(tag))
+
+	entry := b.GetInsertBlock()
+	end := llvm.AddBasicBlock(g.fn, "enum_end")
+	sw := b.CreateSwitch(tag, end, len(t.Members))
+	var values []llvm.Value
+	var blocks []llvm.BasicBlock
+	for idx, mem := range t.Members {
+		members := ast.ComparisonMembers(mem.Type)
+		if len(members) == 0 {
+			continue
+		}
+
+		block := llvm.AddBasicBlock(g.fn, "member_"+mem.Name)
+		sw.AddCase(llvm.ConstInt(g.v.enumTagLLVMType(t), uint64(mem.Tag), false), block)
+		b.SetInsertPointAtEnd(block)
+
+		memberPtr := llvm.PointerType(g.v.llvmEnumTypeForMember(t, idx, gcon), 0)
+		data := b.CreateStructGEP(b.CreateBitCast(ptr, memberPtr, ""), 1, "")
+		mh := h
+		for field, typ := range members {
+			mh = g.genMember(typ, gcon, b.CreateStructGEP(data, field, ""), mh)
+		}
+		values = append(values, mh)
+		blocks = append(blocks, b.GetInsertBlock())
+		b.CreateBr(end)
+	}
+
+	b.SetInsertPointAtEnd(end)
+	res := b.CreatePHI(llvm.Int64Type(), "")
+	res.AddIncoming(append(values, h), append(blocks, entry))
+	return res
+}
+
+// genElements 依次混入数组的count个元素，element返回第i个元素的地址
+func (g *hashGen) genElements(typ *ast.TypeReference, gcon *ast.GenericContext, count, h llvm.Value, element func(i llvm.Value) llvm.Value) llvm.Value {
+	b := g.builder
+	entry := b.GetInsertBlock()
+	header := llvm.AddBasicBlock(g.fn, "elements")
+	body := llvm.AddBasicBlock(g.fn, "element")
+	exit := llvm.AddBasicBlock(g.fn, "elements_end")
+	b.CreateBr(header)
+
+	b.SetInsertPointAtEnd(header)
+	i := b.CreatePHI(count.Type(), "i")
+	acc := b.CreatePHI(llvm.Int64Type(), "h")
+	b.CreateCondBr(b.CreateICmp(llvm.IntULT, i, count, ""), body, exit)
+
+	b.SetInsertPointAtEnd(body)
+	next := g.genMember(typ, gcon, element(i), acc)
+	inc := b.CreateAdd(i, llvm.ConstInt(count.Type(), 1, false), "")
+	i.AddIncoming([]llvm.Value{llvm.ConstInt(count.Type(), 0, false), inc}, []llvm.BasicBlock{entry, b.GetInsertBlock()})
+	acc.AddIncoming([]llvm.Value{h, next}, []llvm.BasicBlock{entry, b.GetInsertBlock()})
+	b.CreateBr(header)
+
+	b.SetInsertPointAtEnd(exit)
+	return acc
+}
+
+// word 把不超过64位的整数或指针转换为64位的字
+func (g *hashGen) word(value llvm.Value) llvm.Value {
+	b := g.builder
+	i64 := llvm.Int64Type()
+	switch value.Type().TypeKind() {
+	case llvm.PointerTypeKind:
+		return b.CreatePtrToInt(value, i64, "")
+	case llvm.IntegerTypeKind:
+		if value.Type().IntTypeWidth() < 64 {
+			return b.CreateZExt(value, i64, "")
+		}
+		return value
+	}
+	panic("INTERNAL ERROR: Cannot hash a value that is neither an integer nor a pointer")
+}
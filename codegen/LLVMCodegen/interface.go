@@ -0,0 +1,244 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 接口值
+//
+// 接口值是 {装箱的值的地址, 方法表的地址}，两个成员都是 i8*（参见 ast/interface.go）。
+// 方法表是每个（类型, 接口）一个的常量数组，第一项是类型信息，之后按接口中方法的顺序存放类型的方法的绑定函数，
+// 与方法值使用相同的绑定函数（参见 closure.go），所以通过接口值调用方法和取得方法值都不需要再包装。
+// 装箱的值存放在当前函数的栈上，每次装箱使用新的存储，不与之前装箱的值共享
+//
+// 类型信息是每个类型一个的常量 {类型名, 方法数组, 方法数}，与运行时中的 TypeInfo 布局相同，
+// 方法数组的每一项是 {Key, 绑定函数}（参见 ast.TypeInfoMethods）。
+// 接口值之间的转换不知道装箱的值的类型，由运行时在类型信息中按Key查找目标接口的每个方法，
+// 新的方法表与装箱的值一样存放在当前函数的栈上
+
+// interfaceValueType 接口值的类型
+func (v *Codegen) interfaceValueType() llvm.Type {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+	return llvm.StructType([]llvm.Type{i8ptr, i8ptr}, false)
+}
+
+// isInterfaceValue 类型（去掉指针和引用之后）是否是接口类型
+func (v *Codegen) isInterfaceValue(typ *ast.TypeReference) bool {
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		typ = gcon.Replace(typ)
+	}
+	for {
+		switch t := typ.BaseType.(type) {
+		case ast.PointerType:
+			typ = t.Addressee
+		case ast.ReferenceType:
+			typ = t.Referrer
+		default:
+			_, ok := ast.InterfaceOf(typ)
+			return ok
+		}
+	}
+}
+
+// genInterfaceWrapExpr 把值复制到栈上，与方法表一起组成接口值。
+// Borrowed时不复制，引用的地址就是装箱的值的地址
+func (v *Codegen) genInterfaceWrapExpr(n *ast.InterfaceWrapExpr) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	valType, ifaceType := n.Expr.GetType(), n.Interface
+	if n.Borrowed {
+		valType = valType.BaseType.(ast.ReferenceType).Referrer
+	}
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		valType, ifaceType = gcon.Replace(valType), gcon.Replace(ifaceType)
+	}
+
+	var box llvm.Value
+	if n.Borrowed {
+		box = v.genExprAndLoadIfNeccesary(n.Expr)
+	} else {
+		// 不放在入口基本块中：循环中每次装箱都要有自己的存储
+		valLLVMType := v.typeRefToLLVMType(valType)
+		box = v.builder().CreateAlloca(valLLVMType, "interface_box")
+		box.SetAlignment(v.targetData.ABITypeAlignment(valLLVMType))
+		v.builder().CreateStore(v.genExprAndLoadIfNeccesary(n.Expr), box)
+	}
+
+	res := llvm.Undef(v.interfaceValueType())
+	res = v.builder().CreateInsertValue(res, v.builder().CreateBitCast(box, i8ptr, ""), 0, "")
+	res = v.builder().CreateInsertValue(res, llvm.ConstBitCast(v.interfaceVtable(valType, ifaceType), i8ptr), 1, "")
+	return res
+}
+
+// interfaceVtable 类型为valType的值作为接口ifaceType时的方法表。每个模块中只生成一次
+func (v *Codegen) interfaceVtable(valType, ifaceType *ast.TypeReference) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	noGcon := ast.NewGenericContext(nil, nil)
+	name := "_vtable" + ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, valType, noGcon) +
+		ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, ifaceType, noGcon)
+	if vtable := v.curFile.LlvmModule.NamedGlobal(name); !vtable.IsNil() {
+		return vtable
+	}
+
+	inter, _ := ast.InterfaceOf(ifaceType)
+	entries := make([]llvm.Value, len(inter.Functions)+1)
+	entries[0] = llvm.ConstBitCast(v.typeInfo(valType), i8ptr)
+	for idx, ifn := range inter.Functions {
+		method, reason := ast.InterfaceMethod(valType, ifaceType, ifn)
+		if method == nil {
+			// 语义检查已经报告
+			panic("INTERNAL ERROR: " + reason)
+		}
+
+		entries[idx+1] = llvm.ConstBitCast(v.boxedMethodThunk(valType, method), i8ptr)
+	}
+
+	vtable := llvm.AddGlobal(v.curFile.LlvmModule, llvm.ArrayType(i8ptr, len(entries)), name)
+	vtable.SetLinkage(llvm.InternalLinkage)
+	vtable.SetGlobalConstant(true)
+	vtable.SetInitializer(llvm.ConstArray(i8ptr, entries))
+	return vtable
+}
+
+// boxedMethodThunk 类型为valType的装箱的值的方法method的绑定函数
+func (v *Codegen) boxedMethodThunk(valType *ast.TypeReference, method *ast.Function) llvm.Value {
+	fae := &ast.FunctionAccessExpr{Function: method, GenericArguments: valType.GenericArguments}
+	_, pointerReceiver := method.Type.Receiver.BaseType.(ast.PointerType)
+	return v.boundMethodThunk(v.genAccessExpr(fae), !pointerReceiver)
+}
+
+// typeInfo 类型为valType的装箱的值的类型信息。每个模块中只生成一次
+func (v *Codegen) typeInfo(valType *ast.TypeReference) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	name := "_typeinfo" + ast.TypeReferenceMangledName(ast.MANGLE_ARK_UNSTABLE, valType, ast.NewGenericContext(nil, nil))
+	if info := v.curFile.LlvmModule.NamedGlobal(name); !info.IsNil() {
+		return info
+	}
+
+	methods := ast.TypeInfoMethods(valType)
+	methodType := llvm.StructType([]llvm.Type{i8ptr, i8ptr}, false)
+	entries := make([]llvm.Value, len(methods))
+	for idx, method := range methods {
+		entries[idx] = llvm.ConstStruct([]llvm.Value{
+			v.constCString(method.Key),
+			llvm.ConstBitCast(v.boxedMethodThunk(valType, method.Function), i8ptr),
+		}, false)
+	}
+
+	methodArray := llvm.AddGlobal(v.curFile.LlvmModule, llvm.ArrayType(methodType, len(entries)), name+".methods")
+	methodArray.SetLinkage(llvm.InternalLinkage)
+	methodArray.SetGlobalConstant(true)
+	methodArray.SetInitializer(llvm.ConstArray(methodType, entries))
+
+	uintType := v.primitiveTypeToLLVMType(ast.PRIMITIVE_uint)
+	info := llvm.AddGlobal(v.curFile.LlvmModule, llvm.StructType([]llvm.Type{i8ptr, llvm.PointerType(methodType, 0), uintType}, false), name)
+	info.SetLinkage(llvm.InternalLinkage)
+	info.SetGlobalConstant(true)
+	info.SetInitializer(llvm.ConstStruct([]llvm.Value{
+		v.constCString(valType.String()),
+		llvm.ConstBitCast(methodArray, llvm.PointerType(methodType, 0)),
+		llvm.ConstInt(uintType, uint64(len(entries)), false),
+	}, false))
+	return info
+}
+
+// constCString 常量C字符串，返回i8*
+func (v *Codegen) constCString(str string) llvm.Value {
+	global := llvm.AddGlobal(v.curFile.LlvmModule, llvm.ArrayType(llvm.IntType(8), len(str)+1), ".str")
+	global.SetLinkage(llvm.InternalLinkage)
+	global.SetGlobalConstant(true)
+	global.SetInitializer(llvm.ConstString(str, true))
+	return llvm.ConstBitCast(global, llvm.PointerType(llvm.IntType(8), 0))
+}
+
+// genInterfaceMethod 从接口值（或者它的指针、引用）中取出方法fn的绑定函数和装箱的值的地址
+func (v *Codegen) genInterfaceMethod(value llvm.Value, typ *ast.TypeReference, fn *ast.Function) (fnPtr, data llvm.Value) {
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		typ = gcon.Replace(typ)
+	}
+	for ast.IsPointerOrReferenceType(typ.BaseType) {
+		value = v.builder().CreateLoad(value, "")
+		switch t := typ.BaseType.ActualType().(type) {
+		case ast.PointerType:
+			typ = t.Addressee
+		case ast.ReferenceType:
+			typ = t.Referrer
+		}
+	}
+
+	inter, _ := ast.InterfaceOf(typ)
+	index := -1
+	for idx, ifn := range inter.Functions {
+		if ifn.Name == fn.Name {
+			index = idx
+		}
+	}
+
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+	data = v.builder().CreateExtractValue(value, 0, "")
+	vtable := v.builder().CreateBitCast(v.builder().CreateExtractValue(value, 1, ""), llvm.PointerType(i8ptr, 0), "")
+	slot := v.builder().CreateGEP(vtable, []llvm.Value{llvm.ConstInt(llvm.IntType(32), uint64(index+1), false)}, "")
+	return v.builder().CreateLoad(slot, ""), data
+}
+
+// genInterfaceCall 通过接口值调用方法：args的第一个是接收者，换成装箱的值的地址，调用方法表中的绑定函数。
+// 装箱的值的类型已知时直接调用绑定函数，参见 devirt.go
+func (v *Codegen) genInterfaceCall(fae *ast.FunctionAccessExpr, fnType ast.FunctionType, args []llvm.Value) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	fnPtr, known := v.knownInterfaceMethod(fae)
+	var data llvm.Value
+	if known {
+		data = v.builder().CreateExtractValue(args[0], 0, "")
+	} else {
+		fnPtr, data = v.genInterfaceMethod(args[0], fae.ReceiverAccess.GetType(), fae.Function)
+	}
+
+	plainType := v.functionTypeToLLVMType(fnType, false, nil)
+	boundType := llvm.FunctionType(plainType.ReturnType(), append([]llvm.Type{i8ptr}, plainType.ParamTypes()...), false)
+
+	bound := v.builder().CreateBitCast(fnPtr, llvm.PointerType(boundType, 0), "")
+	return v.builder().CreateCall(bound, append([]llvm.Value{data}, args[1:]...), "")
+}
+
+// genInterfaceCast 接口值之间的转换 J(i)：装箱的值不变，由方法表第一项的类型信息查找J的每个方法，组成新的方法表
+func (v *Codegen) genInterfaceCast(n *ast.CastExpr) llvm.Value {
+	i8ptr := llvm.PointerType(llvm.IntType(8), 0)
+
+	ifaceType := n.GetType()
+	if gcon := v.currentFunction().gcon; gcon != nil {
+		ifaceType = gcon.Replace(ifaceType)
+	}
+	inter, _ := ast.InterfaceOf(ifaceType)
+
+	value := v.genExprAndLoadIfNeccesary(n.Expr)
+	oldVtable := v.builder().CreateBitCast(v.builder().CreateExtractValue(value, 1, ""), llvm.PointerType(i8ptr, 0), "")
+	info := v.builder().CreateLoad(oldVtable, "")
+
+	lookup := v.genAccessExpr(&ast.FunctionAccessExpr{Function: ast.RuntimeFunction("__interface_method")})
+	lookupParams := lookup.Type().ElementType().ParamTypes()
+	ifaceName := v.constCString(ifaceType.String())
+
+	vtable := v.builder().CreateAlloca(llvm.ArrayType(i8ptr, len(inter.Functions)+1), "interface_vtable")
+	vtablePtr := v.builder().CreateBitCast(vtable, llvm.PointerType(i8ptr, 0), "")
+	v.builder().CreateStore(info, vtablePtr)
+	for idx, ifn := range inter.Functions {
+		key := v.constCString(ast.InterfaceMethodKey(ifn.Name, ast.InterfaceMethodType(ifaceType, ifn)))
+		fn := v.builder().CreateCall(lookup, []llvm.Value{
+			v.builder().CreateBitCast(info, lookupParams[0], ""),
+			llvm.ConstBitCast(key, lookupParams[1]),
+			llvm.ConstBitCast(ifaceName, lookupParams[2]),
+		}, "")
+
+		slot := v.builder().CreateGEP(vtablePtr, []llvm.Value{llvm.ConstInt(llvm.IntType(32), uint64(idx+1), false)}, "")
+		v.builder().CreateStore(v.builder().CreateIntToPtr(fn, i8ptr, ""), slot)
+	}
+
+	res := llvm.Undef(v.interfaceValueType())
+	res = v.builder().CreateInsertValue(res, v.builder().CreateExtractValue(value, 0, ""), 0, "")
+	res = v.builder().CreateInsertValue(res, v.builder().CreateBitCast(vtable, i8ptr, ""), 1, "")
+	return res
+}
@@ -0,0 +1,151 @@
+package LLVMCodegen
+
+import (
+	"sort"
+
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 结构体布局
+//
+// 默认编译器可以重排结构体的成员：按对齐从大到小排列，减少成员之间的填充。
+// 只有重排后确实变小时才重排，否则保持声明的顺序。
+// 标注了 [layout(c)] 或 [packed] 的结构体（参见 ast.StructType.FixedLayout）按声明的顺序排列，
+// 与C共享的结构体必须标注 [layout(c)]。
+// 只重排命名的结构体类型，枚举成员中的结构体按声明的顺序排列（模式匹配按位置解构）。
+//
+// 重排后成员在LLVM结构体中的位置与 MemberIndex 不同，访问成员时用 structFieldIndex 转换
+
+// reorderStructFields 按对齐从大到小重排成员。返回重排后的成员类型，以及每个成员（按声明的顺序）的位置；
+// 重排不能减小结构体时返回nil
+func (v *Codegen) reorderStructFields(fields []llvm.Type) ([]llvm.Type, []int) {
+	positions := make([]int, len(fields))
+	for idx := range positions {
+		positions[idx] = idx
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return v.targetData.ABITypeAlignment(fields[positions[i]]) > v.targetData.ABITypeAlignment(fields[positions[j]])
+	})
+
+	reordered := make([]llvm.Type, len(fields))
+	order := make([]int, len(fields))
+	for pos, idx := range positions {
+		reordered[pos] = fields[idx]
+		order[idx] = pos
+	}
+
+	if v.targetData.TypeAllocSize(llvm.StructType(reordered, false)) >= v.targetData.TypeAllocSize(llvm.StructType(fields, false)) {
+		return nil, nil
+	}
+	return reordered, order
+}
+
+// structFieldIndex 结构体成员（MemberIndex）在LLVM结构体类型中的位置
+func (v *Codegen) structFieldIndex(structType llvm.Type, memberIdx int) int {
+	if order, ok := v.structFieldOrders[structType]; ok {
+		return order[memberIdx]
+	}
+	return memberIdx
+}
+
+// FieldLayout 结构体成员在内存中的位置
+type FieldLayout struct {
+	Name   string
+	Type   *ast.TypeReference
+	Offset uint64
+	Size   uint64
+	Align  uint64
+}
+
+// StructLayout 结构体在目标平台上的布局，成员按在内存中的顺序排列
+type StructLayout struct {
+	Size      uint64
+	Align     uint64
+	Reordered bool // 成员的顺序与声明的顺序不同
+	Fields    []FieldLayout
+}
+
+// LayoutOf 计算结构体类型在目标平台（Target）上的布局，用于 ku analyze --layout。
+// 不需要先生成代码，类型不能依赖泛型的类型参数
+func (v *Codegen) LayoutOf(typ *ast.TypeReference) *StructLayout {
+	v.initLayout()
+
+	st := typ.BaseType.ActualType().(ast.StructType)
+	llvmType := v.typeRefToLLVMType(typ)
+	gcon := ast.NewGenericContextFromTypeReference(typ)
+
+	res := &StructLayout{
+		Size:  v.targetData.TypeAllocSize(llvmType),
+		Align: uint64(v.targetData.ABITypeAlignment(llvmType)),
+	}
+	_, res.Reordered = v.structFieldOrders[llvmType]
+
+	// 联合体的成员都从偏移0开始
+	if st.IsUnion {
+		for _, mem := range st.Members {
+			memType := gcon.Replace(mem.Type)
+			memLLVMType := v.typeRefToLLVMType(memType)
+			res.Fields = append(res.Fields, FieldLayout{
+				Name:  mem.Name,
+				Type:  memType,
+				Size:  v.targetData.TypeAllocSize(memLLVMType),
+				Align: uint64(v.targetData.ABITypeAlignment(memLLVMType)),
+			})
+		}
+		return res
+	}
+
+	fieldTypes := llvmType.StructElementTypes()
+	for idx, mem := range st.Members {
+		pos := v.structFieldIndex(llvmType, idx)
+		res.Fields = append(res.Fields, FieldLayout{
+			Name:   mem.Name,
+			Type:   gcon.Replace(mem.Type),
+			Offset: v.targetData.ElementOffset(llvmType, pos),
+			Size:   v.targetData.TypeAllocSize(fieldTypes[pos]),
+			Align:  uint64(v.targetData.ABITypeAlignment(fieldTypes[pos])),
+		})
+	}
+	sort.SliceStable(res.Fields, func(i, j int) bool {
+		return res.Fields[i].Offset < res.Fields[j].Offset
+	})
+	return res
+}
+
+// initLayout 不生成代码时计算类型布局所需的初始化
+func (v *Codegen) initLayout() {
+	if v.namedTypeLookup == nil {
+		v.initializeTarget()
+		v.namedTypeLookup = make(map[string]llvm.Type)
+		v.structFieldOrders = make(map[llvm.Type][]int)
+		v.curFile = &WrappedModule{LlvmModule: llvm.NewModule("layout")}
+	}
+}
+
+// SizeOf、AlignOf、OffsetOf 类型在目标平台上的大小、对齐以及结构体成员的偏移（实现 ast.TypeLayout），
+// 用于计算数组长度中的 sizeof、alignof、offsetof。依赖泛型的类型参数时不是常量
+
+func (v *Codegen) SizeOf(typ *ast.TypeReference) (uint64, bool) {
+	if typeHasSubstitution(typ) {
+		return 0, false
+	}
+	v.initLayout()
+	return v.targetData.TypeAllocSize(v.typeRefToLLVMType(typ)), true
+}
+
+func (v *Codegen) AlignOf(typ *ast.TypeReference) (uint64, bool) {
+	if typeHasSubstitution(typ) {
+		return 0, false
+	}
+	v.initLayout()
+	return uint64(v.targetData.ABITypeAlignment(v.typeRefToLLVMType(typ))), true
+}
+
+func (v *Codegen) OffsetOf(typ *ast.TypeReference, member string) (uint64, bool) {
+	if typeHasSubstitution(typ) {
+		return 0, false
+	}
+	v.initLayout()
+	return v.memberOffset(typ, member), true
+}
@@ -0,0 +1,148 @@
+package LLVMCodegen
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/semantic"
+)
+
+// 字符串的模式匹配 match s { "get" => ..., "put" => ..., _ => ... }
+//
+// 先按长度分派（switch），长度相同的模式按内容排序后二分查找：每一步用 memcmp 比较目标与中间的模式，
+// 相等时进入分支，小于0时在前一半中查找，大于0时在后一半中查找，而不是逐个比较所有的模式。
+// 模式的内容取自常量池（constpool.go），空字符串只需要按长度分派。
+// 没有匹配的模式时进入 _ 分支，没有 _ 分支时跳过整个 match 语句。模式不能重复，由 semantic 检查。
+
+// stringCase 字符串模式和它的分支的入口
+type stringCase struct {
+	value string
+	block llvm.BasicBlock
+}
+
+// genStringMatchStat 生成目标是 string 的 match 语句
+func (v *Codegen) genStringMatchStat(n *ast.MatchStat) {
+	target := v.genLoadIfNeccesary(n.Target, v.genExpr(n.Target))
+	length := v.builder().CreateExtractValue(target, 0, "match_len")
+	data := v.builder().CreateExtractValue(target, 1, "match_data")
+
+	fn := v.currentLLVMFunction()
+	exitBlock := llvm.AddBasicBlock(fn, "match_exit")
+	defaultBlock := exitBlock
+
+	// 按源码中的顺序生成分支，生成的代码是确定的
+	patterns := make([]ast.Expr, 0, len(n.Branches))
+	for pattern := range n.Branches {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i].Pos(), patterns[j].Pos()
+		return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+	})
+
+	var cases []stringCase
+	blocks := make([]llvm.BasicBlock, len(patterns))
+	for idx, pattern := range patterns {
+		switch p := pattern.(type) {
+		case *ast.StringLiteral:
+			blocks[idx] = llvm.AddBasicBlock(fn, "match_branch")
+			cases = append(cases, stringCase{value: p.Value, block: blocks[idx]})
+		case *ast.DiscardAccessExpr:
+			blocks[idx] = llvm.AddBasicBlock(fn, "match_branch_default")
+			defaultBlock = blocks[idx]
+		default:
+			panic("INTERNAL ERROR: Branch in string match was not string literal or discard")
+		}
+	}
+
+	sort.Slice(cases, func(i, j int) bool {
+		a, b := cases[i].value, cases[j].value
+		return len(a) < len(b) || (len(a) == len(b) && a < b)
+	})
+
+	// 按长度分派，每个长度一组
+	sw := v.builder().CreateSwitch(length, defaultBlock, len(cases))
+	for start := 0; start < len(cases); {
+		end := start + 1
+		for end < len(cases) && len(cases[end].value) == len(cases[start].value) {
+			end++
+		}
+
+		size := len(cases[start].value)
+		block := llvm.AddBasicBlock(fn, fmt.Sprintf("match_len_%d", size))
+		sw.AddCase(llvm.ConstInt(length.Type(), uint64(size), false), block)
+		v.builder().SetInsertPointAtEnd(block)
+		v.genStringSearch(data, length, cases[start:end], defaultBlock)
+		start = end
+	}
+
+	for idx, pattern := range patterns {
+		v.builder().SetInsertPointAtEnd(blocks[idx])
+		branch := n.Branches[pattern]
+		v.genNode(branch)
+		if !semantic.IsNodeTerminating(branch) {
+			v.builder().CreateBr(exitBlock)
+		}
+	}
+
+	exitBlock.MoveAfter(v.builder().GetInsertBlock())
+	v.builder().SetInsertPointAtEnd(exitBlock)
+}
+
+// genStringSearch 在排好序的、长度都是length的模式中二分查找data，没有找到时跳转到defaultBlock
+func (v *Codegen) genStringSearch(data, length llvm.Value, cases []stringCase, defaultBlock llvm.BasicBlock) {
+	if len(cases) == 0 {
+		v.builder().CreateBr(defaultBlock)
+		return
+	}
+	if len(cases[0].value) == 0 {
+		v.builder().CreateBr(cases[0].block)
+		return
+	}
+
+	mid := len(cases) / 2
+	fn := v.currentLLVMFunction()
+	res := v.builder().CreateCall(v.memcmpFunction(length.Type()), []llvm.Value{data, v.poolString(cases[mid].value), length}, "")
+	zero := llvm.ConstInt(res.Type(), 0, false)
+
+	less, greater := cases[:mid], cases[mid+1:]
+	if len(less) == 0 && len(greater) == 0 {
+		v.builder().CreateCondBr(v.builder().CreateICmp(llvm.IntEQ, res, zero, ""), cases[mid].block, defaultBlock)
+		return
+	}
+
+	notEqual := llvm.AddBasicBlock(fn, "match_cmp")
+	v.builder().CreateCondBr(v.builder().CreateICmp(llvm.IntEQ, res, zero, ""), cases[mid].block, notEqual)
+	v.builder().SetInsertPointAtEnd(notEqual)
+
+	lessBlock, greaterBlock := defaultBlock, defaultBlock
+	if len(less) > 0 {
+		lessBlock = llvm.AddBasicBlock(fn, "match_less")
+	}
+	if len(greater) > 0 {
+		greaterBlock = llvm.AddBasicBlock(fn, "match_greater")
+	}
+	v.builder().CreateCondBr(v.builder().CreateICmp(llvm.IntSLT, res, zero, ""), lessBlock, greaterBlock)
+
+	if len(less) > 0 {
+		v.builder().SetInsertPointAtEnd(lessBlock)
+		v.genStringSearch(data, length, less, defaultBlock)
+	}
+	if len(greater) > 0 {
+		v.builder().SetInsertPointAtEnd(greaterBlock)
+		v.genStringSearch(data, length, greater, defaultBlock)
+	}
+}
+
+// memcmpFunction C标准库的 memcmp，sizeType是 size_t 对应的类型
+func (v *Codegen) memcmpFunction(sizeType llvm.Type) llvm.Value {
+	fn := v.curFile.LlvmModule.NamedFunction("memcmp")
+	if fn.IsNil() {
+		bytePtr := llvm.PointerType(llvm.IntType(8), 0)
+		fnType := llvm.FunctionType(llvm.Int32Type(), []llvm.Type{bytePtr, bytePtr, sizeType}, false)
+		fn = llvm.AddFunction(v.curFile.LlvmModule, "memcmp", fnType)
+	}
+	return fn
+}
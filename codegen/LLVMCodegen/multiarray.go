@@ -0,0 +1,76 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 多维数组
+//
+// [3][4]int 是元素为 [4]int 的定长数组，在LLVM中是 [3 x [4 x i64]]，按行优先存放。
+// 连续访问定长数组的 a[i][j] 只计算一次地址（一个GEP），所有下标的边界检查合并为一次比较和跳转：
+// 下标扩展到指针宽度后按无符号数与长度比较，负数下标也会越界。
+
+// fixedArrayAccesses 连续访问定长数组时最外层的数组表达式，以及从外到内的每一层访问。
+// 如 a[i][j] 返回 a 和 [a[i], a[i][j]]
+func fixedArrayAccesses(access *ast.ArrayAccessExpr) (ast.Expr, []*ast.ArrayAccessExpr) {
+	accesses := []*ast.ArrayAccessExpr{access}
+	for {
+		arrType, ok := access.Array.GetType().BaseType.ActualType().(ast.ArrayType)
+		if !ok || !arrType.IsFixedLength {
+			return access.Array, nil
+		}
+
+		inner, ok := access.Array.(*ast.ArrayAccessExpr)
+		if !ok {
+			return access.Array, accesses
+		}
+		if innerType, ok := inner.Array.GetType().BaseType.ActualType().(ast.ArrayType); !ok || !innerType.IsFixedLength {
+			return access.Array, accesses
+		}
+
+		accesses = append([]*ast.ArrayAccessExpr{inner}, accesses...)
+		access = inner
+	}
+}
+
+// genFixedArrayAccessGEP 计算连续访问定长数组的元素地址，合并所有下标的边界检查
+func (v *Codegen) genFixedArrayAccessGEP(base ast.Expr, accesses []*ast.ArrayAccessExpr) llvm.Value {
+	gep := v.genAccessGEP(base)
+
+	indices := []llvm.Value{llvm.ConstInt(llvm.Int32Type(), 0, false)}
+	var outOfBounds llvm.Value
+	for _, access := range accesses {
+		index := v.genSubscript(access.Subscript)
+		indices = append(indices, index)
+
+		var cond llvm.Value
+		if v.uncheckedAccesses[access] {
+			// 只需要检查下界
+			if access.Subscript.GetType().BaseType.IsSigned() {
+				cond = v.builder().CreateICmp(llvm.IntSLT, index, llvm.ConstInt(index.Type(), 0, false), "boundscheck_lower")
+			}
+		} else {
+			length := access.Array.GetType().BaseType.ActualType().(ast.ArrayType).Length
+			cond = v.builder().CreateICmp(llvm.IntUGE, index, llvm.ConstInt(index.Type(), uint64(length), false), "boundscheck")
+		}
+
+		if cond.IsNil() {
+			continue
+		} else if outOfBounds.IsNil() {
+			outOfBounds = cond
+		} else {
+			outOfBounds = v.builder().CreateOr(outOfBounds, cond, "")
+		}
+	}
+
+	if !outOfBounds.IsNil() {
+		segvBlock, needToSetup := v.boundsCheckSegvBlock()
+		endBlock := llvm.AddBasicBlock(v.currentLLVMFunction(), "boundscheck_end")
+		v.builder().CreateCondBr(outOfBounds, segvBlock, endBlock)
+		v.setupSegvBlock(segvBlock, needToSetup)
+		v.builder().SetInsertPointAtEnd(endBlock)
+	}
+
+	return v.builder().CreateGEP(gep, indices, "")
+}
@@ -0,0 +1,30 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// new value 在堆上分配一个值
+//
+// 先计算值，再通过运行时钩子alloc分配目标平台上这个类型的大小的内存，把值存入其中，得到指向它的指针。
+// 钩子的链接符号由用户程序替换时（参见 ast.HookSymbol），new同样使用替换后的分配器。
+
+func (v *Codegen) genNewExpr(n *ast.NewExpr) llvm.Value {
+	if !v.inFunction() {
+		v.err("Cannot use `new` in a global initializer")
+	}
+
+	value := v.genMoveExpr(n.Expr)
+	typ := value.Type()
+
+	alloc := v.genAccessExpr(&ast.FunctionAccessExpr{Function: ast.RuntimeHook("alloc")})
+	sizeType := alloc.Type().ElementType().ParamTypes()[0]
+	mem := v.builder().CreateCall(alloc, []llvm.Value{
+		llvm.ConstInt(sizeType, v.targetData.TypeAllocSize(typ), false),
+	}, "")
+
+	ptr := v.builder().CreateBitCast(mem, llvm.PointerType(typ, 0), "new")
+	v.builder().CreateStore(value, ptr)
+	return ptr
+}
@@ -0,0 +1,199 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 纯函数的内存属性
+//
+// 纯函数（标注的或者推导出的，参见 ast.Function.IsPure）不修改调用者可见的内存，但它仍然可以读取不可修改的全局变量、
+// 通过指针参数读取内存、调用其他纯函数，所以一般只能标注为 readonly。
+// 只有能证明函数不访问任何内存时才标注为 readnone：参数中没有指针（functionTypeHasIndirection），
+// 函数体中只有局部变量、基本类型的运算和控制流，调用的函数也都能证明是 readnone。
+// 全局变量、解引用、数组下标（越界时调用运行时报错）、字符串比较、分配内存等都算作访问内存。
+// 这里的分析是保守的：无法证明时使用 readonly。
+//
+// 只有标注了 [pure] 的函数才加上这些LLVM属性：推导出的纯函数可能不会结束（如死循环），
+// 加上属性后没有使用结果的调用可能被删除，改变程序的行为。
+// 标注的和推导出的纯函数都用于公共子表达式消除：同一个基本块中用同样的实参调用 readnone 的纯函数时，复用之前的结果（参见 reusePureCall）。
+
+// pureFunctionReadsNone 纯函数fn（在泛型上下文gcon中）是否能证明不访问任何内存
+func pureFunctionReadsNone(fn *ast.Function, gcon *ast.GenericContext) bool {
+	return (&readNoneAnalysis{visiting: make(map[*ast.Function]bool)}).function(fn, gcon)
+}
+
+type readNoneAnalysis struct {
+	// 正在分析的函数。递归调用不改变结论，按 readnone 处理
+	visiting map[*ast.Function]bool
+}
+
+func (v *readNoneAnalysis) function(fn *ast.Function, gcon *ast.GenericContext) bool {
+	if v.visiting[fn] {
+		return true
+	}
+	if !fn.IsPure() || fn.Body == nil || functionTypeHasIndirection(fn.Type, gcon) {
+		return false
+	}
+	v.visiting[fn] = true
+
+	scanner := &memoryAccessScanner{analysis: v, gcon: gcon, locals: make(map[*ast.Variable]bool)}
+	if fn.Receiver != nil {
+		scanner.locals[fn.Receiver.Variable] = true
+	}
+	for _, param := range fn.Parameters {
+		scanner.locals[param.Variable] = true
+	}
+	ast.NewASTVisitor(scanner).Visit(fn.Body)
+	return !scanner.touchesMemory
+}
+
+// memoryAccessScanner 在函数体中查找可能访问内存的节点
+type memoryAccessScanner struct {
+	analysis      *readNoneAnalysis
+	gcon          *ast.GenericContext
+	locals        map[*ast.Variable]bool
+	touchesMemory bool
+}
+
+func (v *memoryAccessScanner) EnterScope() {}
+func (v *memoryAccessScanner) ExitScope()  {}
+
+func (v *memoryAccessScanner) PostVisit(node *ast.Node) {}
+
+func (v *memoryAccessScanner) Visit(node *ast.Node) bool {
+	if v.touchesMemory {
+		return false
+	}
+
+	switch n := (*node).(type) {
+	case *ast.Block, *ast.BlockStat, *ast.IfStat, *ast.LoopStat, *ast.ReturnStat, *ast.BreakStat, *ast.ContinueStat,
+		*ast.CallStat, *ast.AssignStat, *ast.BinopAssignStat, *ast.DestructAssignStat, *ast.DestructBinopAssignStat,
+		*ast.DiscardAccessExpr, *ast.TempAccessExpr, *ast.CondExpr,
+		*ast.NumericLiteral, *ast.BoolLiteral, *ast.RuneLiteral, *ast.TupleLiteral, *ast.UnaryExpr, *ast.CastExpr,
+		*ast.OverflowArithExpr, *ast.FloatBuiltinExpr, *ast.SizeofExpr, *ast.AlignofExpr, *ast.OffsetofExpr,
+		*ast.StaticAssertStat:
+		return true
+
+	case *ast.VariableDecl:
+		v.locals[n.Variable] = true
+		return true
+
+	case *ast.DestructVarDecl:
+		for _, vari := range n.Variables {
+			v.locals[vari] = true
+		}
+		return true
+
+	case *ast.VariableAccessExpr:
+		v.touchesMemory = !v.locals[n.Variable]
+
+	case *ast.StructAccessExpr:
+		// 通过指针或引用访问成员时会隐式解引用
+		v.touchesMemory = n.Method != nil || !v.isValueType(n.Struct.GetType())
+		return !v.touchesMemory
+
+	case *ast.CompositeLiteral:
+		v.touchesMemory = !v.isValueType(n.Type)
+		return !v.touchesMemory
+
+	case *ast.BinaryExpr:
+		// 字符串、结构等的比较会读取内存（如调用 memcmp）
+		v.touchesMemory = n.Method != nil || !v.isPrimitive(n.Lhand.GetType()) || !v.isPrimitive(n.Rhand.GetType())
+		return !v.touchesMemory
+
+	case *ast.MatchStat:
+		v.touchesMemory = !v.isPrimitive(n.Target.GetType())
+		return !v.touchesMemory
+
+	case *ast.CallExpr:
+		fae, ok := n.Function.(*ast.FunctionAccessExpr)
+		// 泛型函数的实例需要单独分析，这里不处理
+		v.touchesMemory = !ok || len(fae.GenericArguments) > 0 || len(fae.Function.Type.GenericParameters) > 0 ||
+			!v.analysis.function(fae.Function, nil)
+		if !v.touchesMemory {
+			if n.ReceiverAccess != nil {
+				ast.NewASTVisitor(v).VisitExpr(n.ReceiverAccess)
+			}
+			for _, arg := range n.Arguments {
+				ast.NewASTVisitor(v).VisitExpr(arg)
+			}
+		}
+
+	case *ast.FunctionDecl:
+		// 嵌套函数单独生成，只在调用时分析
+
+	default:
+		v.touchesMemory = true
+	}
+	return false
+}
+
+func (v *memoryAccessScanner) resolve(typ *ast.TypeReference) *ast.TypeReference {
+	if v.gcon != nil {
+		return v.gcon.Replace(typ)
+	}
+	return typ
+}
+
+func (v *memoryAccessScanner) isPrimitive(typ *ast.TypeReference) bool {
+	if typ == nil {
+		return false
+	}
+	_, ok := v.resolve(typ).BaseType.ActualType().(ast.PrimitiveType)
+	return ok
+}
+
+// isValueType 类型的值直接保存在变量中，访问它不需要读取其他内存
+func (v *memoryAccessScanner) isValueType(typ *ast.TypeReference) bool {
+	return typ != nil && !typeReferenceHasIndirection(v.resolve(typ))
+}
+
+// pureCall 基本块中对 readnone 纯函数的调用
+type pureCall struct {
+	fn     llvm.Value
+	args   []llvm.Value
+	result llvm.Value
+}
+
+// callReadsNone 对fae的调用是否调用了能证明不访问任何内存的纯函数。泛型函数、方法和C函数不处理
+func (v *Codegen) callReadsNone(fae *ast.FunctionAccessExpr) bool {
+	fn := fae.Function
+	if len(fae.GenericArguments) > 0 || len(fn.Type.GenericParameters) > 0 || fn.Receiver != nil || fn.Type.Attrs().Contains("C") {
+		return false
+	}
+	res, ok := v.readNoneFunctions[fn]
+	if !ok {
+		res = pureFunctionReadsNone(fn, nil)
+		v.readNoneFunctions[fn] = res
+	}
+	return res
+}
+
+// reusePureCall 当前基本块中之前用同样的实参调用过 readnone 的纯函数fn时，返回那次调用的结果
+func (v *Codegen) reusePureCall(fn llvm.Value, args []llvm.Value) (llvm.Value, bool) {
+	block := v.builder().GetInsertBlock()
+	for _, call := range v.pureCalls[block] {
+		if call.fn == fn && sameValues(call.args, args) {
+			return call.result, true
+		}
+	}
+	return llvm.Value{}, false
+}
+
+func (v *Codegen) recordPureCall(fn llvm.Value, args []llvm.Value, result llvm.Value) {
+	block := v.builder().GetInsertBlock()
+	v.pureCalls[block] = append(v.pureCalls[block], pureCall{fn: fn, args: args, result: result})
+}
+
+func sameValues(a, b []llvm.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
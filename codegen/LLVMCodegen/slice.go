@@ -0,0 +1,48 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 切片 a[low:high]
+//
+// 结果是新的数组头 {high-low, ptr+low}，与a共享元素，不复制。
+// 切片之前调用运行时的 __slice_check 检查 0 <= low <= high <= len(a)，不满足时停止程序；
+// 两端先扩展到指针的宽度，再作为无符号数比较，负数的下标也会被当作越界。
+// 字符串（string类型）改为调用 __string_slice_check，它还检查两端不会切开多字节的UTF-8字符。
+
+func (v *Codegen) genSliceExpr(n *ast.SliceExpr) llvm.Value {
+	if !v.inFunction() {
+		v.err("Cannot slice in a global initializer")
+	}
+
+	array := v.genExprAndLoadIfNeccesary(n.Array)
+	length := v.builder().CreateExtractValue(array, 0, "")
+	data := v.builder().CreateExtractValue(array, 1, "")
+
+	low := llvm.ConstInt(length.Type(), 0, false)
+	if n.Low != nil {
+		low = v.builder().CreateIntCast(v.genSubscript(n.Low), length.Type(), "")
+	}
+	high := length
+	if n.High != nil {
+		high = v.builder().CreateIntCast(v.genSubscript(n.High), length.Type(), "")
+	}
+
+	if ast.IsStringType(n.Array.GetType()) {
+		v.genSliceCheck("__string_slice_check", array, low, high)
+	} else {
+		v.genSliceCheck("__slice_check", length, low, high)
+	}
+
+	res := llvm.Undef(array.Type())
+	res = v.builder().CreateInsertValue(res, v.builder().CreateSub(high, low, ""), 0, "")
+	res = v.builder().CreateInsertValue(res, v.builder().CreateGEP(data, []llvm.Value{low}, ""), 1, "")
+	return res
+}
+
+func (v *Codegen) genSliceCheck(name string, args ...llvm.Value) {
+	fn := v.genAccessExpr(&ast.FunctionAccessExpr{Function: ast.RuntimeFunction(name)})
+	v.builder().CreateCall(fn, args, "")
+}
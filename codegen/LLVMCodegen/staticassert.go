@@ -0,0 +1,137 @@
+package LLVMCodegen
+
+import (
+	"fmt"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 编译期断言
+//
+//	static_assert(sizeof(Header) == 16, "Header must match the C layout");
+//
+// 条件由常量求值器计算。与目标平台无关的断言在语义分析时检查（参见 semantic.StaticAssertCheck）；
+// 用到 sizeof、alignof、offsetof 等数据布局的断言被标记为 TargetDependent，在每个模块生成代码之前检查（包括函数体中的）。
+// 泛型函数中依赖类型参数的断言无法对所有实例检查，直接跳过。
+
+// checkStaticAsserts 检查子模块中依赖目标平台的编译期断言，条件不成立时报错退出
+func (v *Codegen) checkStaticAsserts(submod *ast.Submodule) {
+	scanner := &staticAssertScanner{}
+	visitor := ast.NewASTVisitor(scanner)
+	for _, node := range submod.Nodes {
+		visitor.Visit(node)
+	}
+
+	if len(scanner.asserts) == 0 {
+		return
+	}
+
+	generic := false
+	eval := ast.NewConstEvaluator(v.inputModules())
+	eval.Calls = true
+	eval.SizeOf = func(typ *ast.TypeReference) (uint64, bool) {
+		if typeHasSubstitution(typ) {
+			generic = true
+			return 0, false
+		}
+		return v.targetData.TypeAllocSize(v.typeRefToLLVMType(typ)), true
+	}
+	eval.AlignOf = func(typ *ast.TypeReference) (uint64, bool) {
+		if typeHasSubstitution(typ) {
+			generic = true
+			return 0, false
+		}
+		return uint64(v.targetData.ABITypeAlignment(v.typeRefToLLVMType(typ))), true
+	}
+	eval.OffsetOf = func(typ *ast.TypeReference, member string) (uint64, bool) {
+		if typeHasSubstitution(typ) {
+			generic = true
+			return 0, false
+		}
+		return v.memberOffset(typ, member), true
+	}
+
+	for _, stat := range scanner.asserts {
+		generic = false
+		value := eval.Eval(stat.Cond)
+		switch {
+		case value == nil && generic:
+			continue
+		case value == nil || value.Kind != ast.ConstBool:
+			v.staticAssertErr(submod, stat, "Static assertion condition isn't a constant expression")
+		case !value.Bool:
+			msg := "Static assertion failed"
+			if stat.Message != "" {
+				msg += ": " + stat.Message
+			}
+			v.staticAssertErr(submod, stat, "%s", msg)
+		}
+	}
+}
+
+func (v *Codegen) staticAssertErr(submod *ast.Submodule, stat *ast.StaticAssertStat, err string, stuff ...interface{}) {
+	pos := stat.Pos()
+	log.Error(log.TagCodegen, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
+		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(err, stuff...))
+	if submod.File != nil {
+		log.Errorln(log.TagCodegen, submod.File.MarkPos(pos))
+	}
+	util.ExitFunc(util.EXIT_FAILURE_CODEGEN)
+}
+
+// inputModules 常量可以引用所有输入模块中的不可变全局变量
+func (v *Codegen) inputModules() []*ast.Module {
+	res := make([]*ast.Module, len(v.input))
+	for idx, mod := range v.input {
+		res[idx] = mod.Module
+	}
+	return res
+}
+
+// typeHasSubstitution 类型是否依赖泛型的类型参数
+func typeHasSubstitution(typ *ast.TypeReference) bool {
+	if typ == nil {
+		return false
+	}
+	for _, garg := range typ.GenericArguments {
+		if typeHasSubstitution(garg) {
+			return true
+		}
+	}
+
+	switch t := typ.BaseType.(type) {
+	case *ast.SubstitutionType:
+		return true
+	case ast.PointerType:
+		return typeHasSubstitution(t.Addressee)
+	case ast.ReferenceType:
+		return typeHasSubstitution(t.Referrer)
+	case ast.ArrayType:
+		return typeHasSubstitution(t.MemberType)
+	case ast.TupleType:
+		for _, mem := range t.Members {
+			if typeHasSubstitution(mem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// staticAssertScanner 找出所有依赖目标平台的编译期断言
+type staticAssertScanner struct {
+	asserts []*ast.StaticAssertStat
+}
+
+func (v *staticAssertScanner) Visit(n *ast.Node) bool {
+	if stat, ok := (*n).(*ast.StaticAssertStat); ok && stat.TargetDependent {
+		v.asserts = append(v.asserts, stat)
+	}
+	return true
+}
+
+func (v *staticAssertScanner) PostVisit(n *ast.Node) {}
+func (v *staticAssertScanner) EnterScope()           {}
+func (v *staticAssertScanner) ExitScope()            {}
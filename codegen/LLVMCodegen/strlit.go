@@ -0,0 +1,96 @@
+package LLVMCodegen
+
+import (
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 字符串字面量的存储
+//
+// 字面量的内容放在常量池中（见 constpool.go）。字符串可以通过 var 变量修改（如 var s = "abc"; s[0] = 'x'），
+// 所以一般情况下使用字面量时要复制一份：函数中复制到栈上，全局变量的初始值复制为模块内部的可写全局变量。
+// 内容不可能被写入的字面量直接指向常量池：
+//   - C字符串字面量，类型是不可修改的 ^u8
+//   - 只被读取的字面量：比较、match 的目标，以及 len、hashof 和 cstr 的操作数
+//   - 不可修改的变量的初始值，且这个变量的每次使用都只读取内容（同上，或者用下标读取元素）。
+//     导出的全局变量可能在其它模块中使用，总是复制
+
+// markPooledStringLiterals 分析模块中所有子模块，记录可以直接指向常量池的字符串字面量
+func (v *Codegen) markPooledStringLiterals(mod *WrappedModule) {
+	scanner := &stringLiteralScanner{
+		readOnly:     make(map[ast.Expr]bool),
+		uses:         make(map[*ast.Variable]int),
+		readOnlyUses: make(map[*ast.Variable]int),
+		initializers: make(map[*ast.Variable]*ast.StringLiteral),
+	}
+	for _, submod := range mod.Parts {
+		ast.NewASTVisitor(scanner).VisitSubmodule(submod)
+	}
+
+	for expr := range scanner.readOnly {
+		if lit, ok := expr.(*ast.StringLiteral); ok {
+			v.pooledStringLiterals[lit] = true
+		}
+	}
+	for vari, lit := range scanner.initializers {
+		if scanner.uses[vari] == scanner.readOnlyUses[vari] {
+			v.pooledStringLiterals[lit] = true
+		}
+	}
+}
+
+// stringLiteralPooled 字面量n的内容是否不会被写入，可以直接使用常量池中的数据
+func (v *Codegen) stringLiteralPooled(n *ast.StringLiteral) bool {
+	if n.IsCString {
+		if ptr, ok := n.GetType().BaseType.ActualType().(ast.PointerType); ok && !ptr.IsMutable {
+			return true
+		}
+	}
+	return v.pooledStringLiterals[n]
+}
+
+type stringLiteralScanner struct {
+	readOnly     map[ast.Expr]bool                    // 只读取内容的表达式
+	uses         map[*ast.Variable]int                // 变量被访问的次数
+	readOnlyUses map[*ast.Variable]int                // 其中只读取内容的次数
+	initializers map[*ast.Variable]*ast.StringLiteral // 不可修改的变量的字面量初始值
+}
+
+func (v *stringLiteralScanner) EnterScope()         {}
+func (v *stringLiteralScanner) ExitScope()          {}
+func (v *stringLiteralScanner) PostVisit(*ast.Node) {}
+
+// Visit 先访问父节点，所以访问操作数时已经知道它是否只被读取
+func (v *stringLiteralScanner) Visit(node *ast.Node) bool {
+	switch n := (*node).(type) {
+	case *ast.VariableDecl:
+		lit, ok := n.Assignment.(*ast.StringLiteral)
+		if ok && !n.Variable.Mutable && ast.VariableVisibility(n.IsPublic(), n.Variable) == ast.VISIBILITY_INTERNAL {
+			v.initializers[n.Variable] = lit
+		}
+	case *ast.BinaryExpr:
+		if n.Method == nil && n.Op.Category() == parser.OP_COMPARISON {
+			v.readOnly[n.Lhand] = true
+			v.readOnly[n.Rhand] = true
+		}
+	case *ast.MatchStat:
+		v.readOnly[n.Target] = true
+	case *ast.ArrayLenExpr:
+		v.readOnly[n.Expr] = true
+	case *ast.HashExpr:
+		v.readOnly[n.Expr] = true
+	case *ast.CStringExpr:
+		v.readOnly[n.Expr] = true
+	case *ast.ArrayAccessExpr:
+		// 不可修改的变量的元素也不可修改，这里只会读取
+		if acc, ok := n.Array.(*ast.VariableAccessExpr); ok && !acc.Variable.Mutable {
+			v.readOnly[n.Array] = true
+		}
+	case *ast.VariableAccessExpr:
+		v.uses[n.Variable]++
+		if v.readOnly[n] {
+			v.readOnlyUses[n.Variable]++
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package LLVMCodegen
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ark-lang/go-llvm/llvm"
+)
+
+// targetPreset 预置的交叉编译目标：三元组、默认CPU与特性、ABI以及交叉链接器
+type targetPreset struct {
+	Triple   string
+	CPU      string
+	Features string
+	ABI      string // 为空时使用LLVM的默认ABI
+	Linker   string // 为空时由 defaultLinker 选择
+}
+
+var targetPresets = map[string]targetPreset{
+	"linux-x86_64": {
+		Triple: "x86_64-unknown-linux-gnu",
+		CPU:    "x86-64",
+		Linker: "cc",
+	},
+	"linux-arm64": {
+		Triple:   "aarch64-unknown-linux-gnu",
+		CPU:      "generic",
+		Features: "+neon,+fp-armv8",
+		Linker:   "aarch64-linux-gnu-gcc",
+	},
+	"linux-riscv64": {
+		Triple:   "riscv64-unknown-linux-gnu",
+		CPU:      "generic-rv64",
+		Features: "+m,+a,+f,+d,+c",
+		ABI:      "lp64d", // 与gcc工具链的默认ABI保持一致，否则无法与libc链接
+		Linker:   "riscv64-linux-gnu-gcc",
+	},
+	"windows-x86_64": {
+		Triple: "x86_64-pc-windows-msvc",
+		CPU:    "x86-64",
+		// 不指定链接器，由 defaultLinker 在lld-link和link.exe中选择
+	},
+}
+
+// TargetPresetNames 所有预置目标的名字，用于命令行帮助
+func TargetPresetNames() []string {
+	var names []string
+	for name := range targetPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// preset 返回Target对应的预置目标。Target为空时使用本机，不是预置名字时当作三元组
+func (v *Codegen) preset() targetPreset {
+	if v.Target == "" {
+		return targetPreset{Triple: llvm.DefaultTargetTriple()}
+	}
+	if preset, ok := targetPresets[v.Target]; ok {
+		return preset
+	}
+	return targetPreset{Triple: v.Target}
+}
+
+// TargetTriple 返回target（三元组或预置目标名，为空时为本机）对应的目标三元组
+func TargetTriple(target string) string {
+	return (&Codegen{Target: target}).targetTriple()
+}
+
+// isNativeTarget 是否为本机生成代码
+func (v *Codegen) isNativeTarget() bool {
+	return v.targetTriple() == llvm.DefaultTargetTriple()
+}
+
+// targetTriple 代码生成的目标三元组
+func (v *Codegen) targetTriple() string {
+	return v.preset().Triple
+}
+
+// initializeTarget 初始化LLVM目标，创建目标机器。交叉编译时需要初始化所有的目标
+func (v *Codegen) initializeTarget() {
+	if v.isNativeTarget() {
+		llvm.InitializeNativeTarget()
+		llvm.InitializeNativeAsmPrinter()
+	} else {
+		llvm.InitializeAllTargetInfos()
+		llvm.InitializeAllTargets()
+		llvm.InitializeAllTargetMCs()
+		llvm.InitializeAllAsmPrinters()
+	}
+	llvm.InitializeAllAsmParsers()
+
+	preset := v.preset()
+
+	var err error
+	v.target, err = llvm.GetTargetFromTriple(preset.Triple)
+	if err != nil {
+		v.err("Unsupported target `%s`: %s", preset.Triple, err.Error())
+	}
+	v.targetMachine = v.target.CreateTargetMachine(preset.Triple, preset.CPU, preset.Features,
+		llvm.CodeGenLevelNone, v.relocMode(), llvm.CodeModelDefault)
+	v.targetData = v.targetMachine.TargetData()
+}
+
+// setModuleTarget 设置模块的目标三元组、数据布局和ABI。
+// 它们决定了符号修饰规则（比如32位Windows上C符号的下划线前缀）以及类型的大小和对齐
+func (v *Codegen) setModuleTarget(mod llvm.Module) {
+	mod.SetTarget(v.targetTriple())
+	mod.SetDataLayout(v.targetData.String())
+
+	if abi := v.preset().ABI; abi != "" {
+		mod.AddNamedMetadataOperand("llvm.module.flags", llvm.MDNode([]llvm.Value{
+			llvm.ConstInt(llvm.Int32Type(), 1, false), // Error：链接时ABI不一致报错
+			llvm.MDString("target-abi"),
+			llvm.MDString(abi),
+		}))
+	}
+}
+
+// isWindowsTarget 目标是否是Windows。Windows上生成COFF目标文件，使用MSVC风格的链接器生成PE可执行文件
+func (v *Codegen) isWindowsTarget() bool {
+	return strings.Contains(v.targetTriple(), "windows")
+}
+
+func (v *Codegen) objectFileExt() string {
+	if v.isWindowsTarget() {
+		return ".obj"
+	}
+	return ".o"
+}
+
+// executableName 可执行文件名。Windows上需要.exe后缀
+func (v *Codegen) executableName() string {
+	if v.isWindowsTarget() && !strings.HasSuffix(strings.ToLower(v.OutputName), ".exe") {
+		return v.OutputName + ".exe"
+	}
+	return v.OutputName
+}
+
+// defaultLinker 默认的链接器。预置目标使用对应的交叉链接器；
+// 没有指定链接器的Windows目标优先使用lld-link，找不到时使用MSVC的link.exe
+func (v *Codegen) defaultLinker() string {
+	if linker := v.preset().Linker; linker != "" {
+		return linker
+	}
+
+	if v.isWindowsTarget() {
+		if _, err := exec.LookPath("lld-link"); err == nil {
+			return "lld-link"
+		}
+		return "link"
+	}
+	return "cc"
+}
+
+// windowsLinkArgs MSVC风格链接器的参数。
+// 静态链接时使用静态CRT（libcmt），否则使用动态CRT（msvcrt）；
+// 运行时用到的printf在新版CRT中是内联函数，需要legacy_stdio_definitions提供符号
+func (v *Codegen) windowsLinkArgs(objFiles []string, libs []string) []string {
+	args := append([]string{}, v.LinkerArgs...)
+	args = append(args, "/nologo", "/subsystem:console", "/out:"+v.executableName())
+
+	if v.Static {
+		args = append(args, "/defaultlib:libcmt", "/defaultlib:libucrt", "/defaultlib:libvcruntime")
+	} else {
+		args = append(args, "/defaultlib:msvcrt", "/defaultlib:ucrt", "/defaultlib:vcruntime")
+	}
+	args = append(args, "legacy_stdio_definitions.lib")
+
+	if v.Strip {
+		args = append(args, "/debug:none")
+	}
+
+	args = append(args, objFiles...)
+	for _, lib := range libs {
+		args = append(args, lib+".lib")
+	}
+	return args
+}
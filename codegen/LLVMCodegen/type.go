@@ -55,7 +55,20 @@ func (v *Codegen) addStructType(typ ast.StructType, name string, gcon *ast.Gener
 		}
 	}
 
-	structure.StructSetBody(v.structTypeToLLVMTypeFields(typ, gcon), typ.Attrs().Contains("packed"))
+	if typ.IsUnion {
+		structure.StructSetBody(v.unionTypeToLLVMTypeFields(typ, gcon), false)
+		return
+	}
+
+	fields := v.structTypeToLLVMTypeFields(typ, gcon)
+	if !typ.FixedLayout() {
+		if reordered, order := v.reorderStructFields(fields); order != nil {
+			fields = reordered
+			v.structFieldOrders[structure] = order
+		}
+	}
+
+	structure.StructSetBody(fields, typ.Attrs().Contains("packed"))
 }
 
 func (v *Codegen) addEnumType(typ ast.EnumType, name string, gcon *ast.GenericContext) {
@@ -64,8 +77,7 @@ func (v *Codegen) addEnumType(typ ast.EnumType, name string, gcon *ast.GenericCo
 	}
 
 	if typ.Simple {
-		// TODO: Handle other integer size, maybe dynamic depending on max value?
-		v.namedTypeLookup[name] = llvm.IntType(32)
+		v.namedTypeLookup[name] = v.enumTagLLVMType(typ)
 	} else {
 		enum := v.curFile.LlvmModule.Context().StructCreateNamed(name)
 		v.namedTypeLookup[name] = enum
@@ -124,7 +136,7 @@ func (v *Codegen) typeToLLVMType(typ ast.Type, gcon *ast.GenericContext) llvm.Ty
 	case ast.PrimitiveType:
 		return v.primitiveTypeToLLVMType(typ)
 	case ast.FunctionType:
-		return v.functionTypeToLLVMType(typ, true, gcon)
+		return v.closureType()
 	case ast.StructType:
 		return v.structTypeToLLVMType(typ, gcon)
 	case ast.PointerType:
@@ -137,6 +149,8 @@ func (v *Codegen) typeToLLVMType(typ ast.Type, gcon *ast.GenericContext) llvm.Ty
 		return v.enumTypeToLLVMType(typ, gcon)
 	case ast.ReferenceType:
 		return llvm.PointerType(v.typeRefToLLVMTypeWithOuter(typ.Referrer, gcon), 0)
+	case ast.InterfaceType, *ast.InterfaceType:
+		return v.interfaceValueType()
 	case *ast.NamedType:
 		switch typ.Type.(type) {
 		case ast.StructType, ast.EnumType:
@@ -163,7 +177,7 @@ func (v *Codegen) typeToLLVMType(typ ast.Type, gcon *ast.GenericContext) llvm.Ty
 		return v.typeRefToLLVMTypeWithOuter(gcon.GetSubstitutionType(typ), gcon)
 
 	default:
-		log.Debugln("codegen", "Type was %s (%s)", typ.TypeName(), reflect.TypeOf(typ))
+		log.Debugln(log.TagCodegen, "Type was %s (%s)", typ.TypeName(), reflect.TypeOf(typ))
 		panic("Unimplemented type category in LLVM codegen")
 	}
 }
@@ -189,6 +203,9 @@ func (v *Codegen) arrayTypeToLLVMType(typ ast.ArrayType, gcon *ast.GenericContex
 }
 
 func (v *Codegen) structTypeToLLVMType(typ ast.StructType, gcon *ast.GenericContext) llvm.Type {
+	if typ.IsUnion {
+		return llvm.StructType(v.unionTypeToLLVMTypeFields(typ, gcon), false)
+	}
 	return llvm.StructType(v.structTypeToLLVMTypeFields(typ, gcon), typ.Attrs().Contains("packed"))
 }
 
@@ -206,8 +223,7 @@ func (v *Codegen) structTypeToLLVMTypeFields(typ ast.StructType, gcon *ast.Gener
 
 func (v *Codegen) enumTypeToLLVMType(typ ast.EnumType, gcon *ast.GenericContext) llvm.Type {
 	if typ.Simple {
-		// TODO: Handle other integer size, maybe dynamic depending on max value? (1 / 2)
-		return llvm.IntType(32)
+		return v.enumTagLLVMType(typ)
 	}
 
 	return llvm.StructType(v.enumTypeToLLVMTypeFields(typ, gcon), true)
@@ -227,7 +243,12 @@ func (v *Codegen) enumTypeToLLVMTypeFields(typ ast.EnumType, gcon *ast.GenericCo
 		panic("INTERNAL ERROR: Enum union length would overflow golang int-type")
 	}
 
-	return []llvm.Type{enumTagType, llvm.ArrayType(llvm.IntType(8), int(longestLength))}
+	return []llvm.Type{v.enumTagLLVMType(typ), llvm.ArrayType(llvm.IntType(8), int(longestLength))}
+}
+
+// enumTagLLVMType 枚举标签的LLVM类型，由 [repr(...)] 标注决定。简单枚举整体就是这个类型，便于和C互操作
+func (v *Codegen) enumTagLLVMType(typ ast.EnumType) llvm.Type {
+	return v.primitiveTypeToLLVMType(typ.TagType())
 }
 
 func (v *Codegen) enumMemberTypeToPaddedLLVMType(enumType ast.EnumType, memberIdx int, gcon *ast.GenericContext) llvm.Type {
@@ -254,7 +275,7 @@ func (v *Codegen) enumMemberTypeToPaddedLLVMType(enumType ast.EnumType, memberId
 }
 
 func (v *Codegen) llvmEnumTypeForMember(enumType ast.EnumType, memberIdx int, gcon *ast.GenericContext) llvm.Type {
-	return llvm.StructType([]llvm.Type{enumTagType, v.enumMemberTypeToPaddedLLVMType(enumType, memberIdx, gcon)}, true)
+	return llvm.StructType([]llvm.Type{v.enumTagLLVMType(enumType), v.enumMemberTypeToPaddedLLVMType(enumType, memberIdx, gcon)}, true)
 }
 
 func (v *Codegen) functionTypeToLLVMType(typ ast.FunctionType, ptr bool, gcon *ast.GenericContext) llvm.Type {
@@ -263,19 +284,28 @@ func (v *Codegen) functionTypeToLLVMType(typ ast.FunctionType, ptr bool, gcon *a
 		numOfParams++
 	}
 
+	// 函数类型的值是闭包，C函数的参数和返回值使用原始的函数指针，参见 closure.go
+	cFunction := typ.Attrs().Contains("C")
+	valueType := func(t *ast.TypeReference) llvm.Type {
+		if ft, ok := t.BaseType.ActualType().(ast.FunctionType); ok && cFunction {
+			return v.functionTypeToLLVMType(ft, true, gcon)
+		}
+		return v.typeRefToLLVMTypeWithOuter(t, gcon)
+	}
+
 	params := make([]llvm.Type, 0, numOfParams)
 	if typ.Receiver != nil {
 		params = append(params, v.typeRefToLLVMTypeWithOuter(typ.Receiver, gcon))
 	}
 	for _, par := range typ.Parameters {
-		params = append(params, v.typeRefToLLVMTypeWithOuter(par, gcon))
+		params = append(params, valueType(par))
 	}
 
 	var returnType llvm.Type
 
 	// oo theres a type, let's try figure it out
 	if typ.Return != nil {
-		returnType = v.typeRefToLLVMTypeWithOuter(typ.Return, gcon)
+		returnType = valueType(typ.Return)
 	} else {
 		returnType = llvm.VoidType()
 	}
@@ -322,3 +352,65 @@ func (v *Codegen) primitiveTypeToLLVMType(typ ast.PrimitiveType) llvm.Type {
 		panic("Unimplemented primitive type in LLVM codegen")
 	}
 }
+
+// functionTypeHasIndirection 函数的接收器或参数中是否含有指针（包括引用和动态数组）。
+// 没有指针的纯函数不会读取调用者可见的内存
+func functionTypeHasIndirection(typ ast.FunctionType, gcon *ast.GenericContext) bool {
+	params := typ.Parameters
+	if typ.Receiver != nil {
+		params = append([]*ast.TypeReference{typ.Receiver}, params...)
+	}
+
+	for _, par := range params {
+		if gcon != nil {
+			par = gcon.Replace(par)
+		}
+		if typeReferenceHasIndirection(par) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeReferenceHasIndirection(typ *ast.TypeReference) bool {
+	switch t := typ.BaseType.ActualType().(type) {
+	case ast.PointerType, ast.ReferenceType:
+		return true
+
+	// 函数值的环境是指针，参见 closure.go
+	case ast.FunctionType:
+		return true
+
+	case ast.ArrayType:
+		return !t.IsFixedLength || typeReferenceHasIndirection(t.MemberType)
+
+	case ast.StructType:
+		gcon := ast.NewGenericContextFromTypeReference(typ)
+		for _, mem := range t.Members {
+			if typeReferenceHasIndirection(gcon.Replace(mem.Type)) {
+				return true
+			}
+		}
+		return false
+
+	case ast.TupleType:
+		for _, mem := range t.Members {
+			if typeReferenceHasIndirection(mem) {
+				return true
+			}
+		}
+		return false
+
+	case ast.EnumType:
+		gcon := ast.NewGenericContextFromTypeReference(typ)
+		for _, mem := range t.Members {
+			if typeReferenceHasIndirection(gcon.Replace(&ast.TypeReference{BaseType: mem.Type})) {
+				return true
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
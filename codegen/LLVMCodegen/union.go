@@ -0,0 +1,77 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// 联合体（union）
+//
+// 联合体的所有成员从同一个地址开始。LLVM没有联合体类型，这里用只有一个成员的结构体表示：
+// 对齐最大的成员（对齐相同时取最大的），后面用字节数组补足到最大的成员的大小（按对齐向上取整）。
+// 访问成员时把联合体的地址转换为成员类型的指针，因此成员的偏移总是0。
+// 联合体字面量最多初始化一个成员，先把值写入联合体的栈空间再读出。
+
+func (v *Codegen) unionTypeToLLVMTypeFields(typ ast.StructType, gcon *ast.GenericContext) []llvm.Type {
+	members := v.structTypeToLLVMTypeFields(typ, gcon)
+	if len(members) == 0 {
+		return nil
+	}
+
+	base := members[0]
+	var size uint64
+	for _, mem := range members {
+		memAlign, baseAlign := v.targetData.ABITypeAlignment(mem), v.targetData.ABITypeAlignment(base)
+		if memAlign > baseAlign || (memAlign == baseAlign && v.targetData.TypeAllocSize(mem) > v.targetData.TypeAllocSize(base)) {
+			base = mem
+		}
+		if memSize := v.targetData.TypeAllocSize(mem); memSize > size {
+			size = memSize
+		}
+	}
+
+	align := uint64(v.targetData.ABITypeAlignment(base))
+	size = (size + align - 1) / align * align
+
+	fields := []llvm.Type{base}
+	if pad := size - v.targetData.TypeAllocSize(base); pad > 0 {
+		fields = append(fields, llvm.ArrayType(llvm.IntType(8), int(pad)))
+	}
+	return fields
+}
+
+// genUnionMemberGEP 联合体成员的地址：把联合体的地址转换为成员类型（memberType）的指针
+func (v *Codegen) genUnionMemberGEP(union llvm.Value, memberType llvm.Type) llvm.Value {
+	memberType = llvm.PointerType(memberType, 0)
+	if union.IsConstant() {
+		return llvm.ConstBitCast(union, memberType)
+	}
+	return v.builder().CreateBitCast(union, memberType, "")
+}
+
+func (v *Codegen) genUnionLiteral(n *ast.CompositeLiteral) llvm.Value {
+	unionType := n.Type.BaseType.ActualType().(ast.StructType)
+	unionLLVMType := v.typeRefToLLVMType(n.Type)
+	if len(n.Values) == 0 {
+		return llvm.ConstNull(unionLLVMType)
+	}
+
+	member := unionType.GetMember(n.Fields[0])
+	value := v.genExprAndLoadIfNeccesary(n.Values[0])
+
+	// 全局变量的初始值必须是常量，只能初始化与联合体的第一个LLVM成员类型相同的成员
+	if !v.inFunction() {
+		if !value.IsConstant() {
+			v.err("Encountered non-constant value in global union literal")
+		}
+		if value.Type() != unionLLVMType.StructElementTypes()[0] {
+			v.err("Union literal in a global initializer can't initialize member `%s` of type `%s`", member.Name, member.Type.String())
+		}
+		return v.builder().CreateInsertValue(llvm.ConstNull(unionLLVMType), value, 0, "")
+	}
+
+	alloc := v.createAlignedAlloca(unionLLVMType, "")
+	v.builder().CreateStore(llvm.ConstNull(unionLLVMType), alloc)
+	v.builder().CreateStore(value, v.genUnionMemberGEP(alloc, value.Type()))
+	return v.builder().CreateLoad(alloc, "")
+}
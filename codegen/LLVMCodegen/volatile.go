@@ -0,0 +1,29 @@
+package LLVMCodegen
+
+import (
+	"github.com/ark-lang/go-llvm/llvm"
+	"github.com/ku-lang/ku/ast"
+)
+
+// volatile_load(ptr) 和 volatile_store(ptr, value)
+//
+// 生成带volatile标记的load/store：LLVM不会删除、合并或者把它们与其他volatile操作重排，
+// 因此可以用来读写内存映射的硬件寄存器，如 volatile_store(^var u32(0x40021018), 1)。
+
+func (v *Codegen) genVolatileLoadExpr(n *ast.VolatileLoadExpr) llvm.Value {
+	if !v.inFunction() {
+		v.err("Cannot use `volatile_load` in a global initializer")
+	}
+
+	ptr := v.genExprAndLoadIfNeccesary(n.Pointer)
+	load := v.builder().CreateLoad(ptr, "")
+	load.SetVolatile(true)
+	return load
+}
+
+func (v *Codegen) genVolatileStoreStat(n *ast.VolatileStoreStat) {
+	ptr := v.genExprAndLoadIfNeccesary(n.Pointer)
+	value := v.genExprAndLoadIfNeccesary(n.Value)
+	store := v.builder().CreateStore(value, ptr)
+	store.SetVolatile(true)
+}
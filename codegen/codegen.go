@@ -2,6 +2,8 @@ package codegen
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ku-lang/ku/ast"
 )
@@ -10,11 +12,12 @@ type Codegen interface {
 	Generate(input []*ast.Module)
 }
 
+// OutputType 代码生成后要产生的文件类型。可以同时产生多种，如 llvm-ir,executable
 type OutputType int
 
 const (
-	OutputUnknown OutputType = iota
-	OutputExectuably
+	OutputUnknown    OutputType = 0
+	OutputExectuably OutputType = 1 << (iota - 1)
 	OutputObject
 	OutputAssembly
 	OutputLLVMIR
@@ -27,10 +30,30 @@ var typeMapping = map[string]OutputType{
 	"llvm-ir":    OutputLLVMIR,
 }
 
+// OutputTypeNames 所有输出类型的名字，按字母顺序排列
+func OutputTypeNames() []string {
+	names := make([]string, 0, len(typeMapping))
+	for name := range typeMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has 是否需要产生typ类型的文件
+func (v OutputType) Has(typ OutputType) bool {
+	return v&typ != 0
+}
+
+// ParseOutputType 解析逗号分隔的输出类型列表，如 `llvm-ir,object,executable`
 func ParseOutputType(input string) (OutputType, error) {
-	typ, ok := typeMapping[input]
-	if !ok {
-		return OutputUnknown, fmt.Errorf("ark-lang/codegen: Unknown output type `%s`", input)
+	res := OutputUnknown
+	for _, name := range strings.Split(input, ",") {
+		typ, ok := typeMapping[strings.TrimSpace(name)]
+		if !ok {
+			return OutputUnknown, fmt.Errorf("ark-lang/codegen: Unknown output type `%s`", name)
+		}
+		res |= typ
 	}
-	return typ, nil
+	return res, nil
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// 根据kingpin的命令模型生成shell自动补全脚本。参数的可选值见 flagValueHints
+
+func printCompletions(shell string) {
+	model := app.Model()
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion(model))
+	case "zsh":
+		fmt.Print(zshCompletion(model))
+	case "fish":
+		fmt.Print(fishCompletion(model))
+	}
+}
+
+func visibleCommands(model *kingpin.ApplicationModel) []*kingpin.CmdModel {
+	var res []*kingpin.CmdModel
+	for _, cmd := range model.Commands {
+		if !cmd.Hidden {
+			res = append(res, cmd)
+		}
+	}
+	return res
+}
+
+func visibleFlags(flags []*kingpin.FlagModel) []*kingpin.FlagModel {
+	var res []*kingpin.FlagModel
+	for _, flag := range flags {
+		if !flag.Hidden {
+			res = append(res, flag)
+		}
+	}
+	return res
+}
+
+func flagWords(flags []*kingpin.FlagModel) string {
+	var words []string
+	for _, flag := range visibleFlags(flags) {
+		words = append(words, "--"+flag.Name)
+		if flag.Short != 0 {
+			words = append(words, "-"+string(flag.Short))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func bashCompletion(model *kingpin.ApplicationModel) string {
+	buf := new(bytes.Buffer)
+	name := model.Name
+
+	var commandNames []string
+	for _, cmd := range visibleCommands(model) {
+		commandNames = append(commandNames, cmd.Name)
+	}
+
+	fmt.Fprintf(buf, "# bash completion for %s\n", name)
+	fmt.Fprintf(buf, "_%s() {\n", name)
+	buf.WriteString("    local cur prev cmd word\n")
+	buf.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	buf.WriteString("    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n\n")
+
+	// 参数值
+	buf.WriteString("    case \"$prev\" in\n")
+	seen := make(map[string]bool)
+	flags := model.Flags
+	for _, cmd := range visibleCommands(model) {
+		flags = append(flags, cmd.Flags...)
+	}
+	for _, flag := range visibleFlags(flags) {
+		if flag.IsBoolFlag() || seen[flag.Name] {
+			continue
+		}
+		seen[flag.Name] = true
+
+		pattern := "--" + flag.Name
+		if flag.Short != 0 {
+			pattern += "|-" + string(flag.Short)
+		}
+		if hints, ok := flagValueHints[flag.Name]; ok {
+			fmt.Fprintf(buf, "    %s)\n        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n        return ;;\n", pattern, strings.Join(hints, " "))
+		} else {
+			fmt.Fprintf(buf, "    %s)\n        COMPREPLY=($(compgen -f -- \"$cur\"))\n        return ;;\n", pattern)
+		}
+	}
+	buf.WriteString("    esac\n\n")
+
+	// 当前的子命令
+	buf.WriteString("    cmd=\"\"\n")
+	buf.WriteString("    for word in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do\n")
+	fmt.Fprintf(buf, "        case \"$word\" in\n        %s)\n            cmd=\"$word\"\n            break ;;\n        esac\n", strings.Join(commandNames, "|"))
+	buf.WriteString("    done\n\n")
+
+	buf.WriteString("    case \"$cmd\" in\n")
+	fmt.Fprintf(buf, "    \"\")\n        COMPREPLY=($(compgen -W \"%s %s\" -- \"$cur\")) ;;\n", strings.Join(commandNames, " "), flagWords(model.Flags))
+	for _, cmd := range visibleCommands(model) {
+		fmt.Fprintf(buf, "    %s)\n", cmd.Name)
+		fmt.Fprintf(buf, "        if [[ \"$cur\" == -* ]]; then\n            COMPREPLY=($(compgen -W \"%s %s\" -- \"$cur\"))\n", flagWords(cmd.Flags), flagWords(model.Flags))
+		fmt.Fprintf(buf, "        else\n            COMPREPLY=($(compgen -f -- \"$cur\"))\n        fi ;;\n")
+	}
+	buf.WriteString("    esac\n")
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(buf, "complete -o filenames -F _%s %s\n", name, name)
+	return buf.String()
+}
+
+// zshCompletion 通过 bashcompinit 复用bash的补全脚本
+func zshCompletion(model *kingpin.ApplicationModel) string {
+	return "#compdef " + model.Name + "\n\nautoload -U +X bashcompinit && bashcompinit\n\n" + bashCompletion(model)
+}
+
+func fishCompletion(model *kingpin.ApplicationModel) string {
+	buf := new(bytes.Buffer)
+	name := model.Name
+
+	fmt.Fprintf(buf, "# fish completion for %s\n", name)
+	fmt.Fprintf(buf, "complete -c %s -f\n", name)
+
+	for _, flag := range visibleFlags(model.Flags) {
+		buf.WriteString(fishFlag(name, "", flag))
+	}
+
+	for _, cmd := range visibleCommands(model) {
+		fmt.Fprintf(buf, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", name, cmd.Name, fishQuote(cmd.Help))
+		for _, flag := range visibleFlags(cmd.Flags) {
+			buf.WriteString(fishFlag(name, "__fish_seen_subcommand_from "+cmd.Name, flag))
+		}
+		if len(cmd.Args) > 0 {
+			fmt.Fprintf(buf, "complete -c %s -n %s -F\n", name, fishQuote("__fish_seen_subcommand_from "+cmd.Name))
+		}
+	}
+
+	return buf.String()
+}
+
+func fishFlag(name, condition string, flag *kingpin.FlagModel) string {
+	res := "complete -c " + name
+	if condition != "" {
+		res += " -n " + fishQuote(condition)
+	}
+	res += " -l " + flag.Name
+	if flag.Short != 0 {
+		res += " -s " + string(flag.Short)
+	}
+	if hints, ok := flagValueHints[flag.Name]; ok {
+		res += " -x -a " + fishQuote(strings.Join(hints, " "))
+	} else if !flag.IsBoolFlag() {
+		res += " -r -F"
+	}
+	return res + " -d " + fishQuote(flag.Help) + "\n"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "\\'", -1) + "'"
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 内部编译错误（ICE）报告
+//
+// 编译器的每个阶段都通过 runPhase 执行。某个阶段panic时，不再直接打印Go的panic信息，
+// 而是把复现所需的内容写入临时目录中的报告包：
+//
+//	REPORT.txt   版本、平台、命令行参数、出错的阶段、panic信息和调用栈
+//	command.txt  可以直接复制执行的命令行
+//	src/         编译过程中读入的所有源文件
+//
+// 然后提示用户提交bug并附上报告包
+const bugReportURL = "https://github.com/ku-lang/ku/issues"
+
+// readSources 编译过程中读入的源文件，按读入顺序排列
+var readSources []*lexer.Sourcefile
+
+// recordSource 记录读入的源文件，用于ICE报告
+func recordSource(sf *lexer.Sourcefile) {
+	readSources = append(readSources, sf)
+}
+
+// runPhase 执行编译阶段name，捕获其中的panic并生成ICE报告
+func runPhase(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			// 源码有错误时的退出不是内部错误，参见 catchErrorExit
+			if exit, ok := r.(errorExit); ok {
+				panic(exit)
+			}
+			reportICE(name, r, debug.Stack())
+		}
+	}()
+
+	log.Timed(name, "", fn)
+}
+
+// errorExit 在 catchErrorExit 中编译出错时，util.ExitFunc 抛出的panic，值是退出码
+type errorExit int
+
+// catchErrorExit 运行fn，编译出错时不退出程序，而是返回false。ku lsp 和 ku repl 用它在同一进程中反复编译
+func catchErrorExit(fn func()) (ok bool) {
+	exit := util.ExitFunc
+	util.ExitFunc = func(code int) {
+		panic(errorExit(code))
+	}
+
+	defer func() {
+		util.ExitFunc = exit
+		if r := recover(); r != nil {
+			if _, isExit := r.(errorExit); !isExit {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+
+	fn()
+	return true
+}
+
+func reportICE(phase string, r interface{}, stack []byte) {
+	log.Errorln(log.TagMain, "%s: internal compiler error in %s: %v", util.Bold(util.Red("error")), phase, r)
+	log.Debugln(log.TagMain, "%s", stack)
+
+	dir, err := writeICEBundle(phase, r, stack)
+	if err != nil {
+		log.Errorln(log.TagMain, "Couldn't write reproducer bundle: %s", err)
+		log.Errorln(log.TagMain, "Please file a bug at %s with the source that caused the crash.", bugReportURL)
+	} else {
+		log.Errorln(log.TagMain, "A reproducer bundle was written to %s", dir)
+		log.Errorln(log.TagMain, "Please file a bug at %s and attach the contents of that directory.", bugReportURL)
+	}
+
+	util.ExitFunc(util.EXIT_FAILURE_INTERNAL)
+}
+
+func writeICEBundle(phase string, r interface{}, stack []byte) (string, error) {
+	dir, err := ioutil.TempDir("", "ku-ice")
+	if err != nil {
+		return "", err
+	}
+
+	cwd, _ := os.Getwd()
+
+	report := new(bytes.Buffer)
+	fmt.Fprintf(report, "ku version: %s\n", VERSION)
+	fmt.Fprintf(report, "go version: %s\n", runtime.Version())
+	fmt.Fprintf(report, "platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(report, "directory:  %s\n", cwd)
+	fmt.Fprintf(report, "command:    %s\n", commandLine())
+	fmt.Fprintf(report, "phase:      %s\n", phase)
+	fmt.Fprintf(report, "panic:      %v\n", r)
+
+	fmt.Fprintf(report, "\nsource files:\n")
+	for idx, sf := range readSources {
+		name := bundleSourceName(idx, sf.Path)
+		fmt.Fprintf(report, "  %s -> src/%s\n", sf.Path, filepath.ToSlash(name))
+
+		path := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, []byte(string(sf.Contents)), 0666); err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Fprintf(report, "\nstack trace:\n%s", stack)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "REPORT.txt"), report.Bytes(), 0666); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "command.txt"), []byte(commandLine()+"\n"), 0666); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// bundleSourceName 源文件在报告包中的路径。当前目录下的文件保持原来的相对路径，
+// 这样在 src 目录中执行 command.txt 中的命令就能复现；其他文件放在 external 下
+func bundleSourceName(idx int, path string) string {
+	clean := filepath.Clean(path)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return filepath.Join("external", strconv.Itoa(idx), filepath.Base(clean))
+	}
+	return clean
+}
+
+// commandLine 复现崩溃的命令行，可以直接粘贴到POSIX shell中执行
+func commandLine() string {
+	args := []string{"ku"}
+	for _, arg := range os.Args[1:] {
+		args = append(args, shellQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote 按POSIX shell的规则转义参数：用单引号括起来；参数中的单引号要先结束引用，
+// 写成转义的 \' 再重新开始引用。
+// 单引号中的内容没有任何特殊字符，不能用 strconv.Quote，它生成的是Go字符串字面量
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, needsShellQuote) < 0 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func needsShellQuote(r rune) bool {
+	safe := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r)
+	return !safe
+}
@@ -2,105 +2,207 @@ package doc
 
 import (
 	"html/template"
+	"strings"
 
+	"github.com/ku-lang/ku/ast"
 	"github.com/ku-lang/ku/parser"
 )
 
 type Decl struct {
-	Node       parser.Documentable
+	Node       ast.Decl
 	Docs       string
 	ParsedDocs template.HTML // docs after markdown parsing
 	Ident      string        // identifier
 	Snippet    string        // code snippet of declaration
+	Overloads  []*Decl       // 同名函数的其他重载，和这个声明显示在同一个标题下
+	Unsafe     bool          // 标注了 [unsafe] 的函数，只能在 unsafe 代码块中调用
 }
 
-func (v *Decl) process() {
-	/*v.ParsedDocs = template.HTML(parseMarkdown(v.Docs))
-
-	switch v.Node.(type) {
-	case *parser.FunctionDecl:
-		v.Ident, v.Snippet = generateFunctionDeclSnippet(v.Node.(*parser.FunctionDecl))
-	case *parser.StructDecl:
-		v.Ident, v.Snippet = generateStructDeclSnippet(v.Node.(*parser.StructDecl))
-	case *parser.TraitDecl:
-		v.Ident, v.Snippet = generateTraitDeclSnippet(v.Node.(*parser.TraitDecl))
-	case *parser.ImplDecl:
-		v.Ident, v.Snippet = generateImplDeclSnippet(v.Node.(*parser.ImplDecl))
-	case *parser.VariableDecl:
-		v.Ident, v.Snippet = generateVariableDeclSnippet(v.Node.(*parser.VariableDecl))
+// process 生成声明的代码片段。文档在类型推导之后生成，
+// 所以片段中是推导出的完整类型，而不只是源码中写出的部分
+func (v *Decl) process(eval *ast.ConstEvaluator, private bool) {
+	v.ParsedDocs = template.HTML(parseMarkdown(v.Docs))
+
+	switch n := v.Node.(type) {
+	case *ast.FunctionDecl:
+		v.Ident, v.Snippet = generateFunctionDeclSnippet(n)
+		v.Unsafe = n.Function.Type.Attrs().Contains("unsafe")
+	case *ast.TypeDecl:
+		v.Ident, v.Snippet = generateTypeDeclSnippet(n, private)
+	case *ast.TypeAliasDecl:
+		v.Ident, v.Snippet = generateTypeAliasDeclSnippet(n)
+	case *ast.VariableDecl:
+		v.Ident, v.Snippet = generateVariableDeclSnippet(n, eval)
 	default:
 		panic("unimplimented decl type in doc")
-	}*/
+	}
 }
 
-/*func generateFunctionDeclSnippet(decl *parser.FunctionDecl) (ident, snippet string) {
-	ident = decl.Function.Name
+func generateFunctionDeclSnippet(decl *ast.FunctionDecl) (ident, snippet string) {
+	fn := decl.Function
+
+	// 方法写成 fun T.name、fun var T.name 或 fun static T.name
+	keyword := parser.KEYWORD_FUN
+	ident = fn.Name
+	if fn.Receiver != nil {
+		recv := fn.Receiver.Variable.Type
+		if ptr, ok := recv.BaseType.(ast.PointerType); ok {
+			keyword += " " + parser.KEYWORD_VAR
+			recv = ptr.Addressee
+		}
+		ident = recv.String() + "." + ident
+	} else if fn.StaticReceiverType != nil {
+		keyword += " " + parser.KEYWORD_STATIC
+		ident = fn.StaticReceiverType.TypeName() + genericSigilSnippet(fn.StaticTypeParameters) + "." + ident
+	}
 
-	snippet = parser.KEYWORD_FUNC + " " + ident + "("
-	for i, par := range decl.Function.Parameters {
-		snippet += par.Variable.Name + ": " + par.Variable.Type.TypeName()
-		if i < len(decl.Function.Parameters)-1 {
+	// 静态方法的类型的泛型参数写在类型名之后，参见 ast.Function.StaticTypeParameters
+	snippet = attrsSnippet(fn.Type.Attrs()) + publicSnippet(decl) + keyword + " " + ident +
+		genericSigilSnippet(fn.Type.GenericParameters[len(fn.StaticTypeParameters):]) + "("
+	for i, par := range fn.Parameters {
+		snippet += par.Variable.Name + " " + par.Variable.Type.String()
+		if i < len(fn.Parameters)-1 {
 			snippet += ", "
 		}
 	}
+	if fn.Type.IsVariadic {
+		if len(fn.Parameters) > 0 {
+			snippet += ", "
+		}
+		snippet += "..."
+	}
 	snippet += ")"
-	if decl.Function.ReturnType != nil {
-		snippet += ": " + decl.Function.ReturnType.TypeName()
 
+	if ret := fn.Type.Return; ret != nil && !ret.BaseType.IsVoidType() {
+		snippet += " " + ret.String()
 	}
-
 	return
 }
 
-func generateStructDeclSnippet(decl *parser.StructDecl) (ident, snippet string) {
-	ident = decl.Struct.Name
-	snippet = "struct " + decl.Struct.Name + " {"
-	for i, member := range decl.Struct.Variables {
-		snippet += "\n    " + member.Variable.Name + ": " + member.Variable.Type.TypeName()
-		if member.Assignment != nil {
-			snippet += " = [TODO values]"
+// generateTypeDeclSnippet 生成类型声明的片段。private为false时不显示结构体的非公开成员
+func generateTypeDeclSnippet(decl *ast.TypeDecl, private bool) (ident, snippet string) {
+	ident = decl.NamedType.Name
+	snippet = attrsSnippet(decl.NamedType.Attrs()) + publicSnippet(decl) + "type " + ident + " "
+
+	switch typ := decl.NamedType.Type.(type) {
+	case ast.StructType:
+		snippet += typ.Keyword() + genericSigilSnippet(typ.GenericParameters) + " {\n"
+		hidden := false
+		for _, member := range typ.Members {
+			if !member.Public && !private {
+				hidden = true
+				continue
+			}
+			snippet += "    "
+			if member.Public {
+				snippet += parser.KEYWORD_PUB + " "
+			}
+			snippet += member.Name + " " + member.Type.String() + ",\n"
 		}
-		if i < len(decl.Struct.Variables)-1 {
-			snippet += ","
-		} else {
-			snippet += "\n"
+		if hidden {
+			snippet += "    // private members omitted\n"
 		}
+		snippet += "}"
+
+	case ast.EnumType:
+		snippet += "enum" + genericSigilSnippet(typ.GenericParameters) + " {\n"
+		for _, member := range typ.Members {
+			snippet += "    " + member.Name
+			switch memType := member.Type.(type) {
+			case ast.TupleType:
+				if len(memType.Members) > 0 {
+					snippet += memType.TypeName()
+				}
+			case ast.StructType:
+				snippet += " " + memType.TypeName()
+			}
+			snippet += ",\n"
+		}
+		snippet += "}"
+
+	default:
+		snippet += decl.NamedType.Type.TypeName()
 	}
-	snippet += "}"
 	return
 }
 
-func generateTraitDeclSnippet(decl *parser.TraitDecl) (ident, snippet string) {
-	ident = decl.Trait.Name
-	snippet = "trait " + decl.Trait.Name + " {"
-	for _, member := range decl.Trait.Functions {
-		_, functionSnippet := generateFunctionDeclSnippet(member)
-		snippet += "\n    " + functionSnippet + "\n"
-	}
-	snippet += "}"
+func generateTypeAliasDeclSnippet(decl *ast.TypeAliasDecl) (ident, snippet string) {
+	alias := decl.Alias
+	ident = alias.Name
+	snippet = publicSnippet(decl) + "type " + ident + genericSigilSnippet(alias.GenericParameters) +
+		" = " + alias.Type.String()
 	return
 }
 
-func generateImplDeclSnippet(decl *parser.ImplDecl) (ident, snippet string) {
-	ident = decl.StructName
-	snippet = "impl " + decl.StructName
-	if decl.TraitName != "" {
-		snippet += " for " + decl.TraitName
+func generateVariableDeclSnippet(decl *ast.VariableDecl, eval *ast.ConstEvaluator) (ident, snippet string) {
+	vari := decl.Variable
+	ident = vari.Name
+
+	keyword := parser.KEYWORD_LET
+	if vari.Mutable {
+		keyword = parser.KEYWORD_VAR
+	}
+	// 静态成员写成 static let T.name
+	if vari.StaticReceiverType != nil {
+		keyword = parser.KEYWORD_STATIC + " " + keyword
+		ident = vari.StaticReceiverType.Name + "." + ident
 	}
-	snippet += " {"
-	for _, member := range decl.Functions {
-		_, functionSnippet := generateFunctionDeclSnippet(member)
-		snippet += "\n    " + functionSnippet + "\n"
+	snippet = attrsSnippet(vari.Attrs) + publicSnippet(decl) + keyword + " " + ident
+	if vari.Type != nil {
+		snippet += " " + vari.Type.String()
+	}
+
+	// 只显示不可变变量的值，可变变量的初始值没有意义
+	if !vari.Mutable && decl.Assignment != nil {
+		if value := eval.Eval(decl.Assignment); value != nil {
+			snippet += " = " + value.String()
+		}
 	}
-	snippet += "}"
 	return
 }
 
-func generateVariableDeclSnippet(decl *parser.VariableDecl) (ident, snippet string) {
-	ident = decl.Variable.Name
-	snippet = ident + ": " + decl.Variable.Type.TypeName()
-	if decl.Assignment != nil {
-		snippet += " = [TODO values]"
+func publicSnippet(decl ast.Decl) string {
+	if decl.IsPublic() {
+		return parser.KEYWORD_PUB + " "
+	} else if decl.IsFilePrivate() {
+		return parser.KEYWORD_PRIV + " "
 	}
-	return
-}*/
+	return ""
+}
+
+func attrsSnippet(attrs parser.AttrGroup) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	var strs []string
+	for _, attr := range attrs.Sorted() {
+		if attr.Value == "" {
+			strs = append(strs, attr.Key)
+		} else {
+			strs = append(strs, attr.Key+"=\""+attr.Value+"\"")
+		}
+	}
+	return "[" + strings.Join(strs, ", ") + "]\n"
+}
+
+// genericSigilSnippet 泛型参数以及它们的约束，如 <T: Eq & Hash, U>
+func genericSigilSnippet(sigil ast.GenericSigil) string {
+	if len(sigil) == 0 {
+		return ""
+	}
+
+	var params []string
+	for _, param := range sigil {
+		str := param.Name
+		if len(param.Constraints) > 0 {
+			var constraints []string
+			for _, c := range param.Constraints {
+				constraints = append(constraints, c.String())
+			}
+			str += ": " + strings.Join(constraints, " & ")
+		}
+		params = append(params, str)
+	}
+	return "<" + strings.Join(params, ", ") + ">"
+}
@@ -1,7 +1,9 @@
 package doc
 
 import (
+	"html/template"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/ku-lang/ku/ast"
@@ -11,15 +13,16 @@ import (
 )
 
 type Docgen struct {
-	Input []*ast.Module
-	Dir   string
+	Input           []*ast.Module
+	Dir             string
+	DocumentPrivate bool // 是否也生成非公开声明的文档，默认只有公开声明
 
 	output    []*File
 	curOutput *File
 }
 
 func (v *Docgen) Generate() {
-	log.Verboseln("docgen", util.TEXT_BOLD+util.TEXT_GREEN+"Started docgenning"+util.TEXT_RESET)
+	log.Verboseln(log.TagDocgen, util.TEXT_BOLD+util.TEXT_GREEN+"Started docgenning"+util.TEXT_RESET)
 	t := time.Now()
 
 	v.output = make([]*File, 0)
@@ -29,52 +32,71 @@ func (v *Docgen) Generate() {
 	v.generate()
 
 	dur := time.Since(t)
-	log.Verbose("docgen", util.TEXT_BOLD+util.TEXT_GREEN+"Finished docgenning"+util.TEXT_RESET+" (%.2fms)\n",
+	log.Verbose(log.TagDocgen, util.TEXT_BOLD+util.TEXT_GREEN+"Finished docgenning"+util.TEXT_RESET+" (%.2fms)\n",
 		float32(dur.Nanoseconds())/1000000)
 }
 
 func (v *Docgen) traverse() {
+	// 先收集所有不可变的全局变量，常量的值可能引用其他模块中的常量
+	eval := ast.NewConstEvaluator(v.Input)
+
 	for _, file := range v.Input {
+		docs := moduleDocs(file)
 		v.curOutput = &File{
 			// XXX: This might cause problems on windows (`:` not allowed in file names)
-			Name: file.Name.String(),
+			Name:     file.Name.String(),
+			Overview: template.HTML(parseMarkdown(docs)),
+			Summary:  summary(docs),
 		}
 
 		for _, submod := range file.Parts {
 			for _, n := range submod.Nodes {
-				switch n.(type) {
-				case ast.Decl:
-					decl := &Decl{
-						Node: n.(parser.Documentable),
-					}
+				node, ok := n.(ast.Decl)
+				if !ok {
+					continue
+				}
+				if _, ok := n.(*ast.DestructVarDecl); ok {
+					continue
+				}
+				if !node.IsPublic() && !v.DocumentPrivate {
+					continue
+				}
+
+				decl := &Decl{
+					Node: node,
+				}
 
-					for _, comm := range decl.Node.DocComments() {
+				if documentable, ok := n.(parser.Documentable); ok {
+					for _, comm := range documentable.DocComments() {
 						decl.Docs += comm.Contents + "\n"
 					}
+				}
 
-					decl.process()
-
-					switch n.(type) {
-					case *ast.FunctionDecl:
-						v.curOutput.FunctionDecls = append(v.curOutput.FunctionDecls, decl)
-					//case *ast.StructDecl:
-					//	v.curOutput.StructDecls = append(v.curOutput.StructDecls, decl)
-					//case *ast.TraitDecl:
-					//	v.curOutput.TraitDecls = append(v.curOutput.TraitDecls, decl)
-					//case *ast.ImplDecl:
-					//	v.curOutput.ImplDecls = append(v.curOutput.ImplDecls, decl)
-					case *ast.VariableDecl:
-						v.curOutput.VariableDecls = append(v.curOutput.VariableDecls, decl)
-					default:
-						panic("dammit")
-					}
+				decl.process(eval, v.DocumentPrivate)
+
+				switch n.(type) {
+				case *ast.FunctionDecl:
+					v.curOutput.FunctionDecls = append(v.curOutput.FunctionDecls, decl)
+				case *ast.TypeDecl, *ast.TypeAliasDecl:
+					v.curOutput.TypeDecls = append(v.curOutput.TypeDecls, decl)
+				case *ast.VariableDecl:
+					v.curOutput.VariableDecls = append(v.curOutput.VariableDecls, decl)
 				}
 			}
 		}
 
+		sortDecls(v.curOutput.VariableDecls)
+		sortDecls(v.curOutput.TypeDecls)
+		sortDecls(v.curOutput.FunctionDecls)
+		v.curOutput.FunctionDecls = groupOverloads(v.curOutput.FunctionDecls)
+
 		v.output = append(v.output, v.curOutput)
 		v.curOutput = nil
 	}
+
+	sort.Slice(v.output, func(i, j int) bool {
+		return v.output[i].Name < v.output[j].Name
+	})
 }
 
 func (v *Docgen) generate() {
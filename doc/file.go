@@ -11,11 +11,11 @@ var fileTemplate = template.Must(template.New("file").Parse(FILE_TEMPLATE_STR))
 
 type File struct {
 	Name          string
-	RootLoc       string // path from this file to the root directory (the directory containing index.html)
+	RootLoc       string        // path from this file to the root directory (the directory containing index.html)
+	Overview      template.HTML // module overview, from the module doc comment or doc.md
+	Summary       template.HTML // first paragraph of the overview, shown in the index
 	VariableDecls []*Decl
-	StructDecls   []*Decl
-	TraitDecls    []*Decl
-	ImplDecls     []*Decl
+	TypeDecls     []*Decl
 	FunctionDecls []*Decl
 }
 
@@ -68,24 +68,37 @@ const FILE_TEMPLATE_STR = `<!DOCTYPE html>
     <body>
         <div class="slab">
         	<div class="wrapper">
-		        <h1 class="slab-title">File {{.Name}}</h1>
+		        <h1 class="slab-title">Module {{.Name}}</h1>
 				<a href="{{.RootLoc}}index.html">Index</a>
 			</div>
 		</div>
 
 		<div class="wrapper">
-	        <section class="doc">
+			{{if .Overview}}
+	        <section class="doc" id="section-overview">
 				<h2>Overview</h2>
-				<ul>
-					{{range .VariableDecls}}<li><a href="#{{.Ident}}">{{.Snippet}}</a></li>{{end}}
-					{{range .StructDecls}}<li><a href="#{{.Ident}}">{{.Snippet}}</a></li>{{end}}
-					{{range .TraitDecls}}<li><a href="#{{.Ident}}">{{.Snippet}}</a></li>{{end}}
-					{{range .ImplDecls}}<li><a href="#{{.Ident}}">{{.Snippet}}</a></li>{{end}}
-					{{range .FunctionDecls}}<li><a href="#{{.Ident}}">{{.Snippet}}</a></li>{{end}}
+				<div class="doccomment">{{.Overview}}</div>
+			</section>
+			{{end}}
+
+	        <section class="doc">
+				<h2>Contents</h2>
+				<ul class="toc">
+					{{if .Overview}}<li><a href="#section-overview">Overview</a></li>{{end}}
+					{{if .VariableDecls}}<li><a href="#section-variables">Variables</a>
+						<ul>{{range .VariableDecls}}<li><a href="#{{.Ident}}">{{.Ident}}</a></li>{{end}}</ul>
+					</li>{{end}}
+					{{if .TypeDecls}}<li><a href="#section-types">Types</a>
+						<ul>{{range .TypeDecls}}<li><a href="#{{.Ident}}">{{.Ident}}</a></li>{{end}}</ul>
+					</li>{{end}}
+					{{if .FunctionDecls}}<li><a href="#section-functions">Functions</a>
+						<ul>{{range .FunctionDecls}}<li><a href="#{{.Ident}}">{{.Ident}}</a></li>{{end}}</ul>
+					</li>{{end}}
 				</ul>
 			</section>
 
-			<section class="doc">
+			{{if .VariableDecls}}
+			<section class="doc" id="section-variables">
 				<h2>Variables</h2>
 					{{range .VariableDecls}}
 					<h3 class="declname" id="{{.Ident}}">{{.Ident}}</h3>
@@ -93,42 +106,34 @@ const FILE_TEMPLATE_STR = `<!DOCTYPE html>
 					<div class="doccomment">{{.ParsedDocs}}</div>
 				{{end}}
 			</section>
+			{{end}}
 
-			<section class="doc">
-				<h2>Structs</h2>
-					{{range .StructDecls}}
-					<h3 class="declname" id="{{.Ident}}">{{.Ident}}</h3>
-					<pre class="snippet"><code>{{.Snippet}}</code></pre>
-					<div class="doccomment">{{.ParsedDocs}}</div>
-				{{end}}
-			</section>
-
-			<section class="doc">
-				<h2>Traits</h2>
-					{{range .TraitDecls}}
+			{{if .TypeDecls}}
+			<section class="doc" id="section-types">
+				<h2>Types</h2>
+					{{range .TypeDecls}}
 					<h3 class="declname" id="{{.Ident}}">{{.Ident}}</h3>
 					<pre class="snippet"><code>{{.Snippet}}</code></pre>
 					<div class="doccomment">{{.ParsedDocs}}</div>
 				{{end}}
 			</section>
+			{{end}}
 
-			<section class="doc">
-				<h2>Implementations</h2>
-					{{range .ImplDecls}}
-					<h3 class="declname" id="{{.Ident}}">{{.Ident}}</h3>
-					<pre class="snippet"><code>{{.Snippet}}</code></pre>
-					<div class="doccomment">{{.ParsedDocs}}</div>
-				{{end}}
-			</section>
-
-			<section class="doc">
+			{{if .FunctionDecls}}
+			<section class="doc" id="section-functions">
 				<h2>Functions</h2>
 					{{range .FunctionDecls}}
-					<h3 class="declname" id="{{.Ident}}">{{.Ident}}</h3>
+					<h3 class="declname" id="{{.Ident}}">{{.Ident}}{{if .Unsafe}} <span class="unsafe">unsafe</span>{{end}}</h3>
+					<pre class="snippet"><code>{{.Snippet}}</code></pre>
+					<div class="doccomment">{{.ParsedDocs}}</div>
+					{{range .Overloads}}
+					{{if .Unsafe}}<span class="unsafe">unsafe</span>{{end}}
 					<pre class="snippet"><code>{{.Snippet}}</code></pre>
 					<div class="doccomment">{{.ParsedDocs}}</div>
+					{{end}}
 				{{end}}
 			</section>
+			{{end}}
 		</div>
 	</body>
 </html>`
@@ -48,7 +48,7 @@ const INDEX_TEMPLATE_STR = `<!DOCTYPE html>
 
         <div class="wrapper">
             <ul class="files">
-                {{range .Files}}<li><a href="files/{{.Name}}.html">{{.Name}}</a></li>{{end}}
+                {{range .Files}}<li><a href="files/{{.Name}}.html">{{.Name}}</a>{{if .Summary}}<div class="summary">{{.Summary}}</div>{{end}}</li>{{end}}
             </ul>
         </div>
     </body>
@@ -0,0 +1,112 @@
+package doc
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+)
+
+// 模块概览：模块的文档页面开头显示模块的概览，来自文件开头的模块文档注释（参见parser.parseModuleDocComments），
+// 模块有多个文件时按文件名顺序拼接。没有模块文档注释时，使用模块目录中的 doc.md
+const overviewFileName = "doc.md"
+
+// moduleDocs 返回模块的概览文档（markdown）
+func moduleDocs(module *ast.Module) string {
+	trees := make([]string, 0, len(module.Trees))
+	docs := make(map[string]string)
+	for _, tree := range module.Trees {
+		var contents string
+		for _, comm := range tree.DocComments() {
+			contents += comm.Contents + "\n"
+		}
+		if contents != "" {
+			trees = append(trees, tree.Source.Name)
+			docs[tree.Source.Name] = contents
+		}
+	}
+	sort.Strings(trees)
+
+	var res string
+	for _, name := range trees {
+		if res != "" {
+			res += "\n"
+		}
+		res += docs[name]
+	}
+	if res != "" {
+		return res
+	}
+
+	// 单个源文件组成的模块没有目录，使用源文件所在的目录
+	dir := module.Dirpath
+	if dir == "" && len(module.Trees) == 1 {
+		dir = filepath.Dir(module.Trees[0].Source.Path)
+	}
+	if dir == "" {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, overviewFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			panic(err)
+		}
+		return ""
+	}
+	return string(data)
+}
+
+// summary 概览中标题以外的第一段，显示在索引页面中
+func summary(docs string) template.HTML {
+	for _, para := range strings.Split(docs, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para != "" && !strings.HasPrefix(para, "#") {
+			return template.HTML(parseMarkdown(para))
+		}
+	}
+	return ""
+}
+
+// sortDecls 按名字排序声明，方法（T.name）排在类型T的其他方法旁边
+func sortDecls(decls []*Decl) {
+	sort.SliceStable(decls, func(i, j int) bool {
+		return decls[i].Ident < decls[j].Ident
+	})
+}
+
+// groupOverloads 把重载的函数（排序后相邻的同名函数）合并到第一个声明中，重载按声明的位置排列
+func groupOverloads(decls []*Decl) []*Decl {
+	var res []*Decl
+	for _, decl := range decls {
+		if len(res) > 0 && res[len(res)-1].Ident == decl.Ident {
+			res[len(res)-1].Overloads = append(res[len(res)-1].Overloads, decl)
+			continue
+		}
+		res = append(res, decl)
+	}
+
+	for idx, decl := range res {
+		if len(decl.Overloads) == 0 {
+			continue
+		}
+		group := append([]*Decl{decl}, decl.Overloads...)
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := group[i].Node.Pos(), group[j].Node.Pos()
+			if a.Filename != b.Filename {
+				return a.Filename < b.Filename
+			}
+			return a.Line < b.Line
+		})
+		for _, overload := range group {
+			overload.Overloads = nil
+		}
+		group[0].Overloads = group[1:]
+		res[idx] = group[0]
+	}
+	return res
+}
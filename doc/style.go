@@ -109,8 +109,26 @@ a {
 	color: #444444;
 }
 
+.toc ul {
+	margin-bottom: 0.5em;
+}
+
+.files .summary {
+	padding-left: 25px;
+	margin-bottom: 0.5em;
+}
+
 .snippet {
 	margin: 10px;
 	padding: 10px;
 	background-color: #DDDDDD;
+}
+
+.unsafe {
+	font-family: "Fira Sans", "Helvetica Neue", Helvetica, Arial, sans-serif;
+	font-size: 0.7em;
+	padding: 2px 6px;
+	color: #fff;
+	background-color: #B03A2E;
+	vertical-align: middle;
 }`
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ku-lang/ku/parser"
+	"github.com/ku-lang/ku/util"
+)
+
+// 在编译阶段结束后输出语法树（--dump-after）
+//
+// parse 阶段输出语法分析树，其他阶段输出AST。输出到标准输出，不带颜色，子模块按文件名排序。
+// 输出的详细程度由 --dump-level 决定：
+//
+//	stable  不包含源码位置，只在语法树本身变化时才会变化，适合与保存的结果比较
+//	full    每个节点前加上源码位置
+var (
+	dumpPhases = []string{"parse", "construct", "resolve", "infer", "semcheck"}
+	dumpLevels = []string{"stable", "full"}
+)
+
+// dumpAfter 如果要求在phase阶段之后输出语法树，输出选中的模块的语法树
+func (v *Context) dumpAfter(phase string) {
+	if !containsString(v.DumpAfter, phase) {
+		return
+	}
+	full := v.DumpLevel == "full"
+
+	for _, module := range v.modules {
+		if len(v.DumpModules) > 0 && !containsString(v.DumpModules, module.Name.String()) {
+			continue
+		}
+
+		if phase == "parse" {
+			for _, tree := range module.Trees {
+				fmt.Printf(";; after %s: module %s, file %s\n", phase, module.Name, tree.Source.Name)
+				for _, node := range tree.Nodes {
+					fmt.Println(parser.DumpNode(node, full))
+				}
+				fmt.Println()
+			}
+			continue
+		}
+
+		names := make([]string, 0, len(module.Parts))
+		for name := range module.Parts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			submod := module.Parts[name]
+			fmt.Printf(";; after %s: module %s, file %s\n", phase, module.Name, submod.File.Name)
+			for _, node := range submod.Nodes {
+				if full {
+					fmt.Printf("@%d:%d ", node.Pos().Line, node.Pos().Char)
+				}
+				fmt.Println(util.StripColors(node.String()))
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/kupkg"
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/parser"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 特性（feature）与条件编译，cfg标注的语法参见parser/cfg.go。
+//
+// 顶层模块的目录中可以有清单文件 ku.json，声明模块的特性（以及构建钩子，参见hooks.go；源码布局，参见sourceroots.go）：
+//
+//	{"features": ["json", "yaml"]}
+//
+// 模块中的cfg标注只能使用声明过的特性。没有清单的模块（以及单个源文件）可以使用任意特性。
+// 编译时用 --features 启用特性：name 启用输入模块自己的特性（有多个输入时启用每个输入模块的特性），module/name 启用模块module的特性。
+// 模块包在打包时就已经决定了启用哪些特性，只能启用打包时启用过的特性
+const moduleManifestName = "ku.json"
+
+// moduleManifest 顶层模块的清单
+type moduleManifest struct {
+	path string
+
+	Module string `json:"module,omitempty"` // 项目的顶层模块名，参见project.go
+
+	Features []string `json:"features,omitempty"`
+	Hooks    []string `json:"hooks,omitempty"` // 构建钩子，参见hooks.go
+
+	// 源码根目录和模块目录的映射，参见sourceroots.go
+	Roots   []string          `json:"roots,omitempty"`
+	Modules map[string]string `json:"modules,omitempty"`
+
+	Exclude []string `json:"exclude,omitempty"` // 不属于模块的文件，参见sourcefiles.go
+}
+
+// readModuleManifest 读入顶层模块root的清单，模块没有源码目录或者清单时返回nil
+func (v *Context) readModuleManifest(root string) *moduleManifest {
+	if manifest, ok := v.moduleManifests[root]; ok {
+		return manifest
+	}
+
+	var manifest *moduleManifest
+	if fi, dirpath, err := v.findModuleDir(root); err == nil && fi.IsDir() {
+		path := filepath.Join(dirpath, moduleManifestName)
+		if data, err := ioutil.ReadFile(path); err == nil {
+			manifest = &moduleManifest{path: path}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				setupErr("Invalid module manifest `%s`: %s", path, err)
+			}
+			manifest.checkModules(root)
+			checkExcludePatterns(manifest.Exclude, "`"+path+"`")
+		} else if !os.IsNotExist(err) {
+			setupErr("%s", err)
+		}
+	}
+
+	v.moduleManifests[root] = manifest
+	return manifest
+}
+
+// inputRoots 输入的顶层模块名，输入的源文件属于 __main
+func (v *Context) inputRoots() []string {
+	var roots []string
+	for _, input := range v.Inputs {
+		root := input
+		if strings.HasSuffix(input, ".ku") {
+			root = "__main"
+		}
+		if !containsString(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// featureEnabled 顶层模块root的特性feature是否启用
+func (v *Context) featureEnabled(root, feature string) bool {
+	for _, enabled := range v.Features {
+		if enabled == root+"/"+feature || (enabled == feature && containsString(v.inputRoots(), root)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCfg 删除源文件中要求的特性没有启用的声明和use语句，返回保留下来的use语句用到的模块
+func (v *Context) filterCfg(sourcefile *lexer.Sourcefile, tree *parser.ParseTree, root string) []*parser.NameNode {
+	manifest := v.readModuleManifest(root)
+
+	deps, err := parser.FilterCfg(tree, func(feature string, attr *parser.Attr) bool {
+		if manifest != nil && !containsString(manifest.Features, feature) {
+			log.Errorln(log.TagMain, "%s [%s:%d:%d] Feature `%s` isn't declared in `%s`", util.Red("error:"),
+				attr.Pos().Filename, attr.Pos().Line, attr.Pos().Char, feature, manifest.path)
+			log.Errorln(log.TagMain, "%s", sourcefile.MarkPos(attr.Pos()))
+			util.ExitFunc(util.EXIT_FAILURE_SETUP)
+		}
+		return v.featureEnabled(root, feature)
+	})
+	if err != nil {
+		setupErr("%s", err)
+	}
+	return deps
+}
+
+// checkFeatures 检查 --features 启用的特性是否在模块清单中声明过，以及模块包打包时是否启用了这些特性
+func (v *Context) checkFeatures() {
+	for _, enabled := range v.Features {
+		roots, feature := v.inputRoots(), enabled
+		if idx := strings.IndexByte(enabled, '/'); idx >= 0 {
+			roots, feature = []string{enabled[:idx]}, enabled[idx+1:]
+		}
+
+		for _, root := range roots {
+			if pkg := v.packages[root]; pkg != nil {
+				if !containsString(pkg.Manifest.EnabledFeatures, feature) {
+					setupErr("Package `%s` (from `%s`) was built without feature `%s`.\n"+
+						"Rebuild it with `ku package --features %s`, or don't enable `%s`.",
+						root, pkg.Path, feature, feature, enabled)
+				}
+				continue
+			}
+
+			if manifest := v.readModuleManifest(root); manifest != nil && !containsString(manifest.Features, feature) {
+				setupErr("Feature `%s` enabled with --features isn't declared in `%s`", enabled, manifest.path)
+			}
+		}
+	}
+}
+
+// packageFeatures 在模块包的清单中记录打包的模块声明的特性和启用的特性
+func (v *Context) packageFeatures(manifest *kupkg.Manifest) {
+	root := v.Inputs[0]
+	if modManifest := v.readModuleManifest(root); modManifest != nil {
+		manifest.Features = modManifest.Features
+	}
+
+	for _, enabled := range v.Features {
+		feature := strings.TrimPrefix(enabled, root+"/")
+		if !strings.Contains(feature, "/") && !containsString(manifest.EnabledFeatures, feature) {
+			manifest.EnabledFeatures = append(manifest.EnabledFeatures, feature)
+		}
+	}
+}
+
+// splitFeatures 把 --features 的值（可以重复，每个值中用逗号分隔）拆成特性列表
+func splitFeatures(values []string) []string {
+	var res []string
+	for _, value := range values {
+		for _, feature := range strings.Split(value, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				res = append(res, feature)
+			}
+		}
+	}
+	return res
+}
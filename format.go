@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 源码格式化（ku fmt）
+//
+// 对每个源文件进行语法分析，用 parser.Format 重新输出。默认把结果输出到标准输出；
+// -w 把结果写回源文件；--check 只列出格式不对的文件，有这样的文件时以1退出，用于CI。
+// 目录参数递归处理其中的 .ku 文件，跳过以 . 开头的目录（如 .ku-build）。
+//
+// 输出之前对格式化的结果重新进行语法分析，检查语法树和注释的数量不变，
+// 不一致时说明格式化器有问题，报错并保留原文件不变。
+
+// formatFiles 格式化paths中的源文件，返回ku fmt的退出码
+func formatFiles(paths []string, write, check bool) int {
+	files := formatInputs(paths)
+
+	unformatted := 0
+	for _, path := range files {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			setupErr("%s", err)
+		}
+
+		formatted := formatSource(path)
+		if formatted == string(contents) {
+			if !check && !write {
+				fmt.Print(formatted)
+			}
+			continue
+		}
+
+		switch {
+		case check:
+			unformatted++
+			fmt.Println(path)
+		case write:
+			info, err := os.Stat(path)
+			if err != nil {
+				setupErr("%s", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(formatted), info.Mode()); err != nil {
+				setupErr("Couldn't write `%s`: %s", path, err)
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+
+	if unformatted > 0 {
+		return 1
+	}
+	return 0
+}
+
+// formatInputs 要格式化的文件：参数中的文件，以及参数中的目录下所有的 .ku 文件
+func formatInputs(paths []string) []string {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			setupErr("%s", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if file != path && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(file, ".ku") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			setupErr("%s", err)
+		}
+	}
+	return files
+}
+
+// formatSource 格式化一个源文件，返回格式化后的源码。源文件有语法错误时报错退出
+func formatSource(path string) string {
+	sourcefile, err := lexer.NewSourcefile(path)
+	if err != nil {
+		setupErr("%s", err)
+	}
+	sourcefile.Tokens = lexer.Lex(sourcefile)
+	tree, _ := parser.Parse(sourcefile)
+
+	formatted := parser.Format(tree)
+
+	// 格式化不能改变语法树，也不能丢掉注释
+	result := &lexer.Sourcefile{
+		Name:     sourcefile.Name,
+		Path:     sourcefile.Path,
+		Contents: []rune(formatted),
+		NewLines: []int{-1, -1},
+	}
+	resultTree, ok := tryParse(result)
+	if !ok || dumpParseTree(resultTree) != dumpParseTree(tree) ||
+		countComments(result) != countComments(sourcefile) {
+		setupErr("Formatting `%s` would change its meaning, so it was left unchanged. This is a bug in ku fmt", path)
+	}
+	return formatted
+}
+
+func dumpParseTree(tree *parser.ParseTree) string {
+	var buf strings.Builder
+	for _, node := range tree.Nodes {
+		buf.WriteString(parser.DumpNode(node, false))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// countComments 普通注释和文档注释的数量
+func countComments(sourcefile *lexer.Sourcefile) int {
+	count := len(sourcefile.Comments)
+	for _, tok := range sourcefile.Tokens {
+		if tok.Type == lexer.Doccomment {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ku-lang/ku/ast"
+)
+
+// ku graph：输出模块依赖图，或者（--calls）类型推导之后的函数调用图，格式为 DOT（Graphviz）或 JSON。
+// 用来了解模块之间的耦合，找出并拆开不需要的依赖和循环依赖：
+//
+//	ku graph src -o deps.dot && dot -Tsvg deps.dot -o deps.svg
+//
+// 循环依赖中的模块和边在 DOT 中标为红色，在 JSON 中列在 cycles 中
+var graphFormats = []string{"dot", "json"}
+
+// graph 依赖图与调用图
+type graph struct {
+	Modules      []string       `json:"modules"`
+	Dependencies []graphEdge    `json:"dependencies"`
+	Cycles       [][]string     `json:"cycles"`
+	Functions    []graphFunc    `json:"functions,omitempty"`
+	Calls        []graphEdge    `json:"calls,omitempty"`
+	cyclic       map[string]int // 模块 -> 所在的循环依赖的序号
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type graphFunc struct {
+	Name   string `json:"name"`
+	Module string `json:"module"`
+	label  string
+}
+
+// Graph 输出输入模块及其依赖的模块的依赖图。calls为true时改为输出类型推导之后的调用图
+func (v *Context) Graph(output, format string, calls bool) {
+	// 调用图需要解析变量，而解析要求没有循环依赖
+	v.AllowCycles = !calls
+	if calls {
+		runPhase("runtime loading", func() {
+			LoadRuntime()
+		})
+	}
+
+	v.parseFiles()
+
+	g := &graph{
+		Dependencies: []graphEdge{},
+		Cycles:       [][]string{},
+		cyclic:       make(map[string]int),
+	}
+	runPhase("graph phase", func() {
+		v.moduleGraph(g)
+	})
+
+	if calls {
+		runPhase("resolve phase", func() {
+			for _, module := range v.modules {
+				ast.Resolve(module, v.moduleLookup)
+			}
+		})
+		// 方法调用在类型推导时才能确定调用的函数
+		runPhase("inference phase", func() {
+			for _, module := range v.modules {
+				for _, submod := range module.Parts {
+					ast.Infer(submod)
+				}
+			}
+		})
+		runPhase("call graph phase", func() {
+			v.callGraph(g)
+		})
+	}
+
+	out := os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			setupErr("Couldn't create `%s`: %s", output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var err error
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(g)
+	} else {
+		err = g.writeDot(out, calls)
+	}
+	if err != nil {
+		setupErr("Couldn't write the graph: %s", err)
+	}
+}
+
+// moduleGraph 收集模块、模块之间的依赖以及循环依赖
+func (v *Context) moduleGraph(g *graph) {
+	for _, module := range v.modules {
+		g.Modules = append(g.Modules, module.Name.String())
+	}
+	sort.Strings(g.Modules)
+
+	seen := make(map[graphEdge]bool)
+	for _, edges := range v.depGraph.EdgesFrom {
+		for _, dep := range edges {
+			edge := graphEdge{From: dep.Src.Module.String(), To: dep.Dst.Module.String()}
+			if !seen[edge] {
+				seen[edge] = true
+				g.Dependencies = append(g.Dependencies, edge)
+			}
+		}
+	}
+	sortEdges(g.Dependencies)
+
+	for _, cycle := range v.depGraph.Cycles() {
+		var names []string
+		for _, node := range cycle {
+			names = append(names, node.Module.String())
+		}
+		sort.Strings(names)
+		g.Cycles = append(g.Cycles, names)
+	}
+	sort.Slice(g.Cycles, func(i, j int) bool {
+		return g.Cycles[i][0] < g.Cycles[j][0]
+	})
+	for idx, cycle := range g.Cycles {
+		for _, name := range cycle {
+			g.cyclic[name] = idx
+		}
+	}
+}
+
+// callGraph 收集各个模块中的函数（包括方法），以及函数之间的调用。
+// 函数中的匿名函数调用的函数算作外层函数的调用
+func (v *Context) callGraph(g *graph) {
+	seen := make(map[graphEdge]bool)
+	for _, module := range v.modules {
+		for _, submod := range module.Parts {
+			for _, node := range submod.Nodes {
+				decl, ok := node.(*ast.FunctionDecl)
+				if !ok {
+					continue
+				}
+
+				fn := decl.Function
+				caller := functionGraphName(fn)
+				g.Functions = append(g.Functions, graphFunc{Name: caller, Module: module.Name.String(), label: functionLabel(fn)})
+				if fn.Body == nil {
+					continue
+				}
+
+				scanner := &callScanner{}
+				ast.NewASTVisitor(scanner).VisitBlock(fn.Body)
+				for _, callee := range scanner.callees {
+					edge := graphEdge{From: caller, To: functionGraphName(callee)}
+					if !seen[edge] {
+						seen[edge] = true
+						g.Calls = append(g.Calls, edge)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(g.Functions, func(i, j int) bool {
+		return g.Functions[i].Name < g.Functions[j].Name
+	})
+	sortEdges(g.Calls)
+}
+
+// functionGraphName 调用图中函数的名字：模块名.函数名，方法为 模块名.类型名.方法名
+func functionGraphName(fn *ast.Function) string {
+	name := functionLabel(fn)
+	if fn.ParentModule != nil {
+		name = fn.ParentModule.Name.String() + "." + name
+	}
+	return name
+}
+
+// functionLabel 模块中的函数名，方法为 类型名.方法名
+func functionLabel(fn *ast.Function) string {
+	if fn.Receiver != nil {
+		recv := fn.Receiver.Variable.Type
+		if ptr, ok := recv.BaseType.(ast.PointerType); ok {
+			recv = ptr.Addressee
+		}
+		return recv.BaseType.TypeName() + "." + fn.Name
+	} else if fn.StaticReceiverType != nil {
+		return fn.StaticReceiverType.TypeName() + "." + fn.Name
+	}
+	return fn.Name
+}
+
+// callScanner 找出函数体中访问（调用或者取值）的所有函数
+type callScanner struct {
+	callees []*ast.Function
+}
+
+func (v *callScanner) Visit(n *ast.Node) bool {
+	if access, ok := (*n).(*ast.FunctionAccessExpr); ok && access.Function != nil && !access.Function.Anonymous {
+		v.callees = append(v.callees, access.Function)
+	}
+	return true
+}
+
+func (v *callScanner) PostVisit(n *ast.Node) {}
+func (v *callScanner) EnterScope()           {}
+func (v *callScanner) ExitScope()            {}
+
+func sortEdges(edges []graphEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+// writeDot 以 DOT 格式输出。输出调用图时，每个模块是一个子图，其中是模块中的函数
+func (g *graph) writeDot(w io.Writer, calls bool) error {
+	fmt.Fprintln(w, "digraph ku {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+
+	if !calls {
+		for _, name := range g.Modules {
+			fmt.Fprintf(w, "\t%s%s;\n", strconv.Quote(name), g.cycleAttrs(name, name))
+		}
+		for _, edge := range g.Dependencies {
+			fmt.Fprintf(w, "\t%s -> %s%s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To), g.cycleAttrs(edge.From, edge.To))
+		}
+	} else {
+		for idx, module := range g.Modules {
+			fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", idx)
+			fmt.Fprintf(w, "\t\tlabel=%s;\n", strconv.Quote(module))
+			for _, fn := range g.Functions {
+				if fn.Module == module {
+					fmt.Fprintf(w, "\t\t%s [label=%s];\n", strconv.Quote(fn.Name), strconv.Quote(fn.label))
+				}
+			}
+			fmt.Fprintln(w, "\t}")
+		}
+		for _, edge := range g.Calls {
+			fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// cycleAttrs 两个模块在同一个循环依赖中时，把它们之间的边（或者模块本身）标为红色
+func (g *graph) cycleAttrs(from, to string) string {
+	a, ok := g.cyclic[from]
+	b, ok2 := g.cyclic[to]
+	if ok && ok2 && a == b {
+		return " [color=red]"
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 构建脚本与构建钩子
+//
+// 从源码编译一个顶层模块之前，先运行它的构建钩子：
+//
+//	ku.json 中的 hooks   依次用shell执行的命令，如 {"hooks": ["./gen-tables.sh"]}
+//	build.ku            模块目录中的构建脚本，用 ku run 编译运行。它不属于模块本身
+//
+// 钩子在模块目录中运行，可以把生成的源码写到环境变量 KU_GENERATED_DIR 指定的目录中，
+// 即 .ku-build/generated/<模块名>。这个目录的结构与搜索路径相同，如 a/gen/x.ku 属于模块 a.gen，
+// 钩子运行后目录会被加入搜索路径。每次编译前都会清空这个目录。
+// 钩子还可以读取 KU_MODULE（模块名）、KU_FEATURES（启用的特性）和 KU_TARGET（目标三元组）
+const buildScriptName = "build.ku"
+
+// runModuleBuildHooks 在读入模块之前，运行从源码编译的顶层模块的构建钩子
+func (v *Context) runModuleBuildHooks(modname *ast.ModuleName) {
+	root := modname.Parts[0]
+	if v.ranHooks[root] {
+		return
+	}
+	if fi, dir, err := v.findModuleDir(root); err == nil && fi.IsDir() {
+		v.runBuildHooks(root, dir)
+	}
+}
+
+// runBuildHooks 运行顶层模块root的构建钩子。模块目录为dir，每个模块只运行一次
+func (v *Context) runBuildHooks(root, dir string) {
+	if v.ranHooks[root] {
+		return
+	}
+	v.ranHooks[root] = true
+
+	var hooks []string
+	if manifest := v.readModuleManifest(root); manifest != nil {
+		hooks = manifest.Hooks
+	}
+	script := filepath.Join(dir, buildScriptName)
+	if _, err := os.Stat(script); err != nil {
+		script = ""
+	}
+	if len(hooks) == 0 && script == "" {
+		return
+	}
+
+	genDir := filepath.Join(buildDirName, "generated", root)
+	// 钩子的输出会混入 ku lsp 的通信，这时不运行钩子，使用之前的构建生成的源码
+	if v.SkipHooks {
+		if _, err := os.Stat(genDir); err == nil {
+			v.Searchpaths = append(v.Searchpaths, genDir)
+		}
+		return
+	}
+	if err := os.RemoveAll(genDir); err != nil {
+		setupErr("Couldn't clear `%s`: %s", genDir, err)
+	}
+	genDir = ensureBuildDir(filepath.Join("generated", root))
+
+	absGenDir, err := filepath.Abs(genDir)
+	if err != nil {
+		setupErr("%s", err)
+	}
+	env := append(os.Environ(),
+		"KU_GENERATED_DIR="+absGenDir,
+		"KU_MODULE="+root,
+		"KU_FEATURES="+strings.Join(v.Features, ","),
+		"KU_TARGET="+LLVMCodegen.TargetTriple(v.Target),
+	)
+
+	for _, hook := range hooks {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", hook)
+		} else {
+			cmd = exec.Command("sh", "-c", hook)
+		}
+		v.runHook(cmd, dir, env, root, hook)
+	}
+
+	if script != "" {
+		exe, err := os.Executable()
+		if err != nil {
+			setupErr("Couldn't locate the ku executable to run `%s`: %s", script, err)
+		}
+
+		args := []string{"run", buildScriptName}
+		for _, searchpath := range v.Searchpaths {
+			abs, err := filepath.Abs(searchpath)
+			if err != nil {
+				setupErr("%s", err)
+			}
+			args = append(args, "-I", abs)
+		}
+		v.runHook(exec.Command(exe, args...), dir, env, root, script)
+	}
+
+	v.Searchpaths = append(v.Searchpaths, genDir)
+}
+
+// runHook 在模块目录中运行一个构建钩子，失败时退出
+func (v *Context) runHook(cmd *exec.Cmd, dir string, env []string, root, name string) {
+	log.Verboseln(log.TagMain, "Running build hook of module `%s`: %s", root, name)
+
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		setupErr("Build hook `%s` of module `%s` failed: %s", name, root, err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/kui"
+	"github.com/ku-lang/ku/lexer"
+)
+
+// 模块接口文件（.kui）。
+//
+// build --emit-interface 为每个编译的模块在 .ku-build/kui 下生成接口文件，路径与模块名对应，如 a.b.c 对应 a/b/c.kui。
+// 搜索路径中找不到模块的源码目录时，会查找同名的接口文件，只根据其中的声明编译依赖它的模块
+
+// writeInterfaces 为所有从源码编译的模块生成接口文件
+func (v *Context) writeInterfaces() {
+	for _, module := range v.modules {
+		if module.Interface || module.Name.String() == "__main" {
+			continue
+		}
+
+		iface, err := kui.Extract(module, VERSION)
+		if err != nil {
+			setupErr("Couldn't write interface of module `%s`: %s", module.Name, err)
+		}
+
+		path := filepath.Join(v.InterfaceDir, module.Name.ToPath()+kui.Extension)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			setupErr("%s", err)
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			setupErr("%s", err)
+		}
+		err = iface.Write(file)
+		file.Close()
+		if err != nil {
+			setupErr("Couldn't write interface file `%s`: %s", path, err)
+		}
+	}
+}
+
+// parseInterface 读入接口文件，返回只包含其中声明的模块
+func (v *Context) parseInterface(path string, modname *ast.ModuleName) *ast.Module {
+	file, err := os.Open(path)
+	if err != nil {
+		setupErr("%s", err)
+	}
+	iface, err := kui.Read(file)
+	file.Close()
+	if err != nil {
+		setupErr("Couldn't read interface file `%s`: %s", path, err)
+	}
+
+	return v.loadInterface(iface, path, modname)
+}
+
+// loadInterface 返回只包含接口中声明的模块。path为接口文件的位置，用于错误信息
+func (v *Context) loadInterface(iface *kui.Interface, path string, modname *ast.ModuleName) *ast.Module {
+	if iface.Module != modname.String() {
+		setupErr("Interface file `%s` is for module `%s`, expected `%s`", path, iface.Module, modname)
+	}
+
+	module := &ast.Module{
+		Name:      modname,
+		Dirpath:   filepath.Dir(path),
+		Interface: true,
+	}
+	v.moduleLookup.Create(modname).Module = module
+
+	sourcefile := &lexer.Sourcefile{
+		Name:     modname.Last(),
+		Path:     path,
+		Contents: []rune(iface.Source),
+		NewLines: []int{-1, -1},
+	}
+	recordSource(sourcefile)
+	v.parseSourcefile(sourcefile, module)
+
+	return module
+}
+
+// moduleExists 搜索路径中是否有模块的源码目录、接口文件或者包含模块的模块包
+func (v *Context) moduleExists(modname *ast.ModuleName) bool {
+	if _, _, err := v.findModuleSourceDir(modname); err == nil {
+		return true
+	}
+	if _, _, err := v.findModuleDir(modname.ToPath() + kui.Extension); err == nil {
+		return true
+	}
+	_, mod := v.packagedModule(modname)
+	return mod != nil
+}
@@ -0,0 +1,250 @@
+package kuast
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/util"
+)
+
+// Extract 从完成了语义检查的模块中提取分析结果。
+//
+// 类型按引用驻留：同一个类型（基本类型、同一个命名类型及相同的泛型实参、结构相同的其它类型）
+// 在类型表中只有一项。命名类型先占用表中的位置再提取实际类型，递归定义的类型（如链表节点中指向自身的指针）
+// 引用的是同一项
+func Extract(module *ast.Module, compiler string) *File {
+	ex := &extractor{
+		file:  &File{Compiler: compiler, Module: module.Name.String()},
+		index: make(map[string]int),
+	}
+
+	for _, tree := range module.Trees {
+		submod := module.Parts[tree.Source.Name]
+		if submod == nil {
+			continue
+		}
+		ex.file.Sources = append(ex.file.Sources, ex.extractSubmodule(submod))
+	}
+	return ex.file
+}
+
+type extractor struct {
+	file  *File
+	index map[string]int // 类型的键到类型表中下标的映射
+}
+
+func (v *extractor) extractSubmodule(submod *ast.Submodule) Source {
+	src := Source{Name: submod.File.Name, Path: submod.File.Path}
+	if contents, err := ioutil.ReadFile(submod.File.Path); err == nil {
+		src.Hash = HashSource(contents)
+	} else {
+		src.Hash = HashSource([]byte(string(submod.File.Contents)))
+	}
+
+	for _, node := range submod.Nodes {
+		pos := node.Pos()
+		switch n := node.(type) {
+		case *ast.TypeDecl:
+			src.Decls = append(src.Decls, Decl{
+				Kind: DeclType, Name: n.NamedType.Name, Public: n.IsPublic(),
+				Type: v.typeOf(&ast.TypeReference{BaseType: n.NamedType}),
+				Line: pos.Line, Char: pos.Char,
+			})
+
+		case *ast.FunctionDecl:
+			name := n.Function.Name
+			if recv := n.Function.Type.Receiver; recv != nil {
+				name = ast.TypeWithoutPointers(recv.BaseType).TypeName() + "." + name
+			} else if n.Function.StaticReceiverType != nil {
+				name = n.Function.StaticReceiverType.TypeName() + "." + name
+			}
+			src.Decls = append(src.Decls, Decl{
+				Kind: DeclFunction, Name: name, Public: n.IsPublic(),
+				Type: v.typeOf(&ast.TypeReference{BaseType: n.Function.Type}),
+				Line: pos.Line, Char: pos.Char,
+			})
+
+		case *ast.VariableDecl:
+			src.Decls = append(src.Decls, Decl{
+				Kind: DeclVariable, Name: n.Variable.Name, Public: n.IsPublic(),
+				Type: v.typeOf(n.Variable.Type),
+				Line: pos.Line, Char: pos.Char,
+			})
+		}
+	}
+
+	collector := &exprCollector{extractor: v}
+	visitor := ast.NewASTVisitor(collector)
+	for _, node := range submod.Nodes {
+		visitor.Visit(node)
+	}
+	src.Exprs = collector.exprs
+	return src
+}
+
+// exprCollector 按先序遍历收集有类型的表达式
+type exprCollector struct {
+	extractor *extractor
+	exprs     []Expr
+}
+
+func (v *exprCollector) EnterScope() {}
+func (v *exprCollector) ExitScope()  {}
+
+func (v *exprCollector) Visit(node *ast.Node) bool {
+	if expr, ok := (*node).(ast.Expr); ok && expr.GetType() != nil {
+		pos := expr.Pos()
+		v.exprs = append(v.exprs, Expr{
+			Node: expr.NodeName(),
+			Type: v.extractor.typeOf(expr.GetType()),
+			Line: pos.Line, Char: pos.Char,
+		})
+	}
+	return true
+}
+
+func (v *exprCollector) PostVisit(node *ast.Node) {}
+
+// typeOf 类型在类型表中的下标，不在表中时加入
+func (v *extractor) typeOf(typ *ast.TypeReference) int {
+	if typ == nil {
+		return NoType
+	}
+
+	args := v.typesOf(typ.GenericArguments)
+
+	// 命名类型和泛型参数以自身为键，先占用位置，再提取其中用到的类型
+	switch t := typ.BaseType.(type) {
+	case *ast.NamedType:
+		key := fmt.Sprintf("named %p %v", t, args)
+		if idx, ok := v.index[key]; ok {
+			return idx
+		}
+		idx := v.add(key, Type{Kind: KindNamed, Name: namedTypeName(t, typ), GenericArgs: args, Return: NoType, Receiver: NoType})
+		v.file.Types[idx].Underlying = v.typeOf(&ast.TypeReference{BaseType: t.Type})
+		return idx
+
+	case *ast.SubstitutionType:
+		key := fmt.Sprintf("substitution %p", t)
+		if idx, ok := v.index[key]; ok {
+			return idx
+		}
+		idx := v.add(key, Type{Kind: KindSubstitution, Name: t.Name, Return: NoType, Receiver: NoType, Underlying: NoType})
+		v.file.Types[idx].Elems = v.typesOf(t.Constraints)
+		return idx
+	}
+
+	entry := Type{Name: util.StripColors(typ.String()), GenericArgs: args, Return: NoType, Receiver: NoType, Underlying: NoType}
+	switch t := typ.BaseType.(type) {
+	case ast.PrimitiveType:
+		entry.Kind = KindPrimitive
+
+	case ast.PointerType:
+		entry.Kind = KindPointer
+		entry.Elems = []int{v.typeOf(t.Addressee)}
+		entry.Mutable = t.IsMutable
+
+	case ast.ReferenceType:
+		entry.Kind = KindReference
+		entry.Elems = []int{v.typeOf(t.Referrer)}
+		entry.Mutable = t.IsMutable
+
+	case ast.ArrayType:
+		entry.Kind = KindArray
+		entry.Elems = []int{v.typeOf(t.MemberType)}
+		entry.Length = -1
+		if t.IsFixedLength {
+			entry.Length = t.Length
+		}
+
+	case ast.TupleType:
+		entry.Kind = KindTuple
+		entry.Elems = v.typesOf(t.Members)
+
+	case ast.FunctionType:
+		entry.Kind = KindFunction
+		entry.Elems = v.typesOf(t.Parameters)
+		entry.Return = v.typeOf(t.Return)
+		entry.Receiver = v.typeOf(t.Receiver)
+		entry.Variadic = t.IsVariadic
+
+	case ast.StructType:
+		entry.Kind = KindStruct
+		entry.Union = t.IsUnion
+		for _, mem := range t.Members {
+			entry.Fields = append(entry.Fields, Field{Name: mem.Name, Type: v.typeOf(mem.Type), Public: mem.Public})
+		}
+
+	case ast.EnumType:
+		entry.Kind = KindEnum
+		for _, mem := range t.Members {
+			entry.Fields = append(entry.Fields, Field{Name: mem.Name, Type: v.typeOf(&ast.TypeReference{BaseType: mem.Type}), Tag: mem.Tag})
+		}
+
+	case ast.InterfaceType:
+		v.interfaceEntry(&entry, t)
+
+	case *ast.InterfaceType:
+		v.interfaceEntry(&entry, *t)
+
+	default:
+		entry.Kind = KindOther
+	}
+
+	key := entryKey(entry)
+	if idx, ok := v.index[key]; ok {
+		return idx
+	}
+	return v.add(key, entry)
+}
+
+// interfaceEntry 接口的方法。TypeName 是调试用的多行格式，名字只列出方法名
+func (v *extractor) interfaceEntry(entry *Type, t ast.InterfaceType) {
+	entry.Kind = KindInterface
+	names := make([]string, len(t.Functions))
+	for idx, fn := range t.Functions {
+		names[idx] = fn.Name
+		entry.Fields = append(entry.Fields, Field{Name: fn.Name, Type: v.typeOf(&ast.TypeReference{BaseType: fn.Type})})
+	}
+	entry.Name = "interface { " + strings.Join(names, ", ") + " }"
+}
+
+func (v *extractor) typesOf(types []*ast.TypeReference) []int {
+	if len(types) == 0 {
+		return nil
+	}
+	res := make([]int, len(types))
+	for idx, typ := range types {
+		res[idx] = v.typeOf(typ)
+	}
+	return res
+}
+
+func (v *extractor) add(key string, entry Type) int {
+	idx := len(v.file.Types)
+	v.file.Types = append(v.file.Types, entry)
+	v.index[key] = idx
+	return idx
+}
+
+// entryKey 结构相同的类型的键相同。用到的类型都已经驻留，比较下标即可
+func entryKey(entry Type) string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "%d %q %v %v %d %d %d %d %t %t %t", entry.Kind, entry.Name, entry.Elems, entry.GenericArgs,
+		entry.Return, entry.Receiver, entry.Underlying, entry.Length, entry.Mutable, entry.Variadic, entry.Union)
+	for _, field := range entry.Fields {
+		fmt.Fprintf(buf, " %q:%d:%t:%d", field.Name, field.Type, field.Public, field.Tag)
+	}
+	return buf.String()
+}
+
+// namedTypeName 命名类型带模块名的写法，如 a.b.T<int>
+func namedTypeName(t *ast.NamedType, typ *ast.TypeReference) string {
+	name := util.StripColors(typ.String())
+	if t.ParentModule != nil && t.ParentModule.Name != nil {
+		name = t.ParentModule.Name.String() + "." + name
+	}
+	return name
+}
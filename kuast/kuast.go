@@ -0,0 +1,263 @@
+// Package kuast 读写带类型的语法树（.kuast）。
+//
+// 完成变量解析、类型推导和语义检查之后，模块的分析结果写入 .kuast 文件，增量编译的缓存、
+// 接口文件和编辑器等工具读入它就能得到声明和表达式的类型，不需要重新分析源码。
+//
+// 文件格式：
+//
+//	"KUAST" 格式版本(1字节)
+//	File                      gob编码，deflate压缩
+//
+// 类型只在类型表（File.Types）中出现一次，其它地方用下标引用，参见 Extract。
+// 数据结构改变时应当增加 Version；File中也记录了数据结构的摘要（SchemaHash），
+// 忘记增加版本号时读入也会失败，缓存视为失效，重新分析即可。
+// 源文件的内容改变时缓存同样失效，参见 File.Stale
+package kuast
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+const (
+	magic = "KUAST"
+
+	// Version 文件格式的版本，数据结构改变时增加
+	Version = 1
+
+	// Extension 带类型的语法树文件的扩展名
+	Extension = ".kuast"
+)
+
+// File 一个模块的分析结果
+type File struct {
+	Schema   string   // 写入时的数据结构摘要，参见 SchemaHash
+	Compiler string   // 生成文件的编译器版本
+	Module   string   // 模块名，如 a.b.c
+	Sources  []Source // 模块的源文件
+	Types    []Type   // 类型表
+}
+
+// Source 一个源文件中的声明和表达式
+type Source struct {
+	Name  string // 文件名
+	Path  string // 文件路径
+	Hash  string // 文件内容的sha256，用于判断缓存是否失效
+	Decls []Decl
+	Exprs []Expr
+}
+
+// TypeKind 类型的种类
+type TypeKind uint8
+
+const (
+	KindOther        TypeKind = iota // 其它类型，只记录名字
+	KindPrimitive                    // 基本类型
+	KindNamed                        // 命名类型
+	KindPointer                      // 指针
+	KindReference                    // 引用
+	KindArray                        // 数组
+	KindTuple                        // 元组
+	KindFunction                     // 函数
+	KindStruct                       // 结构体或者联合体
+	KindEnum                         // 枚举
+	KindInterface                    // 接口
+	KindSubstitution                 // 泛型参数
+)
+
+// NoType 类型的下标，表示没有类型，如没有返回值的函数的返回类型
+const NoType = -1
+
+// Type 类型表中的一项。用到的其它类型都是类型表中的下标
+type Type struct {
+	Kind        TypeKind
+	Name        string  // 在源码中的写法，如 ^[]u8；命名类型带模块名，如 a.b.T
+	Elems       []int   // 指针、引用、数组的元素；元组的成员；函数的参数；泛型参数的约束
+	Return      int     // 函数的返回类型
+	Receiver    int     // 方法的接收者类型
+	Underlying  int     // 命名类型的实际类型
+	GenericArgs []int   // 泛型实参
+	Fields      []Field // 结构体的成员；枚举的成员；接口的方法
+	Length      int     // 定长数组的长度，不定长的数组为-1
+	Mutable     bool    // 可变的指针、引用
+	Variadic    bool    // 可变参数的函数
+	Union       bool    // 联合体
+}
+
+// Field 结构体的成员、枚举的成员或者接口的方法
+type Field struct {
+	Name   string
+	Type   int
+	Public bool
+	Tag    int // 枚举成员的标签
+}
+
+// DeclKind 声明的种类
+type DeclKind uint8
+
+const (
+	DeclType DeclKind = iota
+	DeclFunction
+	DeclVariable
+)
+
+// Decl 顶层的类型、函数（包括方法）和变量声明
+type Decl struct {
+	Kind       DeclKind
+	Name       string
+	Public     bool
+	Type       int
+	Line, Char int
+}
+
+// Expr 一个表达式推导得到的类型
+type Expr struct {
+	Node       string // 表达式的种类，如 call expression
+	Type       int
+	Line, Char int
+}
+
+// StaleError 缓存已经失效
+type StaleError struct {
+	Reason string
+}
+
+func (v *StaleError) Error() string {
+	return "stale typed AST: " + v.Reason
+}
+
+// SchemaHash 数据结构的摘要：File及其用到的所有类型的字段名和字段类型
+func SchemaHash() string {
+	h := sha256.New()
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		fmt.Fprintf(h, "%s %s;", t.Name(), t.Kind())
+		switch t.Kind() {
+		case reflect.Slice, reflect.Ptr:
+			walk(t.Elem())
+		case reflect.Struct:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				fmt.Fprintf(h, "%s:", field.Name)
+				walk(field.Type)
+			}
+		}
+	}
+	walk(reflect.TypeOf(File{}))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Write 把分析结果写入w
+func (v *File) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	bw.WriteByte(Version)
+
+	fw, err := flate.NewWriter(bw, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	v.Schema = SchemaHash()
+	if err := gob.NewEncoder(fw).Encode(v); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Read 从r读入分析结果。版本或者数据结构不同时返回 *StaleError
+func Read(r io.Reader) (*File, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a ku typed AST file")
+	}
+	if header[len(magic)] != Version {
+		return nil, &StaleError{Reason: fmt.Sprintf("format version %d, expected %d", header[len(magic)], Version)}
+	}
+
+	res := &File{}
+	if err := gob.NewDecoder(flate.NewReader(br)).Decode(res); err != nil {
+		return nil, err
+	}
+	if schema := SchemaHash(); res.Schema != schema {
+		return nil, &StaleError{Reason: fmt.Sprintf("schema %s, expected %s", res.Schema, schema)}
+	}
+	return res, nil
+}
+
+// Stale 源文件不存在或者内容改变时，返回失效的原因
+func (v *File) Stale() (string, bool) {
+	for _, src := range v.Sources {
+		contents, err := ioutil.ReadFile(src.Path)
+		if err != nil {
+			return fmt.Sprintf("couldn't read `%s`: %s", src.Path, err), true
+		}
+		if HashSource(contents) != src.Hash {
+			return fmt.Sprintf("`%s` has changed", src.Path), true
+		}
+	}
+	return "", false
+}
+
+// Load 读入path中的分析结果。文件格式、数据结构或者源文件改变时返回 *StaleError
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if reason, stale := res.Stale(); stale {
+		return nil, &StaleError{Reason: reason}
+	}
+	return res, nil
+}
+
+// HashSource 源文件内容的摘要
+func HashSource(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// TypeString 类型表中下标为idx的类型在源码中的写法
+func (v *File) TypeString(idx int) string {
+	if idx < 0 || idx >= len(v.Types) {
+		return "void"
+	}
+	return v.Types[idx].Name
+}
+
+// ExprAt 源文件name中位于line行char列的表达式，没有时返回nil。同一位置有多个表达式时返回最外层的
+func (v *File) ExprAt(name string, line, char int) *Expr {
+	for i := range v.Sources {
+		src := &v.Sources[i]
+		if src.Name != name {
+			continue
+		}
+		for j := range src.Exprs {
+			if expr := &src.Exprs[j]; expr.Line == line && expr.Char == char {
+				return expr
+			}
+		}
+	}
+	return nil
+}
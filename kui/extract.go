@@ -0,0 +1,292 @@
+package kui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/parser"
+)
+
+// Extract 从模块的语法分析树中提取导出的声明。
+// 私有类型也会保留，因为导出的声明可能用到它们。
+// 导出的变量必须写明类型；不可变变量的初始值是常量时写成字面量（编译期断言和数组长度会用到它），否则不写入接口文件。
+// 多变量定义（let a, b = ...）不能导出到接口文件中。
+//
+// 导出的泛型函数在使用它的模块中实例化，函数体中用到的私有声明也要写入接口文件（参见 privateDependencies）：
+// 私有函数保留函数体，在使用它的程序中生成内部符号；私有方法只保留函数头；
+// 私有的不可变变量的初始值必须是常量，其他私有变量不能在导出的泛型函数中使用
+func Extract(module *ast.Module, compiler string) (*Interface, error) {
+	res := &Interface{
+		Compiler: compiler,
+		Module:   module.Name.String(),
+	}
+
+	decls := newModuleDecls(module)
+	private, err := decls.privateDependencies()
+	if err != nil {
+		return nil, err
+	}
+	eval := decls.constEvaluator()
+
+	uses := make(map[string]bool)
+	buf := new(bytes.Buffer)
+	for _, tree := range module.Trees {
+		src := tree.Source
+		for _, node := range tree.Nodes {
+			switch n := node.(type) {
+			case *parser.UseDirectiveNode:
+				name := src.SpanContents(n.Module.Where())
+				if !uses[name] {
+					uses[name] = true
+					res.Uses = append(res.Uses, name)
+				}
+
+			case *parser.LinkDirectiveNode, *parser.FeatureDirectiveNode:
+				// 泛型函数的函数体在使用它的模块中编译，其中可能用到实验性的语言特性
+				buf.WriteString(src.SpanContents(n.Where()) + "\n")
+
+			case *parser.TypeDeclNode:
+				writeDecl(buf, n, src.SpanContents(n.Where()))
+
+			case *parser.FunctionDeclNode:
+				decl := decls.functions[n.Where().Start()]
+				if !n.IsPublic() && (decl == nil || !private[decl.Function]) {
+					continue
+				}
+				if decls.writesBody(n) {
+					text := src.SpanContents(n.Where())
+					// => 之后不是条件语句时，顶层的函数以 ; 结束，它不在函数的位置范围内
+					if n.Function.Expr != nil || n.Function.Stat != nil && !isConditionalStat(n.Function.Stat) {
+						text += ";"
+					}
+					writeDecl(buf, n, text)
+				} else {
+					writeDecl(buf, n, src.SpanContents(n.Function.Header.Where())+";")
+				}
+
+			case *parser.VarDeclNode:
+				decl := decls.variables[n.Where().Start()]
+				if !n.IsPublic() && (decl == nil || !private[decl.Variable]) {
+					continue
+				}
+				if n.Type == nil {
+					return nil, fmt.Errorf("[%s:%d:%d] exported variable `%s` needs an explicit type to be written to an interface file",
+						n.Where().Filename, n.Where().StartLine, n.Where().StartChar, n.Name.Value)
+				}
+
+				keyword := "let"
+				if n.Mutable.Value != "" {
+					keyword = "var"
+				}
+				text := keyword + " " + n.Name.Value + " " + src.SpanContents(n.Type.Where())
+				if decl != nil && !decl.Variable.Mutable && decl.Assignment != nil {
+					if value := eval.Eval(decl.Assignment); value != nil {
+						text += " = " + value.Literal()
+					}
+				}
+				writeDecl(buf, n, text)
+			}
+		}
+	}
+
+	head := new(bytes.Buffer)
+	for _, use := range res.Uses {
+		head.WriteString("use " + use + "\n")
+	}
+	res.Source = head.String() + buf.String()
+	return res, nil
+}
+
+// moduleDecls 模块中的顶层声明，按照声明的位置对应到语法分析树中的节点
+type moduleDecls struct {
+	module    *ast.Module
+	functions map[lexer.Position]*ast.FunctionDecl
+	variables map[lexer.Position]*ast.VariableDecl
+
+	functionNodes map[*ast.Function]*parser.FunctionDeclNode
+	functionDecls map[*ast.Function]*ast.FunctionDecl
+	variableDecls map[*ast.Variable]*ast.VariableDecl
+}
+
+func newModuleDecls(module *ast.Module) *moduleDecls {
+	res := &moduleDecls{
+		module:        module,
+		functions:     make(map[lexer.Position]*ast.FunctionDecl),
+		variables:     make(map[lexer.Position]*ast.VariableDecl),
+		functionNodes: make(map[*ast.Function]*parser.FunctionDeclNode),
+		functionDecls: make(map[*ast.Function]*ast.FunctionDecl),
+		variableDecls: make(map[*ast.Variable]*ast.VariableDecl),
+	}
+	for _, submod := range module.Parts {
+		for _, node := range submod.Nodes {
+			switch n := node.(type) {
+			case *ast.FunctionDecl:
+				res.functions[n.Pos()] = n
+				res.functionDecls[n.Function] = n
+			case *ast.VariableDecl:
+				res.variables[n.Pos()] = n
+				res.variableDecls[n.Variable] = n
+			}
+		}
+	}
+	for _, tree := range module.Trees {
+		for _, node := range tree.Nodes {
+			if n, ok := node.(*parser.FunctionDeclNode); ok {
+				if decl := res.functions[n.Where().Start()]; decl != nil {
+					res.functionNodes[decl.Function] = n
+				}
+			}
+		}
+	}
+	return res
+}
+
+// writesBody 函数是否连同函数体写入接口文件：泛型函数在使用时实例化；
+// 私有的普通函数是内部符号，使用它的程序要自己生成一份。其他函数只写函数头
+func (v *moduleDecls) writesBody(n *parser.FunctionDeclNode) bool {
+	if n.Function.Body == nil && n.Function.Stat == nil && n.Function.Expr == nil {
+		return false
+	}
+	if isGeneric(n.Function.Header) {
+		return true
+	}
+	decl := v.functions[n.Where().Start()]
+	return !n.IsPublic() && decl != nil && !isMethod(decl.Function)
+}
+
+// privateDependencies 导出的泛型函数（直接或者间接）用到的私有函数和变量
+func (v *moduleDecls) privateDependencies() (map[interface{}]bool, error) {
+	res := make(map[interface{}]bool)
+
+	var work []*ast.FunctionDecl
+	for fn, n := range v.functionNodes {
+		if n.IsPublic() && v.writesBody(n) {
+			work = append(work, v.functionDecls[fn])
+		}
+	}
+
+	eval := v.constEvaluator()
+	for len(work) > 0 {
+		decl := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		refs := &referenceCollector{}
+		ast.NewASTVisitor(refs).Visit(decl.Function.Body)
+
+		for _, fn := range refs.functions {
+			// C函数的声明也是公开的，这里看源码中有没有写 pub
+			n, ok := v.functionNodes[fn]
+			if !ok || n.IsPublic() || res[fn] {
+				continue
+			}
+			res[fn] = true
+			// 私有方法只写入函数头，函数体在模块的目标文件中
+			if v.writesBody(n) {
+				work = append(work, v.functionDecls[fn])
+			}
+		}
+
+		for _, vari := range refs.variables {
+			dep, ok := v.variableDecls[vari]
+			if !ok || dep.IsPublic() || res[vari] {
+				continue
+			}
+			if ast.VariableVisibility(false, vari) == ast.VISIBILITY_INTERNAL {
+				if vari.Mutable || dep.Assignment == nil || eval.Eval(dep.Assignment) == nil {
+					pos := decl.Pos()
+					return nil, fmt.Errorf("[%s:%d:%d] `%s` uses private variable `%s`, which can't be written to an interface file; make it public or a constant",
+						pos.Filename, pos.Line, pos.Char, decl.Function.Name, vari.Name)
+				}
+			}
+			res[vari] = true
+		}
+	}
+	return res, nil
+}
+
+// constEvaluator 计算不可变变量的初始值，可以使用本模块和引入的模块中的常量
+func (v *moduleDecls) constEvaluator() *ast.ConstEvaluator {
+	modules := []*ast.Module{v.module}
+	for _, submod := range v.module.Parts {
+		for _, used := range submod.UseScope.UsedModules {
+			modules = append(modules, used)
+		}
+	}
+	eval := ast.NewConstEvaluator(modules)
+	if ast.TargetLayout != nil {
+		eval.SizeOf, eval.AlignOf, eval.OffsetOf = ast.TargetLayout.SizeOf, ast.TargetLayout.AlignOf, ast.TargetLayout.OffsetOf
+	}
+	return eval
+}
+
+// referenceCollector 收集函数体中访问的函数和变量
+type referenceCollector struct {
+	functions []*ast.Function
+	variables []*ast.Variable
+}
+
+func (v *referenceCollector) EnterScope() {}
+func (v *referenceCollector) ExitScope()  {}
+
+func (v *referenceCollector) PostVisit(node *ast.Node) {}
+
+func (v *referenceCollector) Visit(node *ast.Node) bool {
+	switch n := (*node).(type) {
+	case *ast.FunctionAccessExpr:
+		v.functions = append(v.functions, n.Function)
+		v.functions = append(v.functions, n.Overloads...)
+	case *ast.VariableAccessExpr:
+		if n.Variable != nil {
+			v.variables = append(v.variables, n.Variable)
+		}
+	case *ast.StructAccessExpr:
+		if n.Method != nil {
+			v.functions = append(v.functions, n.Method.Function)
+		}
+	}
+	return true
+}
+
+func writeDecl(buf *bytes.Buffer, decl parser.DeclNode, text string) {
+	buf.WriteString("\n")
+	if attrs := decl.Attrs(); len(attrs) > 0 {
+		var strs []string
+		for _, attr := range attrs.Sorted() {
+			// [key(value)] 和 [key="value"] 的值相同，统一写成后一种
+			if attr.Value == "" {
+				strs = append(strs, attr.Key)
+			} else {
+				strs = append(strs, attr.Key+"=\""+attr.Value+"\"")
+			}
+		}
+		buf.WriteString("[" + strings.Join(strs, ", ") + "]\n")
+	}
+	if decl.IsPublic() {
+		buf.WriteString("pub ")
+	}
+	buf.WriteString(text + "\n")
+}
+
+// isGeneric 函数本身、方法的接收者或者静态方法的类型是否有泛型参数
+func isGeneric(header *parser.FunctionHeaderNode) bool {
+	if header.GenericSigil != nil || header.StaticReceiverSigil != nil {
+		return true
+	}
+	return header.Receiver != nil && header.Receiver.Type != nil && len(header.Receiver.Type.GenericArguments) > 0
+}
+
+// isMethod 方法和静态方法总是外部符号，参见 ast.FunctionVisibility
+func isMethod(fn *ast.Function) bool {
+	return fn.Receiver != nil || fn.StaticReceiverType != nil
+}
+
+func isConditionalStat(stat parser.ParseNode) bool {
+	switch stat.(type) {
+	case *parser.IfStatNode, *parser.MatchStatNode, *parser.LoopStatNode:
+		return true
+	}
+	return false
+}
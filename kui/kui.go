@@ -0,0 +1,141 @@
+// Package kui 读写模块接口文件（.kui）。
+//
+// 接口文件记录一个模块导出的声明，依赖这个模块的其他模块只需要读入接口文件就可以完成名字解析和类型推导，
+// 不需要模块的源码。模块的代码需要以目标文件的形式另外提供。
+//
+// 文件格式：
+//
+//	"KUI" 格式版本(1字节)
+//	编译器版本、模块名              字符串：uvarint长度 + 内容
+//	依赖的模块数量(uvarint) 模块名...
+//	声明源码                        deflate压缩后的字符串
+//
+// 声明源码是只包含导出声明的ku源码：类型定义完整保留；非泛型函数只保留函数头；
+// 泛型函数在使用时才实例化，所以保留函数体，函数体中用到的私有函数和常量也一起保留；
+// 导出的全局变量保留类型，不可变变量的初始值是常量时写成字面量。
+package kui
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	magic   = "KUI"
+	version = 1
+
+	// Extension 接口文件的扩展名
+	Extension = ".kui"
+)
+
+// Interface 一个模块的接口
+type Interface struct {
+	Compiler string   // 生成接口文件的编译器版本
+	Module   string   // 模块名，如 a.b.c
+	Uses     []string // 声明中用到的模块
+	Source   string   // 导出声明的源码
+}
+
+// Write 把接口写入w
+func (v *Interface) Write(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(magic)
+	buf.WriteByte(version)
+
+	writeString(buf, v.Compiler)
+	writeString(buf, v.Module)
+	writeUvarint(buf, uint64(len(v.Uses)))
+	for _, use := range v.Uses {
+		writeString(buf, use)
+	}
+
+	source := new(bytes.Buffer)
+	fw, err := flate.NewWriter(source, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write([]byte(v.Source)); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	writeString(buf, source.String())
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Read 从r读入接口
+func Read(r io.Reader) (*Interface, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a ku interface file")
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported interface file version %d (expected %d)", header[len(magic)], version)
+	}
+
+	res := &Interface{}
+	var err error
+	if res.Compiler, err = readString(br); err != nil {
+		return nil, err
+	}
+	if res.Module, err = readString(br); err != nil {
+		return nil, err
+	}
+
+	numUses, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < numUses; i++ {
+		use, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		res.Uses = append(res.Uses, use)
+	}
+
+	compressed, err := readString(br)
+	if err != nil {
+		return nil, err
+	}
+	source, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader([]byte(compressed))))
+	if err != nil {
+		return nil, err
+	}
+	res.Source = string(source)
+
+	return res, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, x uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	buf.Write(tmp[:n])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
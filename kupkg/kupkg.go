@@ -0,0 +1,201 @@
+// Package kupkg 读写预编译的模块包（.kupkg）。
+//
+// 模块包把一组模块的接口文件和目标文件打包在一起，使用者不需要这些模块的源码就可以编译和链接。
+// 包以根模块命名，包含根模块及其所有子模块，如 json.kupkg 包含 json、json.parse 等模块。
+//
+// 包是一个zip文件：
+//
+//	KUPKG.json        清单，见 Manifest
+//	kui/a/b.kui       模块 a.b 的接口文件
+//	obj/a/b.o         模块 a.b 的目标文件，扩展名与目标平台有关
+package kupkg
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/kui"
+)
+
+const (
+	manifestName = "KUPKG.json"
+
+	// Extension 模块包的扩展名
+	Extension = ".kupkg"
+)
+
+// Manifest 模块包的清单
+type Manifest struct {
+	Name      string            `json:"name"`                // 包名，即根模块的名字
+	Version   string            `json:"version"`             // 包的语义化版本号
+	Compiler  string            `json:"compiler"`            // 编译这个包的编译器版本
+	Compilers string            `json:"compilers,omitempty"` // 可以使用这个包的编译器版本范围，为空时只能是Compiler
+	Target    string            `json:"target"`              // 目标文件的目标三元组
+	Requires  map[string]string `json:"requires,omitempty"`  // 依赖的其他模块包及其版本范围
+	Modules   []Module          `json:"modules"`
+
+	Features        []string `json:"features,omitempty"`         // 模块清单中声明的特性
+	EnabledFeatures []string `json:"enabled-features,omitempty"` // 打包时启用的特性
+
+}
+
+// Module 包中的一个模块
+type Module struct {
+	Name      string `json:"name"`      // 模块名，如 a.b
+	Interface string `json:"interface"` // 接口文件在包中的路径
+	Object    string `json:"object"`    // 目标文件在包中的路径
+}
+
+// Module 返回名为name的模块，不存在时返回nil
+func (v *Manifest) Module(name string) *Module {
+	for i := range v.Modules {
+		if v.Modules[i].Name == name {
+			return &v.Modules[i]
+		}
+	}
+	return nil
+}
+
+// Writer 逐个模块写入模块包
+type Writer struct {
+	manifest Manifest
+	zw       *zip.Writer
+}
+
+// NewWriter 创建向w写入的模块包，manifest中的Modules由AddModule填写
+func NewWriter(w io.Writer, manifest Manifest) *Writer {
+	manifest.Modules = nil
+	return &Writer{manifest: manifest, zw: zip.NewWriter(w)}
+}
+
+// AddModule 写入一个模块的接口和目标文件objPath
+func (v *Writer) AddModule(iface *kui.Interface, objPath string) error {
+	modpath := path.Join(strings.Split(iface.Module, ".")...)
+	mod := Module{
+		Name:      iface.Module,
+		Interface: path.Join("kui", modpath+kui.Extension),
+		Object:    path.Join("obj", modpath+filepath.Ext(objPath)),
+	}
+
+	w, err := v.zw.Create(mod.Interface)
+	if err != nil {
+		return err
+	}
+	if err := iface.Write(w); err != nil {
+		return err
+	}
+
+	w, err = v.zw.Create(mod.Object)
+	if err != nil {
+		return err
+	}
+	obj, err := os.Open(objPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, obj)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	v.manifest.Modules = append(v.manifest.Modules, mod)
+	return nil
+}
+
+// Close 写入清单，结束模块包
+func (v *Writer) Close() error {
+	w, err := v.zw.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(&v.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return v.zw.Close()
+}
+
+// Package 打开的模块包
+type Package struct {
+	Path     string
+	Manifest Manifest
+
+	zr *zip.ReadCloser
+}
+
+// Open 打开模块包并读入清单
+func Open(filename string) (*Package, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	res := &Package{Path: filename, zr: zr}
+
+	rc, err := res.open(manifestName)
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	err = json.NewDecoder(rc).Decode(&res.Manifest)
+	rc.Close()
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("invalid package manifest: %s", err)
+	}
+
+	return res, nil
+}
+
+// Close 关闭模块包
+func (v *Package) Close() error {
+	return v.zr.Close()
+}
+
+// ReadInterface 读入模块mod的接口
+func (v *Package) ReadInterface(mod *Module) (*kui.Interface, error) {
+	rc, err := v.open(mod.Interface)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return kui.Read(rc)
+}
+
+// ExtractObject 把模块mod的目标文件解压到目录dir中，文件以模块名命名，返回解压后的路径
+func (v *Package) ExtractObject(mod *Module, dir string) (string, error) {
+	rc, err := v.open(mod.Object)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	filename := filepath.Join(dir, mod.Name+path.Ext(mod.Object))
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, rc)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return filename, err
+}
+
+func (v *Package) open(name string) (io.ReadCloser, error) {
+	for _, file := range v.zr.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("`%s` not found in package", name)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+)
+
+// ku analyze --layout T：输出结构体类型在目标平台（--target）上的布局，
+// 即每个成员的偏移、大小和对齐，以及成员之间和结尾的填充。
+// 编译器默认可以重排成员以减少填充，参见codegen/LLVMCodegen/layout.go；
+// 与C共享的结构体应该标注 [layout(c)]，按声明的顺序排列。
+// T可以是类型名，或者用模块名限定的 模块名.T
+
+// reportLayout 输出结构体类型name的布局
+func (v *Context) reportLayout(name string) {
+	var module *ast.Module
+	var decl *ast.TypeDecl
+	runPhase("layout analysis", func() {
+		module, decl = v.findStructDecl(name)
+	})
+
+	st := decl.NamedType.Type.ActualType().(ast.StructType)
+	if len(st.GenericParameters) > 0 {
+		setupErr("Struct type `%s` is generic, its layout depends on the type arguments", name)
+	}
+
+	layout := (&LLVMCodegen.Codegen{Target: v.Target}).LayoutOf(&ast.TypeReference{BaseType: decl.NamedType})
+
+	fmt.Printf("%s %s.%s: size %d, align %d\n", st.Keyword(), module.Name.String(), decl.NamedType.Name, layout.Size, layout.Align)
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "OFFSET\tSIZE\tALIGN\tFIELD")
+	var end uint64
+	for _, field := range layout.Fields {
+		if field.Offset > end {
+			fmt.Fprintf(out, "%d\t%d\t\t(padding)\n", end, field.Offset-end)
+		}
+		fmt.Fprintf(out, "%d\t%d\t%d\t%s %s\n", field.Offset, field.Size, field.Align, field.Name, field.Type.String())
+		// 联合体的成员互相重叠
+		if field.Offset+field.Size > end {
+			end = field.Offset + field.Size
+		}
+	}
+	if layout.Size > end {
+		fmt.Fprintf(out, "%d\t%d\t\t(padding)\n", end, layout.Size-end)
+	}
+	out.Flush()
+
+	if layout.Reordered {
+		fmt.Println("\nMembers were reordered to reduce padding, add [layout(c)] to keep the declaration order")
+	}
+}
+
+// findStructDecl 在所有模块中查找结构体类型的声明。name没有用模块名限定时，必须只有一个模块中有这个类型
+func (v *Context) findStructDecl(name string) (*ast.Module, *ast.TypeDecl) {
+	moduleName, typeName := "", name
+	if idx := strings.LastIndex(name, "."); idx != -1 {
+		moduleName, typeName = name[:idx], name[idx+1:]
+	}
+
+	var modules []*ast.Module
+	var decls []*ast.TypeDecl
+	for _, module := range v.modules {
+		if moduleName != "" && module.Name.String() != moduleName {
+			continue
+		}
+
+		for _, submod := range module.Parts {
+			for _, node := range submod.Nodes {
+				decl, ok := node.(*ast.TypeDecl)
+				if !ok || decl.NamedType.Name != typeName {
+					continue
+				}
+				if _, ok := decl.NamedType.Type.ActualType().(ast.StructType); ok {
+					modules = append(modules, module)
+					decls = append(decls, decl)
+				}
+			}
+		}
+	}
+
+	switch len(decls) {
+	case 0:
+		setupErr("No struct type `%s` found", name)
+	case 1:
+	default:
+		var names []string
+		for _, module := range modules {
+			names = append(names, "`"+module.Name.String()+"."+typeName+"`")
+		}
+		setupErr("Struct type `%s` is ambiguous, qualify it with its module: %s", name, strings.Join(names, ", "))
+	}
+	return modules[0], decls[0]
+}
@@ -4,7 +4,6 @@ package lexer
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"unicode"
 
@@ -23,12 +22,12 @@ type lexer struct {
 
 // errPos 输出错误信息，打印错误位置，并退出程序
 func (v *lexer) errPos(pos Position, err string, stuff ...interface{}) {
-	log.Errorln("lexer", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
+	log.Errorln(log.TagLexer, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
 		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(err, stuff...))
 
-	log.Error("lexer", v.input.MarkPos(pos))
+	log.Error(log.TagLexer, v.input.MarkPos(pos))
 
-	os.Exit(1)
+	util.ExitFunc(1)
 }
 
 // err errPos的语法糖
@@ -90,12 +89,22 @@ func (v *lexer) pushToken(t TokenType) {
 	v.input.Tokens = append(v.input.Tokens, tok)
 
 	// 输出当前token。在Debug模式下，可以通过这个输出看到词法分析器获取的所有token列表。
-	log.Debug("lexer", "[%4d:%4d:% 11s] `%s`\n", v.startPos, v.endPos, tok.Type, tok.Contents)
+	log.Debug(log.TagLexer, "[%4d:%4d:% 11s] `%s`\n", v.startPos, v.endPos, tok.Type, tok.Contents)
 
 	// 清空缓存，以便继续分析
 	v.discardBuffer()
 }
 
+// pushComment 把刚分析完的普通注释加入到Comments列表中
+func (v *lexer) pushComment() {
+	v.input.Comments = append(v.input.Comments, &Token{
+		Type:     Comment,
+		Contents: string(v.input.Contents[v.startPos:v.endPos]),
+		Where:    NewSpan(v.tokStart, v.curPos),
+	})
+	v.discardBuffer()
+}
+
 // Lex 词法分析的主函数。对input源文件进行词法分析，并返回一个Token数组
 func Lex(input *Sourcefile) []*Token {
 	// 创建一个词法分析器实例，具体参数的作用，参见lexer类型的声明注释
@@ -203,8 +212,8 @@ func (v *lexer) skipBlockComment() bool {
 
 	if isDoc { // 如果是文档注释，仍然返回一个类型为Doccomment的Token
 		v.pushToken(Doccomment)
-	} else { // 其他注释则直接跳过
-		v.discardBuffer()
+	} else { // 其他注释不是词号，单独记录下来
+		v.pushComment()
 	}
 	return true
 }
@@ -228,7 +237,7 @@ func (v *lexer) skipLineComment() bool {
 			if isDoc {
 				v.pushToken(Doccomment)
 			} else {
-				v.discardBuffer()
+				v.pushComment()
 			}
 			v.consume()
 			return true
@@ -259,6 +268,11 @@ func (v *lexer) skipLayoutAndComments() {
 }
 
 func (v *lexer) lexNumberWithValidator(validator func(rune) bool) {
+	v.consumeNumber(validator)
+	v.pushToken(Number)
+}
+
+func (v *lexer) consumeNumber(validator func(rune) bool) {
 	for {
 		if validator(v.peek(0)) || v.peek(0) == '_' {
 			v.consume()
@@ -268,12 +282,44 @@ func (v *lexer) lexNumberWithValidator(validator func(rune) bool) {
 				v.consume()
 			}
 		} else {
-			v.pushToken(Number)
 			return
 		}
 	}
 }
 
+// DurationUnits 时长字面量的单位及其纳秒数，如 10ms、2s、1.5h
+var DurationUnits = map[string]int64{
+	"ns": 1,
+	"us": 1000,
+	"ms": 1000 * 1000,
+	"s":  1000 * 1000 * 1000,
+	"m":  60 * 1000 * 1000 * 1000,
+	"h":  60 * 60 * 1000 * 1000 * 1000,
+}
+
+// consumeDurationUnit 十进制数字之后紧跟的时长单位属于数字符号，如 10ms。
+// 单位之后不能再有字母、数字或下划线，否则仍然是数字之后的标识符
+func (v *lexer) consumeDurationUnit() {
+	n := 0
+	for isLetter(v.peek(n)) {
+		n++
+	}
+	if n == 0 || isDecimalDigit(v.peek(n)) || v.peek(n) == '_' {
+		return
+	}
+
+	unit := make([]rune, n)
+	for i := range unit {
+		unit[i] = v.peek(i)
+	}
+	if _, ok := DurationUnits[string(unit)]; !ok {
+		return
+	}
+	for i := 0; i < n; i++ {
+		v.consume()
+	}
+}
+
 // recognizeNumberToken 识别数字符号
 // 喾语言支持的数字符号包括：
 // 1. 十六进制（Hexadecimal）：0x12AF 0X334B
@@ -283,6 +329,7 @@ func (v *lexer) lexNumberWithValidator(validator func(rune) bool) {
 // 5. 32位浮点数（float/f32）：1234.56f
 // 6. 64位浮点数（double/f64）：1234.56d
 // 7. 128位浮点数（f128）：1234.56q
+// 8. 时长（Duration）：10ms 2s 1.5h，单位见 DurationUnits
 func (v *lexer) recognizeNumberToken() {
 	// 由于调用该函数前已经判断了 isDecimalDigit，因此可以先消耗掉第一个数字字符
 	v.consume()
@@ -305,13 +352,15 @@ func (v *lexer) recognizeNumberToken() {
 		v.lexNumberWithValidator(isOctalDigit)
 	} else { // 如果第二个字符也是数字，则该数字是十进制或浮点数
 		// Decimal or floating
-		v.lexNumberWithValidator(func(r rune) bool {
+		v.consumeNumber(func(r rune) bool {
 			if isDecimalDigit(r) || r == '.' {
 				return true
 			}
 			peek := unicode.ToLower(r)
 			return peek == 'f' || peek == 'd' || peek == 'q'
 		})
+		v.consumeDurationUnit()
+		v.pushToken(Number)
 	}
 }
 
@@ -392,8 +441,15 @@ func (v *lexer) recognizeOperatorToken() {
 	if strings.ContainsRune("=!><", v.peek(0)) && v.peek(1) == '=' { // 双字符操作符：==, !=, >=, <=
 		v.consume()
 		v.consume()
-	} else if v.peek(0) == '>' && v.peek(1) == '>' { // 连续两个 >>，是不同的操作符。用于支持嵌套泛型
+	} else if v.peek(0) == '>' && v.peek(1) == '>' { // 连续两个 >>，拆分为两个单独的 >。用于支持嵌套泛型
+		// 由语法分析器根据上下文判断是嵌套泛型的闭合，还是右移操作符
 		v.consume()
+
+		// >>= 也要拆开：否则第二个 > 会和 = 组合成 >=
+		if v.peek(1) == '=' {
+			v.pushToken(Operator)
+			v.consume()
+		}
 	} else { // 两个连续的操作符识别为混合操作符。TODO：why？
 		v.consume()
 		// never consume @, ^ or = into an mixed/combined operator
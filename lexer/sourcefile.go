@@ -3,7 +3,7 @@ package lexer
 import (
 	"bytes"
 	"io/ioutil"
-	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/ku-lang/ku/util"
@@ -16,19 +16,16 @@ type Sourcefile struct {
 	Contents []rune   // 文件内容
 	NewLines []int    // 换行符列表
 	Tokens   []*Token // 所有的词法符号
+	Comments []*Token // 普通注释。语法分析不需要它们，ku fmt 用来保留注释
 }
 
 // NewSourcfile 根据文件路径，获取文件名，读入文件内容，并返回一个新的“源文件”对象
-func NewSourcefile(filepath string) (*Sourcefile, error) {
-	// TODO, get this to handle the rare //file//shit
-	// cut out the filename from path
-	// + 1 to cut out the slash.
-	i, j := strings.LastIndex(filepath, "/")+1, strings.LastIndex(filepath, path.Ext(filepath))
+func NewSourcefile(sourcePath string) (*Sourcefile, error) {
+	// 文件名不包含目录和扩展名。目录分隔符按照当前系统处理，Windows上 / 和 \ 都可以
+	base := filepath.Base(sourcePath)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
 
-	// this is the name of the file, not the path
-	name := filepath[i:j]
-
-	sf := &Sourcefile{Name: name, Path: filepath}
+	sf := &Sourcefile{Name: name, Path: sourcePath}
 	sf.NewLines = append(sf.NewLines, -1)
 	sf.NewLines = append(sf.NewLines, -1)
 
@@ -46,6 +43,16 @@ func (s *Sourcefile) GetLine(line int) string {
 	return string(s.Contents[s.NewLines[line]+1 : s.NewLines[line+1]])
 }
 
+// Offset 位置pos在文件内容中的下标
+func (s *Sourcefile) Offset(pos Position) int {
+	return s.NewLines[pos.Line] + pos.Char
+}
+
+// SpanContents 获取span对应的源码
+func (s *Sourcefile) SpanContents(span Span) string {
+	return string(s.Contents[s.Offset(span.Start()):s.Offset(span.End())])
+}
+
 // 默认的Tab宽度，用于错误输出
 const TabWidth = 4
 
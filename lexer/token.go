@@ -12,9 +12,10 @@ const (
 	Erroneous                   // 错误的词法类型
 	String                      // 字符串
 	Doccomment                  // 文档注释
+	Comment                     // 普通注释，不在词号列表中，见 Sourcefile.Comments
 )
 
-var tokenStrings = []string{"rune", "identifier", "separator", "operator", "number", "erroneous", "string", "doccomment"}
+var tokenStrings = []string{"rune", "identifier", "separator", "operator", "number", "erroneous", "string", "doccomment", "comment"}
 
 // 打印TokenType实例对应的名称
 func (v TokenType) String() string {
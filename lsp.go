@@ -0,0 +1,813 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/kuast"
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/semantic"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 语言服务器（ku lsp）
+//
+// 通过标准输入输出与编辑器通信，消息是带 Content-Length 头的JSON-RPC（Language Server Protocol）。支持：
+//
+//	诊断        打开、修改和保存文件之后分析文件所在的模块，发布错误和警告（textDocument/publishDiagnostics）
+//	跳转到定义  变量、函数、方法和类型的声明（textDocument/definition）
+//	悬停        变量和成员的类型、函数的签名（textDocument/hover）
+//
+// 每次分析建立新的编译环境，进行到语义分析为止；编辑器中的文件内容代替磁盘上的文件（Context.Overlay）。
+// 文件所在的目录在某个搜索路径之下时分析这个模块，否则只分析这个文件。没有给出搜索路径时使用编辑器打开的目录。
+//
+// 编译出错时不能退出，分析在 catchErrorExit 中进行。日志不输出到标准输出，而是收集起来，
+// 从中解析出错误的位置和消息。分析出错之前已经得到的语法树仍然用于跳转和悬停。
+// 这次分析得不到名字的类型时（如依赖的模块出错），悬停使用 build --emit-typed-ast 写入的带类型的语法树，
+// 只在缓存没有失效并且文档没有未保存的修改时使用，参见 cachedHover。
+
+// LSP的诊断级别
+const (
+	lspSeverityError   = 1
+	lspSeverityWarning = 2
+)
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	Position       lspPosition     `json:"position"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// lspDocument 编辑器中打开的文件
+type lspDocument struct {
+	uri   string
+	path  string // 绝对路径
+	text  string
+	lines []string
+
+	analysis *lspAnalysis
+}
+
+// lspAnalysis 一次分析的结果
+type lspAnalysis struct {
+	submod *ast.Submodule               // 文档对应的子模块，构建语法树之前出错时为nil
+	decls  map[interface{}]*lspDecl     // *ast.Variable、*ast.Function、*ast.NamedType -> 声明
+	files  map[*lexer.Sourcefile]string // 声明所在的源文件 -> 绝对路径
+}
+
+// lspDecl 声明的名字和位置
+type lspDecl struct {
+	name string
+	pos  lexer.Position
+	file *lexer.Sourcefile
+}
+
+type lspServer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	searchpaths []string
+	features    []string
+
+	docs     map[string]*lspDocument // URI -> 文档
+	logs     bytes.Buffer            // 分析时收集的日志
+	shutdown bool
+}
+
+// serveLSP 运行语言服务器，直到编辑器发出exit通知，返回退出码
+func serveLSP(searchpaths, features []string) int {
+	v := &lspServer{
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		features: features,
+		docs:     make(map[string]*lspDocument),
+	}
+	for _, path := range searchpaths {
+		if abs, err := filepath.Abs(path); err == nil {
+			v.searchpaths = append(v.searchpaths, abs)
+		}
+	}
+
+	log.SetOutput(&v.logs)
+
+	for {
+		msg, err := v.read()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "ku lsp: %s\n", err)
+			}
+			return 1
+		}
+
+		if msg.Method == "exit" {
+			if v.shutdown {
+				return 0
+			}
+			return 1
+		}
+		v.handle(msg)
+	}
+}
+
+func (v *lspServer) read() (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := v.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if idx := strings.Index(line, ":"); idx > 0 && strings.EqualFold(line[:idx], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[idx+1:])); err != nil {
+				return nil, fmt.Errorf("invalid header `%s`", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(v.in, body); err != nil {
+		return nil, err
+	}
+	msg := &lspMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (v *lspServer) write(msg interface{}) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(v.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (v *lspServer) reply(id *json.RawMessage, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	v.write(&lspResponse{JSONRPC: "2.0", ID: id, Result: data})
+}
+
+func (v *lspServer) replyError(id *json.RawMessage, code int, msg string) {
+	v.write(&lspResponse{JSONRPC: "2.0", ID: id, Error: &lspError{Code: code, Message: msg}})
+}
+
+func (v *lspServer) notify(method string, params interface{}) {
+	v.write(&lspNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (v *lspServer) handle(msg *lspMessage) {
+	params := &lspDocumentParams{}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, params); err != nil && msg.ID != nil {
+			v.replyError(msg.ID, -32602, err.Error())
+			return
+		}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		v.initialize(msg.Params)
+		v.reply(msg.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    1, // 每次修改发送整个文件
+					"save":      true,
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "ku", "version": VERSION},
+		})
+
+	case "shutdown":
+		v.shutdown = true
+		v.reply(msg.ID, nil)
+
+	case "textDocument/didOpen":
+		v.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			v.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+
+	case "textDocument/didSave":
+		if doc := v.docs[params.TextDocument.URI]; doc != nil {
+			v.update(doc.uri, doc.text)
+		}
+
+	case "textDocument/didClose":
+		delete(v.docs, params.TextDocument.URI)
+		v.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []lspDiagnostic{},
+		})
+
+	case "textDocument/definition":
+		v.reply(msg.ID, v.definition(params.TextDocument.URI, params.Position))
+
+	case "textDocument/hover":
+		v.reply(msg.ID, v.hover(params.TextDocument.URI, params.Position))
+
+	default:
+		// 不支持的通知直接忽略
+		if msg.ID != nil {
+			v.replyError(msg.ID, -32601, "Method not supported: "+msg.Method)
+		}
+	}
+}
+
+// initialize 没有给出搜索路径时，编辑器打开的目录作为搜索路径
+func (v *lspServer) initialize(raw json.RawMessage) {
+	var params struct {
+		RootURI  string `json:"rootUri"`
+		RootPath string `json:"rootPath"`
+	}
+	json.Unmarshal(raw, &params)
+	if len(v.searchpaths) > 0 {
+		return
+	}
+
+	root := params.RootPath
+	if params.RootURI != "" {
+		root = uriToPath(params.RootURI)
+	}
+	if root != "" {
+		v.searchpaths = append(v.searchpaths, root)
+	}
+}
+
+// update 文档的内容改变了，重新分析并发布诊断
+func (v *lspServer) update(uri, text string) {
+	doc := v.docs[uri]
+	if doc == nil {
+		doc = &lspDocument{uri: uri, path: uriToPath(uri)}
+		v.docs[uri] = doc
+	}
+	doc.text = text
+	doc.lines = strings.Split(text, "\n")
+
+	diags := v.analyze(doc)
+
+	// 同一个模块中打开的其他文件也得到它们的诊断
+	dir := filepath.Dir(doc.path)
+	for _, other := range v.docs {
+		if filepath.Dir(other.path) != dir {
+			continue
+		}
+		res := diags[other]
+		if res == nil {
+			res = []lspDiagnostic{}
+		}
+		v.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         other.uri,
+			"diagnostics": res,
+		})
+	}
+}
+
+// analyze 分析文档所在的模块，返回每个打开的文档的诊断
+func (v *lspServer) analyze(doc *lspDocument) map[*lspDocument][]lspDiagnostic {
+	context := NewContext()
+	context.Searchpaths = append([]string{}, v.searchpaths...)
+	context.Features = v.features
+	context.SkipHooks = true
+	context.Inputs = []string{v.moduleInput(doc.path)}
+	context.Overlay = make(map[string]string)
+	for _, other := range v.docs {
+		context.Overlay[other.path] = other.text
+	}
+
+	v.logs.Reset()
+	readSources = nil
+	var runtimeModule *ast.Module
+	catchErrorExit(func() {
+		runPhase("runtime loading", func() {
+			runtimeModule = LoadRuntime()
+		})
+		context.parseFiles()
+		runPhase("resolve phase", func() {
+			for _, module := range context.modules {
+				ast.Resolve(module, context.moduleLookup)
+			}
+		})
+		runPhase("inference phase", func() {
+			for _, module := range context.modules {
+				for _, submod := range module.Parts {
+					ast.Infer(submod)
+				}
+			}
+		})
+		runPhase("semantic analysis phase", func() {
+			for _, module := range context.modules {
+				if !module.Interface {
+					semantic.SemCheck(module, false)
+				}
+			}
+		})
+	})
+
+	modules := context.modules
+	if runtimeModule != nil {
+		modules = append(modules, runtimeModule)
+	}
+	doc.analysis = newLSPAnalysis(modules, doc.path)
+	return v.diagnostics(doc)
+}
+
+// moduleInput 文件所在的目录在某个搜索路径之下时是这个目录对应的模块，否则是文件本身
+func (v *lspServer) moduleInput(path string) string {
+	dir := filepath.Dir(path)
+	for _, searchpath := range v.searchpaths {
+		rel, err := filepath.Rel(searchpath, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return strings.Replace(filepath.ToSlash(rel), "/", ".", -1)
+	}
+	return path
+}
+
+var lspLogPattern = regexp.MustCompile(`^(error|warning|note):?\s*(?:\[([^\[\]]*):(\d+):(\d+)\])?\s*(.*)$`)
+
+// diagnostics 从分析时的日志中解析出错误和警告。note补充前一个错误；
+// 文件名与打开的文档都不同的错误，以及没有位置的错误，报告在分析的文档的开头
+func (v *lspServer) diagnostics(doc *lspDocument) map[*lspDocument][]lspDiagnostic {
+	res := make(map[*lspDocument][]lspDiagnostic)
+	var last *lspDiagnostic
+	for _, line := range strings.Split(util.StripColors(v.logs.String()), "\n") {
+		match := lspLogPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		kind, file, msg := match[1], match[2], match[5]
+
+		if kind == "note" {
+			if last != nil {
+				last.Message += "\nnote: " + msg
+			}
+			continue
+		}
+
+		target := doc
+		var rng lspRange
+		if file != "" {
+			lineNum, _ := strconv.Atoi(match[3])
+			char, _ := strconv.Atoi(match[4])
+			if other := v.documentNamed(file, filepath.Dir(doc.path)); other != nil {
+				target = other
+				rng = target.tokenRange(lineNum, char)
+			} else {
+				msg = fmt.Sprintf("[%s:%d:%d] %s", file, lineNum, char, msg)
+			}
+		}
+
+		severity := lspSeverityError
+		if kind == "warning" {
+			severity = lspSeverityWarning
+		}
+		res[target] = append(res[target], lspDiagnostic{Range: rng, Severity: severity, Source: "ku", Message: msg})
+		last = &res[target][len(res[target])-1]
+	}
+	return res
+}
+
+// documentNamed 目录dir中文件名（不含扩展名，与lexer.Position相同）为name的打开的文档
+func (v *lspServer) documentNamed(name, dir string) *lspDocument {
+	for _, doc := range v.docs {
+		base := filepath.Base(doc.path)
+		if filepath.Dir(doc.path) == dir && strings.TrimSuffix(base, filepath.Ext(base)) == name {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (v *lspServer) definition(uri string, pos lspPosition) interface{} {
+	doc := v.docs[uri]
+	if doc == nil || doc.analysis == nil {
+		return nil
+	}
+	target, _ := doc.analysis.lookup(doc.sourcePosition(pos))
+	decl := doc.analysis.decls[target]
+	if decl == nil {
+		return nil
+	}
+
+	path := doc.analysis.files[decl.file]
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	tok := decl.nameToken()
+	start, end := decl.pos, decl.pos
+	if tok != nil {
+		start, end = tok.Where.Start(), tok.Where.End()
+	}
+	return &lspLocation{
+		URI: pathToURI(path),
+		Range: lspRange{
+			Start: sourcefilePosition(decl.file, start),
+			End:   sourcefilePosition(decl.file, end),
+		},
+	}
+}
+
+func (v *lspServer) hover(uri string, pos lspPosition) interface{} {
+	doc := v.docs[uri]
+	if doc == nil || doc.analysis == nil {
+		return nil
+	}
+	target, tok := doc.analysis.lookup(doc.sourcePosition(pos))
+
+	var text string
+	switch target := target.(type) {
+	case *ast.Variable:
+		keyword := "let"
+		if target.Mutable {
+			keyword = "var"
+		}
+		text = keyword + " " + target.Name
+		if target.Type != nil {
+			text += " " + target.Type.String()
+		}
+	case *ast.Function:
+		text = "fun " + functionLabel(target) + strings.TrimPrefix(ast.OverloadSignature(target), target.Name)
+	case *ast.NamedType:
+		text = "type " + target.Name
+		if target.Type != nil {
+			text += " " + target.Type.TypeName()
+		}
+	case *ast.TypeReference:
+		text = tok.Contents + " " + target.String()
+	default:
+		if text = v.cachedHover(doc, tok); text == "" {
+			return nil
+		}
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": "```ku\n" + util.StripColors(text) + "\n```",
+		},
+		"range": lspRange{
+			Start: doc.lspPosition(tok.Where.StartLine, tok.Where.StartChar),
+			End:   doc.lspPosition(tok.Where.EndLine, tok.Where.EndChar),
+		},
+	}
+}
+
+// cachedHover 从文档所在模块的带类型的语法树中找出名字tok所在的表达式的类型，没有时返回空串。
+// 文档与磁盘上的文件相同时，缓存中的位置才与文档一致
+func (v *lspServer) cachedHover(doc *lspDocument, tok *lexer.Token) string {
+	if tok == nil || doc.analysis.submod == nil {
+		return ""
+	}
+	if contents, err := ioutil.ReadFile(doc.path); err != nil || string(contents) != doc.text {
+		return ""
+	}
+
+	submod := doc.analysis.submod
+	path := filepath.Join(buildDirName, "cache", submod.Parent.Name.ToPath()+kuast.Extension)
+	file, err := kuast.Load(path)
+	if err != nil {
+		return ""
+	}
+	expr := file.ExprAt(submod.File.Name, tok.Where.StartLine, tok.Where.StartChar)
+	if expr == nil || expr.Type == kuast.NoType {
+		return ""
+	}
+	return tok.Contents + " " + file.TypeString(expr.Type)
+}
+
+// newLSPAnalysis 记录分析得到的所有声明，找出路径为path的文档对应的子模块
+func newLSPAnalysis(modules []*ast.Module, path string) *lspAnalysis {
+	res := &lspAnalysis{
+		decls: make(map[interface{}]*lspDecl),
+		files: make(map[*lexer.Sourcefile]string),
+	}
+
+	for _, module := range modules {
+		for _, submod := range module.Parts {
+			file := submod.File.Path
+			if module.IsRuntime() {
+				file = findRuntimePath()
+			}
+			if abs, err := filepath.Abs(file); err == nil {
+				file = abs
+			}
+			res.files[submod.File] = file
+			if file == path {
+				res.submod = submod
+			}
+
+			ast.NewASTVisitor(&lspDeclCollector{analysis: res, file: submod.File}).VisitSubmodule(submod)
+		}
+	}
+	return res
+}
+
+// lookup 位置pos（行和字符从1开始）上的名字所指的变量、函数或类型，以及这个名字。
+// 成员访问返回成员的类型，没有找到时返回nil
+func (v *lspAnalysis) lookup(pos lexer.Position) (interface{}, *lexer.Token) {
+	if v.submod == nil {
+		return nil, nil
+	}
+
+	tokens := v.submod.File.Tokens
+	idx := -1
+	for i, tok := range tokens {
+		if tok.Type == lexer.Identifier && tok.Where.StartLine == pos.Line &&
+			tok.Where.StartChar <= pos.Char && pos.Char <= tok.Where.EndChar {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, nil
+	}
+	tok := tokens[idx]
+	member := idx > 0 && tokens[idx-1].Contents == "."
+
+	finder := &lspNodeFinder{tok: tok, member: member}
+	ast.NewASTVisitor(finder).VisitSubmodule(v.submod)
+	if finder.target != nil {
+		return finder.target, tok
+	}
+
+	// 类型名
+	if ident := v.submod.FileScope.GetIdent(ast.UnresolvedName{Name: tok.Contents}); !member && ident != nil && ident.Type == ast.IDENT_TYPE {
+		if nt, ok := ident.Value.(*ast.NamedType); ok {
+			return nt, tok
+		}
+	}
+	return nil, tok
+}
+
+// lspDeclCollector 记录一个子模块中的声明
+type lspDeclCollector struct {
+	analysis *lspAnalysis
+	file     *lexer.Sourcefile
+}
+
+func (v *lspDeclCollector) EnterScope()           {}
+func (v *lspDeclCollector) ExitScope()            {}
+func (v *lspDeclCollector) PostVisit(n *ast.Node) {}
+
+func (v *lspDeclCollector) Visit(n *ast.Node) bool {
+	switch n := (*n).(type) {
+	case *ast.FunctionDecl:
+		v.add(n.Function, n.Function.Name, n.Pos())
+	case *ast.VariableDecl:
+		v.add(n.Variable, n.Variable.Name, n.Pos())
+	case *ast.DestructVarDecl:
+		for _, vari := range n.Variables {
+			v.add(vari, vari.Name, n.Pos())
+		}
+	case *ast.TypeDecl:
+		v.add(n.NamedType, n.NamedType.Name, n.Pos())
+	}
+	return true
+}
+
+func (v *lspDeclCollector) add(key interface{}, name string, pos lexer.Position) {
+	if _, ok := v.analysis.decls[key]; !ok && pos.Line > 0 {
+		v.analysis.decls[key] = &lspDecl{name: name, pos: pos, file: v.file}
+	}
+}
+
+// nameToken 声明中的名字：声明的位置之后第一个内容是名字的标识符
+func (v *lspDecl) nameToken() *lexer.Token {
+	for _, tok := range v.file.Tokens {
+		start := tok.Where.Start()
+		if start.Line < v.pos.Line || (start.Line == v.pos.Line && start.Char < v.pos.Char) {
+			continue
+		}
+		if start.Line > v.pos.Line+1 {
+			break
+		}
+		if tok.Type == lexer.Identifier && tok.Contents == v.name {
+			return tok
+		}
+	}
+	return nil
+}
+
+// lspNodeFinder 找出名字tok对应的节点。成员和方法访问的位置是被访问的表达式的开始，
+// 取名字之前、最靠近名字的访问
+type lspNodeFinder struct {
+	tok    *lexer.Token
+	member bool
+
+	target  interface{}
+	nearest lexer.Position
+}
+
+func (v *lspNodeFinder) EnterScope()           {}
+func (v *lspNodeFinder) ExitScope()            {}
+func (v *lspNodeFinder) PostVisit(n *ast.Node) {}
+
+func (v *lspNodeFinder) Visit(n *ast.Node) bool {
+	pos := (*n).Pos()
+	at := pos.Line == v.tok.Where.StartLine && pos.Char == v.tok.Where.StartChar
+	name := v.tok.Contents
+
+	switch n := (*n).(type) {
+	case *ast.VariableAccessExpr:
+		if at && !v.member && n.Variable != nil {
+			v.target = n.Variable
+		}
+	case *ast.VariableDecl:
+		if at && n.Variable.Name == name {
+			v.target = n.Variable
+		}
+	case *ast.FunctionAccessExpr:
+		if n.Function == nil || n.Function.Name != name {
+			break
+		}
+		if !v.member && at {
+			v.target = n.Function
+		} else if v.member && n.ReceiverAccess != nil {
+			v.nearer(pos, n.Function)
+		}
+	case *ast.StructAccessExpr:
+		if v.member && n.Member == name && n.GetType() != nil {
+			v.nearer(pos, n.GetType())
+		}
+	case *ast.FunctionDecl:
+		if n.Function.Name == name && pos.Line == v.tok.Where.StartLine && pos.Char < v.tok.Where.StartChar {
+			v.target = n.Function
+		}
+	case *ast.TypeDecl:
+		if n.NamedType.Name == name && pos.Line == v.tok.Where.StartLine && pos.Char < v.tok.Where.StartChar {
+			v.target = n.NamedType
+		}
+	}
+	return true
+}
+
+// nearer 在名字之前、比已经找到的更靠近名字的访问
+func (v *lspNodeFinder) nearer(pos lexer.Position, target interface{}) {
+	tok := v.tok.Where.Start()
+	if pos.Line > tok.Line || (pos.Line == tok.Line && pos.Char >= tok.Char) {
+		return
+	}
+	if v.target == nil || pos.Line > v.nearest.Line || (pos.Line == v.nearest.Line && pos.Char > v.nearest.Char) {
+		v.target = target
+		v.nearest = pos
+	}
+}
+
+// sourcePosition LSP的位置（从0开始，字符按UTF-16计）转换为源码中的位置（从1开始，字符按rune计）
+func (v *lspDocument) sourcePosition(pos lspPosition) lexer.Position {
+	res := lexer.Position{Line: pos.Line + 1, Char: 1}
+	if pos.Line < 0 || pos.Line >= len(v.lines) {
+		return res
+	}
+	units := 0
+	for _, r := range v.lines[pos.Line] {
+		if units >= pos.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		res.Char++
+	}
+	return res
+}
+
+// lspPosition 源码中的位置转换为LSP的位置
+func (v *lspDocument) lspPosition(line, char int) lspPosition {
+	return lspPositionInLines(v.lines, line, char)
+}
+
+// tokenRange 从源码中的位置开始的词法符号的范围，没有找到时是一个字符
+func (v *lspDocument) tokenRange(line, char int) lspRange {
+	if v.analysis != nil && v.analysis.submod != nil && v.analysis.files[v.analysis.submod.File] == v.path {
+		for _, tok := range v.analysis.submod.File.Tokens {
+			if tok.Where.StartLine == line && tok.Where.StartChar == char {
+				return lspRange{Start: v.lspPosition(line, char), End: v.lspPosition(tok.Where.EndLine, tok.Where.EndChar)}
+			}
+		}
+	}
+	return lspRange{Start: v.lspPosition(line, char), End: v.lspPosition(line, char+1)}
+}
+
+func sourcefilePosition(sf *lexer.Sourcefile, pos lexer.Position) lspPosition {
+	return lspPositionInLines(strings.Split(string(sf.Contents), "\n"), pos.Line, pos.Char)
+}
+
+func lspPositionInLines(lines []string, line, char int) lspPosition {
+	res := lspPosition{Line: line - 1}
+	if line < 1 || line > len(lines) {
+		if res.Line < 0 {
+			res.Line = 0
+		}
+		return res
+	}
+	for idx, r := range []rune(lines[line-1]) {
+		if idx >= char-1 {
+			break
+		}
+		res.Character += len(utf16.Encode([]rune{r}))
+	}
+	return res
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := filepath.FromSlash(u.Path)
+	// Windows上的 /C:/dir/file.ku
+	if len(path) > 2 && path[0] == filepath.Separator && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.Clean(path)
+}
+
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -14,7 +18,10 @@ import (
 	"github.com/ku-lang/ku/codegen"
 	"github.com/ku-lang/ku/codegen/LLVMCodegen"
 	"github.com/ku-lang/ku/doc"
+	"github.com/ku-lang/ku/kui"
+	"github.com/ku-lang/ku/kupkg"
 	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/mir"
 	"github.com/ku-lang/ku/parser"
 	"github.com/ku-lang/ku/semantic"
 	"github.com/ku-lang/ku/util"
@@ -36,6 +43,15 @@ func main() {
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 	log.SetLevel(*logLevel)
 	log.SetTags(*logTags)
+	log.SetFormat(*logFormat)
+
+	// 实验性的语言特性，参见ast/feature.go
+	for _, feature := range *enableFeatures {
+		if !ast.IsLanguageFeature(feature) {
+			setupErr("%s", ast.UnknownFeatureMessage(feature))
+		}
+	}
+	ast.EnabledFeatures = *enableFeatures
 
 	// 初始化编译环境
 	context := NewContext()
@@ -44,12 +60,29 @@ func main() {
 	switch command {
 	case buildCom.FullCommand(): // build命令；编译代码
 		// 下面这些变量均来自于args，从kingpin解析而来
-		if *buildInput == "" {
-			setupErr("No input files passed.")
-		}
-
 		context.Searchpaths = *buildSearchpaths
-		context.Input = *buildInput
+		context.Features = splitFeatures(*buildFeatures)
+		context.setExcludes(*buildExcludes)
+		context.Inputs = *buildInputs
+		if len(context.Inputs) == 0 {
+			context.Inputs = []string{context.useProject()}
+		}
+		context.Target = *buildTarget
+		context.PIC = *buildPIC
+		context.Static = *buildStatic
+		context.Strip = *buildStrip
+		context.EmitMIR = *buildEmitMIR
+		if *buildEmitInterface {
+			context.InterfaceDir = ensureBuildDir("kui")
+		}
+		if *buildEmitTypedAST {
+			context.TypedASTDir = ensureBuildDir("cache")
+		}
+		context.DumpAfter = *buildDumpAfter
+		context.DumpModules = *buildDumpModules
+		context.DumpLevel = *buildDumpLevel
+		setExplainTypes(*buildExplainTypes, *buildExplainAt)
+		ast.MaxErrors = *buildMaxErrors
 
 		outputType, err := codegen.ParseOutputType(*buildOutputType)
 		if err != nil {
@@ -57,31 +90,159 @@ func main() {
 			os.Exit(1)
 		}
 
+		// 默认输出到 .ku-build/bin，链接用的中间文件放在 .ku-build/obj。
+		// 用 -o 指定了输出文件时不创建构建目录，中间文件与输出文件放在一起
+		output := *buildOutput
+		if output == "" {
+			output = filepath.Join(ensureBuildDir("bin"), "main")
+			context.ObjDir = ensureBuildDir("obj")
+		}
+
 		// 主流程：编译代码文件
-		context.Build(*buildOutput, outputType, *buildCodegen, *buildOptLevel)
+		context.Build(output, outputType, *buildCodegen, *buildOptLevel)
 
 		printFinishedMessage(startTime, buildCom.FullCommand(), 1)
 
+	case runCom.FullCommand(): // run命令：编译并运行
+		context.Searchpaths = *runSearchpaths
+		context.Features = splitFeatures(*runFeatures)
+		context.setExcludes(*runExcludes)
+		context.Inputs = []string{*runInput}
+		if *runInput == "" {
+			context.Inputs = []string{context.useProject()}
+		}
+		setExplainTypes(*runExplainTypes, *runExplainAt)
+		ast.MaxErrors = *runMaxErrors
+
+		os.Exit(context.Run(*runOptLevel, *runArgs))
+
+	case testCom.FullCommand(): // test命令：编译并运行测试
+		context.Searchpaths = *testSearchpaths
+		context.Features = splitFeatures(*testFeatures)
+		context.setExcludes(*testExcludes)
+		context.Inputs = []string{*testInput}
+		if *testInput == "" {
+			context.Inputs = []string{context.useProject()}
+		}
+		ast.MaxErrors = *testMaxErrors
+
+		os.Exit(context.Test(*testOptLevel, *testRun))
+
+	case fmtCom.FullCommand(): // fmt命令：格式化源文件
+		os.Exit(formatFiles(*fmtPaths, *fmtWrite, *fmtCheck))
+
 	case docgenCom.FullCommand(): // docgen命令：生成文档
 		context.Searchpaths = *docgenSearchpaths
-		context.Input = *docgenInput
-		context.Docgen(*docgenDir)
+		if len(*docgenInputs) == 0 {
+			setupErr("No input files passed.")
+		}
+		context.Inputs = *docgenInputs
+		dir := *docgenDir
+		if dir == "" {
+			dir = ensureBuildDir("doc")
+		}
+		context.Docgen(dir, *docgenPrivate)
 
 		printFinishedMessage(startTime, docgenCom.FullCommand(), 1)
+
+	case packageCom.FullCommand(): // package命令：把模块编译成模块包
+		context.Searchpaths = *packageSearchpaths
+		context.Features = splitFeatures(*packageFeatures)
+		context.setExcludes(*packageExcludes)
+		context.Inputs = []string{*packageInput}
+		context.Target = *packageTarget
+
+		output := *packageOutput
+		if output == "" {
+			output = filepath.Join(ensureBuildDir("pkg"), *packageInput+kupkg.Extension)
+		}
+		compilers := *packageCompilers
+		if compilers == "" {
+			compilers = "^" + VERSION
+		}
+		context.Package(output, *packageVersion, compilers, *packageRequires, *packageOptLevel)
+
+		printFinishedMessage(startTime, packageCom.FullCommand(), 1)
+
+	case graphCom.FullCommand(): // graph命令：输出模块依赖图和调用图
+		context.Searchpaths = *graphSearchpaths
+		context.Features = splitFeatures(*graphFeatures)
+		context.Inputs = []string{*graphInput}
+
+		context.Graph(*graphOutput, *graphFormat, *graphCalls)
+
+	case analyzeCom.FullCommand(): // analyze命令：分析项目并输出报告
+		context.Searchpaths = *analyzeSearchpaths
+		context.Features = splitFeatures(*analyzeFeatures)
+		context.Inputs = []string{*analyzeInput}
+		context.Target = *analyzeTarget
+
+		context.Analyze(*analyzeDead, *analyzeSize, *analyzeLayout, *analyzeOptLevel, *analyzeTop)
+
+	case newCom.FullCommand(): // new命令：创建项目
+		newProject(*newName)
+
+	case initCom.FullCommand(): // init命令：把当前目录初始化为项目
+		name := *initName
+		if name == "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				setupErr("%s", err)
+			}
+			name = filepath.Base(cwd)
+		}
+		initProject(".", name)
+
+	case cleanCom.FullCommand(): // clean命令：删除构建输出目录
+		if err := cleanBuildDir(); err != nil {
+			setupErr("%s", err)
+		}
+
+	case reduceCom.FullCommand(): // reduce命令：最小化崩溃复现
+		output := *reduceOutput
+		if output == "" {
+			output = strings.TrimSuffix(*reduceInput, ".ku") + ".reduced.ku"
+		}
+		context.Reduce(*reduceInput, output, *reducePredicate, *reduceTimeout)
+
+	case lspCom.FullCommand(): // lsp命令：语言服务器
+		os.Exit(serveLSP(*lspSearchpaths, splitFeatures(*lspFeatures)))
+
+	case replCom.FullCommand(): // repl命令：交互式解释器
+		os.Exit(runREPL(*replSearchpaths, splitFeatures(*replFeatures)))
+
+	case abitestCom.FullCommand(): // abitest命令：比较ku与C的结构体布局
+		context.Target = *abitestTarget
+		context.ABITest(*abitestCount, *abitestSeed, *abitestInput, *abitestCC, *abitestKeep)
+
+	case completionsCom.FullCommand(): // completions命令：输出shell自动补全脚本
+		printCompletions(*completionsShell)
 	}
 }
 
 func printFinishedMessage(startTime time.Time, command string, numFiles int) {
 	dur := time.Since(startTime)
-	log.Info("main", "%s (%d file(s), %.2fms)\n",
+	log.Info(log.TagMain, "%s (%d file(s), %.2fms)\n",
 		util.TEXT_GREEN+util.TEXT_BOLD+fmt.Sprintf("Finished %s", command)+util.TEXT_RESET,
 		numFiles, float32(dur.Nanoseconds())/1000000)
 }
 
 func setupErr(err string, stuff ...interface{}) {
-	log.Error("main", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
+	log.Error(log.TagMain, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" %s\n",
 		fmt.Sprintf(err, stuff...))
-	os.Exit(util.EXIT_FAILURE_SETUP)
+	util.ExitFunc(util.EXIT_FAILURE_SETUP)
+}
+
+// setExplainTypes 设置类型推导的解释选项，参见ast/explain.go。给出位置时也解释推导错误
+func setExplainTypes(onError bool, at string) {
+	ast.ExplainTypes.OnError = onError || at != ""
+	if at != "" {
+		pos, err := ast.ParseExplainPosition(at)
+		if err != nil {
+			setupErr("%s", err)
+		}
+		ast.ExplainTypes.At = pos
+	}
 }
 
 // 类型：编译环境
@@ -89,21 +250,78 @@ type Context struct {
 	// 搜索路径：所有搜索路径之下的.ku文件都会进行编译
 	Searchpaths []string
 
-	// 输入文件：待编译的主文件。现在只支持一个文件（通常是main.ku）
-	Input string
+	// 输入：待编译的源文件（合并为 __main 模块，通常是main.ku）或者模块
+	Inputs []string
+
+	// 代码生成与链接选项：目标平台、位置无关代码、静态链接、去除符号
+	Target string
+	PIC    bool
+	Static bool
+	Strip  bool
+
+	// 输出每个模块的中层IR（MIR）
+	EmitMIR bool
+
+	// 模块接口文件（.kui）的输出目录，为空时不输出
+	InterfaceDir string
+
+	// 带类型的语法树（.kuast）的输出目录，为空时不输出，参见typedast.go
+	TypedASTDir string
+
+	// 链接用的中间目标文件所在的目录，为空时与输出文件放在一起
+	ObjDir string
+
+	// 编译模块包：不要求有main函数，参见package.go
+	Library bool
+
+	// ku test：同时编译输入模块的测试文件，并加入运行测试的main函数，参见test.go
+	Testing bool
+	tests   []*testFunction
+
+	// 启用的特性，参见features.go
+	Features []string
+
+	// 排除的模块源文件的模式，参见sourcefiles.go
+	Excludes []string
+
+	// 不把循环依赖当作错误，用于 ku graph 显示循环依赖，参见graph.go
+	AllowCycles bool
+
+	// 编辑器中打开的源文件的内容（绝对路径 -> 源码），代替磁盘上的文件，参见lsp.go
+	Overlay map[string]string
+
+	// 不运行构建钩子，参见hooks.go
+	SkipHooks bool
+
+	// 当前目录中的项目的顶层模块名，没有输入时使用，参见project.go
+	ProjectModule string
+
+	// 在这些阶段之后输出语法树，以及要输出的模块（为空时输出所有模块）和详细程度，参见dump.go
+	DumpAfter   []string
+	DumpModules []string
+	DumpLevel   string
 
 	moduleLookup *ast.ModuleLookup
 	depGraph     *ast.DependencyGraph
 	modules      []*ast.Module
 
 	modulesToRead []*ast.ModuleName
+
+	moduleManifests map[string]*moduleManifest // 读入过的顶层模块清单，没有清单的模块为nil
+	ranHooks        map[string]bool            // 已经运行过构建钩子的顶层模块
+	packages        map[string]*kupkg.Package  // 打开过的模块包，搜索路径中没有的包为nil
+	linkObjects     []string                   // 从模块包中解压的目标文件
+	objectFiles     map[string]string          // 代码生成输出的目标文件，模块名 -> 路径
 }
 
 // 初始化编译环境
 func NewContext() *Context {
 	res := &Context{
-		moduleLookup: ast.NewModuleLookup(""),
-		depGraph:     ast.NewDependencyGraph(),
+		moduleLookup:    ast.NewModuleLookup(""),
+		depGraph:        ast.NewDependencyGraph(),
+		moduleManifests: make(map[string]*moduleManifest),
+		ranHooks:        make(map[string]bool),
+		packages:        make(map[string]*kupkg.Package),
 	}
 	return res
 }
@@ -112,26 +330,19 @@ func NewContext() *Context {
 // 主流程：编译代码文件
 func (v *Context) Build(output string, outputType codegen.OutputType, usedCodegen string, optLevel int) {
 	// 首先加载runtime。注：其实这个加载过程也是一个完整的编译过程。
-	runtimeModule := LoadRuntime()
+	var runtimeModule *ast.Module
+	runPhase("runtime loading", func() {
+		runtimeModule = LoadRuntime()
+	})
 
 	// 语法分析（其中也包含了词法分析），生成AST语法树
 	v.parseFiles()
-
-	// debug：打印parse的AST树
-	for _, module := range v.modules {
-		for _, submod := range module.Parts {
-			// 打印AST
-			log.Debugln("main", "AST of submodule `%s/%s`:", module.Name, submod.File.Name)
-			for _, node := range submod.Nodes {
-				log.Debugln("main", "%s", node.String())
-			}
-			log.Debugln("main", "")
-		}
-	}
+	v.dumpAfter("parse")
+	v.dumpAfter("construct")
 
 	// 变量解析
 	hasMainFunc := false
-	log.Timed("resolve phase", "", func() {
+	runPhase("resolve phase", func() {
 		for _, module := range v.modules {
 			ast.Resolve(module, v.moduleLookup)
 
@@ -142,47 +353,66 @@ func (v *Context) Build(output string, outputType codegen.OutputType, usedCodege
 			}
 		}
 	})
+	v.dumpAfter("resolve")
 
 	// 如果没有找到主函数，直接退出
-	if !hasMainFunc {
-		log.Error("main", util.Red("error: ")+"main function not found\n")
-		os.Exit(1)
-	}
-
-	// debug：打印parse的AST树
-	for _, module := range v.modules {
-		for _, submod := range module.Parts {
-			// 打印AST
-			log.Debugln("main", "AST of submodule `%s/%s`:", module.Name, submod.File.Name)
-			for _, node := range submod.Nodes {
-				log.Debugln("main", "%s", node.String())
-			}
-			log.Debugln("main", "")
-		}
+	if !hasMainFunc && !v.Library {
+		log.Error(log.TagMain, util.Red("error: ")+"main function not found\n")
+		util.ExitFunc(1)
 	}
 
 	// 类型推导
-	log.Timed("inference phase", "", func() {
+	runPhase("inference phase", func() {
 		for _, module := range v.modules {
 			for _, submod := range module.Parts {
 				ast.Infer(submod)
-
-				// 打印AST
-				log.Debugln("main", "AST of submodule `%s/%s`:", module.Name, submod.File.Name)
-				for _, node := range submod.Nodes {
-					log.Debugln("main", "%s", node.String())
-				}
-				log.Debugln("main", "")
 			}
 		}
 	})
+	v.dumpAfter("infer")
 
 	// 语义分析
-	log.Timed("semantic analysis phase", "", func() {
+	runPhase("semantic analysis phase", func() {
 		for _, module := range v.modules {
-			semantic.SemCheck(module, *ignoreUnused)
+			// 接口模块在编译时已经检查过
+			if !module.Interface {
+				semantic.SemCheck(module, *ignoreUnused)
+			}
 		}
 	})
+	v.dumpAfter("semcheck")
+
+	// 输出模块接口文件
+	if v.InterfaceDir != "" {
+		runPhase("interface phase", func() {
+			v.writeInterfaces()
+		})
+	}
+
+	// 输出带类型的语法树
+	if v.TypedASTDir != "" {
+		runPhase("typed ast phase", func() {
+			v.writeTypedASTs()
+		})
+	}
+
+	// 输出MIR，用于查看。代码生成只使用MIR上去虚化的结果，参见 LLVMCodegen/devirt.go
+	if v.EmitMIR {
+		runPhase("mir lowering phase", func() {
+			for _, module := range v.modules {
+				if module.Interface {
+					continue
+				}
+				filename := output + "-" + module.MangledName(ast.MANGLE_ARK_UNSTABLE) + ".mir"
+				mirModule := mir.Lower(module)
+				mir.Devirtualize(mirModule)
+				err := ioutil.WriteFile(filename, []byte(mirModule.String()), 0666)
+				if err != nil {
+					setupErr("Couldn't write MIR file `%s`: %s", filename, err)
+				}
+			}
+		})
+	}
 
 	// 代码生成
 	if usedCodegen != "none" {
@@ -192,44 +422,145 @@ func (v *Context) Build(output string, outputType codegen.OutputType, usedCodege
 		switch usedCodegen {
 		case "llvm":
 			gen = &LLVMCodegen.Codegen{
-				OutputName: output,
-				OutputType: outputType,
-				OptLevel:   optLevel,
+				OutputName:  output,
+				OutputType:  outputType,
+				OptLevel:    optLevel,
+				Target:      v.Target,
+				PIC:         v.PIC,
+				Static:      v.Static,
+				Strip:       v.Strip,
+				ObjDir:      v.ObjDir,
+				LinkObjects: v.linkObjects,
 			}
 		default:
-			log.Error("main", util.Red("error: ")+"Invalid backend choice `"+usedCodegen+"`")
+			log.Error(log.TagMain, util.Red("error: ")+"Invalid backend choice `"+usedCodegen+"`")
 			os.Exit(1)
 		}
 
-		log.Timed("codegen phase", "", func() {
+		runPhase("codegen phase", func() {
 			mods := v.modules
 			if runtimeModule != nil {
 				mods = append(mods, runtimeModule)
 			}
 			gen.Generate(mods)
 		})
+
+		if llvmGen, ok := gen.(*LLVMCodegen.Codegen); ok {
+			v.objectFiles = llvmGen.ObjectFiles
+		}
+	}
+}
+
+// Run 把代码编译到临时目录中并运行，返回程序的退出码。临时目录在运行结束后删除
+func (v *Context) Run(optLevel int, args []string) int {
+	dir, err := ioutil.TempDir("", "ku-run")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "main")
+	v.Build(output, codegen.OutputExectuably, "llvm", optLevel)
+
+	if runtime.GOOS == "windows" {
+		output += ".exe"
+	}
+
+	cmd := exec.Command(output, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// 终端的Ctrl-C同时发给程序和编译器。程序运行期间编译器不退出，由程序决定如何处理，之后仍然删除临时目录
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			// 与shell一致，被信号终止的程序的退出码是 128+信号编号
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return exitErr.ExitCode()
+		}
+		log.Error(log.TagMain, util.Red("error: ")+"Couldn't run `%s`: %s\n", output, err)
+		return 1
 	}
+	return 0
 }
 
 // Docgen 生成代码文档
-func (v *Context) Docgen(dir string) {
+// 文档在类型推导之后生成，这样声明中可以显示推导出的类型。private为true时也生成非公开声明的文档
+func (v *Context) Docgen(dir string, private bool) {
+	runPhase("runtime loading", func() {
+		LoadRuntime()
+	})
+
 	v.parseFiles()
 
+	runPhase("resolve phase", func() {
+		for _, module := range v.modules {
+			ast.Resolve(module, v.moduleLookup)
+		}
+	})
+
+	runPhase("inference phase", func() {
+		for _, module := range v.modules {
+			for _, submod := range module.Parts {
+				ast.Infer(submod)
+			}
+		}
+	})
+
 	gen := &doc.Docgen{
-		Input: v.modules,
-		Dir:   dir,
+		Input:           v.modules,
+		Dir:             dir,
+		DocumentPrivate: private,
 	}
 
-	gen.Generate()
+	runPhase("docgen phase", func() {
+		gen.Generate()
+	})
 }
 
 // parseFiles 对各个文件进行分析。
 // 分析过程包括：模块读取、文件读取、词法分析、语法分析、AST语法树构建
 func (v *Context) parseFiles() {
+	// 数组长度中的 sizeof 等在变量解析时按编译目标计算
+	ast.TargetLayout = &LLVMCodegen.Codegen{Target: v.Target}
+
+	// 检查每个输入：源文件都放入 __main 模块直接进行分析；文件夹建立对应的模块，并加入到待分析模块列表中
+	var files []string
+	for _, input := range v.Inputs {
+		if strings.HasSuffix(input, ".ku") { // 输入是源文件。只支持.ku文件名
+			file := filepath.Clean(input)
+			if containsString(files, file) {
+				continue
+			}
+			// 子模块以文件名命名，不同目录中的同名文件不能放在同一个模块中
+			for _, other := range files {
+				if filepath.Base(other) == filepath.Base(file) {
+					setupErr("Input files `%s` and `%s` have the same name", other, file)
+				}
+			}
+			files = append(files, file)
+			continue
+		}
+
+		// 输入是一个文件夹。模块路径中不能包含'/', '.'和空格
+		if strings.ContainsAny(input, `\/. `) {
+			setupErr("Invalid module name: %s", input)
+		}
+
+		// 将整个文件作为一个模块加入待分析列表
+		//modname := &ast.ModuleName{Parts: strings.Split(input, "::")}
+		modname := &ast.ModuleName{Parts: strings.Split(input, ".")}
+		v.modulesToRead = append(v.modulesToRead, modname)
+	}
 
-	// 检查Input，如果是单个文件，就作为__main模块直接进行分析；如果是一个文件夹，建立对应的模块，并加入到待分析模块列表中
-	if strings.HasSuffix(v.Input, ".ku") { // 如果输入是单个文件。只支持.ku文件名
-		// 如果只有一个文件，则将它放入 __main 模块中
+	if len(files) > 0 {
+		// 所有源文件合并为 __main 模块，与同一个模块目录中的多个文件一样
 		modname := &ast.ModuleName{Parts: []string{"__main"}}
 		module := &ast.Module{
 			Name:    modname,
@@ -237,24 +568,29 @@ func (v *Context) parseFiles() {
 		}
 		v.moduleLookup.Create(modname).Module = module
 
-		// 直接分析该文件
-		v.parseFile(v.Input, module)
-
-		v.modules = append(v.modules, module)
-	} else { // 如果输入是一个文件夹
-		// 模块路径中不能包含'/', '.'和空格
-		if strings.ContainsAny(v.Input, `\/. `) {
-			setupErr("Invalid module name: %s", v.Input)
+		// 直接分析这些文件。构建钩子在第一个文件所在的目录中运行，构建脚本本身不再运行构建脚本
+		isBuildScript := false
+		for _, file := range files {
+			isBuildScript = isBuildScript || filepath.Base(file) == buildScriptName
+		}
+		if !isBuildScript {
+			v.runBuildHooks("__main", filepath.Dir(files[0]))
+		}
+		for _, file := range files {
+			v.parseFile(file, module)
 		}
 
-		// 将整个文件作为一个模块加入待分析列表
-		//modname := &ast.ModuleName{Parts: strings.Split(v.Input, "::")}
-		modname := &ast.ModuleName{Parts: strings.Split(v.Input, ".")}
-		v.modulesToRead = append(v.modulesToRead, modname)
+		v.modules = append(v.modules, module)
 	}
 
+	// 输入模块的清单中可以有额外的源码根目录
+	v.addManifestRoots()
+
+	// 最后查找标准库
+	v.Searchpaths = append(v.Searchpaths, findLibraryPath())
+
 	// 读取所有待分析模块的文件，进行词法分析和语法分析
-	log.Timed("read/lex/parse phase", "", func() {
+	runPhase("read/lex/parse phase", func() {
 		for i := 0; i < len(v.modulesToRead); i++ {
 			modname := v.
 				modulesToRead[i]
@@ -264,9 +600,20 @@ func (v *Context) parseFiles() {
 				continue
 			}
 
-			// 找到模块对应的目录
-			fi, dirpath, err := v.findModuleDir(modname.ToPath())
+			// 先运行构建钩子，它们生成的模块也可能在搜索路径中
+			v.runModuleBuildHooks(modname)
+
+			// 找到模块对应的目录。没有源码时使用模块的接口文件，或者模块包中预编译的模块
+			fi, dirpath, err := v.findModuleSourceDir(modname)
 			if err != nil {
+				if _, kuiPath, kuiErr := v.findModuleDir(modname.ToPath() + kui.Extension); kuiErr == nil {
+					v.modules = append(v.modules, v.parseInterface(kuiPath, modname))
+					continue
+				}
+				if pkg, mod := v.packagedModule(modname); mod != nil {
+					v.modules = append(v.modules, v.loadPackagedModule(pkg, mod, modname))
+					continue
+				}
 				setupErr("Couldn't find module `%s`: %s", modname, err)
 			}
 
@@ -288,8 +635,12 @@ func (v *Context) parseFiles() {
 			}
 
 			for _, childFile := range childFiles {
-				// 忽略掉非.ku文件
-				if strings.HasPrefix(childFile.Name(), ".") || !strings.HasSuffix(childFile.Name(), ".ku") {
+				// 忽略掉非.ku文件、测试文件、其他平台的文件以及排除的文件，参见sourcefiles.go
+				if !v.isModuleSourceFile(modname, childFile.Name()) {
+					continue
+				}
+				// 顶层模块目录中的构建脚本不属于模块
+				if len(modname.Parts) == 1 && childFile.Name() == buildScriptName {
 					continue
 				}
 
@@ -304,21 +655,36 @@ func (v *Context) parseFiles() {
 		}
 	})
 
+	// 检查模块包之间的版本要求
+	runPhase("package version check", func() {
+		v.checkPackageRequirements()
+	})
+
+	// 检查启用的特性
+	runPhase("feature check", func() {
+		v.checkFeatures()
+	})
+
 	// 检查模块中的循环依赖
-	log.Timed("cyclic dependency check", "", func() {
+	runPhase("cyclic dependency check", func() {
 		errs := v.depGraph.DetectCycles()
-		if len(errs) > 0 {
-			log.Error("main", "%s: Encountered cyclic dependency between: ", util.Bold(util.Red("error")))
+		if len(errs) > 0 && !v.AllowCycles {
+			log.Error(log.TagMain, "%s: Encountered cyclic dependency between: ", util.Bold(util.Red("error")))
 			for _, cycle := range errs {
-				log.Error("main", "%s", cycle)
+				log.Error(log.TagMain, "%s", cycle)
 			}
-			log.Errorln("main", "")
-			os.Exit(util.EXIT_FAILURE_SETUP)
+			log.Errorln(log.TagMain, "")
+			util.ExitFunc(util.EXIT_FAILURE_SETUP)
 		}
 	})
 
+	// 测试时在构建AST之前加入运行测试的main函数
+	if v.Testing {
+		v.addTestHarness()
+	}
+
 	// 构建AST语法树
-	log.Timed("construction phase", "", func() {
+	runPhase("construction phase", func() {
 		for _, module := range v.modules {
 			ast.Construct(module, v.moduleLookup)
 		}
@@ -328,37 +694,69 @@ func (v *Context) parseFiles() {
 // parseFile 分析单个文件
 func (v *Context) parseFile(path string, module *ast.Module) {
 	// 读入文件内容
-	sourcefile, err := lexer.NewSourcefile(path)
+	sourcefile, err := v.readSourcefile(path)
 	if err != nil {
 		setupErr("%s", err.Error())
 	}
+	recordSource(sourcefile)
 
+	v.parseSourcefile(sourcefile, module)
+}
+
+// readSourcefile 读入源文件。Overlay中有这个文件时使用其中的内容
+func (v *Context) readSourcefile(path string) (*lexer.Sourcefile, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		if contents, ok := v.Overlay[abs]; ok {
+			base := filepath.Base(path)
+			return &lexer.Sourcefile{
+				Name:     strings.TrimSuffix(base, filepath.Ext(base)),
+				Path:     path,
+				Contents: []rune(contents),
+				NewLines: []int{-1, -1},
+			}, nil
+		}
+	}
+	return lexer.NewSourcefile(path)
+}
+
+// parseSourcefile 对读入的源码进行词法分析和语法分析，并把用到的模块加入待分析列表
+func (v *Context) parseSourcefile(sourcefile *lexer.Sourcefile, module *ast.Module) {
 	// 进行词法分析（Lex），得到Token列表
 	sourcefile.Tokens = lexer.Lex(sourcefile)
 
 	// 进行语法分析（Parse），得到语法分析树。
 	// 注：这里的语法分析树（ParseTree）与后面的 AST语法树 是不同的。之后的构建阶段（Construction）会根据语法分析树构建出AST语法树
-	parseTree, deps := parser.Parse(sourcefile)
+	parseTree, _ := parser.Parse(sourcefile)
 	module.Trees = append(module.Trees, parseTree)
 
+	// 删除要求的特性没有启用的声明，剩下的use语句用到的模块才是依赖
+	deps := v.filterCfg(sourcefile, parseTree, module.Name.Parts[0])
+
 	// Add dependencies to parse array
 	for _, dep := range deps {
 		depname := ast.NewModuleName(dep)
 		v.modulesToRead = append(v.modulesToRead, depname)
 		v.depGraph.AddDependency(module.Name, depname)
+		v.runModuleBuildHooks(depname)
 
-		if _, _, err := v.findModuleDir(depname.ToPath()); err != nil {
-			log.Errorln("main", "%s [%s:%d:%d] Couldn't find module `%s`", util.Red("error:"),
+		if !v.moduleExists(depname) {
+			log.Errorln(log.TagMain, "%s [%s:%d:%d] Couldn't find module `%s`", util.Red("error:"),
 				dep.Where().Filename, dep.Where().StartLine, dep.Where().EndLine,
 				depname.String())
-			log.Errorln("main", "%s", sourcefile.MarkSpan(dep.Where()))
-			os.Exit(1)
+			log.Errorln(log.TagMain, "%s", sourcefile.MarkSpan(dep.Where()))
+			util.ExitFunc(1)
 		}
 	}
 }
 
 // findModuleDir 搜寻模块目录
 func (v *Context) findModuleDir(modulePath string) (fi os.FileInfo, path string, err error) {
+	// 项目的顶层模块的目录是当前目录
+	if v.ProjectModule != "" && modulePath == v.ProjectModule {
+		fi, err := os.Stat(".")
+		return fi, ".", err
+	}
+
 	for _, searchPath := range v.Searchpaths {
 		path := filepath.Join(searchPath, modulePath)
 		fi, err := os.Stat(path)
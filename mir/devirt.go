@@ -0,0 +1,126 @@
+package mir
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// Devirtualize 把被调用函数在编译时已知的间接调用替换为直接调用，返回替换的数量。
+//
+// 已知的被调用函数有两种：函数常量本身，以及从只被赋值一次、没有被取地址的局部变量中读出的函数常量
+// （赋值必须先于读取：要么在同一基本块中位于读取之前，要么位于入口基本块中）。
+// 泛型参数的约束中的接口方法通过单态化实现，本来就是直接调用；通过接口值的调用不会降低到MIR（参见 lowerCallExpr），
+// 所以需要处理的只有函数值。
+func Devirtualize(module *Module) int {
+	count := 0
+	for _, fn := range module.Functions {
+		count += devirtualizeFunction(fn)
+	}
+	return count
+}
+
+type storeSite struct {
+	block *Block
+	index int
+	fn    *FuncRef // 存入的函数常量，不是函数常量时为nil
+}
+
+func devirtualizeFunction(fn *Function) int {
+	if fn.Unsupported != "" {
+		return 0
+	}
+
+	stores := make(map[*Local][]storeSite)
+	escaped := make(map[*Local]bool)
+	for _, param := range fn.Params {
+		escaped[param] = true
+	}
+
+	for _, block := range fn.Blocks {
+		for idx, instr := range block.Instrs {
+			switch instr := instr.(type) {
+			case Store:
+				if instr.Dest.Local == nil {
+					continue
+				}
+				if len(instr.Dest.Projections) > 0 {
+					escaped[instr.Dest.Local] = true
+					continue
+				}
+				site := storeSite{block: block, index: idx}
+				if ref, ok := instr.Value.(*FuncRef); ok {
+					site.fn = ref
+				}
+				stores[instr.Dest.Local] = append(stores[instr.Dest.Local], site)
+
+			case AddressOf:
+				if instr.Source.Local != nil {
+					escaped[instr.Source.Local] = true
+				}
+			}
+		}
+	}
+
+	// 临时值 -> 已知的函数
+	known := make(map[*Temp]*FuncRef)
+	entry := fn.Blocks[0]
+	for _, block := range fn.Blocks {
+		for idx, instr := range block.Instrs {
+			load, ok := instr.(Load)
+			if !ok || load.Source.Local == nil || len(load.Source.Projections) > 0 {
+				continue
+			}
+
+			local := load.Source.Local
+			sites := stores[local]
+			if escaped[local] || len(sites) != 1 || sites[0].fn == nil {
+				continue
+			}
+
+			site := sites[0]
+			if site.block == block && site.index < idx || site.block == entry && block != entry {
+				known[load.Dest] = site.fn
+			}
+		}
+	}
+
+	count := 0
+	for _, block := range fn.Blocks {
+		for idx, instr := range block.Instrs {
+			call, ok := instr.(CallIndirect)
+			if !ok {
+				continue
+			}
+
+			var target *FuncRef
+			switch callee := call.Callee.(type) {
+			case *FuncRef:
+				target = callee
+			case *Temp:
+				target = known[callee]
+			}
+
+			if target != nil {
+				block.Instrs[idx] = Call{Dest: call.Dest, Function: target.Function, Args: call.Args, Source: call.Source, Known: target}
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// KnownCallees 返回 Devirtualize 替换的间接调用：AST中的调用 -> 被调用的函数常量。
+// LLVM后端把这些调用生成为直接调用
+func KnownCallees(module *Module) map[*ast.CallExpr]*ast.FunctionAccessExpr {
+	res := make(map[*ast.CallExpr]*ast.FunctionAccessExpr)
+	for _, fn := range module.Functions {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if call, ok := instr.(Call); ok && call.Known != nil {
+					res[call.Source] = call.Known.Source
+				}
+			}
+		}
+	}
+	return res
+}
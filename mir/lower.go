@@ -0,0 +1,507 @@
+package mir
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// Lower 把经过语义检查的模块转换为MIR。
+// 泛型函数和用到MIR还不支持的特性的函数只生成签名，并在 Function.Unsupported 中说明原因
+func Lower(module *ast.Module) *Module {
+	res := &Module{Name: module.Name.String()}
+
+	names := make([]string, 0, len(module.Parts))
+	for name := range module.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, node := range module.Parts[name].Nodes {
+			decl, ok := node.(*ast.FunctionDecl)
+			if !ok || decl.Prototype {
+				continue
+			}
+			res.Functions = append(res.Functions, lowerFunction(decl.Function))
+		}
+	}
+
+	return res
+}
+
+type unsupportedError struct {
+	what string
+}
+
+type lowerer struct {
+	fn     *Function
+	cur    *Block
+	locals map[*ast.Variable]*Local
+
+	breakTargets    []*Block
+	continueTargets []*Block
+}
+
+func lowerFunction(astFn *ast.Function) (fn *Function) {
+	fn = &Function{Source: astFn}
+
+	if len(astFn.Type.GenericParameters) > 0 {
+		fn.Name = astFn.Name
+		fn.Unsupported = "generic function"
+		return fn
+	}
+
+	fn.Name = FunctionName(astFn)
+	if ret := astFn.Type.Return; ret != nil && !ret.BaseType.IsVoidType() {
+		fn.ReturnType = ret
+	}
+
+	v := &lowerer{
+		fn:     fn,
+		locals: make(map[*ast.Variable]*Local),
+	}
+
+	if astFn.Receiver != nil {
+		fn.Params = append(fn.Params, v.newLocal(astFn.Receiver.Variable))
+	}
+	for _, par := range astFn.Parameters {
+		fn.Params = append(fn.Params, v.newLocal(par.Variable))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(unsupportedError)
+			if !ok {
+				panic(r)
+			}
+			fn.Blocks = nil
+			fn.Unsupported = err.what
+		}
+	}()
+
+	v.cur = v.newBlock()
+	v.lowerBlock(astFn.Body)
+	if v.cur.Terminator == nil {
+		v.cur.Terminator = Return{}
+	}
+	v.pruneUnreachable()
+
+	return fn
+}
+
+// FunctionName 非泛型函数的符号名，与LLVM后端一致
+func FunctionName(fn *ast.Function) string {
+	if fn.Type.Attrs().Contains("nomangle") {
+		return fn.Name
+	}
+	return fn.MangledName(ast.MANGLE_ARK_UNSTABLE, ast.NewGenericContext(nil, nil))
+}
+
+func unsupported(format string, args ...interface{}) {
+	panic(unsupportedError{what: fmt.Sprintf(format, args...)})
+}
+
+func (v *lowerer) newLocal(vari *ast.Variable) *Local {
+	local := &Local{Id: len(v.fn.Locals), Name: vari.Name, Type: vari.Type}
+	v.fn.Locals = append(v.fn.Locals, local)
+	v.locals[vari] = local
+	return local
+}
+
+func (v *lowerer) newTempLocal(typ *ast.TypeReference) *Local {
+	local := &Local{Id: len(v.fn.Locals), Name: "tmp", Type: typ}
+	v.fn.Locals = append(v.fn.Locals, local)
+	return local
+}
+
+func (v *lowerer) newTemp(typ *ast.TypeReference) *Temp {
+	temp := &Temp{Id: v.fn.nextTemp, Typ: typ}
+	v.fn.nextTemp++
+	return temp
+}
+
+func (v *lowerer) newBlock() *Block {
+	block := &Block{Id: len(v.fn.Blocks)}
+	v.fn.Blocks = append(v.fn.Blocks, block)
+	return block
+}
+
+func (v *lowerer) emit(instr Instr) {
+	v.cur.Instrs = append(v.cur.Instrs, instr)
+}
+
+// terminate 结束当前基本块，之后的代码（如 return 之后的语句）进入一个新的不可达基本块
+func (v *lowerer) terminate(term Terminator) {
+	v.cur.Terminator = term
+	v.cur = v.newBlock()
+}
+
+// jumpTo 结束当前基本块并跳转到target，之后在target中继续生成代码
+func (v *lowerer) jumpTo(target *Block) {
+	if v.cur.Terminator == nil {
+		v.cur.Terminator = Jump{Target: target}
+	}
+	v.cur = target
+}
+
+// pruneUnreachable 删除从入口不可达的基本块，并把剩下的基本块按逆后序排列、重新编号
+func (v *lowerer) pruneUnreachable() {
+	visited := make(map[*Block]bool)
+	var postorder []*Block
+
+	var visit func(block *Block)
+	visit = func(block *Block) {
+		visited[block] = true
+		if block.Terminator != nil {
+			for _, succ := range block.Terminator.Successors() {
+				if !visited[succ] {
+					visit(succ)
+				}
+			}
+		}
+		postorder = append(postorder, block)
+	}
+	visit(v.fn.Blocks[0])
+
+	blocks := make([]*Block, 0, len(postorder))
+	for idx := len(postorder) - 1; idx >= 0; idx-- {
+		block := postorder[idx]
+		block.Id = len(blocks)
+		blocks = append(blocks, block)
+	}
+	v.fn.Blocks = blocks
+}
+
+/**
+ * Statements
+ */
+
+func (v *lowerer) lowerBlock(block *ast.Block) {
+	for _, node := range block.Nodes {
+		v.lowerNode(node)
+	}
+}
+
+func (v *lowerer) lowerNode(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.VariableDecl:
+		local := v.newLocal(n.Variable)
+		if n.Assignment != nil {
+			v.emit(Store{Dest: Place{Local: local}, Value: v.lowerExpr(n.Assignment)})
+		}
+
+	case *ast.AssignStat:
+		if _, ok := n.Access.(*ast.DiscardAccessExpr); ok {
+			v.lowerExpr(n.Assignment)
+			return
+		}
+		value := v.lowerExpr(n.Assignment)
+		v.emit(Store{Dest: v.lowerPlace(n.Access), Value: value})
+
+	case *ast.BinopAssignStat:
+		if n.Operator.Category() == parser.OP_LOGICAL {
+			unsupported("logical binop assignment")
+		}
+		place := v.lowerPlace(n.Access)
+		old := v.newTemp(n.Access.GetType())
+		v.emit(Load{Dest: old, Source: place})
+		rhand := v.lowerExpr(n.Assignment)
+		res := v.newTemp(n.Access.GetType())
+		v.emit(BinOp{Dest: res, Op: n.Operator, Lhand: old, Rhand: rhand})
+		v.emit(Store{Dest: place, Value: res})
+
+	case *ast.ReturnStat:
+		if n.Value == nil {
+			v.terminate(Return{})
+		} else {
+			v.terminate(Return{Value: v.lowerExpr(n.Value)})
+		}
+
+	case *ast.IfStat:
+		end := v.newBlock()
+		for idx, expr := range n.Exprs {
+			then := v.newBlock()
+			next := end
+			if idx < len(n.Exprs)-1 || n.Else != nil {
+				next = v.newBlock()
+			}
+
+			v.cur.Terminator = Branch{Cond: v.lowerExpr(expr), Then: then, Else: next}
+
+			v.cur = then
+			v.lowerBlock(n.Bodies[idx])
+			v.jumpTo(end)
+			v.cur = next
+		}
+		if n.Else != nil {
+			v.lowerBlock(n.Else)
+			v.jumpTo(end)
+		}
+
+	case *ast.LoopStat:
+		head := v.newBlock()
+		body := v.newBlock()
+		end := v.newBlock()
+
+		v.jumpTo(head)
+		switch n.LoopType {
+		case ast.LOOP_TYPE_INFINITE:
+			v.cur.Terminator = Jump{Target: body}
+		case ast.LOOP_TYPE_CONDITIONAL:
+			v.cur.Terminator = Branch{Cond: v.lowerExpr(n.Condition), Then: body, Else: end}
+		default:
+			panic("INTERNAL ERROR: Invalid loop type")
+		}
+
+		v.breakTargets = append(v.breakTargets, end)
+		v.continueTargets = append(v.continueTargets, head)
+		v.cur = body
+		v.lowerBlock(n.Body)
+		v.jumpTo(head)
+		v.breakTargets = v.breakTargets[:len(v.breakTargets)-1]
+		v.continueTargets = v.continueTargets[:len(v.continueTargets)-1]
+
+		v.cur = end
+
+	case *ast.BreakStat:
+		v.terminate(Jump{Target: v.breakTargets[len(v.breakTargets)-1]})
+
+	case *ast.ContinueStat:
+		v.terminate(Jump{Target: v.continueTargets[len(v.continueTargets)-1]})
+
+	case *ast.CallStat:
+		v.lowerCallExpr(n.Call)
+
+	case *ast.BlockStat:
+		v.lowerBlock(n.Block)
+
+	case *ast.StaticAssertStat:
+		// 编译期断言不生成代码
+
+	default:
+		unsupported("%s", node.NodeName())
+	}
+}
+
+/**
+ * Expressions
+ */
+
+func (v *lowerer) lowerExpr(expr ast.Expr) Value {
+	switch n := expr.(type) {
+	case *ast.NumericLiteral, *ast.BoolLiteral, *ast.RuneLiteral, *ast.StringLiteral:
+		return &Const{Expr: n}
+
+	case *ast.BinaryExpr:
+		if n.Op.Category() == parser.OP_LOGICAL {
+			return v.lowerLogicalExpr(n)
+		}
+		if n.Method != nil {
+			unsupported("operator `%s` implemented by a constraint method", n.Op.OpString())
+		}
+		if n.Op.Category() == parser.OP_COMPARISON && ast.IsCompositeComparison(n.Lhand.GetType()) {
+			unsupported("comparison of `%s`", n.Lhand.GetType().String())
+		}
+		lhand := v.lowerExpr(n.Lhand)
+		rhand := v.lowerExpr(n.Rhand)
+		res := v.newTemp(n.GetType())
+		v.emit(BinOp{Dest: res, Op: n.Op, Lhand: lhand, Rhand: rhand})
+		return res
+
+	case *ast.UnaryExpr:
+		operand := v.lowerExpr(n.Expr)
+		res := v.newTemp(n.GetType())
+		v.emit(UnOp{Dest: res, Op: n.Op, Operand: operand})
+		return res
+
+	case *ast.CastExpr:
+		if _, ok := ast.InterfaceOf(n.Expr.GetType()); ok {
+			unsupported("cast between interface types")
+		}
+		operand := v.lowerExpr(n.Expr)
+		res := v.newTemp(n.GetType())
+		v.emit(Cast{Dest: res, Operand: operand, To: n.GetType()})
+		return res
+
+	case *ast.CallExpr:
+		res := v.lowerCallExpr(n)
+		if res == nil {
+			unsupported("void call used as value")
+		}
+		return res
+
+	case *ast.VariableAccessExpr, *ast.StructAccessExpr, *ast.ArrayAccessExpr, *ast.DerefAccessExpr:
+		place := v.lowerPlace(n)
+		res := v.newTemp(n.GetType())
+		v.emit(Load{Dest: res, Source: place})
+		return res
+
+	case *ast.TempAccessExpr:
+		return v.lowerExpr(n.Expr)
+
+	case *ast.ReferenceToExpr:
+		place := v.lowerPlace(n.Access)
+		res := v.newTemp(n.GetType())
+		v.emit(AddressOf{Dest: res, Source: place, IsMutable: n.IsMutable})
+		return res
+
+	case *ast.PointerToExpr:
+		place := v.lowerPlace(n.Access)
+		res := v.newTemp(n.GetType())
+		v.emit(AddressOf{Dest: res, Source: place, IsPointer: true, IsMutable: n.IsMutable})
+		return res
+
+	case *ast.FunctionAccessExpr:
+		if len(n.Function.Type.GenericParameters) > 0 || n.Function.Receiver != nil {
+			unsupported("reference to function `%s`", n.Function.Name)
+		}
+		return &FuncRef{Function: n.Function, Source: n}
+
+	case *ast.ArrayLenExpr:
+		if n.Expr == nil {
+			unsupported("len of type")
+		}
+		return v.lowerArrayLen(v.lowerPlace(n.Expr), n.Expr.GetType())
+
+	default:
+		unsupported("%s", expr.NodeName())
+		return nil
+	}
+}
+
+// lowerLogicalExpr 短路求值：结果存入一个临时局部变量，在汇合的基本块中读出
+func (v *lowerer) lowerLogicalExpr(n *ast.BinaryExpr) Value {
+	result := v.newTempLocal(n.GetType())
+	rhandBlock := v.newBlock()
+	shortBlock := v.newBlock()
+	end := v.newBlock()
+
+	lhand := v.lowerExpr(n.Lhand)
+	if n.Op == parser.BINOP_LOG_AND {
+		v.cur.Terminator = Branch{Cond: lhand, Then: rhandBlock, Else: shortBlock}
+	} else {
+		v.cur.Terminator = Branch{Cond: lhand, Then: shortBlock, Else: rhandBlock}
+	}
+
+	v.cur = shortBlock
+	v.emit(Store{Dest: Place{Local: result}, Value: &Const{Expr: &ast.BoolLiteral{Value: n.Op == parser.BINOP_LOG_OR}}})
+	v.jumpTo(end)
+
+	v.cur = rhandBlock
+	v.emit(Store{Dest: Place{Local: result}, Value: v.lowerExpr(n.Rhand)})
+	v.jumpTo(end)
+
+	res := v.newTemp(n.GetType())
+	v.emit(Load{Dest: res, Source: Place{Local: result}})
+	return res
+}
+
+// lowerCallExpr 生成函数调用，没有返回值时返回nil
+func (v *lowerer) lowerCallExpr(n *ast.CallExpr) Value {
+	var callee Value
+	fae, direct := n.Function.(*ast.FunctionAccessExpr)
+	if direct {
+		if len(fae.Function.Type.GenericParameters) > 0 || fae.ReceiverAccess != nil && len(fae.ReceiverAccess.GetType().GenericArguments) > 0 {
+			unsupported("call to generic function `%s`", fae.Function.Name)
+		}
+		// 接口的方法没有接收者，通过接口值的调用在运行时才知道被调用的方法
+		if fae.ReceiverAccess != nil && fae.Function.Type.Receiver == nil {
+			unsupported("call to interface method `%s`", fae.Function.Name)
+		}
+	} else {
+		callee = v.lowerExpr(n.Function)
+	}
+
+	var args []Value
+	if n.ReceiverAccess != nil {
+		args = append(args, v.lowerExpr(n.ReceiverAccess))
+	}
+	for _, arg := range n.Arguments {
+		args = append(args, v.lowerExpr(arg))
+	}
+
+	var dest *Temp
+	fnType := n.Function.GetType().BaseType.ActualType().(ast.FunctionType)
+	if ret := fnType.Return; ret != nil && !ret.BaseType.IsVoidType() {
+		dest = v.newTemp(n.GetType())
+	}
+
+	if direct {
+		v.emit(Call{Dest: dest, Function: fae.Function, Args: args, Source: n})
+	} else {
+		v.emit(CallIndirect{Dest: dest, Callee: callee, Args: args, Source: n})
+	}
+
+	if dest == nil {
+		return nil
+	}
+	return dest
+}
+
+func (v *lowerer) lowerArrayLen(array Place, typ *ast.TypeReference) Value {
+	arrType, ok := typ.BaseType.ActualType().(ast.ArrayType)
+	if !ok {
+		unsupported("len of non-array")
+	}
+	if arrType.IsFixedLength {
+		return &Const{Expr: &ast.NumericLiteral{
+			IntValue: big.NewInt(int64(arrType.Length)),
+			Type:     &ast.TypeReference{BaseType: ast.PRIMITIVE_uint},
+		}}
+	}
+
+	res := v.newTemp(&ast.TypeReference{BaseType: ast.PRIMITIVE_uint})
+	v.emit(ArrayLen{Dest: res, Array: array})
+	return res
+}
+
+// lowerPlace 把访问表达式转换为位置
+func (v *lowerer) lowerPlace(expr ast.Expr) Place {
+	switch n := expr.(type) {
+	case *ast.VariableAccessExpr:
+		if local, ok := v.locals[n.Variable]; ok {
+			return Place{Local: local}
+		}
+		return Place{Global: n.Variable}
+
+	case *ast.StructAccessExpr:
+		if n.Method != nil {
+			unsupported("method value `%s`", n.Member)
+		}
+		if _, ok := n.Struct.GetType().BaseType.ActualType().(ast.StructType); !ok {
+			unsupported("member access on `%s`", n.Struct.GetType().String())
+		}
+		return v.lowerPlace(n.Struct).Project(Projection{Kind: PROJECTION_FIELD, Field: n.Member})
+
+	case *ast.ArrayAccessExpr:
+		switch n.Array.GetType().BaseType.ActualType().(type) {
+		case ast.ArrayType:
+			array := v.lowerPlace(n.Array)
+			index := v.lowerExpr(n.Subscript)
+			v.emit(BoundsCheck{Index: index, Length: v.lowerArrayLen(array, n.Array.GetType())})
+			return array.Project(Projection{Kind: PROJECTION_INDEX, Index: index})
+
+		case ast.PointerType:
+			ptr := v.lowerExpr(n.Array)
+			return Place{Pointer: ptr, Projections: []Projection{{Kind: PROJECTION_INDEX, Index: v.lowerExpr(n.Subscript)}}}
+
+		default:
+			unsupported("subscript on `%s`", n.Array.GetType().String())
+		}
+
+	case *ast.DerefAccessExpr:
+		return Place{Pointer: v.lowerExpr(n.Expr)}
+
+	case *ast.TempAccessExpr:
+		local := v.newTempLocal(n.GetType())
+		v.emit(Store{Dest: Place{Local: local}, Value: v.lowerExpr(n.Expr)})
+		return Place{Local: local}
+	}
+
+	unsupported("%s as place", expr.NodeName())
+	return Place{}
+}
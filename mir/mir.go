@@ -0,0 +1,413 @@
+// Package mir 中层中间表示（mid-level IR）。
+//
+// MIR 位于带类型的AST与LLVM IR之间。每个函数由若干基本块组成，基本块内是三地址形式的指令，
+// 并以一条终结指令（跳转、条件跳转、返回）结束。表达式的中间结果是只赋值一次的临时值（SSA风格），
+// 变量则存放在局部变量槽（Local）中，通过 load/store 访问，所以不需要phi节点。
+//
+// LLVM后端从AST生成代码，只从MIR读取分析的结果：通过函数值的调用按 Devirtualize 的结果生成为直接调用（参见 KnownCallees）。
+// --emit-mir 把MIR写入文件，用于查看。
+package mir
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// Module 一个模块中所有函数的MIR
+type Module struct {
+	Name      string
+	Functions []*Function
+}
+
+func (v *Module) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "module %s\n", v.Name)
+	for _, fn := range v.Functions {
+		buf.WriteString("\n")
+		buf.WriteString(fn.String())
+	}
+	return buf.String()
+}
+
+// Function 函数。第一个基本块是入口
+type Function struct {
+	Name       string // 修饰后的名字
+	Source     *ast.Function
+	Params     []*Local
+	Locals     []*Local // 包括参数
+	Blocks     []*Block
+	ReturnType *ast.TypeReference // 为nil时没有返回值
+
+	// Unsupported 不为空时表示函数用到了MIR还不支持的语言特性，没有生成函数体
+	Unsupported string
+
+	nextTemp int
+}
+
+func (v *Function) String() string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("fun " + v.Name + "(")
+	for idx, param := range v.Params {
+		if idx > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(param.String() + " " + param.Type.String())
+	}
+	buf.WriteString(")")
+	if v.ReturnType != nil {
+		buf.WriteString(" " + v.ReturnType.String())
+	}
+
+	if v.Unsupported != "" {
+		fmt.Fprintf(buf, " // not lowered: %s\n", v.Unsupported)
+		return buf.String()
+	}
+
+	buf.WriteString(" {\n")
+	for _, local := range v.Locals[len(v.Params):] {
+		fmt.Fprintf(buf, "    let %s %s\n", local, local.Type)
+	}
+
+	for _, block := range v.Blocks {
+		fmt.Fprintf(buf, "%s:\n", block.Name())
+		for _, instr := range block.Instrs {
+			fmt.Fprintf(buf, "    %s\n", instr)
+		}
+		if block.Terminator != nil {
+			fmt.Fprintf(buf, "    %s\n", block.Terminator)
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Local 局部变量槽，可以取地址
+type Local struct {
+	Id   int
+	Name string
+	Type *ast.TypeReference
+}
+
+func (v *Local) String() string {
+	return fmt.Sprintf("$%s.%d", v.Name, v.Id)
+}
+
+// Block 基本块
+type Block struct {
+	Id         int
+	Instrs     []Instr
+	Terminator Terminator
+}
+
+func (v *Block) Name() string {
+	return fmt.Sprintf("bb%d", v.Id)
+}
+
+// Value 指令的操作数：临时值、常量或函数常量
+type Value interface {
+	Type() *ast.TypeReference
+	String() string
+}
+
+// Temp 临时值，只被赋值一次
+type Temp struct {
+	Id  int
+	Typ *ast.TypeReference
+}
+
+func (v *Temp) Type() *ast.TypeReference { return v.Typ }
+func (v *Temp) String() string           { return fmt.Sprintf("t%d", v.Id) }
+
+// Const 常量：数字、布尔、字符或字符串常量
+type Const struct {
+	Expr ast.Expr
+}
+
+func (v *Const) Type() *ast.TypeReference { return v.Expr.GetType() }
+
+func (v *Const) String() string {
+	switch lit := v.Expr.(type) {
+	case *ast.NumericLiteral:
+		if lit.IsFloat {
+			return strconv.FormatFloat(lit.FloatValue, 'g', -1, 64)
+		}
+		return lit.IntValue.String()
+	case *ast.BoolLiteral:
+		return strconv.FormatBool(lit.Value)
+	case *ast.RuneLiteral:
+		return strconv.QuoteRune(lit.Value)
+	case *ast.StringLiteral:
+		if lit.IsCString {
+			return "c" + strconv.Quote(lit.Value)
+		}
+		return strconv.Quote(lit.Value)
+	default:
+		panic("INTERNAL ERROR: Invalid MIR constant")
+	}
+}
+
+// FuncRef 函数常量，即作为值使用的函数
+type FuncRef struct {
+	Function *ast.Function
+	Source   *ast.FunctionAccessExpr
+}
+
+func (v *FuncRef) Type() *ast.TypeReference {
+	return &ast.TypeReference{BaseType: v.Function.Type}
+}
+
+func (v *FuncRef) String() string { return FunctionName(v.Function) }
+
+// Place 可以读写和取地址的位置：局部变量、全局变量或指针指向的位置，再加上一串投影，如 $a.0.b[t1]
+type Place struct {
+	Local       *Local
+	Global      *ast.Variable
+	Pointer     Value // Local和Global都为nil时，位置为 @Pointer，打印为 (@t0)
+	Projections []Projection
+}
+
+func (v Place) String() string {
+	var res string
+	switch {
+	case v.Local != nil:
+		res = v.Local.String()
+	case v.Global != nil:
+		res = "@" + v.Global.Name
+	default:
+		res = "(@" + v.Pointer.String() + ")"
+	}
+
+	for _, proj := range v.Projections {
+		res += proj.String()
+	}
+	return res
+}
+
+// Project 返回加上一个投影之后的新位置
+func (v Place) Project(proj Projection) Place {
+	projs := make([]Projection, len(v.Projections), len(v.Projections)+1)
+	copy(projs, v.Projections)
+	v.Projections = append(projs, proj)
+	return v
+}
+
+type ProjectionKind int
+
+const (
+	PROJECTION_FIELD ProjectionKind = iota // 结构体成员
+	PROJECTION_INDEX                       // 数组元素
+)
+
+type Projection struct {
+	Kind  ProjectionKind
+	Field string // PROJECTION_FIELD
+	Index Value  // PROJECTION_INDEX
+}
+
+func (v Projection) String() string {
+	switch v.Kind {
+	case PROJECTION_FIELD:
+		return "." + v.Field
+	case PROJECTION_INDEX:
+		return "[" + v.Index.String() + "]"
+	default:
+		panic("INTERNAL ERROR: Invalid MIR projection")
+	}
+}
+
+// Instr 基本块中的指令
+type Instr interface {
+	instr()
+	String() string
+}
+
+// BinOp Dest = Lhand op Rhand。逻辑运算 && 和 || 已经被转换成了条件跳转
+type BinOp struct {
+	Dest         *Temp
+	Op           parser.BinOpType
+	Lhand, Rhand Value
+}
+
+// UnOp Dest = op Operand
+type UnOp struct {
+	Dest    *Temp
+	Op      parser.UnOpType
+	Operand Value
+}
+
+// Cast Dest = To(Operand)
+type Cast struct {
+	Dest    *Temp
+	Operand Value
+	To      *ast.TypeReference
+}
+
+// Load Dest = Source
+type Load struct {
+	Dest   *Temp
+	Source Place
+}
+
+// Store Dest = Value
+type Store struct {
+	Dest  Place
+	Value Value
+}
+
+// AddressOf Dest = &Source 或 ^Source
+type AddressOf struct {
+	Dest      *Temp
+	Source    Place
+	IsPointer bool // ^ 取指针；否则 & 取引用
+	IsMutable bool
+}
+
+// ArrayLen Dest = len(Array)
+type ArrayLen struct {
+	Dest  *Temp
+	Array Place
+}
+
+// BoundsCheck 如果 Index >= Length，程序终止
+type BoundsCheck struct {
+	Index  Value
+	Length Value
+}
+
+// Call Dest = Function(Args...)，没有返回值时Dest为nil。方法调用的接收器是第一个参数
+type Call struct {
+	Dest     *Temp
+	Function *ast.Function
+	Args     []Value
+	Source   *ast.CallExpr
+
+	// Devirtualize 替换的间接调用中，已知的函数值；源码中的直接调用为nil
+	Known *FuncRef
+}
+
+// CallIndirect 通过函数值调用，Callee的值在编译时不一定知道
+type CallIndirect struct {
+	Dest   *Temp
+	Callee Value
+	Args   []Value
+	Source *ast.CallExpr
+}
+
+func (_ BinOp) instr()        {}
+func (_ UnOp) instr()         {}
+func (_ Cast) instr()         {}
+func (_ Load) instr()         {}
+func (_ Store) instr()        {}
+func (_ AddressOf) instr()    {}
+func (_ ArrayLen) instr()     {}
+func (_ BoundsCheck) instr()  {}
+func (_ Call) instr()         {}
+func (_ CallIndirect) instr() {}
+
+func (v BinOp) String() string {
+	return fmt.Sprintf("%s = %s %s %s", v.Dest, v.Lhand, v.Op.OpString(), v.Rhand)
+}
+
+func (v UnOp) String() string {
+	return fmt.Sprintf("%s = %s%s", v.Dest, v.Op.OpString(), v.Operand)
+}
+
+func (v Cast) String() string {
+	return fmt.Sprintf("%s = %s(%s)", v.Dest, v.To, v.Operand)
+}
+
+func (v Load) String() string {
+	return fmt.Sprintf("%s = load %s", v.Dest, v.Source)
+}
+
+func (v Store) String() string {
+	return fmt.Sprintf("store %s = %s", v.Dest, v.Value)
+}
+
+func (v AddressOf) String() string {
+	op := "&"
+	if v.IsPointer {
+		op = "^"
+	}
+	if v.IsMutable {
+		op += "mut "
+	}
+	return fmt.Sprintf("%s = %s%s", v.Dest, op, v.Source)
+}
+
+func (v ArrayLen) String() string {
+	return fmt.Sprintf("%s = len(%s)", v.Dest, v.Array)
+}
+
+func (v BoundsCheck) String() string {
+	return fmt.Sprintf("boundscheck %s < %s", v.Index, v.Length)
+}
+
+func (v Call) String() string {
+	return callString(v.Dest, "call "+FunctionName(v.Function), v.Args)
+}
+
+func (v CallIndirect) String() string {
+	return callString(v.Dest, "call_indirect "+v.Callee.String(), v.Args)
+}
+
+func callString(dest *Temp, callee string, args []Value) string {
+	buf := new(bytes.Buffer)
+	if dest != nil {
+		buf.WriteString(dest.String() + " = ")
+	}
+	buf.WriteString(callee + "(")
+	for idx, arg := range args {
+		if idx > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(arg.String())
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
+
+// Terminator 基本块的终结指令
+type Terminator interface {
+	Successors() []*Block
+	String() string
+}
+
+// Jump 无条件跳转
+type Jump struct {
+	Target *Block
+}
+
+// Branch 条件跳转
+type Branch struct {
+	Cond       Value
+	Then, Else *Block
+}
+
+// Return 返回，没有返回值时Value为nil
+type Return struct {
+	Value Value
+}
+
+func (v Jump) Successors() []*Block   { return []*Block{v.Target} }
+func (v Branch) Successors() []*Block { return []*Block{v.Then, v.Else} }
+func (v Return) Successors() []*Block { return nil }
+
+func (v Jump) String() string {
+	return "jump " + v.Target.Name()
+}
+
+func (v Branch) String() string {
+	return fmt.Sprintf("branch %s, %s, %s", v.Cond, v.Then.Name(), v.Else.Name())
+}
+
+func (v Return) String() string {
+	if v.Value == nil {
+		return "return"
+	}
+	return "return " + v.Value.String()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+	"github.com/ku-lang/ku/kui"
+	"github.com/ku-lang/ku/kupkg"
+	"github.com/ku-lang/ku/util/semver"
+)
+
+// 预编译的模块包（.kupkg），格式参见kupkg包。
+//
+// package 命令编译一个模块及其子模块，把它们的接口文件和目标文件打包成以模块命名的包，如 json.kupkg。
+// 编译时，搜索路径中找不到模块 a.b 的源码目录和接口文件时，会查找模块包 a.kupkg，
+// 从中读入模块的接口，并把模块的目标文件解压到 .ku-build/obj/pkg 下一起链接。
+//
+// 清单中记录了包的语义化版本号、可以使用这个包的编译器版本范围，以及依赖的其他模块包的版本范围，
+// 打开模块包时检查编译器版本，读入所有模块之后检查模块包之间的版本要求
+
+// Package 把模块v.Inputs[0]及其子模块编译成模块包output。
+// 用到的其他模块必须来自接口文件或其他模块包，不会打包进来。
+// compilers为可以使用这个包的编译器版本范围；requires为 包名@版本范围 形式的依赖要求，
+// 没有指定版本范围的依赖包要求与编译时使用的版本兼容
+func (v *Context) Package(output, version, compilers string, requires []string, optLevel int) {
+	input := v.Inputs[0]
+	if strings.HasSuffix(input, ".ku") {
+		setupErr("Only modules can be packaged, not single files: `%s`", input)
+	}
+	if _, err := semver.Parse(version); err != nil {
+		setupErr("Invalid package version: %s", err)
+	}
+	if _, err := semver.ParseRange(compilers); err != nil {
+		setupErr("Invalid compiler version range: %s", err)
+	}
+
+	requireRanges := make(map[string]string)
+	for _, require := range requires {
+		idx := strings.IndexByte(require, '@')
+		if idx < 0 {
+			setupErr("Invalid package requirement `%s`, expected <package>@<version range>", require)
+		}
+		if _, err := semver.ParseRange(require[idx+1:]); err != nil {
+			setupErr("Invalid package requirement `%s`: %s", require, err)
+		}
+		requireRanges[require[:idx]] = require[idx+1:]
+	}
+
+	dir, err := ioutil.TempDir("", "ku-package")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	v.Library = true
+	v.Build(filepath.Join(dir, input), codegen.OutputObject, "llvm", optLevel)
+
+	var modules []*ast.Module
+	for _, module := range v.modules {
+		if module.Interface {
+			continue
+		}
+		if module.Name.Parts[0] != input {
+			os.RemoveAll(dir)
+			setupErr("Module `%s` is compiled from source but isn't part of package `%s`, package it separately", module.Name, input)
+		}
+		modules = append(modules, module)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		os.RemoveAll(dir)
+		setupErr("%s", err)
+	}
+
+	for name, pkg := range v.packages {
+		if _, ok := requireRanges[name]; !ok && pkg != nil {
+			requireRanges[name] = "^" + pkg.Manifest.Version
+		}
+	}
+
+	manifest := kupkg.Manifest{
+		Name:      input,
+		Version:   version,
+		Compiler:  VERSION,
+		Compilers: compilers,
+		Target:    LLVMCodegen.TargetTriple(v.Target),
+		Requires:  requireRanges,
+	}
+	v.packageFeatures(&manifest)
+
+	w := kupkg.NewWriter(file, manifest)
+	for _, module := range modules {
+		iface, err := kui.Extract(module, VERSION)
+		if err == nil {
+			err = w.AddModule(iface, v.objectFiles[module.Name.String()])
+		}
+		if err != nil {
+			file.Close()
+			os.RemoveAll(dir)
+			setupErr("Couldn't package module `%s`: %s", module.Name, err)
+		}
+	}
+
+	err = w.Close()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		setupErr("Couldn't write package `%s`: %s", output, err)
+	}
+}
+
+// openPackage 打开搜索路径中名为name的模块包，没有时返回nil
+func (v *Context) openPackage(name string) *kupkg.Package {
+	if pkg, ok := v.packages[name]; ok {
+		return pkg
+	}
+
+	var pkg *kupkg.Package
+	if _, path, err := v.findModuleDir(name + kupkg.Extension); err == nil {
+		pkg, err = kupkg.Open(path)
+		if err != nil {
+			setupErr("Couldn't open package `%s`: %s", path, err)
+		}
+		if pkg.Manifest.Name != name {
+			setupErr("Package `%s` is named `%s`, expected `%s`", path, pkg.Manifest.Name, name)
+		}
+		if target := LLVMCodegen.TargetTriple(v.Target); pkg.Manifest.Target != target {
+			setupErr("Package `%s` was compiled for `%s`, but the target is `%s`", path, pkg.Manifest.Target, target)
+		}
+		checkPackageVersion(pkg)
+	}
+
+	v.packages[name] = pkg
+	return pkg
+}
+
+// packagedModule 返回包含模块modname的模块包以及包中的模块，模块不在模块包中时返回nil
+func (v *Context) packagedModule(modname *ast.ModuleName) (*kupkg.Package, *kupkg.Module) {
+	pkg := v.openPackage(modname.Parts[0])
+	if pkg == nil {
+		return nil, nil
+	}
+	return pkg, pkg.Manifest.Module(modname.String())
+}
+
+// loadPackagedModule 从模块包中读入模块的接口，并解压模块的目标文件用于链接
+func (v *Context) loadPackagedModule(pkg *kupkg.Package, mod *kupkg.Module, modname *ast.ModuleName) *ast.Module {
+	path := pkg.Path + ":" + mod.Interface
+
+	iface, err := pkg.ReadInterface(mod)
+	if err != nil {
+		setupErr("Couldn't read interface file `%s`: %s", path, err)
+	}
+
+	obj, err := pkg.ExtractObject(mod, ensureBuildDir(filepath.Join("obj", "pkg", pkg.Manifest.Name)))
+	if err != nil {
+		setupErr("Couldn't extract object file of module `%s` from `%s`: %s", modname, pkg.Path, err)
+	}
+	v.linkObjects = append(v.linkObjects, obj)
+
+	return v.loadInterface(iface, path, modname)
+}
+
+// checkPackageVersion 检查模块包的版本号，以及当前的编译器是否可以使用这个包
+func checkPackageVersion(pkg *kupkg.Package) {
+	manifest := &pkg.Manifest
+	if _, err := semver.Parse(manifest.Version); err != nil {
+		setupErr("Package `%s` has an invalid version: %s", pkg.Path, err)
+	}
+
+	compilers := manifest.Compilers
+	if compilers == "" {
+		compilers = "=" + manifest.Compiler
+	}
+	rng, err := semver.ParseRange(compilers)
+	if err != nil {
+		setupErr("Package `%s` has an invalid compiler version range: %s", pkg.Path, err)
+	}
+
+	if !rng.Contains(compilerVersion()) {
+		setupErr("Package `%s` %s (from `%s`) supports ku compiler versions `%s`, but this is ku %s.\n"+
+			"Rebuild the package with `ku package` using this compiler, or use a compiler matching `%s`.",
+			manifest.Name, manifest.Version, pkg.Path, compilers, VERSION, compilers)
+	}
+}
+
+// checkPackageRequirements 检查用到的模块包之间的版本要求。
+// 只检查用到的模块包；依赖的模块来自源码或接口文件时没有版本号，不检查
+func (v *Context) checkPackageRequirements() {
+	var names []string
+	for name, pkg := range v.packages {
+		if pkg != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		manifest := &v.packages[name].Manifest
+
+		var deps []string
+		for dep := range manifest.Requires {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+
+		for _, dep := range deps {
+			depPkg := v.packages[dep]
+			if depPkg == nil {
+				continue
+			}
+
+			rng, err := semver.ParseRange(manifest.Requires[dep])
+			if err != nil {
+				setupErr("Package `%s` has an invalid requirement on `%s`: %s", name, dep, err)
+			}
+			depVersion, _ := semver.Parse(depPkg.Manifest.Version)
+			if !rng.Contains(depVersion) {
+				setupErr("Package `%s` %s requires `%s` `%s`, but `%s` is version %s.\n"+
+					"Put a version of `%s` matching `%s` on the search path, or rebuild `%s` against %s %s.",
+					name, manifest.Version, dep, rng, depPkg.Path, depPkg.Manifest.Version,
+					dep, rng, name, dep, depPkg.Manifest.Version)
+			}
+		}
+	}
+}
+
+// compilerVersion 当前编译器的版本
+func compilerVersion() semver.Version {
+	ver, err := semver.Parse(VERSION)
+	if err != nil {
+		panic("invalid compiler version " + VERSION)
+	}
+	return ver
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"sort"
+
 	"github.com/ku-lang/ku/lexer"
 	"github.com/ku-lang/ku/util"
 )
@@ -47,9 +49,24 @@ func (v AttrGroup) Equals(other AttrGroup) bool {
 	return true
 }
 
+// Sorted 按名字排序的属性列表
+func (v AttrGroup) Sorted() []*Attr {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	res := make([]*Attr, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, v[key])
+	}
+	return res
+}
+
 func (v AttrGroup) String() string {
 	var strs []string
-	for _, attr := range v {
+	for _, attr := range v.Sorted() {
 		strs = append(strs, attr.String())
 	}
 
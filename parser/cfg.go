@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 条件编译：顶层声明和use语句可以带有 [cfg(feature = "name")] 标注，
+// 只有特性name启用时才会编译。这样库可以把可选的依赖和功能放在特性后面，由使用者在编译时选择启用
+
+// CfgFeature 返回cfg标注要求的特性
+func CfgFeature(attr *Attr) (string, error) {
+	const prefix = "feature="
+	if !strings.HasPrefix(attr.Value, prefix) {
+		return "", fmt.Errorf("Expected `cfg(feature = \"name\")`, got `cfg(%s)`", attr.Value)
+	}
+
+	feature, err := strconv.Unquote(attr.Value[len(prefix):])
+	if err != nil || feature == "" {
+		return "", fmt.Errorf("Expected a feature name in `cfg(%s)`", attr.Value)
+	}
+	return feature, nil
+}
+
+// FilterCfg 删除语法分析树中要求的特性没有启用的顶层节点，并去掉保留下来的节点上的cfg标注。
+// enabled判断特性是否启用。返回保留下来的use语句用到的模块
+func FilterCfg(tree *ParseTree, enabled func(feature string, attr *Attr) bool) ([]*NameNode, error) {
+	var deps []*NameNode
+	nodes := tree.Nodes[:0]
+	for _, node := range tree.Nodes {
+		if attr := node.Attrs().Get("cfg"); attr != nil {
+			feature, err := CfgFeature(attr)
+			if err != nil {
+				return nil, fmt.Errorf("[%s:%d:%d] %s", attr.Pos().Filename, attr.Pos().Line, attr.Pos().Char, err)
+			}
+			if !enabled(feature, attr) {
+				continue
+			}
+			delete(node.Attrs(), "cfg")
+		}
+
+		if use, ok := node.(*UseDirectiveNode); ok {
+			deps = append(deps, use.Module)
+		}
+		nodes = append(nodes, node)
+	}
+	tree.Nodes = nodes
+
+	return deps, nil
+}
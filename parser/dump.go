@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DumpNode 以稳定的文本格式输出语法分析树节点，用于 --dump-after=parse。
+// 每个节点输出为 (类型名 字段: 值 ...)，子节点缩进一层；零值字段和文档注释不输出。
+// withPos 为true时在类型名之后输出节点在源码中的位置
+func DumpNode(node ParseNode, withPos bool) string {
+	d := &dumper{buf: new(bytes.Buffer), withPos: withPos}
+	d.value(reflect.ValueOf(node), 0)
+	return d.buf.String()
+}
+
+type dumper struct {
+	buf     *bytes.Buffer
+	withPos bool
+}
+
+var (
+	locatedStringType = reflect.TypeOf(LocatedString{})
+	bigIntType        = reflect.TypeOf(&big.Int{})
+	attrGroupType     = reflect.TypeOf(AttrGroup{})
+)
+
+func (v *dumper) value(val reflect.Value, indent int) {
+	if !val.IsValid() {
+		v.buf.WriteString("nil")
+		return
+	}
+
+	switch val.Type() {
+	case locatedStringType:
+		v.buf.WriteString(strconv.Quote(val.Interface().(LocatedString).Value))
+		return
+	case bigIntType:
+		v.buf.WriteString(val.Interface().(*big.Int).String())
+		return
+	case attrGroupType:
+		var attrs []string
+		for _, attr := range val.Interface().(AttrGroup).Sorted() {
+			if attr.Value == "" {
+				attrs = append(attrs, attr.Key)
+			} else {
+				attrs = append(attrs, attr.Key+"="+strconv.Quote(attr.Value))
+			}
+		}
+		v.buf.WriteString("[" + strings.Join(attrs, " ") + "]")
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			v.buf.WriteString("nil")
+			return
+		}
+		v.value(val.Elem(), indent)
+
+	case reflect.Struct:
+		v.node(val, indent)
+
+	case reflect.Slice:
+		v.buf.WriteString("[")
+		for i := 0; i < val.Len(); i++ {
+			v.newline(indent + 1)
+			v.value(val.Index(i), indent+1)
+		}
+		v.buf.WriteString("]")
+
+	case reflect.String:
+		v.buf.WriteString(strconv.Quote(val.String()))
+
+	case reflect.Int32:
+		// rune
+		v.buf.WriteString(strconv.QuoteRune(rune(val.Int())))
+
+	default:
+		fmt.Fprintf(v.buf, "%v", val)
+	}
+}
+
+func (v *dumper) node(val reflect.Value, indent int) {
+	v.buf.WriteString("(" + val.Type().Name())
+
+	var node ParseNode
+	if val.CanAddr() && val.Addr().CanInterface() {
+		node, _ = val.Addr().Interface().(ParseNode)
+	}
+	if node != nil && v.withPos {
+		where := node.Where()
+		fmt.Fprintf(v.buf, " @%d:%d-%d:%d", where.StartLine, where.StartChar, where.EndLine, where.EndChar)
+	}
+
+	v.fields(val, node, indent)
+	v.buf.WriteString(")")
+}
+
+func (v *dumper) fields(val reflect.Value, node ParseNode, indent int) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fval := val.Field(i)
+
+		switch field.Name {
+		case "baseNode":
+			// 只输出属性，位置和文档注释不输出
+			if node != nil && len(node.Attrs()) > 0 {
+				v.newline(indent + 1)
+				v.buf.WriteString("Attrs: ")
+				v.value(reflect.ValueOf(node.Attrs()), indent+1)
+			}
+			continue
+		case "baseDecl":
+			v.fields(fval, node, indent)
+			continue
+		case "public":
+			if fval.Bool() {
+				v.newline(indent + 1)
+				v.buf.WriteString("Public: true")
+			}
+			continue
+		}
+
+		if isZero(fval) {
+			continue
+		}
+
+		v.newline(indent + 1)
+		v.buf.WriteString(field.Name + ": ")
+		v.value(fval, indent+1)
+	}
+}
+
+func (v *dumper) newline(indent int) {
+	v.buf.WriteString("\n")
+	v.buf.WriteString(strings.Repeat("  ", indent))
+}
+
+func isZero(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Slice, reflect.Map:
+		return val.Len() == 0
+	}
+	return val.IsZero()
+}
@@ -0,0 +1,37 @@
+package parser
+
+// FloatBuiltin 浮点数内建函数
+type FloatBuiltin int
+
+const (
+	FLOAT_BUILTIN_IS_NAN FloatBuiltin = iota // is_nan(x)
+	FLOAT_BUILTIN_IS_INF                     // is_inf(x)，正负无穷都返回true
+	FLOAT_BUILTIN_FMA                        // fma(a, b, c)，计算 a * b + c，只舍入一次
+)
+
+var floatBuiltinNames = map[string]FloatBuiltin{
+	"is_nan": FLOAT_BUILTIN_IS_NAN,
+	"is_inf": FLOAT_BUILTIN_IS_INF,
+	"fma":    FLOAT_BUILTIN_FMA,
+}
+
+func (v FloatBuiltin) String() string {
+	for name, builtin := range floatBuiltinNames {
+		if builtin == v {
+			return name
+		}
+	}
+	panic("missing float builtin")
+}
+
+// NumArguments 内建函数的参数个数
+func (v FloatBuiltin) NumArguments() int {
+	switch v {
+	case FLOAT_BUILTIN_IS_NAN, FLOAT_BUILTIN_IS_INF:
+		return 1
+	case FLOAT_BUILTIN_FMA:
+		return 3
+	default:
+		panic("missing float builtin")
+	}
+}
@@ -0,0 +1,1011 @@
+package parser
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ku-lang/ku/lexer"
+)
+
+// 源码格式化（ku fmt）
+//
+// Format 把语法分析树重新输出为统一格式的源码：用Tab缩进，左花括号与语句在同一行，运算符和逗号后面加空格，
+// 每个语句、成员和match分支各占一行。语法树中没有保留的内容从源码中取得：
+//   - 注释不在语法树中，词法分析把它们记录在 Sourcefile.Comments 中（文档注释仍然是词号）。
+//     输出每一行（语句、成员、列表元素等）之前，先输出源码中位于它之前的注释；
+//     源码中注释前面同一行还有代码时，注释接在上一行的末尾，相邻几行的行尾注释对齐；
+//   - 源码中一行之前是空行时，输出中也保留一个空行，代码块开头的空行去掉；
+//   - 数字、字符串和字符常量按源码原样输出，括号在语法树中是只有一个元素的元组，也原样保留；
+//   - 函数调用、复合常量、元组和类型的成员列表，在源码中结束括号另起一行时每个元素一行，带结尾的逗号，
+//     否则输出在一行中。
+//
+// 格式化只改变空白、注释的位置和可省略的分隔符，不改变语法树（参见 ku fmt 的检查）。
+
+// Format 格式化tree，返回格式化后的源码
+func Format(tree *ParseTree) string {
+	p := &printer{source: tree.Source, lineStart: true}
+	p.comments = append(p.comments, tree.Source.Comments...)
+	for _, tok := range tree.Source.Tokens {
+		if tok.Type == lexer.Doccomment {
+			p.comments = append(p.comments, tok)
+		}
+	}
+	sort.SliceStable(p.comments, func(i, j int) bool {
+		return before(p.comments[i].Where.Start(), p.comments[j].Where.Start())
+	})
+
+	for _, node := range tree.Nodes {
+		p.item(p.start(node))
+		p.decl(node, true)
+		p.newline()
+	}
+	p.flush(lexer.Position{Line: math.MaxInt32})
+
+	res := strings.Trim(alignComments(p.buf.String()), "\n")
+	if res == "" {
+		return ""
+	}
+	return res + "\n"
+}
+
+type printer struct {
+	buf        bytes.Buffer
+	source     *lexer.Sourcefile
+	indent     int
+	lineStart  bool // 下一次输出在行首，需要先缩进
+	blockStart bool // 刚开始一个代码块或列表，下一行之前不空行
+
+	comments []*lexer.Token // 按位置排序的所有注释
+	next     int            // 下一个还没有输出的注释
+}
+
+// before 位置a是否在位置b之前
+func before(a, b lexer.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+}
+
+func (v *printer) write(strs ...string) {
+	for _, str := range strs {
+		if v.lineStart {
+			v.buf.WriteString(strings.Repeat("\t", v.indent))
+			v.lineStart = false
+		}
+		v.buf.WriteString(str)
+	}
+	v.blockStart = false
+}
+
+func (v *printer) newline() {
+	v.buf.WriteByte('\n')
+	v.lineStart = true
+}
+
+// item 开始输出新的一行：先输出位于start之前的注释，源码中这一行之前是空行时输出一个空行
+func (v *printer) item(start lexer.Position) {
+	v.flush(start)
+	v.space(start.Line)
+}
+
+// flush 输出位于pos之前、还没有输出的注释。只在行首调用
+func (v *printer) flush(pos lexer.Position) {
+	for v.next < len(v.comments) && before(v.comments[v.next].Where.Start(), pos) {
+		comment := v.comments[v.next]
+		v.next++
+		text := strings.TrimRightFunc(comment.Contents, unicode.IsSpace)
+
+		// 行尾注释：接在上一行末尾，用 \v 标记，最后由alignComments对齐
+		if v.codeBefore(comment.Where.Start()) && v.buf.Len() > 0 && !bytes.HasSuffix(v.buf.Bytes(), []byte("\n\n")) {
+			v.buf.Truncate(v.buf.Len() - 1)
+			v.buf.WriteString("\v" + text + "\n")
+			continue
+		}
+
+		v.space(comment.Where.StartLine)
+		v.write(text)
+		v.newline()
+	}
+}
+
+// hasComments 在from和to之间是否有还没有输出的注释
+func (v *printer) hasComments(from, to lexer.Position) bool {
+	for _, comment := range v.comments[v.next:] {
+		if before(comment.Where.Start(), to) && !before(comment.Where.Start(), from) {
+			return true
+		}
+	}
+	return false
+}
+
+// space 源码中第line行之前是空行时输出一个空行，不在文件、代码块和列表的开头输出，也不连续输出多个空行
+func (v *printer) space(line int) {
+	if v.blockStart || v.buf.Len() == 0 || line <= 1 || bytes.HasSuffix(v.buf.Bytes(), []byte("\n\n")) {
+		return
+	}
+	if strings.TrimSpace(v.source.GetLine(line-1)) == "" {
+		v.newline()
+	}
+}
+
+// codeBefore 源码中pos所在的一行在pos之前是否还有代码
+func (v *printer) codeBefore(pos lexer.Position) bool {
+	line := []rune(v.source.GetLine(pos.Line))
+	if pos.Char-1 > len(line) {
+		return false
+	}
+	return strings.TrimSpace(string(line[:pos.Char-1])) != ""
+}
+
+// sourceAt 源码中pos处的字符，超出文件时返回0
+func (v *printer) sourceAt(pos lexer.Position) rune {
+	if offset := v.source.Offset(pos); offset >= 0 && offset < len(v.source.Contents) {
+		return v.source.Contents[offset]
+	}
+	return 0
+}
+
+// start 节点在源码中的开始位置，包括节点之前的标注
+func (v *printer) start(node ParseNode) lexer.Position {
+	pos := node.Where().Start()
+	for _, attr := range node.Attrs() {
+		if attr.Pos().Line > 0 && before(attr.Pos(), pos) {
+			pos = attr.Pos()
+		}
+	}
+	return pos
+}
+
+// end 节点在源码中的结束位置
+func end(node ParseNode) lexer.Position {
+	return node.Where().End()
+}
+
+// multiline 列表在源码中的结束括号是否在最后一个元素之后另起一行
+func multiline(last ParseNode, where lexer.Span) bool {
+	return last != nil && where.EndLine > end(last).Line
+}
+
+// list 输出括号中以逗号分隔的n个元素，elem输出第i个元素，start是它在源码中的开始位置。
+// lines为true（或者没有元素但有注释）时每个元素一行，带结尾的逗号
+func (v *printer) list(open, close string, n int, where lexer.Span, lines bool, start func(i int) lexer.Position, elem func(i int)) {
+	v.write(open)
+	if n == 0 && v.hasComments(where.Start(), where.End()) {
+		lines = true
+	}
+	if !lines {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				v.write(", ")
+			}
+			elem(i)
+		}
+		v.write(close)
+		return
+	}
+
+	v.newline()
+	v.indent++
+	v.blockStart = true
+	for i := 0; i < n; i++ {
+		v.item(start(i))
+		elem(i)
+		v.write(",")
+		v.newline()
+	}
+	v.flush(where.End())
+	v.indent--
+	v.write(close)
+}
+
+// nodes 把节点列表转换为list的参数
+func (v *printer) nodes(nodes []ParseNode, open, close string, where lexer.Span, elem func(node ParseNode)) {
+	var last ParseNode
+	if len(nodes) > 0 {
+		last = nodes[len(nodes)-1]
+	}
+	v.list(open, close, len(nodes), where, multiline(last, where),
+		func(i int) lexer.Position { return v.start(nodes[i]) },
+		func(i int) { elem(nodes[i]) })
+}
+
+// attrs 输出标注，合并为一组。源码中标注与声明不在同一行时，声明另起一行
+func (v *printer) attrs(attrs AttrGroup, line int) {
+	if len(attrs) == 0 {
+		return
+	}
+
+	list := make([]*Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		list = append(list, attr)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Pos() == list[j].Pos() {
+			return list[i].Key < list[j].Key
+		}
+		return before(list[i].Pos(), list[j].Pos())
+	})
+
+	strs := make([]string, len(list))
+	for i, attr := range list {
+		strs[i] = v.attr(attr)
+	}
+	v.write("[" + strings.Join(strs, ", ") + "]")
+
+	if list[len(list)-1].Pos().Line < line {
+		v.newline()
+	} else {
+		v.write(" ")
+	}
+}
+
+// attr 输出一个标注：key、key="value"、key(value) 或 key(name = "value")，写法参见parseAttributes
+func (v *printer) attr(attr *Attr) string {
+	if attr.Value == "" {
+		return attr.Key
+	}
+
+	pos := attr.Pos()
+	pos.Char += len([]rune(attr.Key))
+	for unicode.IsSpace(v.sourceAt(pos)) {
+		pos.Char++
+	}
+	if v.sourceAt(pos) == '=' {
+		return attr.Key + "=\"" + attr.Value + "\""
+	}
+
+	if idx := strings.Index(attr.Value, "="); idx >= 0 {
+		if value, err := strconv.Unquote(attr.Value[idx+1:]); err == nil {
+			return attr.Key + "(" + attr.Value[:idx] + " = \"" + value + "\")"
+		}
+	}
+	return attr.Key + "(" + attr.Value + ")"
+}
+
+// decl 输出声明和语句。topLevel为true时是顶层节点
+func (v *printer) decl(node ParseNode, topLevel bool) {
+	v.attrs(node.Attrs(), node.Where().StartLine)
+
+	if decl, ok := node.(DeclNode); ok && topLevel {
+		if decl.IsPublic() {
+			v.write(KEYWORD_PUB + " ")
+		} else if decl.IsFilePrivate() {
+			v.write(KEYWORD_PRIV + " ")
+		}
+	}
+
+	switch n := node.(type) {
+	case *FunctionDeclNode:
+		v.function(n.Function, topLevel)
+	case *TypeDeclNode:
+		v.typeDecl(n)
+	case *VarDeclNode:
+		v.varDecl(n)
+	case *DestructVarDeclNode:
+		v.write("(")
+		for i, name := range n.Names {
+			if i > 0 {
+				v.write(", ")
+			}
+			if n.Mutable[i] {
+				v.write(KEYWORD_VAR + " ")
+			}
+			v.write(name.Value)
+		}
+		v.write(") := ")
+		v.expr(n.Value)
+	case *UseDirectiveNode:
+		v.write(KEYWORD_USE + " ")
+		v.name(n.Module)
+	case *LinkDirectiveNode:
+		v.write("#link \"" + n.Library.Value + "\"")
+	case *WarnDirectiveNode:
+		v.write("#warn(" + n.Level.Value + ", \"" + n.Name.Value + "\")")
+	case *FeatureDirectiveNode:
+		v.write("#feature(\"" + n.Feature.Value + "\")")
+	default:
+		v.stat(node)
+	}
+}
+
+func (v *printer) function(fn *FunctionNode, topLevel bool) {
+	v.header(fn.Header)
+	switch {
+	case fn.Body != nil:
+		v.write(" ")
+		v.block(fn.Body)
+	case fn.Stat != nil:
+		v.write(" => ")
+		v.stat(fn.Stat)
+		if topLevel && !isConditional(fn.Stat) {
+			v.write(";")
+		}
+	case fn.Expr != nil:
+		v.write(" => ")
+		v.expr(fn.Expr)
+		if topLevel {
+			v.write(";")
+		}
+	default:
+		v.write(";")
+	}
+}
+
+// header 输出函数头。省略了fun关键字的lambda只输出参数和返回类型
+func (v *printer) header(h *FunctionHeaderNode) {
+	short := h.Anonymous && v.sourceAt(h.Where().Start()) == '('
+	if !short {
+		v.write(KEYWORD_FUN)
+	}
+	if !h.Anonymous {
+		v.write(" ")
+	}
+
+	if h.Receiver != nil {
+		typ := h.Receiver.Type
+		if !h.Receiver.Mutable.IsEmpty() {
+			v.write(KEYWORD_VAR + " ")
+			if ptr, ok := typ.Type.(*PointerTypeNode); ok {
+				typ = ptr.TargetType
+			}
+		}
+		v.typeRef(typ)
+		v.write(".")
+	} else if h.StaticReceiverType != nil {
+		v.write(KEYWORD_STATIC + " ")
+		v.name(h.StaticReceiverType.Name)
+		v.sigil(h.StaticReceiverSigil)
+		v.write(".")
+	}
+	v.write(h.Name.Value)
+	v.sigil(h.GenericSigil)
+
+	v.write("(")
+	for i, arg := range h.Arguments {
+		if i > 0 {
+			v.write(", ")
+		}
+		v.param(arg)
+	}
+	if h.Variadic {
+		if len(h.Arguments) > 0 {
+			v.write(", ")
+		}
+		v.write("...")
+	}
+	v.write(")")
+
+	if h.ReturnType != nil {
+		v.write(" ")
+		v.typeRef(h.ReturnType)
+	}
+}
+
+// param 函数参数：[标注] var name Type = 默认值
+func (v *printer) param(arg *VarDeclNode) {
+	v.attrs(arg.Attrs(), arg.Where().StartLine)
+	if !arg.Mutable.IsEmpty() {
+		v.write(KEYWORD_VAR + " ")
+	}
+	v.write(arg.Name.Value)
+	if arg.Type != nil {
+		v.write(" ")
+		v.typeRef(arg.Type)
+	}
+	if arg.Value != nil {
+		v.write(" = ")
+		v.expr(arg.Value)
+	}
+}
+
+// sigil 泛型参数 <T: A & B, U>。where子句中的约束已经合并到泛型参数中
+func (v *printer) sigil(sigil *GenericSigilNode) {
+	if sigil == nil {
+		return
+	}
+	v.write("<")
+	for i, param := range sigil.GenericParameters {
+		if i > 0 {
+			v.write(", ")
+		}
+		v.write(param.Name.Value)
+		for j, con := range param.Constraints {
+			if j == 0 {
+				v.write(": ")
+			} else {
+				v.write(" & ")
+			}
+			v.typeRef(con)
+		}
+	}
+	v.write(">")
+}
+
+func (v *printer) varDecl(n *VarDeclNode) {
+	if n.Mutable.IsEmpty() {
+		v.write(KEYWORD_LET + " ")
+	} else {
+		v.write(KEYWORD_VAR + " ")
+	}
+	v.write(n.Name.Value)
+	if n.Type != nil {
+		v.write(" ")
+		v.typeRef(n.Type)
+	}
+	if n.Value != nil {
+		v.write(" = ")
+		v.expr(n.Value)
+	}
+}
+
+func (v *printer) typeDecl(n *TypeDeclNode) {
+	v.write("type " + n.Name.Value)
+	if n.Alias {
+		v.sigil(n.GenericSigil)
+		v.write(" = ")
+		v.typ(n.Type)
+		return
+	}
+
+	v.write(" ")
+	if st, ok := n.Type.(*StructTypeNode); ok && v.sourceAt(st.Where().Start()) == '{' {
+		v.structType(st, false)
+		return
+	}
+	v.typ(n.Type)
+}
+
+func (v *printer) name(n *NameNode) {
+	for _, mod := range n.Modules {
+		v.write(mod.Value, ".")
+	}
+	v.write(n.Name.Value)
+}
+
+func (v *printer) typeRefs(refs []*TypeReferenceNode) {
+	for i, ref := range refs {
+		if i > 0 {
+			v.write(", ")
+		}
+		v.typeRef(ref)
+	}
+}
+
+func (v *printer) typeRef(ref *TypeReferenceNode) {
+	v.typ(ref.Type)
+	if len(ref.GenericArguments) > 0 {
+		v.write("<")
+		v.typeRefs(ref.GenericArguments)
+		v.write(">")
+	}
+}
+
+func (v *printer) typ(node ParseNode) {
+	switch t := node.(type) {
+	case *TypeReferenceNode:
+		v.typeRef(t)
+	case *NamedTypeNode:
+		v.name(t.Name)
+	case *PointerTypeNode:
+		v.write("^")
+		if t.Mutable {
+			v.write(KEYWORD_VAR + " ")
+		}
+		v.typeRef(t.TargetType)
+	case *ReferenceTypeNode:
+		v.write("&")
+		if t.Mutable {
+			v.write(KEYWORD_VAR + " ")
+		}
+		v.typeRef(t.TargetType)
+	case *TupleTypeNode:
+		v.write("(")
+		v.typeRefs(t.MemberTypes)
+		v.write(")")
+	case *FunctionTypeNode:
+		v.write(KEYWORD_FUN + "(")
+		v.typeRefs(t.ParameterTypes)
+		if t.IsVariadic {
+			if len(t.ParameterTypes) > 0 {
+				v.write(", ")
+			}
+			v.write("...")
+		}
+		v.write(")")
+		if t.ReturnType != nil {
+			v.write(" ")
+			v.typeRef(t.ReturnType)
+		}
+	case *ArrayTypeNode:
+		v.write("[")
+		if t.LengthExpr != nil {
+			v.expr(t.LengthExpr)
+		} else if t.IsFixedLength {
+			v.write(v.arrayLength(t))
+		}
+		v.write("]")
+		v.typeRef(t.MemberType)
+	case *StructTypeNode:
+		v.structType(t, true)
+	case *EnumTypeNode:
+		v.enumType(t)
+	case *InterfaceTypeNode:
+		v.interfaceType(t)
+	default:
+		v.write(v.source.SpanContents(node.Where()))
+	}
+}
+
+// arrayLength 定长数组的长度字面量按源码原样输出，如 [0x100]u8
+func (v *printer) arrayLength(t *ArrayTypeNode) string {
+	pos := t.Where().Start()
+	pos.Char++
+	var buf []rune
+	for r := v.sourceAt(pos); r != ']' && r != 0; r = v.sourceAt(pos) {
+		buf = append(buf, r)
+		pos.Char++
+	}
+	if length := strings.TrimSpace(string(buf)); length != "" && !strings.ContainsRune(length, '\n') {
+		return length
+	}
+	return strconv.Itoa(t.Length)
+}
+
+// structType 结构体、联合体，以及类型定义和枚举成员中省略了struct关键字的结构体
+func (v *printer) structType(t *StructTypeNode, keyword bool) {
+	if t.IsUnion {
+		v.write(KEYWORD_UNION)
+	} else if keyword {
+		v.write(KEYWORD_STRUCT)
+	}
+	v.sigil(t.GenericSigil)
+	if t.IsUnion || keyword {
+		v.write(" ")
+	}
+
+	// 静态成员与普通成员按源码中的顺序输出
+	var members []ParseNode
+	for _, mem := range t.Members {
+		members = append(members, mem)
+	}
+	for _, static := range t.StaticMembers {
+		members = append(members, static)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return before(members[i].Where().Start(), members[j].Where().Start())
+	})
+
+	v.nodes(members, "{", "}", t.Where(), func(node ParseNode) {
+		switch mem := node.(type) {
+		case *StructMemberNode:
+			if mem.Public {
+				v.write(KEYWORD_PUB + " ")
+			}
+			v.write(mem.Name.Value + " ")
+			v.typeRef(mem.Type)
+		case *VarDeclNode:
+			if mem.IsPublic() {
+				v.write(KEYWORD_PUB + " ")
+			}
+			v.write(KEYWORD_STATIC + " ")
+			v.varDecl(mem)
+		}
+	})
+}
+
+func (v *printer) enumType(t *EnumTypeNode) {
+	v.write(KEYWORD_ENUM)
+	v.sigil(t.GenericSigil)
+	v.write(" ")
+
+	entries := make([]ParseNode, len(t.Members))
+	for i, mem := range t.Members {
+		entries[i] = mem
+	}
+	v.nodes(entries, "{", "}", t.Where(), func(node ParseNode) {
+		entry := node.(*EnumEntryNode)
+		v.write(entry.Name.Value)
+		switch {
+		case entry.Value != nil:
+			v.write(" = ")
+			v.expr(entry.Value)
+		case entry.TupleBody != nil:
+			v.typ(entry.TupleBody)
+		case entry.StructBody != nil:
+			v.write(" ")
+			v.structType(entry.StructBody, false)
+		}
+	})
+}
+
+// interfaceType 接口的每个函数后面都必须有逗号，所以总是每个函数一行
+func (v *printer) interfaceType(t *InterfaceTypeNode) {
+	v.write(KEYWORD_INTERFACE)
+	v.sigil(t.GenericSigil)
+	v.write(" ")
+
+	v.list("{", "}", len(t.Functions), t.Where(), len(t.Functions) > 0,
+		func(i int) lexer.Position { return t.Functions[i].Where().Start() },
+		func(i int) { v.header(t.Functions[i]) })
+}
+
+// block 输出代码块，每个语句一行
+func (v *printer) block(block *BlockNode) {
+	v.write("{")
+	if len(block.Nodes) == 0 && block.Tail == nil && !v.hasComments(block.Where().Start(), block.Where().End()) {
+		v.write("}")
+		return
+	}
+
+	v.newline()
+	v.indent++
+	v.blockStart = true
+	for i, node := range block.Nodes {
+		v.item(v.start(node))
+		v.decl(node, false)
+		// 下一个语句以括号开头时，不加分号会被当成调用或者下标的一部分。
+		// 代码块的值以一元运算符开头时，不加分号还会被当成二元运算的右操作数
+		if !isConditional(node) {
+			if i+1 < len(block.Nodes) {
+				if r := v.sourceAt(v.start(block.Nodes[i+1])); r == '(' || r == '[' {
+					v.write(";")
+				}
+			} else if block.Tail != nil {
+				if r := v.sourceAt(v.start(block.Tail)); strings.ContainsRune("([-!~^&@", r) {
+					v.write(";")
+				}
+			}
+		}
+		v.newline()
+	}
+	if block.Tail != nil {
+		v.item(v.start(block.Tail))
+		v.expr(block.Tail)
+		v.newline()
+	}
+	v.flush(block.Where().End())
+	v.indent--
+	v.write("}")
+}
+
+// isConditional 以代码块结束、后面不能加分号的语句，参见parseNode
+func isConditional(node ParseNode) bool {
+	switch node.(type) {
+	case *IfStatNode, *MatchStatNode, *LoopStatNode, *BlockStatNode:
+		return true
+	}
+	return false
+}
+
+func (v *printer) stat(node ParseNode) {
+	switch n := node.(type) {
+	case *IfStatNode:
+		for i, part := range n.Parts {
+			if i > 0 {
+				v.write(" " + KEYWORD_ELSE + " ")
+			}
+			v.write(KEYWORD_IF + " ")
+			v.expr(part.Condition)
+			v.write(" ")
+			v.block(part.Body)
+		}
+		if n.ElseBody != nil {
+			v.write(" " + KEYWORD_ELSE + " ")
+			v.block(n.ElseBody)
+		}
+
+	case *MatchStatNode:
+		v.write(KEYWORD_MATCH + " ")
+		v.expr(n.Value)
+		v.write(" ")
+		v.list("{", "}", len(n.Cases), n.Where(), len(n.Cases) > 0,
+			func(i int) lexer.Position { return n.Cases[i].Where().Start() },
+			func(i int) {
+				v.expr(n.Cases[i].Pattern)
+				v.write(" => ")
+				if n.Cases[i].Value != nil {
+					v.expr(n.Cases[i].Value)
+				} else if body, ok := n.Cases[i].Body.(*BlockNode); ok {
+					v.block(body)
+				} else {
+					v.stat(n.Cases[i].Body)
+				}
+			})
+
+	case *LoopStatNode:
+		v.write(KEYWORD_FOR + " ")
+		if n.Iterable != nil {
+			v.write(n.Variable.Value + " " + KEYWORD_IN + " ")
+			v.expr(n.Iterable)
+			v.write(" ")
+		} else if n.Condition != nil {
+			v.expr(n.Condition)
+			v.write(" ")
+		}
+		v.block(n.Body)
+
+	case *BlockStatNode:
+		if n.Body.NonScoping {
+			v.write(KEYWORD_DO + " ")
+		} else if n.Body.Unsafe {
+			v.write(KEYWORD_UNSAFE + " ")
+		}
+		v.block(n.Body)
+
+	case *ReturnStatNode:
+		v.write(KEYWORD_RETURN)
+		if n.Value != nil {
+			v.write(" ")
+			v.expr(n.Value)
+		}
+
+	case *BreakStatNode:
+		v.write(KEYWORD_BREAK)
+
+	case *ContinueStatNode:
+		v.write(KEYWORD_CONTINUE)
+
+	case *DeferStatNode:
+		v.write(KEYWORD_DEFER + " ")
+		v.expr(n.Call)
+
+	case *StaticAssertNode:
+		v.write(KEYWORD_STATIC_ASSERT + "(")
+		v.expr(n.Cond)
+		if n.Message != nil {
+			v.write(", ")
+			v.expr(n.Message)
+		}
+		v.write(")")
+
+	case *VolatileStoreStatNode:
+		v.write(KEYWORD_VOLATILE_STORE + "(")
+		v.expr(n.Pointer)
+		v.write(", ")
+		v.expr(n.Value)
+		v.write(")")
+
+	case *CallStatNode:
+		v.expr(n.Call)
+
+	case *AssignStatNode:
+		v.expr(n.Target)
+		v.write(" = ")
+		v.expr(n.Value)
+
+	case *BinopAssignStatNode:
+		v.expr(n.Target)
+		v.write(" " + n.Operator.OpString() + "= ")
+		v.expr(n.Value)
+
+	default:
+		v.expr(node)
+	}
+}
+
+// call 输出 name(args)，用于内建函数
+func (v *printer) call(name string, args ...ParseNode) {
+	v.write(name + "(")
+	for i, arg := range args {
+		if i > 0 {
+			v.write(", ")
+		}
+		v.expr(arg)
+	}
+	v.write(")")
+}
+
+// exprOrType sizeof 和 alignof 的参数是表达式或者类型
+func (v *printer) exprOrType(name string, value ParseNode, typ *TypeReferenceNode) {
+	v.write(name + "(")
+	if value != nil {
+		v.expr(value)
+	} else {
+		v.typeRef(typ)
+	}
+	v.write(")")
+}
+
+// operand 输出一元运算符的操作数。词法分析会把两个相邻的运算符合并为一个（@、^ 和 = 除外），如 - -x，
+// 操作数以这样的运算符开头时用空格分开
+func (v *printer) operand(node ParseNode) {
+	switch n := node.(type) {
+	case *UnaryExprNode:
+		if n.Operator != UNOP_DEREF {
+			v.write(" ")
+		}
+	case *AddrofExprNode:
+		if n.IsReference {
+			v.write(" ")
+		}
+	}
+	v.expr(node)
+}
+
+func (v *printer) expr(node ParseNode) {
+	switch n := node.(type) {
+	case *CondExprNode:
+		v.stat(n.Stat)
+
+	case *BinaryExprNode:
+		v.expr(n.Lhand)
+		v.write(" " + n.Operator.OpString() + " ")
+		v.expr(n.Rhand)
+
+	case *UnaryExprNode:
+		v.write(n.Operator.OpString())
+		v.operand(n.Value)
+
+	case *AddrofExprNode:
+		if n.IsReference {
+			v.write("&")
+		} else {
+			v.write("^")
+		}
+		if n.Mutable {
+			v.write(KEYWORD_VAR + " ")
+			v.expr(n.Value)
+		} else {
+			v.operand(n.Value)
+		}
+
+	case *CastExprNode:
+		v.typeRef(n.Type)
+		v.write("(")
+		v.expr(n.Value)
+		v.write(")")
+
+	case *CallExprNode:
+		v.expr(n.Function)
+		v.nodes(n.Arguments, "(", ")", n.Where(), v.expr)
+
+	case *VariableAccessNode:
+		v.name(n.Name)
+		if len(n.GenericParameters) > 0 {
+			v.write("<")
+			v.typeRefs(n.GenericParameters)
+			v.write(">")
+		}
+
+	case *StructAccessNode:
+		v.expr(n.Struct)
+		v.write("." + n.Member.Value)
+
+	case *ArrayAccessNode:
+		v.expr(n.Array)
+		v.write("[")
+		v.expr(n.Index)
+		v.write("]")
+
+	case *SliceNode:
+		v.expr(n.Array)
+		v.write("[")
+		if n.Low != nil {
+			v.expr(n.Low)
+		}
+		v.write(":")
+		if n.High != nil {
+			v.expr(n.High)
+		}
+		v.write("]")
+
+	case *TupleLiteralNode:
+		v.nodes(n.Values, "(", ")", n.Where(), v.expr)
+
+	case *CompositeLiteralNode:
+		if n.Type != nil {
+			v.typeRef(n.Type)
+		}
+		v.list("{", "}", len(n.Values), n.Where(), len(n.Values) > 0 && multiline(n.Values[len(n.Values)-1], n.Where()),
+			func(i int) lexer.Position {
+				if !n.Fields[i].IsEmpty() {
+					return n.Fields[i].Where.Start()
+				}
+				return v.start(n.Values[i])
+			},
+			func(i int) {
+				if !n.Fields[i].IsEmpty() {
+					v.write(n.Fields[i].Value + ": ")
+				}
+				v.expr(n.Values[i])
+			})
+
+	case *LambdaExprNode:
+		v.function(n.Function, false)
+
+	case *ArrayLenExprNode:
+		v.call(KEYWORD_LEN, n.ArrayExpr)
+	case *SizeofExprNode:
+		v.exprOrType(KEYWORD_SIZEOF, n.Value, n.Type)
+	case *AlignofExprNode:
+		v.exprOrType(KEYWORD_ALIGNOF, n.Value, n.Type)
+	case *OffsetofExprNode:
+		v.write(KEYWORD_OFFSETOF + "(")
+		v.typeRef(n.Type)
+		v.write(", " + n.Member.Value + ")")
+	case *OverflowArithExprNode:
+		v.call(OverflowArithName(n.Mode, n.Operator), n.Lhand, n.Rhand)
+	case *FloatBuiltinExprNode:
+		v.call(n.Builtin.String(), n.Arguments...)
+	case *BitcastExprNode:
+		v.write(KEYWORD_BITCAST + "<")
+		v.typeRef(n.Type)
+		v.write(">")
+		v.call("", n.Value)
+	case *VolatileLoadExprNode:
+		v.call(KEYWORD_VOLATILE_LOAD, n.Pointer)
+	case *CStringExprNode:
+		v.call(KEYWORD_CSTR, n.Value)
+	case *HashExprNode:
+		v.call(KEYWORD_HASHOF, n.Value)
+	case *NewExprNode:
+		v.write(KEYWORD_NEW + " ")
+		v.expr(n.Value)
+
+	case *DiscardAccessNode:
+		v.write(KEYWORD_DISCARD)
+
+	case *EnumPatternNode:
+		v.name(n.MemberName)
+		if len(n.Names) > 0 {
+			v.write("(")
+			for i, name := range n.Names {
+				if i > 0 {
+					v.write(", ")
+				}
+				v.write(name.Value)
+			}
+			v.write(")")
+		}
+
+	case *BoolLitNode:
+		v.write(strconv.FormatBool(n.Value))
+
+	case *StringLitNode:
+		// 字符串的位置不包括结尾的引号，普通字符串也不包括开头的引号
+		text := v.source.SpanContents(n.Where())
+		if n.IsCString {
+			text = "c\"" + text[strings.IndexRune(text, '"')+1:]
+		} else {
+			text = "\"" + text
+		}
+		v.write(text + "\"")
+
+	default:
+		// 数字和字符常量等按源码原样输出
+		v.write(v.source.SpanContents(node.Where()))
+	}
+}
+
+// alignComments 对齐相邻几行（缩进相同）的行尾注释。行尾注释之前用 \v 标记
+func alignComments(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); {
+		if !strings.Contains(lines[i], "\v") {
+			i++
+			continue
+		}
+
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], "\t"))
+		j, width := i, 0
+		for ; j < len(lines) && strings.Contains(lines[j], "\v"); j++ {
+			if len(lines[j])-len(strings.TrimLeft(lines[j], "\t")) != indent {
+				break
+			}
+			code := lines[j][:strings.Index(lines[j], "\v")]
+			if w := len([]rune(code)); w > width {
+				width = w
+			}
+		}
+
+		for k := i; k < j; k++ {
+			idx := strings.Index(lines[k], "\v")
+			code, comment := lines[k][:idx], lines[k][idx+1:]
+			lines[k] = code + strings.Repeat(" ", width-len([]rune(code))+1) + strings.Replace(comment, "\v", " ", -1)
+		}
+		i = j
+	}
+	return strings.Join(lines, "\n")
+}
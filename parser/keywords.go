@@ -2,8 +2,10 @@ package parser
 
 const (
 	KEYWORD_AS        string = "as"
+	KEYWORD_BITCAST   string = "bitcast"
 	KEYWORD_BREAK     string = "break"
 	KEYWORD_C         string = "C"
+	KEYWORD_CSTR      string = "cstr"
 	KEYWORD_DEFER     string = "defer"
 	KEYWORD_DISCARD   string = "_"
 	KEYWORD_DO        string = "do"
@@ -16,26 +18,48 @@ const (
 	KEYWORD_LEN       string = "len"
 	KEYWORD_IF        string = "if"
 	KEYWORD_MATCH     string = "match"
+	KEYWORD_NEW       string = "new"
 	KEYWORD_LET       string = "let"
 	KEYWORD_VAR       string = "var"
 	KEYWORD_CONTINUE  string = "continue"
 	KEYWORD_PUB       string = "pub"
+	KEYWORD_PRIV      string = "priv"
 	KEYWORD_RETURN    string = "return"
 	KEYWORD_SIZEOF    string = "sizeof"
+	KEYWORD_ALIGNOF   string = "alignof"
+	KEYWORD_OFFSETOF  string = "offsetof"
+	KEYWORD_HASHOF    string = "hashof"
 	KEYWORD_STRUCT    string = "struct"
 	KEYWORD_INTERFACE string = "interface"
 	KEYWORD_TRUE      string = "true"
+	KEYWORD_UNION     string = "union"
+	KEYWORD_UNSAFE    string = "unsafe"
 	KEYWORD_USE       string = "use"
 	KEYWORD_VOID      string = "void"
 	KEYWORD_THIS      string = "this"
 	KEYWORD_IN        string = "in"
 	KEYWORD_STATIC    string = "static"
+
+	KEYWORD_STATIC_ASSERT  string = "static_assert"
+	KEYWORD_VOLATILE_LOAD  string = "volatile_load"
+	KEYWORD_VOLATILE_STORE string = "volatile_store"
+)
+
+// where子句的关键字。它不是保留关键字，只在函数头的参数列表之后表示where子句，参见 parser.whereClauseAhead
+const KEYWORD_WHERE string = "where"
+
+// 浮点数特殊值的名字。它们不是保留关键字，作用域中没有同名的标识符时才表示特殊值，参见 ast.Resolver
+const (
+	FLOAT_NAN string = "nan"
+	FLOAT_INF string = "inf"
 )
 
 var keywordList = []string{
 	KEYWORD_AS,
+	KEYWORD_BITCAST,
 	KEYWORD_BREAK,
 	KEYWORD_C,
+	KEYWORD_CSTR,
 	KEYWORD_DEFER,
 	KEYWORD_DISCARD,
 	KEYWORD_DO,
@@ -48,20 +72,30 @@ var keywordList = []string{
 	KEYWORD_LEN,
 	KEYWORD_IF,
 	KEYWORD_MATCH,
+	KEYWORD_NEW,
 	KEYWORD_LET,
 	KEYWORD_VAR,
 	KEYWORD_CONTINUE,
 	KEYWORD_PUB,
+	KEYWORD_PRIV,
 	KEYWORD_RETURN,
 	KEYWORD_SIZEOF,
+	KEYWORD_ALIGNOF,
+	KEYWORD_OFFSETOF,
+	KEYWORD_HASHOF,
 	KEYWORD_STRUCT,
 	KEYWORD_INTERFACE,
 	KEYWORD_TRUE,
+	KEYWORD_UNION,
+	KEYWORD_UNSAFE,
 	KEYWORD_USE,
 	KEYWORD_VOID,
 	KEYWORD_THIS,
 	KEYWORD_IN,
 	KEYWORD_STATIC,
+	KEYWORD_STATIC_ASSERT,
+	KEYWORD_VOLATILE_LOAD,
+	KEYWORD_VOLATILE_STORE,
 }
 
 // Contains a map with all keywords as keys, and true as values
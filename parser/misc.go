@@ -62,3 +62,17 @@ func UnescapeString(s string) (string, error) {
 
 	return string(out), nil
 }
+
+// EscapeString 与 UnescapeString 相反，把字符串写成字面量的内容。quote是字面量两边的引号
+func EscapeString(s string, quote rune) string {
+	var out []rune
+	for _, r := range s {
+		index := strings.IndexRune(SIMPLE_ESCAPE_VALUES, r)
+		if index < 0 || (r != quote && (r == '\'' || r == '"')) {
+			out = append(out, r)
+		} else {
+			out = append(out, '\\', []rune(SIMPLE_ESCAPE_NAMES)[index])
+		}
+	}
+	return string(out)
+}
@@ -103,10 +103,20 @@ func newBinOpPrecedenceMap() map[BinOpType]int {
 
 	for i, list := range precedences {
 		for _, op := range list {
+			if _, ok := m[op]; ok {
+				panic("INTERNAL ERROR: Binary operator `" + op.OpString() + "` has multiple precedences")
+			}
 			m[op] = i + 1
 		}
 	}
 
+	// 每个二元操作符都必须有优先级，否则表达式解析时会被当成非法操作符
+	for op := BINOP_ERR + 1; int(op) < len(binOpStrings); op++ {
+		if _, ok := m[op]; !ok {
+			panic("INTERNAL ERROR: Missing precedence for binary operator `" + op.OpString() + "`")
+		}
+	}
+
 	return m
 }
 
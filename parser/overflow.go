@@ -0,0 +1,51 @@
+package parser
+
+// OverflowMode 整数运算内建函数在溢出时的行为
+type OverflowMode int
+
+const (
+	OVERFLOW_CHECKED    OverflowMode = iota // checked_*，返回 (结果, 是否溢出)
+	OVERFLOW_WRAPPING                       // wrapping_*，按补码回绕
+	OVERFLOW_SATURATING                     // saturating_*，截断到类型的最小值或最大值
+)
+
+func (v OverflowMode) String() string {
+	switch v {
+	case OVERFLOW_CHECKED:
+		return "checked"
+	case OVERFLOW_WRAPPING:
+		return "wrapping"
+	case OVERFLOW_SATURATING:
+		return "saturating"
+	default:
+		panic("missing overflow mode")
+	}
+}
+
+type overflowArith struct {
+	Mode     OverflowMode
+	Operator BinOpType
+}
+
+// 所有的溢出控制内建函数，如 checked_add(a, b)。
+// 饱和乘法没有对应的LLVM内部函数，所以没有 saturating_mul
+var overflowArithNames = map[string]overflowArith{
+	"checked_add":    {OVERFLOW_CHECKED, BINOP_ADD},
+	"checked_sub":    {OVERFLOW_CHECKED, BINOP_SUB},
+	"checked_mul":    {OVERFLOW_CHECKED, BINOP_MUL},
+	"wrapping_add":   {OVERFLOW_WRAPPING, BINOP_ADD},
+	"wrapping_sub":   {OVERFLOW_WRAPPING, BINOP_SUB},
+	"wrapping_mul":   {OVERFLOW_WRAPPING, BINOP_MUL},
+	"saturating_add": {OVERFLOW_SATURATING, BINOP_ADD},
+	"saturating_sub": {OVERFLOW_SATURATING, BINOP_SUB},
+}
+
+// OverflowArithName 返回溢出控制内建函数的名字，如 checked_add
+func OverflowArithName(mode OverflowMode, op BinOpType) string {
+	for name, arith := range overflowArithNames {
+		if arith.Mode == mode && arith.Operator == op {
+			return name
+		}
+	}
+	panic("INTERNAL ERROR: Missing overflow arithmetic builtin for `" + mode.String() + " " + op.OpString() + "`")
+}
@@ -94,6 +94,19 @@ type UseDirectiveNode struct {
 	Module *NameNode
 }
 
+// WarnDirectiveNode #warn(off, "unused")：在整个文件中关闭或打开警告，或者把它当作错误
+type WarnDirectiveNode struct {
+	baseNode
+	Level LocatedString // off、on 或 error
+	Name  LocatedString
+}
+
+// FeatureDirectiveNode #feature("name")：在整个文件中启用语言特性
+type FeatureDirectiveNode struct {
+	baseNode
+	Feature LocatedString
+}
+
 // types
 type ReferenceTypeNode struct {
 	baseNode
@@ -124,6 +137,7 @@ type ArrayTypeNode struct {
 	MemberType    *TypeReferenceNode
 	IsFixedLength bool
 	Length        int
+	LengthExpr    ParseNode // 长度不是整数字面量时的常量表达式，如 [N * 2]u8
 }
 
 type NamedTypeNode struct {
@@ -143,11 +157,14 @@ type DeclNode interface {
 	ParseNode
 	IsPublic() bool // only used for top-level nodes
 	SetPublic(bool)
+	IsFilePrivate() bool // 只在声明所在的文件中可见（priv），同样只用于顶层节点
+	SetFilePrivate(bool)
 }
 
 type baseDecl struct {
 	baseNode
-	public bool
+	public      bool
+	filePrivate bool
 }
 
 func (v *baseDecl) SetPublic(p bool) {
@@ -158,6 +175,14 @@ func (v baseDecl) IsPublic() bool {
 	return v.public
 }
 
+func (v *baseDecl) SetFilePrivate(p bool) {
+	v.filePrivate = p
+}
+
+func (v baseDecl) IsFilePrivate() bool {
+	return v.filePrivate
+}
+
 type InterfaceTypeNode struct {
 	baseNode
 	Functions    []*FunctionHeaderNode
@@ -166,8 +191,10 @@ type InterfaceTypeNode struct {
 
 type StructTypeNode struct {
 	baseNode
-	Members      []*StructMemberNode
-	GenericSigil *GenericSigilNode
+	Members       []*StructMemberNode
+	StaticMembers []*VarDeclNode // 静态成员 static let MAX int = 100，只能在类型定义中声明
+	GenericSigil  *GenericSigilNode
+	IsUnion       bool // union：所有成员从同一个地址开始，互相重叠
 }
 
 type StructMemberNode struct {
@@ -186,8 +213,9 @@ type FunctionHeaderNode struct {
 	ReturnType   *TypeReferenceNode
 	Variadic     bool
 
-	StaticReceiverType *NamedTypeNode // use this if static
-	Receiver           *VarDeclNode   // use this if not static. this would be so much nicer with tagged unions...
+	StaticReceiverType  *NamedTypeNode    // use this if static
+	StaticReceiverSigil *GenericSigilNode // 静态方法的类型的泛型参数，如 fun static List<T>.make() 中的<T>
+	Receiver            *VarDeclNode      // use this if not static. this would be so much nicer with tagged unions...
 }
 
 type FunctionNode struct {
@@ -246,6 +274,7 @@ type TypeDeclNode struct {
 	Name         LocatedString
 	GenericSigil *GenericSigilNode
 	Type         ParseNode
+	Alias        bool // 类型别名 type Name<T> = Type，Type是TypeReferenceNode。只有别名可以在名称后声明泛型参数
 }
 
 type GenericSigilNode struct {
@@ -265,6 +294,20 @@ type DeferStatNode struct {
 	Call *CallExprNode
 }
 
+// StaticAssertNode 编译期断言 static_assert(cond, "message")，可以在顶层或者语句中使用
+type StaticAssertNode struct {
+	baseNode
+	Cond    ParseNode
+	Message *StringLitNode // 可以省略
+}
+
+// VolatileStoreStatNode volatile_store(ptr, value)
+type VolatileStoreStatNode struct {
+	baseNode
+	Pointer ParseNode
+	Value   ParseNode
+}
+
 type IfStatNode struct {
 	baseNode
 	Parts    []*ConditionBodyNode
@@ -286,13 +329,18 @@ type MatchStatNode struct {
 type MatchCaseNode struct {
 	baseNode
 	Pattern ParseNode
-	Body    ParseNode
+	Body    ParseNode // 代码块或者语句
+	Value   ParseNode // 分支的值，如 A => 1 中的 1。有值时Body为nil
 }
 
 type LoopStatNode struct {
 	baseNode
 	Condition ParseNode
 	Body      *BlockNode
+
+	// for-in循环的变量和迭代的值，Iterable为nil时不是for-in循环
+	Variable LocatedString
+	Iterable ParseNode
 }
 
 type ReturnStatNode struct {
@@ -308,7 +356,15 @@ type BlockStatNode struct {
 type BlockNode struct {
 	baseNode
 	NonScoping bool
+	Unsafe     bool // unsafe { ... }
 	Nodes      []ParseNode
+	Tail       ParseNode // 最后的不是语句的表达式，是代码块的值，如 if c { 1 } else { 2 } 中的 1 和 2
+}
+
+// CondExprNode 作为表达式的if或match语句，值是执行的分支的值
+type CondExprNode struct {
+	baseNode
+	Stat ParseNode // *IfStatNode 或 *MatchStatNode
 }
 
 type CallStatNode struct {
@@ -356,6 +412,63 @@ type SizeofExprNode struct {
 	Type  *TypeReferenceNode
 }
 
+type AlignofExprNode struct {
+	baseNode
+	Value ParseNode
+	Type  *TypeReferenceNode
+}
+
+type OffsetofExprNode struct {
+	baseNode
+	Type   *TypeReferenceNode
+	Member LocatedString
+}
+
+type FloatBuiltinExprNode struct {
+	baseNode
+	Builtin   FloatBuiltin
+	Arguments []ParseNode
+}
+
+// BitcastExprNode bitcast<T>(value)
+type BitcastExprNode struct {
+	baseNode
+	Type  *TypeReferenceNode
+	Value ParseNode
+}
+
+// VolatileLoadExprNode volatile_load(ptr)
+type VolatileLoadExprNode struct {
+	baseNode
+	Pointer ParseNode
+}
+
+// CStringExprNode cstr(value)
+type CStringExprNode struct {
+	baseNode
+	Value ParseNode
+}
+
+// HashExprNode hashof(value)
+type HashExprNode struct {
+	baseNode
+	Value ParseNode
+}
+
+// NewExprNode new value，如 new Point{x: 1} 或 new Vec(1, 2)
+type NewExprNode struct {
+	baseNode
+	Value ParseNode
+}
+
+type OverflowArithExprNode struct {
+	baseNode
+	Mode     OverflowMode
+	Operator BinOpType
+	Lhand    ParseNode
+	Rhand    ParseNode
+}
+
 type AddrofExprNode struct {
 	baseNode
 	Value       ParseNode
@@ -406,6 +519,14 @@ type ArrayAccessNode struct {
 	Index ParseNode
 }
 
+// SliceNode 切片 a[low:high]，省略的一端为nil
+type SliceNode struct {
+	baseNode
+	Array ParseNode
+	Low   ParseNode
+	High  ParseNode
+}
+
 type DiscardAccessNode struct {
 	baseNode
 }
@@ -441,6 +562,7 @@ type NumberLitNode struct {
 	IntValue   *big.Int
 	FloatValue float64
 	FloatSize  rune
+	IsDuration bool // 时长字面量，IntValue是纳秒数
 }
 
 type StringLitNode struct {
@@ -6,7 +6,6 @@ package parser
 import (
 	"fmt"
 	"math/big"
-	"os"
 	"strconv"
 	"strings"
 	"unicode"
@@ -74,26 +73,26 @@ func (v *parser) errPos(err string, stuff ...interface{}) {
 
 func (v *parser) errTokenSpecific(tok *lexer.Token, err string, stuff ...interface{}) {
 	v.dumpRules()
-	log.Errorln("parser",
+	log.Errorln(log.TagParser,
 		util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
 		tok.Where.Filename, tok.Where.StartLine, tok.Where.StartChar,
 		fmt.Sprintf(err, stuff...))
 
-	log.Error("parser", v.input.MarkSpan(tok.Where))
+	log.Error(log.TagParser, v.input.MarkSpan(tok.Where))
 
-	os.Exit(util.EXIT_FAILURE_PARSE)
+	util.ExitFunc(util.EXIT_FAILURE_PARSE)
 }
 
 func (v *parser) errPosSpecific(pos lexer.Position, err string, stuff ...interface{}) {
 	v.dumpRules()
-	log.Errorln("parser",
+	log.Errorln(log.TagParser,
 		util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s",
 		pos.Filename, pos.Line, pos.Char,
 		fmt.Sprintf(err, stuff...))
 
-	log.Error("parser", v.input.MarkPos(pos))
+	log.Error(log.TagParser, v.input.MarkPos(pos))
 
-	os.Exit(util.EXIT_FAILURE_PARSE)
+	util.ExitFunc(util.EXIT_FAILURE_PARSE)
 }
 
 // rule operations
@@ -107,7 +106,7 @@ func (v *parser) popRule() {
 }
 
 func (v *parser) dumpRules() {
-	log.Debugln("parser", strings.Join(v.ruleStack, " / "))
+	log.Debugln(log.TagParser, strings.Join(v.ruleStack, " / "))
 }
 
 // peek 向前亏看ahead个Token。
@@ -208,11 +207,16 @@ func (v *parser) expect(typ lexer.TokenType, val string) *lexer.Token {
 
 // parse 语法分析器的主方法，开启分析的循环
 func (v *parser) parse() {
+	v.parseModuleDocComments()
+
 	for v.peek(0) != nil {
 		if n := v.parseDecl(true); n != nil { // 各种定义块，如函数定义，常量定义等
 			v.tree.AddNode(n)
 		} else if n := v.parseToplevelDirective(); n != nil { // 顶层指令，如use语句等
 			v.tree.AddNode(n)
+		} else if n := v.parseStaticAssert(); n != nil { // 编译期断言
+			v.tree.AddNode(n)
+			v.optional(lexer.Separator, ";")
 		} else {
 			v.err("Unexpected token at toplevel: `%s` (%s)", v.peek(0).Contents, v.peek(0).Type)
 		}
@@ -255,12 +259,64 @@ func (v *parser) parseToplevelDirective() ParseNode {
 		res.SetWhere(lexer.NewSpanFromTokens(start, library))
 		return res
 
+	case "warn": // #warn(off, "unused")
+		v.expect(lexer.Separator, "(")
+		level := v.expect(lexer.Identifier, "")
+		if !isWarnLevel(level.Contents) {
+			v.errTokenSpecific(level, "Expected `off`, `on` or `error` in #warn directive, got `%s`", level.Contents)
+		}
+		v.expect(lexer.Separator, ",")
+		name := v.expect(lexer.String, "")
+		end := v.expect(lexer.Separator, ")")
+
+		res := &WarnDirectiveNode{Level: NewLocatedString(level), Name: NewLocatedString(name)}
+		res.SetWhere(lexer.NewSpanFromTokens(start, end))
+		return res
+
+	case "feature": // #feature("name")
+		v.expect(lexer.Separator, "(")
+		feature := v.expect(lexer.String, "")
+		end := v.expect(lexer.Separator, ")")
+
+		res := &FeatureDirectiveNode{Feature: NewLocatedString(feature)}
+		res.SetWhere(lexer.NewSpanFromTokens(start, end))
+		return res
+
 	default:
 		v.errTokenSpecific(directive, "No such directive `%s`", directive.Contents)
 		return nil
 	}
 }
 
+// isWarnLevel #warn 指令的第一个参数是否有效
+func isWarnLevel(level string) bool {
+	return level == "off" || level == "on" || level == "error"
+}
+
+// parseModuleDocComments 分析文件开头的模块文档注释。
+// 文件开头的文档注释后面空一行，或者后面是use语句、文件结尾时，是整个模块的文档，而不属于后面的声明
+func (v *parser) parseModuleDocComments() {
+	var dcs []*DocComment
+	for v.peek(0) != nil && v.peek(0).Type == lexer.Doccomment {
+		// 文档注释之间的空行也把模块文档与后面声明的文档分开
+		if len(dcs) > 0 && v.peek(0).Where.StartLine > dcs[len(dcs)-1].Where.EndLine+1 {
+			break
+		}
+		dcs = append(dcs, newDocComment(v.consumeToken()))
+	}
+	if len(dcs) == 0 {
+		return
+	}
+
+	last, next := dcs[len(dcs)-1], v.peek(0)
+	if next != nil && next.Where.StartLine <= last.Where.EndLine+1 && !(next.Type == lexer.Identifier && next.Contents == KEYWORD_USE) {
+		// 紧跟着声明，属于这个声明。把文档注释还回去
+		v.currentToken -= len(dcs)
+		return
+	}
+	v.tree.SetDocComments(dcs)
+}
+
 // parseDocComments 分析文档注释
 func (v *parser) parseDocComments() []*DocComment {
 	defer un(trace(v, "doccomments"))
@@ -268,21 +324,24 @@ func (v *parser) parseDocComments() []*DocComment {
 	var dcs []*DocComment
 
 	for v.nextIs(lexer.Doccomment) {
-		tok := v.consumeToken()
+		dcs = append(dcs, newDocComment(v.consumeToken()))
+	}
 
-		var contents string
-		if strings.HasPrefix(tok.Contents, "/**") {
-			contents = tok.Contents[3 : len(tok.Contents)-2]
-		} else if strings.HasPrefix(tok.Contents, "///") {
-			contents = tok.Contents[3:]
-		} else {
-			panic(fmt.Sprintf("How did this doccomment get through the lexer??\n`%s`", tok.Contents))
-		}
+	return dcs
+}
 
-		dcs = append(dcs, &DocComment{Where: tok.Where, Contents: contents})
+// newDocComment 去掉文档注释Token的注释符号
+func newDocComment(tok *lexer.Token) *DocComment {
+	var contents string
+	if strings.HasPrefix(tok.Contents, "/**") {
+		contents = tok.Contents[3 : len(tok.Contents)-2]
+	} else if strings.HasPrefix(tok.Contents, "///") {
+		contents = tok.Contents[3:]
+	} else {
+		panic(fmt.Sprintf("How did this doccomment get through the lexer??\n`%s`", tok.Contents))
 	}
 
-	return dcs
+	return &DocComment{Where: tok.Where, Contents: contents}
 }
 
 // parseAttributes 分析标注
@@ -310,6 +369,16 @@ func (v *parser) parseAttributes() AttrGroup {
 			if v.tokenMatches(0, lexer.Operator, "=") {
 				v.consumeToken()
 				attr.Value = v.expect(lexer.String, "").Contents
+			} else if v.tokenMatches(0, lexer.Separator, "(") {
+				// 另一种写法：[key(value)]，值是一个标识符，如 [repr(u8)]；
+				// 或者 [key(name = "value")]，值记为 name="value"，如 [cfg(feature = "json")]
+				v.consumeToken()
+				attr.Value = v.expect(lexer.Identifier, "").Contents
+				if v.tokenMatches(0, lexer.Operator, "=") {
+					v.consumeToken()
+					attr.Value += "=" + strconv.Quote(v.expect(lexer.String, "").Contents)
+				}
+				v.expect(lexer.Separator, ")")
 			}
 
 			if attrs.Set(attr.Key, attr) {
@@ -359,10 +428,10 @@ func (v *parser) parseName() *NameNode {
 
 // parseDecl 解析各种定义语句。
 // 包括：
-//    - 类型定义 TypeDecl
-//    - 函数定义 FuncDecl
-//    - 变量定义 VarDecl （其实主要是常量）
-//    - 解构变量定义 DestructVarDecl 这个是支持多变量定义的特殊语法
+//   - 类型定义 TypeDecl
+//   - 函数定义 FuncDecl
+//   - 变量定义 VarDecl （其实主要是常量）
+//   - 解构变量定义 DestructVarDecl 这个是支持多变量定义的特殊语法
 func (v *parser) parseDecl(isTopLevel bool) ParseNode {
 	defer un(trace(v, "decl"))
 
@@ -372,12 +441,15 @@ func (v *parser) parseDecl(isTopLevel bool) ParseNode {
 	docComments := v.parseDocComments()
 	attrs := v.parseAttributes()
 
-	// 解析pub属性
-	var pub bool
+	// 解析pub属性，或者只在本文件中可见的priv属性
+	var pub, priv bool
 	if isTopLevel {
 		if v.tokenMatches(0, lexer.Identifier, KEYWORD_PUB) {
 			pub = true
 			v.consumeToken()
+		} else if v.tokenMatches(0, lexer.Identifier, KEYWORD_PRIV) {
+			priv = true
+			v.consumeToken()
 		}
 	}
 	// 解析不同类型的定义块
@@ -389,12 +461,18 @@ func (v *parser) parseDecl(isTopLevel bool) ParseNode {
 		res = varDecl
 	} else if varTupleDecl := v.parseDestructVarDecl(isTopLevel); varTupleDecl != nil { // 多变量定义
 		res = varTupleDecl
+	} else if isTopLevel && attrs != nil && !pub && !priv && v.tokenMatches(0, lexer.Identifier, KEYWORD_USE) {
+		// 带标注的use语句，如 [cfg(feature = "json")] use json
+		use := v.parseToplevelDirective()
+		use.SetAttrs(attrs)
+		return use
 	} else {
 		return nil
 	}
 
-	// 将开头解析的pub属性、文档注释和标注添加到解析结果中
+	// 将开头解析的pub/priv属性、文档注释和标注添加到解析结果中
 	res.(DeclNode).SetPublic(pub)
+	res.(DeclNode).SetFilePrivate(priv)
 
 	if len(docComments) != 0 {
 		res.SetDocComments(docComments)
@@ -419,9 +497,15 @@ func (v *parser) parseFuncDecl(isTopLevel bool) *FunctionDeclNode {
 	return res
 }
 
-// parseLambdaExpr 解析lambda函数定义
+// parseLambdaExpr 解析lambda函数定义。
+// 完整的形式是 fun (a int, b int) int => a + b，也可以省略fun关键字：(a, b) => a + b
 func (v *parser) parseLambdaExpr() *LambdaExprNode {
-	fn := v.parseFunc(true, false)
+	var fn *FunctionNode
+	if v.isShortLambda() {
+		fn = v.parseFuncBody(v.parseShortLambdaHeader(), false)
+	} else {
+		fn = v.parseFunc(true, false)
+	}
 	if fn == nil {
 		return nil
 	}
@@ -443,6 +527,11 @@ func (v *parser) parseFunc(lambda bool, topLevelNode bool) *FunctionNode {
 		return nil
 	}
 
+	return v.parseFuncBody(funcHeader, topLevelNode)
+}
+
+// parseFuncBody 分析函数头之后的函数体：代码块、=> 之后的语句或表达式，或者直接以;结束
+func (v *parser) parseFuncBody(funcHeader *FunctionHeaderNode, topLevelNode bool) *FunctionNode {
 	var body *BlockNode
 	var stat, expr ParseNode
 	var end lexer.Position
@@ -485,8 +574,7 @@ func (v *parser) parseFunc(lambda bool, topLevelNode bool) *FunctionNode {
 func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 	defer un(trace(v, "funcheader"))
 
-	// 函数头必须以fun关键字开头。
-	// TODO: 未来应当让lambda不需要使用fun，而是直接 (a int, b int) => a + b 即可
+	// 函数头必须以fun关键字开头。省略fun的lambda参见 parseShortLambdaHeader
 	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_FUN) {
 		return nil
 	}
@@ -528,8 +616,19 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 				if typ == nil {
 					v.currentToken = pos
 				} else {
+					// 泛型类型的静态方法：fun static List<T>.make()。<...>后面没有"."时是函数自己的泛型参数，如 fun static Maybe.of<T>()
+					var sigil *GenericSigilNode
+					if sigilPos := v.currentToken; v.tokenMatches(0, lexer.Operator, "<") {
+						sigil = v.parseGenericSigil()
+						if !v.tokenMatches(0, lexer.Separator, ".") {
+							v.currentToken = sigilPos
+							sigil = nil
+						}
+					}
+
 					if v.tokenMatches(0, lexer.Separator, ".") { // 后面还有 ".name" 的形式
 						res.StaticReceiverType = typ
+						res.StaticReceiverSigil = sigil
 						v.expect(lexer.Separator, ".")
 					} else if v.tokenMatches(0, lexer.Separator, "(") || v.tokenMatches(0, lexer.Operator, "<") { // 已经解析到了"("说明解析过头了，把名字也包含进类型了
 						if len(typ.Name.Modules) == 0 { // 只解析出了一个名字，在static情况下应该是错误的
@@ -542,7 +641,7 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 						}
 					}
 				}
-			} else {
+			} else if !v.constrainedSigilAhead() {
 				// 先尝试解析一个类型名称，后面应当接着一个"."
 				typ := v.parseTypeReference(true, false, true)
 				wtyp := typ
@@ -601,14 +700,14 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 								// Deal with genericarguments
 							}
 						} else {
-							log.Debugln("parser", "parsed a non namednode in fun header:%#v", typ)
+							log.Debugln(log.TagParser, "parsed a non namednode in fun header:%#v", typ)
 						}
 					}
 				}
 			}
 		}
 
-		log.Debugln("parser", "parsed now: %#v", res)
+		log.Debugln(log.TagParser, "parsed now: %#v", res)
 
 		if name == nil {
 			// 函数名
@@ -622,7 +721,161 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 	// 函数名后面接着泛型声明
 	genericSigil := v.parseGenericSigil()
 
-	// 然后是参数列表，以(开头
+	// 然后是参数列表
+	args, variadic, maybeEndToken := v.parseFunParams(lambda)
+
+	// 解析返回类型。可能为空
+	var returnType *TypeReferenceNode
+	if !v.whereClauseAhead() {
+		returnType = v.parseTypeReference(true, false, true)
+	}
+
+	res.Arguments = args
+	res.Variadic = variadic
+	res.GenericSigil = genericSigil
+	res.Anonymous = lambda
+
+	if returnType != nil {
+		res.ReturnType = returnType
+		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), returnType.Where().End()))
+	} else {
+		res.SetWhere(lexer.NewSpanFromTokens(startToken, maybeEndToken))
+	}
+
+	// 最后是where子句
+	if end, ok := v.parseWhereClause(genericSigil); ok {
+		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), end))
+	}
+
+	return res
+}
+
+// whereClauseAhead 接下来是否是where子句。where 不是保留关键字，
+// 只有函数头中参数列表之后的 where 名字: 才是where子句，其他地方的 where 是普通的标识符
+func (v *parser) whereClauseAhead() bool {
+	return v.tokensMatch(lexer.Identifier, KEYWORD_WHERE, lexer.Identifier, "", lexer.Operator, ":")
+}
+
+// parseWhereClause 分析函数头最后的where子句，如 where T: Ord & Hash, U: Into<T>。
+// 子句中的约束加到泛型声明中同名的类型参数上，与直接写在泛型声明中的约束相同。
+// 返回子句的结束位置，没有where子句时第二个返回值为false
+func (v *parser) parseWhereClause(sigil *GenericSigilNode) (lexer.Position, bool) {
+	if !v.whereClauseAhead() {
+		return lexer.Position{}, false
+	}
+	v.consumeToken()
+
+	var end lexer.Position
+	for {
+		clause := v.parseTypeParameter()
+		if len(clause.Constraints) == 0 {
+			v.errPosSpecific(clause.Where().Start(), "Expected `:` and constraints after `%s` in where clause", clause.Name.Value)
+		}
+
+		var param *TypeParameterNode
+		if sigil != nil {
+			for _, par := range sigil.GenericParameters {
+				if par.Name.Value == clause.Name.Value {
+					param = par
+					break
+				}
+			}
+		}
+		if param == nil {
+			v.errPosSpecific(clause.Where().Start(), "`%s` in where clause is not a type parameter of the function", clause.Name.Value)
+		}
+		param.Constraints = append(param.Constraints, clause.Constraints...)
+		end = clause.Where().End()
+
+		if !v.tokenMatches(0, lexer.Separator, ",") {
+			break
+		}
+		v.consumeToken()
+	}
+	return end, true
+}
+
+// parseShortLambdaHeader 分析省略了fun关键字的lambda的函数头，如 (a, b) => a + b 中的 (a, b)。
+// 只在 isShortLambda 判断之后调用
+func (v *parser) parseShortLambdaHeader() *FunctionHeaderNode {
+	defer un(trace(v, "shortlambdaheader"))
+
+	startToken := v.peek(0)
+	args, variadic, endToken := v.parseFunParams(true)
+
+	res := &FunctionHeaderNode{Arguments: args, Variadic: variadic, Anonymous: true}
+	if returnType := v.parseTypeReference(true, false, true); returnType != nil {
+		res.ReturnType = returnType
+		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), returnType.Where().End()))
+	} else {
+		res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	}
+	return res
+}
+
+// isShortLambda 向前查看，判断接下来是否是省略了fun关键字的lambda：
+// 括号中的参数列表，之后可能有返回类型，然后是 =>。
+// 这样与元组常量 (a, b) 和括号中的表达式区分开
+func (v *parser) isShortLambda() bool {
+	if !v.tokenMatches(0, lexer.Separator, "(") {
+		return false
+	}
+
+	// 找到匹配的右括号
+	ahead, depth := 0, 0
+	for ; ; ahead++ {
+		tok := v.peek(ahead)
+		if tok == nil {
+			return false
+		}
+		if tok.Type != lexer.Separator {
+			continue
+		}
+		switch tok.Contents {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ";":
+			return false
+		}
+		if depth == 0 {
+			break
+		}
+	}
+
+	// 跳过返回类型，只可能包含名字、泛型参数、指针、引用、数组、元组和函数类型中的记号，
+	// 逗号只能出现在括号中
+	for ahead++; ; ahead++ {
+		tok := v.peek(ahead)
+		if tok == nil {
+			return false
+		}
+		if depth == 0 && tok.Type == lexer.Operator && tok.Contents == "=>" {
+			return true
+		}
+
+		switch {
+		case tok.Type == lexer.Identifier, tok.Type == lexer.Number:
+		case tok.Type == lexer.Operator && (tok.Contents == "^" || tok.Contents == "&"):
+		case tok.Contents == "(" || tok.Contents == "[" || tok.Contents == "<":
+			depth++
+		case tok.Contents == ")" || tok.Contents == "]" || tok.Contents == ">":
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case tok.Type == lexer.Separator && (tok.Contents == "." || (tok.Contents == "," && depth > 0)):
+		default:
+			return false
+		}
+	}
+}
+
+// parseFunParams 分析函数的参数列表，返回参数、是否是可变参数，以及结尾的右括号。
+// lambda的参数可以省略类型
+func (v *parser) parseFunParams(lambda bool) ([]*VarDeclNode, bool, *lexer.Token) {
+	// 参数列表以(开头
 	v.expect(lexer.Separator, "(")
 
 	var args []*VarDeclNode
@@ -642,7 +895,7 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 				v.err("Duplicate `...` in function arguments")
 			}
 		} else { // 否则每个参数是一个变量定义块
-			arg := v.parseParaDecl(false)
+			arg := v.parseParaDecl(false, lambda)
 			if arg == nil {
 				v.err("Expected valid variable declaration in function args")
 			}
@@ -656,25 +909,36 @@ func (v *parser) parseFunHeader(lambda bool) *FunctionHeaderNode {
 	}
 
 	// 参数列表结束
-	maybeEndToken := v.expect(lexer.Separator, ")")
-
-	// 解析返回类型。可能为空
-	var returnType *TypeReferenceNode
-	returnType = v.parseTypeReference(true, false, true)
-
-	res.Arguments = args
-	res.Variadic = variadic
-	res.GenericSigil = genericSigil
-	res.Anonymous = lambda
+	endToken := v.expect(lexer.Separator, ")")
+	return args, variadic, endToken
+}
 
-	if returnType != nil {
-		res.ReturnType = returnType
-		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), returnType.Where().End()))
-	} else {
-		res.SetWhere(lexer.NewSpanFromTokens(startToken, maybeEndToken))
+// constrainedSigilAhead 接下来是否是 名字<...> 而且尖括号中有 ":"，如 max<T: Comparable<T>>。
+// 类型的泛型实参中不会出现 ":"，所以这是函数名和带约束的泛型参数，不是方法的接收者类型
+func (v *parser) constrainedSigilAhead() bool {
+	i := 0
+	for v.tokenMatches(i, lexer.Identifier, "") || v.tokenMatches(i, lexer.Separator, ".") {
+		i++
+	}
+	if !v.tokenMatches(i, lexer.Operator, "<") {
+		return false
 	}
 
-	return res
+	depth := 0
+	for ; v.peek(i) != nil; i++ {
+		switch {
+		case v.tokenMatches(i, lexer.Operator, "<"):
+			depth++
+		case v.tokenMatches(i, lexer.Operator, ">"):
+			depth--
+			if depth == 0 {
+				return false
+			}
+		case v.tokenMatches(i, lexer.Operator, ":"):
+			return true
+		}
+	}
+	return false
 }
 
 // parseTypeDecl 分析类型定义
@@ -695,6 +959,25 @@ func (v *parser) parseTypeDecl(isTopLevel bool) *TypeDeclNode {
 		v.err("Cannot use reserved keyword `%s` as type name", name.Contents)
 	}
 
+	// 类型别名：type Pair<T> = (T, T)，使用别名的地方直接代入别名的类型
+	sigil := v.parseGenericSigil()
+	if sigil != nil || v.tokenMatches(0, lexer.Operator, "=") {
+		v.expect(lexer.Operator, "=")
+		typ := v.parseTypeReference(true, false, true)
+		if typ == nil {
+			v.err("Expected valid type in declaration of type alias `%s`", name.Contents)
+		}
+
+		res := &TypeDeclNode{
+			Name:         NewLocatedString(name),
+			GenericSigil: sigil,
+			Type:         typ,
+			Alias:        true,
+		}
+		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), typ.Where().End()))
+		return res
+	}
+
 	// 如果直接遇到"{"，则认为后面是一个struct结构体声明。
 	var typ ParseNode
 	if v.tokenMatches(0, lexer.Separator, "{") {
@@ -823,11 +1106,15 @@ func (v *parser) parseVarDecl(isTopLevel bool) *VarDeclNode {
 
 // parseParaDecl 解析变量声明块。用于普通变量的定义，也用于函数定义中的变量列表。
 // 实例：a: string
-func (v *parser) parseParaDecl(isReceiver bool) *VarDeclNode {
+// lambda的参数可以省略类型，如 fun (x) => x + 1，类型由上下文推导得到
+func (v *parser) parseParaDecl(isReceiver bool, typeOptional bool) *VarDeclNode {
 	defer un(trace(v, "vardeclbody"))
 
 	startPos := v.currentToken
 
+	// 参数标注，如 [noalias]、[readonly]
+	attrs := v.parseAttributes()
+
 	// 可修改变量，默认是不可修改的，因此需要加var来指定可修改
 	var mutable *lexer.Token
 	if v.tokenMatches(0, lexer.Identifier, KEYWORD_VAR) {
@@ -843,7 +1130,7 @@ func (v *parser) parseParaDecl(isReceiver bool) *VarDeclNode {
 
 	// 变量类型
 	varType := v.parseTypeReference(true, false, true)
-	if varType == nil && !v.tokenMatches(0, lexer.Operator, "=") {
+	if varType == nil && !typeOptional && !v.tokenMatches(0, lexer.Operator, "=") {
 		v.err("Expected valid type in variable declaration")
 	}
 
@@ -879,8 +1166,14 @@ func (v *parser) parseParaDecl(isReceiver bool) *VarDeclNode {
 	if value != nil {
 		res.Value = value
 		end = value.Where().End()
-	} else {
+	} else if varType != nil {
 		end = varType.Where().End()
+	} else {
+		end = name.Where.End()
+	}
+
+	if attrs != nil {
+		res.SetAttrs(attrs)
 	}
 
 	res.SetWhere(lexer.NewSpan(start, end))
@@ -1058,6 +1351,10 @@ func (v *parser) parseStat() ParseNode {
 		res = continueStat
 	} else if deferStat := v.parseDeferStat(); deferStat != nil { // defer 语句
 		res = deferStat
+	} else if staticAssert := v.parseStaticAssert(); staticAssert != nil { // 编译期断言
+		res = staticAssert
+	} else if volatileStore := v.parseVolatileStoreStat(); volatileStore != nil { // volatile 写
+		res = volatileStore
 	} else if returnStat := v.parseReturnStat(); returnStat != nil { // return 语句
 		res = returnStat
 	} else if callStat := v.parseCallStat(); callStat != nil { // 函数调用语句
@@ -1071,6 +1368,68 @@ func (v *parser) parseStat() ParseNode {
 	return res
 }
 
+// parseStaticAssert 解析编译期断言 static_assert(cond, "message")。
+// 条件在类型推导之后由常量求值器计算，为false时编译失败，参见codegen/LLVMCodegen/staticassert.go
+func (v *parser) parseStaticAssert() *StaticAssertNode {
+	defer un(trace(v, "staticassert"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_STATIC_ASSERT) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+
+	cond := v.parseExpr()
+	if cond == nil {
+		v.err("Expected condition in static assertion")
+	}
+
+	res := &StaticAssertNode{Cond: cond}
+	if v.tokenMatches(0, lexer.Separator, ",") {
+		v.consumeToken()
+		res.Message = v.parseStringLit()
+		if res.Message == nil {
+			v.err("Expected string literal message in static assertion")
+		}
+	}
+
+	endToken := v.expect(lexer.Separator, ")")
+
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// parseVolatileStoreStat 解析 volatile_store(ptr, value)，通过指针ptr写入value，写操作不会被优化掉或者重排
+func (v *parser) parseVolatileStoreStat() *VolatileStoreStatNode {
+	defer un(trace(v, "volatilestorestat"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_VOLATILE_STORE) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+
+	ptr := v.parseExpr()
+	if ptr == nil {
+		v.err("Expected valid pointer expression as first argument to `%s`", KEYWORD_VOLATILE_STORE)
+	}
+
+	v.expect(lexer.Separator, ",")
+
+	value := v.parseExpr()
+	if value == nil {
+		v.err("Expected valid expression as second argument to `%s`", KEYWORD_VOLATILE_STORE)
+	}
+
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &VolatileStoreStatNode{Pointer: ptr, Value: value}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
 // parseDeferStat 解析defer语句
 func (v *parser) parseDeferStat() *DeferStatNode {
 	defer un(trace(v, "deferstat"))
@@ -1186,21 +1545,25 @@ func (v *parser) parseMatchStat() *MatchStatNode {
 		v.expect(lexer.Operator, "=>")
 
 		// 操作代码
-		var body ParseNode
+		var body, value ParseNode
 		if v.tokenMatches(0, lexer.Separator, "{") { // 可以是代码块
 			body = v.parseBlock()
-		} else { // 也可以是单个语句
-			body = v.parseStat()
+		} else if body = v.parseStat(); body == nil { // 也可以是单个语句，或者分支的值
+			value = v.parseValueExpr()
 		}
+		end := body
 		if body == nil {
-			v.err("Expected valid arm statement in match clause")
+			if value == nil {
+				v.err("Expected valid arm statement in match clause")
+			}
+			end = value
 		}
 
 		// 各个模式项之间以逗号分隔
 		v.expect(lexer.Separator, ",")
 
-		caseNode := &MatchCaseNode{Pattern: pattern, Body: body}
-		caseNode.SetWhere(lexer.NewSpan(pattern.Where().Start(), body.Where().End()))
+		caseNode := &MatchCaseNode{Pattern: pattern, Body: body, Value: value}
+		caseNode.SetWhere(lexer.NewSpan(pattern.Where().Start(), end.Where().End()))
 		cases = append(cases, caseNode)
 	}
 
@@ -1293,6 +1656,26 @@ func (v *parser) parseLoopStat() *LoopStatNode {
 	}
 	startToken := v.consumeToken()
 
+	// for-in循环：for x in iterable { ... }，遍历实现了迭代器协议的值，参见 ast.Constructor.constructForInNode
+	if v.tokenMatches(0, lexer.Identifier, "") && v.tokenMatches(1, lexer.Identifier, KEYWORD_IN) {
+		variable := NewLocatedString(v.consumeToken())
+		v.consumeToken()
+
+		iterable := v.parseExpr()
+		if iterable == nil {
+			v.err("Expected valid expression after `in` in for loop")
+		}
+
+		body := v.parseBlock()
+		if body == nil {
+			v.err("Expected valid block as body of loop statement")
+		}
+
+		res := &LoopStatNode{Variable: variable, Iterable: iterable, Body: body}
+		res.SetWhere(lexer.NewSpan(startToken.Where.Start(), body.Where().End()))
+		return res
+	}
+
 	// 条件表达式，可以为空。为空时，即为无限循环。
 	condition := v.parseExpr()
 
@@ -1368,16 +1751,22 @@ func (v *parser) parseContinueStat() *ContinueStatNode {
 func (v *parser) parseBlockStat() *BlockStatNode {
 	defer un(trace(v, "blockstat"))
 
-	// 代码块语句可以以do关键字开头，也可以直接进入{}
+	// 代码块语句可以以do关键字开头，也可以直接进入{}。
+	// unsafe { ... } 中可以进行指针运算等不安全的操作
 	startPos := v.currentToken
-	var doToken *lexer.Token
+	var doToken, unsafeToken *lexer.Token
 	if v.tokenMatches(0, lexer.Identifier, KEYWORD_DO) {
 		doToken = v.consumeToken()
+	} else if v.tokenMatches(0, lexer.Identifier, KEYWORD_UNSAFE) {
+		unsafeToken = v.consumeToken()
 	}
 
 	// 解析代码块，即 {...} 的内容
 	body := v.parseBlock()
 	if body == nil {
+		if unsafeToken != nil {
+			v.err("Expected block after `unsafe`")
+		}
 		v.currentToken = startPos
 		return nil
 	}
@@ -1386,6 +1775,9 @@ func (v *parser) parseBlockStat() *BlockStatNode {
 	if doToken != nil {
 		body.NonScoping = true
 		res.SetWhere(lexer.NewSpan(doToken.Where.Start(), body.Where().End()))
+	} else if unsafeToken != nil {
+		body.Unsafe = true
+		res.SetWhere(lexer.NewSpan(unsafeToken.Where.Start(), body.Where().End()))
 	} else {
 		res.SetWhere(body.Where())
 	}
@@ -1438,10 +1830,16 @@ func (v *parser) parseBlock() *BlockNode {
 		nodes = append(nodes, node)
 	}
 
+	// 最后可以是一个不是语句的表达式，它是代码块的值
+	var tail ParseNode
+	if !v.tokenMatches(0, lexer.Separator, "}") {
+		tail = v.parseValueExpr()
+	}
+
 	// 函数体以}结尾
 	endToken := v.expect(lexer.Separator, "}")
 
-	res := &BlockNode{Nodes: nodes}
+	res := &BlockNode{Nodes: nodes, Tail: tail}
 	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
 	return res
 }
@@ -1498,10 +1896,16 @@ func (v *parser) parseAssignStat() ParseNode {
 	return res
 }
 
+// peekBinop 窥看接下来的二元操作符，返回操作符类型以及它占用的Token数量
+// 注意，词法分析总是把 >> 拆成两个 >（为了支持嵌套泛型），因此这里要把两个紧挨着的 > 重新组合成右移操作符
 func (v *parser) peekBinop() (BinOpType, int) {
+	if v.peek(0) == nil {
+		return BINOP_ERR, 0
+	}
+
 	var str string
 	var numTokens int
-	if v.tokensMatch(lexer.Operator, ">", lexer.Operator, ">") {
+	if v.tokensMatch(lexer.Operator, ">", lexer.Operator, ">") && tokensAdjacent(v.peek(0), v.peek(1)) {
 		str = ">>"
 		numTokens = 2
 	} else {
@@ -1514,6 +1918,11 @@ func (v *parser) peekBinop() (BinOpType, int) {
 	return typ, numTokens
 }
 
+// tokensAdjacent 判断两个Token在源码中是否紧挨着，中间没有空白
+func tokensAdjacent(a, b *lexer.Token) bool {
+	return a.Where.EndLine == b.Where.StartLine && a.Where.EndChar == b.Where.StartChar
+}
+
 // parseBinopAssignStat 解析二元赋值语句
 // 实例： a += 1
 func (v *parser) parseBinopAssignStat() ParseNode {
@@ -1523,13 +1932,18 @@ func (v *parser) parseBinopAssignStat() ParseNode {
 
 	// 以+=, *=, -=, /= 之类的二元操作符号开头
 	accessExpr := v.parseExpr()
-	if accessExpr == nil || !v.tokensMatch(lexer.Operator, "", lexer.Operator, "=") {
+	if accessExpr == nil || !v.tokenMatches(0, lexer.Operator, "") {
 		v.currentToken = startPos
 		return nil
 	}
 
-	// 注意，>>=有三个字符。因此要通过 peekBinop单独判断
+	// 注意，>>=有三个字符，词法分析后是三个Token。因此要通过 peekBinop单独判断
 	typ, numTokens := v.peekBinop()
+	if !v.tokenMatches(numTokens, lexer.Operator, "=") {
+		v.currentToken = startPos
+		return nil
+	}
+
 	if typ == BINOP_ERR || typ.Category() == OP_COMPARISON {
 		v.err("Invalid binary operator `%s`", v.peek(0).Contents)
 	}
@@ -1637,7 +2051,7 @@ func (v *parser) parseType(doNamed bool, onlyComposites bool, mustParse bool) Pa
 
 	if v.tokenMatches(0, lexer.Separator, "[") { // 数组
 		res = v.parseArrayType()
-	} else if v.tokenMatches(0, lexer.Identifier, KEYWORD_STRUCT) { // 结构体。注：如果要简化自定义结构体类型的定义，就要修改这里。
+	} else if v.tokenMatches(0, lexer.Identifier, KEYWORD_STRUCT) || v.tokenMatches(0, lexer.Identifier, KEYWORD_UNION) { // 结构体或联合体。注：如果要简化自定义结构体类型的定义，就要修改这里。
 		res = v.parseStructType(true)
 	} else if v.tokenMatches(0, lexer.Identifier, KEYWORD_ENUM) { // 枚举类型
 		res = v.parseEnumType()
@@ -1730,8 +2144,8 @@ func (v *parser) parseInterfaceType() *InterfaceTypeNode {
 	return res
 }
 
-// parseStructType 解析结构体类型
-// 参数requireKeyword表示结构体前面必须有 struct 关键字
+// parseStructType 解析结构体类型，以及以 union 关键字开始的联合体类型
+// 参数requireKeyword表示结构体前面必须有 struct 或 union 关键字
 func (v *parser) parseStructType(requireKeyword bool) *StructTypeNode {
 	defer un(trace(v, "structtype"))
 
@@ -1739,9 +2153,12 @@ func (v *parser) parseStructType(requireKeyword bool) *StructTypeNode {
 
 	var sigil *GenericSigilNode
 
+	isUnion := false
 	if requireKeyword {
-		// struct 关键字
-		if !v.tokenMatches(0, lexer.Identifier, KEYWORD_STRUCT) {
+		// struct 或 union 关键字
+		if v.tokenMatches(0, lexer.Identifier, KEYWORD_UNION) {
+			isUnion = true
+		} else if !v.tokenMatches(0, lexer.Identifier, KEYWORD_STRUCT) {
 			return nil
 		}
 		startToken = v.consumeToken()
@@ -1760,6 +2177,7 @@ func (v *parser) parseStructType(requireKeyword bool) *StructTypeNode {
 	}
 
 	var members []*StructMemberNode
+	var statics []*VarDeclNode
 	// 循环解析结构体成员，直到遇到“}"
 	for {
 		// 遇到"}"结束
@@ -1767,6 +2185,15 @@ func (v *parser) parseStructType(requireKeyword bool) *StructTypeNode {
 			break
 		}
 
+		// 静态成员属于类型本身，不是结构体的成员
+		if static := v.parseStaticMember(); static != nil {
+			statics = append(statics, static)
+			if v.tokenMatches(0, lexer.Separator, ",") {
+				v.consumeToken()
+			}
+			continue
+		}
+
 		// 解析一个结构体成员
 		member := v.parseStructMember()
 		if member == nil {
@@ -1783,11 +2210,38 @@ func (v *parser) parseStructType(requireKeyword bool) *StructTypeNode {
 
 	endToken := v.expect(lexer.Separator, "}")
 
-	res := &StructTypeNode{Members: members, GenericSigil: sigil}
+	res := &StructTypeNode{Members: members, StaticMembers: statics, GenericSigil: sigil, IsUnion: isUnion}
 	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
 	return res
 }
 
+// parseStaticMember 解析一个静态成员
+// 实例：pub static let MAX int = 100
+// 静态成员是类型名限定的模块级变量，通过 类型名.MAX 访问
+func (v *parser) parseStaticMember() *VarDeclNode {
+	startPos := v.currentToken
+	docs := v.parseDocComments()
+
+	// 必须是 "static" 或 "pub static" 开头
+	var pub bool
+	if v.tokensMatch(lexer.Identifier, KEYWORD_PUB, lexer.Identifier, KEYWORD_STATIC) {
+		v.consumeToken()
+		pub = true
+	} else if !v.tokenMatches(0, lexer.Identifier, KEYWORD_STATIC) {
+		v.currentToken = startPos
+		return nil
+	}
+	v.consumeToken()
+
+	res := v.parseVarDeclBody(false)
+	if res == nil {
+		v.err("Expected `let` or `var` declaration after `static` in struct")
+	}
+	res.SetPublic(pub)
+	res.SetDocComments(docs)
+	return res
+}
+
 // parseStructMember 解析一个结构体成员
 // 实例： a : int
 // TODO 去掉 ":"
@@ -2016,8 +2470,18 @@ func (v *parser) parseArrayType() *ArrayTypeNode {
 	}
 	startToken := v.consumeToken()
 
-	// 数组长度：数字
-	length := v.parseNumberLit()
+	// 数组长度：数字，或者在变量解析之后求值的常量表达式，如 [N * 2]u8、[sizeof(Header)]u8
+	var length *NumberLitNode
+	var lengthExpr ParseNode
+	if !v.tokenMatches(0, lexer.Separator, "]") {
+		lengthExpr = v.parseExpr()
+		if lengthExpr == nil {
+			v.err("Expected array length")
+		}
+		if lit, ok := lengthExpr.(*NumberLitNode); ok {
+			length, lengthExpr = lit, nil
+		}
+	}
 	if length != nil && length.IsFloat {
 		v.err("Expected integer length for array type")
 	}
@@ -2031,12 +2495,15 @@ func (v *parser) parseArrayType() *ArrayTypeNode {
 		v.err("Expected valid type in array type")
 	}
 
-	res := &ArrayTypeNode{MemberType: memberType}
+	res := &ArrayTypeNode{MemberType: memberType, LengthExpr: lengthExpr}
 	if length != nil {
 		// TODO: Defend against overflow
 		res.Length = int(length.IntValue.Int64())
 		res.IsFixedLength = true
 	}
+	if lengthExpr != nil {
+		res.IsFixedLength = true
+	}
 	res.SetWhere(lexer.NewSpan(startToken.Where.Start(), memberType.Where().End()))
 	return res
 }
@@ -2104,7 +2571,9 @@ func (v *parser) parseBinaryOperator(upperPrecedence int, lhand ParseNode) Parse
 			return nil
 		}
 
-		nextPrecedence := v.getPrecedence(stringToBinOpType(v.peek(0).Contents))
+		// 这里同样要用 peekBinop，否则 >> 会被当成 > 来计算优先级
+		nextTyp, _ := v.peekBinop()
+		nextPrecedence := v.getPrecedence(nextTyp)
 		if tokPrecedence < nextPrecedence {
 			rhand = v.parseBinaryOperator(tokPrecedence+1, rhand)
 			if rhand == nil {
@@ -2118,7 +2587,7 @@ func (v *parser) parseBinaryOperator(upperPrecedence int, lhand ParseNode) Parse
 			Rhand:    rhand,
 			Operator: typ,
 		}
-		temp.SetWhere(lexer.NewSpan(lhand.Where().Start(), rhand.Where().Start()))
+		temp.SetWhere(lexer.NewSpan(lhand.Where().Start(), rhand.Where().End()))
 		lhand = temp
 	}
 }
@@ -2149,16 +2618,38 @@ func (v *parser) parsePostfixExpr() ParseNode {
 			v.consumeToken()
 			defer un(trace(v, "arrayindex"))
 
-			index := v.parseExpr()
-			if index == nil {
-				v.err("Expected valid expression as array index")
+			// 切片 a[low:high]，两端都可以省略
+			var index ParseNode
+			if !v.tokenMatches(0, lexer.Operator, ":") {
+				index = v.parseExpr()
+				if index == nil {
+					v.err("Expected valid expression as array index")
+				}
 			}
 
-			endToken := v.expect(lexer.Separator, "]")
+			if v.tokenMatches(0, lexer.Operator, ":") {
+				v.consumeToken()
 
-			res := &ArrayAccessNode{Array: expr, Index: index}
-			res.SetWhere(lexer.NewSpan(expr.Where().Start(), endToken.Where.End()))
-			expr = res
+				var high ParseNode
+				if !v.tokenMatches(0, lexer.Separator, "]") {
+					high = v.parseExpr()
+					if high == nil {
+						v.err("Expected valid expression as slice bound")
+					}
+				}
+
+				endToken := v.expect(lexer.Separator, "]")
+
+				res := &SliceNode{Array: expr, Low: index, High: high}
+				res.SetWhere(lexer.NewSpan(expr.Where().Start(), endToken.Where.End()))
+				expr = res
+			} else {
+				endToken := v.expect(lexer.Separator, "]")
+
+				res := &ArrayAccessNode{Array: expr, Index: index}
+				res.SetWhere(lexer.NewSpan(expr.Where().Start(), endToken.Where.End()))
+				expr = res
+			}
 		} else if v.tokenMatches(0, lexer.Separator, "(") {
 			// call expr
 			v.consumeToken()
@@ -2205,14 +2696,34 @@ func (v *parser) parsePrimaryExpr() ParseNode {
 
 	if sizeofExpr := v.parseSizeofExpr(); sizeofExpr != nil { // sizeof 表达式
 		res = sizeofExpr
+	} else if alignofExpr := v.parseAlignofExpr(); alignofExpr != nil { // alignof 表达式
+		res = alignofExpr
+	} else if offsetofExpr := v.parseOffsetofExpr(); offsetofExpr != nil { // offsetof 表达式
+		res = offsetofExpr
 	} else if arrayLenExpr := v.parseArrayLenExpr(); arrayLenExpr != nil { // 数组长度表达式
 		res = arrayLenExpr
+	} else if overflowExpr := v.parseOverflowArithExpr(); overflowExpr != nil { // 溢出控制的整数运算
+		res = overflowExpr
+	} else if floatExpr := v.parseFloatBuiltinExpr(); floatExpr != nil { // 浮点数内建函数
+		res = floatExpr
+	} else if bitcastExpr := v.parseBitcastExpr(); bitcastExpr != nil { // 按位重新解释类型
+		res = bitcastExpr
+	} else if volatileLoad := v.parseVolatileLoadExpr(); volatileLoad != nil { // volatile 读
+		res = volatileLoad
+	} else if cstrExpr := v.parseCStringExpr(); cstrExpr != nil { // 转换为C字符串
+		res = cstrExpr
+	} else if hashExpr := v.parseHashExpr(); hashExpr != nil { // 哈希值
+		res = hashExpr
+	} else if newExpr := v.parseNewExpr(); newExpr != nil { // 在堆上分配
+		res = newExpr
 	} else if addrofExpr := v.parseAddrofExpr(); addrofExpr != nil { // 获取地址表达式
 		res = addrofExpr
+	} else if condExpr := v.parseCondExpr(); condExpr != nil { // 作为表达式的if和match
+		res = condExpr
+	} else if lambdaExpr := v.parseLambdaExpr(); lambdaExpr != nil { // lambda表达式，在元组常量之前
+		res = lambdaExpr
 	} else if litExpr := v.parseLitExpr(); litExpr != nil { // 常量表达式
 		res = litExpr
-	} else if lambdaExpr := v.parseLambdaExpr(); lambdaExpr != nil { // lambda表达式
-		res = lambdaExpr
 	} else if unaryExpr := v.parseUnaryExpr(); unaryExpr != nil { // 一元操作表达式
 		res = unaryExpr
 	} else if castExpr := v.parseCastExpr(); castExpr != nil { // 类型转化表达式
@@ -2242,7 +2753,10 @@ func (v *parser) parsePrimaryExpr() ParseNode {
 					v.consumeToken()
 				}
 
-				if !v.tokenMatches(0, lexer.Operator, ">") {
+				// 嵌套泛型内层的 > 已经在parseTypeReference中消化了。
+				// 如果闭合的 > 后面还紧跟着一个 >，说明这其实是右移操作符，比如 a < b >> 2
+				isShift := v.tokensMatch(lexer.Operator, ">", lexer.Operator, ">") && tokensAdjacent(v.peek(0), v.peek(1))
+				if !v.tokenMatches(0, lexer.Operator, ">") || isShift {
 					v.currentToken = startPos
 					parameters = nil
 				} else {
@@ -2259,6 +2773,35 @@ func (v *parser) parsePrimaryExpr() ParseNode {
 	return res
 }
 
+// parseCondExpr 解析作为表达式的if和match，如 let x = if c { 1 } else { 2 }。
+// 它们的值是执行的分支的值：代码块最后的表达式，或者match分支 => 之后的表达式
+func (v *parser) parseCondExpr() *CondExprNode {
+	defer un(trace(v, "condexpr"))
+
+	var stat ParseNode
+	if ifStat := v.parseIfStat(); ifStat != nil {
+		stat = ifStat
+	} else if matchStat := v.parseMatchStat(); matchStat != nil {
+		stat = matchStat
+	} else {
+		return nil
+	}
+
+	res := &CondExprNode{Stat: stat}
+	res.SetWhere(stat.Where())
+	return res
+}
+
+// parseValueExpr 解析作为代码块或match分支的值的表达式，可以是复合字面量
+func (v *parser) parseValueExpr() ParseNode {
+	defer un(trace(v, "valueexpr"))
+
+	if lit := v.parseCompositeLiteral(); lit != nil {
+		return lit
+	}
+	return v.parseExpr()
+}
+
 // len(arr)
 func (v *parser) parseArrayLenExpr() *ArrayLenExprNode {
 	defer un(trace(v, "arraylenexpr"))
@@ -2296,6 +2839,31 @@ func (v *parser) parseSizeofExpr() *SizeofExprNode {
 	}
 	startToken := v.consumeToken()
 
+	value, typ, endToken := v.parseExprOrTypeArgument(KEYWORD_SIZEOF)
+
+	res := &SizeofExprNode{Value: value, Type: typ}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// alignof(expr) 或 alignof(type)
+func (v *parser) parseAlignofExpr() *AlignofExprNode {
+	defer un(trace(v, "alignofexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_ALIGNOF) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	value, typ, endToken := v.parseExprOrTypeArgument(KEYWORD_ALIGNOF)
+
+	res := &AlignofExprNode{Value: value, Type: typ}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// sizeof 和 alignof 的参数：(expr) 或 (type)，返回参数以及结尾的 )
+func (v *parser) parseExprOrTypeArgument(builtin string) (ParseNode, *TypeReferenceNode, *lexer.Token) {
 	v.expect(lexer.Separator, "(")
 
 	var typ *TypeReferenceNode
@@ -2303,17 +2871,224 @@ func (v *parser) parseSizeofExpr() *SizeofExprNode {
 	if value == nil {
 		typ = v.parseTypeReference(true, false, true)
 		if typ == nil {
-			v.err("Expected valid expression or type in sizeof expression")
+			v.err("Expected valid expression or type in %s expression", builtin)
 		}
 	}
 
 	endToken := v.expect(lexer.Separator, ")")
+	return value, typ, endToken
+}
 
-	res := &SizeofExprNode{Value: value, Type: typ}
+// offsetof(type, member)
+func (v *parser) parseOffsetofExpr() *OffsetofExprNode {
+	defer un(trace(v, "offsetofexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_OFFSETOF) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+
+	typ := v.parseTypeReference(true, false, true)
+	if typ == nil {
+		v.err("Expected type in offsetof expression")
+	}
+
+	v.expect(lexer.Separator, ",")
+	member := v.expect(lexer.Identifier, "")
+
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &OffsetofExprNode{Type: typ, Member: NewLocatedString(member)}
 	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
 	return res
 }
 
+// checked_add(a, b)、wrapping_mul(a, b)、saturating_sub(a, b) 等。
+// 内建函数的名字不是保留关键字，后面紧跟 ( 时才按内建函数解析；作用域中有同名的函数或变量时，
+// 解析名字时再改成普通的调用，参见 ast.Resolver
+func (v *parser) parseOverflowArithExpr() *OverflowArithExprNode {
+	defer un(trace(v, "overflowarithexpr"))
+
+	if !v.tokensMatch(lexer.Identifier, "", lexer.Separator, "(") {
+		return nil
+	}
+	arith, ok := overflowArithNames[v.peek(0).Contents]
+	if !ok {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+
+	lhand := v.parseExpr()
+	if lhand == nil {
+		v.err("Expected valid expression as first argument to `%s`", startToken.Contents)
+	}
+
+	v.expect(lexer.Separator, ",")
+
+	rhand := v.parseExpr()
+	if rhand == nil {
+		v.err("Expected valid expression as second argument to `%s`", startToken.Contents)
+	}
+
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &OverflowArithExprNode{Mode: arith.Mode, Operator: arith.Operator, Lhand: lhand, Rhand: rhand}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// is_nan(x)、is_inf(x)、fma(a, b, c)。与 parseOverflowArithExpr 相同，名字不是保留关键字
+func (v *parser) parseFloatBuiltinExpr() *FloatBuiltinExprNode {
+	defer un(trace(v, "floatbuiltinexpr"))
+
+	if !v.tokensMatch(lexer.Identifier, "", lexer.Separator, "(") {
+		return nil
+	}
+	builtin, ok := floatBuiltinNames[v.peek(0).Contents]
+	if !ok {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+
+	var args []ParseNode
+	for i := 0; i < builtin.NumArguments(); i++ {
+		if i > 0 {
+			v.expect(lexer.Separator, ",")
+		}
+
+		arg := v.parseExpr()
+		if arg == nil {
+			v.err("Expected valid expression as argument to `%s`", startToken.Contents)
+		}
+		args = append(args, arg)
+	}
+
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &FloatBuiltinExprNode{Builtin: builtin, Arguments: args}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// bitcast<T>(value)
+func (v *parser) parseBitcastExpr() *BitcastExprNode {
+	defer un(trace(v, "bitcastexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_BITCAST) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Operator, "<")
+	typ := v.parseTypeReference(true, false, true)
+	if typ == nil {
+		v.err("Expected valid type in bitcast expression")
+	}
+	v.expect(lexer.Operator, ">")
+
+	v.expect(lexer.Separator, "(")
+	value := v.parseExpr()
+	if value == nil {
+		v.err("Expected valid expression in bitcast expression")
+	}
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &BitcastExprNode{Type: typ, Value: value}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// volatile_load(ptr)
+func (v *parser) parseVolatileLoadExpr() *VolatileLoadExprNode {
+	defer un(trace(v, "volatileloadexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_VOLATILE_LOAD) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+	ptr := v.parseExpr()
+	if ptr == nil {
+		v.err("Expected valid pointer expression as argument to `%s`", KEYWORD_VOLATILE_LOAD)
+	}
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &VolatileLoadExprNode{Pointer: ptr}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// cstr(value)
+func (v *parser) parseCStringExpr() *CStringExprNode {
+	defer un(trace(v, "cstringexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_CSTR) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+	value := v.parseExpr()
+	if value == nil {
+		v.err("Expected valid string expression as argument to `%s`", KEYWORD_CSTR)
+	}
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &CStringExprNode{Value: value}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// hashof(value)
+func (v *parser) parseHashExpr() *HashExprNode {
+	defer un(trace(v, "hashexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_HASHOF) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	v.expect(lexer.Separator, "(")
+	value := v.parseExpr()
+	if value == nil {
+		v.err("Expected valid expression as argument to `%s`", KEYWORD_HASHOF)
+	}
+	endToken := v.expect(lexer.Separator, ")")
+
+	res := &HashExprNode{Value: value}
+	res.SetWhere(lexer.NewSpanFromTokens(startToken, endToken))
+	return res
+}
+
+// new Type{...}、new Type(args) 或 new expr
+func (v *parser) parseNewExpr() *NewExprNode {
+	defer un(trace(v, "newexpr"))
+
+	if !v.tokenMatches(0, lexer.Identifier, KEYWORD_NEW) {
+		return nil
+	}
+	startToken := v.consumeToken()
+
+	value := v.parseCompositeLiteral()
+	if value == nil {
+		value = v.parsePostfixExpr()
+	}
+	if value == nil {
+		v.err("Expected valid expression after `%s`", KEYWORD_NEW)
+	}
+
+	res := &NewExprNode{Value: value}
+	res.SetWhere(lexer.NewSpan(startToken.Where.Start(), value.Where().End()))
+	return res
+}
+
 // &expr 或 &var expr
 func (v *parser) parseAddrofExpr() *AddrofExprNode {
 	defer un(trace(v, "addrofexpr"))
@@ -2638,7 +3413,10 @@ func (v *parser) parseNumberLit() *NumberLitNode {
 
 	res := &NumberLitNode{}
 
-	if strings.HasPrefix(num, "0x") || strings.HasPrefix(num, "0X") { // 十六进制
+	if value, unit, ok := splitDurationUnit(num); ok { // 时长
+		res.IsDuration = true
+		res.IntValue = v.parseDuration(token, value, unit)
+	} else if strings.HasPrefix(num, "0x") || strings.HasPrefix(num, "0X") { // 十六进制
 		ok := false
 		res.IntValue, ok = parseInt(num[2:], 16)
 		if !ok {
@@ -2695,6 +3473,43 @@ func (v *parser) parseNumberLit() *NumberLitNode {
 	return res
 }
 
+// splitDurationUnit 把时长字面量分为数值和单位，如 10ms 分为 10 和 ms。不是时长时返回false
+func splitDurationUnit(num string) (string, string, bool) {
+	if strings.HasPrefix(num, "0x") || strings.HasPrefix(num, "0X") || strings.HasPrefix(num, "0b") || strings.HasPrefix(num, "0o") {
+		return "", "", false
+	}
+	// 词法分析器只把单位放在十进制数字之后；ms、ns和us也以s结尾，先检查两个字母的单位
+	for _, n := range []int{2, 1} {
+		if len(num) <= n {
+			continue
+		}
+		if _, ok := lexer.DurationUnits[num[len(num)-n:]]; ok && !unicode.IsLetter(rune(num[len(num)-n-1])) {
+			return num[:len(num)-n], num[len(num)-n:], true
+		}
+	}
+	return "", "", false
+}
+
+// parseDuration 时长字面量的纳秒数。数值可以有小数，如 1.5s，但结果必须是整数纳秒，并且不超过 s64 的范围
+func (v *parser) parseDuration(token *lexer.Token, value, unit string) *big.Int {
+	rat, ok := new(big.Rat).SetString(strings.Replace(value, "_", "", -1))
+	if !ok {
+		v.errTokenSpecific(token, "Malformed duration literal: `%s`", token.Contents)
+		return big.NewInt(0)
+	}
+
+	rat.Mul(rat, new(big.Rat).SetInt64(lexer.DurationUnits[unit]))
+	if !rat.IsInt() {
+		v.errTokenSpecific(token, "Duration literal `%s` is not a whole number of nanoseconds", token.Contents)
+		return big.NewInt(0)
+	}
+	if !rat.Num().IsInt64() {
+		v.errTokenSpecific(token, "Duration literal `%s` overflows `Duration`, the maximum is about 292 years", token.Contents)
+		return big.NewInt(0)
+	}
+	return rat.Num()
+}
+
 // parseStringLit 解析字符串常量。
 func (v *parser) parseStringLit() *StringLitNode {
 	defer un(trace(v, "stringlit"))
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 项目（ku new、ku init）
+//
+// 项目是一个目录，其中的清单 ku.json 给出顶层模块的名字，源码在 src 中：
+//
+//	hello/
+//	  ku.json      {"module": "hello", "modules": {"hello": "src"}}
+//	  src/main.ku
+//	  .gitignore   忽略构建输出目录 .ku-build
+//
+// ku new <name> 创建这样的目录，ku init 把当前目录初始化为项目（已有的文件不会覆盖）。
+// 在项目目录中运行 ku build、ku run 和 ku test 时可以不给出输入，这时编译项目的顶层模块：
+// 它的模块目录就是当前目录，清单的 modules 把它映射到 src，子模块在 src 的子目录中。
+
+// projectSourceDir 项目的源码目录
+const projectSourceDir = "src"
+
+// projectModuleName 项目名，即顶层模块名，只能由字母、数字和下划线组成
+var projectModuleName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const projectMain = `[C] fun printf(fmt ^u8, ...) int;
+
+pub fun main() int {
+	C.printf(c"Hello, world!\n")
+	return 0
+}
+`
+
+const projectGitignore = "/" + buildDirName + "/\n"
+
+// newProject 在目录name中创建项目
+func newProject(name string) {
+	if _, err := os.Stat(name); err == nil {
+		setupErr("Couldn't create project `%s`: `%s` already exists", name, name)
+	}
+	initProject(name, filepath.Base(name))
+}
+
+// initProject 把目录dir初始化为顶层模块名为name的项目
+func initProject(dir, name string) {
+	if !projectModuleName.MatchString(name) {
+		setupErr("Invalid project name `%s`: only letters, digits and `_` are allowed", name)
+	}
+
+	manifestPath := filepath.Join(dir, moduleManifestName)
+	if _, err := os.Stat(manifestPath); err == nil {
+		setupErr("`%s` already exists", manifestPath)
+	}
+
+	manifest := moduleManifest{
+		Module:  name,
+		Modules: map[string]string{name: projectSourceDir},
+	}
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		setupErr("%s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, projectSourceDir), 0777); err != nil {
+		setupErr("Couldn't create project directory: %s", err)
+	}
+	writeProjectFile(manifestPath, string(data)+"\n")
+	writeProjectFile(filepath.Join(dir, projectSourceDir, "main.ku"), projectMain)
+	writeProjectFile(filepath.Join(dir, ".gitignore"), projectGitignore)
+
+	log.Infoln(log.TagMain, "Created project `%s` in %s", name, dir)
+}
+
+// writeProjectFile 写入项目中的文件，已经存在的文件保持不变
+func writeProjectFile(path, contents string) {
+	if _, err := os.Stat(path); err == nil {
+		log.Infoln(log.TagMain, "Keeping existing %s", path)
+		return
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+		setupErr("%s", err)
+	}
+}
+
+// useProject 命令没有输入时编译当前目录中的项目，返回项目的顶层模块名。当前目录不是项目时报错
+func (v *Context) useProject() string {
+	data, err := ioutil.ReadFile(moduleManifestName)
+	if os.IsNotExist(err) {
+		setupErr("No input files passed, and the current directory has no %s; create a project with `ku init`", moduleManifestName)
+	} else if err != nil {
+		setupErr("%s", err)
+	}
+
+	var manifest moduleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		setupErr("Invalid module manifest `%s`: %s", moduleManifestName, err)
+	}
+	if manifest.Module == "" {
+		setupErr("No input files passed, and %s doesn't name the project module", moduleManifestName)
+	}
+	if !projectModuleName.MatchString(manifest.Module) {
+		setupErr("Invalid project module name `%s` in %s", manifest.Module, moduleManifestName)
+	}
+
+	v.ProjectModule = manifest.Module
+	return manifest.Module
+}
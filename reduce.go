@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/parser"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 崩溃复现的最小化（ku reduce）
+//
+// 给定一个能让编译器崩溃的源文件和一个判定命令，不断删除源码中的片段，
+// 只要判定命令仍然成功（退出码为0，表示崩溃依然存在）就保留删除，最终得到尽可能小的源码。
+//
+// 删除以语法树节点为单位：先尝试删除顶层声明，再逐层深入删除函数体、结构体、循环等中的语句和成员，
+// 这样得到的候选源码大多仍然是合法的。源码无法解析时，退回到按行删除。
+// 每一层的删除使用delta debugging（ddmin）算法。
+
+type reducer struct {
+	name      string   // 候选文件的文件名，与输入文件相同
+	dir       string   // 存放候选文件的临时目录
+	predicate []string // 判定命令，{} 替换为候选文件的路径
+	timeout   time.Duration
+
+	results map[string]bool // 已经判定过的候选源码
+	tests   int
+}
+
+// span 源码中的一个片段，[start, end) 为字符下标
+type span struct {
+	start, end int
+}
+
+// Reduce 最小化input，把结果写入output
+func (v *Context) Reduce(input, output string, predicate []string, timeout time.Duration) {
+	contents, err := ioutil.ReadFile(input)
+	if err != nil {
+		setupErr("%s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "ku-reduce")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &reducer{
+		name:      filepath.Base(input),
+		dir:       dir,
+		predicate: predicate,
+		timeout:   timeout,
+		results:   make(map[string]bool),
+	}
+
+	src := string(contents)
+	if !r.test(src) {
+		os.RemoveAll(dir)
+		setupErr("The predicate doesn't succeed on the unreduced input `%s`", input)
+	}
+
+	for {
+		progress := false
+
+		// 按语法树逐层删除
+		for depth := 0; ; depth++ {
+			chunks, ok := parseChunks(r.name, src, depth)
+			if !ok || len(chunks) == 0 {
+				break
+			}
+			if reduced, ok := r.ddmin(src, chunks); ok {
+				src = reduced
+				progress = true
+			}
+		}
+
+		// 按行删除
+		if reduced, ok := r.ddmin(src, lineChunks(src)); ok {
+			src = reduced
+			progress = true
+		}
+
+		if !progress {
+			break
+		}
+	}
+
+	if err := ioutil.WriteFile(output, []byte(src), 0666); err != nil {
+		os.RemoveAll(dir)
+		setupErr("Couldn't write `%s`: %s", output, err)
+	}
+
+	log.Infoln(log.TagMain, "Reduced `%s` from %d to %d bytes after %d tests, written to `%s`",
+		input, len(contents), len(src), r.tests, output)
+}
+
+// test 判定命令在候选源码上是否成功
+func (v *reducer) test(src string) bool {
+	if res, ok := v.results[src]; ok {
+		return res
+	}
+
+	path := filepath.Join(v.dir, v.name)
+	if err := ioutil.WriteFile(path, []byte(src), 0666); err != nil {
+		setupErr("Couldn't write `%s`: %s", path, err)
+	}
+
+	args := make([]string, 0, len(v.predicate)+1)
+	replaced := false
+	for _, arg := range v.predicate {
+		if strings.Contains(arg, "{}") {
+			arg = strings.Replace(arg, "{}", path, -1)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	// 超时的运行不算成功
+	err := exec.CommandContext(ctx, args[0], args[1:]...).Run()
+	res := err == nil && ctx.Err() == nil
+
+	v.tests++
+	v.results[src] = res
+	log.Verboseln(log.TagMain, "Test %d: %d bytes, %v", v.tests, len(src), res)
+	return res
+}
+
+// ddmin 尝试删除chunks中的片段，返回删除后的源码以及是否删除了任何片段
+func (v *reducer) ddmin(src string, chunks []span) (string, bool) {
+	removed := make([]bool, len(chunks))
+	live := make([]int, len(chunks))
+	for i := range live {
+		live[i] = i
+	}
+
+	changed := false
+	n := 2
+	for len(live) > 0 {
+		if n > len(live) {
+			n = len(live)
+		}
+		size := (len(live) + n - 1) / n
+
+		progress := false
+		for start := 0; start < len(live); start += size {
+			end := start + size
+			if end > len(live) {
+				end = len(live)
+			}
+
+			try := make([]bool, len(removed))
+			copy(try, removed)
+			for _, idx := range live[start:end] {
+				try[idx] = true
+			}
+
+			if v.test(cutChunks(src, chunks, try)) {
+				removed = try
+				live = append(live[:start:start], live[end:]...)
+				if n > 2 {
+					n--
+				}
+				progress, changed = true, true
+				break
+			}
+		}
+
+		if !progress {
+			if n >= len(live) {
+				break
+			}
+			n *= 2
+		}
+	}
+
+	return cutChunks(src, chunks, removed), changed
+}
+
+// cutChunks 删除源码中被标记的片段。chunks按位置排序且互不重叠
+func cutChunks(src string, chunks []span, removed []bool) string {
+	runes := []rune(src)
+	var res []rune
+	last := 0
+	for i, chunk := range chunks {
+		if !removed[i] {
+			continue
+		}
+		res = append(res, runes[last:chunk.start]...)
+		last = chunk.end
+	}
+	return string(append(res, runes[last:]...))
+}
+
+func lineChunks(src string) []span {
+	var chunks []span
+	start := 0
+	for i, r := range []rune(src) {
+		if r == '\n' {
+			chunks = append(chunks, span{start, i + 1})
+			start = i + 1
+		}
+	}
+	if n := len([]rune(src)); start < n {
+		chunks = append(chunks, span{start, n})
+	}
+	return chunks
+}
+
+// parseChunks 解析源码，返回语法树中第depth层的节点所在的片段。源码无法解析时ok为false
+func parseChunks(name, src string, depth int) (chunks []span, ok bool) {
+	sourcefile := &lexer.Sourcefile{
+		Name:     strings.TrimSuffix(name, filepath.Ext(name)),
+		Path:     name,
+		Contents: []rune(src),
+		NewLines: []int{-1, -1},
+	}
+
+	tree, ok := tryParse(sourcefile)
+	if !ok {
+		return nil, false
+	}
+
+	nodes := tree.Nodes
+	for i := 0; i < depth; i++ {
+		var children []parser.ParseNode
+		for _, node := range nodes {
+			children = append(children, childNodes(node)...)
+		}
+		nodes = children
+	}
+
+	for _, node := range nodes {
+		if node == nil || node.Where().StartLine == 0 {
+			continue
+		}
+		chunks = append(chunks, lineSpan(sourcefile, node.Where()))
+	}
+	return chunks, true
+}
+
+// tryParse 对源码进行词法分析和语法分析。出错时不退出程序，也不输出错误信息
+func tryParse(sourcefile *lexer.Sourcefile) (tree *parser.ParseTree, ok bool) {
+	exit := util.ExitFunc
+	util.ExitFunc = func(code int) {
+		panic(code)
+	}
+	log.SetTags(string(log.TagMain))
+
+	defer func() {
+		util.ExitFunc = exit
+		log.SetTags(*logTags)
+		if recover() != nil {
+			tree, ok = nil, false
+		}
+	}()
+
+	sourcefile.Tokens = lexer.Lex(sourcefile)
+	tree, _ = parser.Parse(sourcefile)
+	return tree, true
+}
+
+// childNodes 返回节点中可以单独删除的子节点：语句、结构体成员、枚举成员和match分支
+func childNodes(node parser.ParseNode) []parser.ParseNode {
+	var res []parser.ParseNode
+	addBlock := func(block *parser.BlockNode) {
+		if block != nil {
+			res = append(res, block.Nodes...)
+			if block.Tail != nil {
+				res = append(res, block.Tail)
+			}
+		}
+	}
+
+	switch n := node.(type) {
+	case *parser.FunctionDeclNode:
+		addBlock(n.Function.Body)
+	case *parser.TypeDeclNode:
+		switch typ := n.Type.(type) {
+		case *parser.StructTypeNode:
+			for _, member := range typ.Members {
+				res = append(res, member)
+			}
+		case *parser.EnumTypeNode:
+			for _, member := range typ.Members {
+				res = append(res, member)
+			}
+		}
+	case *parser.IfStatNode:
+		for _, part := range n.Parts {
+			addBlock(part.Body)
+		}
+		addBlock(n.ElseBody)
+	case *parser.LoopStatNode:
+		addBlock(n.Body)
+	case *parser.BlockStatNode:
+		addBlock(n.Body)
+	case *parser.MatchStatNode:
+		for _, c := range n.Cases {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// lineSpan 把节点的位置转换为字符下标。如果节点独占若干行，片段包括行首的缩进和行尾的换行
+func lineSpan(sourcefile *lexer.Sourcefile, where lexer.Span) span {
+	contents := sourcefile.Contents
+	start := sourcefile.Offset(where.Start())
+	end := sourcefile.Offset(where.End())
+
+	lineStart := start
+	for lineStart > 0 && (contents[lineStart-1] == ' ' || contents[lineStart-1] == '\t') {
+		lineStart--
+	}
+	lineEnd := end
+	for lineEnd < len(contents) && (contents[lineEnd] == ' ' || contents[lineEnd] == '\t' || contents[lineEnd] == '\r') {
+		lineEnd++
+	}
+
+	if (lineStart == 0 || contents[lineStart-1] == '\n') && (lineEnd == len(contents) || contents[lineEnd] == '\n') {
+		if lineEnd < len(contents) {
+			lineEnd++
+		}
+		return span{lineStart, lineEnd}
+	}
+	return span{start, end}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen"
+	"github.com/ku-lang/ku/semantic"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 交互式解释器（ku repl）
+//
+// 逐行输入声明、语句和表达式，括号没有闭合时继续读下一行。输入按开头的词分类：
+//
+//	fun type use pub priv [attr]  顶层声明，检查通过后加入会话
+//	let var                       变量声明，检查通过后运行并加入会话
+//	其他                          表达式或语句，检查通过后编译运行
+//
+// 会话是合成的 __main 模块，只有一个源文件 repl.ku，通过 Context.Overlay 提供而不写入磁盘：
+// 先是会话中的顶层声明，然后是main函数，其中依次是会话中的语句和这次的输入。
+// 每次输入后重新分析这个模块（运行时只加载一次，参见LoadRuntime），有错误时显示错误并丢弃这次的输入。
+//
+// 表达式先作为 `let __repl_value = (...)` 检查，值的类型是整数、浮点数、bool或字符串时打印值，其他类型显示类型名；
+// 不能作为表达式时作为语句。编译器没有JIT，表达式和语句编译成程序运行，程序的输出直接显示。
+//
+// 每次运行的程序都是新的进程，会话中的变量通过快照延续：程序最后在标记行（replSnapshotMark）之后打印main中
+// 每个变量的值，会话用 `let x int = 5` 这样的字面量声明代替之前的语句，所以之前的语句（以及其中的副作用）不会重复执行。
+// 只有整数、f32、f64、bool和字符串的值能写成字面量。运行之后有变量不能取快照时，重新执行语句会重复其中的副作用，
+// 所以这次的输入不保留在会话中（输入已经运行，输出照常显示），会话仍然是最近一次快照，并提示用户。
+//
+// 以 : 开头的输入是会话命令，参见 replHelp。
+
+const (
+	replFileName     = "repl.ku"
+	replValueName    = "__repl_value"
+	replSnapshotMark = "__repl_snapshot__"
+)
+
+const replHelp = `Enter declarations, statements or expressions; unclosed brackets continue on the next line.
+  :help    Show this help
+  :decls   List the declarations and statements kept in the session
+  :reset   Forget all declarations and statements
+  :quit    Leave the REPL (also Ctrl-D)
+
+Every input runs as a new program. Variables of integer, f32, f64, bool and string
+types keep their values between inputs. An input that leaves a variable of any
+other type in the session still runs, but it is not kept.
+`
+
+// replInputKind 输入的种类
+type replInputKind int
+
+const (
+	replDecl replInputKind = iota // 顶层声明
+	replVar                       // 变量声明
+	replExpr                      // 表达式或语句
+)
+
+// replSession 会话中保留的输入
+type replSession struct {
+	searchpaths []string
+	features    []string
+	dir         string // 合成的源文件和编译出的程序所在的临时目录
+
+	decls []string // 顶层声明
+	stmts []string // 变量的字面量声明（最近一次快照）
+
+	logs   bytes.Buffer // 检查时收集的日志
+	parsed bool         // 最近一次检查是否通过了语法分析
+}
+
+// runREPL 运行交互式解释器，直到输入结束或者 :quit，返回退出码
+func runREPL(searchpaths, features []string) int {
+	dir, err := ioutil.TempDir("", "ku-repl")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 会话中的变量不一定在之后用到，未使用的声明不是错误
+	*ignoreUnused = true
+
+	v := &replSession{
+		searchpaths: searchpaths,
+		features:    features,
+		dir:         dir,
+	}
+
+	fmt.Printf("ku %s, :help for help\n", VERSION)
+	in := bufio.NewReader(os.Stdin)
+	for {
+		input, ok := readREPLInput(in)
+		if !ok {
+			fmt.Println()
+			return 0
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		if strings.HasPrefix(input, ":") {
+			if !v.command(input) {
+				return 0
+			}
+			continue
+		}
+		v.eval(input)
+	}
+}
+
+// readREPLInput 读入一次输入，括号没有闭合时继续读下一行。输入结束时返回false
+func readREPLInput(in *bufio.Reader) (string, bool) {
+	var buf strings.Builder
+	prompt := "ku> "
+	for {
+		fmt.Print(prompt)
+		line, err := in.ReadString('\n')
+		buf.WriteString(line)
+		if err != nil {
+			if err != io.EOF || buf.Len() == 0 {
+				return "", false
+			}
+			return buf.String(), true
+		}
+
+		if scanREPLInput(buf.String()) <= 0 {
+			return buf.String(), true
+		}
+		prompt = "... "
+	}
+}
+
+// command 执行会话命令，:quit 时返回false
+func (v *replSession) command(input string) bool {
+	switch input {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help", ":h":
+		fmt.Print(replHelp)
+	case ":reset":
+		v.decls, v.stmts = nil, nil
+	case ":decls":
+		for _, decl := range v.decls {
+			fmt.Println(decl)
+		}
+		for _, stmt := range v.stmts {
+			fmt.Println(stmt)
+		}
+	default:
+		fmt.Printf("%s Unknown command `%s`, :help lists the commands\n", util.Red("error:"), input)
+	}
+	return true
+}
+
+// eval 检查输入，声明加入会话，变量声明、表达式和语句编译运行
+func (v *replSession) eval(input string) {
+	switch classifyREPLInput(input) {
+	case replDecl:
+		if _, ok := v.check(v.source(append(v.decls, input), v.stmts)); ok {
+			v.decls = append(v.decls, input)
+		} else {
+			v.showErrors()
+		}
+
+	case replVar:
+		stmts := appendStmts(v.stmts, input)
+		if submod, ok := v.check(v.source(v.decls, stmts)); ok {
+			v.runAndKeep(submod, stmts)
+		} else {
+			v.showErrors()
+		}
+
+	case replExpr:
+		valueDecl := fmt.Sprintf("let %s = (%s)", replValueName, input)
+		if submod, ok := v.check(v.source(v.decls, appendStmts(v.stmts, valueDecl))); ok {
+			typ := replValueType(submod)
+			printStmt := replPrintValue(typ)
+			if printStmt == "" {
+				name := "<" + util.StripColors(typ.String()) + ">"
+				printStmt = fmt.Sprintf(`__hook_print(c"%s", %d)`, name, len(name))
+			}
+			v.runAndKeep(submod, appendStmts(v.stmts, valueDecl, printStmt, `__hook_print(c"\n", 1)`))
+			return
+		}
+
+		// 作为表达式能通过语法分析时，作为表达式的错误更准确
+		exprLogs := append([]byte{}, v.logs.Bytes()...)
+		exprParsed := v.parsed
+
+		stmts := appendStmts(v.stmts, input)
+		submod, ok := v.check(v.source(v.decls, stmts))
+		if !ok {
+			if exprParsed {
+				os.Stdout.Write(exprLogs)
+			} else {
+				v.showErrors()
+			}
+			return
+		}
+		v.runAndKeep(submod, stmts)
+	}
+}
+
+// appendStmts 在会话的语句之后加上新的语句，不修改stmts
+func appendStmts(stmts []string, more ...string) []string {
+	return append(append([]string{}, stmts...), more...)
+}
+
+// runAndKeep 运行语句stmts（submod是检查它们得到的子模块），成功并且会话中的变量都能取快照时保留它们的值。
+// 不能取快照时不保留这次的输入，会话不变
+func (v *replSession) runAndKeep(submod *ast.Submodule, stmts []string) {
+	vars := replSessionVariables(submod)
+	output, ok := v.run(v.source(v.decls, append(stmts, replSnapshotStmts(vars)...)))
+	if !ok {
+		return
+	}
+
+	decls, bad := parseREPLSnapshot(vars, output)
+	if bad == nil {
+		v.stmts = decls
+		return
+	}
+	fmt.Printf("%s the value of `%s` (%s) can't be kept between inputs, the input is not kept in the session\n",
+		util.TEXT_YELLOW+util.TEXT_BOLD+"warning:"+util.TEXT_RESET, bad.Name, util.StripColors(bad.Type.String()))
+}
+
+// source 合成的源文件：顶层声明（use在最前面），然后是依次执行语句的main函数
+func (v *replSession) source(decls, stmts []string) string {
+	var buf bytes.Buffer
+	for _, decl := range decls {
+		if strings.HasPrefix(decl, "use ") {
+			fmt.Fprintf(&buf, "%s\n", decl)
+		}
+	}
+	for _, decl := range decls {
+		if !strings.HasPrefix(decl, "use ") {
+			fmt.Fprintf(&buf, "\n%s\n", decl)
+		}
+	}
+
+	buf.WriteString("\npub fun main() int {\n")
+	for _, stmt := range stmts {
+		fmt.Fprintf(&buf, "\t%s\n", stmt)
+	}
+	buf.WriteString("\treturn 0\n}\n")
+	return buf.String()
+}
+
+// newContext 编译合成的源文件的编译环境
+func (v *replSession) newContext(source string) *Context {
+	path := filepath.Join(v.dir, replFileName)
+	context := NewContext()
+	context.Searchpaths = append([]string{}, v.searchpaths...)
+	context.Features = v.features
+	context.Inputs = []string{path}
+	context.Overlay = map[string]string{path: source}
+	readSources = nil
+	return context
+}
+
+// check 分析合成的源文件，进行到语义分析为止，返回它的子模块。出错时返回false，错误信息留在日志中
+func (v *replSession) check(source string) (*ast.Submodule, bool) {
+	context := v.newContext(source)
+
+	v.logs.Reset()
+	v.parsed = false
+	log.SetOutput(&v.logs)
+	defer log.SetOutput(os.Stdout)
+
+	ok := catchErrorExit(func() {
+		runPhase("runtime loading", func() {
+			LoadRuntime()
+		})
+		context.parseFiles()
+		v.parsed = true
+		runPhase("resolve phase", func() {
+			for _, module := range context.modules {
+				ast.Resolve(module, context.moduleLookup)
+			}
+		})
+		runPhase("inference phase", func() {
+			for _, module := range context.modules {
+				for _, submod := range module.Parts {
+					ast.Infer(submod)
+				}
+			}
+		})
+		runPhase("semantic analysis phase", func() {
+			for _, module := range context.modules {
+				if !module.Interface {
+					semantic.SemCheck(module, true)
+				}
+			}
+		})
+	})
+	if !ok {
+		return nil, false
+	}
+
+	for _, module := range context.modules {
+		if module.Name.String() == "__main" {
+			for _, submod := range module.Parts {
+				return submod, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// showErrors 显示检查时的错误
+func (v *replSession) showErrors() {
+	os.Stdout.Write(v.logs.Bytes())
+}
+
+// run 编译合成的源文件并运行，返回程序在快照标记之后的输出。编译或者运行失败时返回false
+func (v *replSession) run(source string) ([]byte, bool) {
+	output := filepath.Join(v.dir, "repl")
+	context := v.newContext(source)
+	if !catchErrorExit(func() {
+		context.Build(output, codegen.OutputExectuably, "llvm", 0)
+	}) {
+		return nil, false
+	}
+
+	if runtime.GOOS == "windows" {
+		output += ".exe"
+	}
+
+	stdout := &replOutput{out: os.Stdout}
+	cmd := exec.Command(output)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	// 程序运行期间的Ctrl-C只结束程序，不结束会话
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	err := cmd.Run()
+	stdout.flush()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			fmt.Printf("%s %s\n", util.Red("error:"), exitErr)
+		} else {
+			log.Error(log.TagMain, util.Red("error: ")+"Couldn't run `%s`: %s\n", output, err)
+		}
+		return nil, false
+	}
+	return stdout.snapshot.Bytes(), true
+}
+
+// replOutput 把程序的输出转发到out，直到快照标记为止，之后的输出是快照
+type replOutput struct {
+	out      io.Writer
+	pending  []byte // 可能是快照标记开头的部分，还没有转发
+	found    bool
+	snapshot bytes.Buffer
+}
+
+func (v *replOutput) Write(p []byte) (int, error) {
+	if v.found {
+		return v.snapshot.Write(p)
+	}
+
+	mark := []byte("\n" + replSnapshotMark + "\n")
+	v.pending = append(v.pending, p...)
+	if index := bytes.Index(v.pending, mark); index >= 0 {
+		v.out.Write(v.pending[:index])
+		v.snapshot.Write(v.pending[index+len(mark):])
+		v.pending, v.found = nil, true
+	} else if n := len(v.pending) - len(mark) + 1; n > 0 {
+		v.out.Write(v.pending[:n])
+		v.pending = append([]byte{}, v.pending[n:]...)
+	}
+	return len(p), nil
+}
+
+// flush 转发剩下的输出（程序在打印快照之前结束时）
+func (v *replOutput) flush() {
+	v.out.Write(v.pending)
+	v.pending = nil
+}
+
+// classifyREPLInput 按开头的词区分输入的种类。[ 之后是字母时是属性，否则是数组字面量或类型
+func classifyREPLInput(input string) replInputKind {
+	if strings.HasPrefix(input, "[") {
+		if rest := []rune(input[1:]); len(rest) > 0 && unicode.IsLetter(rest[0]) {
+			return replDecl
+		}
+		return replExpr
+	}
+
+	word := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if len(word) == 0 {
+		return replExpr
+	}
+	switch word[0] {
+	case "fun", "type", "use", "pub", "priv":
+		return replDecl
+	case "let", "var":
+		return replVar
+	}
+	return replExpr
+}
+
+// scanREPLInput 扫描输入中字符串、字符和注释以外的部分，返回没有闭合的括号数
+func scanREPLInput(input string) (depth int) {
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '"', '\'':
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+		case '/':
+			if i+1 < len(runes) && runes[i+1] == '/' {
+				for i < len(runes) && runes[i] != '\n' {
+					i++
+				}
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// replValueType 表达式的值 __repl_value 的类型
+func replValueType(submod *ast.Submodule) *ast.TypeReference {
+	finder := &replValueFinder{}
+	ast.NewASTVisitor(finder).VisitSubmodule(submod)
+	return finder.typ
+}
+
+type replValueFinder struct {
+	typ *ast.TypeReference
+}
+
+func (v *replValueFinder) EnterScope()           {}
+func (v *replValueFinder) ExitScope()            {}
+func (v *replValueFinder) PostVisit(n *ast.Node) {}
+
+func (v *replValueFinder) Visit(n *ast.Node) bool {
+	if decl, ok := (*n).(*ast.VariableDecl); ok && decl.Variable.Name == replValueName {
+		v.typ = decl.Variable.Type
+	}
+	return v.typ == nil
+}
+
+// replPrintValue 打印 __repl_value 的语句，类型不能打印时返回空串。打印函数在runtime.ku中
+func replPrintValue(typ *ast.TypeReference) string {
+	if typ == nil {
+		return ""
+	}
+	if ast.IsStringType(typ) {
+		return fmt.Sprintf("__repl_print_string(%s)", replValueName)
+	}
+
+	prim, ok := typ.BaseType.ActualType().(ast.PrimitiveType)
+	if !ok {
+		return ""
+	}
+	switch {
+	case prim == ast.PRIMITIVE_bool:
+		return fmt.Sprintf("__repl_print_bool(%s)", replValueName)
+	case prim.IsFloatingType():
+		return fmt.Sprintf("__repl_print_f64(f64(%s))", replValueName)
+	case prim.IsIntegerType() && prim.IsSigned():
+		return fmt.Sprintf("print_s128(s128(%s))", replValueName)
+	case prim.IsIntegerType():
+		return fmt.Sprintf("print_u128(u128(%s))", replValueName)
+	}
+	return ""
+}
+
+// replSessionVariables 会话中的变量，即main函数中声明的变量（除了 __repl_value）
+func replSessionVariables(submod *ast.Submodule) []*ast.Variable {
+	var vars []*ast.Variable
+	for _, node := range submod.Nodes {
+		decl, ok := node.(*ast.FunctionDecl)
+		if !ok || decl.Function.Name != "main" || decl.Function.Body == nil {
+			continue
+		}
+		for _, stmt := range decl.Function.Body.Nodes {
+			switch stmt := stmt.(type) {
+			case *ast.VariableDecl:
+				if stmt.Variable.Name != replValueName {
+					vars = append(vars, stmt.Variable)
+				}
+			case *ast.DestructVarDecl:
+				for i, vari := range stmt.Variables {
+					if !stmt.ShouldDiscard[i] {
+						vars = append(vars, vari)
+					}
+				}
+			}
+		}
+	}
+	return vars
+}
+
+// replSnapshotType 能取快照的变量类型：整数、f32、f64、bool或字符串，否则返回false
+func replSnapshotType(typ *ast.TypeReference) (string, bool) {
+	if ast.IsStringType(typ) {
+		return "string", true
+	}
+	prim, ok := typ.BaseType.(ast.PrimitiveType)
+	if !ok || prim == ast.PRIMITIVE_void || prim == ast.PRIMITIVE_f128 {
+		return "", false
+	}
+	return prim.TypeName(), true
+}
+
+// replSnapshotStmts 在快照标记之后依次打印变量值的语句，每个值一行：
+// 整数是十进制数，浮点数是它的位（bitcast为无符号整数），字符串是长度然后是 __repl_print_string 的输出。
+// 有变量不能取快照时只打印快照标记，参见 parseREPLSnapshot
+func replSnapshotStmts(vars []*ast.Variable) []string {
+	stmts := []string{fmt.Sprintf(`__hook_print(c"\n%s\n", %d)`, replSnapshotMark, len(replSnapshotMark)+2)}
+	for _, vari := range vars {
+		typ, ok := replSnapshotType(vari.Type)
+		if !ok {
+			return stmts
+		}
+
+		var stmt string
+		switch typ {
+		case "string":
+			stmt = fmt.Sprintf(`print_u128(u128(len(%s))); __hook_print(c"\n", 1); __repl_print_string(%s)`, vari.Name, vari.Name)
+		case "bool":
+			stmt = fmt.Sprintf("__repl_print_bool(%s)", vari.Name)
+		case "f32":
+			stmt = fmt.Sprintf("print_u128(u128(bitcast<u32>(%s)))", vari.Name)
+		case "f64":
+			stmt = fmt.Sprintf("print_u128(u128(bitcast<u64>(%s)))", vari.Name)
+		default:
+			if vari.Type.BaseType.(ast.PrimitiveType).IsSigned() {
+				stmt = fmt.Sprintf("print_s128(s128(%s))", vari.Name)
+			} else {
+				stmt = fmt.Sprintf("print_u128(u128(%s))", vari.Name)
+			}
+		}
+		stmts = append(stmts, stmt, `__hook_print(c"\n", 1)`)
+	}
+	return stmts
+}
+
+// parseREPLSnapshot 从快照中读出变量的值，返回代替会话中语句的字面量声明。
+// 变量不能取快照，或者值不能写成字面量（如字符串中有 \0 或者不是UTF-8）时，返回这个变量
+func parseREPLSnapshot(vars []*ast.Variable, snapshot []byte) ([]string, *ast.Variable) {
+	var decls []string
+	rest := string(snapshot)
+	nextLine := func() string {
+		line := rest
+		if index := strings.IndexByte(rest, '\n'); index >= 0 {
+			line, rest = rest[:index], rest[index+1:]
+		} else {
+			rest = ""
+		}
+		return line
+	}
+
+	for _, vari := range vars {
+		typ, ok := replSnapshotType(vari.Type)
+		if !ok {
+			return nil, vari
+		}
+
+		var value *ast.Constant
+		line := nextLine()
+		switch typ {
+		case "string":
+			// 字符串中可能有换行，按长度读取。printf遇到 \0 时结束，这时两边的引号对不上
+			length, err := strconv.Atoi(line)
+			if err != nil || len(rest) < length+3 || rest[0] != '"' || rest[length+1:length+3] != "\"\n" {
+				return nil, vari
+			}
+			str := rest[1 : length+1]
+			rest = rest[length+3:]
+			if !utf8.ValidString(str) {
+				return nil, vari
+			}
+			value = &ast.Constant{Kind: ast.ConstString, Str: str}
+		case "bool":
+			value = &ast.Constant{Kind: ast.ConstBool, Bool: line == "true"}
+		case "f32", "f64":
+			bits, err := strconv.ParseUint(line, 10, 64)
+			if err != nil {
+				return nil, vari
+			}
+			value = &ast.Constant{Kind: ast.ConstFloat, Float: math.Float64frombits(bits)}
+			if typ == "f32" {
+				value.Float = float64(math.Float32frombits(uint32(bits)))
+			}
+		default:
+			i, ok := new(big.Int).SetString(line, 10)
+			if !ok {
+				return nil, vari
+			}
+			value = &ast.Constant{Kind: ast.ConstInt, Int: i}
+		}
+
+		keyword := "let"
+		if vari.Mutable {
+			keyword = "var"
+		}
+		decls = append(decls, fmt.Sprintf("%s %s %s = %s", keyword, vari.Name, typ, value.Literal()))
+	}
+	return decls, nil
+}
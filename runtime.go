@@ -1,7 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
 
 	"github.com/ku-lang/ku/ast"
 	"github.com/ku-lang/ku/lexer"
@@ -9,28 +13,46 @@ import (
 	"github.com/ku-lang/ku/semantic"
 )
 
+// loadedRuntime 已经加载的运行时模块，按runtime.ku内容的哈希缓存。同一个进程中再次编译时直接复用，
+// 不再重新进行语法分析、变量解析、类型推导和语义检查；内容变化时重新加载
+var loadedRuntime struct {
+	hash     [sha256.Size]byte
+	module   *ast.Module
+	accesses map[*ast.Function]int // 加载完成时运行时函数的访问数，复用时去掉之前的编译添加的访问
+}
+
 // LoadRuntime 加载运行时
 func LoadRuntime() *ast.Module {
+	runtimePath := findRuntimePath()
+	bytes, err := ioutil.ReadFile(runtimePath)
+	if err != nil {
+		panic("INIT ERROR: Cannot load runtime.ku in " + runtimePath)
+	}
+
+	hash := sha256.Sum256(bytes)
+	if loadedRuntime.module != nil {
+		if loadedRuntime.hash == hash {
+			ast.TruncateFunctionAccesses(loadedRuntime.accesses)
+			return loadedRuntime.module
+		}
+		ast.UnloadRuntimeModule(loadedRuntime.module)
+	}
+
 	runtimeModule := &ast.Module{
 		Name: &ast.ModuleName{
-			Parts: []string{"__runtime"},
+			Parts: []string{ast.RuntimeModuleName},
 		},
-		Dirpath: "__runtime",
+		Dirpath: ast.RuntimeModuleName,
 		Parts:   make(map[string]*ast.Submodule),
 	}
 
-	// TODO: 从配置文件里读取runtime.ku的路径
-	runtimePath := "/usr/local/ku/lib/runtime.ku"
-	bytes, err := ioutil.ReadFile(runtimePath)
-	if err != nil {
-		panic("INIT ERROR: Cannot load runtime.ku in " + runtimePath)
-	}
 	sourcefile := &lexer.Sourcefile{
 		Name:     "runtime",
 		Path:     "runtime.ku",
 		Contents: []rune(string(bytes)),
 		NewLines: []int{-1, -1},
 	}
+	recordSource(sourcefile)
 
 	// 先进行词法分析，得到一个token列表
 	lexer.Lex(sourcefile)
@@ -60,5 +82,36 @@ func LoadRuntime() *ast.Module {
 	// 最有把运行时模块加载到ast中
 	ast.LoadRuntimeModule(runtimeModule)
 
+	loadedRuntime.hash = hash
+	loadedRuntime.module = runtimeModule
+	loadedRuntime.accesses = ast.FunctionAccessCounts(runtimeModule)
 	return runtimeModule
 }
+
+// findRuntimePath 返回runtime.ku的路径
+func findRuntimePath() string {
+	return filepath.Join(findHome(), "lib", "runtime.ku")
+}
+
+// findLibraryPath 返回标准库（std.io等模块）所在的目录，它总是在模块的搜索路径中
+func findLibraryPath() string {
+	return filepath.Join(findHome(), "lib")
+}
+
+// findHome 返回ku的安装目录。
+// 优先使用环境变量KU_HOME指定的安装目录；否则Windows上使用编译器所在目录，其他系统使用/usr/local/ku
+func findHome() string {
+	home := os.Getenv("KU_HOME")
+	if home == "" {
+		if runtime.GOOS == "windows" {
+			exe, err := os.Executable()
+			if err != nil {
+				panic("INIT ERROR: Cannot locate ku executable: " + err.Error())
+			}
+			home = filepath.Dir(exe)
+		} else {
+			home = "/usr/local/ku"
+		}
+	}
+	return home
+}
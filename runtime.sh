@@ -1,2 +1,3 @@
 cp runtime.ku /usr/local/ku/lib/
-
+mkdir -p /usr/local/ku/lib/std
+cp -r lib/std/* /usr/local/ku/lib/std/
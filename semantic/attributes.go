@@ -1,14 +1,21 @@
 package semantic
 
 import (
+	"math/big"
+	"strings"
+
 	"github.com/ku-lang/ku/ast"
 	"github.com/ku-lang/ku/parser"
 )
 
 type AttributeCheck struct {
+	parameters map[*ast.VariableDecl]bool
+}
+
+func (v *AttributeCheck) Init(s *SemanticAnalyzer) {
+	v.parameters = make(map[*ast.VariableDecl]bool)
 }
 
-func (v *AttributeCheck) Init(s *SemanticAnalyzer)       {}
 func (v *AttributeCheck) EnterScope(s *SemanticAnalyzer) {}
 func (v *AttributeCheck) ExitScope(s *SemanticAnalyzer)  {}
 
@@ -23,6 +30,8 @@ func (v *AttributeCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
 		switch typ.(type) {
 		case ast.StructType:
 			v.CheckStructType(s, typ.(ast.StructType))
+		case ast.EnumType:
+			v.CheckEnumType(s, n, typ.(ast.EnumType))
 		}
 
 	case *ast.FunctionDecl:
@@ -42,10 +51,19 @@ func (v *AttributeCheck) Finalize(s *SemanticAnalyzer) {
 func (v *AttributeCheck) CheckFunctionDecl(s *SemanticAnalyzer, n *ast.FunctionDecl) {
 	v.CheckAttrsDistanceFromLine(s, n.Function.Type.Attrs(), n.Pos().Line, "function", n.Function.Name)
 
+	for _, param := range n.Function.Parameters {
+		v.parameters[param] = true
+	}
+
 	for _, attr := range n.Function.Type.Attrs() {
 		switch attr.Key {
 		case "deprecated":
 		case "C":
+		case "pure":
+			if attr.Value != "" {
+				s.Err(attr, "Function attribute `pure` doesn't expect a value")
+			}
+
 		case "call_conv":
 		case "nomangle":
 		case "inline":
@@ -56,12 +74,114 @@ func (v *AttributeCheck) CheckFunctionDecl(s *SemanticAnalyzer, n *ast.FunctionD
 			default:
 				s.Err(attr, "Invalid value `%s` for [inline] attribute", attr.Value)
 			}
+		case "hook":
+			v.checkHook(s, n, attr)
+		case "command":
+			v.checkCommand(s, n, attr)
+		case "unsafe":
+			if attr.Value != "" {
+				s.Err(attr, "Function attribute `unsafe` doesn't expect a value")
+			}
+		case "test":
+			v.checkTest(s, n, attr)
 		default:
 			s.Err(attr, "Invalid function attribute key `%s`", attr.Key)
 		}
 	}
 }
 
+// checkTest 检查 [test] 标注：ku test 运行的测试函数没有参数和返回值，也不是方法或泛型函数（参见test.go）
+func (v *AttributeCheck) checkTest(s *SemanticAnalyzer, n *ast.FunctionDecl, attr *parser.Attr) {
+	fn := n.Function
+	if attr.Value != "" {
+		s.Err(attr, "Function attribute `test` doesn't expect a value")
+	}
+	if fn.Receiver != nil || fn.StaticReceiverType != nil || len(fn.Type.GenericParameters) > 0 {
+		s.Err(attr, "Test function `%s` cannot be a method or generic", fn.Name)
+	}
+	if len(fn.Parameters) > 0 || fn.Type.IsVariadic || fn.Type.Return.BaseType.ActualType() != ast.PRIMITIVE_void {
+		s.Err(attr, "Test function `%s` must have no parameters and no return value", fn.Name)
+	}
+}
+
+// checkCommand 检查 [command(argv)] 标注：它给出运行命令的函数中命令参数的名字，参数的类型是 []string（参见 command.go）
+func (v *AttributeCheck) checkCommand(s *SemanticAnalyzer, n *ast.FunctionDecl, attr *parser.Attr) {
+	if attr.Value == "" {
+		s.Err(attr, "Function attribute `command` expects the name of a parameter, like [command(argv)]")
+		return
+	}
+	idx := commandParameter(n.Function)
+	if idx < 0 {
+		s.Err(attr, "Function `%s` has no parameter `%s` named by its [command] attribute", n.Function.Name, attr.Value)
+		return
+	}
+	par := n.Function.Parameters[idx].Variable
+	if arr, ok := par.Type.BaseType.ActualType().(ast.ArrayType); !ok || arr.IsFixedLength || !isKuString(arr.MemberType) {
+		s.Err(attr, "Command parameter `%s` must be of type `[]string`, found `%s`", par.Name, par.Type.String())
+	}
+}
+
+// checkHook 检查 [hook(name)] 标注：运行时中的函数以它定义钩子的默认实现，
+// 其他模块中的函数以它替换钩子，签名必须与默认实现一致
+func (v *AttributeCheck) checkHook(s *SemanticAnalyzer, n *ast.FunctionDecl, attr *parser.Attr) {
+	fn := n.Function
+	if attr.Value == "" {
+		s.Err(attr, "Function attribute `hook` expects the name of a runtime hook, like [hook(panic)]")
+		return
+	}
+	if n.Prototype || fn.Receiver != nil || fn.StaticReceiverType != nil || len(fn.Type.GenericParameters) > 0 || fn.Type.Attrs().Contains("C") {
+		s.Err(attr, "Runtime hook `%s` must be a non-generic function with a body", attr.Value)
+		return
+	}
+	if s.Module.IsRuntime() {
+		return
+	}
+
+	def := ast.RuntimeHook(attr.Value)
+	if def == nil {
+		s.Err(attr, "Unknown runtime hook `%s`, expected one of: %s", attr.Value, strings.Join(ast.RuntimeHookNames(), ", "))
+		return
+	}
+	if !hookSignatureEqual(def.Type, fn.Type) {
+		s.Err(n, "Runtime hook `%s` must have the signature `%s`, have `%s`", attr.Value, hookSignature(def.Type), hookSignature(fn.Type))
+	}
+}
+
+func hookSignatureEqual(a, b ast.FunctionType) bool {
+	if len(a.Parameters) != len(b.Parameters) || a.IsVariadic != b.IsVariadic {
+		return false
+	}
+	for idx, par := range a.Parameters {
+		if !ast.Identical(par, b.Parameters[idx]) {
+			return false
+		}
+	}
+	if returnsVoid(a) || returnsVoid(b) {
+		return returnsVoid(a) && returnsVoid(b)
+	}
+	return ast.Identical(a.Return, b.Return)
+}
+
+func returnsVoid(typ ast.FunctionType) bool {
+	return typ.Return == nil || typ.Return.BaseType.IsVoidType()
+}
+
+// hookSignature 钩子的签名，如 fun(string)
+func hookSignature(typ ast.FunctionType) string {
+	var pars []string
+	for _, par := range typ.Parameters {
+		pars = append(pars, par.String())
+	}
+	if typ.IsVariadic {
+		pars = append(pars, "...")
+	}
+	res := "fun(" + strings.Join(pars, ", ") + ")"
+	if !returnsVoid(typ) {
+		res += " " + typ.Return.String()
+	}
+	return res
+}
+
 func (v *AttributeCheck) CheckStructType(s *SemanticAnalyzer, n ast.StructType) {
 	for _, attr := range n.Attrs() {
 		switch attr.Key {
@@ -69,6 +189,26 @@ func (v *AttributeCheck) CheckStructType(s *SemanticAnalyzer, n ast.StructType)
 			if attr.Value != "" {
 				s.Err(attr, "Struct attribute `%s` doesn't expect value", attr.Key)
 			}
+			if n.IsUnion {
+				s.Err(attr, "Attribute `packed` is not valid on union types")
+			}
+		case "layout":
+			if attr.Value != "c" {
+				s.Err(attr, "Invalid value `%s` for [layout] attribute, expected `c`", attr.Value)
+			}
+		case "owned":
+			// 不能复制的类型，参见 ast/move.go
+			if attr.Value != "" {
+				s.Err(attr, "Struct attribute `%s` doesn't expect value", attr.Key)
+			}
+		case "derive":
+			// 比较，参见 ast/compare.go
+			if attr.Value != "eq" && attr.Value != "ord" {
+				s.Err(attr, "Invalid value `%s` for [derive] attribute, expected `eq` or `ord`", attr.Value)
+			}
+			if n.IsUnion {
+				s.Err(attr, "Attribute `derive` is not valid on union types")
+			}
 		case "deprecated":
 			// value is optional, nothing to check
 		default:
@@ -77,6 +217,108 @@ func (v *AttributeCheck) CheckStructType(s *SemanticAnalyzer, n ast.StructType)
 	}
 }
 
+func (v *AttributeCheck) CheckEnumType(s *SemanticAnalyzer, decl *ast.TypeDecl, n ast.EnumType) {
+	for _, attr := range n.Attrs() {
+		switch attr.Key {
+		case "repr":
+			v.checkEnumRepr(s, decl, attr, n)
+		case "flags":
+			v.checkEnumFlags(s, decl, attr, n)
+		case "derive":
+			// 只有结构体可以排序，简单枚举按标签排序
+			if attr.Value != "eq" {
+				s.Err(attr, "Invalid value `%s` for enum [derive] attribute, expected `eq`", attr.Value)
+			}
+		case "deprecated":
+			// value is optional, nothing to check
+		default:
+			s.Err(attr, "Invalid enum attribute key `%s`", attr.Key)
+		}
+	}
+}
+
+// checkEnumRepr 检查 [repr(...)] 标注：必须是定长整数类型，并且所有成员的标签都在这个类型的范围内
+func (v *AttributeCheck) checkEnumRepr(s *SemanticAnalyzer, decl *ast.TypeDecl, attr *parser.Attr, n ast.EnumType) {
+	typ, ok := ast.PrimitiveTypeFromName(attr.Value)
+	if !ok || fixedIntegerBits(typ) == 0 {
+		s.Err(attr, "Enum representation must be a fixed-width integer type, have `%s`", attr.Value)
+		return
+	}
+
+	min, max := integerTypeRange(typ)
+	for _, mem := range n.Members {
+		tag := big.NewInt(int64(mem.Tag))
+		if tag.Cmp(min) < 0 || tag.Cmp(max) > 0 {
+			s.Err(decl, "Tag `%d` of enum member `%s` does not fit in representation `%s`", mem.Tag, mem.Name, typ.TypeName())
+		}
+	}
+}
+
+// checkEnumFlags 检查 [flags] 标注：枚举必须是非泛型的简单枚举，
+// 每个成员的标签必须是0、2的幂，或者是其他单个位成员的组合
+func (v *AttributeCheck) checkEnumFlags(s *SemanticAnalyzer, decl *ast.TypeDecl, attr *parser.Attr, n ast.EnumType) {
+	if attr.Value != "" {
+		s.Err(attr, "Enum attribute `flags` doesn't expect a value")
+	}
+
+	if !n.Simple || len(n.GenericParameters) > 0 {
+		s.Err(attr, "Only simple, non-generic enums can be flags enums")
+		return
+	}
+
+	singleBits := 0
+	for _, mem := range n.Members {
+		if isPowerOfTwo(mem.Tag) {
+			singleBits |= mem.Tag
+		}
+	}
+
+	for _, mem := range n.Members {
+		if mem.Tag < 0 {
+			s.Err(decl, "Tag `%d` of flags enum member `%s` must not be negative", mem.Tag, mem.Name)
+		} else if mem.Tag&^singleBits != 0 {
+			s.Err(decl, "Tag `%d` of flags enum member `%s` must be a power of two or a combination of other members", mem.Tag, mem.Name)
+		}
+	}
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// fixedIntegerBits 返回定长整数类型的位数。int、uint等长度依赖于平台的类型返回0
+func fixedIntegerBits(typ ast.PrimitiveType) int {
+	switch typ {
+	case ast.PRIMITIVE_u8, ast.PRIMITIVE_s8:
+		return 8
+	case ast.PRIMITIVE_u16, ast.PRIMITIVE_s16:
+		return 16
+	case ast.PRIMITIVE_u32, ast.PRIMITIVE_s32:
+		return 32
+	case ast.PRIMITIVE_u64, ast.PRIMITIVE_s64:
+		return 64
+	case ast.PRIMITIVE_u128, ast.PRIMITIVE_s128:
+		return 128
+	default:
+		return 0
+	}
+}
+
+// integerTypeRange 返回定长整数类型能表示的最小值和最大值
+func integerTypeRange(typ ast.PrimitiveType) (min, max *big.Int) {
+	bits := uint(fixedIntegerBits(typ))
+	if typ.IsSigned() {
+		max = new(big.Int).Lsh(big.NewInt(1), bits-1)
+		min = new(big.Int).Neg(max)
+		max.Sub(max, big.NewInt(1))
+	} else {
+		min = big.NewInt(0)
+		max = new(big.Int).Lsh(big.NewInt(1), bits)
+		max.Sub(max, big.NewInt(1))
+	}
+	return
+}
+
 /*func (v *AttributeCheck) CheckTraitDecl(s *SemanticAnalyzer, n *ast.TraitDecl) {
 	v.CheckAttrsDistanceFromLine(s, n.Trait.Attrs(), n.Pos().Line, "type", n.Trait.TypeName())
 
@@ -95,6 +337,41 @@ func (v *AttributeCheck) CheckVariableDecl(s *SemanticAnalyzer, n *ast.VariableD
 		case "deprecated":
 			// value is optional, nothing to check
 		case "nozero":
+		case "C":
+			if attr.Value != "" {
+				s.Err(attr, "Variable attribute `C` doesn't expect a value")
+			}
+			if n.Assignment != nil {
+				s.Err(n, "C variable `%s` is defined externally and can't have an initializer", n.Variable.Name)
+			}
+		case "weak":
+			if attr.Value != "" {
+				s.Err(attr, "Variable attribute `weak` doesn't expect a value")
+			}
+			if !n.Variable.Attrs.Contains("C") {
+				s.Err(attr, "Attribute `weak` is only valid on C variables")
+			}
+		case "thread_local":
+			// 如glibc和musl中的errno
+			if attr.Value != "" {
+				s.Err(attr, "Variable attribute `thread_local` doesn't expect a value")
+			}
+			if !n.Variable.Attrs.Contains("C") {
+				s.Err(attr, "Attribute `thread_local` is only valid on C variables")
+			}
+		case "noalias", "readonly":
+			if !v.parameters[n] {
+				s.Err(attr, "Attribute `%s` is only valid on function parameters", attr.Key)
+				continue
+			}
+			if attr.Value != "" {
+				s.Err(attr, "Parameter attribute `%s` doesn't expect a value", attr.Key)
+			}
+			switch n.Variable.Type.BaseType.ActualType().(type) {
+			case ast.PointerType, ast.ReferenceType:
+			default:
+				s.Err(attr, "Attribute `%s` requires a pointer or reference parameter, have `%s`", attr.Key, n.Variable.Type.String())
+			}
 		default:
 			s.Err(attr, "Invalid variable attribute key `%s`", attr.Key)
 		}
@@ -0,0 +1,58 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// ChainedComparisonCheck 检查链式比较，如 a < b < c。
+// 喾语言并不支持链式比较，这样的表达式会被解析为 (a < b) < c，即用bool和c比较。
+// 类型检查只会报出令人费解的类型不匹配，所以这里提前给出更明确的诊断和修改建议。
+type ChainedComparisonCheck struct {
+}
+
+func (_ ChainedComparisonCheck) Name() string { return "chained comparison" }
+
+func (v *ChainedComparisonCheck) Init(s *SemanticAnalyzer)       {}
+func (v *ChainedComparisonCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *ChainedComparisonCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *ChainedComparisonCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *ChainedComparisonCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	expr, ok := n.(*ast.BinaryExpr)
+	if !ok || expr.Op.Category() != parser.OP_COMPARISON {
+		return
+	}
+
+	if inner := chainedComparison(expr.Lhand, expr.Rhand); inner != nil {
+		s.Err(expr, "Chained comparison `a %s b %s c` is parsed as `(a %s b) %s c`; "+
+			"use `a %s b && b %s c` for a range check, or add parentheses to compare the boolean result",
+			inner.Op.OpString(), expr.Op.OpString(), inner.Op.OpString(), expr.Op.OpString(),
+			inner.Op.OpString(), expr.Op.OpString())
+	} else if inner := chainedComparison(expr.Rhand, expr.Lhand); inner != nil {
+		s.Err(expr, "Chained comparison `a %s b %s c` is parsed as `a %s (b %s c)`; "+
+			"use `a %s b && b %s c` for a range check, or add parentheses to compare the boolean result",
+			expr.Op.OpString(), inner.Op.OpString(), expr.Op.OpString(), inner.Op.OpString(),
+			expr.Op.OpString(), inner.Op.OpString())
+	}
+}
+
+func (v *ChainedComparisonCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+// chainedComparison 如果operand是没有括号的比较表达式，而另一侧other不是bool类型，则返回operand。
+// 两侧都是bool的情况（比如 a < b == c < d）是合法的比较，不需要报错。
+func chainedComparison(operand, other ast.Expr) *ast.BinaryExpr {
+	inner, ok := operand.(*ast.BinaryExpr)
+	if !ok || inner.Parenthesized || inner.Op.Category() != parser.OP_COMPARISON {
+		return nil
+	}
+
+	if typ := other.GetType(); typ != nil && ast.Identical(typ, typeRefTo(ast.PRIMITIVE_bool)) {
+		return nil
+	}
+
+	return inner
+}
@@ -0,0 +1,98 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// 运行命令的函数的参数检查
+//
+// 标注了 [command(argv)] 的函数（如 std.process 中的 spawn）的参数argv是要运行的命令：
+// 第一个元素是程序名，其余是传给程序的参数。空的命令在运行时才会失败，
+// 实参是数组字面量，或者用数组字面量初始化的不可变变量时，CommandCheck 在编译时检查：
+// 命令不能为空，程序名是字符串字面量时也不能为空。其它的实参无法在编译时知道内容，不做检查。
+
+// commandParameter 标注了 [command(name)] 的函数中命令参数的位置，没有标注时返回-1
+func commandParameter(fn *ast.Function) int {
+	attr := fn.Type.Attrs().Get("command")
+	if attr == nil {
+		return -1
+	}
+	for idx, par := range fn.Parameters {
+		if par.Variable.Name == attr.Value {
+			return idx
+		}
+	}
+	return -1
+}
+
+type CommandCheck struct {
+	literals map[*ast.Variable]*ast.CompositeLiteral // 用数组字面量初始化的不可变变量
+}
+
+func (_ CommandCheck) Name() string { return "command" }
+
+func (v *CommandCheck) Init(s *SemanticAnalyzer) {
+	v.literals = make(map[*ast.Variable]*ast.CompositeLiteral)
+	for _, submod := range s.Module.Parts {
+		for _, node := range submod.Nodes {
+			if decl, ok := node.(*ast.VariableDecl); ok {
+				v.addLiteral(decl)
+			}
+		}
+	}
+}
+
+func (v *CommandCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *CommandCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *CommandCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *CommandCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.VariableDecl:
+		v.addLiteral(n)
+	case *ast.CallExpr:
+		v.checkCall(s, n)
+	}
+}
+
+func (v *CommandCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+func (v *CommandCheck) addLiteral(decl *ast.VariableDecl) {
+	if decl.Variable.Mutable {
+		return
+	}
+	if lit, ok := decl.Assignment.(*ast.CompositeLiteral); ok {
+		v.literals[decl.Variable] = lit
+	}
+}
+
+func (v *CommandCheck) checkCall(s *SemanticAnalyzer, call *ast.CallExpr) {
+	fae, ok := call.Function.(*ast.FunctionAccessExpr)
+	if !ok {
+		return
+	}
+	idx := commandParameter(fae.Function)
+	if idx < 0 || idx >= len(call.Arguments) {
+		return
+	}
+
+	arg := call.Arguments[idx]
+	lit, ok := arg.(*ast.CompositeLiteral)
+	if vae, isVar := arg.(*ast.VariableAccessExpr); isVar && vae.Variable != nil {
+		lit, ok = v.literals[vae.Variable]
+	}
+	if !ok {
+		return
+	}
+
+	if len(lit.Values) == 0 {
+		s.Err(arg, "Command passed to `%s` is empty, the first element must be the program to run", fae.Function.Name)
+		return
+	}
+	if str, ok := lit.Values[0].(*ast.StringLiteral); ok && str.Value == "" {
+		s.Err(lit.Values[0], "Program name in the command passed to `%s` is empty", fae.Function.Name)
+	}
+}
@@ -0,0 +1,75 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// 作为表达式的if和match（ast.CondExpr）
+//
+// 表达式总要有值：if必须有else分支，match必须有 _ 分支，或者（匹配枚举时）包括枚举的所有成员。
+// 每个分支要么以一个表达式结束（代码块的值），要么不会执行到结尾（return、break、无限循环等）。
+// 分支的值不能是void，并且要能赋值给整个表达式的类型，需要时装箱为接口值（与变量的初始值相同）。
+
+func (v *TypeCheck) CheckCondExpr(s *SemanticAnalyzer, expr *ast.CondExpr) {
+	switch stat := expr.Stat.(type) {
+	case *ast.IfStat:
+		if stat.Else == nil {
+			s.Err(expr, "If expression must have an `else` branch")
+			return
+		}
+
+	case *ast.MatchStat:
+		if !matchIsExhaustive(stat) {
+			s.Err(expr, "Match expression must have a `_` branch or cover every member of the enum")
+			return
+		}
+	}
+
+	typ := expr.GetType()
+	for _, branch := range expr.Branches() {
+		block, ok := branch.(*ast.Block)
+		if !ok || block.Tail == nil {
+			if !IsNodeTerminating(branch) {
+				s.Err(branch, "Branch of %s has no value", expr.NodeName())
+			}
+			continue
+		}
+
+		tailType := block.Tail.GetType()
+		if tailType == nil || tailType.BaseType.IsVoidType() {
+			s.Err(block.Tail, "Value of %s branch has type `void`", expr.NodeName())
+			continue
+		}
+		if typ != nil {
+			expectType(s, block.Tail, typ, &block.Tail)
+		}
+	}
+}
+
+// matchIsExhaustive match语句有 _ 分支，或者匹配枚举时有每一个成员的分支
+func matchIsExhaustive(stat *ast.MatchStat) bool {
+	covered := make(map[string]bool)
+	for pattern := range stat.Branches {
+		switch pattern := pattern.(type) {
+		case *ast.DiscardAccessExpr:
+			return true
+		case *ast.EnumPatternExpr:
+			covered[pattern.MemberName.Name] = true
+		}
+	}
+
+	targetType := stat.Target.GetType()
+	if targetType == nil {
+		return false
+	}
+	et, ok := targetType.BaseType.ActualType().(ast.EnumType)
+	if !ok {
+		return false
+	}
+	for _, mem := range et.Members {
+		if !covered[mem.Name] {
+			return false
+		}
+	}
+	return true
+}
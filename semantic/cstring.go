@@ -0,0 +1,161 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// C字符串的转换
+//
+// ku的字符串不以NUL结尾，cstr(s) 把它复制到缓冲区（参见 LLVMCodegen/cstring.go），得到以NUL结尾的 ^u8。
+// 传给C函数的 ^u8 形参的字符串隐式转换：字符串字面量直接作为C字符串字面量生成，
+// 其它字符串包装为隐式的 cstr，缓冲区只在这次调用期间有效。C函数的 ^var u8 形参可能写入字符串，不做转换。
+//
+// cstr 的缓冲区在离开所在的块时失效，CStringCheck 检查转换得到的指针不会离开这个块：
+// 不能被返回，不能存入全局变量、类型的静态成员或者在块外声明的变量。检查只跟踪直接保存了转换结果的局部变量，
+// 经过结构体成员、数组等的传递不做检查。
+
+// isKuString 类型是否为ku的字符串（string或者 []u8）
+func isKuString(typ *ast.TypeReference) bool {
+	return typ != nil && typ.BaseType.ActualType().Equals(ast.ArrayOf(&ast.TypeReference{BaseType: ast.PRIMITIVE_u8}, false, 0))
+}
+
+// cStringPointer 类型是否为指向u8的指针，以及指针是否可变
+func cStringPointer(typ *ast.TypeReference) (isPointer, mutable bool) {
+	ptr, ok := typ.BaseType.ActualType().(ast.PointerType)
+	if !ok || ptr.Addressee.BaseType.ActualType() != ast.PRIMITIVE_u8 {
+		return false, false
+	}
+	return true, ptr.IsMutable
+}
+
+// convertCStringArgument 把传给C函数fnName的 ^u8 形参par的字符串实参转换为C字符串。
+// 返回true表示已经处理了这个实参（转换或者报错），不再需要检查类型
+func convertCStringArgument(s *SemanticAnalyzer, fnName string, par *ast.TypeReference, expr *ast.Expr) bool {
+	arg := *expr
+	isPointer, mutable := cStringPointer(par)
+	if !isPointer || !isKuString(arg.GetType()) {
+		return false
+	}
+
+	if mutable {
+		s.Err(arg, "Cannot pass `%s` to parameter of type `%s` of C function `%s`, the function may write to it; pass a buffer instead",
+			arg.GetType().String(), par.String(), fnName)
+		return true
+	}
+
+	if lit, ok := arg.(*ast.StringLiteral); ok {
+		lit.IsCString = true
+		lit.Type = nil
+		return true
+	}
+
+	conv := &ast.CStringExpr{Expr: arg, Implicit: true}
+	conv.SetPos(arg.Pos())
+	*expr = conv
+	return true
+}
+
+type CStringCheck struct {
+	InFunction int
+	depth      int                    // 当前块的嵌套深度
+	globals    map[*ast.Variable]bool // 当前模块（所有子模块）的全局变量
+	locals     map[*ast.Variable]int  // 局部变量 -> 声明它的块的深度
+	buffers    map[*ast.Variable]int  // 保存了转换得到的C字符串的局部变量 -> 缓冲区所在的块的深度
+}
+
+func (_ CStringCheck) Name() string { return "cstring" }
+
+func (v *CStringCheck) Init(s *SemanticAnalyzer) {
+	v.InFunction = 0
+	v.depth = 0
+	v.globals = make(map[*ast.Variable]bool)
+	v.locals = make(map[*ast.Variable]int)
+	v.buffers = make(map[*ast.Variable]int)
+	for _, submod := range s.Module.Parts {
+		for _, node := range submod.Nodes {
+			if decl, ok := node.(*ast.VariableDecl); ok {
+				v.globals[decl.Variable] = true
+			}
+		}
+	}
+}
+
+func (v *CStringCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *CStringCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *CStringCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {
+	switch n.(type) {
+	case *ast.FunctionDecl, *ast.LambdaExpr:
+		v.InFunction--
+	case *ast.Block:
+		v.depth--
+	}
+}
+
+func (v *CStringCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FunctionDecl, *ast.LambdaExpr:
+		v.InFunction++
+
+	case *ast.Block:
+		v.depth++
+
+	case *ast.VariableDecl:
+		if v.InFunction <= 0 {
+			if _, ok := v.holdsBuffer(n.Assignment); ok {
+				s.Err(n, "Global variable `%s` can't be initialized with a C string converted by `cstr`, the buffer is only valid until the end of the block", n.Variable.Name)
+			}
+			break
+		}
+		v.locals[n.Variable] = v.depth
+		if depth, ok := v.holdsBuffer(n.Assignment); ok {
+			v.buffers[n.Variable] = depth
+		}
+
+	case *ast.AssignStat:
+		depth, ok := v.holdsBuffer(n.Assignment)
+		if !ok {
+			break
+		}
+		if vae, ok := n.Access.(*ast.VariableAccessExpr); ok && vae.Variable != nil {
+			if v.isGlobal(s, vae.Variable) {
+				s.Err(n, "C string converted by `cstr` can't be stored in global variable `%s`, the buffer is only valid until the end of the block", vae.Variable.Name)
+			} else if declared, ok := v.locals[vae.Variable]; !ok || declared < depth {
+				s.Err(n, "C string converted by `cstr` can't be stored in `%s` declared outside the block, the buffer is only valid until the end of the block", vae.Variable.Name)
+			} else {
+				v.buffers[vae.Variable] = depth
+			}
+		}
+
+	case *ast.ReturnStat:
+		if _, ok := v.holdsBuffer(n.Value); ok {
+			s.Err(n, "C string converted by `cstr` can't be returned, the buffer is only valid until the end of the block")
+		}
+	}
+}
+
+func (v *CStringCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+// holdsBuffer 表达式的值是否为转换得到的C字符串缓冲区，以及缓冲区所在的块的深度
+func (v *CStringCheck) holdsBuffer(expr ast.Expr) (int, bool) {
+	switch expr := expr.(type) {
+	case *ast.CStringExpr:
+		return v.depth, true
+	case *ast.CastExpr:
+		return v.holdsBuffer(expr.Expr)
+	case *ast.VariableAccessExpr:
+		if expr.Variable != nil {
+			depth, ok := v.buffers[expr.Variable]
+			return depth, ok
+		}
+	}
+	return 0, false
+}
+
+// isGlobal 变量是否为全局变量：当前模块的顶层变量、类型的静态成员，或者其它模块的变量
+func (v *CStringCheck) isGlobal(s *SemanticAnalyzer, vari *ast.Variable) bool {
+	return v.globals[vari] || vari.StaticReceiverType != nil ||
+		(vari.ParentModule != nil && vari.ParentModule != s.Module)
+}
@@ -0,0 +1,46 @@
+package semantic
+
+import (
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+)
+
+// DirectiveCheck 检查文件中的 #warn 指令给出的警告名和 #feature 指令给出的特性，参见 ast/directive.go
+type DirectiveCheck struct{}
+
+func (_ DirectiveCheck) Name() string { return "directive" }
+
+func (v *DirectiveCheck) Init(s *SemanticAnalyzer) {
+	names := warningNames()
+	for _, directive := range s.Submodule.WarnDirectives {
+		known := false
+		for _, name := range names {
+			known = known || name == directive.Name
+		}
+		if !known {
+			s.Err(directive, "No warning named `%s`, expected one of: %s", directive.Name, strings.Join(names, ", "))
+		}
+	}
+
+	for _, directive := range s.Submodule.FeatureDirectives {
+		if !ast.IsLanguageFeature(directive.Feature) {
+			s.Err(directive, "%s", ast.UnknownFeatureMessage(directive.Feature))
+		}
+	}
+}
+
+func (v *DirectiveCheck) EnterScope(s *SemanticAnalyzer)            {}
+func (v *DirectiveCheck) ExitScope(s *SemanticAnalyzer)             {}
+func (v *DirectiveCheck) Visit(s *SemanticAnalyzer, n ast.Node)     {}
+func (v *DirectiveCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+func (v *DirectiveCheck) Finalize(s *SemanticAnalyzer)              {}
+
+// warningNames 可以在 #warn 中使用的警告名，即各个语义检查的名字
+func warningNames() []string {
+	var names []string
+	for _, check := range append(semanticChecks(), &UnusedCheck{}) {
+		names = append(names, check.Name())
+	}
+	return names
+}
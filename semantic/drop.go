@@ -0,0 +1,121 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// DropCheck 检查drop方法（参见 ast/drop.go）：
+//   - drop方法没有参数、返回值和自己的泛型参数；
+//   - 自动drop的变量不能显式调用drop。
+//
+// 有drop方法的值不能复制，参见 MoveCheck
+type DropCheck struct {
+	functions []*dropScope
+}
+
+type dropScope struct {
+	fn *ast.Function
+	// 函数中自动drop的局部变量和参数
+	owned map[*ast.Variable]bool
+}
+
+func (_ DropCheck) Name() string { return "drop" }
+
+func (v *DropCheck) Init(s *SemanticAnalyzer) {
+	v.functions = nil
+}
+
+func (v *DropCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *DropCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *DropCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {
+	switch n.(type) {
+	case *ast.FunctionDecl, *ast.LambdaExpr:
+		v.functions = v.functions[:len(v.functions)-1]
+	}
+}
+
+func (v *DropCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FunctionDecl:
+		v.checkDropMethod(s, n, n.Function)
+		v.pushFunction(n.Function)
+		return
+	case *ast.LambdaExpr:
+		v.pushFunction(n.Function)
+		return
+	}
+
+	if len(v.functions) == 0 {
+		return
+	}
+	scope := v.functions[len(v.functions)-1]
+
+	switch n := n.(type) {
+	case *ast.VariableDecl:
+		if ast.DropMethod(n.Variable.Type) != nil {
+			scope.owned[n.Variable] = true
+		}
+
+	case *ast.DestructVarDecl:
+		for idx, vari := range n.Variables {
+			if !n.ShouldDiscard[idx] && ast.DropMethod(vari.Type) != nil {
+				scope.owned[vari] = true
+			}
+		}
+
+	case *ast.CallExpr:
+		v.checkExplicitDrop(s, scope, n)
+	}
+}
+
+func (v *DropCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+func (v *DropCheck) pushFunction(fn *ast.Function) {
+	scope := &dropScope{fn: fn, owned: make(map[*ast.Variable]bool)}
+	for _, param := range fn.Parameters {
+		if ast.DropMethod(param.Variable.Type) != nil {
+			scope.owned[param.Variable] = true
+		}
+	}
+	v.functions = append(v.functions, scope)
+}
+
+// checkDropMethod 检查drop方法的签名
+func (v *DropCheck) checkDropMethod(s *SemanticAnalyzer, loc ast.Locatable, fn *ast.Function) {
+	if fn.Name != ast.DropMethodName || fn.Receiver == nil {
+		return
+	}
+
+	if len(fn.Parameters) > 0 {
+		s.Err(loc, "Drop method `%s` cannot take parameters", fn.Name)
+	}
+	if fn.Type.Return != nil && !fn.Type.Return.BaseType.IsVoidType() {
+		s.Err(loc, "Drop method `%s` cannot return a value, found `%s`", fn.Name, fn.Type.Return.String())
+	}
+	recv := ast.TypeReferenceWithoutPointers(fn.Type.Receiver)
+	if len(fn.Type.GenericParameters) > len(recv.GenericArguments) {
+		s.Err(loc, "Drop method `%s` cannot have its own type parameters", fn.Name)
+	}
+}
+
+// checkExplicitDrop 自动drop的变量在离开作用域时还会drop一次。通过成员、指针或者接收者调用drop由调用者负责
+func (v *DropCheck) checkExplicitDrop(s *SemanticAnalyzer, scope *dropScope, call *ast.CallExpr) {
+	fae, ok := call.Function.(*ast.FunctionAccessExpr)
+	if !ok || fae.Function.Name != ast.DropMethodName || call.ReceiverAccess == nil {
+		return
+	}
+
+	recv := call.ReceiverAccess
+	switch addr := recv.(type) {
+	case *ast.ReferenceToExpr:
+		recv = addr.Access
+	case *ast.PointerToExpr:
+		recv = addr.Access
+	}
+	if vae, ok := recv.(*ast.VariableAccessExpr); ok && scope.owned[vae.Variable] {
+		s.Err(call, "Variable `%s` is dropped automatically at the end of its scope, calling `drop` would drop it twice", vae.Variable.Name)
+	}
+}
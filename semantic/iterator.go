@@ -0,0 +1,51 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// IteratorCheck 检查for-in循环使用的迭代器协议方法的签名：
+// 迭代的值的 iter() 没有参数，返回迭代器；迭代器的 next() 没有参数，返回 Option<T>。
+// 要在TypeCheck之前执行，以便给出比参数个数不对、类型不匹配更明确的错误
+type IteratorCheck struct {
+}
+
+func (_ IteratorCheck) Name() string { return "iterator" }
+
+func (v *IteratorCheck) Init(s *SemanticAnalyzer)       {}
+func (v *IteratorCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *IteratorCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *IteratorCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *IteratorCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	loop, ok := n.(*ast.LoopStat)
+	if !ok || loop.ForIn == nil {
+		return
+	}
+	forIn := loop.ForIn
+
+	iterType := forIn.IterCall.Function.GetType().BaseType.(ast.FunctionType)
+	if len(iterType.Parameters) != 0 {
+		s.Err(loop, "Method `iter` of type `%s` used in for loop must not have parameters",
+			forIn.Iterable.GetType().String())
+	}
+	if iterType.Return == nil || iterType.Return.BaseType.IsVoidType() {
+		s.Err(loop, "Method `iter` of type `%s` used in for loop must return an iterator",
+			forIn.Iterable.GetType().String())
+	}
+
+	nextType := forIn.NextCall.Function.GetType().BaseType.(ast.FunctionType)
+	iterator := forIn.IterCall.GetType().String()
+	if len(nextType.Parameters) != 0 {
+		s.Err(loop, "Method `next` of iterator type `%s` must not have parameters", iterator)
+	}
+	if !ast.IsOptionType(nextType.Return) {
+		s.Err(loop, "Method `next` of iterator type `%s` must return `Option<T>`, have `%s`",
+			iterator, nextType.Return.String())
+	}
+}
+
+func (v *IteratorCheck) Finalize(s *SemanticAnalyzer) {
+
+}
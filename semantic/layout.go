@@ -0,0 +1,79 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// FFILayoutCheck 检查与C共享的结构体是否标注了 [layout(c)]。
+// 编译器默认可以重排结构体的成员以减少填充，所以 [C] 函数、[nomangle] 函数
+// 和指定了调用约定的函数的参数与返回值中用到的结构体（包括通过指针、数组以及其他结构体的成员用到的），
+// 如果没有 [layout(c)] 或 [packed]，布局可能与C不同。
+type FFILayoutCheck struct {
+}
+
+func (_ FFILayoutCheck) Name() string { return "ffi layout" }
+
+func (v *FFILayoutCheck) Init(s *SemanticAnalyzer)       {}
+func (v *FFILayoutCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *FFILayoutCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *FFILayoutCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *FFILayoutCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	decl, ok := n.(*ast.FunctionDecl)
+	if !ok {
+		return
+	}
+
+	fn := decl.Function
+	attrs := fn.Type.Attrs()
+	if !attrs.Contains("C") && !attrs.Contains("nomangle") && !attrs.Contains("call_conv") {
+		return
+	}
+
+	visited := make(map[*ast.NamedType]bool)
+	var unordered []*ast.NamedType
+	for _, param := range fn.Parameters {
+		unordered = unorderedStructs(param.Variable.Type, visited, unordered)
+	}
+	unordered = unorderedStructs(fn.Type.Return, visited, unordered)
+
+	for _, named := range unordered {
+		s.Warn(decl, "Struct `%s` is shared with C by function `%s` but has no [layout(c)] attribute, its members may be reordered", named.TypeName(), fn.Name)
+	}
+}
+
+func (v *FFILayoutCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+// unorderedStructs 找出类型中用到的、成员可能被重排的命名结构体
+func unorderedStructs(typ *ast.TypeReference, visited map[*ast.NamedType]bool, res []*ast.NamedType) []*ast.NamedType {
+	if typ == nil {
+		return res
+	}
+
+	switch t := typ.BaseType.(type) {
+	case *ast.NamedType:
+		st, ok := t.ActualType().(ast.StructType)
+		if !ok || visited[t] {
+			return res
+		}
+		visited[t] = true
+
+		if !st.FixedLayout() {
+			res = append(res, t)
+		}
+		for _, mem := range st.Members {
+			res = unorderedStructs(mem.Type, visited, res)
+		}
+
+	case ast.PointerType:
+		res = unorderedStructs(t.Addressee, visited, res)
+	case ast.ReferenceType:
+		res = unorderedStructs(t.Referrer, visited, res)
+	case ast.ArrayType:
+		res = unorderedStructs(t.MemberType, visited, res)
+	}
+	return res
+}
@@ -31,13 +31,9 @@ func (v *MiscCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
 		}
 	} else {
 		switch n.(type) {
-		case *ast.TypeDecl:
+		// 嵌套函数可以声明在函数中，它们的限制在变量解析时检查，参见 ast.Resolver.resolveNestedFunction
+		case *ast.TypeDecl, *ast.TypeAliasDecl:
 			s.Err(n, "%s must not be in function", util.CapitalizeFirst(n.NodeName()))
-
-		case *ast.FunctionDecl:
-			if v.InFunction > 1 {
-				s.Err(n, "%s must not be in function", util.CapitalizeFirst(n.NodeName()))
-			}
 		}
 	}
 }
@@ -0,0 +1,432 @@
+package semantic
+
+import (
+	"sort"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/lexer"
+)
+
+// MoveCheck 检查有所有权的值的移动（参见 ast/move.go）：
+//   - 只能移出局部变量和参数；
+//   - 移出之后、重新赋值之前不能使用变量，包括只在某些分支中移出的变量。
+//
+// 每个函数按控制流逐个语句分析，记录每个位置上已经移出和可能移出的变量。
+// 分支汇合时取并集，只在一个分支中移出的变量是可能移出；循环重复分析直到不再变化，
+// 因此在循环中移出循环外的变量时，下一次循环的使用也会报错
+type MoveCheck struct{}
+
+func (_ MoveCheck) Name() string { return "move" }
+
+func (v *MoveCheck) Init(s *SemanticAnalyzer) {}
+
+func (v *MoveCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *MoveCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *MoveCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *MoveCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	// lambda的函数体由访问者单独访问到，分析时跳过
+	switch n := n.(type) {
+	case *ast.FunctionDecl:
+		v.checkFunction(s, n.Function)
+	case *ast.LambdaExpr:
+		v.checkFunction(s, n.Function)
+	}
+}
+
+func (v *MoveCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+func (v *MoveCheck) checkFunction(s *SemanticAnalyzer, fn *ast.Function) {
+	if fn.Body == nil {
+		return
+	}
+
+	fa := &moveAnalysis{
+		s:        s,
+		fn:       fn,
+		locals:   make(map[*ast.Variable]bool),
+		state:    make(moveState),
+		reported: make(map[ast.Node]bool),
+	}
+	for _, par := range fn.Parameters {
+		fa.locals[par.Variable] = true
+	}
+	fa.walkBlock(fn.Body)
+}
+
+// moved 变量在某个位置上的状态
+type moved struct {
+	maybe bool // 只在某些分支中移出
+	pos   lexer.Position
+}
+
+// moveState 已经移出的变量。nil表示不可达
+type moveState map[*ast.Variable]moved
+
+func (v moveState) clone() moveState {
+	if v == nil {
+		return nil
+	}
+	res := make(moveState, len(v))
+	for vari, m := range v {
+		res[vari] = m
+	}
+	return res
+}
+
+// mergeMoveStates 两条控制流汇合之后的状态
+func mergeMoveStates(a, b moveState) moveState {
+	if a == nil {
+		return b.clone()
+	}
+	if b == nil {
+		return a.clone()
+	}
+	res := make(moveState)
+	for vari, m := range a {
+		if other, ok := b[vari]; ok {
+			m.maybe = m.maybe || other.maybe
+		} else {
+			m.maybe = true
+		}
+		res[vari] = m
+	}
+	for vari, m := range b {
+		if _, ok := a[vari]; !ok {
+			m.maybe = true
+			res[vari] = m
+		}
+	}
+	return res
+}
+
+func moveStatesEqual(a, b moveState) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for vari, m := range a {
+		if other, ok := b[vari]; !ok || other.maybe != m.maybe {
+			return false
+		}
+	}
+	return true
+}
+
+type moveLoop struct {
+	breaks, continues moveState
+}
+
+type moveAnalysis struct {
+	s  *SemanticAnalyzer
+	fn *ast.Function
+
+	// 可以移出的变量：函数的参数和局部变量
+	locals map[*ast.Variable]bool
+
+	state moveState
+	loops []*moveLoop
+
+	// 循环会分析多次，同一个位置只报告一次
+	reported map[ast.Node]bool
+}
+
+func (v *moveAnalysis) walkBlock(block *ast.Block) {
+	if block == nil {
+		return
+	}
+	for _, node := range block.Nodes {
+		// 不可达的代码由 UnreachableCheck 报告
+		if v.state == nil {
+			return
+		}
+		v.walkNode(node)
+	}
+
+	// 代码块的值移出了代码块，与返回值相同
+	if block.Tail != nil && v.state != nil {
+		v.walkMove(block.Tail)
+	}
+}
+
+func (v *moveAnalysis) walkNode(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Block:
+		v.walkBlock(n)
+
+	case *ast.BlockStat:
+		v.walkBlock(n.Block)
+
+	case *ast.VariableDecl:
+		v.walkMove(n.Assignment)
+		v.declare(n.Variable)
+
+	case *ast.DestructVarDecl:
+		v.walkMove(n.Assignment)
+		for idx, vari := range n.Variables {
+			if !n.ShouldDiscard[idx] {
+				v.declare(vari)
+			}
+		}
+
+	case *ast.AssignStat:
+		v.walkMove(n.Assignment)
+		v.walkAssignee(n.Access)
+
+	case *ast.DestructAssignStat:
+		v.walkMove(n.Assignment)
+		for _, acc := range n.Accesses {
+			v.walkAssignee(acc)
+		}
+
+	case *ast.ReturnStat:
+		v.walkMove(n.Value)
+		v.state = nil
+
+	case *ast.BreakStat:
+		if len(v.loops) > 0 {
+			loop := v.loops[len(v.loops)-1]
+			loop.breaks = mergeMoveStates(loop.breaks, v.state)
+		}
+		v.state = nil
+
+	case *ast.ContinueStat:
+		if len(v.loops) > 0 {
+			loop := v.loops[len(v.loops)-1]
+			loop.continues = mergeMoveStates(loop.continues, v.state)
+		}
+		v.state = nil
+
+	case *ast.IfStat:
+		v.walkIf(n)
+
+	case *ast.LoopStat:
+		v.walkLoop(n)
+
+	case *ast.MatchStat:
+		v.walkMatch(n)
+
+	default:
+		v.walkExpr(node)
+	}
+}
+
+func (v *moveAnalysis) walkIf(n *ast.IfStat) {
+	var out moveState
+	for idx, expr := range n.Exprs {
+		v.walkExpr(expr)
+		notTaken := v.state.clone()
+		v.walkBlock(n.Bodies[idx])
+		out = mergeMoveStates(out, v.state)
+		v.state = notTaken
+	}
+	v.walkBlock(n.Else)
+	v.state = mergeMoveStates(out, v.state)
+}
+
+func (v *moveAnalysis) walkLoop(n *ast.LoopStat) {
+	entry := v.state.clone()
+	for {
+		loop := &moveLoop{}
+		v.loops = append(v.loops, loop)
+
+		v.state = entry.clone()
+		var condFalse moveState
+		if n.LoopType == ast.LOOP_TYPE_CONDITIONAL {
+			v.walkExpr(n.Condition)
+			condFalse = v.state.clone()
+		}
+		v.walkBlock(n.Body)
+		end := mergeMoveStates(v.state, loop.continues)
+
+		v.loops = v.loops[:len(v.loops)-1]
+
+		next := mergeMoveStates(entry, end)
+		if moveStatesEqual(next, entry) {
+			v.state = mergeMoveStates(loop.breaks, condFalse)
+			return
+		}
+		entry = next
+	}
+}
+
+func (v *moveAnalysis) walkMatch(n *ast.MatchStat) {
+	v.walkExpr(n.Target)
+	entry := v.state
+
+	// 按源码中的顺序分析分支，报告的顺序是确定的
+	branches := make([]ast.Node, 0, len(n.Branches))
+	for _, branch := range n.Branches {
+		branches = append(branches, branch)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := branches[i].Pos(), branches[j].Pos()
+		return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+	})
+
+	var out moveState
+	for _, branch := range branches {
+		v.state = entry.clone()
+		v.walkNode(branch)
+		out = mergeMoveStates(out, v.state)
+	}
+	if len(branches) == 0 {
+		out = entry
+	}
+	v.state = out
+}
+
+// declare 声明的变量是新的值。循环中的声明每次都是新的变量
+func (v *moveAnalysis) declare(vari *ast.Variable) {
+	v.locals[vari] = true
+	if v.state != nil {
+		delete(v.state, vari)
+	}
+}
+
+// walkAssignee 给变量赋值之后它又有了值；给成员等赋值需要变量仍然有值
+func (v *moveAnalysis) walkAssignee(acc ast.AccessExpr) {
+	if vae, ok := acc.(*ast.VariableAccessExpr); ok {
+		if v.state != nil {
+			delete(v.state, vae.Variable)
+		}
+		return
+	}
+	v.walkExpr(acc)
+}
+
+// walkMove 分析位于移动的位置上的表达式
+func (v *moveAnalysis) walkMove(expr ast.Expr) {
+	if expr == nil {
+		return
+	}
+	uses := &moveUses{analysis: v, moves: map[ast.Expr]bool{expr: true}}
+	ast.NewASTVisitor(uses).VisitExpr(expr)
+}
+
+func (v *moveAnalysis) walkExpr(node ast.Node) {
+	uses := &moveUses{analysis: v, moves: make(map[ast.Expr]bool)}
+	ast.NewASTVisitor(uses).Visit(node)
+}
+
+// use 使用变量时检查它是否已经移出，move表示这次使用移出了它
+func (v *moveAnalysis) use(vae *ast.VariableAccessExpr, move bool) {
+	vari := vae.Variable
+	if vari == nil || !ast.IsOwned(vari.Type) || v.state == nil {
+		return
+	}
+
+	if m, ok := v.state[vari]; ok && !v.reported[vae] {
+		v.reported[vae] = true
+		if m.maybe {
+			v.s.Err(vae, "Use of possibly moved value `%s`", vari.Name)
+		} else {
+			v.s.Err(vae, "Use of moved value `%s`", vari.Name)
+		}
+		if pos := vae.Pos(); m.pos.Line > pos.Line || (m.pos.Line == pos.Line && m.pos.Char >= pos.Char) {
+			v.s.Note(m.pos, "`%s` was moved here in a previous iteration of the loop", vari.Name)
+		} else {
+			v.s.Note(m.pos, "`%s` was moved here", vari.Name)
+		}
+	}
+
+	if move {
+		v.state[vari] = moved{pos: vae.Pos()}
+	}
+}
+
+// checkMoveSource 只能移出局部变量和参数
+func (v *moveAnalysis) checkMoveSource(expr ast.Expr) {
+	switch expr.(type) {
+	case *ast.VariableAccessExpr, *ast.StructAccessExpr, *ast.ArrayAccessExpr, *ast.DerefAccessExpr:
+	default:
+		return
+	}
+
+	typ := expr.GetType()
+	if typ == nil || !ast.IsOwned(typ) || v.reported[expr] {
+		return
+	}
+
+	if vae, ok := expr.(*ast.VariableAccessExpr); ok {
+		if v.locals[vae.Variable] {
+			return
+		}
+		v.reported[expr] = true
+		if v.fn.Receiver != nil && vae.Variable == v.fn.Receiver.Variable {
+			v.s.Err(expr, "Cannot move out of receiver `%s` of type `%s`, it is borrowed by the method", vae.Variable.Name, typ.String())
+		} else {
+			v.s.Err(expr, "Cannot move out of variable `%s` of type `%s`, only local variables and parameters can be moved", vae.Variable.Name, typ.String())
+		}
+		return
+	}
+
+	var what string
+	switch expr.(type) {
+	case *ast.StructAccessExpr:
+		what = "a struct member"
+	case *ast.ArrayAccessExpr:
+		what = "an array element"
+	case *ast.DerefAccessExpr:
+		what = "a pointer"
+	}
+	v.reported[expr] = true
+	v.s.Err(expr, "Cannot move a value of type `%s` out of %s, pass a reference or a pointer instead", typ.String(), what)
+}
+
+// moveUses 按求值的顺序访问表达式中的变量
+type moveUses struct {
+	analysis *moveAnalysis
+	moves    map[ast.Expr]bool // 位于移动的位置上的子表达式
+}
+
+func (v *moveUses) EnterScope() {}
+func (v *moveUses) ExitScope()  {}
+
+func (v *moveUses) Visit(node *ast.Node) bool {
+	if expr, ok := (*node).(ast.Expr); ok && v.moves[expr] {
+		v.analysis.checkMoveSource(expr)
+	}
+
+	switch n := (*node).(type) {
+	case *ast.LambdaExpr, *ast.FunctionDecl:
+		return false
+
+	case *ast.VariableAccessExpr:
+		v.analysis.use(n, v.moves[n])
+
+	case *ast.CallExpr:
+		// 接收者先于实参求值
+		vis := ast.NewASTVisitor(v)
+		vis.VisitExpr(n.Function)
+		vis.VisitExpr(n.ReceiverAccess)
+		for _, arg := range n.Arguments {
+			v.moves[arg] = true
+			vis.VisitExpr(arg)
+		}
+		return false
+
+	case *ast.CompositeLiteral:
+		for _, val := range n.Values {
+			v.moves[val] = true
+		}
+
+	case *ast.TupleLiteral:
+		for _, mem := range n.Members {
+			v.moves[mem] = true
+		}
+
+	case *ast.NewExpr:
+		v.moves[n.Expr] = true
+
+	case *ast.CondExpr:
+		// 作为表达式的if和match按语句分析控制流
+		v.analysis.walkNode(n.Stat)
+		return false
+	}
+	return true
+}
+
+func (v *moveUses) PostVisit(node *ast.Node) {}
@@ -0,0 +1,44 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// NaNComparisonCheck 检查与 nan 的相等比较。
+// NaN不等于任何值（包括它自身），所以 x == nan 永远为false，x != nan 永远为true，
+// 这几乎一定是想写 is_nan(x)。
+type NaNComparisonCheck struct {
+}
+
+func (_ NaNComparisonCheck) Name() string { return "nan comparison" }
+
+func (v *NaNComparisonCheck) Init(s *SemanticAnalyzer)       {}
+func (v *NaNComparisonCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *NaNComparisonCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *NaNComparisonCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *NaNComparisonCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	expr, ok := n.(*ast.BinaryExpr)
+	if !ok || (expr.Op != parser.BINOP_EQ && expr.Op != parser.BINOP_NOT_EQ) {
+		return
+	}
+
+	if isNaNLiteral(expr.Lhand) || isNaNLiteral(expr.Rhand) {
+		result := "false"
+		if expr.Op == parser.BINOP_NOT_EQ {
+			result = "true"
+		}
+		s.Warn(expr, "Comparison with `nan` using `%s` is always %s, use `is_nan(x)` to test for NaN", expr.Op.OpString(), result)
+	}
+}
+
+func (v *NaNComparisonCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+func isNaNLiteral(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.NumericLiteral)
+	return ok && lit.IsNaN()
+}
@@ -0,0 +1,144 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// PurityCheck 检查 [pure] 函数和 [readonly] 参数。
+// 纯函数只能读写自己的局部变量和参数、读取不可修改的全局变量、调用其他纯函数（标注的或者推导出的）；
+// [readonly] 参数指向的内存不能通过这个参数修改
+type PurityCheck struct {
+	functions []*purityScope
+}
+
+type purityScope struct {
+	fn     *ast.Function
+	locals map[*ast.Variable]bool
+}
+
+func (_ PurityCheck) Name() string { return "purity" }
+
+func (v *PurityCheck) Init(s *SemanticAnalyzer) {
+	v.functions = nil
+}
+
+func (v *PurityCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *PurityCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *PurityCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {
+	switch n.(type) {
+	case *ast.FunctionDecl, *ast.LambdaExpr:
+		v.functions = v.functions[:len(v.functions)-1]
+	}
+}
+
+func (v *PurityCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FunctionDecl:
+		v.pushFunction(n.Function)
+		return
+	case *ast.LambdaExpr:
+		v.pushFunction(n.Function)
+		return
+	}
+
+	if len(v.functions) == 0 {
+		return
+	}
+	scope := v.functions[len(v.functions)-1]
+	// 只检查标注了 [pure] 的函数，没有标注的函数的纯度是推导出来的
+	pure := scope.fn.Type.Attrs().Contains("pure")
+
+	switch n := n.(type) {
+	case *ast.VariableDecl:
+		scope.locals[n.Variable] = true
+
+	case *ast.AssignStat:
+		v.checkWrite(s, scope, pure, n.Access)
+
+	case *ast.BinopAssignStat:
+		v.checkWrite(s, scope, pure, n.Access)
+
+	case *ast.DestructAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(s, scope, pure, acc)
+		}
+
+	case *ast.DestructBinopAssignStat:
+		for _, acc := range n.Accesses {
+			v.checkWrite(s, scope, pure, acc)
+		}
+
+	case *ast.VolatileStoreStat:
+		// 与 @ptr = value 相同
+		deref := &ast.DerefAccessExpr{Expr: n.Pointer}
+		deref.SetPos(n.Pos())
+		v.checkWrite(s, scope, pure, deref)
+
+	// volatile读也是副作用
+	case *ast.VolatileLoadExpr:
+		if pure {
+			s.Err(n, "Pure function `%s` cannot perform volatile memory accesses", scope.fn.Name)
+		}
+
+	case *ast.VariableAccessExpr:
+		if pure && n.Variable != nil && n.Variable.Mutable && !scope.locals[n.Variable] {
+			s.Err(n, "Pure function `%s` cannot access mutable global variable `%s`", scope.fn.Name, n.Variable.Name)
+		}
+
+	case *ast.CallExpr:
+		if !pure {
+			return
+		}
+		if fae, ok := n.Function.(*ast.FunctionAccessExpr); ok {
+			if !IsPureFunction(fae.Function) {
+				s.Err(n, "Pure function `%s` cannot call impure function `%s`", scope.fn.Name, fae.Function.Name)
+			}
+		} else {
+			s.Err(n, "Pure function `%s` cannot call through a function value", scope.fn.Name)
+		}
+	}
+}
+
+func (v *PurityCheck) Finalize(s *SemanticAnalyzer) {
+
+}
+
+func (v *PurityCheck) pushFunction(fn *ast.Function) {
+	scope := &purityScope{fn: fn, locals: make(map[*ast.Variable]bool)}
+	if fn.Receiver != nil {
+		scope.locals[fn.Receiver.Variable] = true
+	}
+	for _, param := range fn.Parameters {
+		scope.locals[param.Variable] = true
+	}
+	v.functions = append(v.functions, scope)
+}
+
+func (v *PurityCheck) checkWrite(s *SemanticAnalyzer, scope *purityScope, pure bool, access ast.Expr) {
+	root, indirect := ast.AccessRoot(access)
+	if root == nil {
+		if pure && indirect {
+			s.Err(access, "Pure function `%s` cannot write through a pointer or reference", scope.fn.Name)
+		}
+		return
+	}
+
+	if indirect && root.Attrs.Contains("readonly") {
+		s.Err(access, "Cannot write through readonly parameter `%s`", root.Name)
+	}
+
+	if !pure {
+		return
+	}
+	if !scope.locals[root] {
+		s.Err(access, "Pure function `%s` cannot modify global variable `%s`", scope.fn.Name, root.Name)
+	} else if indirect {
+		s.Err(access, "Pure function `%s` cannot write through a pointer or reference", scope.fn.Name)
+	}
+}
+
+// IsPureFunction 函数是否是纯函数：标注了 [pure]，或者推导出满足纯函数的要求（参见 ast.Function.IsPure）
+func IsPureFunction(fn *ast.Function) bool {
+	return fn.IsPure()
+}
@@ -22,12 +22,12 @@ func (v *RecursiveDefinitionCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
 		if ok, path := isTypeRecursive(typ); ok {
 			s.Err(n, "Encountered recursive type definition")
 
-			log.Errorln("semantic", "Path taken:")
+			log.Errorln(log.TagSemantic, "Path taken:")
 			for _, typ := range path {
-				log.Error("semantic", typ.TypeName())
-				log.Error("semantic", " <- ")
+				log.Error(log.TagSemantic, typ.TypeName())
+				log.Error(log.TagSemantic, " <- ")
 			}
-			log.Error("semantic", "%s\n\n", typ.TypeName())
+			log.Error(log.TagSemantic, "%s\n\n", typ.TypeName())
 		}
 	}
 }
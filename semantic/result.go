@@ -0,0 +1,36 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// UnusedResultCheck 检查被忽略的 Result。返回 Result 的函数可能失败，
+// 调用语句直接丢弃返回值就无法发现错误。确实不需要处理时用 `_ = f()` 明确地丢弃
+type UnusedResultCheck struct {
+}
+
+func (_ UnusedResultCheck) Name() string { return "unused result" }
+
+func (v *UnusedResultCheck) Init(s *SemanticAnalyzer)       {}
+func (v *UnusedResultCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *UnusedResultCheck) ExitScope(s *SemanticAnalyzer)  {}
+
+func (v *UnusedResultCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+
+func (v *UnusedResultCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	stat, ok := n.(*ast.CallStat)
+	if !ok || !ast.IsResultType(stat.Call.GetType()) {
+		return
+	}
+
+	if fae, ok := stat.Call.Function.(*ast.FunctionAccessExpr); ok {
+		s.Err(stat, "Unused result of `%s` of type `%s`, handle the error or discard it with `_ = ...`",
+			fae.Function.Name, stat.Call.GetType().String())
+	} else {
+		s.Err(stat, "Unused result of type `%s`, handle the error or discard it with `_ = ...`", stat.Call.GetType().String())
+	}
+}
+
+func (v *UnusedResultCheck) Finalize(s *SemanticAnalyzer) {
+
+}
@@ -2,9 +2,9 @@ package semantic
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/lexer"
 	"github.com/ku-lang/ku/util"
 	"github.com/ku-lang/ku/util/log"
 )
@@ -31,37 +31,44 @@ type SemanticCheck interface {
 func (v *SemanticAnalyzer) Err(thing ast.Locatable, err string, stuff ...interface{}) {
 	pos := thing.Pos()
 
-	log.Error("semantic", util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
+	log.Error(log.TagSemantic, util.TEXT_RED+util.TEXT_BOLD+"error:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
 		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(err, stuff...))
 
-	log.Errorln("semantic", v.Submodule.File.MarkPos(pos))
+	log.Errorln(log.TagSemantic, v.Submodule.File.MarkPos(pos))
 
 	v.shouldExit = true
 }
 
+// Note 补充说明前一个错误，如要求某个类型的位置。位置在别的文件时不标记源码
+func (v *SemanticAnalyzer) Note(pos lexer.Position, note string, stuff ...interface{}) {
+	log.Error(log.TagSemantic, util.TEXT_BOLD+"note:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
+		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(note, stuff...))
+
+	if pos.Filename == v.Submodule.File.Name {
+		log.Errorln(log.TagSemantic, v.Submodule.File.MarkPos(pos))
+	}
+}
+
+// Warn 报告警告。警告的名字是当前检查的名字，文件中的 #warn 指令可以关闭它或者把它当作错误
 func (v *SemanticAnalyzer) Warn(thing ast.Locatable, err string, stuff ...interface{}) {
+	switch v.Submodule.WarnLevel(v.Check.Name()) {
+	case ast.WARN_OFF:
+		return
+	case ast.WARN_ERROR:
+		v.Err(thing, err+" (#warn(error, \"%s\"))", append(stuff, v.Check.Name())...)
+		return
+	}
+
 	pos := thing.Pos()
 
-	log.Warning("semantic", util.TEXT_YELLOW+util.TEXT_BOLD+"warning:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
+	log.Warning(log.TagSemantic, util.TEXT_YELLOW+util.TEXT_BOLD+"warning:"+util.TEXT_RESET+" [%s:%d:%d] %s\n",
 		pos.Filename, pos.Line, pos.Char, fmt.Sprintf(err, stuff...))
 
-	log.Warningln("semantic", v.Submodule.File.MarkPos(pos))
+	log.Warningln(log.TagSemantic, v.Submodule.File.MarkPos(pos))
 }
 
 func SemCheck(module *ast.Module, ignoreUnused bool) {
-	checks := []SemanticCheck{
-		&AttributeCheck{},
-		&UnreachableCheck{},
-		&BreakAndContinueCheck{},
-		&DeprecatedCheck{},
-		&RecursiveDefinitionCheck{},
-		&TypeCheck{},
-		&ImmutableAssignCheck{},
-		&UseBeforeDeclareCheck{},
-		&MiscCheck{},
-		&ReferenceCheck{},
-	}
-
+	checks := semanticChecks()
 	if !ignoreUnused {
 		checks = append(checks, &UnusedCheck{})
 	}
@@ -88,6 +95,35 @@ func SemCheck(module *ast.Module, ignoreUnused bool) {
 	}
 }
 
+// semanticChecks 依次执行的语义检查，不包括 UnusedCheck
+func semanticChecks() []SemanticCheck {
+	return []SemanticCheck{
+		&DirectiveCheck{},
+		&AttributeCheck{},
+		&UnreachableCheck{},
+		&BreakAndContinueCheck{},
+		&DeprecatedCheck{},
+		&RecursiveDefinitionCheck{},
+		&ChainedComparisonCheck{},
+		&NaNComparisonCheck{},
+		&FFILayoutCheck{},
+		&IteratorCheck{},
+		&TypeCheck{},
+		&StaticAssertCheck{},
+		&CStringCheck{},
+		&ImmutableAssignCheck{},
+		&PurityCheck{},
+		&UnsafeCheck{},
+		&UseBeforeDeclareCheck{},
+		&MiscCheck{},
+		&ReferenceCheck{},
+		&DropCheck{},
+		&MoveCheck{},
+		&UnusedResultCheck{},
+		&CommandCheck{},
+	}
+}
+
 // the initial check for a semantic pass
 // this will be called _once_ and should be
 // used to initialize things, etc...
@@ -101,14 +137,14 @@ func (v *SemanticAnalyzer) Init() {
 func (v *SemanticAnalyzer) Finalize() {
 	// If we already encountered an error, exit now
 	if v.shouldExit {
-		os.Exit(util.EXIT_FAILURE_SEMANTIC)
+		util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
 	}
 
 	// destroy stuff before finalisation
 	v.Check.Finalize(v)
 
 	if v.shouldExit {
-		os.Exit(util.EXIT_FAILURE_SEMANTIC)
+		util.ExitFunc(util.EXIT_FAILURE_SEMANTIC)
 	}
 }
 
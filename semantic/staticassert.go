@@ -0,0 +1,56 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+)
+
+// StaticAssertCheck 在类型推导之后计算编译期断言的条件，条件不是常量或者不成立时报错。
+// sizeof、alignof、offsetof 以及超出32位的 int、uint、uintptr 运算的结果取决于目标平台，
+// 用到它们的断言标记为 TargetDependent，由代码生成检查（参见 LLVMCodegen/staticassert.go）。
+type StaticAssertCheck struct {
+	eval   *ast.ConstEvaluator
+	layout bool // 当前的条件用到了数据布局
+}
+
+func (_ StaticAssertCheck) Name() string { return "static assert" }
+
+func (v *StaticAssertCheck) Init(s *SemanticAnalyzer) {
+	v.eval = ast.NewConstEvaluator([]*ast.Module{s.Module})
+	v.eval.Calls = true
+	v.eval.SizeOf = func(typ *ast.TypeReference) (uint64, bool) {
+		v.layout = true
+		return 0, false
+	}
+	v.eval.AlignOf = v.eval.SizeOf
+	v.eval.OffsetOf = func(typ *ast.TypeReference, member string) (uint64, bool) {
+		v.layout = true
+		return 0, false
+	}
+}
+
+func (v *StaticAssertCheck) EnterScope(s *SemanticAnalyzer)            {}
+func (v *StaticAssertCheck) ExitScope(s *SemanticAnalyzer)             {}
+func (v *StaticAssertCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {}
+func (v *StaticAssertCheck) Finalize(s *SemanticAnalyzer)              {}
+
+func (v *StaticAssertCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	stat, ok := n.(*ast.StaticAssertStat)
+	if !ok {
+		return
+	}
+
+	v.layout = false
+	value := v.eval.Eval(stat.Cond)
+	switch {
+	case value == nil && v.layout:
+		stat.TargetDependent = true
+	case value == nil || value.Kind != ast.ConstBool:
+		s.Err(stat, "Static assertion condition isn't a constant expression")
+	case !value.Bool:
+		msg := "Static assertion failed"
+		if stat.Message != "" {
+			msg += ": " + stat.Message
+		}
+		s.Err(stat, "%s", msg)
+	}
+}
@@ -2,38 +2,116 @@ package semantic
 
 import (
 	"math/big"
+	"sort"
+	"unicode/utf8"
 
 	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/lexer"
 	"github.com/ku-lang/ku/parser"
 )
 
 func (_ TypeCheck) Name() string { return "type" }
 
 // Takes a pointer to the expr, so we can replace it with a cast if necessary.
-// TODO: do we need an ImplicitCastExpr node? Or just an InterfaceWrapExpr node.
+// Values of named types stored in interface-typed places are boxed with an
+// InterfaceWrapExpr, see ast/interface.go and ast/types_compat.go.
+// TODO: do we need an ImplicitCastExpr node?
 func expectType(s *SemanticAnalyzer, loc ast.Locatable, expect *ast.TypeReference, expr *ast.Expr) {
 	exprType := (*expr).GetType()
-	if expect.ActualTypesEqual(exprType) {
+
+	// 能否赋值由 ast.AssignmentOf 决定，参见 ast/types_compat.go
+	switch ast.AssignmentOf(exprType, expect) {
+	case ast.AssignDirect:
+		return
+
+	case ast.AssignBox:
+		wrap := &ast.InterfaceWrapExpr{Expr: *expr, Interface: expect}
+		wrap.SetPos((*expr).Pos())
+		*expr = wrap
+		return
+
+	case ast.AssignBorrowBox:
+		// 装箱引用的值，接口值放在临时的存储中，再取对它的引用
+		wrap := &ast.InterfaceWrapExpr{Expr: *expr, Interface: expect.BaseType.(ast.ReferenceType).Referrer, Borrowed: true}
+		wrap.SetPos((*expr).Pos())
+		temp := &ast.TempAccessExpr{Expr: wrap}
+		temp.SetPos((*expr).Pos())
+		ref := &ast.ReferenceToExpr{Access: temp}
+		ref.SetPos((*expr).Pos())
+		*expr = ref
 		return
 	}
 
-	if expectPtr, ok := expect.BaseType.(ast.PointerType); ok {
-		if exprPtr, ok := exprType.BaseType.(ast.PointerType); ok {
-			if expectPtr.Addressee.ActualTypesEqual(exprPtr.Addressee) && exprPtr.IsMutable && !expectPtr.IsMutable {
-				return
+	// 缺少接口的方法时逐个报告
+	if ast.IsBoxable(exprType, expect) {
+		checkInterfaceValue(s, loc, expect, exprType)
+		return
+	}
+	if reason := ast.AssignmentError(exprType, expect); reason != "" {
+		s.Err(loc, "Cannot use `%s` as `%s`: %s", exprType.String(), expect.String(), reason)
+		return
+	}
+
+	// 变量的类型是数字常量的默认类型时，提示给出变量的类型
+	if vae, ok := (*expr).(*ast.VariableAccessExpr); ok && vae.Variable != nil && vae.Variable.NumericDefault {
+		if prim, ok := expect.BaseType.ActualType().(ast.PrimitiveType); ok && (prim.IsIntegerType() || prim.IsFloatingType()) {
+			keyword := "let"
+			if vae.Variable.Mutable {
+				keyword = "var"
 			}
+			s.Err(loc, "Mismatched types: want %s, got %s; `%s` has the default type of the numeric literals it is initialized with, declare it like `%s %s %s = ...`",
+				expect.String(), exprType.String(), vae.Variable.Name, keyword, vae.Variable.Name, expect.String())
+			return
 		}
 	}
 
-	if expectPtr, ok := expect.BaseType.(ast.ReferenceType); ok {
-		if exprPtr, ok := exprType.BaseType.(ast.ReferenceType); ok {
-			if expectPtr.Referrer.ActualTypesEqual(exprPtr.Referrer) && exprPtr.IsMutable && !expectPtr.IsMutable {
-				return
-			}
+	// 需要C字符串的地方给出了ku字符串，提示如何转换
+	if isPointer, _ := cStringPointer(expect); isPointer && isKuString(exprType) {
+		hint := "convert it with `cstr(...)`"
+		if _, ok := (*expr).(*ast.StringLiteral); ok {
+			hint = "use a C string literal like `c\"...\"`"
 		}
+		s.Err(loc, "Mismatched types: want %s, got %s; ku strings aren't NUL-terminated, %s", expect.String(), exprType.String(), hint)
+		return
 	}
 
 	s.Err(loc, "Mismatched types: want %s, got %s", expect.String(), exprType.String())
+	noteTypeOrigins(s, expect, exprType, loc.Pos(), (*expr).Pos())
+}
+
+// noteTypeOrigins 指出类型推导时要求这两个类型的表达式或语句，参见 ast.FindTypeMismatch
+func noteTypeOrigins(s *SemanticAnalyzer, want, got *ast.TypeReference, at ...lexer.Position) {
+	wantOrigin, gotOrigin := s.Submodule.FindTypeMismatch(want, got, at...)
+	if wantOrigin == nil || gotOrigin == nil {
+		return
+	}
+	s.Note(wantOrigin.Pos, "%s is expected because of %s", want.String(), wantOrigin.What)
+	s.Note(gotOrigin.Pos, "%s comes from %s", got.String(), gotOrigin.What)
+}
+
+// checkInterfaceValue 类型为typ的值能否装箱为接口值：类型要有接口的每个方法，参数和返回类型相同
+func checkInterfaceValue(s *SemanticAnalyzer, loc ast.Locatable, iface, typ *ast.TypeReference) {
+	inter, _ := ast.InterfaceOf(iface)
+	for _, ifn := range inter.Functions {
+		if _, reason := ast.InterfaceMethod(typ, iface, ifn); reason != "" {
+			s.Err(loc, "Cannot use value of type `%s` as interface `%s`: %s", typ.String(), iface.String(), reason)
+		}
+	}
+}
+
+// checkInterfaceCast 接口值之间的转换。目标接口的方法不能有泛型参数，否则无法组成方法表
+func checkInterfaceCast(s *SemanticAnalyzer, expr *ast.CastExpr) {
+	inter, ok := ast.InterfaceOf(expr.Type)
+	if !ok {
+		s.Err(expr, "Cannot cast interface value of type `%s` to non-interface type `%s`",
+			expr.Expr.GetType().String(), expr.Type.String())
+	}
+	for _, ifn := range inter.Functions {
+		if len(ifn.Type.GenericParameters) > 0 {
+			s.Err(expr, "Cannot cast to interface `%s`: interface method `%s` has generic parameters",
+				expr.Type.String(), ifn.Name)
+		}
+	}
 }
 
 type TypeCheck struct {
@@ -101,27 +179,66 @@ func (v *TypeCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
 	case *ast.MatchStat:
 		v.CheckMatchStat(s, n)
 
+	case *ast.StaticAssertStat:
+		v.CheckStaticAssertStat(s, n)
+
+	case *ast.VolatileStoreStat:
+		v.CheckVolatileStoreStat(s, n)
+
 	case *ast.ArrayLenExpr:
 		v.CheckArrayLenExpr(s, n)
 
+	case *ast.AlignofExpr:
+		v.CheckAlignofExpr(s, n)
+
+	case *ast.OffsetofExpr:
+		v.CheckOffsetofExpr(s, n)
+
 	case *ast.UnaryExpr:
 		v.CheckUnaryExpr(s, n)
 
 	case *ast.BinaryExpr:
 		v.CheckBinaryExpr(s, n)
 
+	case *ast.OverflowArithExpr:
+		v.CheckOverflowArithExpr(s, n)
+
+	case *ast.FloatBuiltinExpr:
+		v.CheckFloatBuiltinExpr(s, n)
+
 	case *ast.CastExpr:
 		v.CheckCastExpr(s, n)
 
+	case *ast.BitcastExpr:
+		v.CheckBitcastExpr(s, n)
+
 	case *ast.CallExpr:
 		v.CheckCallExpr(s, n)
 
 	case *ast.ArrayAccessExpr:
 		v.CheckArrayAccessExpr(s, n)
 
+	case *ast.SliceExpr:
+		v.CheckSliceExpr(s, n)
+
 	case *ast.DerefAccessExpr:
 		v.CheckDerefAccessExpr(s, n)
 
+	case *ast.VolatileLoadExpr:
+		v.CheckVolatileLoadExpr(s, n)
+
+	case *ast.CStringExpr:
+		v.CheckCStringExpr(s, n)
+
+	case *ast.HashExpr:
+		v.CheckHashExpr(s, n)
+
+	case *ast.CondExpr:
+		v.CheckCondExpr(s, n)
+
+	case *ast.NewExpr:
+		v.CheckNewExpr(s, n)
+
 	case *ast.NumericLiteral:
 		v.CheckNumericLiteral(s, n)
 
@@ -148,6 +265,11 @@ func typeRefTo(typ ast.Type) *ast.TypeReference {
 }
 
 func (v *TypeCheck) CheckStructAccessExpr(s *SemanticAnalyzer, access *ast.StructAccessExpr) {
+	if access.Method != nil {
+		v.CheckMethodValue(s, access)
+		return
+	}
+
 	structType := access.Struct.GetType().BaseType.ActualType().(ast.StructType)
 	member := structType.GetMember(access.Member)
 	if !member.Public && structType.Module != s.Submodule.Parent {
@@ -155,6 +277,28 @@ func (v *TypeCheck) CheckStructAccessExpr(s *SemanticAnalyzer, access *ast.Struc
 	}
 }
 
+// CheckMethodValue 方法值引用接收者，可以修改对象成员的方法不能绑定到不可变的接收者
+func (v *TypeCheck) CheckMethodValue(s *SemanticAnalyzer, access *ast.StructAccessExpr) {
+	recType := access.Method.Function.Type.Receiver
+	if recType == nil {
+		return
+	}
+
+	ptr, ok := recType.BaseType.(ast.PointerType)
+	if !ok || !ptr.IsMutable {
+		return
+	}
+
+	accessType := access.Struct.GetType().BaseType
+	if accessPtr, ok := accessType.(ast.PointerType); ok {
+		if !accessPtr.IsMutable {
+			s.Err(access, "Cannot bind method `%s` with a mutable receiver to an immutable pointer", access.Member)
+		}
+	} else if !access.Struct.Mutable() {
+		s.Err(access, "Cannot bind method `%s` with a mutable receiver to an immutable value", access.Member)
+	}
+}
+
 func (v *TypeCheck) CheckVariableDecl(s *SemanticAnalyzer, decl *ast.VariableDecl) {
 	if decl.Variable.Type.BaseType.ActualType() == ast.PRIMITIVE_void {
 		s.Err(decl, "Variable cannot be of type `void`")
@@ -199,8 +343,40 @@ func (v *TypeCheck) CheckIfStat(s *SemanticAnalyzer, stat *ast.IfStat) {
 	}
 }
 
+func (v *TypeCheck) CheckStaticAssertStat(s *SemanticAnalyzer, stat *ast.StaticAssertStat) {
+	if stat.Cond.GetType().BaseType != ast.PRIMITIVE_bool {
+		s.Err(stat.Cond, "Static assertion must have a boolean condition")
+	}
+}
+
+// CheckVolatileStoreStat 只能通过可修改的指针或引用写入，值的类型是指向的类型
+func (v *TypeCheck) CheckVolatileStoreStat(s *SemanticAnalyzer, stat *ast.VolatileStoreStat) {
+	ptrType := stat.Pointer.GetType()
+	switch t := ptrType.BaseType.ActualType().(type) {
+	case ast.PointerType:
+		if !t.IsMutable {
+			s.Err(stat, "Cannot volatile store through immutable pointer of type `%s`", ptrType.String())
+		}
+		expectType(s, stat, t.Addressee, &stat.Value)
+
+	case ast.ReferenceType:
+		if !t.IsMutable {
+			s.Err(stat, "Cannot volatile store through immutable reference of type `%s`", ptrType.String())
+		}
+		expectType(s, stat, t.Referrer, &stat.Value)
+
+	default:
+		s.Err(stat.Pointer, "Cannot volatile store through expression of type `%s`, expected a pointer", ptrType.String())
+	}
+}
+
 func (v *TypeCheck) CheckMatchStat(s *SemanticAnalyzer, stat *ast.MatchStat) {
-	// TODO: Handle string and integer matches
+	// TODO: Handle integer matches
+	if ast.IsStringType(stat.Target.GetType()) {
+		v.checkStringMatchStat(s, stat)
+		return
+	}
+
 	et, isEnum := stat.Target.GetType().BaseType.ActualType().(ast.EnumType)
 	for pattern, _ := range stat.Branches {
 		if _, isDiscard := pattern.(*ast.DiscardAccessExpr); isDiscard {
@@ -230,6 +406,40 @@ func (v *TypeCheck) CheckMatchStat(s *SemanticAnalyzer, stat *ast.MatchStat) {
 
 }
 
+// checkStringMatchStat 匹配字符串时模式只能是字符串字面量（不包括C字符串）和 _，并且不能重复
+func (v *TypeCheck) checkStringMatchStat(s *SemanticAnalyzer, stat *ast.MatchStat) {
+	patterns := make([]ast.Expr, 0, len(stat.Branches))
+	for pattern := range stat.Branches {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i].Pos(), patterns[j].Pos()
+		return a.Line < b.Line || (a.Line == b.Line && a.Char < b.Char)
+	})
+
+	seen := make(map[string]bool)
+	hasDiscard := false
+	for _, pattern := range patterns {
+		if _, isDiscard := pattern.(*ast.DiscardAccessExpr); isDiscard {
+			if hasDiscard {
+				s.Err(pattern, "Duplicate `_` pattern in match")
+			}
+			hasDiscard = true
+			continue
+		}
+
+		lit, ok := pattern.(*ast.StringLiteral)
+		if !ok || lit.IsCString {
+			s.Err(pattern, "Expected string literal pattern in match on type `%s`", stat.Target.GetType().String())
+			continue
+		}
+		if seen[lit.Value] {
+			s.Err(lit, "Duplicate pattern \"%s\" in match", ast.EscapeString(lit.Value))
+		}
+		seen[lit.Value] = true
+	}
+}
+
 func (v *TypeCheck) CheckAssignStat(s *SemanticAnalyzer, stat *ast.AssignStat) {
 	if stat.Access.GetType() != nil {
 		expectType(s, stat, stat.Access.GetType(), &stat.Assignment)
@@ -253,7 +463,7 @@ func (v *TypeCheck) CheckDestructAssignStat(s *SemanticAnalyzer, stat *ast.Destr
 	}
 
 	for idx, acc := range stat.Accesses {
-		if acc.GetType() != nil && !acc.GetType().ActualTypesEqual(tt.Members[idx]) {
+		if acc.GetType() != nil && !ast.Identical(acc.GetType(), tt.Members[idx]) {
 			s.Err(acc, "Mismatched types: `%s` and `%s`", acc.GetType().String(), tt.Members[idx].String())
 		}
 	}
@@ -270,7 +480,7 @@ func (v *TypeCheck) CheckDestructBinopAssignStat(s *SemanticAnalyzer, stat *ast.
 	}
 
 	for idx, acc := range stat.Accesses {
-		if acc.GetType() != nil && !acc.GetType().ActualTypesEqual(tt.Members[idx]) {
+		if acc.GetType() != nil && !ast.Identical(acc.GetType(), tt.Members[idx]) {
 			s.Err(acc, "Mismatched types: `%s` and `%s`", acc.GetType().String(), tt.Members[idx].String())
 		}
 	}
@@ -280,15 +490,44 @@ func (v *TypeCheck) CheckArrayLenExpr(s *SemanticAnalyzer, expr *ast.ArrayLenExp
 
 }
 
+func (v *TypeCheck) CheckAlignofExpr(s *SemanticAnalyzer, expr *ast.AlignofExpr) {
+	typ := expr.Type
+	if expr.Expr != nil {
+		typ = expr.Expr.GetType()
+	}
+	if typ != nil && typ.BaseType.IsVoidType() {
+		s.Err(expr, "Cannot take the alignment of void")
+	}
+}
+
+// offsetof的类型必须是结构体，并且有这个成员
+func (v *TypeCheck) CheckOffsetofExpr(s *SemanticAnalyzer, expr *ast.OffsetofExpr) {
+	if expr.Type == nil {
+		return
+	}
+
+	st, ok := expr.Type.BaseType.ActualType().(ast.StructType)
+	if !ok {
+		s.Err(expr, "Cannot take member offset of non-struct type `%s`", expr.Type.String())
+		return
+	}
+
+	if st.GetMember(expr.Member) == nil {
+		s.Err(expr, "Struct `%s` has no member `%s`", expr.Type.String(), expr.Member)
+	}
+}
+
 func (v *TypeCheck) CheckUnaryExpr(s *SemanticAnalyzer, expr *ast.UnaryExpr) {
 	switch expr.Op {
 	case parser.UNOP_LOG_NOT:
-		if !expr.Expr.GetType().ActualTypesEqual(typeRefTo(ast.PRIMITIVE_bool)) {
+		if !ast.Identical(expr.Expr.GetType(), typeRefTo(ast.PRIMITIVE_bool)) {
 			s.Err(expr, "Used logical not on non-boolean expression")
 		}
 	case parser.UNOP_BIT_NOT:
 		if !(expr.Expr.GetType().BaseType.IsIntegerType() || expr.Expr.GetType().BaseType.IsFloatingType()) {
 			s.Err(expr, "Used bitwise not on non-numeric type")
+		} else if et, ok := expr.Expr.GetType().BaseType.ActualType().(ast.EnumType); ok && !et.IsFlags() {
+			s.Err(expr, "Used bitwise not on enum `%s`, which is not a [flags] enum", expr.Expr.GetType().String())
 		}
 	case parser.UNOP_NEGATIVE:
 		if !(expr.Expr.GetType().BaseType.IsIntegerType() || expr.Expr.GetType().BaseType.IsFloatingType()) {
@@ -299,26 +538,73 @@ func (v *TypeCheck) CheckUnaryExpr(s *SemanticAnalyzer, expr *ast.UnaryExpr) {
 	}
 }
 
+func (v *TypeCheck) CheckFloatBuiltinExpr(s *SemanticAnalyzer, expr *ast.FloatBuiltinExpr) {
+	first := expr.Arguments[0].GetType()
+	for _, arg := range expr.Arguments {
+		if !arg.GetType().BaseType.IsFloatingType() {
+			s.Err(arg, "Argument for `%s` must be a floating point number, have `%s`",
+				expr.Builtin.String(), arg.GetType().String())
+		} else if !ast.Identical(arg.GetType(), first) {
+			s.Err(arg, "Arguments for `%s` must have the same type, have `%s` and `%s`",
+				expr.Builtin.String(), first.String(), arg.GetType().String())
+		}
+	}
+}
+
+func (v *TypeCheck) CheckOverflowArithExpr(s *SemanticAnalyzer, expr *ast.OverflowArithExpr) {
+	lht, rht := expr.Lhand.GetType(), expr.Rhand.GetType()
+	if !ast.Identical(lht, rht) {
+		s.Err(expr, "Operands for `%s` must have the same type, have `%s` and `%s`",
+			expr.Name(), lht.String(), rht.String())
+	} else if prim, ok := lht.BaseType.ActualType().(ast.PrimitiveType); !ok || !prim.IsIntegerType() {
+		s.Err(expr, "Operands for `%s` must be integers, have `%s`", expr.Name(), lht.String())
+	}
+}
+
 func (v *TypeCheck) CheckBinaryExpr(s *SemanticAnalyzer, expr *ast.BinaryExpr) {
+	// 由约束方法实现的运算符，按方法调用检查
+	if expr.Method != nil {
+		return
+	}
+
 	switch expr.Op {
 	case parser.BINOP_EQ, parser.BINOP_NOT_EQ:
-		if !expr.Lhand.GetType().ActualTypesEqual(expr.Rhand.GetType()) {
+		if !ast.Identical(expr.Lhand.GetType(), expr.Rhand.GetType()) {
 			s.Err(expr, "Operands for binary operator `%s` must have the same type, have `%s` and `%s`",
 				expr.Op.OpString(), expr.Lhand.GetType().String(), expr.Rhand.GetType().String())
-		} else if lht := expr.Lhand.GetType(); !(lht.ActualTypesEqual(typeRefTo(ast.PRIMITIVE_bool)) || lht.BaseType.IsIntegerType() || lht.BaseType.IsFloatingType() || lht.BaseType.LevelsOfIndirection() > 0) {
-			s.Err(expr, "Operands for binary operator `%s` must be numeric, or pointers or booleans, have `%s`",
-				expr.Op.OpString(), expr.Lhand.GetType().String())
+		} else if lht := expr.Lhand.GetType(); !ast.Comparable(lht) {
+			// 复合类型逐个比较成员，参见 ast/compare.go
+			s.Err(expr, "Operands for binary operator `%s` must be comparable, have `%s`; structs and enums containing pointers or functions need [derive(eq)]",
+				expr.Op.OpString(), lht.String())
+		}
+
+	case parser.BINOP_GREATER, parser.BINOP_LESS, parser.BINOP_GREATER_EQ, parser.BINOP_LESS_EQ:
+		if !ast.Identical(expr.Lhand.GetType(), expr.Rhand.GetType()) {
+			s.Err(expr, "Operands for binary operator `%s` must have the same type, have `%s` and `%s`",
+				expr.Op.OpString(), expr.Lhand.GetType().String(), expr.Rhand.GetType().String())
+		} else if lht := expr.Lhand.GetType(); !ast.Ordered(lht) {
+			s.Err(expr, "Operands for binary operator `%s` must be numeric, pointers, or ordered, have `%s`; structs need [derive(ord)]",
+				expr.Op.OpString(), lht.String())
 		}
 
 	case parser.BINOP_ADD, parser.BINOP_SUB, parser.BINOP_MUL, parser.BINOP_DIV, parser.BINOP_MOD,
-		parser.BINOP_GREATER, parser.BINOP_LESS, parser.BINOP_GREATER_EQ, parser.BINOP_LESS_EQ,
 		parser.BINOP_BIT_AND, parser.BINOP_BIT_OR, parser.BINOP_BIT_XOR:
-		if !expr.Lhand.GetType().ActualTypesEqual(expr.Rhand.GetType()) {
+		if isPointerArithmetic(expr) {
+			// 指针加减整数，或者两个同类型的指针相减
+			rht := expr.Rhand.GetType()
+			if !rht.BaseType.IsIntegerType() && (expr.Op != parser.BINOP_SUB || !ast.Identical(expr.Lhand.GetType(), rht)) {
+				s.Err(expr, "Invalid pointer arithmetic `%s` %s `%s`: a pointer can only be offset by an integer or subtract a pointer of the same type",
+					expr.Lhand.GetType().String(), expr.Op.OpString(), rht.String())
+			}
+		} else if !ast.Identical(expr.Lhand.GetType(), expr.Rhand.GetType()) {
 			s.Err(expr, "Operands for binary operator `%s` must have the same type, have `%s` and `%s`",
 				expr.Op.OpString(), expr.Lhand.GetType().String(), expr.Rhand.GetType().String())
 		} else if lht := expr.Lhand.GetType(); !(lht.BaseType.IsIntegerType() || lht.BaseType.IsFloatingType() || lht.BaseType.LevelsOfIndirection() > 0) {
 			s.Err(expr, "Operands for binary operator `%s` must be numeric or pointers, have `%s`",
 				expr.Op.OpString(), expr.Lhand.GetType().String())
+		} else if et, ok := lht.BaseType.ActualType().(ast.EnumType); ok && expr.Op.Category() == parser.OP_BITWISE && !et.IsFlags() {
+			s.Err(expr, "Bitwise operator `%s` used on enum `%s`, which is not a [flags] enum",
+				expr.Op.OpString(), lht.String())
 		}
 
 	case parser.BINOP_BIT_LEFT, parser.BINOP_BIT_RIGHT:
@@ -331,7 +617,7 @@ func (v *TypeCheck) CheckBinaryExpr(s *SemanticAnalyzer, expr *ast.BinaryExpr) {
 		}
 
 	case parser.BINOP_LOG_AND, parser.BINOP_LOG_OR:
-		if !expr.Lhand.GetType().ActualTypesEqual(typeRefTo(ast.PRIMITIVE_bool)) || !expr.Lhand.GetType().ActualTypesEqual(expr.Rhand.GetType()) {
+		if !ast.Identical(expr.Lhand.GetType(), typeRefTo(ast.PRIMITIVE_bool)) || !ast.Identical(expr.Lhand.GetType(), expr.Rhand.GetType()) {
 			s.Err(expr, "Operands for logical operator `%s` must have same boolean type, have `%s` and `%s`",
 				expr.Op.OpString(), expr.Lhand.GetType().String(), expr.Rhand.GetType().String())
 		}
@@ -345,12 +631,39 @@ func (v *TypeCheck) CheckCastExpr(s *SemanticAnalyzer, expr *ast.CastExpr) {
 	if expr.Type.Equals(expr.Expr.GetType()) {
 		s.Warn(expr, "Casting expression of type `%s` to the same type",
 			expr.Type.String())
-	} else if !expr.Expr.GetType().CanCastTo(expr.Type) {
+	} else if _, ok := ast.InterfaceOf(expr.Expr.GetType()); ok {
+		checkInterfaceCast(s, expr)
+	} else if !ast.ConvertibleTo(expr.Expr.GetType(), expr.Type) {
 		s.Err(expr, "Cannot cast expression of type `%s` to type `%s`",
 			expr.Expr.GetType().String(), expr.Type.String())
 	}
 }
 
+// CheckBitcastExpr 两个类型在目标平台上的大小必须相同，依赖泛型类型参数的类型在代码生成时检查
+func (v *TypeCheck) CheckBitcastExpr(s *SemanticAnalyzer, expr *ast.BitcastExpr) {
+	from := expr.Expr.GetType()
+	if from.BaseType.IsVoidType() || expr.Type.BaseType.IsVoidType() {
+		s.Err(expr, "Cannot bitcast `%s` to `%s`", from.String(), expr.Type.String())
+		return
+	} else if ast.Identical(from, expr.Type) {
+		s.Warn(expr, "Bitcasting expression of type `%s` to the same type", from.String())
+		return
+	}
+
+	if ast.TargetLayout == nil {
+		return
+	}
+	fromSize, ok := ast.TargetLayout.SizeOf(from)
+	if !ok {
+		return
+	}
+	toSize, ok := ast.TargetLayout.SizeOf(expr.Type)
+	if ok && fromSize != toSize {
+		s.Err(expr, "Cannot bitcast `%s` (%d bytes) to `%s` (%d bytes), the sizes differ",
+			from.String(), fromSize, expr.Type.String(), toSize)
+	}
+}
+
 func (v *TypeCheck) CheckCallExpr(s *SemanticAnalyzer, expr *ast.CallExpr) {
 	fnType := expr.Function.GetType().BaseType.(ast.FunctionType)
 
@@ -386,7 +699,7 @@ func (v *TypeCheck) CheckCallExpr(s *SemanticAnalyzer, expr *ast.CallExpr) {
 	}
 
 	if fnType.Receiver != nil {
-		if !expr.ReceiverAccess.GetType().ActualTypesEqual(fnType.Receiver) {
+		if !ast.Identical(expr.ReceiverAccess.GetType(), fnType.Receiver) {
 			expectType(s, expr, fnType.Receiver, &expr.ReceiverAccess)
 		}
 	}
@@ -418,11 +731,27 @@ func (v *TypeCheck) CheckCallExpr(s *SemanticAnalyzer, expr *ast.CallExpr) {
 					Expr: arg,
 					Type: typeRefTo(ast.PRIMITIVE_uint),
 				}
+			case ast.PRIMITIVE_s128, ast.PRIMITIVE_u128:
+				// printf 等没有128位整数的格式，按64位读取时结果是错的
+				s.Err(arg, "128-bit integer can't be passed as a variadic argument of C function `%s`, print it with `print_s128` or `print_u128`", fnName)
 			}
 		} else {
 			par := fnType.Parameters[i]
+			// 传给C函数的字符串隐式转换为C字符串，参见cstring.go
+			if c && convertCStringArgument(s, fnName, par, &expr.Arguments[i]) {
+				continue
+			}
 			if arg.GetType() != nil { // TODO should arg type ever be nil?
-				expectType(s, arg, par, &arg)
+				expectType(s, arg, par, &expr.Arguments[i])
+			}
+
+			// C函数接收原始的函数指针，方法值和函数类型的变量不能转换为函数指针
+			if _, ok := par.BaseType.ActualType().(ast.FunctionType); ok && c {
+				switch arg.(type) {
+				case *ast.FunctionAccessExpr, *ast.LambdaExpr:
+				default:
+					s.Err(arg, "Only functions and lambdas can be passed to the function-typed parameters of C function `%s`", fnName)
+				}
 			}
 		}
 	}
@@ -440,12 +769,87 @@ func (v *TypeCheck) CheckArrayAccessExpr(s *SemanticAnalyzer, expr *ast.ArrayAcc
 	}
 }
 
+// CheckSliceExpr 只能切片动态数组和字符串。常量的两端在编译时检查顺序，
+// 切片字符串字面量时还检查它们不越界、在UTF-8字符的边界上；其它情况在运行时检查
+func (v *TypeCheck) CheckSliceExpr(s *SemanticAnalyzer, expr *ast.SliceExpr) {
+	typ := expr.Array.GetType()
+	if arr, ok := typ.BaseType.ActualType().(ast.ArrayType); !ok || arr.IsFixedLength {
+		s.Err(expr, "Cannot slice type `%s`, expected a dynamic array or `string`", typ.String())
+	}
+
+	for _, bound := range []ast.Expr{expr.Low, expr.High} {
+		if bound != nil && !bound.GetType().BaseType.IsIntegerType() {
+			s.Err(bound, "Slice bound must be an integer type, have `%s`", bound.GetType().String())
+		}
+	}
+
+	low, high := constantSliceBound(expr.Low), constantSliceBound(expr.High)
+	if low != nil && high != nil && low.Cmp(high) > 0 {
+		s.Err(expr, "Invalid slice bounds: low bound %s is greater than high bound %s", low, high)
+		return
+	}
+
+	lit, ok := expr.Array.(*ast.StringLiteral)
+	if !ok {
+		return
+	}
+	for _, bound := range []*big.Int{low, high} {
+		if bound == nil {
+			continue
+		}
+		if !bound.IsInt64() || bound.Int64() > int64(len(lit.Value)) {
+			s.Err(expr, "Slice bound %s is out of range for string of length %d", bound, len(lit.Value))
+		} else if i := int(bound.Int64()); i < len(lit.Value) && !utf8.RuneStart(lit.Value[i]) {
+			s.Err(expr, "Slice bound %d is not on a UTF-8 character boundary", i)
+		}
+	}
+}
+
+// constantSliceBound 切片的一端是整数字面量时返回它的值
+func constantSliceBound(bound ast.Expr) *big.Int {
+	if lit, ok := bound.(*ast.NumericLiteral); ok && !lit.IsFloat && !lit.IsDuration {
+		return lit.IntValue
+	}
+	return nil
+}
+
 func (v *TypeCheck) CheckDerefAccessExpr(s *SemanticAnalyzer, expr *ast.DerefAccessExpr) {
 	if !ast.IsPointerOrReferenceType(expr.Expr.GetType().BaseType) {
 		s.Err(expr, "Cannot dereference expression of type `%s`", expr.Expr.GetType().String())
 	}
 }
 
+func (v *TypeCheck) CheckVolatileLoadExpr(s *SemanticAnalyzer, expr *ast.VolatileLoadExpr) {
+	if !ast.IsPointerOrReferenceType(expr.Pointer.GetType().BaseType) {
+		s.Err(expr, "Cannot volatile load from expression of type `%s`, expected a pointer", expr.Pointer.GetType().String())
+	}
+}
+
+func (v *TypeCheck) CheckCStringExpr(s *SemanticAnalyzer, expr *ast.CStringExpr) {
+	if !isKuString(expr.Expr.GetType()) {
+		s.Err(expr, "Cannot convert expression of type `%s` to a C string, expected `string`", expr.Expr.GetType().String())
+	}
+}
+
+func (v *TypeCheck) CheckHashExpr(s *SemanticAnalyzer, expr *ast.HashExpr) {
+	typ := expr.Expr.GetType()
+	if typ == nil {
+		return
+	}
+	if ok, why := ast.Hashable(typ); !ok {
+		if why == "" {
+			why = "values of the type can't be compared with `==`"
+		}
+		s.Err(expr, "Cannot hash value of type `%s`, so it can't be a map key: %s", typ.String(), why)
+	}
+}
+
+func (v *TypeCheck) CheckNewExpr(s *SemanticAnalyzer, expr *ast.NewExpr) {
+	if typ := expr.Expr.GetType(); typ == nil || typ.BaseType.IsVoidType() {
+		s.Err(expr, "Cannot allocate a value of type `void` with `new`")
+	}
+}
+
 func (v *TypeCheck) CheckNumericLiteral(s *SemanticAnalyzer, lit *ast.NumericLiteral) {
 	if !(lit.GetType().BaseType.IsIntegerType() || lit.GetType().BaseType.IsFloatingType()) {
 		s.Err(lit, "Numeric literal was non-integer, non-float type: %s", lit.GetType().String())
@@ -463,7 +867,7 @@ func (v *TypeCheck) CheckNumericLiteral(s *SemanticAnalyzer, lit *ast.NumericLit
 
 		switch lit.GetType().BaseType.ActualType() {
 		case ast.PRIMITIVE_int, ast.PRIMITIVE_uint, ast.PRIMITIVE_uintptr:
-			bits = 9000 // FIXME work out proper size
+			bits = 64 // FIXME work out proper size, 64 bits at most on every target
 		case ast.PRIMITIVE_u8, ast.PRIMITIVE_s8:
 			bits = 8
 		case ast.PRIMITIVE_u16, ast.PRIMITIVE_s16:
@@ -525,11 +929,16 @@ func (v *TypeCheck) CheckTupleLiteral(s *SemanticAnalyzer, lit *ast.TupleLiteral
 	}
 
 	for idx, mem := range lit.Members {
-		expectType(s, mem, gcon.Get(memberTypes[idx]), &mem)
+		expectType(s, mem, gcon.Get(memberTypes[idx]), &lit.Members[idx])
 	}
 }
 
 func (v *TypeCheck) CheckCompositeLiteral(s *SemanticAnalyzer, lit *ast.CompositeLiteral) {
+	if lit.Type == nil {
+		s.Err(lit, "Couldn't infer type of composite literal")
+		return
+	}
+
 	gcon := ast.NewGenericContext([]*ast.SubstitutionType{}, []*ast.TypeReference{})
 	if len(lit.Type.GenericArguments) > 0 {
 		gcon = ast.NewGenericContextFromTypeReference(lit.Type)
@@ -537,9 +946,14 @@ func (v *TypeCheck) CheckCompositeLiteral(s *SemanticAnalyzer, lit *ast.Composit
 
 	switch typ := lit.Type.BaseType.ActualType().(type) {
 	case ast.ArrayType:
+		// 定长数组（包括多维数组的每一行）必须给出全部元素
+		if typ.IsFixedLength && len(lit.Values) != typ.Length {
+			s.Err(lit, "Array literal of type `%s` has %d elements, expected %d", lit.Type.String(), len(lit.Values), typ.Length)
+		}
+
 		memType := typ.MemberType
 		for i, mem := range lit.Values {
-			expectType(s, mem, memType, &mem)
+			expectType(s, mem, memType, &lit.Values[i])
 
 			if lit.Fields[i] != "" {
 				s.Err(mem, "Unexpected field in array literal: `%s`", lit.Fields[i])
@@ -547,6 +961,11 @@ func (v *TypeCheck) CheckCompositeLiteral(s *SemanticAnalyzer, lit *ast.Composit
 		}
 
 	case ast.StructType:
+		// 联合体的成员互相重叠，只能初始化其中一个
+		if typ.IsUnion && len(lit.Values) > 1 {
+			s.Err(lit, "Union literal of type `%s` can initialize at most one member, have %d", lit.Type.String(), len(lit.Values))
+		}
+
 		for i, mem := range lit.Values {
 			name := lit.Fields[i]
 
@@ -561,7 +980,7 @@ func (v *TypeCheck) CheckCompositeLiteral(s *SemanticAnalyzer, lit *ast.Composit
 			}
 
 			sMemType := gcon.Replace(sMem.Type)
-			expectType(s, mem, sMemType, &mem)
+			expectType(s, mem, sMemType, &lit.Values[i])
 		}
 
 	default:
@@ -22,7 +22,12 @@ func (v *UnreachableCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {
 			}
 		}
 
-		if len(n.Nodes) > 0 {
+		// 有值的代码块执行到结尾才产生值
+		if n.Tail != nil {
+			if len(n.Nodes) > 0 && IsNodeTerminating(n.Nodes[len(n.Nodes)-1]) {
+				s.Err(n.Tail, "Unreachable code")
+			}
+		} else if len(n.Nodes) > 0 {
 			n.IsTerminating = IsNodeTerminating(n.Nodes[len(n.Nodes)-1])
 		}
 
@@ -0,0 +1,140 @@
+package semantic
+
+import (
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/parser"
+)
+
+// 不安全的操作
+//
+// 指针运算（p + 1、p - 1、p - q）、通过指针的下标访问（p[i]）、按位重新解释类型（bitcast<T>(x)）、
+// 读取联合体的成员（写入成员 u.x = 1 不需要）以及调用标注了 [unsafe] 的函数，
+// 只能写在 unsafe { ... } 中，或者标注了 [unsafe] 的函数体中。
+// 其中没有不安全操作的 unsafe 代码块给出警告。
+
+type UnsafeCheck struct {
+	scopes      []*unsafeScope
+	unionWrites map[*ast.StructAccessExpr]bool // 赋值语句左边的联合体成员访问
+}
+
+// unsafeScope unsafe代码块或[unsafe]函数
+type unsafeScope struct {
+	block *ast.Block // 函数时为nil
+	used  bool
+}
+
+func (_ UnsafeCheck) Name() string { return "unsafe" }
+
+func (v *UnsafeCheck) Init(s *SemanticAnalyzer) {
+	v.unionWrites = make(map[*ast.StructAccessExpr]bool)
+}
+
+func (v *UnsafeCheck) EnterScope(s *SemanticAnalyzer) {}
+func (v *UnsafeCheck) ExitScope(s *SemanticAnalyzer)  {}
+func (v *UnsafeCheck) Finalize(s *SemanticAnalyzer)   {}
+
+func (v *UnsafeCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Block:
+		if n.IsUnsafe {
+			v.scopes = append(v.scopes, &unsafeScope{block: n})
+		}
+
+	case *ast.FunctionDecl:
+		if n.Function.Type.Attrs().Contains("unsafe") {
+			v.scopes = append(v.scopes, &unsafeScope{})
+		}
+
+	case *ast.BinaryExpr:
+		if isPointerArithmetic(n) {
+			v.requireUnsafe(s, n, "Pointer arithmetic")
+		}
+
+	case *ast.ArrayAccessExpr:
+		if _, ok := n.Array.GetType().BaseType.ActualType().(ast.PointerType); ok {
+			v.requireUnsafe(s, n, "Indexing through a pointer")
+		}
+
+	case *ast.BitcastExpr:
+		v.requireUnsafe(s, n, "Bitcast")
+
+	case *ast.AssignStat:
+		v.markUnionWrites(n.Access)
+
+	case *ast.DestructAssignStat:
+		for _, acc := range n.Accesses {
+			v.markUnionWrites(acc)
+		}
+
+	case *ast.StructAccessExpr:
+		if st, ok := n.Struct.GetType().BaseType.ActualType().(ast.StructType); ok && st.IsUnion &&
+			st.GetMember(n.Member) != nil && !v.unionWrites[n] {
+			v.requireUnsafe(s, n, "Reading union member `"+n.Member+"`")
+		}
+
+	case *ast.CallExpr:
+		if fnType, ok := n.Function.GetType().BaseType.(ast.FunctionType); ok && fnType.Attrs().Contains("unsafe") {
+			name := "unsafe function"
+			if fae, ok := n.Function.(*ast.FunctionAccessExpr); ok {
+				name = "unsafe function `" + fae.Function.Name + "`"
+			}
+			v.requireUnsafe(s, n, "Call to "+name)
+		}
+	}
+}
+
+func (v *UnsafeCheck) PostVisit(s *SemanticAnalyzer, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Block:
+		if !n.IsUnsafe {
+			return
+		}
+		scope := v.scopes[len(v.scopes)-1]
+		v.scopes = v.scopes[:len(v.scopes)-1]
+		if !scope.used {
+			s.Warn(n, "Unnecessary `unsafe` block")
+		}
+
+	case *ast.FunctionDecl:
+		if n.Function.Type.Attrs().Contains("unsafe") {
+			v.scopes = v.scopes[:len(v.scopes)-1]
+		}
+	}
+}
+
+// requireUnsafe 不安全的操作what必须在unsafe代码块或[unsafe]函数中
+func (v *UnsafeCheck) requireUnsafe(s *SemanticAnalyzer, n ast.Locatable, what string) {
+	if len(v.scopes) == 0 {
+		s.Err(n, "%s requires an `unsafe` block", what)
+		return
+	}
+	v.scopes[len(v.scopes)-1].used = true
+}
+
+// markUnionWrites 赋值的目标中的联合体成员访问是写入，如 u.x = 1、u.s.y = 2。
+// 经过指针或引用的访问（如 u.p.x）要先读取成员，不是写入
+func (v *UnsafeCheck) markUnionWrites(access ast.Expr) {
+	for {
+		switch n := access.(type) {
+		case *ast.StructAccessExpr:
+			v.unionWrites[n] = true
+			access = n.Struct
+		case *ast.ArrayAccessExpr:
+			if at, ok := n.Array.GetType().BaseType.ActualType().(ast.ArrayType); !ok || !at.IsFixedLength {
+				return
+			}
+			access = n.Array
+		default:
+			return
+		}
+	}
+}
+
+// isPointerArithmetic 是否是指针加减整数或两个指针相减
+func isPointerArithmetic(expr *ast.BinaryExpr) bool {
+	if expr.Op != parser.BINOP_ADD && expr.Op != parser.BINOP_SUB {
+		return false
+	}
+	_, ok := expr.Lhand.GetType().BaseType.ActualType().(ast.PointerType)
+	return ok
+}
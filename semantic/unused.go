@@ -41,7 +41,8 @@ func (v *UnusedCheck) Visit(s *SemanticAnalyzer, n ast.Node) {
 		}
 
 	case *ast.FunctionDecl:
-		if !n.IsPublic() {
+		// 钩子由运行时通过链接符号调用
+		if !n.IsPublic() && ast.HookName(n.Function) == "" {
 			v.encountered = append(v.encountered, n.Function)
 			v.encounteredDecl = append(v.encounteredDecl, n)
 		}
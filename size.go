@@ -0,0 +1,215 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen"
+)
+
+// ku analyze --size：编译项目，从各个模块的目标文件中读出函数符号的大小，
+// 按照符号名的编码（参见ast/mangle.go）对应回ku的模块和函数，输出每个模块的代码大小，以及最大的函数。
+// 泛型函数的每个实例都是单独的符号，实例数说明了单态化带来的代码量。
+// 泛型函数的实例生成在使用它的模块中，但算作定义它的模块的大小。只统计函数的代码，不包括数据
+
+// objSymbol 目标文件中的函数符号
+type objSymbol struct {
+	name string
+	size uint64
+}
+
+type sizeEntry struct {
+	name      string
+	size      uint64
+	functions int // 模块中的函数个数
+	instances int // 符号个数，泛型函数每个实例一个
+}
+
+// reportSize 编译项目并输出代码大小报告。top为列出的最大函数的个数
+func (v *Context) reportSize(optLevel, top int) {
+	dir, err := ioutil.TempDir("", "ku-analyze")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	v.Library = true
+	v.Build(filepath.Join(dir, "main"), codegen.OutputObject, "llvm", optLevel)
+
+	modules := make(map[string]*sizeEntry)
+	functions := make(map[string]*sizeEntry)
+	runPhase("size analysis", func() {
+		for objModule, path := range v.objectFiles {
+			symbols, err := readObjectSymbols(path)
+			if err != nil {
+				setupErr("Couldn't read symbols of `%s`: %s", path, err)
+			}
+
+			for _, sym := range symbols {
+				module, function, ok := ast.DemangleFunction(sym.name)
+				if !ok {
+					module, function = objModule, sym.name
+				}
+
+				fn := functions[module+"."+function]
+				if fn == nil {
+					fn = &sizeEntry{name: module + "." + function}
+					functions[fn.name] = fn
+				}
+				fn.size += sym.size
+				fn.instances++
+
+				mod := modules[module]
+				if mod == nil {
+					mod = &sizeEntry{name: module}
+					modules[module] = mod
+				}
+				mod.size += sym.size
+				mod.instances++
+				if fn.instances == 1 {
+					mod.functions++
+				}
+			}
+		}
+	})
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	var total uint64
+	fmt.Fprintln(out, "MODULE\tBYTES\tFUNCTIONS\tSYMBOLS")
+	for _, mod := range sortedSizeEntries(modules) {
+		fmt.Fprintf(out, "%s\t%d\t%d\t%d\n", mod.name, mod.size, mod.functions, mod.instances)
+		total += mod.size
+	}
+	fmt.Fprintf(out, "total\t%d\n", total)
+	out.Flush()
+
+	fmt.Println()
+	fmt.Fprintln(out, "FUNCTION\tBYTES\tINSTANCES")
+	for idx, fn := range sortedSizeEntries(functions) {
+		if idx >= top {
+			break
+		}
+		fmt.Fprintf(out, "%s\t%d\t%d\n", fn.name, fn.size, fn.instances)
+	}
+	out.Flush()
+}
+
+// sortedSizeEntries 按大小从大到小排序，大小相同时按名字排序
+func sortedSizeEntries(entries map[string]*sizeEntry) []*sizeEntry {
+	var res []*sizeEntry
+	for _, entry := range entries {
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].size != res[j].size {
+			return res[i].size > res[j].size
+		}
+		return res[i].name < res[j].name
+	})
+	return res
+}
+
+// readObjectSymbols 读出目标文件（ELF、Mach-O 或 COFF）中定义的函数符号及其大小。
+// Mach-O 和 COFF 的符号没有大小，用同一节中下一个符号的地址计算
+func readObjectSymbols(path string) ([]objSymbol, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		syms, err := f.Symbols()
+		if err != nil {
+			return nil, err
+		}
+
+		var res []objSymbol
+		for _, sym := range syms {
+			if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Section != elf.SHN_UNDEF {
+				res = append(res, objSymbol{name: sym.Name, size: sym.Size})
+			}
+		}
+		return res, nil
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		if f.Symtab == nil {
+			return nil, nil
+		}
+
+		var addrs []addrSymbol
+		for _, sym := range f.Symtab.Syms {
+			// N_SECT：定义在某一节中的符号。跳过调试符号（N_STAB）和汇编器生成的局部标号
+			if sym.Type&0xe0 != 0 || sym.Type&0x0e != 0x0e || sym.Sect == 0 || int(sym.Sect) > len(f.Sections) {
+				continue
+			}
+			if strings.HasPrefix(sym.Name, "ltmp") || strings.HasPrefix(sym.Name, "L") || strings.HasPrefix(sym.Name, "l_") {
+				continue
+			}
+			sect := f.Sections[sym.Sect-1]
+			if sect.Name != "__text" {
+				continue
+			}
+			// Mach-O 的C符号名以 _ 开头
+			name := sym.Name
+			if len(name) > 0 && name[0] == '_' {
+				name = name[1:]
+			}
+			addrs = append(addrs, addrSymbol{name: name, section: int(sym.Sect), addr: sym.Value, end: sect.Addr + sect.Size})
+		}
+		return sizesFromAddrs(addrs), nil
+	}
+
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unknown object file format")
+	}
+	defer f.Close()
+
+	var addrs []addrSymbol
+	for _, sym := range f.Symbols {
+		// 0x20：函数符号
+		if sym.Type != 0x20 || sym.SectionNumber <= 0 || int(sym.SectionNumber) > len(f.Sections) {
+			continue
+		}
+		sect := f.Sections[sym.SectionNumber-1]
+		addrs = append(addrs, addrSymbol{name: sym.Name, section: int(sym.SectionNumber), addr: uint64(sym.Value), end: uint64(sect.Size)})
+	}
+	return sizesFromAddrs(addrs), nil
+}
+
+// addrSymbol 没有大小的符号，end为所在节的结束地址
+type addrSymbol struct {
+	name    string
+	section int
+	addr    uint64
+	end     uint64
+}
+
+// sizesFromAddrs 按地址排序，每个符号的大小为到同一节中下一个符号（或节结尾）的距离
+func sizesFromAddrs(addrs []addrSymbol) []objSymbol {
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].section != addrs[j].section {
+			return addrs[i].section < addrs[j].section
+		}
+		return addrs[i].addr < addrs[j].addr
+	})
+
+	var res []objSymbol
+	for i, sym := range addrs {
+		end := sym.end
+		if i+1 < len(addrs) && addrs[i+1].section == sym.section {
+			end = addrs[i+1].addr
+		}
+		if end >= sym.addr {
+			res = append(res, objSymbol{name: sym.name, size: end - sym.addr})
+		}
+	}
+	return res
+}
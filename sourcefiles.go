@@ -0,0 +1,121 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen/LLVMCodegen"
+)
+
+// 模块源文件的选择
+//
+// 读入模块目录时，以下文件不属于模块：
+//
+//	.x.ku、x.txt        以 . 开头的文件，以及不以 .ku 结尾的文件
+//	x_test.ku           测试文件，只有 ku test 测试这个模块时才编译（参见test.go）
+//	x_linux.ku          平台相关的文件 x_<os>.ku、x_<arch>.ku、x_<os>_<arch>.ku，只在目标平台（--target）匹配时编译。
+//	                    os是linux、windows、darwin等，arch是x86_64、arm64、riscv64等，与预置目标的名字一致
+//	匹配排除模式的文件   模式来自顶层模块的清单 {"exclude": ["gen_*.ku", "net/legacy_*.ku"]}，或者命令行的 --exclude
+//
+// 排除模式的语法与filepath.Match相同，匹配文件在顶层模块中的路径，如模块 app.net 的文件 x.ku 为 net/x.ku，
+// 与模块目录实际在哪里无关（参见sourceroots.go）；不含 / 的模式只匹配文件名。
+// 直接输入的源文件总是会编译。
+const testFileSuffix = "_test.ku"
+
+var (
+	knownTargetOS   = []string{"linux", "windows", "darwin", "freebsd", "netbsd", "openbsd", "android"}
+	knownTargetArch = []string{"x86_64", "x86", "arm64", "arm", "riscv64", "wasm32"}
+)
+
+// isModuleSourceFile 模块modname的目录中名为name的文件是否属于模块
+func (v *Context) isModuleSourceFile(modname *ast.ModuleName, name string) bool {
+	if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".ku") {
+		return false
+	}
+	if strings.HasSuffix(name, testFileSuffix) && !(v.Testing && modname.String() == v.testModuleName()) {
+		return false
+	}
+	if !v.matchesTarget(name) {
+		return false
+	}
+
+	path := strings.Join(append(append([]string{}, modname.Parts[1:]...), name), "/")
+	patterns := v.Excludes
+	if manifest := v.readModuleManifest(modname.Parts[0]); manifest != nil {
+		patterns = append(append([]string{}, patterns...), manifest.Exclude...)
+	}
+	for _, pattern := range patterns {
+		target := path
+		if !strings.Contains(pattern, "/") {
+			target = name
+		}
+		if matched, _ := filepath.Match(pattern, target); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTarget 文件名中的平台后缀是否与目标平台匹配，没有平台后缀的文件总是匹配
+func (v *Context) matchesTarget(name string) bool {
+	parts := strings.Split(strings.TrimSuffix(name, ".ku"), "_")
+	if len(parts) < 2 {
+		return true
+	}
+	targetOS, arch := targetOSArch(LLVMCodegen.TargetTriple(v.Target))
+
+	last := parts[len(parts)-1]
+	if containsString(knownTargetArch, last) {
+		if len(parts) >= 3 && containsString(knownTargetOS, parts[len(parts)-2]) {
+			return parts[len(parts)-2] == targetOS && last == arch
+		}
+		return last == arch
+	}
+	if containsString(knownTargetOS, last) {
+		return last == targetOS
+	}
+	return true
+}
+
+// targetOSArch 从目标三元组中取出操作系统和架构，名字与knownTargetOS和knownTargetArch一致
+func targetOSArch(triple string) (osName, arch string) {
+	parts := strings.Split(triple, "-")
+
+	arch = parts[0]
+	switch {
+	case arch == "aarch64":
+		arch = "arm64"
+	case arch == "i386" || arch == "i486" || arch == "i586" || arch == "i686":
+		arch = "x86"
+	case strings.HasPrefix(arch, "armv") || strings.HasPrefix(arch, "thumbv"):
+		arch = "arm"
+	}
+
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, "macosx") {
+			return "darwin", arch
+		}
+		for _, name := range knownTargetOS {
+			if strings.HasPrefix(part, name) {
+				return name, arch
+			}
+		}
+	}
+	return "", arch
+}
+
+// checkExcludePatterns 检查排除模式的语法，from为模式的来源
+func checkExcludePatterns(patterns []string, from string) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			setupErr("Invalid exclude pattern `%s` in %s: %s", pattern, from, err)
+		}
+	}
+}
+
+// setExcludes 设置 --exclude 给出的排除模式
+func (v *Context) setExcludes(patterns []string) {
+	checkExcludePatterns(patterns, "--exclude")
+	v.Excludes = patterns
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ku-lang/ku/ast"
+)
+
+// 源码根目录与模块目录的映射
+//
+// 默认情况下，模块 a.b.c 的源码在某个搜索路径下的 a/b/c 目录中。顶层模块的清单 ku.json 可以改变这个布局：
+//
+//	{
+//	  "roots": ["third_party", "../shared"],
+//	  "modules": {"app": "src", "app.gen": "../generated/gen"}
+//	}
+//
+// roots 是额外的源码根目录。输入模块的清单中的roots加入搜索路径，用于查找其他顶层模块。
+// modules 把模块映射到目录，子模块在这个目录的相应子目录中，如上面的 app.net.http 在 src/net/http 中，
+// 有多个映射时使用最长的一个。清单只能映射它所属的顶层模块和其中的子模块。
+// 目录都相对于清单所在的目录，清单本身仍然在搜索路径下的顶层模块目录中。
+
+// addManifestRoots 把输入模块的清单中的源码根目录加入搜索路径
+func (v *Context) addManifestRoots() {
+	for _, input := range v.inputRoots() {
+		manifest := v.readModuleManifest(input)
+		if manifest == nil {
+			continue
+		}
+		for _, root := range manifest.Roots {
+			v.Searchpaths = append(v.Searchpaths, filepath.Join(filepath.Dir(manifest.path), root))
+		}
+	}
+}
+
+// findModuleSourceDir 查找模块的源码目录：先使用模块所属的顶层模块的清单中的映射，没有映射时在搜索路径中查找
+func (v *Context) findModuleSourceDir(modname *ast.ModuleName) (os.FileInfo, string, error) {
+	if manifest := v.readModuleManifest(modname.Parts[0]); manifest != nil {
+		if dir, ok := manifest.moduleDir(modname); ok {
+			fi, err := os.Stat(dir)
+			if err != nil {
+				return nil, "", fmt.Errorf("ku: Unable to find module `%s` in `%s`, as mapped by `%s`", modname, dir, manifest.path)
+			}
+			return fi, dir, nil
+		}
+	}
+	return v.findModuleDir(modname.ToPath())
+}
+
+// moduleDir 清单把模块modname映射到的目录
+func (v *moduleManifest) moduleDir(modname *ast.ModuleName) (string, bool) {
+	for n := len(modname.Parts); n > 0; n-- {
+		dir, ok := v.Modules[strings.Join(modname.Parts[:n], ".")]
+		if !ok {
+			continue
+		}
+		parts := append([]string{filepath.Dir(v.path), dir}, modname.Parts[n:]...)
+		return filepath.Join(parts...), true
+	}
+	return "", false
+}
+
+// checkModules 检查清单中的映射：只能映射顶层模块root和其中的子模块，目录不能为空
+func (v *moduleManifest) checkModules(root string) {
+	for name, dir := range v.Modules {
+		if name != root && !strings.HasPrefix(name, root+".") {
+			setupErr("Module `%s` mapped in `%s` isn't part of module `%s`", name, v.path, root)
+		}
+		if dir == "" {
+			setupErr("Module `%s` is mapped to an empty directory in `%s`", name, v.path)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ku-lang/ku/ast"
+	"github.com/ku-lang/ku/codegen"
+	"github.com/ku-lang/ku/lexer"
+	"github.com/ku-lang/ku/parser"
+	"github.com/ku-lang/ku/util"
+	"github.com/ku-lang/ku/util/log"
+)
+
+// 测试运行器（ku test）
+//
+// 测试函数是输入模块中名称以 test_ 开头、或者标注了 [test] 的顶层函数，没有参数和返回值，不是方法或泛型函数，
+// 也不是只在所在文件中可见的（priv）。名称以 test_ 开头但不满足这些条件的函数是测试的辅助函数，不作为测试运行；
+// 标注了 [test] 的函数不满足条件时报错。测试时输入模块目录中的测试文件 x_test.ku 也会编译（参见sourcefiles.go）。
+//
+// 语法分析之后、构建AST之前，输入模块自己的main函数改名为 __test_user_main，再加入一个生成的源文件：
+// 它的main函数按环境变量 KU_TEST 给出的序号调用一个测试函数（参见runtime.ku的 __test_index）。
+// 编译出的程序对每个测试运行一次，以0退出的测试通过；panic或以其它退出码结束的测试失败，报告它的位置和输出。
+
+const (
+	testHarnessName  = "__test_main"
+	testUserMainName = "__test_user_main"
+	testIndexEnv     = "KU_TEST"
+)
+
+// testFunction 发现的一个测试函数
+type testFunction struct {
+	name  string
+	where lexer.Span
+}
+
+// Test 编译并运行输入模块中名称包含filter的测试（filter为空时运行全部测试），返回ku test的退出码
+func (v *Context) Test(optLevel int, filter string) int {
+	dir, err := ioutil.TempDir("", "ku-test")
+	if err != nil {
+		setupErr("Couldn't create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	v.Testing = true
+	output := filepath.Join(dir, "test")
+	v.Build(output, codegen.OutputExectuably, "llvm", optLevel)
+
+	if runtime.GOOS == "windows" {
+		output += ".exe"
+	}
+
+	failed, ran := 0, 0
+	for idx, test := range v.tests {
+		if !strings.Contains(test.name, filter) {
+			continue
+		}
+		ran++
+
+		start := time.Now()
+		out, code := runTest(output, idx)
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		if code == 0 {
+			fmt.Printf("%s %s (%s)\n", util.Green("PASS"), test.name, elapsed)
+			continue
+		}
+		failed++
+		fmt.Printf("%s %s [%s:%d] exit code %d (%s)\n", util.Red("FAIL"), test.name,
+			test.where.Filename, test.where.StartLine, code, elapsed)
+		for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+			if line != "" {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	switch {
+	case ran == 0:
+		fmt.Println("no tests to run")
+	case failed > 0:
+		fmt.Printf("%s: %d of %d tests failed\n", util.Red("FAIL"), failed, ran)
+		return 1
+	default:
+		fmt.Printf("%s: %d tests passed\n", util.Green("ok"), ran)
+	}
+	return 0
+}
+
+// runTest 运行测试程序中序号为idx的测试，返回它的输出和退出码。被信号终止时退出码是 128+信号编号
+func runTest(program string, idx int) ([]byte, int) {
+	cmd := exec.Command(program)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", testIndexEnv, idx))
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				return out.Bytes(), 128 + int(status.Signal())
+			}
+			return out.Bytes(), exitErr.ExitCode()
+		}
+		log.Error(log.TagMain, util.Red("error: ")+"Couldn't run `%s`: %s\n", program, err)
+		os.Exit(1)
+	}
+	return out.Bytes(), 0
+}
+
+// testModuleName 要测试的模块：源文件合并成的 __main 模块，或者输入的模块
+func (v *Context) testModuleName() string {
+	if strings.HasSuffix(v.Inputs[0], ".ku") {
+		return "__main"
+	}
+	return v.Inputs[0]
+}
+
+// addTestHarness 在输入模块中查找测试函数，改名模块自己的main函数，并加入运行测试的main函数
+func (v *Context) addTestHarness() {
+	var module *ast.Module
+	for _, mod := range v.modules {
+		if mod.Name.String() == v.testModuleName() {
+			module = mod
+		}
+	}
+	if module == nil || module.Interface {
+		setupErr("No source files to test in module `%s`", v.testModuleName())
+	}
+
+	for _, tree := range module.Trees {
+		for _, node := range tree.Nodes {
+			decl, ok := node.(*parser.FunctionDeclNode)
+			if !ok {
+				continue
+			}
+			header := decl.Function.Header
+			isTest := decl.Attrs().Contains("test")
+			if !isTest && !strings.HasPrefix(header.Name.Value, "test_") {
+				if header.Name.Value == "main" && header.Receiver == nil && header.StaticReceiverType == nil {
+					header.Name.Value = testUserMainName
+				}
+				continue
+			}
+
+			if reason := testFunctionProblem(decl); reason != "" {
+				if isTest {
+					where := header.Name.Where
+					setupErr("[%s:%d:%d] Test function `%s` %s", where.Filename, where.StartLine, where.StartChar,
+						header.Name.Value, reason)
+				}
+				continue
+			}
+			v.tests = append(v.tests, &testFunction{name: header.Name.Value, where: header.Name.Where})
+		}
+	}
+
+	// 生成的main函数：序号不在范围内时什么也不运行
+	var buf bytes.Buffer
+	buf.WriteString("pub fun main() int {\n\tlet index = __test_index()\n")
+	for idx, test := range v.tests {
+		fmt.Fprintf(&buf, "\tif index == %d {\n\t\t%s()\n\t\treturn 0\n\t}\n", idx, test.name)
+	}
+	buf.WriteString("\treturn 0\n}\n")
+
+	sourcefile := &lexer.Sourcefile{
+		Name:     testHarnessName,
+		Path:     testHarnessName + ".ku",
+		Contents: []rune(buf.String()),
+		NewLines: []int{-1, -1},
+	}
+	recordSource(sourcefile)
+	v.parseSourcefile(sourcefile, module)
+}
+
+// testFunctionProblem 函数不能作为测试的原因，可以作为测试时返回空串
+func testFunctionProblem(decl *parser.FunctionDeclNode) string {
+	header := decl.Function.Header
+	switch {
+	case header.Receiver != nil || header.StaticReceiverType != nil:
+		return "cannot be a method"
+	case header.GenericSigil != nil:
+		return "cannot be generic"
+	case len(header.Arguments) > 0 || header.Variadic:
+		return "cannot have parameters"
+	case header.ReturnType != nil:
+		return "cannot return a value"
+	case decl.IsFilePrivate():
+		return "cannot be file private"
+	case decl.Function.Body == nil && decl.Function.Stat == nil && decl.Function.Expr == nil:
+		return "must have a body"
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+#!/bin/sh
+# 类型推导的规模测试：生成语句数不同的大函数，记录 ku build 中 inference phase 的用时
+#
+# 用法：tests/bench/infer.sh [组数...]，默认 1000 2000 4000 8000，每组3条语句
+#
+# 编译器是PATH中的ku，或者环境变量KU给出的编译器；只做前端（--codegen=none），不需要链接器。
+# 生成的函数中每条语句都引入新的类型变量（泛型函数的实参、泛型结构的成员、推导类型的局部变量），
+# 并且与前一条语句的变量有约束，所有约束都在同一个函数中求解（参见 ast.Inferrer.Solve）。
+# 语句数加倍时用时也接近加倍说明求解是线性的，接近4倍说明是平方的。比较两个编译器时分别运行：
+#
+#   KU=/path/to/old/ku tests/bench/infer.sh
+#   KU=/path/to/new/ku tests/bench/infer.sh
+
+KU=${KU:-ku}
+sizes=${*:-1000 2000 4000 8000}
+
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+# generate n 输出有n组语句的 main 函数
+generate() {
+	awk -v n="$1" 'BEGIN {
+		print "type Box struct<T> {"
+		print "\tv T,"
+		print "}"
+		print ""
+		print "fun id<T>(x T) T {"
+		print "\treturn x"
+		print "}"
+		print ""
+		print "fun unbox<T>(b Box<T>, other T) T {"
+		print "\treturn b.v"
+		print "}"
+		print ""
+		print "pub fun main() int {"
+		print "\tlet x0 int = 0"
+		print "\tlet y0 = id<int>(x0)"
+		for (i = 1; i <= n; i++) {
+			printf "\tlet x%d = id<int>(x%d) + 1\n", i, i - 1
+			printf "\tlet b%d = Box<int>{v: x%d}\n", i, i
+			printf "\tlet y%d int = unbox(b%d, y%d)\n", i, i, i - 1
+		}
+		printf "\treturn y%d - y%d\n", n, n
+		print "}"
+	}'
+}
+
+printf "%10s %14s\n" "statements" "inference(ms)"
+for n in $sizes; do
+	src="$work/bench_$n.ku"
+	generate "$n" > "$src"
+
+	log=$(cd "$work" && "$KU" --loglevel=verbose build --codegen=none --unused -o "bench_$n" "$src" 2>&1)
+	if [ $? -ne 0 ]; then
+		printf "%s\n" "$log" | tail -n 20
+		echo "build failed for $n statements"
+		exit 1
+	fi
+
+	# 去掉颜色，取 "Ended inference phase (12.34ms)" 中的用时
+	ms=$(printf "%s\n" "$log" | sed 's/\x1b\[[0-9;]*m//g' |
+		sed -n 's/.*Ended inference phase (\([0-9.]*\)ms).*/\1/p' | head -n 1)
+	printf "%10d %14s\n" "$((n * 3 + 3))" "$ms"
+done
@@ -0,0 +1,261 @@
+#!/bin/sh
+# 编译器的回归测试
+#
+# 用法：tests/run.sh [测试文件...]，不给出测试文件时运行 tests 下的全部测试。
+# 环境变量 KU 是要测试的编译器，默认是PATH中的 ku；CC 是abi测试用的C编译器，默认是 cc。
+#
+# 测试是ku源文件，按所在的目录分类，文件中 // 开头的指令行给出期望的结果，都是子串匹配：
+#   run/    编译并运行，程序以0退出，标准输出与 // OUTPUT: 行逐行相同
+#   error/  编译失败，编译器的输出包含每个 // ERROR: 行
+#   ir/     对每个 // TARGET:（没有时为本机）生成 __main 模块的LLVM IR，其中依次出现每个 // CHECK: 行；
+#           // CHECK-NOT: 行不能出现在它前后两个 CHECK 匹配的行之间。{{.*}} 匹配一行中任意的内容
+#   abi/    对每个 // TARGET:（没有时为本机）用 ku abitest 检查文件中 [layout(c)] 类型的布局与C编译器的相同。
+#           CC 是clang时可以检查所有的目标，否则只检查本机的目标，其他目标跳过
+# modules/ 中是测试用到的模块，编译时在其中查找 use 引入的模块。
+#
+# // REQUIRES: 给出测试适用的系统（uname -s 的输出，如 Linux），其他系统上跳过这个测试
+
+dir=$(dirname "$0")
+KU=${KU:-ku}
+CC=${CC:-cc}
+tmp=$(mktemp -d) || exit 1
+trap 'rm -rf "$tmp"' EXIT
+esc=$(printf '\033')
+
+passed=0
+failed=0
+skipped=0
+system=$(uname -s)
+
+# 本机对应的目标预设
+case "$system-$(uname -m)" in
+Linux-x86_64) host_target=linux-x86_64 ;;
+Linux-aarch64) host_target=linux-arm64 ;;
+Linux-riscv64) host_target=linux-riscv64 ;;
+*) host_target=native ;;
+esac
+
+# directive 测试文件中指令 // $1: 之后的内容，每行一个
+directive() {
+	sed -n "s|^[[:space:]]*// $1: \{0,1\}||p" "$test"
+}
+
+pass() {
+	passed=$((passed + 1))
+}
+
+# fail 报告失败的原因$1，以及文件$2中的详细信息
+fail() {
+	echo "FAIL $test: $1"
+	if [ -n "$2" ]; then
+		sed 's/^/    /' "$2"
+	fi
+	failed=$((failed + 1))
+}
+
+# compile 编译测试文件，参数传给 ku build。编译器的输出去掉颜色之后在 $tmp/log 中
+compile() {
+	rm -rf "$tmp/out"
+	mkdir "$tmp/out"
+	"$KU" build --unused -I "$dir/modules" -o "$tmp/out/test" "$@" "$test" >"$tmp/log.raw" 2>&1
+	status=$?
+	sed "s/$esc\[[0-9;]*m//g" "$tmp/log.raw" >"$tmp/log"
+	return $status
+}
+
+run_test() {
+	if ! compile; then
+		fail "compile error" "$tmp/log"
+		return
+	fi
+
+	exe="$tmp/out/test"
+	if [ -f "$exe.exe" ]; then
+		exe="$exe.exe"
+	fi
+	"$exe" >"$tmp/stdout" 2>"$tmp/stderr" </dev/null
+	status=$?
+
+	directive OUTPUT >"$tmp/expected"
+	if [ $status -ne 0 ]; then
+		fail "exit status $status" "$tmp/stderr"
+	elif ! diff "$tmp/expected" "$tmp/stdout" >"$tmp/diff"; then
+		fail "unexpected output" "$tmp/diff"
+	else
+		pass
+	fi
+}
+
+error_test() {
+	if compile; then
+		fail "compiled without errors"
+		return
+	fi
+
+	directive ERROR >"$tmp/expected"
+	: >"$tmp/missing"
+	while IFS= read -r line; do
+		if ! grep -qF -- "$line" "$tmp/log"; then
+			echo "missing: $line" >>"$tmp/missing"
+		fi
+	done <"$tmp/expected"
+
+	if [ -s "$tmp/missing" ]; then
+		cat "$tmp/log" >>"$tmp/missing"
+		fail "expected errors not reported" "$tmp/missing"
+	else
+		pass
+	fi
+}
+
+ir_test() {
+	targets=$(directive TARGET)
+	for target in ${targets:-native}; do
+		if [ "$target" = native ]; then
+			set --
+		else
+			set -- --target="$target"
+		fi
+
+		if ! compile --output-type=llvm-ir "$@"; then
+			fail "[$target] compile error" "$tmp/log"
+			continue
+		fi
+		cat "$tmp"/out/test-*__main*.ll >"$tmp/ir" 2>/dev/null
+
+		if check_ir >"$tmp/check"; then
+			pass
+		else
+			fail "[$target] IR doesn't match" "$tmp/check"
+		fi
+	done
+}
+
+abi_test() {
+	targets=$(directive TARGET)
+	for target in ${targets:-native}; do
+		if [ "$target" = native ]; then
+			set --
+		else
+			case $(basename "$CC") in
+			*clang*) ;;
+			*)
+				if [ "$target" != "$host_target" ]; then
+					skipped=$((skipped + 1))
+					continue
+				fi
+				;;
+			esac
+			set -- --target="$target"
+		fi
+
+		if "$KU" abitest --cc="$CC" "$@" "$test" >"$tmp/log.raw" 2>&1; then
+			pass
+		else
+			sed "s/$esc\[[0-9;]*m//g" "$tmp/log.raw" >"$tmp/log"
+			fail "[$target] layouts don't match C" "$tmp/log"
+		fi
+	done
+}
+
+# check_ir 在 $tmp/ir 中依次匹配测试文件中的 CHECK 和 CHECK-NOT，不匹配时输出原因
+check_ir() {
+	awk -v test="$test" '
+	BEGIN {
+		while ((getline line < test) > 0) {
+			if (line ~ /^[ \t]*\/\/ CHECK-NOT:/) {
+				sub(/^[ \t]*\/\/ CHECK-NOT: ?/, "", line)
+				kind[++n] = "not"
+				pattern[n] = line
+			} else if (line ~ /^[ \t]*\/\/ CHECK:/) {
+				sub(/^[ \t]*\/\/ CHECK: ?/, "", line)
+				kind[++n] = "check"
+				pattern[n] = line
+			}
+		}
+	}
+
+	{ ir[NR] = $0 }
+
+	# line中依次出现pat被 {{.*}} 分开的每一段
+	function matches(line, pat,    parts, count, k, at) {
+		count = split(pat, parts, /\{\{\.\*\}\}/)
+		for (k = 1; k <= count; k++) {
+			if (parts[k] == "") {
+				continue
+			}
+			at = index(line, parts[k])
+			if (at == 0) {
+				return 0
+			}
+			line = substr(line, at + length(parts[k]))
+		}
+		return 1
+	}
+
+	# 第from行到第to行中不能出现 CHECK-NOT 的内容
+	function check_nots(from, to,    k, j) {
+		for (k = 1; k <= nots; k++) {
+			for (j = from; j <= to; j++) {
+				if (matches(ir[j], forbidden[k])) {
+					printf "CHECK-NOT: %s\nmatched line %d: %s\n", forbidden[k], j, ir[j]
+					return 0
+				}
+			}
+		}
+		return 1
+	}
+
+	END {
+		pos = 1
+		nots = 0
+		for (i = 1; i <= n; i++) {
+			if (kind[i] == "not") {
+				forbidden[++nots] = pattern[i]
+				continue
+			}
+			for (j = pos; j <= NR && !matches(ir[j], pattern[i]); j++) {
+			}
+			if (j > NR) {
+				printf "CHECK: %s\nnot found after line %d\n", pattern[i], pos
+				exit 1
+			}
+			if (!check_nots(pos, j - 1)) {
+				exit 1
+			}
+			pos = j + 1
+			nots = 0
+		}
+		if (!check_nots(pos, NR)) {
+			exit 1
+		}
+	}' "$tmp/ir"
+}
+
+if [ $# -eq 0 ]; then
+	set -- "$dir"/run/*.ku "$dir"/error/*.ku "$dir"/ir/*.ku "$dir"/abi/*.ku
+fi
+
+for test in "$@"; do
+	# 没有测试的目录
+	if [ ! -f "$test" ]; then
+		continue
+	fi
+
+	required=$(directive REQUIRES)
+	if [ -n "$required" ] && [ "$required" != "$system" ]; then
+		skipped=$((skipped + 1))
+		continue
+	fi
+
+	case $test in
+	*run/*.ku) run_test ;;
+	*error/*.ku) error_test ;;
+	*ir/*.ku) ir_test ;;
+	*abi/*.ku) abi_test ;;
+	*) fail "not in a test directory" ;;
+	esac
+done
+
+echo "$passed passed, $failed failed, $skipped skipped"
+[ $failed -eq 0 ]
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ku-lang/ku/kuast"
+)
+
+// 带类型的语法树（.kuast）。
+//
+// build --emit-typed-ast 在语义检查之后，为每个从源码编译的模块在 .ku-build/cache 下写入分析结果，
+// 路径与模块名对应，如 a.b.c 对应 a/b/c.kuast。工具用 kuast.Load 读入，源文件改变或者文件格式改变时
+// Load 返回 *kuast.StaleError，需要重新分析。目前 ku lsp 在分析得不到类型时用它回答悬停（参见 lsp.go 的 cachedHover）
+
+// writeTypedASTs 为所有从源码编译的模块写入带类型的语法树
+func (v *Context) writeTypedASTs() {
+	for _, module := range v.modules {
+		if module.Interface {
+			continue
+		}
+
+		path := filepath.Join(v.TypedASTDir, module.Name.ToPath()+kuast.Extension)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			setupErr("%s", err)
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			setupErr("%s", err)
+		}
+		err = kuast.Extract(module, VERSION).Write(file)
+		file.Close()
+		if err != nil {
+			setupErr("Couldn't write typed AST file `%s`: %s", path, err)
+		}
+	}
+}
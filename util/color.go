@@ -2,6 +2,7 @@ package util
 
 import (
 	"os"
+	"regexp"
 	"runtime"
 )
 
@@ -67,3 +68,10 @@ func Cyan(s string) string {
 func White(s string) string {
 	return TEXT_WHITE + s + TEXT_RESET
 }
+
+var colorCodes = regexp.MustCompile("\x1B\\[[0-9;]*m")
+
+// StripColors 去掉字符串中的颜色控制符
+func StripColors(s string) string {
+	return colorCodes.ReplaceAllString(s, "")
+}
@@ -1,5 +1,7 @@
 package util
 
+import "os"
+
 const (
 	EXIT_SUCCESS int = iota
 	EXIT_FAILURE_SETUP
@@ -7,4 +9,9 @@ const (
 	EXIT_FAILURE_CONSTRUCTOR
 	EXIT_FAILURE_SEMANTIC
 	EXIT_FAILURE_CODEGEN
+	EXIT_FAILURE_INTERNAL // 内部编译错误（ICE）
 )
+
+// ExitFunc 编译出错时调用的退出函数，默认是os.Exit。
+// ku reduce 和 ku lsp 把它替换为panic，以便在源码有错误时继续运行
+var ExitFunc = os.Exit
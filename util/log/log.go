@@ -1,9 +1,12 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ku-lang/ku/util"
 )
@@ -27,12 +30,14 @@ var LevelMap = map[string]LogLevel{
 }
 
 var currentLevel LogLevel
-var enabledTags map[string]bool
+var enabledTags map[Tag]bool
 var enableAll bool
+var jsonFormat bool
+var output io.Writer = os.Stdout
 
 func init() {
 	currentLevel = LevelInfo
-	enabledTags = make(map[string]bool)
+	enabledTags = make(map[Tag]bool)
 	enableAll = false
 }
 
@@ -47,74 +52,134 @@ func SetLevel(level string) {
 }
 
 func SetTags(tags string) {
-	enabledTags = make(map[string]bool)
+	enabledTags = make(map[Tag]bool)
 	enableAll = false
 
 	for _, tag := range strings.Split(tags, ",") {
 		if tag == "all" {
 			enableAll = true
+		} else if IsTag(tag) {
+			enabledTags[Tag(tag)] = true
 		} else {
-			enabledTags[tag] = true
+			fmt.Printf("Invalid log tag `%s`, use --logtags=list to see the available tags\n", tag)
+			os.Exit(util.EXIT_FAILURE_SETUP)
 		}
 	}
 }
 
+// SetFormat 设置日志输出格式：text 原样输出；json 每条日志输出一行JSON对象，方便在CI中收集和过滤
+func SetFormat(format string) {
+	switch format {
+	case "text":
+		jsonFormat = false
+	case "json":
+		jsonFormat = true
+	default:
+		fmt.Println("Invalid log format")
+		os.Exit(util.EXIT_FAILURE_SETUP)
+	}
+}
+
+// SetOutput 设置日志的输出位置，默认是标准输出。ku lsp 用标准输出通信，日志另行收集
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 func AtLevel(level LogLevel) bool {
 	return level >= currentLevel
 }
 
-func Log(level LogLevel, tag string, msg string, args ...interface{}) {
+func Log(level LogLevel, tag Tag, msg string, args ...interface{}) {
 	if !enableAll {
 		if !enabledTags[tag] {
 			return
 		}
 	}
 
-	if AtLevel(level) {
-		fmt.Printf(msg, args...)
+	if !AtLevel(level) {
+		return
+	}
+
+	if jsonFormat {
+		logJSON(level, tag, fmt.Sprintf(msg, args...))
+	} else {
+		fmt.Fprintf(output, msg, args...)
+	}
+}
+
+type jsonRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Tag     Tag    `json:"tag"`
+	Message string `json:"msg"`
+}
+
+// logJSON 输出一条JSON日志。去掉颜色控制符和首尾空白，只有空白的消息（比如缩进）不输出
+func logJSON(level LogLevel, tag Tag, msg string) {
+	msg = strings.TrimSpace(util.StripColors(msg))
+	if msg == "" {
+		return
+	}
+
+	var levelName string
+	for name, lvl := range LevelMap {
+		if lvl == level {
+			levelName = name
+		}
+	}
+
+	data, err := json.Marshal(jsonRecord{
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Level:   levelName,
+		Tag:     tag,
+		Message: msg,
+	})
+	if err != nil {
+		panic(err)
 	}
+	fmt.Fprintln(output, string(data))
 }
 
-func Logln(level LogLevel, tag string, msg string, args ...interface{}) {
+func Logln(level LogLevel, tag Tag, msg string, args ...interface{}) {
 	Log(level, tag, msg+"\n", args...)
 }
 
-func Debug(tag string, msg string, args ...interface{}) {
+func Debug(tag Tag, msg string, args ...interface{}) {
 	Log(LevelDebug, tag, msg, args...)
 }
 
-func Debugln(tag string, msg string, args ...interface{}) {
+func Debugln(tag Tag, msg string, args ...interface{}) {
 	Logln(LevelDebug, tag, msg, args...)
 }
 
-func Verbose(tag string, msg string, args ...interface{}) {
+func Verbose(tag Tag, msg string, args ...interface{}) {
 	Log(LevelVerbose, tag, msg, args...)
 }
 
-func Verboseln(tag string, msg string, args ...interface{}) {
+func Verboseln(tag Tag, msg string, args ...interface{}) {
 	Logln(LevelVerbose, tag, msg, args...)
 }
 
-func Info(tag string, msg string, args ...interface{}) {
+func Info(tag Tag, msg string, args ...interface{}) {
 	Log(LevelInfo, tag, msg, args...)
 }
 
-func Infoln(tag string, msg string, args ...interface{}) {
+func Infoln(tag Tag, msg string, args ...interface{}) {
 	Logln(LevelInfo, tag, msg, args...)
 }
 
-func Warning(tag string, msg string, args ...interface{}) {
+func Warning(tag Tag, msg string, args ...interface{}) {
 	Log(LevelWarning, tag, msg, args...)
 }
 
-func Warningln(tag string, msg string, args ...interface{}) {
+func Warningln(tag Tag, msg string, args ...interface{}) {
 	Logln(LevelWarning, tag, msg, args...)
 }
 
-func Error(tag string, msg string, args ...interface{}) {
+func Error(tag Tag, msg string, args ...interface{}) {
 	Log(LevelError, tag, msg, args...)
 }
 
-func Errorln(tag string, msg string, args ...interface{}) {
+func Errorln(tag Tag, msg string, args ...interface{}) {
 	Logln(LevelError, tag, msg, args...)
 }
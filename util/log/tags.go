@@ -0,0 +1,54 @@
+package log
+
+// Tag 日志标签。编译器中用到的所有标签都要在 tagInfos 中登记，
+// --logtags 只接受登记过的标签，--logtags=list 会列出它们
+type Tag string
+
+const (
+	TagMain        Tag = "main"
+	TagLexer       Tag = "lexer"
+	TagParser      Tag = "parser"
+	TagConstructor Tag = "constructor"
+	TagResolve     Tag = "resolve"
+	TagInference   Tag = "inference"
+	TagInferrer    Tag = "inferrer"
+	TagRuntime     Tag = "runtime"
+	TagSemantic    Tag = "semantic"
+	TagCodegen     Tag = "codegen"
+	TagDocgen      Tag = "docgen"
+)
+
+type TagInfo struct {
+	Tag         Tag
+	Description string
+}
+
+// 按编译流程的顺序排列
+var tagInfos = []TagInfo{
+	{TagMain, "Driver progress, timings and setup messages"},
+	{TagLexer, "Tokens produced by the lexer"},
+	{TagParser, "Parse tree and parser errors"},
+	{TagConstructor, "Construction of the AST from the parse tree"},
+	{TagResolve, "Name resolution"},
+	{TagInference, "Type inference progress"},
+	{TagInferrer, "Type inference errors"},
+	{TagRuntime, "Loading of runtime types"},
+	{TagSemantic, "Semantic checks"},
+	{TagCodegen, "Code generation and linking"},
+	{TagDocgen, "Documentation generation"},
+}
+
+// Tags 返回所有登记的日志标签
+func Tags() []TagInfo {
+	return tagInfos
+}
+
+// IsTag 名字是否是登记过的日志标签
+func IsTag(name string) bool {
+	for _, info := range tagInfos {
+		if string(info.Tag) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -20,8 +20,8 @@ func Timed(titleColored, titleUncolored string, fn func()) {
 		titleUncolored = " " + titleUncolored
 	}
 
-	Verbose("main", strings.Repeat(" ", indent))
-	Verboseln("main", bold+util.TEXT_GREEN+"Started "+titleColored+util.TEXT_RESET+titleUncolored)
+	Verbose(TagMain, strings.Repeat(" ", indent))
+	Verboseln(TagMain, bold+util.TEXT_GREEN+"Started "+titleColored+util.TEXT_RESET+titleUncolored)
 	start := time.Now()
 
 	indent++
@@ -29,6 +29,6 @@ func Timed(titleColored, titleUncolored string, fn func()) {
 	indent--
 
 	duration := time.Since(start)
-	Verbose("main", strings.Repeat(" ", indent))
-	Verboseln("main", bold+util.TEXT_GREEN+"Ended "+titleColored+util.TEXT_RESET+titleUncolored+" (%.2fms)", float32(duration)/1000000)
+	Verbose(TagMain, strings.Repeat(" ", indent))
+	Verboseln(TagMain, bold+util.TEXT_GREEN+"Ended "+titleColored+util.TEXT_RESET+titleUncolored+" (%.2fms)", float32(duration)/1000000)
 }
@@ -0,0 +1,218 @@
+// Package semver 解析语义化版本号（major.minor.patch[-prerelease]）和版本范围。
+//
+// 版本范围由 || 分隔的若干组条件组成，满足任意一组即可；组内的条件以空格分隔，必须同时满足。条件可以是：
+//
+//	1.2.3  =1.2.3        等于该版本
+//	>1.2.3 >=1.2.3 <1.2.3 <=1.2.3
+//	^1.2.3               与该版本兼容：不低于该版本，且第一个非0的部分相同，如 ^0.2.3 即 >=0.2.3 <0.3.0
+//	~1.2.3               不低于该版本，且主版本号和次版本号相同
+//	*                    任意版本
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version 语义化版本号。构建元数据（+之后的部分）被忽略
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // 预发布版本，如 beta.1
+}
+
+// Parse 解析版本号，可以带有前缀v
+func Parse(s string) (Version, error) {
+	str := strings.TrimPrefix(s, "v")
+	if idx := strings.IndexByte(str, '+'); idx >= 0 {
+		str = str[:idx]
+	}
+
+	var res Version
+	if idx := strings.IndexByte(str, '-'); idx >= 0 {
+		res.Pre = str[idx+1:]
+		str = str[:idx]
+		if res.Pre == "" {
+			return Version{}, fmt.Errorf("invalid version `%s`: empty prerelease", s)
+		}
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version `%s`: expected major.minor.patch", s)
+	}
+	nums := []*int{&res.Major, &res.Minor, &res.Patch}
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 || part == "" || (len(part) > 1 && part[0] == '0') {
+			return Version{}, fmt.Errorf("invalid version `%s`: `%s` is not a number", s, part)
+		}
+		*nums[i] = num
+	}
+	return res, nil
+}
+
+func (v Version) String() string {
+	res := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		res += "-" + v.Pre
+	}
+	return res
+}
+
+// Compare 比较两个版本，v小于、等于、大于other时分别返回-1、0、1。预发布版本小于对应的正式版本
+func (v Version) Compare(other Version) int {
+	if c := compareInt(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Pre, "."), strings.Split(other.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		an, aerr := strconv.Atoi(a[i])
+		bn, berr := strconv.Atoi(b[i])
+		var c int
+		switch {
+		case aerr == nil && berr == nil:
+			c = compareInt(an, bn)
+		case aerr == nil: // 数字小于字符串
+			c = -1
+		case berr == nil:
+			c = 1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Range 版本范围
+type Range struct {
+	str  string
+	sets [][]comparator
+}
+
+type comparator struct {
+	op  string // = > >= < <=
+	ver Version
+}
+
+// ParseRange 解析版本范围
+func ParseRange(s string) (*Range, error) {
+	res := &Range{str: strings.TrimSpace(s)}
+	for _, group := range strings.Split(s, "||") {
+		if strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("invalid version range `%s`: empty condition", s)
+		}
+
+		var set []comparator
+		for _, cond := range strings.Fields(group) {
+			comps, err := parseCondition(cond)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version range `%s`: %s", s, err)
+			}
+			set = append(set, comps...)
+		}
+		res.sets = append(res.sets, set)
+	}
+	return res, nil
+}
+
+func parseCondition(cond string) ([]comparator, error) {
+	if cond == "*" {
+		return nil, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if !strings.HasPrefix(cond, op) {
+			continue
+		}
+		ver, err := Parse(cond[len(op):])
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "^":
+			var upper Version
+			switch {
+			case ver.Major > 0:
+				upper = Version{Major: ver.Major + 1}
+			case ver.Minor > 0:
+				upper = Version{Minor: ver.Minor + 1}
+			default:
+				upper = Version{Patch: ver.Patch + 1}
+			}
+			return []comparator{{">=", ver}, {"<", upper}}, nil
+		case "~":
+			return []comparator{{">=", ver}, {"<", Version{Major: ver.Major, Minor: ver.Minor + 1}}}, nil
+		}
+		return []comparator{{op, ver}}, nil
+	}
+
+	ver, err := Parse(cond)
+	if err != nil {
+		return nil, err
+	}
+	return []comparator{{"=", ver}}, nil
+}
+
+// Contains 版本ver是否在范围之内
+func (v *Range) Contains(ver Version) bool {
+	for _, set := range v.sets {
+		ok := true
+		for _, comp := range set {
+			ok = ok && comp.matches(ver)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (v comparator) matches(ver Version) bool {
+	c := ver.Compare(v.ver)
+	switch v.op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return c == 0
+}
+
+func (v *Range) String() string {
+	return v.str
+}